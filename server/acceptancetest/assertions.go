@@ -1,12 +1,15 @@
 package acceptancetest
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wikisophia/api/server/http/problems"
 )
 
 func AssertBadRequest(t *testing.T, method, path, body string) {
@@ -14,6 +17,7 @@ func AssertBadRequest(t *testing.T, method, path, body string) {
 	a := NewApp(t, nil)
 	rr := a.Do(httptest.NewRequest(method, path, strings.NewReader(body)))
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Equal(t, problems.ContentType, rr.Header().Get("Content-Type"))
 }
 
 func AssertMethodNotAllowed(t *testing.T, method, path string) {
@@ -21,4 +25,15 @@ func AssertMethodNotAllowed(t *testing.T, method, path string) {
 	a := NewApp(t, nil)
 	rr := a.Do(httptest.NewRequest(method, path, nil))
 	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	assert.Equal(t, problems.CodeMethodNotAllowed, ParseProblem(t, rr).Code)
+}
+
+// ParseProblem makes sure the response is an application/problem+json error, and returns its body.
+func ParseProblem(t *testing.T, rr *httptest.ResponseRecorder) problems.Problem {
+	t.Helper()
+	assert.Equal(t, problems.ContentType, rr.Header().Get("Content-Type"))
+	var problem problems.Problem
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &problem))
+	assert.Equal(t, rr.Code, problem.Status)
+	return problem
 }
@@ -3,18 +3,37 @@ package acceptancetest
 import (
 	"context"
 	"errors"
+	"sync"
+	"time"
 
 	"github.com/wikisophia/api/server/accounts"
 )
 
+// Emailer records the emails the app sends. It's safe for concurrent use,
+// but the slices should only be read once the requests which send emails are done.
 type Emailer struct {
 	shouldSucceed bool
+	mutex         sync.Mutex
 
 	Welcomes       []*accounts.Account
 	PasswordResets []*accounts.Account
+	Verifications  []*accounts.Account
+	Locks          []Lock
+	// EmailChanges go to the email an account is moving to.
+	EmailChanges []*accounts.Account
+	// EmailChangeNotices go to the email an account is moving from.
+	EmailChangeNotices []*accounts.Account
+}
+
+// Lock is an email which said that an account was locked.
+type Lock struct {
+	Account accounts.Account
+	Until   time.Time
 }
 
 func (e *Emailer) SendWelcome(ctx context.Context, account accounts.Account) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
 	e.Welcomes = append(e.Welcomes, &account)
 	if e.shouldSucceed {
 		return nil
@@ -23,9 +42,51 @@ func (e *Emailer) SendWelcome(ctx context.Context, account accounts.Account) err
 }
 
 func (e *Emailer) SendReset(ctx context.Context, account accounts.Account) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
 	e.PasswordResets = append(e.PasswordResets, &account)
 	if e.shouldSucceed {
 		return nil
 	}
 	return errors.New("Password reset message failed to send")
 }
+
+func (e *Emailer) SendVerification(ctx context.Context, account accounts.Account) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.Verifications = append(e.Verifications, &account)
+	if e.shouldSucceed {
+		return nil
+	}
+	return errors.New("Email verification message failed to send")
+}
+
+func (e *Emailer) SendLocked(ctx context.Context, account accounts.Account, until time.Time) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.Locks = append(e.Locks, Lock{Account: account, Until: until})
+	if e.shouldSucceed {
+		return nil
+	}
+	return errors.New("Account locked message failed to send")
+}
+
+func (e *Emailer) SendEmailChange(ctx context.Context, account accounts.Account) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.EmailChanges = append(e.EmailChanges, &account)
+	if e.shouldSucceed {
+		return nil
+	}
+	return errors.New("Email change message failed to send")
+}
+
+func (e *Emailer) SendEmailChangeNotice(ctx context.Context, account accounts.Account) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.EmailChangeNotices = append(e.EmailChangeNotices, &account)
+	if e.shouldSucceed {
+		return nil
+	}
+	return errors.New("Email change notice failed to send")
+}
@@ -0,0 +1,126 @@
+package acceptancetest
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// ReceivedEmail is an email which an email.FileEmailer wrote.
+type ReceivedEmail struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Link is a link from an email, like the one to reset a password.
+type Link struct {
+	URL   *url.URL
+	ID    int64
+	Token string
+}
+
+// LatestEmail reads the newest .eml file in dir which was sent to address.
+// It fails the test if there isn't one.
+func LatestEmail(t *testing.T, dir string, address string) ReceivedEmail {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	require.NoError(t, err)
+	// The FileEmailer's names start with the time, so the newest files come last.
+	sort.Sort(sort.Reverse(sort.StringSlice(files)))
+	for _, file := range files {
+		email := readEmail(t, file)
+		if strings.EqualFold(email.To, address) {
+			return email
+		}
+	}
+	require.FailNow(t, "no emails were sent to "+address, "looked in %s", dir)
+	return ReceivedEmail{}
+}
+
+// ResetLink returns the link which resets the account's password.
+func (e ReceivedEmail) ResetLink(t *testing.T) Link {
+	t.Helper()
+	return e.link(t, "/reset-password")
+}
+
+// VerifyLink returns the link which verifies the account's email.
+func (e ReceivedEmail) VerifyLink(t *testing.T) Link {
+	t.Helper()
+	return e.link(t, "/verify-email")
+}
+
+// ConfirmLink returns the link which moves the account to a new email.
+func (e ReceivedEmail) ConfirmLink(t *testing.T) Link {
+	t.Helper()
+	return e.link(t, "/confirm-email")
+}
+
+var urlPattern = regexp.MustCompile(`https?://\S+`)
+
+// link finds the first link in the text version of the email whose path ends with path.
+func (e ReceivedEmail) link(t *testing.T, path string) Link {
+	t.Helper()
+	for _, match := range urlPattern.FindAllString(e.Text, -1) {
+		parsed, err := url.Parse(match)
+		require.NoError(t, err)
+		if !strings.HasSuffix(parsed.Path, path) {
+			continue
+		}
+		id, err := strconv.ParseInt(parsed.Query().Get("id"), 10, 64)
+		require.NoError(t, err, "the link %s should have an account ID", match)
+		return Link{URL: parsed, ID: id, Token: parsed.Query().Get("token")}
+	}
+	require.FailNow(t, "the email has no "+path+" link", "the email said:\n%s", e.Text)
+	return Link{}
+}
+
+func readEmail(t *testing.T, file string) ReceivedEmail {
+	t.Helper()
+	f, err := os.Open(file)
+	require.NoError(t, err)
+	defer f.Close()
+	message, err := mail.ReadMessage(f)
+	require.NoError(t, err)
+
+	to, err := mail.ParseAddress(message.Header.Get("To"))
+	require.NoError(t, err)
+	subject, err := new(mime.WordDecoder).DecodeHeader(message.Header.Get("Subject"))
+	require.NoError(t, err)
+	email := ReceivedEmail{To: to.Address, Subject: subject}
+
+	_, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	// multipart.Reader decodes the quoted-printable parts.
+	parts := multipart.NewReader(message.Body, params["boundary"])
+	for {
+		part, err := parts.NextPart()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		content, err := io.ReadAll(part)
+		require.NoError(t, err)
+		mediaType, _, err := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		require.NoError(t, err)
+		switch mediaType {
+		case "text/plain":
+			email.Text = strings.ReplaceAll(string(content), "\r\n", "\n")
+		case "text/html":
+			email.HTML = strings.ReplaceAll(string(content), "\r\n", "\n")
+		}
+	}
+	return email
+}
@@ -1,8 +1,140 @@
 package accounts
 
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/wikisophia/api/server/accounts/tokens"
+)
+
 // Account has the info which is tied to the email which signed up.
 type Account struct {
 	ID         int64
 	Email      string
 	ResetToken string
+	// VerificationToken is only set on Accounts returned by EmailVerifier.NewVerificationToken(),
+	// or ResetTokenGenerator.NewResetToken() if the account is new.
+	VerificationToken string
+	// EmailChangeToken is only set on Accounts returned by EmailChanger.RequestEmailChange().
+	// Their Email is the one the account is moving to.
+	EmailChangeToken string
+}
+
+// AccountProfile is what an account says about itself. Anyone may see its DisplayName and Bio,
+// but the Email and Preferences are only for the account itself.
+type AccountProfile struct {
+	ID          int64
+	Email       string
+	DisplayName string
+	Bio         string
+	// Preferences is a JSON object which clients may use as they like. The server never looks inside it.
+	// It's nil if the account hasn't set any.
+	Preferences json.RawMessage
+	// DeletionDueAt is when the account will be purged. It's the zero Time unless its owner asked to delete it.
+	DeletionDueAt time.Time
+}
+
+// ProfileUpdate changes some parts of an AccountProfile. The ones which are nil stay as they are.
+type ProfileUpdate struct {
+	DisplayName *string
+	Bio         *string
+	// Preferences replaces all the old ones.
+	Preferences json.RawMessage
+}
+
+// These are the limits on each part of an AccountProfile. Lengths are counted in characters,
+// but the size of the Preferences is counted in bytes.
+const (
+	MaxDisplayNameLength = 50
+	MaxBioLength         = 500
+	MaxPreferencesSize   = 4096
+)
+
+// StoredAccount is everything a Store keeps about an account which should survive
+// a move to another Store. Reset and verification tokens are deliberately left out, since they expire quickly.
+type StoredAccount struct {
+	ID           int64  `json:"id"`
+	Email        string `json:"email"`
+	PasswordHash string `json:"passwordHash,omitempty"`
+	// EmailVerifiedAt is nil if the email was never verified.
+	EmailVerifiedAt *time.Time      `json:"emailVerifiedAt,omitempty"`
+	DisplayName     string          `json:"displayName,omitempty"`
+	Bio             string          `json:"bio,omitempty"`
+	Preferences     json.RawMessage `json:"preferences,omitempty"`
+	// DeletionDueAt is nil unless the account's owner asked to delete it.
+	DeletionDueAt *time.Time `json:"deletionDueAt,omitempty"`
+	// PurgedAt is nil unless the account was purged. Purged accounts are kept so that their IDs aren't reused,
+	// but their Email is a random placeholder, and everything else about them is gone.
+	PurgedAt *time.Time `json:"purgedAt,omitempty"`
+	// TwoFactorSecret is the TOTP secret. It's empty unless two-factor auth is on.
+	// Unconfirmed secrets are left out, since their owners can enroll again.
+	TwoFactorSecret string `json:"twoFactorSecret,omitempty"`
+	// TwoFactorLastStep is the step of the last TOTP code which was used, so that it can't be used again.
+	TwoFactorLastStep int64 `json:"twoFactorLastStep,omitempty"`
+	// RecoveryCodeHashes are the hashes of the recovery codes which haven't been used yet.
+	RecoveryCodeHashes []string `json:"recoveryCodeHashes,omitempty"`
+	TwoFactorRequired  bool     `json:"twoFactorRequired,omitempty"`
+	Moderator          bool     `json:"moderator,omitempty"`
+}
+
+// TwoFactorEnrollment is a new TOTP secret, which the account's owner should add to their authenticator app.
+// It isn't used until it's confirmed.
+type TwoFactorEnrollment struct {
+	ID     int64
+	Email  string
+	Secret string
+}
+
+// TwoFactorStatus says whether an account logs in with a TOTP code as well as its password.
+type TwoFactorStatus struct {
+	Enabled bool
+	// Required is true if the account may not log in without two-factor auth, or turn it off.
+	Required          bool
+	RecoveryCodesLeft int
+}
+
+// Session records a login, so that the account's owner can see where they're logged in.
+type Session struct {
+	ID        int64
+	AccountID int64
+	IssuedAt  time.Time
+	// LastUsedAt is the last time a request used the session, to the minute. It's IssuedAt if none have.
+	LastUsedAt time.Time
+	// Client is the User-Agent of the request which logged in, cut to MaxSessionClientLength bytes.
+	Client string
+}
+
+// MaxSessionClientLength is the most bytes of a Session's Client which are kept.
+const MaxSessionClientLength = 255
+
+// TrimSessionClient cuts the client to MaxSessionClientLength bytes, without splitting a character.
+func TrimSessionClient(client string) string {
+	if len(client) <= MaxSessionClientLength {
+		return client
+	}
+	end := MaxSessionClientLength
+	for end > 0 && !utf8.RuneStart(client[end]) {
+		end--
+	}
+	return client[:end]
+}
+
+// LoginFailures counts the failed logins on an account since its last successful one.
+type LoginFailures struct {
+	AccountID int64
+	Count     int
+	// LockedUntil is when the account may log in again. It's the zero Time if it was never locked.
+	LockedUntil time.Time
+}
+
+// PurgedEmail makes the placeholder email which a purged account gets in place of its real one.
+// It's random, so that nobody can ask for its reset tokens, and it ends in ".invalid", so nothing can be sent to it.
+func PurgedEmail(id int64) (string, error) {
+	token, err := tokens.NewVerificationToken(20)
+	if err != nil {
+		return "", err
+	}
+	return "purged-" + strconv.FormatInt(id, 10) + "-" + token + "@purged.invalid", nil
 }
@@ -0,0 +1,87 @@
+// Package deletion purges the accounts whose owners asked to delete them, once their grace period is over.
+package deletion
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/config"
+	"github.com/wikisophia/api/server/logging"
+)
+
+// Purger anonymizes the accounts in a Deleter which are due to be purged.
+// Use NewPurger() to make one.
+type Purger struct {
+	deleter accounts.Deleter
+	cfg     config.Deletion
+	now     func() time.Time
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewPurger makes a Purger for the accounts in deleter.
+// now tells the time. If it's nil, time.Now is used.
+func NewPurger(deleter accounts.Deleter, cfg config.Deletion, now func() time.Time) *Purger {
+	if now == nil {
+		now = time.Now
+	}
+	return &Purger{
+		deleter: deleter,
+		cfg:     cfg,
+		now:     now,
+	}
+}
+
+// Start purges accounts in the background until Stop() is called.
+// It checks for due accounts right away, and then once every purge interval.
+func (p *Purger) Start() {
+	stop, done := make(chan struct{}), make(chan struct{})
+	p.stop, p.done = stop, done
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stop
+		cancel()
+	}()
+	go func() {
+		defer close(done)
+		timer := time.NewTimer(0)
+		defer timer.Stop()
+		for {
+			select {
+			case <-timer.C:
+				if _, err := p.PurgeDue(ctx); err != nil {
+					logging.FromContext(ctx).Error("failed to purge accounts", slog.Any("error", err))
+				}
+				timer.Reset(p.cfg.PurgeInterval())
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends the background purges started by Start(). A purge which is running at the time is rolled back,
+// and happens again the next time the accounts are checked.
+// It's safe to call even if Start() wasn't.
+func (p *Purger) Stop() {
+	if p.stop != nil {
+		close(p.stop)
+		<-p.done
+		p.stop = nil
+	}
+}
+
+// PurgeDue anonymizes every account which is due to be purged, and returns how many it purged.
+func (p *Purger) PurgeDue(ctx context.Context) (int, error) {
+	purged, err := p.deleter.PurgeAccounts(ctx, p.now())
+	if err != nil {
+		return 0, err
+	}
+	if purged > 0 {
+		logging.FromContext(ctx).Info("purged deleted accounts", slog.Int("count", purged))
+	}
+	return purged, nil
+}
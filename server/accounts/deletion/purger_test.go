@@ -0,0 +1,67 @@
+package deletion_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/accounts/deletion"
+	"github.com/wikisophia/api/server/accounts/memory"
+	"github.com/wikisophia/api/server/config"
+)
+
+func TestOnlyDueAccountsPurged(t *testing.T) {
+	store := memory.NewMemoryStore()
+	now := time.Now()
+	purger := deletion.NewPurger(store, testConfig(), func() time.Time { return now })
+	due := newAccount(t, store, "due@soph.wiki")
+	require.NoError(t, store.ScheduleDeletion(context.Background(), due, "some-password", now.Add(-time.Minute)))
+	later := newAccount(t, store, "later@soph.wiki")
+	require.NoError(t, store.ScheduleDeletion(context.Background(), later, "some-password", now.Add(time.Hour)))
+
+	purged, err := purger.PurgeDue(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+	_, err = store.AccountProfile(context.Background(), due)
+	assert.True(t, errors.As(err, &accounts.AccountNotExistsError{}))
+	_, err = store.AccountProfile(context.Background(), later)
+	assert.NoError(t, err)
+
+	purged, err = purger.PurgeDue(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, purged)
+}
+
+func TestPurgerStartsAndStops(t *testing.T) {
+	store := memory.NewMemoryStore()
+	purger := deletion.NewPurger(store, testConfig(), nil)
+	id := newAccount(t, store, "email@soph.wiki")
+	require.NoError(t, store.ScheduleDeletion(context.Background(), id, "some-password", time.Now()))
+
+	purger.Start()
+	assert.Eventually(t, func() bool {
+		_, err := store.AccountProfile(context.Background(), id)
+		return errors.As(err, &accounts.AccountNotExistsError{})
+	}, time.Second, 5*time.Millisecond)
+	purger.Stop()
+	purger.Stop()
+}
+
+func newAccount(t *testing.T, store *memory.InMemoryStore, email string) int64 {
+	t.Helper()
+	account, _, err := store.NewResetToken(context.Background(), email)
+	require.NoError(t, err)
+	require.NoError(t, store.SetForgottenPassword(context.Background(), account.ID, "some-password", account.ResetToken))
+	return account.ID
+}
+
+func testConfig() config.Deletion {
+	return config.Deletion{
+		GracePeriodMillis:   0,
+		PurgeIntervalMillis: 10,
+	}
+}
@@ -0,0 +1,258 @@
+package email
+
+import (
+	"bytes"
+	"crypto/rand"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/wikisophia/api/server/accounts"
+)
+
+//go:embed templates/*
+var templateFiles embed.FS
+
+// Message is an email which is ready to send.
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Composer writes the Messages for each kind of email, from the text and HTML templates in ./templates.
+// Create these with the NewComposer() function.
+type Composer struct {
+	baseURL *url.URL
+	kinds   map[string]kind
+}
+
+// kind is one sort of email, like a welcome or a password reset.
+type kind struct {
+	subject string
+	text    *texttemplate.Template
+	html    *htmltemplate.Template
+}
+
+// subjects has the subject of each kind of email. The keys are the template names.
+var subjects = map[string]string{
+	"welcome":             "Welcome to Wikisophia",
+	"reset":               "Reset your Wikisophia password",
+	"verification":        "Confirm your email for Wikisophia",
+	"locked":              "Your Wikisophia account is locked",
+	"email_change":        "Confirm your new email for Wikisophia",
+	"email_change_notice": "Your Wikisophia account is moving to a new email",
+}
+
+// templateData is what the templates can use. Links which don't apply to a kind of email are empty.
+type templateData struct {
+	Subject          string
+	Email            string
+	ResetLink        string
+	VerifyLink       string
+	ConfirmLink      string
+	ResetRequestLink string
+	Until            string
+}
+
+// NewComposer makes a Composer whose links start with publicBaseURL, like "https://soph.wiki".
+func NewComposer(publicBaseURL string) (*Composer, error) {
+	baseURL, err := url.Parse(publicBaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the public base URL: %v", err)
+	}
+	if !baseURL.IsAbs() {
+		return nil, fmt.Errorf("the public base URL %q is not absolute", publicBaseURL)
+	}
+	composer := &Composer{
+		baseURL: baseURL,
+		kinds:   make(map[string]kind, len(subjects)),
+	}
+	for name, subject := range subjects {
+		text, err := texttemplate.ParseFS(templateFiles, "templates/"+name+".txt")
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the %s text template: %v", name, err)
+		}
+		html, err := htmltemplate.ParseFS(templateFiles, "templates/layout.html", "templates/"+name+".html")
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the %s HTML template: %v", name, err)
+		}
+		composer.kinds[name] = kind{
+			subject: subject,
+			text:    text,
+			html:    html,
+		}
+	}
+	return composer, nil
+}
+
+// Welcome writes the email for a new account. It links to the pages which set the password
+// and verify the email. The verification link is left out if the account has no VerificationToken.
+func (c *Composer) Welcome(account accounts.Account) (Message, error) {
+	return c.compose("welcome", account, templateData{
+		ResetLink:  c.resetLink(account),
+		VerifyLink: c.verifyLink(account),
+	})
+}
+
+// Reset writes the email which links to the page that sets a forgotten password.
+func (c *Composer) Reset(account accounts.Account) (Message, error) {
+	return c.compose("reset", account, templateData{
+		ResetLink: c.resetLink(account),
+	})
+}
+
+// Verification writes the email which links to the page that verifies the account's email.
+func (c *Composer) Verification(account accounts.Account) (Message, error) {
+	return c.compose("verification", account, templateData{
+		VerifyLink: c.verifyLink(account),
+	})
+}
+
+// Locked writes the email which says that the account can't log in until the given time.
+func (c *Composer) Locked(account accounts.Account, until time.Time) (Message, error) {
+	return c.compose("locked", account, templateData{
+		ResetRequestLink: c.link("/reset-password", nil),
+		Until:            until.UTC().Format("January 2, 2006 at 15:04 MST"),
+	})
+}
+
+// EmailChange writes the email which links to the page that confirms an account's move to a new email.
+// The account's Email should be the new one.
+func (c *Composer) EmailChange(account accounts.Account) (Message, error) {
+	return c.compose("email_change", account, templateData{
+		ConfirmLink: c.link("/confirm-email", url.Values{
+			"id":    {strconv.FormatInt(account.ID, 10)},
+			"token": {account.EmailChangeToken},
+		}),
+	})
+}
+
+// EmailChangeNotice writes the email which tells an account's current email that it's moving to a new one.
+func (c *Composer) EmailChangeNotice(account accounts.Account) (Message, error) {
+	return c.compose("email_change_notice", account, templateData{
+		ResetRequestLink: c.link("/reset-password", nil),
+	})
+}
+
+func (c *Composer) compose(name string, account accounts.Account, data templateData) (Message, error) {
+	kind := c.kinds[name]
+	data.Subject = kind.subject
+	data.Email = account.Email
+
+	var text, html strings.Builder
+	if err := kind.text.Execute(&text, data); err != nil {
+		return Message{}, fmt.Errorf("failed to write the %s email's text: %v", name, err)
+	}
+	if err := kind.html.ExecuteTemplate(&html, "layout", data); err != nil {
+		return Message{}, fmt.Errorf("failed to write the %s email's HTML: %v", name, err)
+	}
+	return Message{
+		To:      account.Email,
+		Subject: kind.subject,
+		Text:    text.String(),
+		HTML:    html.String(),
+	}, nil
+}
+
+func (c *Composer) resetLink(account accounts.Account) string {
+	return c.link("/reset-password", url.Values{
+		"id":    {strconv.FormatInt(account.ID, 10)},
+		"token": {account.ResetToken},
+	})
+}
+
+func (c *Composer) verifyLink(account accounts.Account) string {
+	if account.VerificationToken == "" {
+		return ""
+	}
+	return c.link("/verify-email", url.Values{
+		"id":    {strconv.FormatInt(account.ID, 10)},
+		"token": {account.VerificationToken},
+	})
+}
+
+// link returns the URL of a page on the public site.
+func (c *Composer) link(path string, query url.Values) string {
+	link := *c.baseURL
+	link.Path = strings.TrimSuffix(link.Path, "/") + path
+	link.RawQuery = query.Encode()
+	return link.String()
+}
+
+// MIME encodes the message as a multipart/alternative email from the given address,
+// with the text and HTML as quoted-printable parts. The lines end with CRLF, as SMTP expects.
+func (m Message) MIME(from *mail.Address, date time.Time) ([]byte, error) {
+	if strings.ContainsAny(m.To, "\r\n") {
+		return nil, errors.New("the recipient's address contains a line break")
+	}
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=utf-8", m.Text},
+		{"text/html; charset=utf-8", m.HTML},
+	} {
+		writer, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		encoder := quotedprintable.NewWriter(writer)
+		if _, err := encoder.Write([]byte(strings.ReplaceAll(part.content, "\n", "\r\n"))); err != nil {
+			return nil, err
+		}
+		if err := encoder.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+
+	messageID, err := newMessageID(from)
+	if err != nil {
+		return nil, err
+	}
+	var message bytes.Buffer
+	writeHeader := func(name, value string) {
+		message.WriteString(name + ": " + value + "\r\n")
+	}
+	writeHeader("From", from.String())
+	writeHeader("To", (&mail.Address{Address: m.To}).String())
+	writeHeader("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	writeHeader("Date", date.Format(time.RFC1123Z))
+	writeHeader("Message-ID", messageID)
+	writeHeader("MIME-Version", "1.0")
+	writeHeader("Content-Type", "multipart/alternative; boundary="+parts.Boundary())
+	message.WriteString("\r\n")
+	message.Write(body.Bytes())
+	return message.Bytes(), nil
+}
+
+// newMessageID makes a unique Message-ID header in the domain of the sender.
+func newMessageID(from *mail.Address) (string, error) {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return "", fmt.Errorf("failed to make a Message-ID: %v", err)
+	}
+	domain := from.Address[strings.LastIndex(from.Address, "@")+1:]
+	return "<" + hex.EncodeToString(random) + "@" + domain + ">", nil
+}
@@ -0,0 +1,99 @@
+package email_test
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/accounts/email"
+)
+
+func TestWelcomeLinks(t *testing.T) {
+	composer, err := email.NewComposer("https://soph.wiki/app/")
+	require.NoError(t, err)
+	message, err := composer.Welcome(accounts.Account{
+		ID:                3,
+		Email:             "someone@soph.wiki",
+		ResetToken:        "reset-token",
+		VerificationToken: "verify-token",
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "someone@soph.wiki", message.To)
+	assert.Contains(t, message.Text, "https://soph.wiki/app/reset-password?id=3&token=reset-token")
+	assert.Contains(t, message.Text, "https://soph.wiki/app/verify-email?id=3&token=verify-token")
+	assert.Contains(t, message.HTML, `href="https://soph.wiki/app/reset-password?id=3&amp;token=reset-token"`)
+	assert.Contains(t, message.HTML, `href="https://soph.wiki/app/verify-email?id=3&amp;token=verify-token"`)
+}
+
+func TestWelcomeWithoutVerification(t *testing.T) {
+	composer, err := email.NewComposer("https://soph.wiki")
+	require.NoError(t, err)
+	message, err := composer.Welcome(accounts.Account{ID: 3, Email: "someone@soph.wiki", ResetToken: "reset-token"})
+	require.NoError(t, err)
+	assert.NotContains(t, message.Text, "verify-email")
+	assert.NotContains(t, message.HTML, "verify-email")
+}
+
+func TestHTMLEscaped(t *testing.T) {
+	composer, err := email.NewComposer("https://soph.wiki")
+	require.NoError(t, err)
+	message, err := composer.Reset(accounts.Account{ID: 3, Email: "<b>someone</b>@soph.wiki", ResetToken: "token"})
+	require.NoError(t, err)
+	assert.NotContains(t, message.HTML, "<b>someone</b>")
+}
+
+func TestMIME(t *testing.T) {
+	composer, err := email.NewComposer("https://soph.wiki")
+	require.NoError(t, err)
+	message, err := composer.Locked(accounts.Account{ID: 3, Email: "someone@soph.wiki"}, time.Date(2030, 1, 2, 3, 4, 0, 0, time.UTC))
+	require.NoError(t, err)
+	from := &mail.Address{Name: "Wikisophia", Address: "noreply@soph.wiki"}
+	data, err := message.MIME(from, time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+
+	parsed, err := mail.ReadMessage(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, `"Wikisophia" <noreply@soph.wiki>`, parsed.Header.Get("From"))
+	assert.Equal(t, "<someone@soph.wiki>", parsed.Header.Get("To"))
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	require.NoError(t, err)
+	assert.Equal(t, message.Subject, subject)
+	assert.True(t, strings.HasSuffix(parsed.Header.Get("Message-ID"), "@soph.wiki>"))
+
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	require.Equal(t, "multipart/alternative", mediaType)
+	reader := multipart.NewReader(parsed.Body, params["boundary"])
+	assertPart(t, reader, "text/plain", message.Text)
+	assertPart(t, reader, "text/html", message.HTML)
+	_, err = reader.NextPart()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestMIMERejectsHeaderInjection(t *testing.T) {
+	message := email.Message{To: "someone@soph.wiki\r\nBcc: other@soph.wiki", Subject: "Hi", Text: "Hi", HTML: "Hi"}
+	_, err := message.MIME(&mail.Address{Address: "noreply@soph.wiki"}, time.Now())
+	assert.Error(t, err)
+}
+
+func assertPart(t *testing.T, reader *multipart.Reader, contentType string, body string) {
+	t.Helper()
+	part, err := reader.NextPart()
+	require.NoError(t, err)
+	mediaType, _, err := mime.ParseMediaType(part.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	assert.Equal(t, contentType, mediaType)
+	// multipart.Reader decodes quoted-printable parts itself, and removes the header.
+	decoded, err := io.ReadAll(part)
+	require.NoError(t, err)
+	assert.Equal(t, strings.ReplaceAll(body, "\n", "\r\n"), string(decoded))
+}
@@ -2,12 +2,25 @@ package email
 
 import (
 	"context"
+	"time"
 
 	"github.com/wikisophia/api/server/accounts"
 )
 
-// Emailer sends new account and password reset tokens
+// Emailer sends new account, password reset and email verification tokens,
+// and warns people when their account gets locked.
 type Emailer interface {
+	// SendWelcome goes to new accounts. Both the ResetToken and VerificationToken are set.
 	SendWelcome(ctx context.Context, account accounts.Account) error
 	SendReset(ctx context.Context, account accounts.Account) error
+	// SendVerification sends a new VerificationToken to an account which hasn't verified its email yet.
+	SendVerification(ctx context.Context, account accounts.Account) error
+	// SendLocked tells the account's owner that it can't log in until the given time,
+	// because of too many failed logins. The account's ResetToken isn't set.
+	SendLocked(ctx context.Context, account accounts.Account, until time.Time) error
+	// SendEmailChange goes to the email an account is moving to. The account's Email is the new one,
+	// and its EmailChangeToken is set.
+	SendEmailChange(ctx context.Context, account accounts.Account) error
+	// SendEmailChangeNotice tells the account's current email that it's moving to a new one.
+	SendEmailChangeNotice(ctx context.Context, account accounts.Account) error
 }
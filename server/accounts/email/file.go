@@ -0,0 +1,124 @@
+package email
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/config"
+)
+
+// FileEmailer writes each email to a .eml file in a directory, instead of sending it.
+// Mail clients can open the files, and tests can read them with net/mail.
+// Create these with the NewFileEmailer() function.
+type FileEmailer struct {
+	dir      string
+	from     *mail.Address
+	composer *Composer
+}
+
+// NewFileEmailer makes a FileEmailer from the config, and makes its directory if it doesn't exist.
+func NewFileEmailer(cfg config.Email) (*FileEmailer, error) {
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the from address: %v", err)
+	}
+	composer, err := NewComposer(cfg.PublicBaseURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(cfg.File.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to make the email directory: %v", err)
+	}
+	return &FileEmailer{
+		dir:      cfg.File.Dir,
+		from:     from,
+		composer: composer,
+	}, nil
+}
+
+func (e *FileEmailer) SendWelcome(ctx context.Context, account accounts.Account) error {
+	message, err := e.composer.Welcome(account)
+	if err != nil {
+		return err
+	}
+	return e.write(message)
+}
+
+func (e *FileEmailer) SendReset(ctx context.Context, account accounts.Account) error {
+	message, err := e.composer.Reset(account)
+	if err != nil {
+		return err
+	}
+	return e.write(message)
+}
+
+func (e *FileEmailer) SendVerification(ctx context.Context, account accounts.Account) error {
+	message, err := e.composer.Verification(account)
+	if err != nil {
+		return err
+	}
+	return e.write(message)
+}
+
+func (e *FileEmailer) SendLocked(ctx context.Context, account accounts.Account, until time.Time) error {
+	message, err := e.composer.Locked(account, until)
+	if err != nil {
+		return err
+	}
+	return e.write(message)
+}
+
+func (e *FileEmailer) SendEmailChange(ctx context.Context, account accounts.Account) error {
+	message, err := e.composer.EmailChange(account)
+	if err != nil {
+		return err
+	}
+	return e.write(message)
+}
+
+func (e *FileEmailer) SendEmailChangeNotice(ctx context.Context, account accounts.Account) error {
+	message, err := e.composer.EmailChangeNotice(account)
+	if err != nil {
+		return err
+	}
+	return e.write(message)
+}
+
+// write saves the message in a new file. The names start with the time, so they sort from oldest to newest.
+// Each file is written under a temporary name and then renamed, so readers never see half an email.
+func (e *FileEmailer) write(message Message) error {
+	now := time.Now()
+	data, err := message.MIME(e.from, now)
+	if err != nil {
+		return fmt.Errorf("failed to encode the email: %v", err)
+	}
+	random := make([]byte, 4)
+	if _, err := rand.Read(random); err != nil {
+		return fmt.Errorf("failed to name the email: %v", err)
+	}
+	name := now.UTC().Format("20060102T150405.000000000Z") + "-" + hex.EncodeToString(random) + ".eml"
+
+	temp, err := os.CreateTemp(e.dir, ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to write the email: %v", err)
+	}
+	_, err = temp.Write(data)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), filepath.Join(e.dir, name))
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+		return fmt.Errorf("failed to write the email: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package email_test
+
+import (
+	"context"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/accounts/email"
+	"github.com/wikisophia/api/server/config"
+)
+
+func TestFileEmailsWritten(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "emails")
+	cfg := *config.Defaults().Email
+	cfg.File = &config.EmailFile{Dir: dir}
+	emailer, err := email.NewFileEmailer(cfg)
+	require.NoError(t, err)
+
+	account := accounts.Account{ID: 3, Email: "someone@soph.wiki", ResetToken: "reset-token"}
+	require.NoError(t, emailer.SendReset(context.Background(), account))
+	require.NoError(t, emailer.SendLocked(context.Background(), account, time.Now().Add(time.Hour)))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 2, "the temporary files should be gone")
+	var subjects []string
+	for _, entry := range entries {
+		assert.True(t, strings.HasSuffix(entry.Name(), ".eml"))
+		f, err := os.Open(filepath.Join(dir, entry.Name()))
+		require.NoError(t, err)
+		message, err := mail.ReadMessage(f)
+		f.Close()
+		require.NoError(t, err)
+		assert.Equal(t, "<someone@soph.wiki>", message.Header.Get("To"))
+		subjects = append(subjects, message.Header.Get("Subject"))
+	}
+	assert.Equal(t, []string{"Reset your Wikisophia password", "Your Wikisophia account is locked"}, subjects,
+		"the files should sort from oldest to newest")
+}
+
+func TestFileEmailerNeedsDirectory(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(file, nil, 0o644))
+	cfg := *config.Defaults().Email
+	cfg.File = &config.EmailFile{Dir: file}
+	_, err := email.NewFileEmailer(cfg)
+	assert.Error(t, err)
+}
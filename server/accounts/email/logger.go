@@ -3,6 +3,7 @@ package email
 import (
 	"context"
 	"log"
+	"time"
 
 	"github.com/wikisophia/api/server/accounts"
 )
@@ -10,10 +11,26 @@ import (
 type ConsoleEmailer struct{}
 
 func (e ConsoleEmailer) SendWelcome(ctx context.Context, account accounts.Account) error {
-	log.Printf("%s has ID %d and reset token %s", account.Email, account.ID, account.ResetToken)
+	log.Printf("%s has ID %d, reset token %s and verification token %s", account.Email, account.ID, account.ResetToken, account.VerificationToken)
 	return nil
 }
 func (e ConsoleEmailer) SendReset(ctx context.Context, account accounts.Account) error {
 	log.Printf("%s has ID %d and new reset token %s", account.Email, account.ID, account.ResetToken)
 	return nil
 }
+func (e ConsoleEmailer) SendVerification(ctx context.Context, account accounts.Account) error {
+	log.Printf("%s has ID %d and new verification token %s", account.Email, account.ID, account.VerificationToken)
+	return nil
+}
+func (e ConsoleEmailer) SendLocked(ctx context.Context, account accounts.Account, until time.Time) error {
+	log.Printf("%s has ID %d and is locked until %s", account.Email, account.ID, until.Format(time.RFC3339))
+	return nil
+}
+func (e ConsoleEmailer) SendEmailChange(ctx context.Context, account accounts.Account) error {
+	log.Printf("%s can confirm the move of account %d with token %s", account.Email, account.ID, account.EmailChangeToken)
+	return nil
+}
+func (e ConsoleEmailer) SendEmailChangeNotice(ctx context.Context, account accounts.Account) error {
+	log.Printf("%s has ID %d, and asked to move to a new email", account.Email, account.ID)
+	return nil
+}
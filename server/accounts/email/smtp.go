@@ -0,0 +1,184 @@
+package email
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+
+	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/config"
+)
+
+// SMTPEmailer sends emails through an SMTP server.
+// Create these with the NewSMTPEmailer() function.
+type SMTPEmailer struct {
+	cfg       config.SMTP
+	from      *mail.Address
+	composer  *Composer
+	tlsConfig *tls.Config
+}
+
+// NewSMTPEmailer makes an SMTPEmailer from the config.
+// It checks the server's TLS certificate against the system's roots.
+func NewSMTPEmailer(cfg config.Email) (*SMTPEmailer, error) {
+	return NewSMTPEmailerWith(cfg, nil)
+}
+
+// NewSMTPEmailerWith makes an SMTPEmailer which connects with the given TLS config.
+// If it's nil, the certificate is checked against the system's roots.
+func NewSMTPEmailerWith(cfg config.Email, tlsConfig *tls.Config) (*SMTPEmailer, error) {
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the from address: %v", err)
+	}
+	composer, err := NewComposer(cfg.PublicBaseURL)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+	tlsConfig = tlsConfig.Clone()
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = cfg.SMTP.Host
+	}
+	return &SMTPEmailer{
+		cfg:       *cfg.SMTP,
+		from:      from,
+		composer:  composer,
+		tlsConfig: tlsConfig,
+	}, nil
+}
+
+func (e *SMTPEmailer) SendWelcome(ctx context.Context, account accounts.Account) error {
+	message, err := e.composer.Welcome(account)
+	if err != nil {
+		return err
+	}
+	return e.send(ctx, message)
+}
+
+func (e *SMTPEmailer) SendReset(ctx context.Context, account accounts.Account) error {
+	message, err := e.composer.Reset(account)
+	if err != nil {
+		return err
+	}
+	return e.send(ctx, message)
+}
+
+func (e *SMTPEmailer) SendVerification(ctx context.Context, account accounts.Account) error {
+	message, err := e.composer.Verification(account)
+	if err != nil {
+		return err
+	}
+	return e.send(ctx, message)
+}
+
+func (e *SMTPEmailer) SendLocked(ctx context.Context, account accounts.Account, until time.Time) error {
+	message, err := e.composer.Locked(account, until)
+	if err != nil {
+		return err
+	}
+	return e.send(ctx, message)
+}
+
+func (e *SMTPEmailer) SendEmailChange(ctx context.Context, account accounts.Account) error {
+	message, err := e.composer.EmailChange(account)
+	if err != nil {
+		return err
+	}
+	return e.send(ctx, message)
+}
+
+func (e *SMTPEmailer) SendEmailChangeNotice(ctx context.Context, account accounts.Account) error {
+	message, err := e.composer.EmailChangeNotice(account)
+	if err != nil {
+		return err
+	}
+	return e.send(ctx, message)
+}
+
+// send delivers one message. It gives up once the context is done, or the configured timeout passes.
+func (e *SMTPEmailer) send(ctx context.Context, message Message) error {
+	data, err := message.MIME(e.from, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to encode the email: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, e.cfg.Timeout())
+	defer cancel()
+
+	conn, err := e.dial(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect to the SMTP server: %v", err)
+	}
+	// net/smtp doesn't take a context, so the deadline and cancellation go through the connection.
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	client, err := smtp.NewClient(conn, e.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to start the SMTP session: %v", err)
+	}
+	defer client.Close()
+	if err := e.deliver(client, message.To, data); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("%v: %w", err, ctx.Err())
+		}
+		return err
+	}
+	return nil
+}
+
+func (e *SMTPEmailer) dial(ctx context.Context) (net.Conn, error) {
+	address := net.JoinHostPort(e.cfg.Host, strconv.Itoa(e.cfg.Port))
+	if e.cfg.TLS == config.SMTPTLSImplicit {
+		dialer := &tls.Dialer{Config: e.tlsConfig}
+		return dialer.DialContext(ctx, "tcp", address)
+	}
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, "tcp", address)
+}
+
+// deliver runs the SMTP commands which send data to the recipient.
+func (e *SMTPEmailer) deliver(client *smtp.Client, to string, data []byte) error {
+	if e.cfg.TLS == config.SMTPTLSStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return errors.New("the SMTP server doesn't support STARTTLS")
+		}
+		if err := client.StartTLS(e.tlsConfig); err != nil {
+			return fmt.Errorf("STARTTLS failed: %v", err)
+		}
+	}
+	if e.cfg.Username != "" {
+		// PlainAuth refuses to send the password without TLS, unless the server is on localhost.
+		if err := client.Auth(smtp.PlainAuth("", e.cfg.Username, e.cfg.Password, e.cfg.Host)); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %v", err)
+		}
+	}
+	if err := client.Mail(e.from.Address); err != nil {
+		return fmt.Errorf("the SMTP server rejected the sender: %v", err)
+	}
+	if err := client.Rcpt(to); err != nil {
+		return fmt.Errorf("the SMTP server rejected the recipient: %v", err)
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("the SMTP server rejected the DATA command: %v", err)
+	}
+	if _, err := writer.Write(data); err != nil {
+		return fmt.Errorf("failed to send the email: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("the SMTP server rejected the email: %v", err)
+	}
+	return client.Quit()
+}
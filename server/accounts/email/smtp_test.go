@@ -0,0 +1,100 @@
+package email_test
+
+import (
+	"bytes"
+	"context"
+	"net/mail"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/accounts/email"
+	"github.com/wikisophia/api/server/accounts/email/smtptest"
+	"github.com/wikisophia/api/server/config"
+)
+
+func TestSMTPStartTLS(t *testing.T) {
+	server := smtptest.NewServer(t, smtptest.StartTLS)
+	server.RequireAuth("user", "secret")
+	cfg := emailConfig(server, config.SMTPTLSStartTLS)
+	cfg.SMTP.Username, cfg.SMTP.Password = "user", "secret"
+	emailer, err := email.NewSMTPEmailerWith(cfg, server.ClientTLSConfig())
+	require.NoError(t, err)
+
+	require.NoError(t, emailer.SendReset(context.Background(), accounts.Account{ID: 3, Email: "someone@soph.wiki", ResetToken: "token"}))
+	messages := server.Messages()
+	require.Len(t, messages, 1)
+	assert.True(t, messages[0].TLS)
+	assert.Equal(t, "user", messages[0].Username)
+	assert.Equal(t, "noreply@soph.wiki", messages[0].From)
+	assert.Equal(t, []string{"someone@soph.wiki"}, messages[0].To)
+	parsed, err := mail.ReadMessage(bytes.NewReader(messages[0].Data))
+	require.NoError(t, err)
+	assert.Equal(t, "<someone@soph.wiki>", parsed.Header.Get("To"))
+}
+
+func TestSMTPImplicitTLS(t *testing.T) {
+	server := smtptest.NewServer(t, smtptest.ImplicitTLS)
+	emailer, err := email.NewSMTPEmailerWith(emailConfig(server, config.SMTPTLSImplicit), server.ClientTLSConfig())
+	require.NoError(t, err)
+
+	require.NoError(t, emailer.SendVerification(context.Background(), accounts.Account{ID: 3, Email: "someone@soph.wiki", VerificationToken: "token"}))
+	messages := server.Messages()
+	require.Len(t, messages, 1)
+	assert.True(t, messages[0].TLS)
+	assert.Empty(t, messages[0].Username)
+}
+
+func TestSMTPRequiresStartTLS(t *testing.T) {
+	server := smtptest.NewServer(t, smtptest.Plaintext)
+	emailer, err := email.NewSMTPEmailerWith(emailConfig(server, config.SMTPTLSStartTLS), server.ClientTLSConfig())
+	require.NoError(t, err)
+
+	assert.Error(t, emailer.SendWelcome(context.Background(), accounts.Account{ID: 3, Email: "someone@soph.wiki"}))
+	assert.Empty(t, server.Messages())
+}
+
+func TestSMTPWithoutTLS(t *testing.T) {
+	server := smtptest.NewServer(t, smtptest.Plaintext)
+	emailer, err := email.NewSMTPEmailer(emailConfig(server, config.SMTPTLSNone))
+	require.NoError(t, err)
+
+	require.NoError(t, emailer.SendWelcome(context.Background(), accounts.Account{ID: 3, Email: "someone@soph.wiki"}))
+	messages := server.Messages()
+	require.Len(t, messages, 1)
+	assert.False(t, messages[0].TLS)
+}
+
+func TestSMTPWrongPassword(t *testing.T) {
+	server := smtptest.NewServer(t, smtptest.StartTLS)
+	server.RequireAuth("user", "secret")
+	cfg := emailConfig(server, config.SMTPTLSStartTLS)
+	cfg.SMTP.Username, cfg.SMTP.Password = "user", "wrong"
+	emailer, err := email.NewSMTPEmailerWith(cfg, server.ClientTLSConfig())
+	require.NoError(t, err)
+
+	assert.Error(t, emailer.SendWelcome(context.Background(), accounts.Account{ID: 3, Email: "someone@soph.wiki"}))
+	assert.Empty(t, server.Messages())
+}
+
+func TestSMTPUntrustedCertificate(t *testing.T) {
+	server := smtptest.NewServer(t, smtptest.ImplicitTLS)
+	emailer, err := email.NewSMTPEmailer(emailConfig(server, config.SMTPTLSImplicit))
+	require.NoError(t, err)
+
+	assert.Error(t, emailer.SendWelcome(context.Background(), accounts.Account{ID: 3, Email: "someone@soph.wiki"}))
+	assert.Empty(t, server.Messages())
+}
+
+func emailConfig(server *smtptest.Server, tls string) config.Email {
+	cfg := *config.Defaults().Email
+	smtp := *cfg.SMTP
+	smtp.Host = server.Host()
+	smtp.Port = server.Port()
+	smtp.TLS = tls
+	cfg.Type = config.EmailTypeSMTP
+	cfg.From = "Wikisophia <noreply@soph.wiki>"
+	cfg.SMTP = &smtp
+	return cfg
+}
@@ -0,0 +1,321 @@
+// Package smtptest runs fake SMTP servers in-process, so that tests can check what an SMTPEmailer sends.
+package smtptest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Mode decides how a Server uses TLS.
+type Mode int
+
+const (
+	// StartTLS servers start in plaintext and advertise the STARTTLS extension.
+	StartTLS Mode = iota
+	// ImplicitTLS servers expect a TLS handshake as soon as clients connect.
+	ImplicitTLS
+	// Plaintext servers don't support TLS at all.
+	Plaintext
+)
+
+// Message is an email which a Server accepted.
+type Message struct {
+	From string
+	To   []string
+	// Data is everything the client sent after the DATA command, with the dot-stuffing removed.
+	Data []byte
+	// Username and Password are the credentials the client authenticated with, if any.
+	Username string
+	Password string
+	// TLS is true if the message was sent over an encrypted connection.
+	TLS bool
+}
+
+// Server is a fake SMTP server listening on a random port on 127.0.0.1.
+// Create these with the NewServer() function.
+type Server struct {
+	listener  net.Listener
+	tlsConfig *tls.Config
+	roots     *x509.CertPool
+	mode      Mode
+	wg        sync.WaitGroup
+
+	mutex    sync.Mutex
+	messages []Message
+	// credentials, if set, are the only username and password which AUTH PLAIN accepts.
+	credentials map[string]string
+}
+
+// NewServer starts a Server which uses TLS according to mode.
+// It gets closed when the test finishes.
+func NewServer(t testing.TB, mode Mode) *Server {
+	t.Helper()
+	cert, roots, err := selfSignedCertificate()
+	if err != nil {
+		t.Fatalf("failed to make the fake SMTP server's certificate: %v", err)
+	}
+	server := &Server{
+		tlsConfig: &tls.Config{Certificates: []tls.Certificate{cert}},
+		roots:     roots,
+		mode:      mode,
+	}
+	server.listener, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start the fake SMTP server: %v", err)
+	}
+	server.wg.Add(1)
+	go server.serve()
+	t.Cleanup(server.Close)
+	return server
+}
+
+// RequireAuth makes the server reject emails unless the client authenticates with this username and password.
+func (s *Server) RequireAuth(username string, password string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.credentials = map[string]string{username: password}
+}
+
+// Host returns the address the server listens on.
+func (s *Server) Host() string {
+	host, _, _ := net.SplitHostPort(s.listener.Addr().String())
+	return host
+}
+
+// Port returns the port the server listens on.
+func (s *Server) Port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+// ClientTLSConfig returns a TLS config which trusts the server's certificate.
+func (s *Server) ClientTLSConfig() *tls.Config {
+	return &tls.Config{RootCAs: s.roots, ServerName: s.Host()}
+}
+
+// Messages returns the emails the server has accepted so far.
+func (s *Server) Messages() []Message {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// Close stops the server, and waits for open connections to finish.
+func (s *Server) Close() {
+	s.listener.Close()
+	s.wg.Wait()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(10 * time.Second))
+			s.handle(conn)
+		}()
+	}
+}
+
+// session is the state of one client's connection.
+type session struct {
+	text      *textproto.Conn
+	encrypted bool
+	message   Message
+	hasSender bool
+}
+
+func (s *Server) handle(conn net.Conn) {
+	sess := &session{}
+	if s.mode == ImplicitTLS {
+		conn = tls.Server(conn, s.tlsConfig)
+		sess.encrypted = true
+	}
+	sess.text = textproto.NewConn(conn)
+	sess.reply(220, "127.0.0.1 fake SMTP server ready")
+
+	for {
+		line, err := sess.text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "HELO":
+			sess.reply(250, "127.0.0.1")
+		case "EHLO":
+			extensions := []string{"127.0.0.1", "8BITMIME", "AUTH PLAIN"}
+			if s.mode == StartTLS && !sess.encrypted {
+				extensions = append(extensions, "STARTTLS")
+			}
+			sess.replyLines(250, extensions)
+		case "STARTTLS":
+			if s.mode != StartTLS || sess.encrypted {
+				sess.reply(502, "STARTTLS not available")
+				continue
+			}
+			sess.reply(220, "ready to start TLS")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn = tlsConn
+			sess = &session{text: textproto.NewConn(conn), encrypted: true}
+		case "AUTH":
+			s.auth(sess, arg)
+		case "MAIL":
+			if !s.authorized(sess) {
+				sess.reply(530, "authentication required")
+				continue
+			}
+			sess.message.From = trimPath(arg, "FROM:")
+			sess.hasSender = true
+			sess.reply(250, "OK")
+		case "RCPT":
+			if !sess.hasSender {
+				sess.reply(503, "MAIL first")
+				continue
+			}
+			sess.message.To = append(sess.message.To, trimPath(arg, "TO:"))
+			sess.reply(250, "OK")
+		case "DATA":
+			if len(sess.message.To) == 0 {
+				sess.reply(503, "RCPT first")
+				continue
+			}
+			sess.reply(354, "end data with <CR><LF>.<CR><LF>")
+			data, err := sess.text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			sess.message.Data = data
+			sess.message.TLS = sess.encrypted
+			s.mutex.Lock()
+			s.messages = append(s.messages, sess.message)
+			s.mutex.Unlock()
+			sess.reset()
+			sess.reply(250, "OK: queued")
+		case "RSET":
+			sess.reset()
+			sess.reply(250, "OK")
+		case "NOOP":
+			sess.reply(250, "OK")
+		case "QUIT":
+			sess.reply(221, "bye")
+			return
+		default:
+			sess.reply(502, "command not implemented")
+		}
+	}
+}
+
+// auth handles "AUTH PLAIN", with the initial response on the same line.
+func (s *Server) auth(sess *session, arg string) {
+	mechanism, response, _ := strings.Cut(arg, " ")
+	if !strings.EqualFold(mechanism, "PLAIN") || response == "" {
+		sess.reply(504, "only AUTH PLAIN with an initial response is supported")
+		return
+	}
+	decoded, err := base64.StdEncoding.DecodeString(response)
+	if err != nil {
+		sess.reply(501, "invalid base64")
+		return
+	}
+	parts := strings.Split(string(decoded), "\x00")
+	if len(parts) != 3 {
+		sess.reply(501, "invalid PLAIN response")
+		return
+	}
+	s.mutex.Lock()
+	credentials := s.credentials
+	s.mutex.Unlock()
+	if password, ok := credentials[parts[1]]; credentials != nil && (!ok || password != parts[2]) {
+		sess.reply(535, "authentication failed")
+		return
+	}
+	sess.message.Username, sess.message.Password = parts[1], parts[2]
+	sess.reply(235, "authenticated")
+}
+
+func (s *Server) authorized(sess *session) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.credentials == nil || sess.message.Username != ""
+}
+
+func (sess *session) reset() {
+	sess.message = Message{Username: sess.message.Username, Password: sess.message.Password}
+	sess.hasSender = false
+}
+
+func (sess *session) reply(code int, message string) {
+	sess.text.PrintfLine("%d %s", code, message)
+}
+
+func (sess *session) replyLines(code int, lines []string) {
+	for i, line := range lines {
+		separator := "-"
+		if i == len(lines)-1 {
+			separator = " "
+		}
+		sess.text.PrintfLine("%s%s%s", strconv.Itoa(code), separator, line)
+	}
+}
+
+// trimPath turns "FROM:<a@b.c> SIZE=10" into "a@b.c".
+func trimPath(arg string, prefix string) string {
+	if len(arg) >= len(prefix) && strings.EqualFold(arg[:len(prefix)], prefix) {
+		arg = arg[len(prefix):]
+	}
+	path, _, _ := strings.Cut(strings.TrimSpace(arg), " ")
+	return strings.TrimSuffix(strings.TrimPrefix(path, "<"), ">")
+}
+
+// selfSignedCertificate makes a certificate for 127.0.0.1, and a pool which trusts it.
+func selfSignedCertificate() (tls.Certificate, *x509.CertPool, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	parsed, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, nil, fmt.Errorf("failed to parse the certificate: %v", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(parsed)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: parsed}, roots, nil
+}
@@ -1,5 +1,11 @@
 package accounts
 
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
 // EmailExistsError will be returned if callers try to create a new account
 // with an email that already exists in the system.
 type EmailExistsError struct {
@@ -37,12 +43,28 @@ func (i InvalidPasswordError) Error() string {
 	return "invalid password"
 }
 
+// AccountLockedError will be returned if the user tried to log in while their account
+// is locked because of too many failed logins.
+type AccountLockedError struct {
+	Until time.Time
+}
+
+func (e AccountLockedError) Error() string {
+	return "the account is locked until " + e.Until.UTC().Format(time.RFC3339)
+}
+
 // ProhibitedPasswordError will be returned if the user tries to set a password which
 // we don't allow.
-type ProhibitedPasswordError struct{}
+type ProhibitedPasswordError struct {
+	// Reasons describes each rule the password broke, like "must be at least 8 characters".
+	Reasons []string
+}
 
 func (e ProhibitedPasswordError) Error() string {
-	return "the password is unacceptable"
+	if len(e.Reasons) == 0 {
+		return "the password is unacceptable"
+	}
+	return "the password is unacceptable: it " + strings.Join(e.Reasons, ", and it ")
 }
 
 // InvalidResetTokenError will be returned if the user sent an unrecognized
@@ -52,3 +74,104 @@ type InvalidResetTokenError struct{}
 func (err InvalidResetTokenError) Error() string {
 	return "unrecognized verification token"
 }
+
+// InvalidVerificationTokenError will be returned if the user sent an unrecognized,
+// used or expired email verification token.
+type InvalidVerificationTokenError struct{}
+
+func (err InvalidVerificationTokenError) Error() string {
+	return "unrecognized email verification token"
+}
+
+// InvalidEmailChangeTokenError will be returned if the user sent an unrecognized,
+// used or expired token when confirming a new email.
+type InvalidEmailChangeTokenError struct{}
+
+func (err InvalidEmailChangeTokenError) Error() string {
+	return "unrecognized email change token"
+}
+
+// EmailAlreadyVerifiedError will be returned if the user asks to verify an email
+// which has been verified already.
+type EmailAlreadyVerifiedError struct {
+	Email string
+}
+
+func (e EmailAlreadyVerifiedError) Error() string {
+	return e.Email + " has already been verified"
+}
+
+// EmailNotVerifiedError will be returned if the user tries to do something which needs
+// a verified email before verifying it.
+type EmailNotVerifiedError struct {
+	Email string
+}
+
+func (e EmailNotVerifiedError) Error() string {
+	return e.Email + " has not been verified"
+}
+
+// QueuedEmailNotExistsError will be returned if callers try to operate on an email which isn't in the Outbox.
+type QueuedEmailNotExistsError struct {
+	ID int64
+}
+
+func (e QueuedEmailNotExistsError) Error() string {
+	return fmt.Sprintf("email %d is not in the outbox", e.ID)
+}
+
+// StoreNotEmptyError will be returned if callers try to import accounts into a Store which already has some.
+// Imports keep the accounts' IDs, so they could clash with the ones which are there.
+type StoreNotEmptyError struct{}
+
+func (e StoreNotEmptyError) Error() string {
+	return "the store already has accounts"
+}
+
+// StaleQueuedEmailError will be returned if a dead email can't be retried, because the tokens it carried
+// can't be replaced. This happens if the account moved to another email or was purged, or if it no longer needs the tokens.
+type StaleQueuedEmailError struct {
+	ID int64
+}
+
+func (e StaleQueuedEmailError) Error() string {
+	return fmt.Sprintf("email %d is out of date, so its tokens can't be replaced", e.ID)
+}
+
+// InvalidTwoFactorCodeError will be returned if the user sent a TOTP or recovery code which is wrong,
+// used or expired.
+type InvalidTwoFactorCodeError struct{}
+
+func (err InvalidTwoFactorCodeError) Error() string {
+	return "invalid two-factor code"
+}
+
+// TwoFactorCodeMissingError will be returned if the user sent the right password for an account with
+// two-factor auth on, but no code to go with it.
+type TwoFactorCodeMissingError struct{}
+
+func (err TwoFactorCodeMissingError) Error() string {
+	return "this account has two-factor auth on, so it needs a code too"
+}
+
+// TwoFactorEnabledError will be returned if the user tries to set up two-factor auth when it's on already.
+type TwoFactorEnabledError struct{}
+
+func (err TwoFactorEnabledError) Error() string {
+	return "two-factor auth is already on"
+}
+
+// TwoFactorNotEnrolledError will be returned if the user tries to use two-factor auth before setting it up.
+type TwoFactorNotEnrolledError struct{}
+
+func (err TwoFactorNotEnrolledError) Error() string {
+	return "two-factor auth has not been set up"
+}
+
+// TwoFactorRequiredError will be returned if the user tries to turn off two-factor auth
+// on an account which must have it.
+type TwoFactorRequiredError struct{}
+
+func (err TwoFactorRequiredError) Error() string {
+	return "two-factor auth is required for this account"
+}
@@ -2,6 +2,7 @@ package accounts_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/wikisophia/api/server/accounts"
@@ -18,6 +19,28 @@ func TestErrorMessages(t *testing.T) {
 		accounts.AccountNotExistsError{"some-mail@soph.wiki"},
 		"some-mail@soph.wiki does not have an account")
 	assert.EqualError(t, accounts.InvalidPasswordError{}, "invalid password")
+	assert.EqualError(t,
+		accounts.AccountLockedError{time.Date(2020, time.March, 1, 12, 30, 0, 0, time.UTC)},
+		"the account is locked until 2020-03-01T12:30:00Z")
 	assert.EqualError(t, accounts.ProhibitedPasswordError{}, "the password is unacceptable")
+	assert.EqualError(t,
+		accounts.ProhibitedPasswordError{[]string{"must be at least 8 characters", "has appeared in a data breach"}},
+		"the password is unacceptable: it must be at least 8 characters, and it has appeared in a data breach")
 	assert.EqualError(t, accounts.InvalidResetTokenError{}, "unrecognized verification token")
+	assert.EqualError(t, accounts.InvalidVerificationTokenError{}, "unrecognized email verification token")
+	assert.EqualError(t, accounts.InvalidEmailChangeTokenError{}, "unrecognized email change token")
+	assert.EqualError(t,
+		accounts.EmailAlreadyVerifiedError{"some-mail@soph.wiki"},
+		"some-mail@soph.wiki has already been verified")
+	assert.EqualError(t,
+		accounts.EmailNotVerifiedError{"some-mail@soph.wiki"},
+		"some-mail@soph.wiki has not been verified")
+	assert.EqualError(t, accounts.QueuedEmailNotExistsError{3}, "email 3 is not in the outbox")
+	assert.EqualError(t, accounts.StoreNotEmptyError{}, "the store already has accounts")
+	assert.EqualError(t, accounts.StaleQueuedEmailError{3}, "email 3 is out of date, so its tokens can't be replaced")
+	assert.EqualError(t, accounts.InvalidTwoFactorCodeError{}, "invalid two-factor code")
+	assert.EqualError(t, accounts.TwoFactorCodeMissingError{}, "this account has two-factor auth on, so it needs a code too")
+	assert.EqualError(t, accounts.TwoFactorEnabledError{}, "two-factor auth is already on")
+	assert.EqualError(t, accounts.TwoFactorNotEnrolledError{}, "two-factor auth has not been set up")
+	assert.EqualError(t, accounts.TwoFactorRequiredError{}, "two-factor auth is required for this account")
 }
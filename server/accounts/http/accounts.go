@@ -1,24 +1,24 @@
 package http
 
 import (
-	"context"
 	"encoding/json"
 	"io/ioutil"
-	"log"
 	"net/http"
+	"strconv"
 
 	"github.com/wikisophia/api/server/accounts"
-	"github.com/wikisophia/api/server/accounts/email"
+	"github.com/wikisophia/api/server/http/problems"
+	"github.com/wikisophia/api/server/http/timeouts"
 )
 
-type accountResetDependencies interface {
-	accounts.ResetTokenGenerator
-	email.Emailer
-}
-
 // Handle POST /accounts requests. This either registers a new account or
 // generates a password reset token if the account already exists.
-func accountHandler(dependencies accountResetDependencies) http.HandlerFunc {
+//
+// Both cases get the same response, so that clients can't use this to find out
+// which emails have accounts. Only the email's owner can tell.
+// The store queues the welcome or reset email along with the token, so it's sent even if the
+// email server is down right now.
+func accountHandler(generator accounts.ResetTokenGenerator) http.HandlerFunc {
 	type request struct {
 		Email string
 	}
@@ -26,34 +26,47 @@ func accountHandler(dependencies accountResetDependencies) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		payload, err := ioutil.ReadAll(r.Body)
 		if err != nil {
-			http.Error(w, "failed to read request body: "+err.Error(), http.StatusInternalServerError)
+			problems.Write(w, http.StatusBadRequest, problems.CodeMalformedRequest, "Failed to read the request body.")
 			return
 		}
 
 		var req request
 		if err = json.Unmarshal(payload, &req); err != nil {
-			http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+			problems.Write(w, http.StatusBadRequest, problems.CodeMalformedRequest, "invalid request body: "+err.Error())
 			return
 		}
 		if req.Email == "" {
-			http.Error(w, "missing required property: \"email\"", http.StatusBadRequest)
+			writeMissingProperty(w, "email")
 			return
 		}
 
-		account, accountIsNew, err := dependencies.NewResetToken(context.Background(), req.Email)
-		if err != nil {
-			http.Error(w, "An internal error occurred. Please try again later.", http.StatusInternalServerError)
+		_, _, err = generator.NewResetToken(r.Context(), req.Email)
+		if timeouts.WriteError(w, r, err) {
+			return
 		}
-
-		if accountIsNew {
-			if err = dependencies.SendWelcome(context.Background(), account); err != nil {
-				log.Printf("ERROR: Failed to send welcome email to %s: %v", account.Email, err)
-			}
-		} else {
-			if err = dependencies.SendReset(context.Background(), account); err != nil {
-				log.Printf("ERROR: Failed to send password reset email to %s: %v", account.Email, err)
-			}
+		if err != nil {
+			problems.WriteInternal(w, r, err)
+			return
 		}
 		w.WriteHeader(http.StatusNoContent)
 	}
 }
+
+func writeMissingProperty(w http.ResponseWriter, property string) {
+	problems.WriteInvalid(w, "missing required property: \""+property+"\"", []problems.FieldError{{
+		Field:  property,
+		Detail: "is required",
+	}})
+}
+
+// writeJSON responds with the response as JSON, and a 200 status.
+func writeJSON(w http.ResponseWriter, r *http.Request, response interface{}) {
+	data, err := json.Marshal(response)
+	if err != nil {
+		problems.WriteInternal(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Write(data)
+}
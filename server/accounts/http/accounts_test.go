@@ -9,6 +9,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/wikisophia/api/server/acceptancetest"
+	wikisophiaHttp "github.com/wikisophia/api/server/http"
 )
 
 func TestAccountAcceptsEmails(t *testing.T) {
@@ -31,6 +32,20 @@ func TestAccountSendsResetEmails(t *testing.T) {
 	require.Equal(t, app.Emailer.Welcomes[0].Email, app.Emailer.PasswordResets[0].Email)
 }
 
+func TestAccountResponsesIndistinguishable(t *testing.T) {
+	app := acceptancetest.NewApp(t, nil)
+	created := doSaveAccount(app, `{"email":"some-email@soph.wiki"}`)
+	existing := doSaveAccount(app, `{"email":"some-email@soph.wiki"}`)
+	require.Len(t, app.Emailer.Welcomes, 1)
+	require.Len(t, app.Emailer.PasswordResets, 1)
+
+	assert.Equal(t, created.Code, existing.Code)
+	assert.Equal(t, created.Body.String(), existing.Body.String())
+	created.Header().Del(wikisophiaHttp.RequestIDHeader)
+	existing.Header().Del(wikisophiaHttp.RequestIDHeader)
+	assert.Equal(t, created.Header(), existing.Header())
+}
+
 func TestAccountRejectsBadRequestBodies(t *testing.T) {
 	acceptancetest.AssertBadRequest(t, "POST", "/accounts", "not json")
 	acceptancetest.AssertBadRequest(t, "POST", "/accounts", "{}")
@@ -6,12 +6,16 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/wikisophia/api/server/acceptancetest"
 	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/accounts/totp"
+	"github.com/wikisophia/api/server/http/problems"
 )
 
 func newApp(t *testing.T, cfg *acceptancetest.AppConfig) *app {
@@ -61,6 +65,25 @@ func (a *app) ResetPasswordSuccessfully(id int64, resetToken, password string) {
 	require.Equal(a.t, http.StatusNoContent, a.ResetPassword(id, resetToken, password).Code)
 }
 
+func (a *app) VerifyEmail(id int64, token string) *httptest.ResponseRecorder {
+	type request struct {
+		ID    int64  `json:"id"`
+		Token string `json:"token"`
+	}
+	data, err := json.Marshal(request{id, token})
+	require.NoError(a.t, err)
+	return a.Do(httptest.NewRequest("POST", "/accounts/verify", bytes.NewReader(data)))
+}
+
+func (a *app) ResendVerification(email string) *httptest.ResponseRecorder {
+	type request struct {
+		Email string `json:"email"`
+	}
+	data, err := json.Marshal(request{email})
+	require.NoError(a.t, err)
+	return a.Do(httptest.NewRequest("POST", "/accounts/verify/resend", bytes.NewReader(data)))
+}
+
 func (a *app) Authenticate(email, password string) *httptest.ResponseRecorder {
 	type request struct {
 		Email    string `json:"email"`
@@ -87,11 +110,17 @@ func (a *app) AuthenticateSuccessfully(email, password string) string {
 }
 
 func (a *app) UpdatePassword(id int64, oldPassword, newPassword string) *httptest.ResponseRecorder {
+	return a.UpdatePasswordWithCode(id, oldPassword, newPassword, "")
+}
+
+// UpdatePasswordWithCode changes the password of an account with two-factor auth on.
+func (a *app) UpdatePasswordWithCode(id int64, oldPassword, newPassword, code string) *httptest.ResponseRecorder {
 	type request struct {
 		OldPassword string `json:"oldPassword"`
 		Password    string `json:"password"`
+		Code        string `json:"code,omitempty"`
 	}
-	data, err := json.Marshal(request{oldPassword, newPassword})
+	data, err := json.Marshal(request{oldPassword, newPassword, code})
 	require.NoError(a.t, err)
 	return a.Do(httptest.NewRequest("POST", "/accounts/"+strconv.FormatInt(id, 10)+"/password", bytes.NewReader(data)))
 }
@@ -100,3 +129,184 @@ func (a *app) UpdatePasswordSuccessfully(id int64, oldPassword, newPassword stri
 	rr := a.UpdatePassword(id, oldPassword, newPassword)
 	require.Equal(a.t, http.StatusNoContent, rr.Code)
 }
+
+func (a *app) RequestEmailChange(id int64, password, newEmail string) *httptest.ResponseRecorder {
+	return a.RequestEmailChangeWithCode(id, password, newEmail, "")
+}
+
+// RequestEmailChangeWithCode asks to move an account with two-factor auth on to a new email.
+func (a *app) RequestEmailChangeWithCode(id int64, password, newEmail, code string) *httptest.ResponseRecorder {
+	type request struct {
+		Password string `json:"password"`
+		Email    string `json:"email"`
+		Code     string `json:"code,omitempty"`
+	}
+	data, err := json.Marshal(request{password, newEmail, code})
+	require.NoError(a.t, err)
+	return a.Do(httptest.NewRequest("POST", "/accounts/"+strconv.FormatInt(id, 10)+"/email", bytes.NewReader(data)))
+}
+
+func (a *app) RequestEmailChangeSuccessfully(id int64, password, newEmail string) accounts.Account {
+	numChanges := len(a.Emailer.EmailChanges)
+	require.Equal(a.t, http.StatusNoContent, a.RequestEmailChange(id, password, newEmail).Code)
+	require.Len(a.t, a.Emailer.EmailChanges, numChanges+1)
+	return *a.Emailer.EmailChanges[numChanges]
+}
+
+func (a *app) ConfirmEmailChange(id int64, token string) *httptest.ResponseRecorder {
+	type request struct {
+		Token string `json:"token"`
+	}
+	data, err := json.Marshal(request{token})
+	require.NoError(a.t, err)
+	return a.Do(httptest.NewRequest("POST", "/accounts/"+strconv.FormatInt(id, 10)+"/email", bytes.NewReader(data)))
+}
+
+func (a *app) GetAccount(id string, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/accounts/"+id, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return a.Do(req)
+}
+
+func (a *app) UpdateMe(token string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("PATCH", "/accounts/me", strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return a.Do(req)
+}
+
+func (a *app) DeleteMe(token string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("DELETE", "/accounts/me", strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return a.Do(req)
+}
+
+func (a *app) RestoreMe(token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/accounts/me/restore", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return a.Do(req)
+}
+
+func (a *app) ExportMe(token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/accounts/me/export", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return a.Do(req)
+}
+
+// WriteArgument saves a new argument if id is 0, or a new version of argument id otherwise.
+// The token is the session of the account which wrote it. If it's empty, nobody did.
+func (a *app) WriteArgument(token string, id int64, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/arguments", strings.NewReader(body))
+	if id != 0 {
+		req = httptest.NewRequest("PATCH", "/arguments/"+strconv.FormatInt(id, 10), strings.NewReader(body))
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return a.Do(req)
+}
+
+// EnrollTwoFactor sends a request to set up two-factor auth. The token is the session, if there is one.
+func (a *app) EnrollTwoFactor(token string, id int64, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/accounts/"+strconv.FormatInt(id, 10)+"/two-factor", strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return a.Do(req)
+}
+
+// EnableTwoFactorSuccessfully turns on two-factor auth for the account, and returns its secret and recovery codes.
+// It logs in first, and uses the session or the setup token which that returns. The TOTP code for the current period is used up.
+func (a *app) EnableTwoFactorSuccessfully(id int64, email, password string) (string, []string) {
+	type request struct {
+		Password   string `json:"password,omitempty"`
+		Code       string `json:"code,omitempty"`
+		SetupToken string `json:"setupToken,omitempty"`
+	}
+	var session, setupToken string
+	if rr := a.Authenticate(email, password); rr.Code == http.StatusOK {
+		session = a.AuthenticateSuccessfully(email, password)
+	} else {
+		problem := acceptancetest.ParseProblem(a.t, rr)
+		require.Equal(a.t, problems.CodeTwoFactorSetupRequired, problem.Code)
+		require.NotEmpty(a.t, problem.SetupToken)
+		setupToken = problem.SetupToken
+	}
+
+	var enrollment struct {
+		Secret string `json:"secret"`
+		URI    string `json:"uri"`
+	}
+	data, err := json.Marshal(request{Password: password, SetupToken: setupToken})
+	require.NoError(a.t, err)
+	rr := a.EnrollTwoFactor(session, id, string(data))
+	require.Equal(a.t, http.StatusOK, rr.Code)
+	require.NoError(a.t, json.Unmarshal(rr.Body.Bytes(), &enrollment))
+	require.NotEmpty(a.t, enrollment.Secret)
+	assert.True(a.t, strings.HasPrefix(enrollment.URI, "otpauth://totp/"), "bad uri: %s", enrollment.URI)
+
+	code, err := totp.Code(enrollment.Secret, time.Now())
+	require.NoError(a.t, err)
+	var confirmation struct {
+		RecoveryCodes []string `json:"recoveryCodes"`
+	}
+	data, err = json.Marshal(request{Code: code, SetupToken: setupToken})
+	require.NoError(a.t, err)
+	rr = a.EnrollTwoFactor(session, id, string(data))
+	require.Equal(a.t, http.StatusOK, rr.Code)
+	require.NoError(a.t, json.Unmarshal(rr.Body.Bytes(), &confirmation))
+	require.Len(a.t, confirmation.RecoveryCodes, totp.RecoveryCodeCount)
+	return enrollment.Secret, confirmation.RecoveryCodes
+}
+
+func (a *app) DisableTwoFactor(id int64, password, code string) *httptest.ResponseRecorder {
+	type request struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}
+	data, err := json.Marshal(request{password, code})
+	require.NoError(a.t, err)
+	return a.Do(httptest.NewRequest("DELETE", "/accounts/"+strconv.FormatInt(id, 10)+"/two-factor", bytes.NewReader(data)))
+}
+
+func (a *app) GetTwoFactor(token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/accounts/me/two-factor", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return a.Do(req)
+}
+
+// AuthenticateForChallenge logs in with a password, and returns the challenge for an account with two-factor auth.
+func (a *app) AuthenticateForChallenge(email, password string) string {
+	var response struct {
+		Challenge string `json:"challenge"`
+		Token     string `json:"token"`
+	}
+	rr := a.Authenticate(email, password)
+	require.Equal(a.t, http.StatusOK, rr.Code)
+	assert.Empty(a.t, rr.Header().Get("Set-Cookie"))
+	require.NoError(a.t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Empty(a.t, response.Token)
+	require.NotEmpty(a.t, response.Challenge)
+	return response.Challenge
+}
+
+func (a *app) FinishAuthentication(challenge, code string) *httptest.ResponseRecorder {
+	type request struct {
+		Challenge string `json:"challenge"`
+		Code      string `json:"code"`
+	}
+	data, err := json.Marshal(request{challenge, code})
+	require.NoError(a.t, err)
+	return a.Do(httptest.NewRequest("POST", "/sessions", bytes.NewReader(data)))
+}
@@ -0,0 +1,199 @@
+package http
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/arguments"
+	"github.com/wikisophia/api/server/config"
+	"github.com/wikisophia/api/server/http/problems"
+	"github.com/wikisophia/api/server/http/timeouts"
+	"github.com/wikisophia/api/server/logging"
+)
+
+type exportDependencies interface {
+	accounts.Profile
+	accounts.EmailVerifier
+	accounts.LoginTracker
+	accounts.TwoFactor
+	accounts.Sessions
+	arguments.GetAuthored
+}
+
+// Implements DELETE /accounts/me
+//
+// The account isn't purged right away. It waits out the grace period first, and can be restored until then.
+func deleteMeHandler(key *ecdsa.PrivateKey, cfg config.Deletion, deleter accounts.Deleter) http.HandlerFunc {
+	type request struct {
+		Password string `json:"password"`
+	}
+	type response struct {
+		DeletionDueAt time.Time `json:"deletionDueAt"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := SessionAccountID(key, r)
+		if !ok {
+			problems.Write(w, http.StatusForbidden, problems.CodePermissionDenied, "Log in to delete your account.")
+			return
+		}
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			problems.Write(w, http.StatusBadRequest, problems.CodeMalformedRequest, "Failed to read the request body.")
+			return
+		}
+		var req request
+		if err := json.Unmarshal(data, &req); err != nil {
+			problems.Write(w, http.StatusBadRequest, problems.CodeMalformedRequest, "Malformed request: "+err.Error())
+			return
+		}
+		if req.Password == "" {
+			writeMissingProperty(w, "password")
+			return
+		}
+
+		dueAt := time.Now().Add(cfg.GracePeriod()).UTC().Truncate(time.Second)
+		err = deleter.ScheduleDeletion(r.Context(), id, req.Password, dueAt)
+		if timeouts.WriteError(w, r, err) {
+			return
+		}
+		var locked accounts.AccountLockedError
+		if errors.As(err, &locked) {
+			writeAccountLocked(w, locked)
+			return
+		}
+		if errors.As(err, &accounts.InvalidPasswordError{}) || errors.As(err, &accounts.AccountNotExistsError{}) {
+			problems.Write(w, http.StatusForbidden, problems.CodePermissionDenied, "Unauthorized")
+			return
+		}
+		if err != nil {
+			problems.WriteInternal(w, r, err)
+			return
+		}
+		logging.SetAccountID(r.Context(), id)
+		data, err = json.Marshal(response{DeletionDueAt: dueAt})
+		if err != nil {
+			problems.WriteInternal(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.WriteHeader(http.StatusAccepted)
+		w.Write(data)
+	}
+}
+
+// Implements POST /accounts/me/restore
+//
+// This calls off a deletion which hasn't been purged yet.
+func restoreMeHandler(key *ecdsa.PrivateKey, deleter accounts.Deleter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := SessionAccountID(key, r)
+		if !ok {
+			problems.Write(w, http.StatusForbidden, problems.CodePermissionDenied, "Log in to restore your account.")
+			return
+		}
+		if respondToProfileError(w, r, deleter.CancelDeletion(r.Context(), id)) {
+			return
+		}
+		logging.SetAccountID(r.Context(), id)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// Implements GET /accounts/me/export
+//
+// This is everything the stores keep about the account which is logged in, including every argument version it wrote.
+// Sessions only say when and where the account logged in. Their tokens aren't stored, so they can't be exported.
+// Two-factor secrets and recovery codes are left out too, since they're credentials rather than personal data.
+func exportMeHandler(key *ecdsa.PrivateKey, dependencies exportDependencies) http.HandlerFunc {
+	type loginFailures struct {
+		Count       int        `json:"count"`
+		LockedUntil *time.Time `json:"lockedUntil,omitempty"`
+	}
+	type session struct {
+		IssuedAt   time.Time `json:"issuedAt"`
+		LastUsedAt time.Time `json:"lastUsedAt"`
+		Client     string    `json:"client"`
+	}
+	type response struct {
+		ExportedAt      time.Time            `json:"exportedAt"`
+		Account         meResponse           `json:"account"`
+		EmailVerifiedAt *time.Time           `json:"emailVerifiedAt,omitempty"`
+		LoginFailures   loginFailures        `json:"loginFailures"`
+		TwoFactor       twoFactorResponse    `json:"twoFactor"`
+		Sessions        []session            `json:"sessions"`
+		Arguments       []arguments.Argument `json:"arguments"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := SessionAccountID(key, r)
+		if !ok {
+			problems.Write(w, http.StatusForbidden, problems.CodePermissionDenied, "Log in to export your account.")
+			return
+		}
+		profile, err := dependencies.AccountProfile(r.Context(), id)
+		if respondToProfileError(w, r, err) {
+			return
+		}
+		verifiedAt, err := dependencies.EmailVerifiedAt(r.Context(), id)
+		if respondToProfileError(w, r, err) {
+			return
+		}
+		failures, err := dependencies.LoginFailures(r.Context(), profile.Email)
+		if respondToProfileError(w, r, err) {
+			return
+		}
+		twoFactor, err := dependencies.TwoFactorStatus(r.Context(), id)
+		if respondToProfileError(w, r, err) {
+			return
+		}
+		stored, err := dependencies.AccountSessions(r.Context(), id)
+		if respondToProfileError(w, r, err) {
+			return
+		}
+		sessions := make([]session, 0, len(stored))
+		for _, s := range stored {
+			sessions = append(sessions, session{
+				IssuedAt:   s.IssuedAt.UTC().Truncate(time.Second),
+				LastUsedAt: s.LastUsedAt.UTC().Truncate(time.Minute),
+				Client:     s.Client,
+			})
+		}
+		authored, err := dependencies.FetchAuthored(r.Context(), id)
+		if respondToProfileError(w, r, err) {
+			return
+		}
+
+		archive := response{
+			ExportedAt:      time.Now().UTC().Truncate(time.Second),
+			Account:         newMeResponse(profile),
+			EmailVerifiedAt: optionalTime(verifiedAt),
+			LoginFailures: loginFailures{
+				Count:       failures.Count,
+				LockedUntil: optionalTime(failures.LockedUntil),
+			},
+			TwoFactor: newTwoFactorResponse(twoFactor),
+			Sessions:  sessions,
+			Arguments: authored,
+		}
+		logging.SetAccountID(r.Context(), id)
+		w.Header().Set("Content-Disposition", `attachment; filename="wikisophia-account-`+strconv.FormatInt(id, 10)+`.json"`)
+		writeJSON(w, r, archive)
+	}
+}
+
+// optionalTime returns nil for the zero Time, so that JSON can leave it out.
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	utc := t.UTC()
+	return &utc
+}
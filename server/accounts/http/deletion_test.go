@@ -0,0 +1,167 @@
+package http_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wikisophia/api/server/acceptancetest"
+	"github.com/wikisophia/api/server/config"
+	"github.com/wikisophia/api/server/http/problems"
+)
+
+func TestDeletedAccountsPurgedAfterGracePeriod(t *testing.T) {
+	a := newApp(t, &acceptancetest.AppConfig{
+		EmailerSucceeds: true,
+		Deletion:        &config.Deletion{GracePeriodMillis: 3600000, PurgeIntervalMillis: 1000},
+	})
+	acct := a.SaveAccountSuccessfully("some-email@soph.wiki")
+	a.ResetPasswordSuccessfully(acct.ID, acct.ResetToken, "some-password")
+	token := a.AuthenticateSuccessfully("some-email@soph.wiki", "some-password")
+	require.Equal(t, http.StatusOK, a.UpdateMe(token, `{"displayName":"Someone"}`).Code)
+
+	rr := a.DeleteMe(token, `{"password":"some-password"}`)
+	require.Equal(t, http.StatusAccepted, rr.Code)
+	var deletion struct {
+		DeletionDueAt time.Time `json:"deletionDueAt"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &deletion))
+	assert.WithinDuration(t, time.Now().Add(time.Hour), deletion.DeletionDueAt, time.Minute)
+	rr = a.GetAccount("me", token)
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"deletionDueAt"`)
+
+	assert.Equal(t, 0, a.PurgeAccounts(time.Now()))
+	a.AuthenticateSuccessfully("some-email@soph.wiki", "some-password")
+	assert.Equal(t, 1, a.PurgeAccounts(deletion.DeletionDueAt))
+
+	assert.Equal(t, http.StatusForbidden, a.Authenticate("some-email@soph.wiki", "some-password").Code)
+	assert.Equal(t, http.StatusForbidden, a.GetAccount("me", token).Code)
+	assert.Equal(t, http.StatusNotFound, a.GetAccount(strconv.FormatInt(acct.ID, 10), "").Code)
+	assert.Equal(t, http.StatusForbidden, a.ExportMe(token).Code)
+	assert.Equal(t, http.StatusForbidden, a.RestoreMe(token).Code)
+	assert.NotEqual(t, acct.ID, a.SaveAccountSuccessfully("some-email@soph.wiki").ID)
+}
+
+func TestDeletionCanBeCalledOff(t *testing.T) {
+	a := newApp(t, nil)
+	acct := a.SaveAccountSuccessfully("some-email@soph.wiki")
+	a.ResetPasswordSuccessfully(acct.ID, acct.ResetToken, "some-password")
+	token := a.AuthenticateSuccessfully("some-email@soph.wiki", "some-password")
+
+	require.Equal(t, http.StatusAccepted, a.DeleteMe(token, `{"password":"some-password"}`).Code)
+	require.Equal(t, http.StatusNoContent, a.RestoreMe(token).Code)
+	rr := a.GetAccount("me", token)
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.NotContains(t, rr.Body.String(), `"deletionDueAt"`)
+	assert.Equal(t, 0, a.PurgeAccounts(time.Now().Add(365*24*time.Hour)))
+	a.AuthenticateSuccessfully("some-email@soph.wiki", "some-password")
+}
+
+func TestDeletionRejectsBadRequestsProperly(t *testing.T) {
+	a := newApp(t, nil)
+	acct := a.SaveAccountSuccessfully("some-email@soph.wiki")
+	a.ResetPasswordSuccessfully(acct.ID, acct.ResetToken, "some-password")
+	token := a.AuthenticateSuccessfully("some-email@soph.wiki", "some-password")
+
+	assert.Equal(t, http.StatusForbidden, a.DeleteMe("", `{"password":"some-password"}`).Code)
+	assert.Equal(t, http.StatusForbidden, a.DeleteMe("not-a-jwt", `{"password":"some-password"}`).Code)
+	assert.Equal(t, http.StatusForbidden, a.DeleteMe(token, `{"password":"some-wrong-password"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, a.DeleteMe(token, "not json").Code)
+	assert.Equal(t, http.StatusBadRequest, a.DeleteMe(token, "{}").Code)
+	assert.Equal(t, http.StatusForbidden, a.RestoreMe("").Code)
+	a.AssertNotFound("DELETE", "/accounts/"+strconv.FormatInt(acct.ID, 10))
+	a.AssertNotFound("GET", "/accounts/"+strconv.FormatInt(acct.ID, 10)+"/export")
+	a.AssertNotFound("POST", "/accounts/"+strconv.FormatInt(acct.ID, 10)+"/restore")
+	assert.Equal(t, 0, a.PurgeAccounts(time.Now().Add(365*24*time.Hour)))
+}
+
+func TestWrongDeletionPasswordsLockAccount(t *testing.T) {
+	a := newApp(t, nil)
+	acct := a.SaveAccountSuccessfully("some-email@soph.wiki")
+	a.ResetPasswordSuccessfully(acct.ID, acct.ResetToken, "some-password")
+	token := a.AuthenticateSuccessfully("some-email@soph.wiki", "some-password")
+	threshold := config.Defaults().Lockout.Threshold
+	for i := 1; i < threshold; i++ {
+		assert.Equal(t, problems.CodePermissionDenied, acceptancetest.ParseProblem(t, a.DeleteMe(token, `{"password":"some-wrong-password"}`)).Code)
+	}
+
+	rr := a.DeleteMe(token, `{"password":"some-wrong-password"}`)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Equal(t, problems.CodeAccountLocked, acceptancetest.ParseProblem(t, rr).Code)
+	rr = a.DeleteMe(token, `{"password":"some-password"}`)
+	assert.Equal(t, problems.CodeAccountLocked, acceptancetest.ParseProblem(t, rr).Code)
+}
+
+func TestExportHasTheWholeAccount(t *testing.T) {
+	a := newApp(t, nil)
+	acct := a.SaveAccountSuccessfully("some-email@soph.wiki")
+	a.ResetPasswordSuccessfully(acct.ID, acct.ResetToken, "some-password")
+	token := a.AuthenticateSuccessfully("some-email@soph.wiki", "some-password")
+	require.Equal(t, http.StatusOK, a.UpdateMe(token, `{"displayName":"Someone","preferences":{"theme":"dark"}}`).Code)
+	require.Equal(t, http.StatusForbidden, a.Authenticate("some-email@soph.wiki", "some-wrong-password").Code)
+	require.Equal(t, http.StatusCreated, a.WriteArgument(token, 0, `{"conclusion":"c","premises":["p1","p2"]}`).Code)
+	require.Equal(t, http.StatusOK, a.WriteArgument("", 1, `{"conclusion":"c","premises":["p3","p4"]}`).Code)
+	require.Equal(t, http.StatusOK, a.WriteArgument(token, 1, `{"conclusion":"c","premises":["p5","p6"]}`).Code)
+	require.Equal(t, http.StatusCreated, a.WriteArgument("", 0, `{"conclusion":"someone else's","premises":["p1","p2"]}`).Code)
+
+	assert.Equal(t, http.StatusForbidden, a.ExportMe("").Code)
+	rr := a.ExportMe(token)
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json; charset=utf-8", rr.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="wikisophia-account-`+strconv.FormatInt(acct.ID, 10)+`.json"`, rr.Header().Get("Content-Disposition"))
+	var archive map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &archive))
+	assert.Contains(t, archive, "exportedAt")
+	assert.JSONEq(t, `{"id":`+strconv.FormatInt(acct.ID, 10)+`,"email":"some-email@soph.wiki","displayName":"Someone","bio":"","preferences":{"theme":"dark"}}`, string(archive["account"]))
+	assert.JSONEq(t, `{"count":1}`, string(archive["loginFailures"]))
+	assert.JSONEq(t, `{"enabled":false,"required":false,"recoveryCodesLeft":0}`, string(archive["twoFactor"]))
+	assert.JSONEq(t, `[
+		{"id":1,"version":1,"conclusion":"c","premises":["p1","p2"]},
+		{"id":1,"version":3,"conclusion":"c","premises":["p5","p6"]}
+	]`, string(archive["arguments"]))
+	assert.NotContains(t, a.Do(httptest.NewRequest("GET", "/arguments/1/version/1", nil)).Body.String(), "author",
+		"only the author should be able to see who wrote an argument")
+	assert.NotContains(t, rr.Body.String(), "some-password")
+}
+
+func TestExportHasTheSessions(t *testing.T) {
+	a := newApp(t, nil)
+	acct := a.SaveAccountSuccessfully("some-email@soph.wiki")
+	a.ResetPasswordSuccessfully(acct.ID, acct.ResetToken, "some-password")
+	before := time.Now().Truncate(time.Second)
+	a.AuthenticateSuccessfully("some-email@soph.wiki", "some-password")
+	req := httptest.NewRequest("POST", "/sessions", strings.NewReader(`{"email":"some-email@soph.wiki","password":"some-password"}`))
+	req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0")
+	rr := a.Do(req)
+	require.Equal(t, http.StatusOK, rr.Code)
+	var session struct {
+		Token string `json:"token"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &session))
+
+	rr = a.ExportMe(session.Token)
+	require.Equal(t, http.StatusOK, rr.Code)
+	var archive struct {
+		Sessions []struct {
+			IssuedAt   time.Time `json:"issuedAt"`
+			LastUsedAt time.Time `json:"lastUsedAt"`
+			Client     string    `json:"client"`
+		} `json:"sessions"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &archive))
+	require.Len(t, archive.Sessions, 2)
+	assert.Equal(t, "", archive.Sessions[0].Client)
+	assert.Equal(t, "Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0", archive.Sessions[1].Client)
+	for _, s := range archive.Sessions {
+		assert.False(t, s.IssuedAt.Before(before))
+		assert.False(t, s.LastUsedAt.After(s.IssuedAt))
+	}
+	assert.NotContains(t, rr.Body.String(), session.Token)
+}
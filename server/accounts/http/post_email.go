@@ -0,0 +1,117 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/http/problems"
+	"github.com/wikisophia/api/server/http/timeouts"
+	"github.com/wikisophia/api/server/logging"
+)
+
+// Implements POST /accounts/:id/email
+//
+// A request with the password and new email asks to move the account there. If the account has two-factor auth on,
+// it needs a code as well. The store queues a token for the new email, and a notice for the old one.
+// A request with that token confirms the move.
+func changeEmailHandler(changer accounts.EmailChanger) httprouter.Handle {
+	type request struct {
+		Password string `json:"password"`
+		Email    string `json:"email"`
+		Code     string `json:"code"`
+		Token    string `json:"token"`
+	}
+
+	respondToStoreError := func(w http.ResponseWriter, r *http.Request, err error) {
+		if timeouts.WriteError(w, r, err) {
+			return
+		}
+		var locked accounts.AccountLockedError
+		if errors.As(err, &locked) {
+			writeAccountLocked(w, locked)
+			return
+		}
+		if writeTwoFactorCodeMissing(w, err) {
+			return
+		}
+		// Don't give away which accounts exist and which ones don't.
+		if errors.As(err, &accounts.InvalidPasswordError{}) ||
+			errors.As(err, &accounts.InvalidTwoFactorCodeError{}) ||
+			errors.As(err, &accounts.InvalidEmailChangeTokenError{}) ||
+			errors.As(err, &accounts.AccountNotExistsError{}) {
+			problems.Write(w, http.StatusForbidden, problems.CodePermissionDenied, "Unauthorized")
+			return
+		}
+		problems.WriteInternal(w, r, err)
+	}
+
+	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		id, err := strconv.ParseInt(params.ByName("id"), 10, 0)
+		if err != nil {
+			problems.Write(w, http.StatusForbidden, problems.CodePermissionDenied, "Unauthorized")
+			return
+		}
+
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			problems.Write(w, http.StatusBadRequest, problems.CodeMalformedRequest, "Failed to read the request body.")
+			return
+		}
+		var req request
+		if err := json.Unmarshal(data, &req); err != nil {
+			problems.Write(w, http.StatusBadRequest, problems.CodeMalformedRequest, "Malformed request: "+err.Error())
+			return
+		}
+
+		if req.Token != "" {
+			if req.Password != "" || req.Email != "" || req.Code != "" {
+				problems.WriteInvalid(w, "A token confirms a change which was already requested, so it can't have a password, email or code.", []problems.FieldError{{
+					Field:  "token",
+					Detail: "must not be defined along with password, email or code",
+				}})
+				return
+			}
+			err := changer.ConfirmEmailChange(r.Context(), id, req.Token)
+			var taken accounts.EmailExistsError
+			if errors.As(err, &taken) {
+				problems.Write(w, http.StatusConflict, problems.CodeEmailTaken, "Another account has "+taken.Email+" now.")
+				return
+			}
+			if err != nil {
+				respondToStoreError(w, r, err)
+				return
+			}
+			logging.SetAccountID(r.Context(), id)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if req.Email == "" {
+			writeMissingProperty(w, "email")
+			return
+		}
+		if req.Password == "" {
+			writeMissingProperty(w, "password")
+			return
+		}
+		_, err = changer.RequestEmailChange(r.Context(), id, req.Password, req.Email, req.Code)
+		if errors.As(err, &accounts.EmailExistsError{}) {
+			problems.WriteInvalid(w, "The account has this email already.", []problems.FieldError{{
+				Field:  "email",
+				Detail: "must be different from the account's email",
+			}})
+			return
+		}
+		if err != nil {
+			respondToStoreError(w, r, err)
+			return
+		}
+		logging.SetAccountID(r.Context(), id)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
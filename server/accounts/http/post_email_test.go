@@ -0,0 +1,106 @@
+package http_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wikisophia/api/server/acceptancetest"
+	"github.com/wikisophia/api/server/config"
+	"github.com/wikisophia/api/server/http/problems"
+)
+
+func TestEmailChangesProperly(t *testing.T) {
+	a := newApp(t, nil)
+	acct := a.SaveAccountSuccessfully("old@soph.wiki")
+	a.ResetPasswordSuccessfully(acct.ID, acct.ResetToken, "some-password")
+
+	require.Equal(t, http.StatusForbidden, a.RequestEmailChange(acct.ID, "some-wrong-password", "new@soph.wiki").Code)
+	change := a.RequestEmailChangeSuccessfully(acct.ID, "some-password", "new@soph.wiki")
+	assert.Equal(t, "new@soph.wiki", change.Email)
+	require.Len(t, a.Emailer.EmailChangeNotices, 1)
+	assert.Equal(t, "old@soph.wiki", a.Emailer.EmailChangeNotices[0].Email)
+	assert.Empty(t, a.Emailer.EmailChangeNotices[0].EmailChangeToken)
+	a.AuthenticateSuccessfully("old@soph.wiki", "some-password")
+
+	require.Equal(t, http.StatusForbidden, a.ConfirmEmailChange(acct.ID, "wrong-"+change.EmailChangeToken).Code)
+	require.Equal(t, http.StatusNoContent, a.ConfirmEmailChange(acct.ID, change.EmailChangeToken).Code)
+	require.Equal(t, http.StatusForbidden, a.Authenticate("old@soph.wiki", "some-password").Code)
+	a.AuthenticateSuccessfully("new@soph.wiki", "some-password")
+}
+
+func TestEmailChangeToTakenEmailConflicts(t *testing.T) {
+	a := newApp(t, nil)
+	acct := a.SaveAccountSuccessfully("old@soph.wiki")
+	a.ResetPasswordSuccessfully(acct.ID, acct.ResetToken, "some-password")
+	change := a.RequestEmailChangeSuccessfully(acct.ID, "some-password", "taken@soph.wiki")
+	a.SaveAccountSuccessfully("taken@soph.wiki")
+
+	rr := a.ConfirmEmailChange(acct.ID, change.EmailChangeToken)
+	require.Equal(t, http.StatusConflict, rr.Code)
+	assert.Equal(t, problems.CodeEmailTaken, acceptancetest.ParseProblem(t, rr).Code)
+	a.AuthenticateSuccessfully("old@soph.wiki", "some-password")
+}
+
+func TestEmailChangeRejectsBadRequestsProperly(t *testing.T) {
+	a := newApp(t, nil)
+	validRequest := `{"password":"some-password","email":"new@soph.wiki"}`
+	assert.Equal(t, http.StatusForbidden,
+		a.Do(httptest.NewRequest("POST", "/accounts/1/email", strings.NewReader(validRequest))).Code)
+	assert.Equal(t, http.StatusForbidden,
+		a.Do(httptest.NewRequest("POST", "/accounts/non-numeric/email", strings.NewReader(validRequest))).Code)
+
+	acct := a.SaveAccountSuccessfully("old@soph.wiki")
+	a.ResetPasswordSuccessfully(acct.ID, acct.ResetToken, "some-password")
+	idString := strconv.FormatInt(acct.ID, 10)
+	a.AssertBadRequest("POST", "/accounts/"+idString+"/email", "not json")
+	a.AssertBadRequest("POST", "/accounts/"+idString+"/email", "5")
+	a.AssertBadRequest("POST", "/accounts/"+idString+"/email", "{}")
+	a.AssertBadRequest("POST", "/accounts/"+idString+"/email", `{"password":"some-password"}`)
+	a.AssertBadRequest("POST", "/accounts/"+idString+"/email", `{"email":"new@soph.wiki"}`)
+	a.AssertBadRequest("POST", "/accounts/"+idString+"/email", `{"password":"some-password","email":"old@soph.wiki"}`)
+	a.AssertBadRequest("POST", "/accounts/"+idString+"/email", `{"password":"some-password","token":"abc"}`)
+	a.AssertBadRequest("POST", "/accounts/"+idString+"/email", `{"email":"new@soph.wiki","token":"abc"}`)
+	assert.Empty(t, a.Emailer.EmailChanges)
+}
+
+func TestEmailChangeThroughEmailLinks(t *testing.T) {
+	dir := t.TempDir()
+	a := newApp(t, &acceptancetest.AppConfig{MailDir: dir})
+
+	require.Equal(t, http.StatusNoContent, a.SaveAccount("old@soph.wiki").Code)
+	reset := acceptancetest.LatestEmail(t, dir, "old@soph.wiki").ResetLink(t)
+	a.ResetPasswordSuccessfully(reset.ID, reset.Token, "some-password")
+
+	require.Equal(t, http.StatusNoContent, a.RequestEmailChange(reset.ID, "some-password", "new@soph.wiki").Code)
+	notice := acceptancetest.LatestEmail(t, dir, "old@soph.wiki")
+	assert.Equal(t, "Your Wikisophia account is moving to a new email", notice.Subject)
+	assert.NotContains(t, notice.Text, "/confirm-email")
+	confirmation := acceptancetest.LatestEmail(t, dir, "new@soph.wiki")
+	assert.Equal(t, "Confirm your new email for Wikisophia", confirmation.Subject)
+	confirm := confirmation.ConfirmLink(t)
+	assert.Equal(t, reset.ID, confirm.ID)
+
+	require.Equal(t, http.StatusNoContent, a.ConfirmEmailChange(confirm.ID, confirm.Token).Code)
+	a.AuthenticateSuccessfully("new@soph.wiki", "some-password")
+}
+
+func TestWrongEmailChangePasswordsLockAccount(t *testing.T) {
+	a := newApp(t, nil)
+	acct := a.SaveAccountSuccessfully("old@soph.wiki")
+	a.ResetPasswordSuccessfully(acct.ID, acct.ResetToken, "some-password")
+	threshold := config.Defaults().Lockout.Threshold
+	for i := 1; i < threshold; i++ {
+		assert.Equal(t, problems.CodePermissionDenied, acceptancetest.ParseProblem(t, a.RequestEmailChange(acct.ID, "wrong-password", "new@soph.wiki")).Code)
+	}
+
+	rr := a.RequestEmailChange(acct.ID, "wrong-password", "new@soph.wiki")
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Equal(t, problems.CodeAccountLocked, acceptancetest.ParseProblem(t, rr).Code)
+	rr = a.RequestEmailChange(acct.ID, "some-password", "new@soph.wiki")
+	assert.Equal(t, problems.CodeAccountLocked, acceptancetest.ParseProblem(t, rr).Code)
+}
@@ -1,7 +1,6 @@
 package http
 
 import (
-	"context"
 	"encoding/json"
 	"errors"
 	"io/ioutil"
@@ -10,75 +9,118 @@ import (
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/http/problems"
+	"github.com/wikisophia/api/server/http/timeouts"
+	"github.com/wikisophia/api/server/logging"
 )
 
 // Implements POST /accounts/:id/password
+//
+// A request with the old password changes it. If the account has two-factor auth on, it needs a code as well.
+// A request with a reset token sets a forgotten password. That doesn't need a code, since the account
+// still needs one to log in afterwards.
 func setPasswordHandler(passwordSetter accounts.PasswordSetter) httprouter.Handle {
 	type request struct {
 		OldPassword string `json:"oldPassword"`
 		Password    string `json:"password"`
 		ResetToken  string `json:"resetToken"`
+		Code        string `json:"code"`
 	}
 
-	respondToStoreError := func(w http.ResponseWriter, err error) {
-		if errors.As(err, &accounts.ProhibitedPasswordError{}) {
-			http.Error(w, "Failed to set password: "+err.Error(), http.StatusBadRequest)
+	respondToStoreError := func(w http.ResponseWriter, r *http.Request, err error) {
+		if timeouts.WriteError(w, r, err) {
+			return
+		}
+		var prohibited accounts.ProhibitedPasswordError
+		if errors.As(err, &prohibited) {
+			problem := problems.Problem{
+				Status: http.StatusBadRequest,
+				Code:   problems.CodeProhibitedPassword,
+				Detail: "Failed to set password: " + err.Error(),
+			}
+			for _, reason := range prohibited.Reasons {
+				problem.Errors = append(problem.Errors, problems.FieldError{
+					Field:  "password",
+					Detail: reason,
+				})
+			}
+			problems.WriteProblem(w, problem)
+			return
+		}
+		var locked accounts.AccountLockedError
+		if errors.As(err, &locked) {
+			writeAccountLocked(w, locked)
+			return
+		}
+		if writeTwoFactorCodeMissing(w, err) {
 			return
 		}
 		// Don't give away which accounts exist and which ones don't.
 		if errors.As(err, &accounts.InvalidResetTokenError{}) ||
 			errors.As(err, &accounts.InvalidPasswordError{}) ||
+			errors.As(err, &accounts.InvalidTwoFactorCodeError{}) ||
 			errors.As(err, &accounts.AccountNotExistsError{}) {
-			http.Error(w, "Unauthorized", http.StatusForbidden)
-			return
-		}
-		if errors.As(err, &accounts.AccountNotExistsError{}) {
-			http.Error(w, "Unknown user ID", http.StatusForbidden)
+			problems.Write(w, http.StatusForbidden, problems.CodePermissionDenied, "Unauthorized")
 			return
 		}
-		http.Error(w, "Internal server error: "+err.Error(), http.StatusInternalServerError)
+		problems.WriteInternal(w, r, err)
 	}
 
 	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
 		idString := params.ByName("id")
 		id, err := strconv.ParseInt(idString, 10, 0)
 		if err != nil {
-			http.Error(w, "Unauthorized", http.StatusForbidden)
+			problems.Write(w, http.StatusForbidden, problems.CodePermissionDenied, "Unauthorized")
 			return
 		}
 
 		data, err := ioutil.ReadAll(r.Body)
 		if err != nil {
-			http.Error(w, "Failed to read request: "+err.Error(), http.StatusBadRequest)
+			problems.Write(w, http.StatusBadRequest, problems.CodeMalformedRequest, "Failed to read the request body.")
 			return
 		}
 
 		var req request
 		if err := json.Unmarshal(data, &req); err != nil {
-			http.Error(w, "Malformed request: "+err.Error(), http.StatusBadRequest)
+			problems.Write(w, http.StatusBadRequest, problems.CodeMalformedRequest, "Malformed request: "+err.Error())
 			return
 		}
 		if req.ResetToken != "" {
 			if req.OldPassword != "" {
-				http.Error(w, "Only one of oldPassword or resetToken should be defined.", http.StatusBadRequest)
+				problems.WriteInvalid(w, "Only one of oldPassword or resetToken should be defined.", []problems.FieldError{{
+					Field:  "oldPassword",
+					Detail: "must not be defined along with resetToken",
+				}})
+				return
+			}
+			if req.Code != "" {
+				problems.WriteInvalid(w, "Reset tokens don't need a two-factor code.", []problems.FieldError{{
+					Field:  "code",
+					Detail: "must not be defined along with resetToken",
+				}})
 				return
 			}
-			if err := passwordSetter.SetForgottenPassword(context.Background(), id, req.Password, req.ResetToken); err != nil {
-				respondToStoreError(w, err)
+			if err := passwordSetter.SetForgottenPassword(r.Context(), id, req.Password, req.ResetToken); err != nil {
+				respondToStoreError(w, r, err)
 				return
 			}
+			logging.SetAccountID(r.Context(), id)
 			w.WriteHeader(http.StatusNoContent)
 			return
 		}
 
 		if req.OldPassword == "" {
-			http.Error(w, "Either oldPassword or resetToken must be defined.", http.StatusBadRequest)
+			problems.WriteInvalid(w, "Either oldPassword or resetToken must be defined.", []problems.FieldError{{
+				Field:  "oldPassword",
+				Detail: "is required if resetToken isn't defined",
+			}})
 			return
 		}
-		if err := passwordSetter.ChangePassword(context.Background(), id, req.OldPassword, req.Password); err != nil {
-			respondToStoreError(w, err)
+		if err := passwordSetter.ChangePassword(r.Context(), id, req.OldPassword, req.Password, req.Code); err != nil {
+			respondToStoreError(w, r, err)
 			return
 		}
+		logging.SetAccountID(r.Context(), id)
 		w.WriteHeader(http.StatusNoContent)
 	}
 }
@@ -9,6 +9,9 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/wikisophia/api/server/acceptancetest"
+	"github.com/wikisophia/api/server/config"
+	"github.com/wikisophia/api/server/http/problems"
 )
 
 func TestPasswordSetsProperly(t *testing.T) {
@@ -43,3 +46,29 @@ func TestSetPasswordRejectsBadRequestsProperly(t *testing.T) {
 	a.AssertBadRequest("POST", "/accounts/"+idString+"/password", `{"password":"something"}`)
 	a.AssertBadRequest("POST", "/accounts/"+idString+"/password", `{"password":"something","resetToken":"abc","oldPassword":"something-else"}`)
 }
+
+func TestProhibitedPasswordNamesReasons(t *testing.T) {
+	a := newApp(t, nil)
+	acct := a.SaveAccountSuccessfully("some-email@soph.wiki")
+	rr := a.ResetPassword(acct.ID, acct.ResetToken, "")
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	problem := acceptancetest.ParseProblem(t, rr)
+	assert.Equal(t, problems.CodeProhibitedPassword, problem.Code)
+	assert.Equal(t, []problems.FieldError{{Field: "password", Detail: "must not be empty"}}, problem.Errors)
+}
+
+func TestWrongOldPasswordsLockAccount(t *testing.T) {
+	a := newApp(t, nil)
+	acct := a.SaveAccountSuccessfully("some-email@soph.wiki")
+	a.ResetPasswordSuccessfully(acct.ID, acct.ResetToken, "some-password")
+	threshold := config.Defaults().Lockout.Threshold
+	for i := 1; i < threshold; i++ {
+		assert.Equal(t, problems.CodePermissionDenied, acceptancetest.ParseProblem(t, a.UpdatePassword(acct.ID, "wrong-password", "some-new-password")).Code)
+	}
+
+	rr := a.UpdatePassword(acct.ID, "wrong-password", "some-new-password")
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Equal(t, problems.CodeAccountLocked, acceptancetest.ParseProblem(t, rr).Code)
+	rr = a.UpdatePassword(acct.ID, "some-password", "some-new-password")
+	assert.Equal(t, problems.CodeAccountLocked, acceptancetest.ParseProblem(t, rr).Code)
+}
@@ -0,0 +1,211 @@
+package http
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/http/problems"
+	"github.com/wikisophia/api/server/http/timeouts"
+	"github.com/wikisophia/api/server/logging"
+)
+
+// meResponse is the whole profile, which only the account itself may see.
+type meResponse struct {
+	ID          int64           `json:"id"`
+	Email       string          `json:"email"`
+	DisplayName string          `json:"displayName"`
+	Bio         string          `json:"bio"`
+	Preferences json.RawMessage `json:"preferences"`
+	// DeletionDueAt is when the account will be purged, if its owner asked to delete it.
+	DeletionDueAt *time.Time `json:"deletionDueAt,omitempty"`
+}
+
+// publicProfileResponse is the part of the profile which anyone may see. It must never have the email.
+type publicProfileResponse struct {
+	ID          int64  `json:"id"`
+	DisplayName string `json:"displayName"`
+	Bio         string `json:"bio"`
+}
+
+// Implements GET /accounts/:id
+//
+// GET /accounts/me returns the whole profile of the account which is logged in.
+// Other IDs get the public part of that account's profile.
+func getAccountHandler(key *ecdsa.PrivateKey, profiles accounts.Profile) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		if params.ByName("id") == "me" {
+			id, ok := SessionAccountID(key, r)
+			if !ok {
+				problems.Write(w, http.StatusForbidden, problems.CodePermissionDenied, "Log in to see your account.")
+				return
+			}
+			profile, err := profiles.AccountProfile(r.Context(), id)
+			if respondToProfileError(w, r, err) {
+				return
+			}
+			logging.SetAccountID(r.Context(), id)
+			writeJSON(w, r, newMeResponse(profile))
+			return
+		}
+
+		id, err := strconv.ParseInt(params.ByName("id"), 10, 0)
+		if err != nil {
+			problems.Write(w, http.StatusNotFound, problems.CodeNotFound, "account "+params.ByName("id")+" does not exist")
+			return
+		}
+		profile, err := profiles.AccountProfile(r.Context(), id)
+		if timeouts.WriteError(w, r, err) {
+			return
+		}
+		if errors.As(err, &accounts.AccountNotExistsError{}) {
+			problems.Write(w, http.StatusNotFound, problems.CodeNotFound, "account "+params.ByName("id")+" does not exist")
+			return
+		}
+		if err != nil {
+			problems.WriteInternal(w, r, err)
+			return
+		}
+		writeJSON(w, r, publicProfileResponse{
+			ID:          profile.ID,
+			DisplayName: profile.DisplayName,
+			Bio:         profile.Bio,
+		})
+	}
+}
+
+// Implements PATCH /accounts/me
+//
+// Each property in the request replaces that part of the profile. The ones which are left out stay as they are.
+func patchMeHandler(key *ecdsa.PrivateKey, profiles accounts.Profile) http.HandlerFunc {
+	type request struct {
+		DisplayName *string         `json:"displayName"`
+		Bio         *string         `json:"bio"`
+		Preferences json.RawMessage `json:"preferences"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := SessionAccountID(key, r)
+		if !ok {
+			problems.Write(w, http.StatusForbidden, problems.CodePermissionDenied, "Log in to change your account.")
+			return
+		}
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			problems.Write(w, http.StatusBadRequest, problems.CodeMalformedRequest, "Failed to read the request body.")
+			return
+		}
+		var req request
+		if err := json.Unmarshal(data, &req); err != nil {
+			problems.Write(w, http.StatusBadRequest, problems.CodeMalformedRequest, "Malformed request: "+err.Error())
+			return
+		}
+
+		update := accounts.ProfileUpdate{}
+		var invalid []problems.FieldError
+		if req.DisplayName != nil {
+			name := strings.TrimSpace(*req.DisplayName)
+			if detail := checkProfileText(name, accounts.MaxDisplayNameLength, false); detail != "" {
+				invalid = append(invalid, problems.FieldError{Field: "displayName", Detail: detail})
+			}
+			update.DisplayName = &name
+		}
+		if req.Bio != nil {
+			bio := strings.TrimSpace(*req.Bio)
+			if detail := checkProfileText(bio, accounts.MaxBioLength, true); detail != "" {
+				invalid = append(invalid, problems.FieldError{Field: "bio", Detail: detail})
+			}
+			update.Bio = &bio
+		}
+		if req.Preferences != nil {
+			preferences, detail := checkPreferences(req.Preferences)
+			if detail != "" {
+				invalid = append(invalid, problems.FieldError{Field: "preferences", Detail: detail})
+			}
+			update.Preferences = preferences
+		}
+		if len(invalid) > 0 {
+			problems.WriteInvalid(w, "The profile is invalid.", invalid)
+			return
+		}
+
+		profile, err := profiles.UpdateProfile(r.Context(), id, update)
+		if respondToProfileError(w, r, err) {
+			return
+		}
+		logging.SetAccountID(r.Context(), id)
+		writeJSON(w, r, newMeResponse(profile))
+	}
+}
+
+// checkProfileText returns the reason why text can't be in a profile, or "" if it can.
+// Only multiline text may have line breaks.
+func checkProfileText(text string, maxLength int, multiline bool) string {
+	if utf8.RuneCountInString(text) > maxLength {
+		return "must be at most " + strconv.Itoa(maxLength) + " characters"
+	}
+	for _, char := range text {
+		if unicode.IsControl(char) && !(multiline && char == '\n') {
+			return "must not have control characters"
+		}
+	}
+	return ""
+}
+
+// checkPreferences compacts the preferences, or returns the reason why they can't be saved.
+func checkPreferences(preferences json.RawMessage) (json.RawMessage, string) {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(preferences, &object); err != nil || object == nil {
+		return nil, "must be an object"
+	}
+	var compacted bytes.Buffer
+	if err := json.Compact(&compacted, preferences); err != nil {
+		return nil, "must be an object"
+	}
+	if compacted.Len() > accounts.MaxPreferencesSize {
+		return nil, "must be at most " + strconv.Itoa(accounts.MaxPreferencesSize) + " bytes"
+	}
+	return compacted.Bytes(), ""
+}
+
+// respondToProfileError writes a response if err isn't nil, and returns true if it did.
+func respondToProfileError(w http.ResponseWriter, r *http.Request, err error) bool {
+	if err == nil {
+		return false
+	}
+	if timeouts.WriteError(w, r, err) {
+		return true
+	}
+	// The account may have been deleted since the session started.
+	if errors.As(err, &accounts.AccountNotExistsError{}) {
+		problems.Write(w, http.StatusForbidden, problems.CodePermissionDenied, "Unauthorized")
+		return true
+	}
+	problems.WriteInternal(w, r, err)
+	return true
+}
+
+func newMeResponse(profile accounts.AccountProfile) meResponse {
+	preferences := profile.Preferences
+	if preferences == nil {
+		preferences = json.RawMessage(`{}`)
+	}
+	return meResponse{
+		ID:            profile.ID,
+		Email:         profile.Email,
+		DisplayName:   profile.DisplayName,
+		Bio:           profile.Bio,
+		Preferences:   preferences,
+		DeletionDueAt: optionalTime(profile.DeletionDueAt),
+	}
+}
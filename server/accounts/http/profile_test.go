@@ -0,0 +1,101 @@
+package http_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wikisophia/api/server/acceptancetest"
+	"github.com/wikisophia/api/server/http/problems"
+)
+
+func TestMeShowsNewAccounts(t *testing.T) {
+	a := newApp(t, nil)
+	acct := a.SaveAccountSuccessfully("some-email@soph.wiki")
+	a.ResetPasswordSuccessfully(acct.ID, acct.ResetToken, "some-password")
+	token := a.AuthenticateSuccessfully("some-email@soph.wiki", "some-password")
+
+	rr := a.GetAccount("me", token)
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json; charset=utf-8", rr.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"id":`+strconv.FormatInt(acct.ID, 10)+`,"email":"some-email@soph.wiki","displayName":"","bio":"","preferences":{}}`, rr.Body.String())
+}
+
+func TestMeUpdatesProperly(t *testing.T) {
+	a := newApp(t, nil)
+	acct := a.SaveAccountSuccessfully("some-email@soph.wiki")
+	a.ResetPasswordSuccessfully(acct.ID, acct.ResetToken, "some-password")
+	token := a.AuthenticateSuccessfully("some-email@soph.wiki", "some-password")
+
+	rr := a.UpdateMe(token, `{"displayName":"  Someone ","preferences":{"theme": "dark"}}`)
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"id":`+strconv.FormatInt(acct.ID, 10)+`,"email":"some-email@soph.wiki","displayName":"Someone","bio":"","preferences":{"theme":"dark"}}`, rr.Body.String())
+
+	require.Equal(t, http.StatusOK, a.UpdateMe(token, `{"bio":"I like\narguments."}`).Code)
+	rr = a.GetAccount("me", token)
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"id":`+strconv.FormatInt(acct.ID, 10)+`,"email":"some-email@soph.wiki","displayName":"Someone","bio":"I like\narguments.","preferences":{"theme":"dark"}}`, rr.Body.String())
+}
+
+func TestPublicProfilesHideEmails(t *testing.T) {
+	a := newApp(t, nil)
+	acct := a.SaveAccountSuccessfully("some-email@soph.wiki")
+	a.ResetPasswordSuccessfully(acct.ID, acct.ResetToken, "some-password")
+	token := a.AuthenticateSuccessfully("some-email@soph.wiki", "some-password")
+	require.Equal(t, http.StatusOK, a.UpdateMe(token, `{"displayName":"Someone","bio":"Hi","preferences":{"theme":"dark"}}`).Code)
+
+	rr := a.GetAccount(strconv.FormatInt(acct.ID, 10), "")
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"id":`+strconv.FormatInt(acct.ID, 10)+`,"displayName":"Someone","bio":"Hi"}`, rr.Body.String())
+	assert.NotContains(t, rr.Body.String(), "some-email")
+
+	assert.Equal(t, http.StatusNotFound, a.GetAccount(strconv.FormatInt(acct.ID+1, 10), "").Code)
+	assert.Equal(t, http.StatusNotFound, a.GetAccount("not-an-id", "").Code)
+}
+
+func TestMeNeedsSession(t *testing.T) {
+	a := newApp(t, nil)
+	assert.Equal(t, http.StatusForbidden, a.GetAccount("me", "").Code)
+	assert.Equal(t, http.StatusForbidden, a.GetAccount("me", "not-a-token").Code)
+	assert.Equal(t, http.StatusForbidden, a.UpdateMe("", `{"displayName":"Someone"}`).Code)
+	a.AssertNotFound("PATCH", "/accounts/1")
+}
+
+func TestMeRejectsBadUpdates(t *testing.T) {
+	a := newApp(t, nil)
+	acct := a.SaveAccountSuccessfully("some-email@soph.wiki")
+	a.ResetPasswordSuccessfully(acct.ID, acct.ResetToken, "some-password")
+	token := a.AuthenticateSuccessfully("some-email@soph.wiki", "some-password")
+
+	assertInvalid := func(body string, field string) {
+		t.Helper()
+		rr := a.UpdateMe(token, body)
+		require.Equal(t, http.StatusBadRequest, rr.Code, body)
+		problem := acceptancetest.ParseProblem(t, rr)
+		assert.Equal(t, problems.CodeValidationFailed, problem.Code)
+		require.Len(t, problem.Errors, 1)
+		assert.Equal(t, field, problem.Errors[0].Field)
+	}
+	assertInvalid(`{"displayName":"`+strings.Repeat("a", 51)+`"}`, "displayName")
+	assertInvalid(`{"displayName":"two\nlines"}`, "displayName")
+	assertInvalid(`{"bio":"`+strings.Repeat("a", 501)+`"}`, "bio")
+	assertInvalid(`{"bio":"bell\u0007"}`, "bio")
+	assertInvalid(`{"preferences":[]}`, "preferences")
+	assertInvalid(`{"preferences":null}`, "preferences")
+	assertInvalid(`{"preferences":{"big":"`+strings.Repeat("a", 4096)+`"}}`, "preferences")
+
+	assert.Equal(t, http.StatusBadRequest, a.UpdateMe(token, "not json").Code)
+	assert.Equal(t, http.StatusBadRequest, a.UpdateMe(token, `{"displayName":5}`).Code)
+
+	rr := a.GetAccount("me", token)
+	require.Equal(t, http.StatusOK, rr.Code)
+	var me struct {
+		DisplayName string `json:"displayName"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &me))
+	assert.Empty(t, me.DisplayName, "rejected updates shouldn't change anything")
+}
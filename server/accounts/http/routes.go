@@ -2,20 +2,44 @@ package http
 
 import (
 	"crypto/ecdsa"
+	"net/http"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/wikisophia/api/server/accounts"
-	"github.com/wikisophia/api/server/accounts/email"
+	"github.com/wikisophia/api/server/arguments"
+	"github.com/wikisophia/api/server/config"
 )
 
 type Dependencies interface {
 	accounts.Store
-	email.Emailer
+	// GetAuthored finds the arguments which accounts wrote, so that they can be exported.
+	arguments.GetAuthored
+}
+
+// Router is implemented by *httprouter.Router.
+// The server may wrap it to add middleware to each route.
+type Router interface {
+	Handle(method, path string, handle httprouter.Handle)
+	HandlerFunc(method, path string, handler http.HandlerFunc)
 }
 
 // AppendRoutes populates the router with all the endpoints related to accounts.
-func AppendRoutes(router *httprouter.Router, key *ecdsa.PrivateKey, dependencies Dependencies) {
+// The verification config says whether accounts must verify their email before they can log in.
+// The deletion config says how long deleted accounts wait before they're purged.
+// The twoFactor config says how authenticator apps should name the site, and how long logins wait for a code.
+func AppendRoutes(router Router, key *ecdsa.PrivateKey, verification config.Verification, deletion config.Deletion, twoFactor config.TwoFactor, dependencies Dependencies) {
 	router.HandlerFunc("POST", "/accounts", accountHandler(dependencies))
-	router.POST("/accounts/:id/password", setPasswordHandler(dependencies))
-	router.HandlerFunc("POST", "/sessions", postSessionHandler(key, dependencies))
+	router.Handle("GET", "/accounts/:id", getAccountHandler(key, dependencies))
+	router.Handle("PATCH", "/accounts/:id", onlyFor("me", patchMeHandler(key, dependencies)))
+	router.Handle("DELETE", "/accounts/:id", onlyFor("me", deleteMeHandler(key, deletion, dependencies)))
+	router.Handle("POST", "/accounts/:id", onlyFor("verify", verifyEmailHandler(dependencies)))
+	router.Handle("POST", "/accounts/:id/password", setPasswordHandler(dependencies))
+	router.Handle("POST", "/accounts/:id/email", changeEmailHandler(dependencies))
+	router.Handle("POST", "/accounts/:id/restore", onlyFor("me", restoreMeHandler(key, dependencies)))
+	router.Handle("GET", "/accounts/:id/export", onlyFor("me", exportMeHandler(key, dependencies)))
+	router.Handle("POST", "/accounts/:id/resend", onlyFor("verify", resendVerificationHandler(dependencies)))
+	router.Handle("GET", "/accounts/:id/two-factor", onlyFor("me", getTwoFactorHandler(key, dependencies)))
+	router.Handle("POST", "/accounts/:id/two-factor", enrollTwoFactorHandler(key, twoFactor, dependencies))
+	router.Handle("DELETE", "/accounts/:id/two-factor", disableTwoFactorHandler(dependencies))
+	router.HandlerFunc("POST", "/sessions", postSessionHandler(key, verification, twoFactor, dependencies))
 }
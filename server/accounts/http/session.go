@@ -1,73 +1,196 @@
 package http
 
 import (
-	"context"
 	"crypto"
 	"crypto/ecdsa"
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
+	"math"
 	"math/big"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/config"
+	"github.com/wikisophia/api/server/http/problems"
+	"github.com/wikisophia/api/server/http/timeouts"
+	"github.com/wikisophia/api/server/logging"
 )
 
-func postSessionHandler(key *ecdsa.PrivateKey, authenticator accounts.Authenticator) http.HandlerFunc {
+type sessionDependencies interface {
+	accounts.Authenticator
+	accounts.EmailVerifier
+	accounts.TwoFactor
+	accounts.Sessions
+}
+
+// Implements POST /sessions
+//
+// A request with the email and password logs in. If the account has two-factor auth on, the response
+// has a challenge instead of a token. A second request with the challenge and a code finishes logging in.
+func postSessionHandler(key *ecdsa.PrivateKey, verification config.Verification, twoFactor config.TwoFactor, dependencies sessionDependencies) http.HandlerFunc {
 	type request struct {
-		Email    string
-		Password string
+		Email     string
+		Password  string
+		Challenge string
+		Code      string
 	}
-	type response struct {
-		Token string `json:"token"`
+	type challengeResponse struct {
+		Challenge string `json:"challenge"`
 	}
-	responsePrefix := []byte(`{"token":"`)
-	responseSuffix := []byte(`"}`)
-	responseOverhead := len(responsePrefix) + len(responseSuffix)
 
 	return func(w http.ResponseWriter, r *http.Request) {
 		body, err := ioutil.ReadAll(r.Body)
 		if err != nil {
-			http.Error(w, "error reading request body: "+err.Error(), http.StatusInternalServerError)
+			problems.Write(w, http.StatusBadRequest, problems.CodeMalformedRequest, "Failed to read the request body.")
 			return
 		}
 		var req request
 		if err = json.Unmarshal(body, &req); err != nil {
-			http.Error(w, "invald request body: "+err.Error(), http.StatusBadRequest)
+			problems.Write(w, http.StatusBadRequest, problems.CodeMalformedRequest, "invalid request body: "+err.Error())
+			return
+		}
+
+		if req.Challenge != "" || req.Code != "" {
+			if req.Email != "" || req.Password != "" {
+				problems.WriteInvalid(w, "A challenge finishes a login which was already started, so it can't have an email or password.", []problems.FieldError{{
+					Field:  "challenge",
+					Detail: "must not be defined along with email or password",
+				}})
+				return
+			}
+			if req.Challenge == "" {
+				writeMissingProperty(w, "challenge")
+				return
+			}
+			if req.Code == "" {
+				writeMissingProperty(w, "code")
+				return
+			}
+			accountID, err := parseChallenge(&key.PublicKey, challengePrefix, req.Challenge, time.Now())
+			if err != nil {
+				problems.Write(w, http.StatusForbidden, problems.CodePermissionDenied, "The challenge is invalid or expired. Log in again.")
+				return
+			}
+			if respondToTwoFactorError(w, r, dependencies.CheckTwoFactor(r.Context(), accountID, req.Code)) {
+				return
+			}
+			logging.SetAccountID(r.Context(), accountID)
+			writeSession(w, r, key, dependencies, accountID)
 			return
 		}
+
 		if req.Email == "" {
-			http.Error(w, "missing required property: \"email\"", http.StatusBadRequest)
+			writeMissingProperty(w, "email")
 			return
 		}
 		if req.Password == "" {
-			http.Error(w, "missing required property: \"password\"", http.StatusBadRequest)
+			writeMissingProperty(w, "password")
+			return
+		}
+		accountID, err := dependencies.Authenticate(r.Context(), req.Email, req.Password)
+		if timeouts.WriteError(w, r, err) {
 			return
 		}
-		_, err = authenticator.Authenticate(context.Background(), req.Email, req.Password)
+		// Locked accounts get the same response as wrong passwords and missing accounts.
+		// Otherwise, anyone could find out which emails have accounts by locking them.
+		// The owner learns about the lock from the email instead.
 		if err != nil {
-			http.Error(w, "permission denied", http.StatusForbidden)
+			problems.Write(w, http.StatusForbidden, problems.CodePermissionDenied, "permission denied")
+			return
+		}
+		logging.SetAccountID(r.Context(), accountID)
+		if verification.RequiredToLogin {
+			verifiedAt, err := dependencies.EmailVerifiedAt(r.Context(), accountID)
+			if timeouts.WriteError(w, r, err) {
+				return
+			}
+			if err != nil {
+				problems.WriteInternal(w, r, err)
+				return
+			}
+			if verifiedAt.IsZero() {
+				problems.Write(w, http.StatusForbidden, problems.CodeEmailNotVerified, "Verify this account's email before logging in.")
+				return
+			}
+		}
+		status, err := dependencies.TwoFactorStatus(r.Context(), accountID)
+		if timeouts.WriteError(w, r, err) {
 			return
 		}
-		jwt, err := newJwt(key, 1)
 		if err != nil {
-			http.Error(w, "error signing token: "+err.Error(), http.StatusInternalServerError)
+			problems.WriteInternal(w, r, err)
+			return
+		}
+		if status.Enabled {
+			challenge, err := newChallenge(key, challengePrefix, accountID, time.Now().Add(twoFactor.ChallengeExpiry()))
+			if err != nil {
+				problems.WriteInternal(w, r, fmt.Errorf("error signing challenge: %v", err))
+				return
+			}
+			writeJSON(w, r, challengeResponse{Challenge: challenge})
+			return
+		}
+		if status.Required {
+			setupToken, err := newChallenge(key, setupPrefix, accountID, time.Now().Add(twoFactor.ChallengeExpiry()))
+			if err != nil {
+				problems.WriteInternal(w, r, fmt.Errorf("error signing setup token: %v", err))
+				return
+			}
+			problems.WriteProblem(w, problems.Problem{
+				Status:     http.StatusForbidden,
+				Code:       problems.CodeTwoFactorSetupRequired,
+				Detail:     "Set up two-factor auth before logging in.",
+				SetupToken: setupToken,
+			})
 			return
 		}
-		w.Header().Set("Content-Length", strconv.Itoa(len(jwt)+responseOverhead))
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		w.Header().Set("Set-Cookie", "auth="+jwt+"; SameSite=Strict; Secure; HttpOnly")
-		w.WriteHeader(http.StatusOK)
-		w.Write(responsePrefix)
-		w.Write([]byte(jwt))
-		w.Write(responseSuffix)
+		writeSession(w, r, key, dependencies, accountID)
 	}
 }
 
+var (
+	sessionResponsePrefix   = []byte(`{"token":"`)
+	sessionResponseSuffix   = []byte(`"}`)
+	sessionResponseOverhead = len(sessionResponsePrefix) + len(sessionResponseSuffix)
+)
+
+// writeSession records a new session for the account, and responds with its token in the body and the auth cookie.
+func writeSession(w http.ResponseWriter, r *http.Request, key *ecdsa.PrivateKey, sessions accounts.Sessions, accountID int64) {
+	session, err := sessions.StartSession(r.Context(), accountID, r.UserAgent(), time.Now())
+	if timeouts.WriteError(w, r, err) {
+		return
+	}
+	if err != nil {
+		problems.WriteInternal(w, r, fmt.Errorf("error starting session: %v", err))
+		return
+	}
+	jwt, err := newJwt(key, accountID, session.ID)
+	if err != nil {
+		problems.WriteInternal(w, r, fmt.Errorf("error signing token: %v", err))
+		return
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(jwt)+sessionResponseOverhead))
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Set-Cookie", "auth="+jwt+"; SameSite=Strict; Secure; HttpOnly")
+	w.WriteHeader(http.StatusOK)
+	w.Write(sessionResponsePrefix)
+	w.Write([]byte(jwt))
+	w.Write(sessionResponseSuffix)
+}
+
+func writeAccountLocked(w http.ResponseWriter, locked accounts.AccountLockedError) {
+	retryAfter := math.Max(1, math.Ceil(time.Until(locked.Until).Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter)))
+	problems.Write(w, http.StatusForbidden, problems.CodeAccountLocked, "This account is locked because of too many failed logins. Try again later, or reset the password.")
+}
+
 const jwtHeader = `{"alg":"ES384","typ":"JWT"}`
 
 const hashFunction = crypto.SHA384
@@ -75,10 +198,10 @@ const expectedCurveBitSize = 384
 const keySize = expectedCurveBitSize / 8
 const expectedSignatureSize = 2 * keySize
 
-// newJwt makes a JWT for the given user, signing it with key.
-func newJwt(key *ecdsa.PrivateKey, userID int64) (string, error) {
+// newJwt makes a JWT for the given user and session, signing it with key.
+func newJwt(key *ecdsa.PrivateKey, userID int64, sessionID int64) (string, error) {
 	header := base64.StdEncoding.EncodeToString([]byte(jwtHeader))
-	payload := base64.StdEncoding.EncodeToString([]byte(`{"userId":` + strconv.FormatInt(userID, 10) + "}"))
+	payload := base64.StdEncoding.EncodeToString([]byte(`{"userId":` + strconv.FormatInt(userID, 10) + `,"sessionId":` + strconv.FormatInt(sessionID, 10) + "}"))
 
 	hash := hashFunction.New()
 	hash.Write([]byte(header + "." + payload))
@@ -93,6 +216,9 @@ func newJwt(key *ecdsa.PrivateKey, userID int64) (string, error) {
 // JWT is the contract class for our auth objects
 type JWT struct {
 	UserID int64 `json:"userId"`
+	// SessionID is the accounts.Session which this token came from.
+	// Tokens signed before sessions were recorded don't have one, so it's 0.
+	SessionID int64 `json:"sessionId,omitempty"`
 }
 
 // parseUserID returns the UserID claim from this jwt
@@ -143,3 +269,44 @@ func bigIntToBytes(n *big.Int) []byte {
 	copy(bPadded[keySize-len(b):], b)
 	return bPadded
 }
+
+// SessionAccountID returns the ID of the account which signed into the request's session,
+// from its "Authorization: Bearer" header or its auth cookie.
+// It returns false if the request has no session, or if the token wasn't signed by key.
+func SessionAccountID(key *ecdsa.PrivateKey, r *http.Request) (int64, bool) {
+	parsed, ok := ParseSession(key, r)
+	return parsed.UserID, ok
+}
+
+// ParseSession returns the claims in the request's session token. It finds the token like SessionAccountID does.
+func ParseSession(key *ecdsa.PrivateKey, r *http.Request) (JWT, bool) {
+	var token string
+	if authorization := r.Header.Get("Authorization"); strings.HasPrefix(authorization, "Bearer ") {
+		token = strings.TrimPrefix(authorization, "Bearer ")
+	} else if cookie, err := r.Cookie("auth"); err == nil {
+		token = cookie.Value
+	} else {
+		return JWT{}, false
+	}
+	parsed, err := parseJwt(&key.PublicKey, token)
+	if err != nil {
+		return JWT{}, false
+	}
+	return parsed, true
+}
+
+// CheckKey makes sure that key can sign session tokens, by signing one and verifying it.
+func CheckKey(key *ecdsa.PrivateKey) error {
+	if key == nil {
+		return errors.New("no JWT private key was loaded")
+	}
+	if key.Curve.Params().BitSize != expectedCurveBitSize {
+		return fmt.Errorf("the JWT private key should use a %d bit curve, but uses %d bits", expectedCurveBitSize, key.Curve.Params().BitSize)
+	}
+	jwt, err := newJwt(key, 0, 0)
+	if err != nil {
+		return fmt.Errorf("failed to sign a JWT: %v", err)
+	}
+	_, err = parseJwt(&key.PublicKey, jwt)
+	return err
+}
@@ -1,11 +1,20 @@
 package http_test
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/wikisophia/api/server/acceptancetest"
+	accountsHttp "github.com/wikisophia/api/server/accounts/http"
+	"github.com/wikisophia/api/server/config"
+	"github.com/wikisophia/api/server/http/problems"
 )
 
 func TestSessionsErrorCodes(t *testing.T) {
@@ -22,10 +31,20 @@ func TestSessionsErrorCodes(t *testing.T) {
 	acceptancetest.AssertBadRequest(t, "POST", "/sessions", "{}")
 	acceptancetest.AssertBadRequest(t, "POST", "/sessions", `{"email":"something@soph.wiki"}`)
 	acceptancetest.AssertBadRequest(t, "POST", "/sessions", `{"password":"password"}`)
+	acceptancetest.AssertBadRequest(t, "POST", "/sessions", `{"email":"something@soph.wiki","password":"`+strings.Repeat("x", 2<<20)+`"}`)
+}
+
+func TestMissingPasswordNamed(t *testing.T) {
+	rr := newApp(t, nil).Do(httptest.NewRequest("POST", "/sessions", strings.NewReader(`{"email":"something@soph.wiki"}`)))
+	problem := acceptancetest.ParseProblem(t, rr)
+	assert.Equal(t, problems.CodeValidationFailed, problem.Code)
+	assert.Equal(t, []problems.FieldError{{Field: "password", Detail: "is required"}}, problem.Errors)
 }
 
 func TestUnknownUserForbidden(t *testing.T) {
-	assert.Equal(t, http.StatusForbidden, newApp(t, nil).Authenticate("something@soph.wiki", "some-password").Code)
+	rr := newApp(t, nil).Authenticate("something@soph.wiki", "some-password")
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Equal(t, problems.CodePermissionDenied, acceptancetest.ParseProblem(t, rr).Code)
 }
 
 func TestValidCredentialsAccepted(t *testing.T) {
@@ -39,3 +58,64 @@ func TestInvalidCredentialsForbidden(t *testing.T) {
 	a.SaveAccountWithPasswordSuccessfully("some-email@soph.wiki", "some-password")
 	assert.Equal(t, http.StatusForbidden, a.Authenticate("some-email@soph.wiki", "wrong-password").Code)
 }
+
+func TestRepeatedFailuresLockAccount(t *testing.T) {
+	a := newApp(t, nil)
+	a.SaveAccountWithPasswordSuccessfully("some-email@soph.wiki", "some-password")
+	threshold := config.Defaults().Lockout.Threshold
+	for i := 1; i < threshold; i++ {
+		assert.Equal(t, problems.CodePermissionDenied, acceptancetest.ParseProblem(t, a.Authenticate("some-email@soph.wiki", "wrong-password")).Code)
+	}
+
+	// Locked accounts look just like wrong passwords, so that nobody can tell which emails have accounts.
+	rr := a.Authenticate("some-email@soph.wiki", "wrong-password")
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Equal(t, problems.CodePermissionDenied, acceptancetest.ParseProblem(t, rr).Code)
+	assert.Empty(t, rr.Header().Get("Retry-After"))
+	require.Len(t, a.Emailer.Locks, 1)
+	assert.Equal(t, "some-email@soph.wiki", a.Emailer.Locks[0].Account.Email)
+
+	rr = a.Authenticate("some-email@soph.wiki", "some-password")
+	assert.Equal(t, problems.CodePermissionDenied, acceptancetest.ParseProblem(t, rr).Code)
+	assert.Equal(t, acceptancetest.ParseProblem(t, a.Authenticate("missing@soph.wiki", "some-password")), acceptancetest.ParseProblem(t, rr))
+}
+
+func TestCheckKey(t *testing.T) {
+	assert.Error(t, accountsHttp.CheckKey(nil))
+
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+	assert.NoError(t, accountsHttp.CheckKey(key))
+
+	wrongCurve, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	assert.Error(t, accountsHttp.CheckKey(wrongCurve))
+}
+
+func TestSessionAccountID(t *testing.T) {
+	a := newApp(t, nil)
+	a.SaveAccountWithPasswordSuccessfully("first-email@soph.wiki", "some-password")
+	a.SaveAccountWithPasswordSuccessfully("second-email@soph.wiki", "some-password")
+	token := a.AuthenticateSuccessfully("second-email@soph.wiki", "some-password")
+
+	key := acceptancetest.KeyForTests(t)
+	req := httptest.NewRequest("POST", "/arguments", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	id, ok := accountsHttp.SessionAccountID(key, req)
+	assert.True(t, ok)
+	assert.Equal(t, int64(2), id)
+
+	req = httptest.NewRequest("POST", "/arguments", nil)
+	req.AddCookie(&http.Cookie{Name: "auth", Value: token})
+	id, ok = accountsHttp.SessionAccountID(key, req)
+	assert.True(t, ok)
+	assert.Equal(t, int64(2), id)
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+	_, ok = accountsHttp.SessionAccountID(otherKey, req)
+	assert.False(t, ok)
+
+	_, ok = accountsHttp.SessionAccountID(key, httptest.NewRequest("POST", "/arguments", nil))
+	assert.False(t, ok)
+}
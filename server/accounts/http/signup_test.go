@@ -0,0 +1,35 @@
+package http_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wikisophia/api/server/acceptancetest"
+	"github.com/wikisophia/api/server/config"
+)
+
+// TestSignupThroughEmailLinks follows the links in the emails which a real emailer writes.
+func TestSignupThroughEmailLinks(t *testing.T) {
+	dir := t.TempDir()
+	app := newApp(t, &acceptancetest.AppConfig{
+		MailDir:      dir,
+		Verification: &config.Verification{RequiredToLogin: true},
+	})
+
+	require.Equal(t, http.StatusNoContent, app.SaveAccount("someone@soph.wiki").Code)
+	welcome := acceptancetest.LatestEmail(t, dir, "someone@soph.wiki")
+	assert.Equal(t, "Welcome to Wikisophia", welcome.Subject)
+	reset := welcome.ResetLink(t)
+	app.ResetPasswordSuccessfully(reset.ID, reset.Token, "some-password")
+	assert.Equal(t, http.StatusForbidden, app.Authenticate("someone@soph.wiki", "some-password").Code)
+
+	require.Equal(t, http.StatusNoContent, app.ResendVerification("someone@soph.wiki").Code)
+	verification := acceptancetest.LatestEmail(t, dir, "someone@soph.wiki")
+	assert.Equal(t, "Confirm your email for Wikisophia", verification.Subject)
+	verify := verification.VerifyLink(t)
+	assert.NotEqual(t, welcome.VerifyLink(t).Token, verify.Token)
+	require.Equal(t, http.StatusNoContent, app.VerifyEmail(verify.ID, verify.Token).Code)
+	app.AuthenticateSuccessfully("someone@soph.wiki", "some-password")
+}
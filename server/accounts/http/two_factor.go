@@ -0,0 +1,300 @@
+package http
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/accounts/totp"
+	"github.com/wikisophia/api/server/config"
+	"github.com/wikisophia/api/server/http/problems"
+	"github.com/wikisophia/api/server/http/timeouts"
+	"github.com/wikisophia/api/server/logging"
+)
+
+// Implements POST /accounts/:id/two-factor
+//
+// A request with the password starts enrollment, and responds with a new TOTP secret for an authenticator app.
+// A request with a code from that app turns two-factor auth on, and responds with the recovery codes.
+// Both need a session for the account. Accounts which must have two-factor auth can't log in until they've
+// set it up, so they send the setup token which their login attempt got instead.
+func enrollTwoFactorHandler(key *ecdsa.PrivateKey, cfg config.TwoFactor, twoFactor accounts.TwoFactor) httprouter.Handle {
+	type request struct {
+		Password   string `json:"password"`
+		Code       string `json:"code"`
+		SetupToken string `json:"setupToken"`
+	}
+	type enrollResponse struct {
+		Secret string `json:"secret"`
+		URI    string `json:"uri"`
+	}
+	type confirmResponse struct {
+		RecoveryCodes []string `json:"recoveryCodes"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		id, err := strconv.ParseInt(params.ByName("id"), 10, 0)
+		if err != nil {
+			problems.Write(w, http.StatusForbidden, problems.CodePermissionDenied, "Unauthorized")
+			return
+		}
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			problems.Write(w, http.StatusBadRequest, problems.CodeMalformedRequest, "Failed to read the request body.")
+			return
+		}
+		var req request
+		if err := json.Unmarshal(data, &req); err != nil {
+			problems.Write(w, http.StatusBadRequest, problems.CodeMalformedRequest, "Malformed request: "+err.Error())
+			return
+		}
+		if req.Code != "" && req.Password != "" {
+			problems.WriteInvalid(w, "A code confirms an enrollment which was already started, so it can't have a password.", []problems.FieldError{{
+				Field:  "code",
+				Detail: "must not be defined along with password",
+			}})
+			return
+		}
+		if req.Code == "" && req.Password == "" {
+			writeMissingProperty(w, "password")
+			return
+		}
+		if !canEnroll(key, r, req.SetupToken, id) {
+			problems.Write(w, http.StatusForbidden, problems.CodePermissionDenied, "Log in to set up two-factor auth.")
+			return
+		}
+
+		if req.Code != "" {
+			codes, err := twoFactor.ConfirmTwoFactor(r.Context(), id, req.Code)
+			if errors.As(err, &accounts.TwoFactorNotEnrolledError{}) {
+				problems.WriteInvalid(w, "Send the password first, to get a secret for the authenticator app.", []problems.FieldError{{
+					Field:  "code",
+					Detail: "must come from a secret which this account was given",
+				}})
+				return
+			}
+			if respondToTwoFactorError(w, r, err) {
+				return
+			}
+			logging.SetAccountID(r.Context(), id)
+			writeJSON(w, r, confirmResponse{RecoveryCodes: codes})
+			return
+		}
+
+		enrollment, err := twoFactor.EnrollTwoFactor(r.Context(), id, req.Password)
+		if respondToTwoFactorError(w, r, err) {
+			return
+		}
+		logging.SetAccountID(r.Context(), id)
+		writeJSON(w, r, enrollResponse{
+			Secret: enrollment.Secret,
+			URI:    totp.URI(enrollment.Secret, cfg.Issuer, enrollment.Email),
+		})
+	}
+}
+
+// canEnroll returns true if the request has a session or an unexpired setup token for the account id.
+func canEnroll(key *ecdsa.PrivateKey, r *http.Request, setupToken string, id int64) bool {
+	if setupToken != "" {
+		accountID, err := parseChallenge(&key.PublicKey, setupPrefix, setupToken, time.Now())
+		return err == nil && accountID == id
+	}
+	accountID, ok := SessionAccountID(key, r)
+	return ok && accountID == id
+}
+
+// Implements DELETE /accounts/:id/two-factor
+//
+// This needs the password and a code, so that someone who only stole one of them can't turn it off.
+func disableTwoFactorHandler(twoFactor accounts.TwoFactor) httprouter.Handle {
+	type request struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		id, err := strconv.ParseInt(params.ByName("id"), 10, 0)
+		if err != nil {
+			problems.Write(w, http.StatusForbidden, problems.CodePermissionDenied, "Unauthorized")
+			return
+		}
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			problems.Write(w, http.StatusBadRequest, problems.CodeMalformedRequest, "Failed to read the request body.")
+			return
+		}
+		var req request
+		if err := json.Unmarshal(data, &req); err != nil {
+			problems.Write(w, http.StatusBadRequest, problems.CodeMalformedRequest, "Malformed request: "+err.Error())
+			return
+		}
+		if req.Password == "" {
+			writeMissingProperty(w, "password")
+			return
+		}
+		if req.Code == "" {
+			writeMissingProperty(w, "code")
+			return
+		}
+
+		err = twoFactor.DisableTwoFactor(r.Context(), id, req.Password, req.Code)
+		if errors.As(err, &accounts.TwoFactorRequiredError{}) {
+			problems.Write(w, http.StatusForbidden, problems.CodeTwoFactorRequired, "This account must keep two-factor auth on.")
+			return
+		}
+		if respondToTwoFactorError(w, r, err) {
+			return
+		}
+		logging.SetAccountID(r.Context(), id)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// Implements GET /accounts/me/two-factor
+func getTwoFactorHandler(key *ecdsa.PrivateKey, twoFactor accounts.TwoFactor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := SessionAccountID(key, r)
+		if !ok {
+			problems.Write(w, http.StatusForbidden, problems.CodePermissionDenied, "Log in to see your two-factor auth settings.")
+			return
+		}
+		status, err := twoFactor.TwoFactorStatus(r.Context(), id)
+		if respondToProfileError(w, r, err) {
+			return
+		}
+		logging.SetAccountID(r.Context(), id)
+		writeJSON(w, r, newTwoFactorResponse(status))
+	}
+}
+
+type twoFactorResponse struct {
+	Enabled           bool `json:"enabled"`
+	Required          bool `json:"required"`
+	RecoveryCodesLeft int  `json:"recoveryCodesLeft"`
+}
+
+func newTwoFactorResponse(status accounts.TwoFactorStatus) twoFactorResponse {
+	return twoFactorResponse{
+		Enabled:           status.Enabled,
+		Required:          status.Required,
+		RecoveryCodesLeft: status.RecoveryCodesLeft,
+	}
+}
+
+// respondToTwoFactorError writes a response if err isn't nil, and returns true if it did.
+func respondToTwoFactorError(w http.ResponseWriter, r *http.Request, err error) bool {
+	if err == nil {
+		return false
+	}
+	if timeouts.WriteError(w, r, err) {
+		return true
+	}
+	if errors.As(err, &accounts.TwoFactorEnabledError{}) {
+		problems.Write(w, http.StatusConflict, problems.CodeTwoFactorEnabled, "Two-factor auth is on already. Turn it off before setting it up again.")
+		return true
+	}
+	var locked accounts.AccountLockedError
+	if errors.As(err, &locked) {
+		writeAccountLocked(w, locked)
+		return true
+	}
+	// Don't give away which accounts exist and which ones don't.
+	if errors.As(err, &accounts.InvalidPasswordError{}) ||
+		errors.As(err, &accounts.InvalidTwoFactorCodeError{}) ||
+		errors.As(err, &accounts.TwoFactorNotEnrolledError{}) ||
+		errors.As(err, &accounts.AccountNotExistsError{}) {
+		problems.Write(w, http.StatusForbidden, problems.CodePermissionDenied, "Unauthorized")
+		return true
+	}
+	problems.WriteInternal(w, r, err)
+	return true
+}
+
+// writeTwoFactorCodeMissing tells the client to send a two-factor code along with the password, if err says it needs one,
+// and returns true if it did. The store only returns that error once the password is known to be right,
+// so this doesn't tell strangers which accounts have two-factor auth on.
+func writeTwoFactorCodeMissing(w http.ResponseWriter, err error) bool {
+	if !errors.As(err, &accounts.TwoFactorCodeMissingError{}) {
+		return false
+	}
+	problems.Write(w, http.StatusForbidden, problems.CodeTwoFactorCodeRequired, "This account has two-factor auth on. Send a code with the password.")
+	return true
+}
+
+// challengePrefix is signed along with each challenge, so that no other token signed by the key
+// can pass for one.
+const challengePrefix = "two-factor-challenge."
+
+// setupPrefix is signed along with each setup token. These work like challenges, but only let accounts
+// which must have two-factor auth set it up.
+const setupPrefix = "two-factor-setup."
+
+type challenge struct {
+	UserID    int64 `json:"userId"`
+	ExpiresAt int64 `json:"expiresAt"`
+}
+
+// newChallenge makes a token which proves that the user logged in with their password before expiresAt.
+// The prefix says what it's for: challengePrefix lets them get a session by sending a two-factor code,
+// and setupPrefix lets them set up two-factor auth. It only has two parts, so it can't be used as a JWT.
+func newChallenge(key *ecdsa.PrivateKey, prefix string, userID int64, expiresAt time.Time) (string, error) {
+	claims, err := json.Marshal(challenge{UserID: userID, ExpiresAt: expiresAt.Unix()})
+	if err != nil {
+		return "", err
+	}
+	payload := base64.StdEncoding.EncodeToString(claims)
+
+	hash := hashFunction.New()
+	hash.Write([]byte(prefix + payload))
+	rSig, sSig, err := ecdsa.Sign(rand.Reader, key, hash.Sum(nil))
+	if err != nil {
+		return "", err
+	}
+	return payload + "." + encodeSignature(rSig, sSig), nil
+}
+
+// parseChallenge returns the ID of the user who the challenge was made for,
+// if key signed it with the prefix and it hasn't expired at now.
+func parseChallenge(key *ecdsa.PublicKey, prefix string, token string, now time.Time) (int64, error) {
+	payload, encodedSignature, ok := strings.Cut(token, ".")
+	if !ok || strings.Contains(encodedSignature, ".") {
+		return 0, errors.New("challenge parse failed: a challenge should have two parts separated by decimals")
+	}
+	signature, err := base64.StdEncoding.DecodeString(encodedSignature)
+	if err != nil {
+		return 0, errors.New("challenge parse failed: signature was not base64 encoded")
+	}
+	if len(signature) != expectedSignatureSize {
+		return 0, errors.New("challenge parse failed: invalid signature length")
+	}
+	sigR := big.NewInt(0).SetBytes(signature[:keySize])
+	sigS := big.NewInt(0).SetBytes(signature[keySize:])
+
+	hash := hashFunction.New()
+	hash.Write([]byte(prefix + payload))
+	if !ecdsa.Verify(key, hash.Sum(nil), sigR, sigS) {
+		return 0, errors.New("challenge rejected: signatures did not match")
+	}
+	claims, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return 0, errors.New("challenge parse failed: claims were not base64 encoded")
+	}
+	var parsed challenge
+	if err := json.Unmarshal(claims, &parsed); err != nil {
+		return 0, errors.New("malformed challenge: this shouldn't happen")
+	}
+	if !now.Before(time.Unix(parsed.ExpiresAt, 0)) {
+		return 0, errors.New("challenge rejected: it expired")
+	}
+	return parsed.UserID, nil
+}
@@ -0,0 +1,232 @@
+package http_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wikisophia/api/server/acceptancetest"
+	"github.com/wikisophia/api/server/accounts/totp"
+	"github.com/wikisophia/api/server/config"
+	"github.com/wikisophia/api/server/http/problems"
+)
+
+func TestTwoFactorLogin(t *testing.T) {
+	a := newApp(t, nil)
+	acct := a.SaveAccountSuccessfully("some-email@soph.wiki")
+	a.ResetPasswordSuccessfully(acct.ID, acct.ResetToken, "some-password")
+	secret, recoveryCodes := a.EnableTwoFactorSuccessfully(acct.ID, "some-email@soph.wiki", "some-password")
+
+	challenge := a.AuthenticateForChallenge("some-email@soph.wiki", "some-password")
+	assert.Equal(t, http.StatusForbidden, a.GetAccount("me", challenge).Code, "challenges shouldn't work as sessions")
+	code, err := totp.Code(secret, time.Now().Add(totp.Period))
+	require.NoError(t, err)
+	rr := a.FinishAuthentication(challenge, code)
+	require.Equal(t, http.StatusOK, rr.Code)
+	var session struct {
+		Token string `json:"token"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &session))
+	assert.Equal(t, "auth="+session.Token+"; SameSite=Strict; Secure; HttpOnly", rr.Header().Get("Set-Cookie"))
+	assert.Equal(t, http.StatusOK, a.GetAccount("me", session.Token).Code)
+
+	rr = a.FinishAuthentication(challenge, code)
+	assert.Equal(t, http.StatusForbidden, rr.Code, "TOTP codes should only work once")
+	assert.Equal(t, problems.CodePermissionDenied, acceptancetest.ParseProblem(t, rr).Code)
+
+	assert.Equal(t, http.StatusOK, a.FinishAuthentication(challenge, strings.ToUpper(recoveryCodes[0])).Code)
+	assert.Equal(t, http.StatusForbidden, a.FinishAuthentication(challenge, recoveryCodes[0]).Code, "recovery codes should only work once")
+
+	rr = a.GetTwoFactor(session.Token)
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"enabled":true,"required":false,"recoveryCodesLeft":9}`, rr.Body.String())
+}
+
+func TestTwoFactorCanBeTurnedOff(t *testing.T) {
+	a := newApp(t, nil)
+	acct := a.SaveAccountSuccessfully("some-email@soph.wiki")
+	a.ResetPasswordSuccessfully(acct.ID, acct.ResetToken, "some-password")
+	_, recoveryCodes := a.EnableTwoFactorSuccessfully(acct.ID, "some-email@soph.wiki", "some-password")
+
+	assert.Equal(t, http.StatusForbidden, a.DisableTwoFactor(acct.ID, "wrong-password", recoveryCodes[0]).Code)
+	assert.Equal(t, http.StatusForbidden, a.DisableTwoFactor(acct.ID, "some-password", "000000").Code)
+	assert.Equal(t, http.StatusNoContent, a.DisableTwoFactor(acct.ID, "some-password", recoveryCodes[0]).Code)
+	token := a.AuthenticateSuccessfully("some-email@soph.wiki", "some-password")
+	assert.JSONEq(t, `{"enabled":false,"required":false,"recoveryCodesLeft":0}`, a.GetTwoFactor(token).Body.String())
+}
+
+func TestTwoFactorProtectsPasswordAndEmailChanges(t *testing.T) {
+	a := newApp(t, nil)
+	acct := a.SaveAccountSuccessfully("some-email@soph.wiki")
+	a.ResetPasswordSuccessfully(acct.ID, acct.ResetToken, "some-password")
+	secret, recoveryCodes := a.EnableTwoFactorSuccessfully(acct.ID, "some-email@soph.wiki", "some-password")
+
+	rr := a.UpdatePassword(acct.ID, "some-password", "some-new-password")
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Equal(t, problems.CodeTwoFactorCodeRequired, acceptancetest.ParseProblem(t, rr).Code)
+	rr = a.UpdatePassword(acct.ID, "wrong-password", "some-new-password")
+	assert.Equal(t, problems.CodePermissionDenied, acceptancetest.ParseProblem(t, rr).Code,
+		"wrong passwords shouldn't reveal that the account has two-factor auth")
+	rr = a.UpdatePasswordWithCode(acct.ID, "some-password", "some-new-password", "000000")
+	assert.Equal(t, problems.CodePermissionDenied, acceptancetest.ParseProblem(t, rr).Code)
+	assert.Equal(t, http.StatusNoContent, a.UpdatePasswordWithCode(acct.ID, "some-password", "some-new-password", recoveryCodes[0]).Code)
+
+	rr = a.RequestEmailChange(acct.ID, "some-new-password", "new@soph.wiki")
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Equal(t, problems.CodeTwoFactorCodeRequired, acceptancetest.ParseProblem(t, rr).Code)
+	code, err := totp.Code(secret, time.Now().Add(totp.Period))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, a.RequestEmailChangeWithCode(acct.ID, "some-new-password", "new@soph.wiki", code).Code)
+}
+
+func TestTwoFactorCanBeRequired(t *testing.T) {
+	a := newApp(t, nil)
+	acct := a.SaveAccountSuccessfully("some-email@soph.wiki")
+	a.ResetPasswordSuccessfully(acct.ID, acct.ResetToken, "some-password")
+	a.RequireTwoFactor(acct.ID, true)
+
+	rr := a.Authenticate("some-email@soph.wiki", "some-password")
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Equal(t, problems.CodeTwoFactorSetupRequired, acceptancetest.ParseProblem(t, rr).Code)
+
+	_, recoveryCodes := a.EnableTwoFactorSuccessfully(acct.ID, "some-email@soph.wiki", "some-password")
+	a.AuthenticateForChallenge("some-email@soph.wiki", "some-password")
+	rr = a.DisableTwoFactor(acct.ID, "some-password", recoveryCodes[0])
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Equal(t, problems.CodeTwoFactorRequired, acceptancetest.ParseProblem(t, rr).Code)
+
+	a.RequireTwoFactor(acct.ID, false)
+	assert.Equal(t, http.StatusNoContent, a.DisableTwoFactor(acct.ID, "some-password", recoveryCodes[0]).Code,
+		"the rejected request shouldn't have used up the code")
+}
+
+func TestEnrollmentNeedsSession(t *testing.T) {
+	a := newApp(t, nil)
+	acct := a.SaveAccountSuccessfully("some-email@soph.wiki")
+	a.ResetPasswordSuccessfully(acct.ID, acct.ResetToken, "some-password")
+	other := a.SaveAccountSuccessfully("other-email@soph.wiki")
+	a.ResetPasswordSuccessfully(other.ID, other.ResetToken, "other-password")
+	otherToken := a.AuthenticateSuccessfully("other-email@soph.wiki", "other-password")
+
+	rr := a.EnrollTwoFactor("", acct.ID, `{"password":"some-password"}`)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Equal(t, problems.CodePermissionDenied, acceptancetest.ParseProblem(t, rr).Code)
+	assert.Equal(t, http.StatusForbidden, a.EnrollTwoFactor(otherToken, acct.ID, `{"password":"some-password"}`).Code,
+		"sessions should only work for their own account")
+	assert.Equal(t, http.StatusForbidden, a.EnrollTwoFactor("", acct.ID, `{"password":"some-password","setupToken":"`+otherToken+`"}`).Code,
+		"sessions shouldn't work as setup tokens")
+
+	a.RequireTwoFactor(acct.ID, true)
+	rr = a.Authenticate("some-email@soph.wiki", "some-password")
+	setupToken := acceptancetest.ParseProblem(t, rr).SetupToken
+	require.NotEmpty(t, setupToken)
+	assert.Equal(t, http.StatusForbidden, a.GetAccount("me", setupToken).Code, "setup tokens shouldn't work as sessions")
+	assert.Equal(t, http.StatusForbidden, a.FinishAuthentication(setupToken, "123456").Code, "setup tokens shouldn't work as challenges")
+	assert.Equal(t, http.StatusForbidden, a.EnrollTwoFactor("", other.ID, `{"password":"other-password","setupToken":"`+setupToken+`"}`).Code,
+		"setup tokens should only work for their own account")
+	assert.Equal(t, http.StatusOK, a.EnrollTwoFactor("", acct.ID, `{"password":"some-password","setupToken":"`+setupToken+`"}`).Code)
+}
+
+func TestWrongTwoFactorCodesLockAccount(t *testing.T) {
+	a := newApp(t, nil)
+	acct := a.SaveAccountSuccessfully("some-email@soph.wiki")
+	a.ResetPasswordSuccessfully(acct.ID, acct.ResetToken, "some-password")
+	_, recoveryCodes := a.EnableTwoFactorSuccessfully(acct.ID, "some-email@soph.wiki", "some-password")
+
+	threshold := config.Defaults().Lockout.Threshold
+	for i := 1; i < threshold; i++ {
+		challenge := a.AuthenticateForChallenge("some-email@soph.wiki", "some-password")
+		assert.Equal(t, problems.CodePermissionDenied, acceptancetest.ParseProblem(t, a.FinishAuthentication(challenge, "000000")).Code)
+	}
+	challenge := a.AuthenticateForChallenge("some-email@soph.wiki", "some-password")
+	rr := a.FinishAuthentication(challenge, "000000")
+	assert.Equal(t, problems.CodeAccountLocked, acceptancetest.ParseProblem(t, rr).Code)
+	assert.Equal(t, "60", rr.Header().Get("Retry-After"))
+
+	rr = a.FinishAuthentication(challenge, recoveryCodes[0])
+	assert.Equal(t, problems.CodeAccountLocked, acceptancetest.ParseProblem(t, rr).Code)
+}
+
+func TestWrongEnrollmentPasswordsLockAccount(t *testing.T) {
+	a := newApp(t, nil)
+	acct := a.SaveAccountSuccessfully("some-email@soph.wiki")
+	a.ResetPasswordSuccessfully(acct.ID, acct.ResetToken, "some-password")
+
+	token := a.AuthenticateSuccessfully("some-email@soph.wiki", "some-password")
+
+	threshold := config.Defaults().Lockout.Threshold
+	for i := 1; i < threshold; i++ {
+		assert.Equal(t, problems.CodePermissionDenied, acceptancetest.ParseProblem(t, a.EnrollTwoFactor(token, acct.ID, `{"password":"wrong-password"}`)).Code)
+	}
+	rr := a.EnrollTwoFactor(token, acct.ID, `{"password":"wrong-password"}`)
+	assert.Equal(t, problems.CodeAccountLocked, acceptancetest.ParseProblem(t, rr).Code)
+	rr = a.EnrollTwoFactor(token, acct.ID, `{"password":"some-password"}`)
+	assert.Equal(t, problems.CodeAccountLocked, acceptancetest.ParseProblem(t, rr).Code)
+}
+
+func TestWrongDisableTwoFactorAttemptsLockAccount(t *testing.T) {
+	a := newApp(t, nil)
+	acct := a.SaveAccountSuccessfully("some-email@soph.wiki")
+	a.ResetPasswordSuccessfully(acct.ID, acct.ResetToken, "some-password")
+	_, recoveryCodes := a.EnableTwoFactorSuccessfully(acct.ID, "some-email@soph.wiki", "some-password")
+
+	threshold := config.Defaults().Lockout.Threshold
+	for i := 1; i < threshold; i++ {
+		assert.Equal(t, problems.CodePermissionDenied, acceptancetest.ParseProblem(t, a.DisableTwoFactor(acct.ID, "wrong-password", recoveryCodes[0])).Code)
+	}
+	rr := a.DisableTwoFactor(acct.ID, "some-password", "000000")
+	assert.Equal(t, problems.CodeAccountLocked, acceptancetest.ParseProblem(t, rr).Code)
+	rr = a.DisableTwoFactor(acct.ID, "some-password", recoveryCodes[0])
+	assert.Equal(t, problems.CodeAccountLocked, acceptancetest.ParseProblem(t, rr).Code)
+}
+
+func TestChallengesExpire(t *testing.T) {
+	a := newApp(t, &acceptancetest.AppConfig{
+		EmailerSucceeds: true,
+		TwoFactor: &config.TwoFactor{
+			Issuer:                "Wikisophia",
+			ChallengeExpiryMillis: 1,
+		},
+	})
+	acct := a.SaveAccountSuccessfully("some-email@soph.wiki")
+	a.ResetPasswordSuccessfully(acct.ID, acct.ResetToken, "some-password")
+	_, recoveryCodes := a.EnableTwoFactorSuccessfully(acct.ID, "some-email@soph.wiki", "some-password")
+
+	challenge := a.AuthenticateForChallenge("some-email@soph.wiki", "some-password")
+	time.Sleep(time.Second)
+	assert.Equal(t, http.StatusForbidden, a.FinishAuthentication(challenge, recoveryCodes[0]).Code)
+}
+
+func TestTwoFactorRejectsBadRequestsProperly(t *testing.T) {
+	a := newApp(t, nil)
+	acct := a.SaveAccountSuccessfully("some-email@soph.wiki")
+	a.ResetPasswordSuccessfully(acct.ID, acct.ResetToken, "some-password")
+
+	a.AssertBadRequest("POST", "/accounts/1/two-factor", "not json")
+	a.AssertBadRequest("POST", "/accounts/1/two-factor", "{}")
+	a.AssertBadRequest("POST", "/accounts/1/two-factor", `{"password":"some-password","code":"123456"}`)
+	a.AssertBadRequest("DELETE", "/accounts/1/two-factor", `{"password":"some-password"}`)
+	a.AssertBadRequest("DELETE", "/accounts/1/two-factor", `{"code":"123456"}`)
+	a.AssertBadRequest("POST", "/sessions", `{"challenge":"abc"}`)
+	a.AssertBadRequest("POST", "/sessions", `{"code":"123456"}`)
+	a.AssertBadRequest("POST", "/sessions", `{"email":"some-email@soph.wiki","password":"some-password","code":"123456"}`)
+	a.AssertNotFound("GET", "/accounts/1/two-factor")
+
+	token := a.AuthenticateSuccessfully("some-email@soph.wiki", "some-password")
+	assert.Equal(t, http.StatusForbidden, a.EnrollTwoFactor(token, acct.ID, `{"password":"wrong-password"}`).Code)
+	assert.Equal(t, http.StatusForbidden, a.EnrollTwoFactor(token, 100, `{"password":"some-password"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, a.EnrollTwoFactor(token, acct.ID, `{"code":"123456"}`).Code, "enrollment should start with the password")
+	assert.Equal(t, http.StatusForbidden, a.GetTwoFactor("").Code)
+	assert.Equal(t, http.StatusForbidden, a.FinishAuthentication("not-a-challenge", "123456").Code)
+	assert.Equal(t, http.StatusForbidden, a.FinishAuthentication(token, "123456").Code, "sessions shouldn't work as challenges")
+	assert.Equal(t, http.StatusForbidden, a.DisableTwoFactor(acct.ID, "some-password", "123456").Code)
+
+	a.EnableTwoFactorSuccessfully(acct.ID, "some-email@soph.wiki", "some-password")
+	rr := a.EnrollTwoFactor(token, acct.ID, `{"password":"some-password"}`)
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	assert.Equal(t, problems.CodeTwoFactorEnabled, acceptancetest.ParseProblem(t, rr).Code)
+}
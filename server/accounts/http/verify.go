@@ -0,0 +1,116 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/http/problems"
+	"github.com/wikisophia/api/server/http/timeouts"
+	"github.com/wikisophia/api/server/logging"
+)
+
+// Implements POST /accounts/verify
+func verifyEmailHandler(verifier accounts.EmailVerifier) http.HandlerFunc {
+	type request struct {
+		ID    int64  `json:"id"`
+		Token string `json:"token"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		payload, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			problems.Write(w, http.StatusBadRequest, problems.CodeMalformedRequest, "Failed to read the request body.")
+			return
+		}
+		var req request
+		if err = json.Unmarshal(payload, &req); err != nil {
+			problems.Write(w, http.StatusBadRequest, problems.CodeMalformedRequest, "invalid request body: "+err.Error())
+			return
+		}
+		if req.ID == 0 {
+			writeMissingProperty(w, "id")
+			return
+		}
+		if req.Token == "" {
+			writeMissingProperty(w, "token")
+			return
+		}
+
+		err = verifier.VerifyEmail(r.Context(), req.ID, req.Token)
+		if timeouts.WriteError(w, r, err) {
+			return
+		}
+		// Don't give away which accounts exist and which ones don't.
+		if errors.As(err, &accounts.InvalidVerificationTokenError{}) ||
+			errors.As(err, &accounts.AccountNotExistsError{}) {
+			problems.Write(w, http.StatusForbidden, problems.CodePermissionDenied, "Unauthorized")
+			return
+		}
+		if err != nil {
+			problems.WriteInternal(w, r, err)
+			return
+		}
+		logging.SetAccountID(r.Context(), req.ID)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// Implements POST /accounts/verify/resend. This emails a new verification token
+// if the account exists and hasn't been verified yet.
+//
+// The response is the same either way, so that clients can't use this to find out which emails have accounts.
+func resendVerificationHandler(verifier accounts.EmailVerifier) http.HandlerFunc {
+	type request struct {
+		Email string `json:"email"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		payload, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			problems.Write(w, http.StatusBadRequest, problems.CodeMalformedRequest, "Failed to read the request body.")
+			return
+		}
+		var req request
+		if err = json.Unmarshal(payload, &req); err != nil {
+			problems.Write(w, http.StatusBadRequest, problems.CodeMalformedRequest, "invalid request body: "+err.Error())
+			return
+		}
+		if req.Email == "" {
+			writeMissingProperty(w, "email")
+			return
+		}
+
+		// The store queues the email along with the token.
+		_, err = verifier.NewVerificationToken(r.Context(), req.Email)
+		if timeouts.WriteError(w, r, err) {
+			return
+		}
+		if errors.As(err, &accounts.AccountNotExistsError{}) || errors.As(err, &accounts.EmailAlreadyVerifiedError{}) {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if err != nil {
+			problems.WriteInternal(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// onlyFor serves the handler if the route's :id is the given value, and responds NotFound otherwise.
+//
+// The router can't have "/accounts/verify" next to "/accounts/:id/password", since one path
+// segment can't be both static and a wildcard. So the verify routes are registered under :id instead.
+func onlyFor(id string, handler http.HandlerFunc) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		if params.ByName("id") != id {
+			problems.NotFound(w, r)
+			return
+		}
+		handler(w, r)
+	}
+}
@@ -0,0 +1,85 @@
+package http_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wikisophia/api/server/acceptancetest"
+	"github.com/wikisophia/api/server/config"
+	"github.com/wikisophia/api/server/http/problems"
+)
+
+func TestWelcomeHasVerificationToken(t *testing.T) {
+	a := newApp(t, nil)
+	account := a.SaveAccountSuccessfully("some-email@soph.wiki")
+	assert.NotEmpty(t, account.VerificationToken)
+	assert.NotEqual(t, account.ResetToken, account.VerificationToken)
+}
+
+func TestVerifyEmail(t *testing.T) {
+	a := newApp(t, nil)
+	account := a.SaveAccountSuccessfully("some-email@soph.wiki")
+	assert.Equal(t, http.StatusNoContent, a.VerifyEmail(account.ID, account.VerificationToken).Code)
+
+	rr := a.VerifyEmail(account.ID, account.VerificationToken)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Equal(t, problems.CodePermissionDenied, acceptancetest.ParseProblem(t, rr).Code)
+}
+
+func TestVerifyRejectsWrongTokens(t *testing.T) {
+	a := newApp(t, nil)
+	account := a.SaveAccountSuccessfully("some-email@soph.wiki")
+	assert.Equal(t, http.StatusForbidden, a.VerifyEmail(account.ID, account.ResetToken).Code)
+	assert.Equal(t, http.StatusForbidden, a.VerifyEmail(account.ID+1, account.VerificationToken).Code)
+}
+
+func TestVerifyRejectsBadRequestBodies(t *testing.T) {
+	acceptancetest.AssertBadRequest(t, "POST", "/accounts/verify", "not json")
+	acceptancetest.AssertBadRequest(t, "POST", "/accounts/verify", "{}")
+	acceptancetest.AssertBadRequest(t, "POST", "/accounts/verify", `{"id":1}`)
+	acceptancetest.AssertBadRequest(t, "POST", "/accounts/verify", `{"token":"abc"}`)
+	acceptancetest.AssertBadRequest(t, "POST", "/accounts/verify/resend", "{}")
+}
+
+func TestOtherAccountPathsNotFound(t *testing.T) {
+	a := newApp(t, nil)
+	a.AssertNotFound("POST", "/accounts/1")
+	a.AssertNotFound("POST", "/accounts/1/resend")
+}
+
+func TestResendVerification(t *testing.T) {
+	a := newApp(t, nil)
+	assert.Equal(t, http.StatusNoContent, a.ResendVerification("nobody@soph.wiki").Code)
+	assert.Empty(t, a.Emailer.Verifications)
+
+	account := a.SaveAccountSuccessfully("some-email@soph.wiki")
+	assert.Equal(t, http.StatusNoContent, a.ResendVerification("some-email@soph.wiki").Code)
+	require.Len(t, a.Emailer.Verifications, 1)
+	resent := a.Emailer.Verifications[0]
+	assert.Equal(t, account.ID, resent.ID)
+	assert.Equal(t, http.StatusForbidden, a.VerifyEmail(account.ID, account.VerificationToken).Code, "the old token should be replaced")
+	assert.Equal(t, http.StatusNoContent, a.VerifyEmail(resent.ID, resent.VerificationToken).Code)
+
+	assert.Equal(t, http.StatusNoContent, a.ResendVerification("some-email@soph.wiki").Code)
+	assert.Len(t, a.Emailer.Verifications, 1, "verified emails shouldn't get new tokens")
+}
+
+func TestLoginRequiresVerification(t *testing.T) {
+	a := newApp(t, &acceptancetest.AppConfig{
+		EmailerSucceeds: true,
+		Verification:    &config.Verification{RequiredToLogin: true},
+	})
+	account := a.SaveAccountSuccessfully("some-email@soph.wiki")
+	a.ResetPasswordSuccessfully(account.ID, account.ResetToken, "some-password")
+
+	rr := a.Authenticate("some-email@soph.wiki", "some-password")
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Equal(t, problems.CodeEmailNotVerified, acceptancetest.ParseProblem(t, rr).Code)
+	rr = a.Authenticate("some-email@soph.wiki", "wrong-password")
+	assert.Equal(t, problems.CodePermissionDenied, acceptancetest.ParseProblem(t, rr).Code, "wrong passwords shouldn't reveal the verification status")
+
+	require.Equal(t, http.StatusNoContent, a.VerifyEmail(account.ID, account.VerificationToken).Code)
+	a.AuthenticateSuccessfully("some-email@soph.wiki", "some-password")
+}
@@ -0,0 +1,233 @@
+// Package lockout stops people from guessing passwords, by locking accounts after too many failed logins.
+package lockout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/accounts/email"
+	"github.com/wikisophia/api/server/config"
+	"github.com/wikisophia/api/server/logging"
+)
+
+// NewStore returns a Store which locks accounts in store after cfg.Threshold failed logins in a row.
+// Wrong two-factor codes count as failed logins too, and so do wrong passwords sent to change the password or email,
+// to delete the account, or to turn two-factor auth on or off.
+// Each failure after that locks the account again, for twice as long as the last time.
+// The owner gets an email through emailer the first time it's locked.
+//
+// If cfg.Threshold is 0, store is returned as-is.
+// now tells the time. If it's nil, time.Now is used.
+func NewStore(store accounts.Store, emailer email.Emailer, cfg config.Lockout, now func() time.Time) accounts.Store {
+	if cfg.Threshold == 0 {
+		return store
+	}
+	if now == nil {
+		now = time.Now
+	}
+	return &lockingStore{
+		Store:     store,
+		emailer:   emailer,
+		threshold: cfg.Threshold,
+		delay:     time.Duration(cfg.DelayMillis) * time.Millisecond,
+		maxDelay:  time.Duration(cfg.MaxDelayMillis) * time.Millisecond,
+		now:       now,
+	}
+}
+
+type lockingStore struct {
+	accounts.Store
+	emailer   email.Emailer
+	threshold int
+	delay     time.Duration
+	maxDelay  time.Duration
+	now       func() time.Time
+}
+
+// Authenticate works like the wrapped Store's, except that it returns an AccountLockedError
+// if the account is locked. Failures while it's locked don't make the lock any longer.
+func (s *lockingStore) Authenticate(ctx context.Context, email, password string) (int64, error) {
+	failures, err := s.Store.LoginFailures(ctx, email)
+	// Let the wrapped Store handle missing accounts, so that they take as long as real ones.
+	if errors.As(err, &accounts.AccountNotExistsError{}) {
+		return s.Store.Authenticate(ctx, email, password)
+	}
+	if err != nil {
+		return -1, err
+	}
+	if s.now().Before(failures.LockedUntil) {
+		// The password still gets checked, so that locked accounts take as long as missing ones.
+		// The result doesn't matter. Even the right password can't log in until the lock ends.
+		s.Store.Authenticate(ctx, email, password)
+		return -1, accounts.AccountLockedError{Until: failures.LockedUntil}
+	}
+
+	id, err := s.Store.Authenticate(ctx, email, password)
+	if errors.As(err, &accounts.InvalidPasswordError{}) {
+		return -1, s.recordFailure(ctx, accounts.Account{ID: failures.AccountID, Email: email}, err)
+	}
+	if err != nil {
+		return -1, err
+	}
+	if failures.Count > 0 {
+		if err := s.clearPasswordFailures(ctx, id); err != nil {
+			return -1, err
+		}
+	}
+	return id, nil
+}
+
+// ChangePassword works like the wrapped Store's, except that wrong old passwords and codes count as failed logins,
+// and it returns an AccountLockedError if the account is locked. Otherwise, it could be used to guess
+// passwords without ever being locked out.
+func (s *lockingStore) ChangePassword(ctx context.Context, id int64, oldPassword, newPassword, code string) error {
+	// Accounts with two-factor auth only get this far with the right code, so all the failures can be cleared.
+	return s.guard(ctx, id, true, func() error {
+		return s.Store.ChangePassword(ctx, id, oldPassword, newPassword, code)
+	})
+}
+
+// RequestEmailChange counts wrong passwords and codes, and checks for locks like ChangePassword does.
+func (s *lockingStore) RequestEmailChange(ctx context.Context, id int64, password, newEmail, code string) (account accounts.Account, err error) {
+	err = s.guard(ctx, id, true, func() error {
+		account, err = s.Store.RequestEmailChange(ctx, id, password, newEmail, code)
+		return err
+	})
+	return account, err
+}
+
+// ScheduleDeletion counts wrong passwords and checks for locks like ChangePassword does.
+func (s *lockingStore) ScheduleDeletion(ctx context.Context, id int64, password string, dueAt time.Time) error {
+	return s.guard(ctx, id, false, func() error {
+		return s.Store.ScheduleDeletion(ctx, id, password, dueAt)
+	})
+}
+
+// CheckTwoFactor works like the wrapped Store's, except that wrong codes count as failed logins,
+// and it returns an AccountLockedError if the account is locked. Locked accounts don't have their codes checked at all.
+func (s *lockingStore) CheckTwoFactor(ctx context.Context, id int64, code string) error {
+	return s.guard(ctx, id, true, func() error {
+		return s.Store.CheckTwoFactor(ctx, id, code)
+	})
+}
+
+// ConfirmTwoFactor counts wrong codes and checks for locks like CheckTwoFactor does. Otherwise, anyone could
+// guess codes for an account's unconfirmed secret, and get its recovery codes.
+func (s *lockingStore) ConfirmTwoFactor(ctx context.Context, id int64, code string) (codes []string, err error) {
+	err = s.guard(ctx, id, true, func() error {
+		codes, err = s.Store.ConfirmTwoFactor(ctx, id, code)
+		return err
+	})
+	return codes, err
+}
+
+// EnrollTwoFactor counts wrong passwords and checks for locks like ChangePassword does.
+func (s *lockingStore) EnrollTwoFactor(ctx context.Context, id int64, password string) (enrollment accounts.TwoFactorEnrollment, err error) {
+	err = s.guard(ctx, id, false, func() error {
+		enrollment, err = s.Store.EnrollTwoFactor(ctx, id, password)
+		return err
+	})
+	return enrollment, err
+}
+
+// DisableTwoFactor counts wrong passwords and wrong codes, and checks for locks like CheckTwoFactor does.
+func (s *lockingStore) DisableTwoFactor(ctx context.Context, id int64, password, code string) error {
+	return s.guard(ctx, id, true, func() error {
+		return s.Store.DisableTwoFactor(ctx, id, password, code)
+	})
+}
+
+// guard calls check unless the account is locked, and records a failure if it returns an InvalidPasswordError
+// or InvalidTwoFactorCodeError. If check succeeds, the failures are cleared. checksCode should be false if
+// check only proved that the caller knows the password, so that accounts with two-factor auth keep them.
+func (s *lockingStore) guard(ctx context.Context, id int64, checksCode bool, check func() error) error {
+	profile, err := s.Store.AccountProfile(ctx, id)
+	if errors.As(err, &accounts.AccountNotExistsError{}) {
+		return check()
+	}
+	if err != nil {
+		return err
+	}
+	failures, err := s.Store.LoginFailures(ctx, profile.Email)
+	if err != nil {
+		return err
+	}
+	if s.now().Before(failures.LockedUntil) {
+		return accounts.AccountLockedError{Until: failures.LockedUntil}
+	}
+
+	err = check()
+	if errors.As(err, &accounts.InvalidPasswordError{}) || errors.As(err, &accounts.InvalidTwoFactorCodeError{}) {
+		return s.recordFailure(ctx, accounts.Account{ID: id, Email: profile.Email}, err)
+	}
+	if err != nil {
+		return err
+	}
+	if failures.Count == 0 {
+		return nil
+	}
+	if !checksCode {
+		return s.clearPasswordFailures(ctx, id)
+	}
+	if err := s.Store.ClearLoginFailures(ctx, id); err != nil {
+		return fmt.Errorf("failed to clear login failures: %v", err)
+	}
+	return nil
+}
+
+// clearPasswordFailures clears the account's failed logins after someone proved they know its password.
+// Accounts with two-factor auth keep them until the code is right too. Otherwise,
+// someone who knew the password could guess codes forever.
+func (s *lockingStore) clearPasswordFailures(ctx context.Context, id int64) error {
+	status, err := s.Store.TwoFactorStatus(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to check two-factor status: %v", err)
+	}
+	if status.Enabled {
+		return nil
+	}
+	if err := s.Store.ClearLoginFailures(ctx, id); err != nil {
+		return fmt.Errorf("failed to clear login failures: %v", err)
+	}
+	return nil
+}
+
+// recordFailure counts a failed login on the account, and locks it if there have been too many.
+// It returns the error which Authenticate or guard should return.
+func (s *lockingStore) recordFailure(ctx context.Context, account accounts.Account, invalidPassword error) error {
+	count, err := s.Store.RecordLoginFailure(ctx, account.ID)
+	if err != nil {
+		return fmt.Errorf("failed to record login failure: %v", err)
+	}
+	if count < s.threshold {
+		return invalidPassword
+	}
+
+	until := s.now().Add(s.lockDuration(count))
+	if err := s.Store.LockAccount(ctx, account.ID, until); err != nil {
+		return fmt.Errorf("failed to lock account: %v", err)
+	}
+	// Later locks aren't worth an email. The owner already knows someone is guessing.
+	if count == s.threshold {
+		if err := s.emailer.SendLocked(ctx, account, until); err != nil {
+			logging.FromContext(ctx).Error("failed to send account locked email", slog.Int64("account_id", account.ID), slog.Any("error", err))
+		}
+	}
+	return accounts.AccountLockedError{Until: until}
+}
+
+// lockDuration returns how long to lock the account for after its count'th failed login.
+func (s *lockingStore) lockDuration(count int) time.Duration {
+	duration := s.delay
+	for i := s.threshold; i < count && duration < s.maxDelay; i++ {
+		duration *= 2
+	}
+	if duration > s.maxDelay {
+		return s.maxDelay
+	}
+	return duration
+}
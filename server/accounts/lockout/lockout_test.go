@@ -0,0 +1,310 @@
+package lockout_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/accounts/lockout"
+	"github.com/wikisophia/api/server/accounts/memory"
+	"github.com/wikisophia/api/server/accounts/totp"
+	"github.com/wikisophia/api/server/config"
+)
+
+func TestLocksAfterThreshold(t *testing.T) {
+	store, emailer, clock := newLockingStore(t)
+	failLogins(t, store, 2)
+
+	_, err := store.Authenticate(context.Background(), "email@soph.wiki", "wrong-password")
+	assertLockedUntil(t, err, clock.now.Add(time.Minute))
+	require.Len(t, emailer.locks, 1)
+	assert.Equal(t, "email@soph.wiki", emailer.locks[0].Email)
+
+	// Even the right password fails while the account is locked.
+	_, err = store.Authenticate(context.Background(), "email@soph.wiki", "password")
+	assertLockedUntil(t, err, clock.now.Add(time.Minute))
+}
+
+func TestLockDoubles(t *testing.T) {
+	store, emailer, clock := newLockingStore(t)
+	failLogins(t, store, 2)
+
+	expected := []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute}
+	for _, duration := range expected {
+		_, err := store.Authenticate(context.Background(), "email@soph.wiki", "wrong-password")
+		assertLockedUntil(t, err, clock.now.Add(duration))
+		clock.now = clock.now.Add(duration)
+	}
+	assert.Len(t, emailer.locks, 1, "only the first lock should send an email")
+}
+
+func TestSuccessClearsFailures(t *testing.T) {
+	store, emailer, _ := newLockingStore(t)
+	failLogins(t, store, 2)
+	_, err := store.Authenticate(context.Background(), "email@soph.wiki", "password")
+	require.NoError(t, err)
+
+	failLogins(t, store, 2)
+	_, err = store.Authenticate(context.Background(), "email@soph.wiki", "password")
+	require.NoError(t, err)
+	assert.Empty(t, emailer.locks)
+}
+
+func TestLockExpires(t *testing.T) {
+	store, _, clock := newLockingStore(t)
+	failLogins(t, store, 2)
+	_, err := store.Authenticate(context.Background(), "email@soph.wiki", "wrong-password")
+	require.True(t, errors.As(err, &accounts.AccountLockedError{}))
+
+	clock.now = clock.now.Add(time.Minute)
+	_, err = store.Authenticate(context.Background(), "email@soph.wiki", "password")
+	assert.NoError(t, err)
+}
+
+func TestResetUnlocks(t *testing.T) {
+	store, _, _ := newLockingStore(t)
+	failLogins(t, store, 2)
+	_, err := store.Authenticate(context.Background(), "email@soph.wiki", "wrong-password")
+	require.True(t, errors.As(err, &accounts.AccountLockedError{}))
+
+	account, _, err := store.NewResetToken(context.Background(), "email@soph.wiki")
+	require.NoError(t, err)
+	require.NoError(t, store.SetForgottenPassword(context.Background(), account.ID, "new-password", account.ResetToken))
+	_, err = store.Authenticate(context.Background(), "email@soph.wiki", "new-password")
+	assert.NoError(t, err)
+}
+
+func TestWrongTwoFactorCodesLock(t *testing.T) {
+	store, emailer, clock := newLockingStore(t)
+	secret := enableTwoFactor(t, store)
+	for i := 0; i < 2; i++ {
+		_, err := store.Authenticate(context.Background(), "email@soph.wiki", "password")
+		require.NoError(t, err)
+		err = store.CheckTwoFactor(context.Background(), 1, "000000")
+		require.True(t, errors.As(err, &accounts.InvalidTwoFactorCodeError{}), "failure %d returned %v", i+1, err)
+	}
+
+	err := store.CheckTwoFactor(context.Background(), 1, "000000")
+	assertLockedUntil(t, err, clock.now.Add(time.Minute))
+	require.Len(t, emailer.locks, 1)
+	code, err := totp.Code(secret, time.Now().Add(totp.Period))
+	require.NoError(t, err)
+	err = store.CheckTwoFactor(context.Background(), 1, code)
+	assertLockedUntil(t, err, clock.now.Add(time.Minute))
+
+	clock.now = clock.now.Add(time.Minute)
+	require.NoError(t, store.CheckTwoFactor(context.Background(), 1, code))
+	failures, err := store.LoginFailures(context.Background(), "email@soph.wiki")
+	require.NoError(t, err)
+	assert.Zero(t, failures.Count)
+}
+
+func TestWrongOldPasswordsLock(t *testing.T) {
+	store, emailer, clock := newLockingStore(t)
+	for i := 0; i < 2; i++ {
+		err := store.ChangePassword(context.Background(), 1, "wrong-password", "new-password", "")
+		require.True(t, errors.As(err, &accounts.InvalidPasswordError{}), "failure %d returned %v", i+1, err)
+	}
+
+	err := store.ChangePassword(context.Background(), 1, "wrong-password", "new-password", "")
+	assertLockedUntil(t, err, clock.now.Add(time.Minute))
+	require.Len(t, emailer.locks, 1)
+	err = store.ChangePassword(context.Background(), 1, "password", "new-password", "")
+	assertLockedUntil(t, err, clock.now.Add(time.Minute))
+	_, err = store.Authenticate(context.Background(), "email@soph.wiki", "password")
+	assertLockedUntil(t, err, clock.now.Add(time.Minute))
+
+	clock.now = clock.now.Add(time.Minute)
+	require.NoError(t, store.ChangePassword(context.Background(), 1, "password", "new-password", ""))
+	failures, err := store.LoginFailures(context.Background(), "email@soph.wiki")
+	require.NoError(t, err)
+	assert.Zero(t, failures.Count)
+}
+
+func TestWrongEmailChangePasswordsLock(t *testing.T) {
+	store, emailer, clock := newLockingStore(t)
+	for i := 0; i < 2; i++ {
+		_, err := store.RequestEmailChange(context.Background(), 1, "wrong-password", "new@soph.wiki", "")
+		require.True(t, errors.As(err, &accounts.InvalidPasswordError{}), "failure %d returned %v", i+1, err)
+	}
+
+	_, err := store.RequestEmailChange(context.Background(), 1, "wrong-password", "new@soph.wiki", "")
+	assertLockedUntil(t, err, clock.now.Add(time.Minute))
+	require.Len(t, emailer.locks, 1)
+	_, err = store.RequestEmailChange(context.Background(), 1, "password", "new@soph.wiki", "")
+	assertLockedUntil(t, err, clock.now.Add(time.Minute))
+
+	clock.now = clock.now.Add(time.Minute)
+	_, err = store.RequestEmailChange(context.Background(), 1, "password", "new@soph.wiki", "")
+	require.NoError(t, err)
+}
+
+func TestWrongDeletionPasswordsLock(t *testing.T) {
+	store, emailer, clock := newLockingStore(t)
+	dueAt := clock.now.Add(time.Hour)
+	for i := 0; i < 2; i++ {
+		err := store.ScheduleDeletion(context.Background(), 1, "wrong-password", dueAt)
+		require.True(t, errors.As(err, &accounts.InvalidPasswordError{}), "failure %d returned %v", i+1, err)
+	}
+
+	err := store.ScheduleDeletion(context.Background(), 1, "wrong-password", dueAt)
+	assertLockedUntil(t, err, clock.now.Add(time.Minute))
+	require.Len(t, emailer.locks, 1)
+	err = store.ScheduleDeletion(context.Background(), 1, "password", dueAt)
+	assertLockedUntil(t, err, clock.now.Add(time.Minute))
+
+	clock.now = clock.now.Add(time.Minute)
+	require.NoError(t, store.ScheduleDeletion(context.Background(), 1, "password", dueAt))
+}
+
+func TestWrongEnrollmentPasswordsLock(t *testing.T) {
+	store, emailer, clock := newLockingStore(t)
+	for i := 0; i < 2; i++ {
+		_, err := store.EnrollTwoFactor(context.Background(), 1, "wrong-password")
+		require.True(t, errors.As(err, &accounts.InvalidPasswordError{}), "failure %d returned %v", i+1, err)
+	}
+
+	_, err := store.EnrollTwoFactor(context.Background(), 1, "wrong-password")
+	assertLockedUntil(t, err, clock.now.Add(time.Minute))
+	require.Len(t, emailer.locks, 1)
+	_, err = store.EnrollTwoFactor(context.Background(), 1, "password")
+	assertLockedUntil(t, err, clock.now.Add(time.Minute))
+
+	clock.now = clock.now.Add(time.Minute)
+	_, err = store.EnrollTwoFactor(context.Background(), 1, "password")
+	require.NoError(t, err)
+}
+
+func TestWrongDisableTwoFactorAttemptsLock(t *testing.T) {
+	store, emailer, clock := newLockingStore(t)
+	secret := enableTwoFactor(t, store)
+	code, err := totp.Code(secret, time.Now().Add(totp.Period))
+	require.NoError(t, err)
+
+	err = store.DisableTwoFactor(context.Background(), 1, "wrong-password", code)
+	require.True(t, errors.As(err, &accounts.InvalidPasswordError{}), "wrong password returned %v", err)
+	err = store.DisableTwoFactor(context.Background(), 1, "password", "000000")
+	require.True(t, errors.As(err, &accounts.InvalidTwoFactorCodeError{}), "wrong code returned %v", err)
+
+	err = store.DisableTwoFactor(context.Background(), 1, "wrong-password", code)
+	assertLockedUntil(t, err, clock.now.Add(time.Minute))
+	require.Len(t, emailer.locks, 1)
+	err = store.DisableTwoFactor(context.Background(), 1, "password", code)
+	assertLockedUntil(t, err, clock.now.Add(time.Minute))
+
+	clock.now = clock.now.Add(time.Minute)
+	require.NoError(t, store.DisableTwoFactor(context.Background(), 1, "password", code))
+	failures, err := store.LoginFailures(context.Background(), "email@soph.wiki")
+	require.NoError(t, err)
+	assert.Zero(t, failures.Count)
+}
+
+// TestUnknownEmailAuthenticates makes sure unknown emails reach the wrapped Store,
+// so that it can make them take as long as real logins.
+func TestUnknownEmailAuthenticates(t *testing.T) {
+	store := &countingStore{Store: memory.NewMemoryStore()}
+	locking := lockout.NewStore(store, &recordingEmailer{}, *config.Defaults().Lockout, nil)
+	_, err := locking.Authenticate(context.Background(), "unknown@soph.wiki", "password")
+	assert.True(t, errors.As(err, &accounts.AccountNotExistsError{}))
+	assert.Equal(t, 1, store.authenticated)
+}
+
+func TestZeroThresholdDisables(t *testing.T) {
+	store := memory.NewMemoryStore()
+	assert.Same(t, store, lockout.NewStore(store, &recordingEmailer{}, config.Lockout{}, nil))
+}
+
+// newLockingStore makes a Store with one account, "email@soph.wiki", whose password is "password".
+// It locks after 3 failures, for one minute at first, and at most five.
+func newLockingStore(t *testing.T) (accounts.Store, *recordingEmailer, *fakeClock) {
+	t.Helper()
+	store := memory.NewMemoryStore()
+	account, _, err := store.NewResetToken(context.Background(), "email@soph.wiki")
+	require.NoError(t, err)
+	require.NoError(t, store.SetForgottenPassword(context.Background(), account.ID, "password", account.ResetToken))
+
+	emailer := &recordingEmailer{}
+	clock := &fakeClock{now: time.Date(2020, time.March, 1, 12, 0, 0, 0, time.UTC)}
+	locking := lockout.NewStore(store, emailer, config.Lockout{
+		Threshold:      3,
+		DelayMillis:    60000,
+		MaxDelayMillis: 300000,
+	}, func() time.Time { return clock.now })
+	return locking, emailer, clock
+}
+
+// enableTwoFactor turns on two-factor auth for "email@soph.wiki", and returns its TOTP secret.
+func enableTwoFactor(t *testing.T, store accounts.Store) string {
+	t.Helper()
+	enrollment, err := store.EnrollTwoFactor(context.Background(), 1, "password")
+	require.NoError(t, err)
+	code, err := totp.Code(enrollment.Secret, time.Now())
+	require.NoError(t, err)
+	_, err = store.ConfirmTwoFactor(context.Background(), 1, code)
+	require.NoError(t, err)
+	return enrollment.Secret
+}
+
+// failLogins tries the wrong password n times, expecting none of them to lock the account.
+func failLogins(t *testing.T, store accounts.Store, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		_, err := store.Authenticate(context.Background(), "email@soph.wiki", "wrong-password")
+		require.True(t, errors.As(err, &accounts.InvalidPasswordError{}), "failure %d returned %v", i+1, err)
+	}
+}
+
+func assertLockedUntil(t *testing.T, err error, until time.Time) {
+	t.Helper()
+	var locked accounts.AccountLockedError
+	if assert.True(t, errors.As(err, &locked), "expected an AccountLockedError. Got %v", err) {
+		assert.Equal(t, until, locked.Until)
+	}
+}
+
+type countingStore struct {
+	accounts.Store
+	authenticated int
+}
+
+func (s *countingStore) Authenticate(ctx context.Context, email, password string) (int64, error) {
+	s.authenticated++
+	return s.Store.Authenticate(ctx, email, password)
+}
+
+type fakeClock struct {
+	now time.Time
+}
+
+type recordingEmailer struct {
+	locks []accounts.Account
+}
+
+func (e *recordingEmailer) SendWelcome(ctx context.Context, account accounts.Account) error {
+	return nil
+}
+
+func (e *recordingEmailer) SendReset(ctx context.Context, account accounts.Account) error {
+	return nil
+}
+
+func (e *recordingEmailer) SendVerification(ctx context.Context, account accounts.Account) error {
+	return nil
+}
+
+func (e *recordingEmailer) SendLocked(ctx context.Context, account accounts.Account, until time.Time) error {
+	e.locks = append(e.locks, account)
+	return nil
+}
+
+func (e *recordingEmailer) SendEmailChange(ctx context.Context, account accounts.Account) error {
+	return nil
+}
+
+func (e *recordingEmailer) SendEmailChangeNotice(ctx context.Context, account accounts.Account) error {
+	return nil
+}
@@ -0,0 +1,110 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/wikisophia/api/server/accounts"
+)
+
+// See the docs on interfaces in store.go
+func (s *InMemoryStore) ScheduleDeletion(ctx context.Context, id int64, password string, dueAt time.Time) error {
+	s.mutex.RLock()
+	info := s.unpurgedByID(id)
+	var hash string
+	if info != nil {
+		hash = info.passwordHash
+	}
+	s.mutex.RUnlock()
+	if info == nil {
+		return accounts.AccountNotExistsError{}
+	}
+	if err := s.checkPassword(ctx, password, hash); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	info = s.unpurgedByID(id)
+	// If the password changed while this was checking it, it isn't right anymore.
+	if info == nil || info.passwordHash != hash {
+		return accounts.InvalidPasswordError{}
+	}
+	info.deletionDueAt = dueAt
+	return nil
+}
+
+// See the docs on interfaces in store.go
+func (s *InMemoryStore) CancelDeletion(ctx context.Context, id int64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	info := s.byID(id)
+	if info == nil || !info.purgedAt.IsZero() {
+		return accounts.AccountNotExistsError{}
+	}
+	info.deletionDueAt = time.Time{}
+	return nil
+}
+
+// See the docs on interfaces in store.go
+func (s *InMemoryStore) PurgeAccounts(ctx context.Context, now time.Time) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	purged := 0
+	for email, info := range s.accounts {
+		if info.deletionDueAt.IsZero() || info.deletionDueAt.After(now) || !info.purgedAt.IsZero() {
+			continue
+		}
+		placeholder, err := accounts.PurgedEmail(info.account.ID)
+		if err != nil {
+			return purged, fmt.Errorf("failed to purge account %d: %v", info.account.ID, err)
+		}
+		delete(s.accounts, email)
+		s.accounts[placeholder] = &accountInfo{
+			account: accounts.Account{
+				ID:    info.account.ID,
+				Email: placeholder,
+			},
+			purgedAt: now,
+		}
+		s.dropEmails(info.account.ID)
+		s.dropSessions(info.account.ID)
+		purged++
+	}
+	return purged, nil
+}
+
+// dropEmails removes the account's emails from the outbox. Callers must hold the mutex.
+func (s *InMemoryStore) dropEmails(id int64) {
+	kept := s.outbox[:0]
+	for _, email := range s.outbox {
+		if email.Account.ID != id {
+			kept = append(kept, email)
+		}
+	}
+	s.outbox = kept
+}
+
+// deletionTimes returns the times for a StoredAccount's DeletionDueAt and PurgedAt.
+func (info *accountInfo) deletionTimes() (dueAt *time.Time, purgedAt *time.Time) {
+	if !info.deletionDueAt.IsZero() {
+		due := info.deletionDueAt
+		dueAt = &due
+	}
+	if !info.purgedAt.IsZero() {
+		purged := info.purgedAt
+		purgedAt = &purged
+	}
+	return dueAt, purgedAt
+}
+
+// setDeletionTimes sets the account's times from a StoredAccount's DeletionDueAt and PurgedAt.
+func (info *accountInfo) setDeletionTimes(dueAt *time.Time, purgedAt *time.Time) {
+	if dueAt != nil {
+		info.deletionDueAt = *dueAt
+	}
+	if purgedAt != nil {
+		info.purgedAt = *purgedAt
+	}
+}
@@ -0,0 +1,83 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/accounts/tokens"
+)
+
+// See the docs on interfaces in store.go
+func (s *InMemoryStore) RequestEmailChange(ctx context.Context, id int64, password, newEmail, code string) (accounts.Account, error) {
+	s.mutex.RLock()
+	info := s.unpurgedByID(id)
+	var email, hash string
+	if info != nil {
+		email, hash = info.account.Email, info.passwordHash
+	}
+	s.mutex.RUnlock()
+	if info == nil {
+		return accounts.Account{}, accounts.AccountNotExistsError{}
+	}
+	if err := s.checkPassword(ctx, password, hash); err != nil {
+		return accounts.Account{}, err
+	}
+	if newEmail == email {
+		return accounts.Account{}, accounts.EmailExistsError{Email: newEmail}
+	}
+	if err := s.checkSecondFactor(ctx, id, code); err != nil {
+		return accounts.Account{}, err
+	}
+	token, err := tokens.NewVerificationToken(20)
+	if err != nil {
+		return accounts.Account{}, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	info = s.unpurgedByID(id)
+	// If the password changed while this was checking it, it isn't right anymore.
+	if info == nil || info.passwordHash != hash {
+		return accounts.Account{}, accounts.InvalidPasswordError{}
+	}
+	info.newEmail = newEmail
+	info.emailChangeTokenHash = tokens.Hash(token)
+	info.emailChangeTokenExpiry = time.Now().Add(s.expiry.Verification)
+	account := accounts.Account{
+		ID:               id,
+		Email:            newEmail,
+		EmailChangeToken: token,
+	}
+	s.queue(accounts.QueuedEmail{Kind: accounts.EmailKindEmailChange, Account: account})
+	s.queue(accounts.QueuedEmail{Kind: accounts.EmailKindEmailChangeNotice, Account: info.account})
+	return account, nil
+}
+
+// See the docs on interfaces in store.go
+func (s *InMemoryStore) ConfirmEmailChange(ctx context.Context, id int64, token string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	info := s.byID(id)
+	if info == nil {
+		return accounts.AccountNotExistsError{}
+	}
+	if token == "" || info.emailChangeTokenHash == "" || time.Now().After(info.emailChangeTokenExpiry) || !tokens.Matches(token, info.emailChangeTokenHash) {
+		return accounts.InvalidEmailChangeTokenError{}
+	}
+	if _, taken := s.accounts[info.newEmail]; taken {
+		return accounts.EmailExistsError{Email: info.newEmail}
+	}
+	delete(s.accounts, info.account.Email)
+	info.account.Email = info.newEmail
+	s.accounts[info.newEmail] = info
+	info.newEmail = ""
+	info.emailChangeTokenHash = ""
+	info.emailChangeTokenExpiry = time.Time{}
+	info.emailVerifiedAt = time.Now()
+	info.resetTokenHash = ""
+	info.resetTokenExpiry = time.Time{}
+	info.verificationTokenHash = ""
+	info.verificationTokenExpiry = time.Time{}
+	return nil
+}
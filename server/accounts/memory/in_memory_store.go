@@ -2,31 +2,134 @@ package memory
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/wikisophia/api/server/accounts"
 	"github.com/wikisophia/api/server/accounts/tokens"
+	"github.com/wikisophia/api/server/config"
+	"github.com/wikisophia/api/server/logging"
+	"github.com/wikisophia/api/server/passwords"
 )
 
 // NewMemoryStore makes an empty InMemoryStore with all its variables initialized.
+// It's safe for concurrent use. The only passwords it rejects are empty ones,
+// and it hashes them with cheap params so that tests stay fast.
+// Its tokens expire after the default config's times.
 func NewMemoryStore() *InMemoryStore {
+	defaults := config.Defaults().Tokens
+	return NewMemoryStoreWith(passwords.NewHasher(cheapHash), nonEmptyPolicy{}, tokens.Expiry{
+		Reset:        defaults.ResetExpiry(),
+		Verification: defaults.VerificationExpiry(),
+	})
+}
+
+// NewMemoryStoreWith makes an empty InMemoryStore which hashes passwords with hasher,
+// checks new ones against policy, and makes tokens which last as long as expiry says.
+func NewMemoryStoreWith(hasher Hasher, policy accounts.PasswordPolicy, expiry tokens.Expiry) *InMemoryStore {
+	missingPasswordHash, err := hasher.Hash(context.Background(), missingPassword)
+	if err != nil {
+		log.Fatalf("Failed to hash the password for missing accounts: %v", err)
+	}
 	return &InMemoryStore{
-		nextID:    1,
-		nextReset: 1,
-		accounts:  make(map[string]*accountInfo, 1),
+		nextID:              1,
+		nextEmailID:         1,
+		nextSessionID:       1,
+		accounts:            make(map[string]*accountInfo, 1),
+		hasher:              hasher,
+		policy:              policy,
+		expiry:              expiry,
+		missingPasswordHash: missingPasswordHash,
+	}
+}
+
+// cheapHash are the Argon2 params used by NewMemoryStore.
+var cheapHash = config.Hash{
+	Time:        1,
+	Memory:      1024,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   16,
+}
+
+// missingPassword is hashed to make InMemoryStore.missingPasswordHash.
+const missingPassword = "this account has no password"
+
+type Hasher interface {
+	// Hash a value to a string which encodes the algorithm + salt as well.
+	Hash(ctx context.Context, value string) (string, error)
+	// Check if the given value matches a hash.
+	Matches(ctx context.Context, value string, hash string) (bool, error)
+	// Check if a matching hash was made with an older algorithm or weaker params than Hash uses now.
+	NeedsRehash(hash string) bool
+}
+
+// nonEmptyPolicy only rejects empty passwords.
+type nonEmptyPolicy struct{}
+
+func (nonEmptyPolicy) Check(email, password string) error {
+	if password == "" {
+		return accounts.ProhibitedPasswordError{Reasons: []string{"must not be empty"}}
 	}
+	return nil
 }
 
 // InMemoryStore saves accounts in program memory.
 // This is mainly intended for testing and easier dev environment setups.
 type InMemoryStore struct {
-	nextID    int64
-	nextReset int64
-	accounts  map[string]*accountInfo
+	mutex    sync.RWMutex
+	nextID   int64
+	accounts map[string]*accountInfo
+	// outbox has the queued emails, ordered by ID. It isn't saved in snapshots, since the emails have tokens in them.
+	outbox      []*accounts.QueuedEmail
+	nextEmailID int64
+	hasher      Hasher
+	policy      accounts.PasswordPolicy
+	// expiry is how long each kind of token can be used for.
+	expiry tokens.Expiry
+	// missingPasswordHash is checked when someone logs into an account which doesn't exist, or has no password.
+	// That makes those logins take as long as ones with the wrong password, so the timing doesn't
+	// reveal which emails have accounts.
+	missingPasswordHash string
+	// sessions are ordered by ID. They aren't saved in snapshots either, since they're only a record of logins.
+	sessions      []*accounts.Session
+	nextSessionID int64
 }
 
 type accountInfo struct {
-	account  accounts.Account
-	password string
+	// account never has a ResetToken, VerificationToken or EmailChangeToken. Only their hashes are kept.
+	account                 accounts.Account
+	passwordHash            string
+	resetTokenHash          string
+	resetTokenExpiry        time.Time
+	emailVerifiedAt         time.Time
+	verificationTokenHash   string
+	verificationTokenExpiry time.Time
+	// newEmail is where the account will move once the emailChangeToken is used.
+	newEmail               string
+	emailChangeTokenHash   string
+	emailChangeTokenExpiry time.Time
+	failedLogins           int
+	lockedUntil            time.Time
+	displayName            string
+	bio                    string
+	preferences            json.RawMessage
+	deletionDueAt          time.Time
+	// purgedAt is set once the account is anonymized. Nothing else about it is kept.
+	purgedAt time.Time
+	// totpSecret is only set once two-factor auth is confirmed. Until then, the secret is in totpPendingSecret.
+	totpSecret         string
+	totpPendingSecret  string
+	totpLastStep       int64
+	recoveryCodeHashes []string
+	twoFactorRequired  bool
+	moderator          bool
 }
 
 // See the docs on interfaces in store.go
@@ -35,75 +138,569 @@ func (s *InMemoryStore) NewResetToken(ctx context.Context, email string) (accoun
 	if err != nil {
 		return accounts.Account{}, false, err
 	}
-	if accountInfo, ok := s.accounts[email]; ok {
-		accountInfo.account.ResetToken = token
-		s.nextReset++
-		return accountInfo.account, false, nil
+	verificationToken, err := tokens.NewVerificationToken(20)
+	if err != nil {
+		return accounts.Account{}, false, err
+	}
+	hash := tokens.Hash(token)
+	expiry := time.Now().Add(s.expiry.Reset)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	info, ok := s.accounts[email]
+	if !ok {
+		info = &accountInfo{
+			account: accounts.Account{
+				ID:    s.nextID,
+				Email: email,
+			},
+			verificationTokenHash:   tokens.Hash(verificationToken),
+			verificationTokenExpiry: time.Now().Add(s.expiry.Verification),
+		}
+		s.nextID++
+		s.accounts[email] = info
 	}
-
-	info := &accountInfo{
-		account: accounts.Account{
-			ID:         s.nextID,
-			Email:      email,
-			ResetToken: token,
-		},
-		password: "",
+	info.resetTokenHash = hash
+	info.resetTokenExpiry = expiry
+	account := info.account
+	account.ResetToken = token
+	if ok {
+		s.queue(accounts.QueuedEmail{Kind: accounts.EmailKindReset, Account: account})
+	} else {
+		account.VerificationToken = verificationToken
+		s.queue(accounts.QueuedEmail{Kind: accounts.EmailKindWelcome, Account: account})
 	}
-	s.nextID++
-	s.accounts[email] = info
-	return info.account, true, nil
+	return account, !ok, nil
 }
 
 // See the docs on interfaces in store.go
 func (s *InMemoryStore) SetForgottenPassword(ctx context.Context, id int64, password, resetToken string) error {
-	if password == "" {
-		return accounts.ProhibitedPasswordError{}
-	}
 	if resetToken == "" {
 		return accounts.InvalidResetTokenError{}
 	}
 
-	for _, accountInfo := range s.accounts {
-		if accountInfo.account.ID == id {
-			if resetToken != accountInfo.account.ResetToken {
-				return accounts.InvalidResetTokenError{}
-			}
-			accountInfo.password = password
-			accountInfo.account.ResetToken = ""
-			return nil
-		}
+	s.mutex.RLock()
+	info := s.byID(id)
+	var email, storedHash string
+	var expiry time.Time
+	if info != nil {
+		email, storedHash, expiry = info.account.Email, info.resetTokenHash, info.resetTokenExpiry
+	}
+	s.mutex.RUnlock()
+	if info == nil {
+		return accounts.AccountNotExistsError{}
+	}
+	if storedHash == "" || time.Now().After(expiry) || !tokens.Matches(resetToken, storedHash) {
+		return accounts.InvalidResetTokenError{}
+	}
+	if err := s.policy.Check(email, password); err != nil {
+		return err
+	}
+	// Hash without holding the lock, since it's slow.
+	hash, err := s.hasher.Hash(ctx, password)
+	if err != nil {
+		return fmt.Errorf("failed to set password: %v", err)
 	}
-	return accounts.AccountNotExistsError{}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	info = s.byID(id)
+	// Someone else may have used or replaced the token while this was hashing.
+	if info == nil || info.resetTokenHash != storedHash {
+		return accounts.InvalidResetTokenError{}
+	}
+	info.passwordHash = hash
+	info.resetTokenHash = ""
+	info.resetTokenExpiry = time.Time{}
+	info.failedLogins = 0
+	info.lockedUntil = time.Time{}
+	return nil
 }
 
 // See the docs on interfaces in store.go
-func (s *InMemoryStore) ChangePassword(ctx context.Context, id int64, oldPassword, newPassword string) error {
-	if newPassword == "" {
-		return accounts.ProhibitedPasswordError{}
-	}
-	for _, accountInfo := range s.accounts {
-		if accountInfo.account.ID == id {
-			if oldPassword != accountInfo.password {
-				return accounts.InvalidPasswordError{}
-			}
-			accountInfo.password = newPassword
-			return nil
-		}
+func (s *InMemoryStore) ChangePassword(ctx context.Context, id int64, oldPassword, newPassword, code string) error {
+	s.mutex.RLock()
+	info := s.byID(id)
+	var email, oldHash string
+	if info != nil {
+		email, oldHash = info.account.Email, info.passwordHash
+	}
+	s.mutex.RUnlock()
+	if info == nil {
+		return accounts.AccountNotExistsError{}
+	}
+	if oldHash == "" {
+		return accounts.InvalidPasswordError{}
+	}
+	matches, err := s.hasher.Matches(ctx, oldPassword, oldHash)
+	if err != nil {
+		return fmt.Errorf("failed to change password: %v", err)
 	}
-	return accounts.AccountNotExistsError{}
+	if !matches {
+		return accounts.InvalidPasswordError{}
+	}
+	if err := s.policy.Check(email, newPassword); err != nil {
+		return err
+	}
+	if err := s.checkSecondFactor(ctx, id, code); err != nil {
+		return err
+	}
+	newHash, err := s.hasher.Hash(ctx, newPassword)
+	if err != nil {
+		return fmt.Errorf("failed to change password: %v", err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	info = s.byID(id)
+	// If the password changed while this was hashing, oldPassword isn't right anymore.
+	if info == nil || info.passwordHash != oldHash {
+		return accounts.InvalidPasswordError{}
+	}
+	info.passwordHash = newHash
+	// A reset token from before the change would undo it, so it stops working.
+	info.resetTokenHash = ""
+	info.resetTokenExpiry = time.Time{}
+	return nil
 }
 
 // See the docs on interfaces in store.go
 func (s *InMemoryStore) Authenticate(ctx context.Context, email, password string) (int64, error) {
-	userInfo, ok := s.accounts[email]
+	s.mutex.RLock()
+	info, ok := s.accounts[email]
+	var id int64
+	var hash string
+	if ok {
+		id, hash = info.account.ID, info.passwordHash
+	}
+	s.mutex.RUnlock()
 	if !ok {
-		return -1, accounts.AccountNotExistsError{email}
+		s.hasher.Matches(ctx, password, s.missingPasswordHash)
+		return -1, accounts.AccountNotExistsError{Email: email}
 	}
-	if userInfo.password == "" {
+	if hash == "" {
+		s.hasher.Matches(ctx, password, s.missingPasswordHash)
 		return -1, accounts.InvalidPasswordError{}
 	}
-	if userInfo.password != password {
+
+	match, err := s.hasher.Matches(ctx, password, hash)
+	if err != nil {
+		return -1, accounts.CorruptedPasswordError{Email: email}
+	}
+	if !match {
 		return -1, accounts.InvalidPasswordError{}
 	}
-	return userInfo.account.ID, nil
+	if s.hasher.NeedsRehash(hash) {
+		if err := s.rehash(ctx, id, password, hash); err != nil {
+			// The login is still valid, so just try again next time.
+			logging.FromContext(ctx).Warn("failed to rehash password", slog.Int64("account_id", id), slog.Any("error", err))
+		}
+	}
+	return id, nil
+}
+
+// rehash replaces oldHash with a new hash of the password, made with the hasher's current params.
+// It does nothing if the password changed in the meantime.
+func (s *InMemoryStore) rehash(ctx context.Context, id int64, password, oldHash string) error {
+	newHash, err := s.hasher.Hash(ctx, password)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if info := s.byID(id); info != nil && info.passwordHash == oldHash {
+		info.passwordHash = newHash
+	}
+	return nil
+}
+
+// See the docs on interfaces in store.go
+func (s *InMemoryStore) LoginFailures(ctx context.Context, email string) (accounts.LoginFailures, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	info, ok := s.accounts[email]
+	if !ok {
+		return accounts.LoginFailures{}, accounts.AccountNotExistsError{Email: email}
+	}
+	return accounts.LoginFailures{
+		AccountID:   info.account.ID,
+		Count:       info.failedLogins,
+		LockedUntil: info.lockedUntil,
+	}, nil
+}
+
+// See the docs on interfaces in store.go
+func (s *InMemoryStore) RecordLoginFailure(ctx context.Context, id int64) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	info := s.byID(id)
+	if info == nil {
+		return 0, accounts.AccountNotExistsError{}
+	}
+	info.failedLogins++
+	return info.failedLogins, nil
+}
+
+// See the docs on interfaces in store.go
+func (s *InMemoryStore) LockAccount(ctx context.Context, id int64, until time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	info := s.byID(id)
+	if info == nil {
+		return accounts.AccountNotExistsError{}
+	}
+	info.lockedUntil = until
+	return nil
+}
+
+// See the docs on interfaces in store.go
+func (s *InMemoryStore) ClearLoginFailures(ctx context.Context, id int64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	info := s.byID(id)
+	if info == nil {
+		return accounts.AccountNotExistsError{}
+	}
+	info.failedLogins = 0
+	info.lockedUntil = time.Time{}
+	return nil
+}
+
+// See the docs on interfaces in store.go
+func (s *InMemoryStore) NewVerificationToken(ctx context.Context, email string) (accounts.Account, error) {
+	token, err := tokens.NewVerificationToken(20)
+	if err != nil {
+		return accounts.Account{}, err
+	}
+	hash := tokens.Hash(token)
+	expiry := time.Now().Add(s.expiry.Verification)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	info, ok := s.accounts[email]
+	if !ok {
+		return accounts.Account{}, accounts.AccountNotExistsError{Email: email}
+	}
+	if !info.emailVerifiedAt.IsZero() {
+		return accounts.Account{}, accounts.EmailAlreadyVerifiedError{Email: email}
+	}
+	info.verificationTokenHash = hash
+	info.verificationTokenExpiry = expiry
+	account := info.account
+	account.VerificationToken = token
+	s.queue(accounts.QueuedEmail{Kind: accounts.EmailKindVerification, Account: account})
+	return account, nil
+}
+
+// See the docs on interfaces in store.go
+func (s *InMemoryStore) VerifyEmail(ctx context.Context, id int64, token string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	info := s.byID(id)
+	if info == nil {
+		return accounts.AccountNotExistsError{}
+	}
+	if token == "" || info.verificationTokenHash == "" || time.Now().After(info.verificationTokenExpiry) || !tokens.Matches(token, info.verificationTokenHash) {
+		return accounts.InvalidVerificationTokenError{}
+	}
+	info.emailVerifiedAt = time.Now()
+	info.verificationTokenHash = ""
+	info.verificationTokenExpiry = time.Time{}
+	return nil
+}
+
+// See the docs on interfaces in store.go
+func (s *InMemoryStore) EmailVerifiedAt(ctx context.Context, id int64) (time.Time, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	info := s.byID(id)
+	if info == nil || !info.purgedAt.IsZero() {
+		return time.Time{}, accounts.AccountNotExistsError{}
+	}
+	return info.emailVerifiedAt, nil
+}
+
+// byID finds the account with this ID, or returns nil if there isn't one.
+// Callers must hold the mutex.
+func (s *InMemoryStore) byID(id int64) *accountInfo {
+	for _, info := range s.accounts {
+		if info.account.ID == id {
+			return info
+		}
+	}
+	return nil
+}
+
+// unpurgedByID works like byID, but returns nil for purged accounts too. Callers must hold the mutex.
+func (s *InMemoryStore) unpurgedByID(id int64) *accountInfo {
+	info := s.byID(id)
+	if info == nil || !info.purgedAt.IsZero() {
+		return nil
+	}
+	return info
+}
+
+// checkPassword returns an InvalidPasswordError unless the password matches the hash.
+// Accounts without a password take as long to check as the ones with one.
+// The lock must not be held, since this is slow.
+func (s *InMemoryStore) checkPassword(ctx context.Context, password, hash string) error {
+	if hash == "" {
+		s.hasher.Matches(ctx, password, s.missingPasswordHash)
+		return accounts.InvalidPasswordError{}
+	}
+	matches, err := s.hasher.Matches(ctx, password, hash)
+	if err != nil {
+		return fmt.Errorf("failed to check password: %v", err)
+	}
+	if !matches {
+		return accounts.InvalidPasswordError{}
+	}
+	return nil
+}
+
+// See the docs on interfaces in store.go
+func (s *InMemoryStore) ExportAccounts(ctx context.Context) ([]accounts.StoredAccount, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	exported := make([]accounts.StoredAccount, 0, len(s.accounts))
+	for _, info := range s.accounts {
+		account := accounts.StoredAccount{
+			ID:           info.account.ID,
+			Email:        info.account.Email,
+			PasswordHash: info.passwordHash,
+			DisplayName:  info.displayName,
+			Bio:          info.bio,
+			Preferences:  info.preferences,
+		}
+		if !info.emailVerifiedAt.IsZero() {
+			verifiedAt := info.emailVerifiedAt
+			account.EmailVerifiedAt = &verifiedAt
+		}
+		account.DeletionDueAt, account.PurgedAt = info.deletionTimes()
+		account.TwoFactorSecret = info.totpSecret
+		account.TwoFactorLastStep = info.totpLastStep
+		account.RecoveryCodeHashes = info.recoveryCodeHashes
+		account.TwoFactorRequired = info.twoFactorRequired
+		account.Moderator = info.moderator
+		exported = append(exported, account)
+	}
+	sort.Slice(exported, func(i, j int) bool {
+		return exported[i].ID < exported[j].ID
+	})
+	return exported, nil
+}
+
+// See the docs on interfaces in store.go
+func (s *InMemoryStore) ImportAccounts(ctx context.Context, imported []accounts.StoredAccount) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(s.accounts) > 0 {
+		return accounts.StoreNotEmptyError{}
+	}
+	// Everything is checked before anything is saved, so that a bad import leaves the store empty.
+	infos := make(map[string]*accountInfo, len(imported))
+	ids := make(map[int64]bool, len(imported))
+	nextID := s.nextID
+	for _, account := range imported {
+		if _, ok := infos[account.Email]; ok {
+			return accounts.EmailExistsError{Email: account.Email}
+		}
+		if ids[account.ID] {
+			return fmt.Errorf("an account with ID %d already exists", account.ID)
+		}
+		info := &accountInfo{
+			account: accounts.Account{
+				ID:    account.ID,
+				Email: account.Email,
+			},
+			passwordHash:       account.PasswordHash,
+			displayName:        account.DisplayName,
+			bio:                account.Bio,
+			preferences:        account.Preferences,
+			totpSecret:         account.TwoFactorSecret,
+			totpLastStep:       account.TwoFactorLastStep,
+			recoveryCodeHashes: account.RecoveryCodeHashes,
+			twoFactorRequired:  account.TwoFactorRequired,
+			moderator:          account.Moderator,
+		}
+		if account.EmailVerifiedAt != nil {
+			info.emailVerifiedAt = *account.EmailVerifiedAt
+		}
+		info.setDeletionTimes(account.DeletionDueAt, account.PurgedAt)
+		infos[account.Email] = info
+		ids[account.ID] = true
+		if account.ID >= nextID {
+			nextID = account.ID + 1
+		}
+	}
+	s.accounts = infos
+	s.nextID = nextID
+	return nil
+}
+
+// WriteSnapshot writes everything in the store to w, so that ReadSnapshot can restore it later.
+// Unlike ExportAccounts, this includes the outstanding tokens and failed logins.
+func (s *InMemoryStore) WriteSnapshot(w io.Writer) error {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	saved := snapshot{
+		NextID:   s.nextID,
+		Accounts: make([]snapshotAccount, 0, len(s.accounts)),
+	}
+	for _, info := range s.accounts {
+		account := snapshotAccount{
+			ID:           info.account.ID,
+			Email:        info.account.Email,
+			PasswordHash: info.passwordHash,
+			FailedLogins: info.failedLogins,
+			DisplayName:  info.displayName,
+			Bio:          info.bio,
+			Preferences:  info.preferences,
+		}
+		if info.resetTokenHash != "" {
+			expiry := info.resetTokenExpiry
+			account.ResetTokenHash = info.resetTokenHash
+			account.ResetTokenExpiry = &expiry
+		}
+		if !info.emailVerifiedAt.IsZero() {
+			verifiedAt := info.emailVerifiedAt
+			account.EmailVerifiedAt = &verifiedAt
+		}
+		if info.verificationTokenHash != "" {
+			expiry := info.verificationTokenExpiry
+			account.VerificationTokenHash = info.verificationTokenHash
+			account.VerificationTokenExpiry = &expiry
+		}
+		if !info.lockedUntil.IsZero() {
+			lockedUntil := info.lockedUntil
+			account.LockedUntil = &lockedUntil
+		}
+		if info.emailChangeTokenHash != "" {
+			expiry := info.emailChangeTokenExpiry
+			account.NewEmail = info.newEmail
+			account.EmailChangeTokenHash = info.emailChangeTokenHash
+			account.EmailChangeTokenExpiry = &expiry
+		}
+		account.DeletionDueAt, account.PurgedAt = info.deletionTimes()
+		account.TwoFactorSecret = info.totpSecret
+		account.TwoFactorPendingSecret = info.totpPendingSecret
+		account.TwoFactorLastStep = info.totpLastStep
+		account.RecoveryCodeHashes = info.recoveryCodeHashes
+		account.TwoFactorRequired = info.twoFactorRequired
+		account.Moderator = info.moderator
+		saved.Accounts = append(saved.Accounts, account)
+	}
+	sort.Slice(saved.Accounts, func(i, j int) bool {
+		return saved.Accounts[i].ID < saved.Accounts[j].ID
+	})
+	return json.NewEncoder(w).Encode(saved)
+}
+
+// ReadSnapshot replaces everything in the store with the data from a WriteSnapshot call.
+func (s *InMemoryStore) ReadSnapshot(r io.Reader) error {
+	var read snapshot
+	if err := json.NewDecoder(r).Decode(&read); err != nil {
+		return fmt.Errorf("failed to read accounts snapshot: %v", err)
+	}
+	loaded := make(map[string]*accountInfo, len(read.Accounts))
+	nextID := read.NextID
+	if nextID < 1 {
+		nextID = 1
+	}
+	for _, account := range read.Accounts {
+		info := &accountInfo{
+			account: accounts.Account{
+				ID:    account.ID,
+				Email: account.Email,
+			},
+			passwordHash:          account.PasswordHash,
+			resetTokenHash:        account.ResetTokenHash,
+			verificationTokenHash: account.VerificationTokenHash,
+			newEmail:              account.NewEmail,
+			emailChangeTokenHash:  account.EmailChangeTokenHash,
+			failedLogins:          account.FailedLogins,
+			displayName:           account.DisplayName,
+			bio:                   account.Bio,
+			preferences:           account.Preferences,
+			totpSecret:            account.TwoFactorSecret,
+			totpPendingSecret:     account.TwoFactorPendingSecret,
+			totpLastStep:          account.TwoFactorLastStep,
+			recoveryCodeHashes:    account.RecoveryCodeHashes,
+			twoFactorRequired:     account.TwoFactorRequired,
+			moderator:             account.Moderator,
+		}
+		if account.ResetTokenExpiry != nil {
+			info.resetTokenExpiry = *account.ResetTokenExpiry
+		}
+		if account.EmailVerifiedAt != nil {
+			info.emailVerifiedAt = *account.EmailVerifiedAt
+		}
+		if account.VerificationTokenExpiry != nil {
+			info.verificationTokenExpiry = *account.VerificationTokenExpiry
+		}
+		if account.Password != "" {
+			// Snapshots from before the InMemoryStore hashed passwords have the raw ones.
+			hash, err := s.hasher.Hash(context.Background(), account.Password)
+			if err != nil {
+				return fmt.Errorf("failed to hash the password of account %d: %v", account.ID, err)
+			}
+			info.passwordHash = hash
+		}
+		if account.LockedUntil != nil {
+			info.lockedUntil = *account.LockedUntil
+		}
+		if account.EmailChangeTokenExpiry != nil {
+			info.emailChangeTokenExpiry = *account.EmailChangeTokenExpiry
+		}
+		info.setDeletionTimes(account.DeletionDueAt, account.PurgedAt)
+		loaded[account.Email] = info
+		if account.ID >= nextID {
+			nextID = account.ID + 1
+		}
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.accounts = loaded
+	s.nextID = nextID
+	return nil
+}
+
+// snapshot is the file format used by WriteSnapshot and ReadSnapshot.
+type snapshot struct {
+	NextID   int64             `json:"nextId"`
+	Accounts []snapshotAccount `json:"accounts"`
+}
+
+// snapshotAccount is one account in a snapshot.
+// Older snapshots had a raw "resetToken" too. It's ignored, so those tokens can't be used anymore.
+type snapshotAccount struct {
+	ID               int64      `json:"id"`
+	Email            string     `json:"email"`
+	PasswordHash     string     `json:"passwordHash,omitempty"`
+	ResetTokenHash   string     `json:"resetTokenHash,omitempty"`
+	ResetTokenExpiry *time.Time `json:"resetTokenExpiry,omitempty"`
+	EmailVerifiedAt  *time.Time `json:"emailVerifiedAt,omitempty"`
+
+	VerificationTokenHash   string     `json:"verificationTokenHash,omitempty"`
+	VerificationTokenExpiry *time.Time `json:"verificationTokenExpiry,omitempty"`
+	// Password is only set in snapshots from before the InMemoryStore hashed passwords.
+	Password     string     `json:"password,omitempty"`
+	FailedLogins int        `json:"failedLogins,omitempty"`
+	LockedUntil  *time.Time `json:"lockedUntil,omitempty"`
+
+	NewEmail               string     `json:"newEmail,omitempty"`
+	EmailChangeTokenHash   string     `json:"emailChangeTokenHash,omitempty"`
+	EmailChangeTokenExpiry *time.Time `json:"emailChangeTokenExpiry,omitempty"`
+
+	DisplayName string          `json:"displayName,omitempty"`
+	Bio         string          `json:"bio,omitempty"`
+	Preferences json.RawMessage `json:"preferences,omitempty"`
+
+	DeletionDueAt *time.Time `json:"deletionDueAt,omitempty"`
+	PurgedAt      *time.Time `json:"purgedAt,omitempty"`
+
+	TwoFactorSecret        string   `json:"twoFactorSecret,omitempty"`
+	TwoFactorPendingSecret string   `json:"twoFactorPendingSecret,omitempty"`
+	TwoFactorLastStep      int64    `json:"twoFactorLastStep,omitempty"`
+	RecoveryCodeHashes     []string `json:"recoveryCodeHashes,omitempty"`
+	TwoFactorRequired      bool     `json:"twoFactorRequired,omitempty"`
+	Moderator              bool     `json:"moderator,omitempty"`
 }
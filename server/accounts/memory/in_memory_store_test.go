@@ -1,12 +1,20 @@
 package memory_test
 
 import (
+	"bytes"
+	"context"
 	"testing"
+	"time"
 
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 	"github.com/wikisophia/api/server/accounts"
 	"github.com/wikisophia/api/server/accounts/memory"
 	"github.com/wikisophia/api/server/accounts/storetest"
+	"github.com/wikisophia/api/server/accounts/tokens"
+	"github.com/wikisophia/api/server/config"
+	"github.com/wikisophia/api/server/passwords"
 )
 
 // TestInMemoryStore makes sure that the inMemoryStore is consistent with the StoreTests suite.
@@ -20,3 +28,156 @@ func TestInMemoryStore(t *testing.T) {
 		},
 	})
 }
+
+// TestInMemoryStorePolicy makes sure that the inMemoryStore is consistent with the PolicyTests suite.
+func TestInMemoryStorePolicy(t *testing.T) {
+	suite.Run(t, &storetest.PolicyTests{
+		StoreFactory: func(policy accounts.PasswordPolicy) accounts.Store {
+			return memory.NewMemoryStoreWith(cheapHasher, policy, hourExpiry)
+		},
+	})
+}
+
+// TestInMemoryStoreTiming makes sure that the inMemoryStore is consistent with the TimingTests suite.
+func TestInMemoryStoreTiming(t *testing.T) {
+	policy, err := passwords.NewPolicy(*config.Defaults().PasswordPolicy)
+	require.NoError(t, err)
+	suite.Run(t, &storetest.TimingTests{
+		StoreFactory: func(hasher *storetest.RecordingHasher) accounts.Store {
+			return memory.NewMemoryStoreWith(hasher, policy, hourExpiry)
+		},
+		Hasher: cheapHasher,
+	})
+}
+
+// TestInMemoryStoreHashing makes sure that the inMemoryStore is consistent with the HashingTests suite.
+func TestInMemoryStoreHashing(t *testing.T) {
+	policy, err := passwords.NewPolicy(*config.Defaults().PasswordPolicy)
+	require.NoError(t, err)
+	stronger := cheapHash
+	stronger.Time++
+	suite.Run(t, &storetest.HashingTests{
+		StoreFactory: func(hasher *storetest.RecordingHasher) accounts.Store {
+			return memory.NewMemoryStoreWith(hasher, policy, hourExpiry)
+		},
+		Weak:   cheapHasher,
+		Strong: passwords.NewHasher(stronger),
+	})
+}
+
+// TestInMemoryStoreResetTokens makes sure that the inMemoryStore is consistent with the ResetTokenTests suite.
+func TestInMemoryStoreResetTokens(t *testing.T) {
+	policy, err := passwords.NewPolicy(*config.Defaults().PasswordPolicy)
+	require.NoError(t, err)
+	suite.Run(t, &storetest.ResetTokenTests{
+		StoreFactory: func(resetTokenExpiry time.Duration) accounts.Store {
+			return memory.NewMemoryStoreWith(cheapHasher, policy, tokens.Expiry{Reset: resetTokenExpiry, Verification: time.Hour})
+		},
+	})
+}
+
+// TestInMemoryStoreVerification makes sure that the inMemoryStore is consistent with the VerificationTests suite.
+func TestInMemoryStoreVerification(t *testing.T) {
+	policy, err := passwords.NewPolicy(*config.Defaults().PasswordPolicy)
+	require.NoError(t, err)
+	suite.Run(t, &storetest.VerificationTests{
+		StoreFactory: func(expiry tokens.Expiry) accounts.Store {
+			return memory.NewMemoryStoreWith(cheapHasher, policy, expiry)
+		},
+	})
+}
+
+// TestInMemoryStoreEmailChange makes sure that the inMemoryStore is consistent with the EmailChangeTests suite.
+func TestInMemoryStoreEmailChange(t *testing.T) {
+	policy, err := passwords.NewPolicy(*config.Defaults().PasswordPolicy)
+	require.NoError(t, err)
+	suite.Run(t, &storetest.EmailChangeTests{
+		StoreFactory: func(expiry tokens.Expiry) accounts.Store {
+			return memory.NewMemoryStoreWith(cheapHasher, policy, expiry)
+		},
+	})
+}
+
+// TestInMemoryStoreProfile makes sure that the inMemoryStore is consistent with the ProfileTests suite.
+func TestInMemoryStoreProfile(t *testing.T) {
+	suite.Run(t, &storetest.ProfileTests{
+		StoreFactory: func() accounts.Store {
+			return memory.NewMemoryStore()
+		},
+	})
+}
+
+// TestInMemoryStoreDeletion makes sure that the inMemoryStore is consistent with the DeletionTests suite.
+func TestInMemoryStoreDeletion(t *testing.T) {
+	suite.Run(t, &storetest.DeletionTests{
+		StoreFactory: func() accounts.Store {
+			return memory.NewMemoryStore()
+		},
+	})
+}
+
+// TestInMemoryStoreTwoFactor makes sure that the inMemoryStore is consistent with the TwoFactorTests suite.
+func TestInMemoryStoreTwoFactor(t *testing.T) {
+	suite.Run(t, &storetest.TwoFactorTests{
+		StoreFactory: func() accounts.Store {
+			return memory.NewMemoryStore()
+		},
+	})
+}
+
+// TestInMemoryStoreSessions makes sure that the inMemoryStore is consistent with the SessionTests suite.
+func TestInMemoryStoreSessions(t *testing.T) {
+	suite.Run(t, &storetest.SessionTests{
+		StoreFactory: func() accounts.Store {
+			return memory.NewMemoryStore()
+		},
+	})
+}
+
+// TestInMemoryStoreOutbox makes sure that the inMemoryStore is consistent with the OutboxTests suite.
+func TestInMemoryStoreOutbox(t *testing.T) {
+	suite.Run(t, &storetest.OutboxTests{
+		StoreFactory: func() accounts.Store {
+			return memory.NewMemoryStore()
+		},
+	})
+}
+
+// TestSnapshotRoundTrip makes sure that a store read from a snapshot carries on where the old one left off.
+func TestSnapshotRoundTrip(t *testing.T) {
+	policy, err := passwords.NewPolicy(*config.Defaults().PasswordPolicy)
+	require.NoError(t, err)
+	store := memory.NewMemoryStoreWith(cheapHasher, policy, hourExpiry)
+	account, _, err := store.NewResetToken(context.Background(), "old@soph.wiki")
+	require.NoError(t, err)
+	require.NoError(t, store.SetForgottenPassword(context.Background(), account.ID, "some-password", account.ResetToken))
+	change, err := store.RequestEmailChange(context.Background(), account.ID, "some-password", "new@soph.wiki", "")
+	require.NoError(t, err)
+
+	var snapshot bytes.Buffer
+	require.NoError(t, store.WriteSnapshot(&snapshot))
+	restored := memory.NewMemoryStoreWith(cheapHasher, policy, hourExpiry)
+	require.NoError(t, restored.ReadSnapshot(&snapshot))
+
+	id, err := restored.Authenticate(context.Background(), "old@soph.wiki", "some-password")
+	require.NoError(t, err)
+	assert.Equal(t, account.ID, id)
+	require.NoError(t, restored.ConfirmEmailChange(context.Background(), account.ID, change.EmailChangeToken))
+	profile, err := restored.AccountProfile(context.Background(), account.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "new@soph.wiki", profile.Email)
+}
+
+// Cheap hashing params keep the suites fast. The hash strength isn't what's being tested.
+var cheapHash = config.Hash{
+	Time:        1,
+	Memory:      1024,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   16,
+}
+
+var cheapHasher = passwords.NewHasher(cheapHash)
+
+// hourExpiry keeps tokens valid for the whole test.
+var hourExpiry = tokens.Expiry{Reset: time.Hour, Verification: time.Hour}
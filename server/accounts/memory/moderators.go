@@ -0,0 +1,33 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/wikisophia/api/server/accounts"
+)
+
+// See the docs on interfaces in store.go
+func (s *InMemoryStore) SetModerator(ctx context.Context, id int64, moderator bool) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	info := s.unpurgedByID(id)
+	if info == nil {
+		return accounts.AccountNotExistsError{}
+	}
+	info.moderator = moderator
+	if moderator {
+		info.twoFactorRequired = true
+	}
+	return nil
+}
+
+// See the docs on interfaces in store.go
+func (s *InMemoryStore) IsModerator(ctx context.Context, id int64) (bool, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	info := s.unpurgedByID(id)
+	if info == nil {
+		return false, accounts.AccountNotExistsError{}
+	}
+	return info.moderator, nil
+}
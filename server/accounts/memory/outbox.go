@@ -0,0 +1,178 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/accounts/tokens"
+)
+
+// See the docs on interfaces in store.go
+func (s *InMemoryStore) QueueEmail(ctx context.Context, email accounts.QueuedEmail) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.queue(email)
+	return nil
+}
+
+// queue adds the email to the outbox, due right away. Callers must hold the mutex.
+func (s *InMemoryStore) queue(email accounts.QueuedEmail) {
+	now := time.Now()
+	s.outbox = append(s.outbox, &accounts.QueuedEmail{
+		ID:            s.nextEmailID,
+		Kind:          email.Kind,
+		Account:       email.Account,
+		LockedUntil:   email.LockedUntil,
+		CreatedAt:     now,
+		NextAttemptAt: now,
+	})
+	s.nextEmailID++
+}
+
+// See the docs on interfaces in store.go
+func (s *InMemoryStore) ClaimEmails(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]accounts.QueuedEmail, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	claimed := make([]accounts.QueuedEmail, 0, limit)
+	for _, email := range s.outbox {
+		if len(claimed) == limit {
+			break
+		}
+		if email.DeadAt.IsZero() && !email.NextAttemptAt.After(now) {
+			email.NextAttemptAt = now.Add(lease)
+			claimed = append(claimed, *email)
+		}
+	}
+	return claimed, nil
+}
+
+// See the docs on interfaces in store.go
+func (s *InMemoryStore) EmailSent(ctx context.Context, id int64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i, email := range s.outbox {
+		if email.ID == id {
+			s.outbox = append(s.outbox[:i], s.outbox[i+1:]...)
+			return nil
+		}
+	}
+	return accounts.QueuedEmailNotExistsError{ID: id}
+}
+
+// See the docs on interfaces in store.go
+func (s *InMemoryStore) EmailFailed(ctx context.Context, id int64, reason string, retryAt time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	email := s.queuedEmail(id)
+	if email == nil {
+		return accounts.QueuedEmailNotExistsError{ID: id}
+	}
+	email.Attempts++
+	email.LastError = reason
+	if retryAt.IsZero() {
+		email.DeadAt = time.Now()
+		email.Account = accounts.Account{ID: email.Account.ID, Email: email.Account.Email}
+	} else {
+		email.NextAttemptAt = retryAt
+	}
+	return nil
+}
+
+// See the docs on interfaces in store.go
+func (s *InMemoryStore) FailedEmails(ctx context.Context) ([]accounts.QueuedEmail, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	failed := make([]accounts.QueuedEmail, 0)
+	for _, email := range s.outbox {
+		if email.Attempts > 0 {
+			failed = append(failed, *email)
+		}
+	}
+	return failed, nil
+}
+
+// See the docs on interfaces in store.go
+func (s *InMemoryStore) RetryEmail(ctx context.Context, id int64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	email := s.queuedEmail(id)
+	if email == nil {
+		return accounts.QueuedEmailNotExistsError{ID: id}
+	}
+	if !email.DeadAt.IsZero() {
+		account, err := s.renewTokens(*email)
+		if err != nil {
+			return err
+		}
+		email.Account = account
+	}
+	email.Attempts = 0
+	email.DeadAt = time.Time{}
+	email.NextAttemptAt = time.Now()
+	return nil
+}
+
+// renewTokens makes new tokens for a dead email, to replace the ones it lost, and returns its Account with them.
+// The tokens only go to the account's current email. Callers must hold the mutex.
+func (s *InMemoryStore) renewTokens(email accounts.QueuedEmail) (accounts.Account, error) {
+	account := email.Account
+	info := s.unpurgedByID(account.ID)
+	switch email.Kind {
+	case accounts.EmailKindWelcome, accounts.EmailKindReset:
+		if info == nil || info.account.Email != account.Email {
+			return accounts.Account{}, accounts.StaleQueuedEmailError{ID: email.ID}
+		}
+		resetToken, err := tokens.NewVerificationToken(20)
+		if err != nil {
+			return accounts.Account{}, err
+		}
+		verificationToken, err := tokens.NewVerificationToken(20)
+		if err != nil {
+			return accounts.Account{}, err
+		}
+		info.resetTokenHash = tokens.Hash(resetToken)
+		info.resetTokenExpiry = time.Now().Add(s.expiry.Reset)
+		account.ResetToken = resetToken
+		// Welcome emails only have a verification link if there's still something to verify.
+		if email.Kind == accounts.EmailKindWelcome && info.emailVerifiedAt.IsZero() {
+			info.verificationTokenHash = tokens.Hash(verificationToken)
+			info.verificationTokenExpiry = time.Now().Add(s.expiry.Verification)
+			account.VerificationToken = verificationToken
+		}
+	case accounts.EmailKindVerification:
+		if info == nil || info.account.Email != account.Email || !info.emailVerifiedAt.IsZero() {
+			return accounts.Account{}, accounts.StaleQueuedEmailError{ID: email.ID}
+		}
+		token, err := tokens.NewVerificationToken(20)
+		if err != nil {
+			return accounts.Account{}, err
+		}
+		info.verificationTokenHash = tokens.Hash(token)
+		info.verificationTokenExpiry = time.Now().Add(s.expiry.Verification)
+		account.VerificationToken = token
+	case accounts.EmailKindEmailChange:
+		if info == nil || info.newEmail != account.Email || info.emailChangeTokenHash == "" {
+			return accounts.Account{}, accounts.StaleQueuedEmailError{ID: email.ID}
+		}
+		token, err := tokens.NewVerificationToken(20)
+		if err != nil {
+			return accounts.Account{}, err
+		}
+		info.emailChangeTokenHash = tokens.Hash(token)
+		info.emailChangeTokenExpiry = time.Now().Add(s.expiry.Verification)
+		account.EmailChangeToken = token
+	}
+	return account, nil
+}
+
+// queuedEmail finds the email with this ID, or returns nil if there isn't one.
+// Callers must hold the mutex.
+func (s *InMemoryStore) queuedEmail(id int64) *accounts.QueuedEmail {
+	for _, email := range s.outbox {
+		if email.ID == id {
+			return email
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/wikisophia/api/server/accounts"
+)
+
+// See the docs on interfaces in store.go
+func (s *InMemoryStore) AccountProfile(ctx context.Context, id int64) (accounts.AccountProfile, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	info := s.byID(id)
+	if info == nil || !info.purgedAt.IsZero() {
+		return accounts.AccountProfile{}, accounts.AccountNotExistsError{}
+	}
+	return info.profile(), nil
+}
+
+// See the docs on interfaces in store.go
+func (s *InMemoryStore) UpdateProfile(ctx context.Context, id int64, update accounts.ProfileUpdate) (accounts.AccountProfile, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	info := s.byID(id)
+	if info == nil || !info.purgedAt.IsZero() {
+		return accounts.AccountProfile{}, accounts.AccountNotExistsError{}
+	}
+	if update.DisplayName != nil {
+		info.displayName = *update.DisplayName
+	}
+	if update.Bio != nil {
+		info.bio = *update.Bio
+	}
+	if update.Preferences != nil {
+		// Copy it, so the caller can't change the stored one by changing theirs.
+		info.preferences = append([]byte(nil), update.Preferences...)
+	}
+	return info.profile(), nil
+}
+
+// profile returns the account's profile. Callers must hold the mutex.
+func (info *accountInfo) profile() accounts.AccountProfile {
+	return accounts.AccountProfile{
+		ID:            info.account.ID,
+		Email:         info.account.Email,
+		DisplayName:   info.displayName,
+		Bio:           info.bio,
+		Preferences:   append([]byte(nil), info.preferences...),
+		DeletionDueAt: info.deletionDueAt,
+	}
+}
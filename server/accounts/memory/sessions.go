@@ -0,0 +1,63 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/wikisophia/api/server/accounts"
+)
+
+// See the docs on interfaces in store.go
+func (s *InMemoryStore) StartSession(ctx context.Context, accountID int64, client string, now time.Time) (accounts.Session, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.unpurgedByID(accountID) == nil {
+		return accounts.Session{}, accounts.AccountNotExistsError{}
+	}
+	session := &accounts.Session{
+		ID:         s.nextSessionID,
+		AccountID:  accountID,
+		IssuedAt:   now,
+		LastUsedAt: now,
+		Client:     accounts.TrimSessionClient(client),
+	}
+	s.nextSessionID++
+	s.sessions = append(s.sessions, session)
+	return *session, nil
+}
+
+// See the docs on interfaces in store.go
+func (s *InMemoryStore) SessionUsed(ctx context.Context, accountID int64, id int64, now time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, session := range s.sessions {
+		if session.ID == id && session.AccountID == accountID && !now.Before(session.LastUsedAt.Add(time.Minute)) {
+			session.LastUsedAt = now
+		}
+	}
+	return nil
+}
+
+// See the docs on interfaces in store.go
+func (s *InMemoryStore) AccountSessions(ctx context.Context, accountID int64) ([]accounts.Session, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	sessions := make([]accounts.Session, 0)
+	for _, session := range s.sessions {
+		if session.AccountID == accountID {
+			sessions = append(sessions, *session)
+		}
+	}
+	return sessions, nil
+}
+
+// dropSessions forgets the account's sessions. Callers must hold the mutex.
+func (s *InMemoryStore) dropSessions(accountID int64) {
+	kept := s.sessions[:0]
+	for _, session := range s.sessions {
+		if session.AccountID != accountID {
+			kept = append(kept, session)
+		}
+	}
+	s.sessions = kept
+}
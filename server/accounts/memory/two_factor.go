@@ -0,0 +1,274 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/accounts/totp"
+)
+
+// See the docs on interfaces in store.go
+func (s *InMemoryStore) EnrollTwoFactor(ctx context.Context, id int64, password string) (accounts.TwoFactorEnrollment, error) {
+	s.mutex.RLock()
+	info := s.unpurgedByID(id)
+	var email, hash string
+	var enabled bool
+	if info != nil {
+		email, hash, enabled = info.account.Email, info.passwordHash, info.totpSecret != ""
+	}
+	s.mutex.RUnlock()
+	if info == nil {
+		return accounts.TwoFactorEnrollment{}, accounts.AccountNotExistsError{}
+	}
+	if err := s.checkPassword(ctx, password, hash); err != nil {
+		return accounts.TwoFactorEnrollment{}, err
+	}
+	if enabled {
+		return accounts.TwoFactorEnrollment{}, accounts.TwoFactorEnabledError{}
+	}
+	secret, err := totp.NewSecret()
+	if err != nil {
+		return accounts.TwoFactorEnrollment{}, fmt.Errorf("failed to enroll in two-factor auth: %v", err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	info = s.unpurgedByID(id)
+	// If the password changed while this was checking it, it isn't right anymore.
+	if info == nil || info.passwordHash != hash {
+		return accounts.TwoFactorEnrollment{}, accounts.InvalidPasswordError{}
+	}
+	if info.totpSecret != "" {
+		return accounts.TwoFactorEnrollment{}, accounts.TwoFactorEnabledError{}
+	}
+	info.totpPendingSecret = secret
+	return accounts.TwoFactorEnrollment{
+		ID:     id,
+		Email:  email,
+		Secret: secret,
+	}, nil
+}
+
+// See the docs on interfaces in store.go
+func (s *InMemoryStore) ConfirmTwoFactor(ctx context.Context, id int64, code string) ([]string, error) {
+	s.mutex.RLock()
+	info := s.unpurgedByID(id)
+	var pending string
+	var enabled bool
+	if info != nil {
+		pending, enabled = info.totpPendingSecret, info.totpSecret != ""
+	}
+	s.mutex.RUnlock()
+	if info == nil {
+		return nil, accounts.AccountNotExistsError{}
+	}
+	if enabled {
+		return nil, accounts.TwoFactorEnabledError{}
+	}
+	if pending == "" {
+		return nil, accounts.TwoFactorNotEnrolledError{}
+	}
+	step, ok, err := totp.Validate(pending, code, time.Now(), 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to confirm two-factor auth: %v", err)
+	}
+	if !ok {
+		return nil, accounts.InvalidTwoFactorCodeError{}
+	}
+	// Hash without holding the lock, since it's slow.
+	codes, hashes, err := s.newRecoveryCodes(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to confirm two-factor auth: %v", err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	info = s.unpurgedByID(id)
+	// Someone else may have confirmed or replaced the secret while this was hashing.
+	if info == nil || info.totpPendingSecret != pending {
+		return nil, accounts.InvalidTwoFactorCodeError{}
+	}
+	info.totpSecret = pending
+	info.totpPendingSecret = ""
+	info.totpLastStep = step
+	info.recoveryCodeHashes = hashes
+	return codes, nil
+}
+
+// See the docs on interfaces in store.go
+func (s *InMemoryStore) CheckTwoFactor(ctx context.Context, id int64, code string) error {
+	s.mutex.RLock()
+	info := s.unpurgedByID(id)
+	var secret string
+	var lastStep int64
+	var hashes []string
+	if info != nil {
+		secret, lastStep, hashes = info.totpSecret, info.totpLastStep, info.recoveryCodeHashes
+	}
+	s.mutex.RUnlock()
+	if info == nil {
+		return accounts.AccountNotExistsError{}
+	}
+	if secret == "" {
+		return accounts.TwoFactorNotEnrolledError{}
+	}
+	return s.useTwoFactorCode(ctx, id, secret, lastStep, hashes, code)
+}
+
+// See the docs on interfaces in store.go
+func (s *InMemoryStore) DisableTwoFactor(ctx context.Context, id int64, password, code string) error {
+	s.mutex.RLock()
+	info := s.unpurgedByID(id)
+	var passwordHash, secret string
+	var lastStep int64
+	var hashes []string
+	var required bool
+	if info != nil {
+		passwordHash, secret, lastStep, hashes, required = info.passwordHash, info.totpSecret, info.totpLastStep, info.recoveryCodeHashes, info.twoFactorRequired
+	}
+	s.mutex.RUnlock()
+	if info == nil {
+		return accounts.AccountNotExistsError{}
+	}
+	if err := s.checkPassword(ctx, password, passwordHash); err != nil {
+		return err
+	}
+	if secret == "" {
+		return accounts.TwoFactorNotEnrolledError{}
+	}
+	// Check this before the code, so that the code isn't used up.
+	if required {
+		return accounts.TwoFactorRequiredError{}
+	}
+	if err := s.useTwoFactorCode(ctx, id, secret, lastStep, hashes, code); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	info = s.unpurgedByID(id)
+	if info == nil || info.passwordHash != passwordHash || info.totpSecret != secret {
+		return accounts.InvalidPasswordError{}
+	}
+	if info.twoFactorRequired {
+		return accounts.TwoFactorRequiredError{}
+	}
+	info.totpSecret = ""
+	info.totpPendingSecret = ""
+	info.totpLastStep = 0
+	info.recoveryCodeHashes = nil
+	return nil
+}
+
+// See the docs on interfaces in store.go
+func (s *InMemoryStore) TwoFactorStatus(ctx context.Context, id int64) (accounts.TwoFactorStatus, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	info := s.unpurgedByID(id)
+	if info == nil {
+		return accounts.TwoFactorStatus{}, accounts.AccountNotExistsError{}
+	}
+	return accounts.TwoFactorStatus{
+		Enabled:           info.totpSecret != "",
+		Required:          info.twoFactorRequired,
+		RecoveryCodesLeft: len(info.recoveryCodeHashes),
+	}, nil
+}
+
+// See the docs on interfaces in store.go
+func (s *InMemoryStore) RequireTwoFactor(ctx context.Context, id int64, required bool) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	info := s.unpurgedByID(id)
+	if info == nil {
+		return accounts.AccountNotExistsError{}
+	}
+	if !required && info.moderator {
+		return accounts.TwoFactorRequiredError{}
+	}
+	info.twoFactorRequired = required
+	return nil
+}
+
+// checkSecondFactor uses up the code if the account has two-factor auth on. Methods which need the password
+// call it once the password is known to be right.
+func (s *InMemoryStore) checkSecondFactor(ctx context.Context, id int64, code string) error {
+	s.mutex.RLock()
+	info := s.unpurgedByID(id)
+	var secret string
+	var lastStep int64
+	var hashes []string
+	if info != nil {
+		secret, lastStep, hashes = info.totpSecret, info.totpLastStep, info.recoveryCodeHashes
+	}
+	s.mutex.RUnlock()
+	if info == nil {
+		return accounts.AccountNotExistsError{}
+	}
+	if secret == "" {
+		return nil
+	}
+	if code == "" {
+		return accounts.TwoFactorCodeMissingError{}
+	}
+	return s.useTwoFactorCode(ctx, id, secret, lastStep, hashes, code)
+}
+
+// useTwoFactorCode checks the code against a TOTP secret and recovery code hashes which were read
+// from the account, and marks it used. The lock must not be held, since checking recovery codes is slow.
+func (s *InMemoryStore) useTwoFactorCode(ctx context.Context, id int64, secret string, lastStep int64, hashes []string, code string) error {
+	step, ok, err := totp.Validate(secret, code, time.Now(), lastStep)
+	if err != nil {
+		return fmt.Errorf("failed to check two-factor code: %v", err)
+	}
+	if ok {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		info := s.unpurgedByID(id)
+		// Someone else may have used this code, or a later one, in the meantime.
+		if info == nil || info.totpSecret != secret || info.totpLastStep >= step {
+			return accounts.InvalidTwoFactorCodeError{}
+		}
+		info.totpLastStep = step
+		return nil
+	}
+
+	matched, err := totp.MatchRecoveryCode(ctx, s.hasher, code, hashes)
+	if err != nil {
+		return fmt.Errorf("failed to check recovery code: %v", err)
+	}
+	if matched == "" {
+		return accounts.InvalidTwoFactorCodeError{}
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	info := s.unpurgedByID(id)
+	if info == nil {
+		return accounts.InvalidTwoFactorCodeError{}
+	}
+	for i, hash := range info.recoveryCodeHashes {
+		if hash == matched {
+			info.recoveryCodeHashes = append(info.recoveryCodeHashes[:i:i], info.recoveryCodeHashes[i+1:]...)
+			return nil
+		}
+	}
+	// Someone else used the code in the meantime.
+	return accounts.InvalidTwoFactorCodeError{}
+}
+
+// newRecoveryCodes makes a set of recovery codes, and their hashes.
+func (s *InMemoryStore) newRecoveryCodes(ctx context.Context) ([]string, []string, error) {
+	codes, err := totp.NewRecoveryCodes()
+	if err != nil {
+		return nil, nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		if hashes[i], err = totp.HashRecoveryCode(ctx, s.hasher, code); err != nil {
+			return nil, nil, err
+		}
+	}
+	return codes, hashes, nil
+}
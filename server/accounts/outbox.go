@@ -0,0 +1,38 @@
+package accounts
+
+import "time"
+
+// EmailKind says which email.Emailer method sends a QueuedEmail.
+type EmailKind string
+
+// The kinds of emails which can wait in an Outbox.
+const (
+	EmailKindWelcome      EmailKind = "welcome"
+	EmailKindReset        EmailKind = "reset"
+	EmailKindVerification EmailKind = "verification"
+	EmailKindLocked       EmailKind = "locked"
+	// EmailKindEmailChange goes to the email an account is moving to, with the token which confirms the move.
+	EmailKindEmailChange EmailKind = "email_change"
+	// EmailKindEmailChangeNotice tells the account's current email that a move was requested.
+	EmailKindEmailChangeNotice EmailKind = "email_change_notice"
+)
+
+// QueuedEmail is an email waiting in an Outbox.
+type QueuedEmail struct {
+	ID   int64
+	Kind EmailKind
+	// Account is who the email goes to, with the tokens it should contain.
+	// Those are only kept until the email is sent, or given up on.
+	Account Account
+	// LockedUntil is when the account unlocks. It's only set on EmailKindLocked emails.
+	LockedUntil time.Time
+	CreatedAt   time.Time
+	// Attempts counts the failed attempts to send the email.
+	Attempts int
+	// NextAttemptAt is when the email is due to be sent.
+	NextAttemptAt time.Time
+	// LastError says why the last attempt failed.
+	LastError string
+	// DeadAt is when the email was given up on. It's the zero Time if it'll still be retried.
+	DeadAt time.Time
+}
@@ -0,0 +1,44 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/wikisophia/api/server/accounts"
+)
+
+// Emailer queues emails in an Outbox rather than sending them, so that a Worker can retry them.
+// Use it for emails which aren't queued by the Store itself, like the ones about lockouts.
+type Emailer struct {
+	Outbox accounts.Outbox
+}
+
+// SendWelcome implements email.Emailer by queueing the email.
+func (e Emailer) SendWelcome(ctx context.Context, account accounts.Account) error {
+	return e.Outbox.QueueEmail(ctx, accounts.QueuedEmail{Kind: accounts.EmailKindWelcome, Account: account})
+}
+
+// SendReset implements email.Emailer by queueing the email.
+func (e Emailer) SendReset(ctx context.Context, account accounts.Account) error {
+	return e.Outbox.QueueEmail(ctx, accounts.QueuedEmail{Kind: accounts.EmailKindReset, Account: account})
+}
+
+// SendVerification implements email.Emailer by queueing the email.
+func (e Emailer) SendVerification(ctx context.Context, account accounts.Account) error {
+	return e.Outbox.QueueEmail(ctx, accounts.QueuedEmail{Kind: accounts.EmailKindVerification, Account: account})
+}
+
+// SendLocked implements email.Emailer by queueing the email.
+func (e Emailer) SendLocked(ctx context.Context, account accounts.Account, until time.Time) error {
+	return e.Outbox.QueueEmail(ctx, accounts.QueuedEmail{Kind: accounts.EmailKindLocked, Account: account, LockedUntil: until})
+}
+
+// SendEmailChange implements email.Emailer by queueing the email.
+func (e Emailer) SendEmailChange(ctx context.Context, account accounts.Account) error {
+	return e.Outbox.QueueEmail(ctx, accounts.QueuedEmail{Kind: accounts.EmailKindEmailChange, Account: account})
+}
+
+// SendEmailChangeNotice implements email.Emailer by queueing the email.
+func (e Emailer) SendEmailChangeNotice(ctx context.Context, account accounts.Account) error {
+	return e.Outbox.QueueEmail(ctx, accounts.QueuedEmail{Kind: accounts.EmailKindEmailChangeNotice, Account: account})
+}
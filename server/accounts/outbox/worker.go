@@ -0,0 +1,160 @@
+// Package outbox sends the emails which wait in an accounts.Outbox, and retries the ones which fail.
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/accounts/email"
+	"github.com/wikisophia/api/server/config"
+	"github.com/wikisophia/api/server/logging"
+)
+
+// Worker sends due emails from an Outbox through an Emailer.
+// Each failure delays the next attempt twice as long as the last one, and emails
+// which fail too many times are left dead in the Outbox for an admin to look at.
+// Use NewWorker() to make one.
+type Worker struct {
+	outbox  accounts.Outbox
+	emailer email.Emailer
+	cfg     config.Outbox
+	now     func() time.Time
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewWorker makes a Worker which sends the emails in outbox through emailer.
+// now tells the time. If it's nil, time.Now is used.
+func NewWorker(outbox accounts.Outbox, emailer email.Emailer, cfg config.Outbox, now func() time.Time) *Worker {
+	if now == nil {
+		now = time.Now
+	}
+	return &Worker{
+		outbox:  outbox,
+		emailer: emailer,
+		cfg:     cfg,
+		now:     now,
+	}
+}
+
+// Start sends emails in the background until Stop() is called.
+// It checks the Outbox again right away after a full batch, and waits for the poll interval otherwise.
+func (w *Worker) Start() {
+	stop, done := make(chan struct{}), make(chan struct{})
+	w.stop, w.done = stop, done
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stop
+		cancel()
+	}()
+	go func() {
+		defer close(done)
+		timer := time.NewTimer(0)
+		defer timer.Stop()
+		for {
+			select {
+			case <-timer.C:
+				claimed, err := w.SendDue(ctx)
+				if err != nil {
+					logging.FromContext(ctx).Error("failed to claim emails", slog.Any("error", err))
+				}
+				if err == nil && claimed == w.cfg.BatchSize {
+					timer.Reset(0)
+				} else {
+					timer.Reset(w.cfg.PollInterval())
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends the background sends started by Start(). Emails which are being sent at the time
+// are abandoned, and get sent again once their lease runs out.
+// It's safe to call even if Start() wasn't.
+func (w *Worker) Stop() {
+	if w.stop != nil {
+		close(w.stop)
+		<-w.done
+		w.stop = nil
+	}
+}
+
+// SendDue claims one batch of due emails and tries to send them. It returns the number it claimed.
+// Failures to send are recorded in the Outbox rather than returned.
+func (w *Worker) SendDue(ctx context.Context) (int, error) {
+	claimed, err := w.outbox.ClaimEmails(ctx, w.now(), w.cfg.BatchSize, w.cfg.Lease())
+	if err != nil {
+		return 0, err
+	}
+	for _, queued := range claimed {
+		w.deliver(ctx, queued)
+	}
+	return len(claimed), nil
+}
+
+// deliver sends one email, and records how it went.
+func (w *Worker) deliver(ctx context.Context, queued accounts.QueuedEmail) {
+	logger := logging.FromContext(ctx).With(
+		slog.Int64("email_id", queued.ID),
+		slog.String("kind", string(queued.Kind)),
+		slog.Int64("account_id", queued.Account.ID))
+	sendErr := w.send(ctx, queued)
+	if sendErr == nil {
+		if err := w.outbox.EmailSent(ctx, queued.ID); err != nil {
+			// The email will be sent again once its lease runs out. Duplicates beat losing it.
+			logger.Error("failed to mark email as sent", slog.Any("error", err))
+		}
+		return
+	}
+
+	retryAt := w.retryAt(queued)
+	if err := w.outbox.EmailFailed(ctx, queued.ID, sendErr.Error(), retryAt); err != nil {
+		logger.Error("failed to record email failure", slog.Any("error", err))
+	}
+	if retryAt.IsZero() {
+		logger.Error("giving up on email", slog.Int("attempts", queued.Attempts+1), slog.Any("error", sendErr))
+	} else {
+		logger.Warn("failed to send email", slog.Int("attempts", queued.Attempts+1), slog.Time("retry_at", retryAt), slog.Any("error", sendErr))
+	}
+}
+
+func (w *Worker) send(ctx context.Context, queued accounts.QueuedEmail) error {
+	switch queued.Kind {
+	case accounts.EmailKindWelcome:
+		return w.emailer.SendWelcome(ctx, queued.Account)
+	case accounts.EmailKindReset:
+		return w.emailer.SendReset(ctx, queued.Account)
+	case accounts.EmailKindVerification:
+		return w.emailer.SendVerification(ctx, queued.Account)
+	case accounts.EmailKindLocked:
+		return w.emailer.SendLocked(ctx, queued.Account, queued.LockedUntil)
+	case accounts.EmailKindEmailChange:
+		return w.emailer.SendEmailChange(ctx, queued.Account)
+	case accounts.EmailKindEmailChangeNotice:
+		return w.emailer.SendEmailChangeNotice(ctx, queued.Account)
+	default:
+		return fmt.Errorf("unknown email kind %q", queued.Kind)
+	}
+}
+
+// retryAt returns when to try a failed email again, or the zero Time if it's failed too many times.
+func (w *Worker) retryAt(queued accounts.QueuedEmail) time.Time {
+	attempts := queued.Attempts + 1
+	if attempts >= w.cfg.MaxAttempts {
+		return time.Time{}
+	}
+	delay := w.cfg.RetryDelay()
+	for i := 1; i < attempts && delay < w.cfg.MaxRetryDelay(); i++ {
+		delay *= 2
+	}
+	if delay > w.cfg.MaxRetryDelay() {
+		delay = w.cfg.MaxRetryDelay()
+	}
+	return w.now().Add(delay)
+}
@@ -0,0 +1,187 @@
+package outbox_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/accounts/memory"
+	"github.com/wikisophia/api/server/accounts/outbox"
+	"github.com/wikisophia/api/server/config"
+)
+
+func TestSentEmailsLeaveTheOutbox(t *testing.T) {
+	store := memory.NewMemoryStore()
+	emailer := &flakyEmailer{}
+	worker := outbox.NewWorker(store, emailer, testConfig(), nil)
+
+	account, _, err := store.NewResetToken(context.Background(), "email@soph.wiki")
+	require.NoError(t, err)
+	claimed, err := worker.SendDue(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, claimed)
+	require.Len(t, emailer.sent, 1)
+	assert.Equal(t, account.ID, emailer.sent[0].ID)
+	assert.Equal(t, account.ResetToken, emailer.sent[0].ResetToken)
+
+	claimed, err = worker.SendDue(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, claimed)
+	assert.Len(t, emailer.sent, 1)
+}
+
+func TestQueuedLockEmailsSent(t *testing.T) {
+	store := memory.NewMemoryStore()
+	emailer := &flakyEmailer{}
+	worker := outbox.NewWorker(store, emailer, testConfig(), nil)
+
+	until := time.Now().Add(time.Hour).Truncate(time.Second)
+	require.NoError(t, outbox.Emailer{Outbox: store}.SendLocked(context.Background(), accounts.Account{ID: 1, Email: "email@soph.wiki"}, until))
+	_, err := worker.SendDue(context.Background())
+	require.NoError(t, err)
+	require.Len(t, emailer.sent, 1)
+	assert.Equal(t, until, emailer.lockedUntil)
+}
+
+func TestFailuresBackOff(t *testing.T) {
+	store := memory.NewMemoryStore()
+	emailer := &flakyEmailer{failures: 3}
+	_, _, err := store.NewResetToken(context.Background(), "email@soph.wiki")
+	require.NoError(t, err)
+	now := time.Now()
+	worker := outbox.NewWorker(store, emailer, testConfig(), func() time.Time { return now })
+
+	for _, delay := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second} {
+		_, err := worker.SendDue(context.Background())
+		require.NoError(t, err)
+		failed, err := store.FailedEmails(context.Background())
+		require.NoError(t, err)
+		require.Len(t, failed, 1)
+		assert.Equal(t, now.Add(delay), failed[0].NextAttemptAt, "retries should back off exponentially, up to the max delay")
+
+		now = now.Add(delay - time.Millisecond)
+		claimed, err := worker.SendDue(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 0, claimed, "emails shouldn't be retried early")
+		now = now.Add(time.Millisecond)
+	}
+
+	claimed, err := worker.SendDue(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, claimed)
+	failed, err := store.FailedEmails(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, failed)
+	assert.Len(t, emailer.sent, 1)
+}
+
+func TestEmailsDieAfterMaxAttempts(t *testing.T) {
+	store := memory.NewMemoryStore()
+	emailer := &flakyEmailer{failures: 100}
+	_, _, err := store.NewResetToken(context.Background(), "email@soph.wiki")
+	require.NoError(t, err)
+	now := time.Now()
+	worker := outbox.NewWorker(store, emailer, testConfig(), func() time.Time { return now })
+
+	for i := 0; i < 4; i++ {
+		_, err := worker.SendDue(context.Background())
+		require.NoError(t, err)
+		now = now.Add(time.Minute)
+	}
+	assert.Equal(t, 4, emailer.attempts)
+	failed, err := store.FailedEmails(context.Background())
+	require.NoError(t, err)
+	require.Len(t, failed, 1)
+	assert.Equal(t, 4, failed[0].Attempts)
+	assert.False(t, failed[0].DeadAt.IsZero())
+	assert.Equal(t, "send failed", failed[0].LastError)
+
+	claimed, err := worker.SendDue(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, claimed, "dead emails shouldn't be sent again without a retry")
+}
+
+func TestWorkerStartsAndStops(t *testing.T) {
+	store := memory.NewMemoryStore()
+	emailer := &flakyEmailer{}
+	worker := outbox.NewWorker(store, emailer, testConfig(), nil)
+	_, _, err := store.NewResetToken(context.Background(), "email@soph.wiki")
+	require.NoError(t, err)
+
+	worker.Start()
+	assert.Eventually(t, func() bool {
+		failed, err := store.FailedEmails(context.Background())
+		return err == nil && len(failed) == 0 && emailer.sentCount() == 1
+	}, time.Second, 5*time.Millisecond)
+	worker.Stop()
+	worker.Stop()
+}
+
+func testConfig() config.Outbox {
+	return config.Outbox{
+		PollIntervalMillis:  10,
+		BatchSize:           10,
+		LeaseMillis:         60000,
+		MaxAttempts:         4,
+		RetryDelayMillis:    1000,
+		MaxRetryDelayMillis: 3000,
+	}
+}
+
+// flakyEmailer fails the first few emails it's asked to send, and records the rest.
+type flakyEmailer struct {
+	mutex       sync.Mutex
+	failures    int
+	attempts    int
+	sent        []accounts.Account
+	lockedUntil time.Time
+}
+
+func (e *flakyEmailer) SendWelcome(ctx context.Context, account accounts.Account) error {
+	return e.send(account)
+}
+
+func (e *flakyEmailer) SendReset(ctx context.Context, account accounts.Account) error {
+	return e.send(account)
+}
+
+func (e *flakyEmailer) SendVerification(ctx context.Context, account accounts.Account) error {
+	return e.send(account)
+}
+
+func (e *flakyEmailer) SendLocked(ctx context.Context, account accounts.Account, until time.Time) error {
+	e.mutex.Lock()
+	e.lockedUntil = until
+	e.mutex.Unlock()
+	return e.send(account)
+}
+
+func (e *flakyEmailer) SendEmailChange(ctx context.Context, account accounts.Account) error {
+	return e.send(account)
+}
+
+func (e *flakyEmailer) SendEmailChangeNotice(ctx context.Context, account accounts.Account) error {
+	return e.send(account)
+}
+
+func (e *flakyEmailer) send(account accounts.Account) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.attempts++
+	if e.attempts <= e.failures {
+		return errors.New("send failed")
+	}
+	e.sent = append(e.sent, account)
+	return nil
+}
+
+func (e *flakyEmailer) sentCount() int {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return len(e.sent)
+}
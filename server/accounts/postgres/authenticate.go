@@ -3,8 +3,13 @@ package postgres
 import (
 	"context"
 	"errors"
+	"log/slog"
 
 	"github.com/jackc/pgx/v4"
+	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/logging"
+	wikisophiaPostgres "github.com/wikisophia/api/server/postgres"
+	"github.com/wikisophia/api/server/tracing"
 )
 
 const authenticateQuery = `
@@ -13,23 +18,53 @@ FROM accounts
 WHERE email = $1;
 `
 
+// rehashQuery only replaces the hash which was checked, in case the password changed in the meantime.
+const rehashQuery = `
+UPDATE accounts
+SET password_hash = $2
+WHERE id = $1
+  AND password_hash = $3;
+`
+
 // See the docs on interfaces in store.go
-func (s *PostgresStore) Authenticate(ctx context.Context, email, password string) (int64, error) {
+func (s *PostgresStore) Authenticate(ctx context.Context, email, password string) (id int64, err error) {
+	ctx, span := wikisophiaPostgres.StartSpan(ctx, s.pool, "accounts.PostgresStore.Authenticate")
+	defer func() { tracing.End(span, err) }()
 	row := s.pool.QueryRow(ctx, authenticateQuery, email)
-	var id int64
-	var hashedPassword string
+	var hashedPassword *string
 	if err := row.Scan(&id, &hashedPassword); err == pgx.ErrNoRows {
-		return -1, errors.New("no account found with that email and password")
+		s.hasher.Matches(ctx, password, s.missingPasswordHash)
+		return -1, accounts.AccountNotExistsError{Email: email}
 	} else if err != nil {
 		return -1, err
 	}
+	if hashedPassword == nil {
+		s.hasher.Matches(ctx, password, s.missingPasswordHash)
+		return -1, accounts.InvalidPasswordError{}
+	}
 
-	match, err := s.hasher.Matches(password, hashedPassword)
+	match, err := s.hasher.Matches(ctx, password, *hashedPassword)
 	if err != nil {
 		return -1, errors.New("error matching password against the database")
 	}
 	if !match {
-		return -1, errors.New("no account found with that email and password")
+		return -1, accounts.InvalidPasswordError{}
+	}
+	if s.hasher.NeedsRehash(*hashedPassword) {
+		if err := s.rehash(ctx, id, password, *hashedPassword); err != nil {
+			// The login is still valid, so just try again next time.
+			logging.FromContext(ctx).Warn("failed to rehash password", slog.Int64("account_id", id), slog.Any("error", err))
+		}
 	}
 	return id, nil
 }
+
+// rehash replaces oldHash with a new hash of the password, made with the hasher's current params.
+func (s *PostgresStore) rehash(ctx context.Context, id int64, password, oldHash string) error {
+	newHash, err := s.hasher.Hash(ctx, password)
+	if err != nil {
+		return err
+	}
+	_, err = s.pool.Exec(ctx, rehashQuery, id, newHash, oldHash)
+	return err
+}
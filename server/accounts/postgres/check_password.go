@@ -0,0 +1,45 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/wikisophia/api/server/accounts"
+)
+
+const selectUnpurgedPasswordQuery = `
+SELECT email, password_hash
+FROM accounts
+WHERE id = $1
+  AND purged_at IS NULL;
+`
+
+// accountPassword returns the account's email and password hash, for methods which check its password.
+// Purged accounts are treated as though they didn't exist.
+func (s *PostgresStore) accountPassword(ctx context.Context, id int64) (email string, hash *string, err error) {
+	if err := s.pool.QueryRow(ctx, selectUnpurgedPasswordQuery, id).Scan(&email, &hash); err == pgx.ErrNoRows {
+		return "", nil, accounts.AccountNotExistsError{}
+	} else if err != nil {
+		return "", nil, fmt.Errorf("failed to read password: %v", err)
+	}
+	return email, hash, nil
+}
+
+// checkPassword returns an InvalidPasswordError unless the password matches the hash.
+// Accounts without a password take as long to check as the ones with one.
+func (s *PostgresStore) checkPassword(ctx context.Context, password string, hash *string) error {
+	if hash == nil {
+		s.hasher.Matches(ctx, password, s.missingPasswordHash)
+		return accounts.InvalidPasswordError{}
+	}
+	matches, err := s.hasher.Matches(ctx, password, *hash)
+	if err != nil {
+		return errors.New("error matching password against the database")
+	}
+	if !matches {
+		return accounts.InvalidPasswordError{}
+	}
+	return nil
+}
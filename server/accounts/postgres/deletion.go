@@ -0,0 +1,157 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/wikisophia/api/server/accounts"
+	wikisophiaPostgres "github.com/wikisophia/api/server/postgres"
+	"github.com/wikisophia/api/server/tracing"
+)
+
+// The password hash is checked again, in case the password changed while the old one was being matched.
+const scheduleDeletionQuery = `
+UPDATE accounts
+SET deletion_due_at = $2
+WHERE id = $1
+  AND password_hash = $3;
+`
+
+const cancelDeletionQuery = `
+UPDATE accounts
+SET deletion_due_at = NULL
+WHERE id = $1
+  AND purged_at IS NULL;
+`
+
+// The rows are locked, and ones which are locked already are skipped, so that concurrent purges don't collide.
+const selectDueDeletionsQuery = `
+SELECT id
+FROM accounts
+WHERE deletion_due_at <= $1
+  AND purged_at IS NULL
+FOR UPDATE SKIP LOCKED;
+`
+
+// Everything which could identify the account's owner is cleared. The row is kept so that its ID isn't reused.
+// The app can't DELETE accounts anyway.
+const purgeAccountQuery = `
+WITH purged AS (
+  UPDATE accounts
+  SET email = $2,
+      password_hash = NULL,
+      reset_token_hash = NULL,
+      reset_token_expiry = NULL,
+      email_verified_at = NULL,
+      verification_token_hash = NULL,
+      verification_token_expiry = NULL,
+      new_email = NULL,
+      email_change_token_hash = NULL,
+      email_change_token_expiry = NULL,
+      failed_logins = 0,
+      locked_until = NULL,
+      display_name = '',
+      bio = '',
+      preferences = NULL,
+      deletion_due_at = NULL,
+      totp_secret = NULL,
+      totp_pending_secret = NULL,
+      totp_last_step = 0,
+      two_factor_required = false,
+      moderator = false,
+      purged_at = $3
+  WHERE id = $1
+  RETURNING id
+), codes AS (
+  DELETE FROM recovery_codes WHERE account_id IN (SELECT id FROM purged)
+), sessions AS (
+  DELETE FROM sessions WHERE account_id IN (SELECT id FROM purged)
+)
+DELETE FROM email_outbox WHERE account_id IN (SELECT id FROM purged);
+`
+
+// See the docs on interfaces in store.go
+func (s *PostgresStore) ScheduleDeletion(ctx context.Context, id int64, password string, dueAt time.Time) (err error) {
+	ctx, span := wikisophiaPostgres.StartSpan(ctx, s.pool, "accounts.PostgresStore.ScheduleDeletion")
+	defer func() { tracing.End(span, err) }()
+	_, passwordHash, err := s.accountPassword(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.checkPassword(ctx, password, passwordHash); err != nil {
+		return err
+	}
+
+	response, err := s.pool.Exec(ctx, scheduleDeletionQuery, id, dueAt, *passwordHash)
+	if err != nil {
+		return fmt.Errorf("failed to schedule deletion: %v", err)
+	}
+	// If no rows changed, the password changed since we read it.
+	if response.RowsAffected() != 1 {
+		return accounts.InvalidPasswordError{}
+	}
+	return nil
+}
+
+// See the docs on interfaces in store.go
+func (s *PostgresStore) CancelDeletion(ctx context.Context, id int64) (err error) {
+	ctx, span := wikisophiaPostgres.StartSpan(ctx, s.pool, "accounts.PostgresStore.CancelDeletion")
+	defer func() { tracing.End(span, err) }()
+	response, err := s.pool.Exec(ctx, cancelDeletionQuery, id)
+	if err != nil {
+		return fmt.Errorf("failed to cancel deletion: %v", err)
+	}
+	if response.RowsAffected() != 1 {
+		return accounts.AccountNotExistsError{}
+	}
+	return nil
+}
+
+// See the docs on interfaces in store.go
+func (s *PostgresStore) PurgeAccounts(ctx context.Context, now time.Time) (purged int, err error) {
+	ctx, span := wikisophiaPostgres.StartSpan(ctx, s.pool, "accounts.PostgresStore.PurgeAccounts")
+	defer func() { tracing.End(span, err) }()
+	tx, err := wikisophiaPostgres.BeginTx(ctx, s.pool)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge accounts: %v", err)
+	}
+	// This does nothing once the transaction is committed.
+	defer tx.Rollback(ctx)
+
+	ids, err := dueDeletions(ctx, tx, now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge accounts: %v", err)
+	}
+	for _, id := range ids {
+		placeholder, err := accounts.PurgedEmail(id)
+		if err != nil {
+			return 0, fmt.Errorf("failed to purge account %d: %v", id, err)
+		}
+		if _, err := tx.Exec(ctx, purgeAccountQuery, id, placeholder, now); err != nil {
+			return 0, fmt.Errorf("failed to purge account %d: %v", id, err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to purge accounts: %v", err)
+	}
+	return len(ids), nil
+}
+
+func dueDeletions(ctx context.Context, tx pgx.Tx, now time.Time) ([]int64, error) {
+	rows, err := tx.Query(ctx, selectDueDeletionsQuery, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,129 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/accounts/tokens"
+	wikisophiaPostgres "github.com/wikisophia/api/server/postgres"
+	"github.com/wikisophia/api/server/tracing"
+)
+
+// The password hash is checked again, in case the password changed while the old one was being matched.
+// Both emails are queued in the same statement.
+const requestEmailChangeQuery = `
+WITH updated AS (
+  UPDATE accounts
+  SET new_email = $2,
+      email_change_token_hash = $3,
+      email_change_token_expiry = $4
+  WHERE id = $1
+    AND password_hash = $5
+  RETURNING id, email
+), queued AS (
+  INSERT INTO email_outbox (kind, account_id, email, email_change_token)
+  SELECT $7, id, $2, $6 FROM updated
+  UNION ALL
+  SELECT $8, id, email, NULL FROM updated
+)
+SELECT id FROM updated;
+`
+
+const selectEmailChangeTokenByIdQuery = `
+SELECT new_email, email_change_token_hash, email_change_token_expiry
+FROM accounts
+WHERE id = $1;
+`
+
+// Tokens sent to the old email are cleared, since they shouldn't work once it isn't the account's.
+const confirmEmailChangeQuery = `
+UPDATE accounts
+SET email = new_email,
+    email_verified_at = $2,
+    new_email = NULL,
+    email_change_token_hash = NULL,
+    email_change_token_expiry = NULL,
+    reset_token_hash = NULL,
+    reset_token_expiry = NULL,
+    verification_token_hash = NULL,
+    verification_token_expiry = NULL
+WHERE id = $1
+  AND email_change_token_hash = $3
+  AND email_change_token_expiry >= $2;
+`
+
+const emailChangeErrorMsg = "failed to request email change"
+
+// See the docs on interfaces in store.go
+func (s *PostgresStore) RequestEmailChange(ctx context.Context, id int64, password, newEmail, code string) (account accounts.Account, err error) {
+	ctx, span := wikisophiaPostgres.StartSpan(ctx, s.pool, "accounts.PostgresStore.RequestEmailChange")
+	defer func() { tracing.End(span, err) }()
+	email, passwordHash, err := s.accountPassword(ctx, id)
+	if err != nil {
+		return accounts.Account{}, err
+	}
+	if err := s.checkPassword(ctx, password, passwordHash); err != nil {
+		return accounts.Account{}, err
+	}
+	if newEmail == email {
+		return accounts.Account{}, accounts.EmailExistsError{Email: newEmail}
+	}
+	if err := s.checkSecondFactor(ctx, id, code); err != nil {
+		return accounts.Account{}, err
+	}
+	token, err := tokens.NewVerificationToken(50)
+	if err != nil {
+		return accounts.Account{}, fmt.Errorf("%s: %v", emailChangeErrorMsg, err)
+	}
+	expiration := time.Now().Add(s.expiry.Verification)
+
+	var updatedID int64
+	err = s.pool.QueryRow(ctx, requestEmailChangeQuery, id, newEmail, tokens.Hash(token), expiration, *passwordHash, token,
+		string(accounts.EmailKindEmailChange), string(accounts.EmailKindEmailChangeNotice)).Scan(&updatedID)
+	// If no rows changed, the password changed since we read it.
+	if err == pgx.ErrNoRows {
+		return accounts.Account{}, accounts.InvalidPasswordError{}
+	} else if err != nil {
+		return accounts.Account{}, fmt.Errorf("%s: %v", emailChangeErrorMsg, err)
+	}
+	return accounts.Account{
+		ID:               id,
+		Email:            newEmail,
+		EmailChangeToken: token,
+	}, nil
+}
+
+// See the docs on interfaces in store.go
+func (s *PostgresStore) ConfirmEmailChange(ctx context.Context, id int64, token string) (err error) {
+	ctx, span := wikisophiaPostgres.StartSpan(ctx, s.pool, "accounts.PostgresStore.ConfirmEmailChange")
+	defer func() { tracing.End(span, err) }()
+	var newEmail, storedHash *string
+	var expiry *time.Time
+	if err := s.pool.QueryRow(ctx, selectEmailChangeTokenByIdQuery, id).Scan(&newEmail, &storedHash, &expiry); err == pgx.ErrNoRows {
+		return accounts.AccountNotExistsError{}
+	} else if err != nil {
+		return fmt.Errorf("failed to confirm email change: %v", err)
+	}
+	if newEmail == nil || storedHash == nil || expiry == nil || time.Now().After(*expiry) || !tokens.Matches(token, *storedHash) {
+		return accounts.InvalidEmailChangeTokenError{}
+	}
+
+	response, err := s.pool.Exec(ctx, confirmEmailChangeQuery, id, time.Now(), *storedHash)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation && pgErr.ConstraintName == "accounts_email_key" {
+			return accounts.EmailExistsError{Email: *newEmail}
+		}
+		return fmt.Errorf("failed to confirm email change: %v", err)
+	}
+	// If no rows change, someone else used or replaced the token since we read it, or it just expired.
+	if response.RowsAffected() != 1 {
+		return accounts.InvalidEmailChangeTokenError{}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgconn"
+	"github.com/wikisophia/api/server/accounts"
+	wikisophiaPostgres "github.com/wikisophia/api/server/postgres"
+	"github.com/wikisophia/api/server/tracing"
+)
+
+const exportAccountsQuery = `
+SELECT id, email, COALESCE(password_hash, ''), email_verified_at, display_name, bio, preferences::text, deletion_due_at, purged_at,
+       COALESCE(totp_secret, ''), totp_last_step, two_factor_required, moderator,
+       (SELECT array_agg(code_hash ORDER BY id) FROM recovery_codes WHERE account_id = accounts.id)
+FROM accounts
+ORDER BY id;
+`
+
+const hasAccountsQuery = `SELECT EXISTS (SELECT 1 FROM accounts);`
+
+// The recovery codes are saved in the same statement.
+const importAccountQuery = `
+WITH imported AS (
+  INSERT INTO accounts (id, email, password_hash, email_verified_at, display_name, bio, preferences, deletion_due_at, purged_at,
+                        totp_secret, totp_last_step, two_factor_required, moderator)
+  VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $7::jsonb, $8, $9, NULLIF($10, ''), $11, $12, $13)
+  RETURNING id
+)
+INSERT INTO recovery_codes (account_id, code_hash)
+SELECT imported.id, unnest($14::text[]) FROM imported;
+`
+
+// Imported rows set their IDs explicitly, so the sequence needs to skip past them
+// or else the next NewResetToken() call would collide with an imported account.
+const resyncAccountIDsQuery = `
+SELECT setval(pg_get_serial_sequence('accounts', 'id'), GREATEST(MAX(id), 1))
+FROM accounts;
+`
+
+// See the docs on interfaces in store.go
+func (s *PostgresStore) ExportAccounts(ctx context.Context) (exported []accounts.StoredAccount, err error) {
+	ctx, span := wikisophiaPostgres.StartSpan(ctx, s.pool, "accounts.PostgresStore.ExportAccounts")
+	defer func() { tracing.End(span, err) }()
+	rows, err := s.pool.Query(ctx, exportAccountsQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export accounts: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var account accounts.StoredAccount
+		var preferences *string
+		if err := rows.Scan(&account.ID, &account.Email, &account.PasswordHash, &account.EmailVerifiedAt,
+			&account.DisplayName, &account.Bio, &preferences, &account.DeletionDueAt, &account.PurgedAt,
+			&account.TwoFactorSecret, &account.TwoFactorLastStep, &account.TwoFactorRequired, &account.Moderator, &account.RecoveryCodeHashes); err != nil {
+			return nil, fmt.Errorf("export result scan failed: %v", err)
+		}
+		if preferences != nil {
+			account.Preferences = []byte(*preferences)
+		}
+		exported = append(exported, account)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to export accounts: %v", err)
+	}
+	return exported, nil
+}
+
+// See the docs on interfaces in store.go
+func (s *PostgresStore) ImportAccounts(ctx context.Context, imported []accounts.StoredAccount) (err error) {
+	ctx, span := wikisophiaPostgres.StartSpan(ctx, s.pool, "accounts.PostgresStore.ImportAccounts")
+	defer func() { tracing.End(span, err) }()
+	tx, err := wikisophiaPostgres.BeginTx(ctx, s.pool)
+	if err != nil {
+		return fmt.Errorf("failed to import accounts: %v", err)
+	}
+	// This does nothing once the transaction is committed.
+	defer tx.Rollback(ctx)
+
+	var exists bool
+	if err := tx.QueryRow(ctx, hasAccountsQuery).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to check for existing accounts: %v", err)
+	}
+	if exists {
+		return accounts.StoreNotEmptyError{}
+	}
+	for _, account := range imported {
+		var preferences *string
+		if account.Preferences != nil {
+			encoded := string(account.Preferences)
+			preferences = &encoded
+		}
+		if _, err := tx.Exec(ctx, importAccountQuery, account.ID, account.Email, account.PasswordHash, account.EmailVerifiedAt,
+			account.DisplayName, account.Bio, preferences, account.DeletionDueAt, account.PurgedAt,
+			account.TwoFactorSecret, account.TwoFactorLastStep, account.TwoFactorRequired, account.Moderator, account.RecoveryCodeHashes); err != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation && pgErr.ConstraintName == "accounts_email_key" {
+				return accounts.EmailExistsError{Email: account.Email}
+			}
+			return fmt.Errorf("failed to import account %d: %v", account.ID, err)
+		}
+	}
+	if _, err := tx.Exec(ctx, resyncAccountIDsQuery); err != nil {
+		return fmt.Errorf("failed to resync the account ID sequence: %v", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to import accounts: %v", err)
+	}
+	return nil
+}
+
+// uniqueViolation is the SQLSTATE code Postgres uses when a UNIQUE constraint fails.
+const uniqueViolation = "23505"
@@ -0,0 +1,90 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/wikisophia/api/server/accounts"
+	wikisophiaPostgres "github.com/wikisophia/api/server/postgres"
+	"github.com/wikisophia/api/server/tracing"
+)
+
+const selectLoginFailuresQuery = `
+SELECT id, failed_logins, locked_until
+FROM accounts
+WHERE email = $1;
+`
+
+const recordLoginFailureQuery = `
+UPDATE accounts
+SET failed_logins = failed_logins + 1
+WHERE id = $1
+RETURNING failed_logins;
+`
+
+const lockAccountQuery = `
+UPDATE accounts
+SET locked_until = $2
+WHERE id = $1;
+`
+
+const clearLoginFailuresQuery = `
+UPDATE accounts
+SET failed_logins = 0,
+    locked_until = NULL
+WHERE id = $1;
+`
+
+// See the docs on interfaces in store.go
+func (s *PostgresStore) LoginFailures(ctx context.Context, email string) (failures accounts.LoginFailures, err error) {
+	ctx, span := wikisophiaPostgres.StartSpan(ctx, s.pool, "accounts.PostgresStore.LoginFailures")
+	defer func() { tracing.End(span, err) }()
+	var lockedUntil *time.Time
+	if err := s.pool.QueryRow(ctx, selectLoginFailuresQuery, email).Scan(&failures.AccountID, &failures.Count, &lockedUntil); err == pgx.ErrNoRows {
+		return accounts.LoginFailures{}, accounts.AccountNotExistsError{Email: email}
+	} else if err != nil {
+		return accounts.LoginFailures{}, fmt.Errorf("failed to fetch login failures: %v", err)
+	}
+	if lockedUntil != nil {
+		failures.LockedUntil = *lockedUntil
+	}
+	return failures, nil
+}
+
+// See the docs on interfaces in store.go
+func (s *PostgresStore) RecordLoginFailure(ctx context.Context, id int64) (count int, err error) {
+	ctx, span := wikisophiaPostgres.StartSpan(ctx, s.pool, "accounts.PostgresStore.RecordLoginFailure")
+	defer func() { tracing.End(span, err) }()
+	if err := s.pool.QueryRow(ctx, recordLoginFailureQuery, id).Scan(&count); err == pgx.ErrNoRows {
+		return 0, accounts.AccountNotExistsError{}
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to record login failure: %v", err)
+	}
+	return count, nil
+}
+
+// See the docs on interfaces in store.go
+func (s *PostgresStore) LockAccount(ctx context.Context, id int64, until time.Time) (err error) {
+	ctx, span := wikisophiaPostgres.StartSpan(ctx, s.pool, "accounts.PostgresStore.LockAccount")
+	defer func() { tracing.End(span, err) }()
+	if result, err := s.pool.Exec(ctx, lockAccountQuery, id, until); err != nil {
+		return fmt.Errorf("failed to lock account: %v", err)
+	} else if result.RowsAffected() != 1 {
+		return accounts.AccountNotExistsError{}
+	}
+	return nil
+}
+
+// See the docs on interfaces in store.go
+func (s *PostgresStore) ClearLoginFailures(ctx context.Context, id int64) (err error) {
+	ctx, span := wikisophiaPostgres.StartSpan(ctx, s.pool, "accounts.PostgresStore.ClearLoginFailures")
+	defer func() { tracing.End(span, err) }()
+	if result, err := s.pool.Exec(ctx, clearLoginFailuresQuery, id); err != nil {
+		return fmt.Errorf("failed to clear login failures: %v", err)
+	} else if result.RowsAffected() != 1 {
+		return accounts.AccountNotExistsError{}
+	}
+	return nil
+}
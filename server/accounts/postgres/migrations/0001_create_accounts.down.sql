@@ -1,4 +1,4 @@
--- Delete the stuff created by create.sql
+-- Delete the stuff created by 0001_create_accounts.up.sql
 DROP INDEX IF EXISTS accounts_email_idx;
 DROP TABLE IF EXISTS accounts;
 
@@ -1,5 +1,5 @@
 -- Create the stuff inside the accounts database.
--- Keep this in sync with the empty.sql and destroy.sql files.
+-- If you add tables, add them to scripts/empty.sql too.
 CREATE FUNCTION update_last_modified()
 RETURNS TRIGGER AS $$
 BEGIN
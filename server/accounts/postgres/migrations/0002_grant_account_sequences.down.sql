@@ -0,0 +1 @@
+REVOKE USAGE, UPDATE ON ALL SEQUENCES IN SCHEMA public FROM :accountsUser;
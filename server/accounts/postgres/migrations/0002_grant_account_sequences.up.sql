@@ -0,0 +1,3 @@
+-- 0001 forgot to let the app use the accounts.id sequence, so it couldn't insert new accounts
+-- unless it owned the table. UPDATE is needed to resync the sequence after imports.
+GRANT USAGE, UPDATE ON ALL SEQUENCES IN SCHEMA public TO :accountsUser;
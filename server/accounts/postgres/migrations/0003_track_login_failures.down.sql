@@ -0,0 +1,3 @@
+-- Delete the stuff created by 0003_track_login_failures.up.sql
+ALTER TABLE accounts DROP COLUMN IF EXISTS locked_until;
+ALTER TABLE accounts DROP COLUMN IF EXISTS failed_logins;
@@ -0,0 +1,5 @@
+-- Count the failed logins on each account, so that repeated guesses can be locked out.
+ALTER TABLE accounts ADD COLUMN failed_logins int NOT NULL DEFAULT 0;
+ALTER TABLE accounts ADD COLUMN locked_until TIMESTAMPTZ;
+COMMENT ON COLUMN accounts.failed_logins IS 'The number of failed logins since the last successful one, or the last password reset.';
+COMMENT ON COLUMN accounts.locked_until IS 'The timestamp when the account may log in again. This is null if it has never been locked, or was unlocked.';
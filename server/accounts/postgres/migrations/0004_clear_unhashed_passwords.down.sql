@@ -0,0 +1 @@
+-- 0004_clear_unhashed_passwords.up.sql deleted passwords which shouldn't have been saved, so there's nothing to undo.
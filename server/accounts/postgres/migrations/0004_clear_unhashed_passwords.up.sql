@@ -0,0 +1,4 @@
+-- Earlier versions of the PostgresStore saved passwords set with a reset token without hashing them.
+-- Those accounts could never log in, since the values aren't valid hashes, so clear them. The owners
+-- can set a new password with another reset token.
+UPDATE accounts SET password_hash = NULL WHERE password_hash NOT LIKE '$%';
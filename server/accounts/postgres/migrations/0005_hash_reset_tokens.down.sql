@@ -0,0 +1,4 @@
+-- Undo 0005_hash_reset_tokens.up.sql. The hashes can't be turned back into tokens, so they're cleared.
+UPDATE accounts SET reset_token_hash = NULL, reset_token_expiry = NULL;
+ALTER TABLE accounts RENAME COLUMN reset_token_hash TO reset_token;
+COMMENT ON COLUMN accounts.reset_token IS 'The token generated by the app to reset this account''s password. This will be null if the user hasn''t requested a reset recently.';
@@ -0,0 +1,5 @@
+-- Delete the stuff created by 0006_verify_emails.up.sql
+ALTER TABLE accounts DROP CONSTRAINT IF EXISTS verification_tokens_must_expire;
+ALTER TABLE accounts DROP COLUMN IF EXISTS verification_token_expiry;
+ALTER TABLE accounts DROP COLUMN IF EXISTS verification_token_hash;
+ALTER TABLE accounts DROP COLUMN IF EXISTS email_verified_at;
@@ -0,0 +1,8 @@
+-- Track which accounts have proven that they own their email, separately from password resets.
+ALTER TABLE accounts ADD COLUMN email_verified_at TIMESTAMPTZ;
+ALTER TABLE accounts ADD COLUMN verification_token_hash varchar(100);
+ALTER TABLE accounts ADD COLUMN verification_token_expiry TIMESTAMPTZ;
+ALTER TABLE accounts ADD CONSTRAINT verification_tokens_must_expire CHECK (verification_token_hash IS NULL OR verification_token_expiry IS NOT NULL);
+COMMENT ON COLUMN accounts.email_verified_at IS 'The timestamp when the account proved that it owns its email. This is null if it never has.';
+COMMENT ON COLUMN accounts.verification_token_hash IS 'The hex SHA-256 of the token generated by the app to verify this account''s email. This will be null if the email is verified, or no token was sent.';
+COMMENT ON COLUMN accounts.verification_token_expiry IS 'The timestamp when the verification token expires.';
@@ -0,0 +1,29 @@
+-- Queue emails in the same transaction as the tokens they send, so that failed sends can be retried.
+CREATE TABLE email_outbox (
+  id bigserial PRIMARY KEY,
+  kind varchar(20) NOT NULL,
+  account_id bigint NOT NULL REFERENCES accounts (id) ON DELETE CASCADE,
+  email varchar(100) NOT NULL,
+  reset_token varchar(100),
+  verification_token varchar(100),
+  locked_until TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  attempts int NOT NULL DEFAULT 0,
+  next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  last_error text,
+  dead_at TIMESTAMPTZ
+);
+COMMENT ON TABLE email_outbox IS 'Emails which are waiting to be sent, or failed too many times.';
+COMMENT ON COLUMN email_outbox.kind IS 'Which email this is, like welcome or reset.';
+COMMENT ON COLUMN email_outbox.email IS 'The address the email goes to.';
+COMMENT ON COLUMN email_outbox.reset_token IS 'The raw password reset token in the email. The row is deleted once it''s sent.';
+COMMENT ON COLUMN email_outbox.verification_token IS 'The raw email verification token in the email. The row is deleted once it''s sent.';
+COMMENT ON COLUMN email_outbox.locked_until IS 'When the account unlocks. This is only set on lockout emails.';
+COMMENT ON COLUMN email_outbox.attempts IS 'The number of failed attempts to send the email.';
+COMMENT ON COLUMN email_outbox.next_attempt_at IS 'The timestamp when the email is due to be sent. Claimed emails are pushed back until their sender has had time to finish.';
+COMMENT ON COLUMN email_outbox.last_error IS 'Why the last attempt to send the email failed.';
+COMMENT ON COLUMN email_outbox.dead_at IS 'The timestamp when the email was given up on. This is null if it will still be retried.';
+CREATE INDEX email_outbox_due_idx ON email_outbox (next_attempt_at) WHERE dead_at IS NULL;
+REVOKE ALL ON TABLE email_outbox FROM PUBLIC;
+GRANT SELECT, INSERT, UPDATE, DELETE ON TABLE email_outbox TO :accountsUser;
+GRANT USAGE ON SEQUENCE email_outbox_id_seq TO :accountsUser;
@@ -0,0 +1,6 @@
+-- Delete the stuff created by 0008_change_emails.up.sql
+ALTER TABLE email_outbox DROP COLUMN IF EXISTS email_change_token;
+ALTER TABLE accounts DROP CONSTRAINT IF EXISTS email_change_tokens_must_expire;
+ALTER TABLE accounts DROP COLUMN IF EXISTS email_change_token_expiry;
+ALTER TABLE accounts DROP COLUMN IF EXISTS email_change_token_hash;
+ALTER TABLE accounts DROP COLUMN IF EXISTS new_email;
@@ -0,0 +1,11 @@
+-- Let accounts move to a new email once they prove that they own it.
+-- new_email isn't UNIQUE, since it isn't the account's yet. The email column's constraint is checked when the move is confirmed.
+ALTER TABLE accounts ADD COLUMN new_email varchar(100);
+ALTER TABLE accounts ADD COLUMN email_change_token_hash varchar(100);
+ALTER TABLE accounts ADD COLUMN email_change_token_expiry TIMESTAMPTZ;
+ALTER TABLE accounts ADD CONSTRAINT email_change_tokens_must_expire CHECK (email_change_token_hash IS NULL OR (email_change_token_expiry IS NOT NULL AND new_email IS NOT NULL));
+COMMENT ON COLUMN accounts.new_email IS 'The email this account asked to move to. It moves once the email change token is used.';
+COMMENT ON COLUMN accounts.email_change_token_hash IS 'The hex SHA-256 of the token sent to new_email, which confirms the move.';
+COMMENT ON COLUMN accounts.email_change_token_expiry IS 'The timestamp when the email change token expires.';
+ALTER TABLE email_outbox ADD COLUMN email_change_token varchar(100);
+COMMENT ON COLUMN email_outbox.email_change_token IS 'The raw email change token in the email. The row is deleted once it''s sent.';
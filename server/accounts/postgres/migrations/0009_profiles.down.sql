@@ -0,0 +1,5 @@
+-- Delete the stuff created by 0009_profiles.up.sql
+ALTER TABLE accounts DROP CONSTRAINT IF EXISTS preferences_must_be_objects;
+ALTER TABLE accounts DROP COLUMN IF EXISTS preferences;
+ALTER TABLE accounts DROP COLUMN IF EXISTS bio;
+ALTER TABLE accounts DROP COLUMN IF EXISTS display_name;
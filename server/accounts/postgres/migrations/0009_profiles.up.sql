@@ -0,0 +1,8 @@
+-- Let accounts say something about themselves.
+ALTER TABLE accounts ADD COLUMN display_name varchar(50) NOT NULL DEFAULT '';
+ALTER TABLE accounts ADD COLUMN bio varchar(500) NOT NULL DEFAULT '';
+ALTER TABLE accounts ADD COLUMN preferences jsonb;
+ALTER TABLE accounts ADD CONSTRAINT preferences_must_be_objects CHECK (preferences IS NULL OR jsonb_typeof(preferences) = 'object');
+COMMENT ON COLUMN accounts.display_name IS 'The name the account goes by. Anyone can see it.';
+COMMENT ON COLUMN accounts.bio IS 'What the account says about itself. Anyone can see it.';
+COMMENT ON COLUMN accounts.preferences IS 'A JSON object which only clients look inside. This is null until the account sets some.';
@@ -0,0 +1,4 @@
+-- Delete the stuff created by 0010_delete_accounts.up.sql
+DROP INDEX IF EXISTS accounts_deletion_due_idx;
+ALTER TABLE accounts DROP COLUMN IF EXISTS purged_at;
+ALTER TABLE accounts DROP COLUMN IF EXISTS deletion_due_at;
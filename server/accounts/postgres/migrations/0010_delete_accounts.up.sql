@@ -0,0 +1,7 @@
+-- Let accounts be deleted once their owners ask, after a grace period.
+-- Purged accounts keep their rows, so that their IDs aren't reused, but everything in them is cleared.
+ALTER TABLE accounts ADD COLUMN deletion_due_at TIMESTAMPTZ;
+ALTER TABLE accounts ADD COLUMN purged_at TIMESTAMPTZ;
+CREATE INDEX accounts_deletion_due_idx ON accounts (deletion_due_at) WHERE deletion_due_at IS NOT NULL AND purged_at IS NULL;
+COMMENT ON COLUMN accounts.deletion_due_at IS 'The timestamp when the account will be purged. This is null unless its owner asked to delete it.';
+COMMENT ON COLUMN accounts.purged_at IS 'The timestamp when the account was purged. Its email is a random placeholder after that, and nothing else is kept.';
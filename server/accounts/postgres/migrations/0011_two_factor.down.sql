@@ -0,0 +1,6 @@
+-- Delete the stuff created by 0011_two_factor.up.sql
+DROP TABLE IF EXISTS recovery_codes;
+ALTER TABLE accounts DROP COLUMN IF EXISTS two_factor_required;
+ALTER TABLE accounts DROP COLUMN IF EXISTS totp_last_step;
+ALTER TABLE accounts DROP COLUMN IF EXISTS totp_pending_secret;
+ALTER TABLE accounts DROP COLUMN IF EXISTS totp_secret;
@@ -0,0 +1,20 @@
+-- Let accounts log in with a TOTP code as well as their password.
+ALTER TABLE accounts ADD COLUMN totp_secret varchar(64);
+ALTER TABLE accounts ADD COLUMN totp_pending_secret varchar(64);
+ALTER TABLE accounts ADD COLUMN totp_last_step bigint NOT NULL DEFAULT 0;
+ALTER TABLE accounts ADD COLUMN two_factor_required boolean NOT NULL DEFAULT false;
+COMMENT ON COLUMN accounts.totp_secret IS 'The base32 TOTP secret. This is null unless two-factor auth is on.';
+COMMENT ON COLUMN accounts.totp_pending_secret IS 'A TOTP secret which is waiting to be confirmed with a code it made.';
+COMMENT ON COLUMN accounts.totp_last_step IS 'The step of the last TOTP code which was used, so that codes can''t be replayed.';
+COMMENT ON COLUMN accounts.two_factor_required IS 'True if the account can''t log in, or turn off two-factor auth, without it. Operators set this on moderators.';
+CREATE TABLE recovery_codes (
+  id bigserial PRIMARY KEY,
+  account_id bigint NOT NULL REFERENCES accounts (id) ON DELETE CASCADE,
+  code_hash varchar(100) NOT NULL
+);
+COMMENT ON TABLE recovery_codes IS 'Codes which can each be used once in place of a TOTP code. The row is deleted once it''s used.';
+COMMENT ON COLUMN recovery_codes.code_hash IS 'The code, hashed like a password.';
+CREATE INDEX recovery_codes_account_idx ON recovery_codes (account_id);
+REVOKE ALL ON TABLE recovery_codes FROM PUBLIC;
+GRANT SELECT, INSERT, DELETE ON TABLE recovery_codes TO :accountsUser;
+GRANT USAGE ON SEQUENCE recovery_codes_id_seq TO :accountsUser;
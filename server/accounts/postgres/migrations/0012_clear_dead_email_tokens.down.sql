@@ -0,0 +1,4 @@
+-- Undo 0012_clear_dead_email_tokens.up.sql. The cleared tokens can't be brought back, so only the comments change.
+COMMENT ON COLUMN email_outbox.reset_token IS 'The raw password reset token in the email. The row is deleted once it''s sent.';
+COMMENT ON COLUMN email_outbox.verification_token IS 'The raw email verification token in the email. The row is deleted once it''s sent.';
+COMMENT ON COLUMN email_outbox.email_change_token IS 'The raw email change token in the email. The row is deleted once it''s sent.';
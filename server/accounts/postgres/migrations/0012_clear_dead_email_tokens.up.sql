@@ -0,0 +1,6 @@
+-- Dead emails lose their tokens, so that they don't sit in the database in plaintext.
+-- Retrying a dead email makes new tokens for it.
+UPDATE email_outbox SET reset_token = NULL, verification_token = NULL, email_change_token = NULL WHERE dead_at IS NOT NULL;
+COMMENT ON COLUMN email_outbox.reset_token IS 'The raw password reset token in the email. It''s cleared if the email dies, and the row is deleted once it''s sent.';
+COMMENT ON COLUMN email_outbox.verification_token IS 'The raw email verification token in the email. It''s cleared if the email dies, and the row is deleted once it''s sent.';
+COMMENT ON COLUMN email_outbox.email_change_token IS 'The raw email change token in the email. It''s cleared if the email dies, and the row is deleted once it''s sent.';
@@ -0,0 +1,2 @@
+-- Delete the stuff created by 0013_moderators.up.sql
+ALTER TABLE accounts DROP COLUMN IF EXISTS moderator;
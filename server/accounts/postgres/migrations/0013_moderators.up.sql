@@ -0,0 +1,3 @@
+-- Moderators could do a lot of damage if someone else took them over, so they must have two-factor auth.
+ALTER TABLE accounts ADD COLUMN moderator boolean NOT NULL DEFAULT false;
+COMMENT ON COLUMN accounts.moderator IS 'True if the account is a moderator. Giving an account the role sets two_factor_required too.';
@@ -0,0 +1,4 @@
+-- Undo 0014_tag_recovery_codes.up.sql. The older code can't read the lookup tags, so they're cut off.
+UPDATE recovery_codes SET code_hash = substring(code_hash from 6) WHERE code_hash ~ '^[0-9a-f]{4}:';
+ALTER TABLE recovery_codes ALTER COLUMN code_hash TYPE varchar(100);
+COMMENT ON COLUMN recovery_codes.code_hash IS 'The code, hashed like a password.';
@@ -0,0 +1,4 @@
+-- Recovery code hashes start with a short lookup tag now, so that checking a code only needs one slow hash.
+-- Hashes from before this still work. The column is as wide as password_hash, since both hold the same kind of hash.
+ALTER TABLE recovery_codes ALTER COLUMN code_hash TYPE varchar(5000);
+COMMENT ON COLUMN recovery_codes.code_hash IS 'The code, hashed like a password. Newer ones start with four hex characters of its SHA-256 and a colon.';
@@ -0,0 +1,2 @@
+-- Delete the stuff created by 0015_sessions.up.sql
+DROP TABLE IF EXISTS sessions;
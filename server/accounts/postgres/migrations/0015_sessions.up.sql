@@ -0,0 +1,15 @@
+-- Record each login, so that people can see where they're logged in.
+CREATE TABLE sessions (
+  id bigserial PRIMARY KEY,
+  account_id bigint NOT NULL REFERENCES accounts (id) ON DELETE CASCADE,
+  issued_at TIMESTAMPTZ NOT NULL,
+  last_used_at TIMESTAMPTZ NOT NULL,
+  client varchar(255) NOT NULL DEFAULT ''
+);
+COMMENT ON TABLE sessions IS 'A record of each login. Session tokens are checked by their signature, so these rows don''t decide whether one still works.';
+COMMENT ON COLUMN sessions.last_used_at IS 'The last time a request used the session, to the minute.';
+COMMENT ON COLUMN sessions.client IS 'The User-Agent of the request which logged in.';
+CREATE INDEX sessions_account_idx ON sessions (account_id);
+REVOKE ALL ON TABLE sessions FROM PUBLIC;
+GRANT SELECT, INSERT, UPDATE, DELETE ON TABLE sessions TO :accountsUser;
+GRANT USAGE ON SEQUENCE sessions_id_seq TO :accountsUser;
@@ -0,0 +1,54 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/wikisophia/api/server/accounts"
+	wikisophiaPostgres "github.com/wikisophia/api/server/postgres"
+	"github.com/wikisophia/api/server/tracing"
+)
+
+// Moderators must have two-factor auth, so giving the role requires it too.
+const setModeratorQuery = `
+UPDATE accounts
+SET moderator = $2,
+    two_factor_required = two_factor_required OR $2
+WHERE id = $1
+  AND purged_at IS NULL;
+`
+
+const selectModeratorQuery = `
+SELECT moderator
+FROM accounts
+WHERE id = $1
+  AND purged_at IS NULL;
+`
+
+// See the docs on interfaces in store.go
+func (s *PostgresStore) SetModerator(ctx context.Context, id int64, moderator bool) (err error) {
+	ctx, span := wikisophiaPostgres.StartSpan(ctx, s.pool, "accounts.PostgresStore.SetModerator")
+	defer func() { tracing.End(span, err) }()
+	response, err := s.pool.Exec(ctx, setModeratorQuery, id, moderator)
+	if err != nil {
+		return fmt.Errorf("failed to set the moderator role: %v", err)
+	}
+	if response.RowsAffected() != 1 {
+		return accounts.AccountNotExistsError{}
+	}
+	return nil
+}
+
+// See the docs on interfaces in store.go
+func (s *PostgresStore) IsModerator(ctx context.Context, id int64) (moderator bool, err error) {
+	ctx, span := wikisophiaPostgres.StartSpan(ctx, s.pool, "accounts.PostgresStore.IsModerator")
+	defer func() { tracing.End(span, err) }()
+	err = s.pool.QueryRow(ctx, selectModeratorQuery, id).Scan(&moderator)
+	if err == pgx.ErrNoRows {
+		return false, accounts.AccountNotExistsError{}
+	} else if err != nil {
+		return false, fmt.Errorf("failed to read the moderator role: %v", err)
+	}
+	return moderator, nil
+}
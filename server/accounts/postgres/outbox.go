@@ -0,0 +1,329 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/accounts/tokens"
+	wikisophiaPostgres "github.com/wikisophia/api/server/postgres"
+	"github.com/wikisophia/api/server/tracing"
+)
+
+const queueEmailQuery = `
+INSERT INTO email_outbox (kind, account_id, email, reset_token, verification_token, email_change_token, locked_until)
+VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), NULLIF($6, ''), $7);
+`
+
+const queuedEmailColumns = `id, kind, account_id, email, COALESCE(reset_token, ''), COALESCE(verification_token, ''), COALESCE(email_change_token, ''), locked_until, created_at, attempts, next_attempt_at, COALESCE(last_error, ''), dead_at`
+
+// SKIP LOCKED lets concurrent workers claim different emails, rather than waiting on each other.
+const claimEmailsQuery = `
+UPDATE email_outbox
+SET next_attempt_at = $2
+WHERE id IN (
+  SELECT id
+  FROM email_outbox
+  WHERE dead_at IS NULL
+    AND next_attempt_at <= $1
+  ORDER BY next_attempt_at, id
+  LIMIT $3
+  FOR UPDATE SKIP LOCKED
+)
+RETURNING ` + queuedEmailColumns + `;
+`
+
+const deleteEmailQuery = `DELETE FROM email_outbox WHERE id = $1;`
+
+const emailFailedQuery = `
+UPDATE email_outbox
+SET attempts = attempts + 1,
+    last_error = $2,
+    next_attempt_at = $3
+WHERE id = $1;
+`
+
+// Dead emails lose their tokens, so that they don't sit in the database in plaintext. RetryEmail makes new ones.
+const emailDiedQuery = `
+UPDATE email_outbox
+SET attempts = attempts + 1,
+    last_error = $2,
+    dead_at = $3,
+    reset_token = NULL,
+    verification_token = NULL,
+    email_change_token = NULL
+WHERE id = $1;
+`
+
+const selectFailedEmailsQuery = `SELECT ` + queuedEmailColumns + ` FROM email_outbox WHERE attempts > 0 ORDER BY id;`
+
+const selectRetriedEmailQuery = `SELECT kind, account_id, email, dead_at IS NOT NULL FROM email_outbox WHERE id = $1 FOR UPDATE;`
+
+const retryEmailQuery = `
+UPDATE email_outbox
+SET attempts = 0,
+    next_attempt_at = NOW()
+WHERE id = $1;
+`
+
+const retryDeadEmailQuery = `
+UPDATE email_outbox
+SET attempts = 0,
+    next_attempt_at = NOW(),
+    dead_at = NULL,
+    reset_token = NULLIF($2, ''),
+    verification_token = NULLIF($3, ''),
+    email_change_token = NULLIF($4, '')
+WHERE id = $1;
+`
+
+// The renew queries only replace tokens which would go to the account's current email.
+
+const renewResetTokenQuery = `
+UPDATE accounts
+SET reset_token_hash = $1,
+    reset_token_expiry = $2
+WHERE id = $3
+  AND email = $4
+  AND purged_at IS NULL;
+`
+
+const renewVerificationTokenQuery = `
+UPDATE accounts
+SET verification_token_hash = $1,
+    verification_token_expiry = $2
+WHERE id = $3
+  AND email = $4
+  AND email_verified_at IS NULL
+  AND purged_at IS NULL;
+`
+
+const renewEmailChangeTokenQuery = `
+UPDATE accounts
+SET email_change_token_hash = $1,
+    email_change_token_expiry = $2
+WHERE id = $3
+  AND new_email = $4
+  AND email_change_token_hash IS NOT NULL
+  AND purged_at IS NULL;
+`
+
+const retryEmailErrorMsg = "failed to retry email"
+
+// See the docs on interfaces in store.go
+func (s *PostgresStore) QueueEmail(ctx context.Context, email accounts.QueuedEmail) (err error) {
+	ctx, span := wikisophiaPostgres.StartSpan(ctx, s.pool, "accounts.PostgresStore.QueueEmail")
+	defer func() { tracing.End(span, err) }()
+	var lockedUntil *time.Time
+	if !email.LockedUntil.IsZero() {
+		lockedUntil = &email.LockedUntil
+	}
+	if _, err := s.pool.Exec(ctx, queueEmailQuery,
+		string(email.Kind),
+		email.Account.ID,
+		email.Account.Email,
+		email.Account.ResetToken,
+		email.Account.VerificationToken,
+		email.Account.EmailChangeToken,
+		lockedUntil,
+	); err != nil {
+		return fmt.Errorf("failed to queue email: %v", err)
+	}
+	return nil
+}
+
+// See the docs on interfaces in store.go
+func (s *PostgresStore) ClaimEmails(ctx context.Context, now time.Time, limit int, lease time.Duration) (claimed []accounts.QueuedEmail, err error) {
+	ctx, span := wikisophiaPostgres.StartSpan(ctx, s.pool, "accounts.PostgresStore.ClaimEmails")
+	defer func() { tracing.End(span, err) }()
+	rows, err := s.pool.Query(ctx, claimEmailsQuery, now, now.Add(lease), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim emails: %v", err)
+	}
+	if claimed, err = scanQueuedEmails(rows); err != nil {
+		return nil, fmt.Errorf("failed to claim emails: %v", err)
+	}
+	// RETURNING doesn't promise any order.
+	sort.Slice(claimed, func(i, j int) bool {
+		return claimed[i].ID < claimed[j].ID
+	})
+	return claimed, nil
+}
+
+// See the docs on interfaces in store.go
+func (s *PostgresStore) EmailSent(ctx context.Context, id int64) (err error) {
+	ctx, span := wikisophiaPostgres.StartSpan(ctx, s.pool, "accounts.PostgresStore.EmailSent")
+	defer func() { tracing.End(span, err) }()
+	if result, err := s.pool.Exec(ctx, deleteEmailQuery, id); err != nil {
+		return fmt.Errorf("failed to delete sent email: %v", err)
+	} else if result.RowsAffected() != 1 {
+		return accounts.QueuedEmailNotExistsError{ID: id}
+	}
+	return nil
+}
+
+// See the docs on interfaces in store.go
+func (s *PostgresStore) EmailFailed(ctx context.Context, id int64, reason string, retryAt time.Time) (err error) {
+	ctx, span := wikisophiaPostgres.StartSpan(ctx, s.pool, "accounts.PostgresStore.EmailFailed")
+	defer func() { tracing.End(span, err) }()
+	var result pgconn.CommandTag
+	if retryAt.IsZero() {
+		result, err = s.pool.Exec(ctx, emailDiedQuery, id, reason, time.Now())
+	} else {
+		result, err = s.pool.Exec(ctx, emailFailedQuery, id, reason, retryAt)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record email failure: %v", err)
+	} else if result.RowsAffected() != 1 {
+		return accounts.QueuedEmailNotExistsError{ID: id}
+	}
+	return nil
+}
+
+// See the docs on interfaces in store.go
+func (s *PostgresStore) FailedEmails(ctx context.Context) (failed []accounts.QueuedEmail, err error) {
+	ctx, span := wikisophiaPostgres.StartSpan(ctx, s.pool, "accounts.PostgresStore.FailedEmails")
+	defer func() { tracing.End(span, err) }()
+	rows, err := s.pool.Query(ctx, selectFailedEmailsQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch failed emails: %v", err)
+	}
+	if failed, err = scanQueuedEmails(rows); err != nil {
+		return nil, fmt.Errorf("failed to fetch failed emails: %v", err)
+	}
+	return failed, nil
+}
+
+// See the docs on interfaces in store.go
+func (s *PostgresStore) RetryEmail(ctx context.Context, id int64) (err error) {
+	ctx, span := wikisophiaPostgres.StartSpan(ctx, s.pool, "accounts.PostgresStore.RetryEmail")
+	defer func() { tracing.End(span, err) }()
+	tx, err := wikisophiaPostgres.BeginTx(ctx, s.pool)
+	if err != nil {
+		return fmt.Errorf("%s: %v", retryEmailErrorMsg, err)
+	}
+	// This does nothing once the transaction is committed.
+	defer tx.Rollback(ctx)
+
+	var email accounts.QueuedEmail
+	var kind string
+	var dead bool
+	if err := tx.QueryRow(ctx, selectRetriedEmailQuery, id).Scan(&kind, &email.Account.ID, &email.Account.Email, &dead); err == pgx.ErrNoRows {
+		return accounts.QueuedEmailNotExistsError{ID: id}
+	} else if err != nil {
+		return fmt.Errorf("%s: %v", retryEmailErrorMsg, err)
+	}
+	email.ID, email.Kind = id, accounts.EmailKind(kind)
+	if !dead {
+		_, err = tx.Exec(ctx, retryEmailQuery, id)
+	} else {
+		var account accounts.Account
+		if account, err = s.renewTokens(ctx, tx, email); errors.As(err, &accounts.StaleQueuedEmailError{}) {
+			return err
+		} else if err == nil {
+			_, err = tx.Exec(ctx, retryDeadEmailQuery, id, account.ResetToken, account.VerificationToken, account.EmailChangeToken)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", retryEmailErrorMsg, err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("%s: %v", retryEmailErrorMsg, err)
+	}
+	return nil
+}
+
+// renewTokens makes new tokens for a dead email through tx, to replace the ones it lost,
+// and returns its Account with them.
+func (s *PostgresStore) renewTokens(ctx context.Context, tx pgx.Tx, email accounts.QueuedEmail) (accounts.Account, error) {
+	account := email.Account
+	var renewed string
+	var err error
+	switch email.Kind {
+	case accounts.EmailKindWelcome, accounts.EmailKindReset:
+		renewed, err = renewToken(ctx, tx, renewResetTokenQuery, s.expiry.Reset, account)
+		account.ResetToken = renewed
+		// Welcome emails only have a verification link if there's still something to verify.
+		if err == nil && renewed != "" && email.Kind == accounts.EmailKindWelcome {
+			account.VerificationToken, err = renewToken(ctx, tx, renewVerificationTokenQuery, s.expiry.Verification, account)
+		}
+	case accounts.EmailKindVerification:
+		renewed, err = renewToken(ctx, tx, renewVerificationTokenQuery, s.expiry.Verification, account)
+		account.VerificationToken = renewed
+	case accounts.EmailKindEmailChange:
+		renewed, err = renewToken(ctx, tx, renewEmailChangeTokenQuery, s.expiry.Verification, account)
+		account.EmailChangeToken = renewed
+	default:
+		// The other emails don't have tokens.
+		return account, nil
+	}
+	if err != nil {
+		return accounts.Account{}, err
+	}
+	if renewed == "" {
+		return accounts.Account{}, accounts.StaleQueuedEmailError{ID: email.ID}
+	}
+	return account, nil
+}
+
+// renewToken replaces one of the account's token hashes with query, and returns the new token.
+// It returns an empty token if query didn't change the account.
+func renewToken(ctx context.Context, tx pgx.Tx, query string, expiry time.Duration, account accounts.Account) (string, error) {
+	token, err := tokens.NewVerificationToken(50)
+	if err != nil {
+		return "", err
+	}
+	result, err := tx.Exec(ctx, query, tokens.Hash(token), time.Now().Add(expiry), account.ID, account.Email)
+	if err != nil {
+		return "", err
+	}
+	if result.RowsAffected() != 1 {
+		return "", nil
+	}
+	return token, nil
+}
+
+// scanQueuedEmails reads rows of queuedEmailColumns, and closes them.
+func scanQueuedEmails(rows pgx.Rows) ([]accounts.QueuedEmail, error) {
+	defer rows.Close()
+	emails := make([]accounts.QueuedEmail, 0)
+	for rows.Next() {
+		var email accounts.QueuedEmail
+		var kind string
+		var lockedUntil, deadAt *time.Time
+		if err := rows.Scan(
+			&email.ID,
+			&kind,
+			&email.Account.ID,
+			&email.Account.Email,
+			&email.Account.ResetToken,
+			&email.Account.VerificationToken,
+			&email.Account.EmailChangeToken,
+			&lockedUntil,
+			&email.CreatedAt,
+			&email.Attempts,
+			&email.NextAttemptAt,
+			&email.LastError,
+			&deadAt,
+		); err != nil {
+			return nil, err
+		}
+		email.Kind = accounts.EmailKind(kind)
+		if lockedUntil != nil {
+			email.LockedUntil = *lockedUntil
+		}
+		if deadAt != nil {
+			email.DeadAt = *deadAt
+		}
+		emails = append(emails, email)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return emails, nil
+}
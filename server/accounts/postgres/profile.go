@@ -0,0 +1,77 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/wikisophia/api/server/accounts"
+	wikisophiaPostgres "github.com/wikisophia/api/server/postgres"
+	"github.com/wikisophia/api/server/tracing"
+)
+
+const selectProfileQuery = `
+SELECT id, email, display_name, bio, preferences::text, deletion_due_at
+FROM accounts
+WHERE id = $1
+  AND purged_at IS NULL;
+`
+
+// NULL parameters leave their columns as they are.
+const updateProfileQuery = `
+UPDATE accounts
+SET display_name = COALESCE($2, display_name),
+    bio = COALESCE($3, bio),
+    preferences = COALESCE($4::jsonb, preferences)
+WHERE id = $1
+  AND purged_at IS NULL
+RETURNING id, email, display_name, bio, preferences::text, deletion_due_at;
+`
+
+// See the docs on interfaces in store.go
+func (s *PostgresStore) AccountProfile(ctx context.Context, id int64) (profile accounts.AccountProfile, err error) {
+	ctx, span := wikisophiaPostgres.StartSpan(ctx, s.pool, "accounts.PostgresStore.AccountProfile")
+	defer func() { tracing.End(span, err) }()
+	profile, err = scanProfile(s.pool.QueryRow(ctx, selectProfileQuery, id))
+	if err == pgx.ErrNoRows {
+		return accounts.AccountProfile{}, accounts.AccountNotExistsError{}
+	} else if err != nil {
+		return accounts.AccountProfile{}, fmt.Errorf("failed to fetch profile: %v", err)
+	}
+	return profile, nil
+}
+
+// See the docs on interfaces in store.go
+func (s *PostgresStore) UpdateProfile(ctx context.Context, id int64, update accounts.ProfileUpdate) (profile accounts.AccountProfile, err error) {
+	ctx, span := wikisophiaPostgres.StartSpan(ctx, s.pool, "accounts.PostgresStore.UpdateProfile")
+	defer func() { tracing.End(span, err) }()
+	var preferences *string
+	if update.Preferences != nil {
+		encoded := string(update.Preferences)
+		preferences = &encoded
+	}
+	profile, err = scanProfile(s.pool.QueryRow(ctx, updateProfileQuery, id, update.DisplayName, update.Bio, preferences))
+	if err == pgx.ErrNoRows {
+		return accounts.AccountProfile{}, accounts.AccountNotExistsError{}
+	} else if err != nil {
+		return accounts.AccountProfile{}, fmt.Errorf("failed to update profile: %v", err)
+	}
+	return profile, nil
+}
+
+func scanProfile(row pgx.Row) (accounts.AccountProfile, error) {
+	var profile accounts.AccountProfile
+	var preferences *string
+	var deletionDueAt *time.Time
+	if err := row.Scan(&profile.ID, &profile.Email, &profile.DisplayName, &profile.Bio, &preferences, &deletionDueAt); err != nil {
+		return accounts.AccountProfile{}, err
+	}
+	if preferences != nil {
+		profile.Preferences = []byte(*preferences)
+	}
+	if deletionDueAt != nil {
+		profile.DeletionDueAt = *deletionDueAt
+	}
+	return profile, nil
+}
@@ -3,82 +3,71 @@ package postgres
 import (
 	"context"
 	"fmt"
-	"log"
 	"time"
 
-	"github.com/jackc/pgx/v4"
 	"github.com/wikisophia/api/server/accounts"
 	"github.com/wikisophia/api/server/accounts/tokens"
+	wikisophiaPostgres "github.com/wikisophia/api/server/postgres"
+	"github.com/wikisophia/api/server/tracing"
 )
 
+// New and existing accounts go through the same single statement, so that the response time
+// doesn't reveal which emails already have accounts. xmax is only 0 on rows which were just inserted.
+// Only new accounts keep the verification token. The email with the tokens is queued in the same statement.
 const newResetTokenQuery = `
-WITH new_row AS (
-	INSERT INTO accounts (email, reset_token, reset_token_expiry)
-	SELECT $1, $2, $3
-	WHERE NOT EXISTS (SELECT 1 FROM accounts WHERE email = $1)
-	RETURNING id
+WITH upserted AS (
+  INSERT INTO accounts (email, reset_token_hash, reset_token_expiry, verification_token_hash, verification_token_expiry)
+  VALUES ($1, $2, $3, $4, $5)
+  ON CONFLICT (email) DO UPDATE
+  SET reset_token_hash = EXCLUDED.reset_token_hash,
+      reset_token_expiry = EXCLUDED.reset_token_expiry
+  RETURNING id, xmax = 0 AS is_new
+), queued AS (
+  INSERT INTO email_outbox (kind, account_id, email, reset_token, verification_token)
+  SELECT CASE WHEN is_new THEN $8 ELSE $9 END, id, $1, $6, CASE WHEN is_new THEN $7 END
+  FROM upserted
 )
-SELECT id, true FROM new_row
-UNION
-SELECT id, false FROM accounts WHERE account = $1;
+SELECT id, is_new FROM upserted;
 `
 
-const updateResetTokenQuery = `
-UPDATE accounts
-SET reset_token = $2,
-		reset_token_expiry = $3
-		password_hash = NULL
-WHERE email = $1
-RETURNING id;
-`
-
-const resetTokenErrorMsg = "failed to save argument"
+const resetTokenErrorMsg = "failed to make a reset token"
 
 // See the docs on interfaces in store.go
-func (store *PostgresStore) NewResetToken(ctx context.Context, email string) (accounts.Account, bool, error) {
+func (store *PostgresStore) NewResetToken(ctx context.Context, email string) (account accounts.Account, isNew bool, err error) {
+	ctx, span := wikisophiaPostgres.StartSpan(ctx, store.pool, "accounts.PostgresStore.NewResetToken")
+	defer func() { tracing.End(span, err) }()
 	token, err := tokens.NewVerificationToken(50)
-	expiration := time.Now().Add(24 * time.Hour)
 	if err != nil {
 		return accounts.Account{}, false, fmt.Errorf("%s: %v", resetTokenErrorMsg, err)
 	}
-
-	transaction, err := store.pool.BeginTx(ctx, pgx.TxOptions{})
+	verificationToken, err := tokens.NewVerificationToken(50)
 	if err != nil {
 		return accounts.Account{}, false, fmt.Errorf("%s: %v", resetTokenErrorMsg, err)
 	}
-	row := transaction.QueryRow(ctx, newResetTokenQuery, email, token, expiration)
+	expiration := time.Now().Add(store.expiry.Reset)
+	verificationExpiration := time.Now().Add(store.expiry.Verification)
+
 	var id int64
-	var isNew bool
-	if err := row.Scan(&id, &isNew); rollbackIfErr(ctx, transaction, err) {
+	if err := store.pool.QueryRow(ctx, newResetTokenQuery,
+		email,
+		tokens.Hash(token),
+		expiration,
+		tokens.Hash(verificationToken),
+		verificationExpiration,
+		token,
+		verificationToken,
+		string(accounts.EmailKindWelcome),
+		string(accounts.EmailKindReset),
+	).Scan(&id, &isNew); err != nil {
 		return accounts.Account{}, false, fmt.Errorf("%s: %v", resetTokenErrorMsg, err)
 	}
-	account := accounts.Account{
+	account = accounts.Account{
 		ID:         id,
 		Email:      email,
 		ResetToken: token,
 	}
-
-	if !isNew {
-		if result, err := transaction.Exec(ctx, updateResetTokenQuery, email, token, expiration); rollbackIfErr(ctx, transaction, err) {
-			return accounts.Account{}, false, fmt.Errorf("%s: %v", resetTokenErrorMsg, err)
-		} else if result.RowsAffected() != 1 {
-			return account, false, nil
-		}
-	}
-
-	if err := transaction.Commit(ctx); rollbackIfErr(ctx, transaction, err) {
-		return accounts.Account{}, false, fmt.Errorf("%s: %v", resetTokenErrorMsg, err)
-	}
-
-	return account, true, nil
-}
-
-func rollbackIfErr(ctx context.Context, transaction pgx.Tx, err error) bool {
-	if err != nil {
-		if rollbackErr := transaction.Rollback(ctx); rollbackErr != nil {
-			log.Printf("ERROR: Failed to rollback transaction: %v", rollbackErr)
-		}
-		return true
+	if isNew {
+		account.VerificationToken = verificationToken
 	}
-	return false
+	return account, isNew, nil
 }
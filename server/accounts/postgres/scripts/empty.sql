@@ -1,2 +1,6 @@
 -- Delete the data out of the accounts database.
+-- Keep this in sync with the tables created in ../migrations.
+DELETE FROM email_outbox;
+DELETE FROM recovery_codes;
+DELETE FROM sessions;
 DELETE FROM accounts;
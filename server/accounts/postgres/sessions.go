@@ -0,0 +1,90 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/wikisophia/api/server/accounts"
+	wikisophiaPostgres "github.com/wikisophia/api/server/postgres"
+	"github.com/wikisophia/api/server/tracing"
+)
+
+// The SELECT inserts nothing if the account doesn't exist.
+const startSessionQuery = `
+INSERT INTO sessions (account_id, issued_at, last_used_at, client)
+SELECT id, $2::timestamptz, $2::timestamptz, $3::varchar
+FROM accounts
+WHERE id = $1
+  AND purged_at IS NULL
+RETURNING id;
+`
+
+// last_used_at is only written once a minute, so that every request doesn't need a write.
+const sessionUsedQuery = `
+UPDATE sessions
+SET last_used_at = $3
+WHERE id = $2
+  AND account_id = $1
+  AND last_used_at <= $4;
+`
+
+const selectAccountSessionsQuery = `
+SELECT id, issued_at, last_used_at, client
+FROM sessions
+WHERE account_id = $1
+ORDER BY id;
+`
+
+// See the docs on interfaces in store.go
+func (s *PostgresStore) StartSession(ctx context.Context, accountID int64, client string, now time.Time) (session accounts.Session, err error) {
+	ctx, span := wikisophiaPostgres.StartSpan(ctx, s.pool, "accounts.PostgresStore.StartSession")
+	defer func() { tracing.End(span, err) }()
+	session = accounts.Session{
+		AccountID:  accountID,
+		IssuedAt:   now,
+		LastUsedAt: now,
+		Client:     accounts.TrimSessionClient(client),
+	}
+	err = s.pool.QueryRow(ctx, startSessionQuery, accountID, now, session.Client).Scan(&session.ID)
+	if err == pgx.ErrNoRows {
+		return accounts.Session{}, accounts.AccountNotExistsError{}
+	} else if err != nil {
+		return accounts.Session{}, fmt.Errorf("failed to start a session: %v", err)
+	}
+	return session, nil
+}
+
+// See the docs on interfaces in store.go
+func (s *PostgresStore) SessionUsed(ctx context.Context, accountID int64, id int64, now time.Time) (err error) {
+	ctx, span := wikisophiaPostgres.StartSpan(ctx, s.pool, "accounts.PostgresStore.SessionUsed")
+	defer func() { tracing.End(span, err) }()
+	if _, err := s.pool.Exec(ctx, sessionUsedQuery, accountID, id, now, now.Add(-time.Minute)); err != nil {
+		return fmt.Errorf("failed to record a session's use: %v", err)
+	}
+	return nil
+}
+
+// See the docs on interfaces in store.go
+func (s *PostgresStore) AccountSessions(ctx context.Context, accountID int64) (sessions []accounts.Session, err error) {
+	ctx, span := wikisophiaPostgres.StartSpan(ctx, s.pool, "accounts.PostgresStore.AccountSessions")
+	defer func() { tracing.End(span, err) }()
+	rows, err := s.pool.Query(ctx, selectAccountSessionsQuery, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sessions: %v", err)
+	}
+	defer rows.Close()
+	sessions = make([]accounts.Session, 0)
+	for rows.Next() {
+		session := accounts.Session{AccountID: accountID}
+		if err := rows.Scan(&session.ID, &session.IssuedAt, &session.LastUsedAt, &session.Client); err != nil {
+			return nil, fmt.Errorf("failed to read sessions: %v", err)
+		}
+		sessions = append(sessions, session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read sessions: %v", err)
+	}
+	return sessions, nil
+}
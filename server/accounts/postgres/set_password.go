@@ -7,63 +7,118 @@ import (
 	"time"
 
 	"github.com/jackc/pgx/v4"
+	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/accounts/tokens"
+	wikisophiaPostgres "github.com/wikisophia/api/server/postgres"
+	"github.com/wikisophia/api/server/tracing"
 )
 
+const selectResetTokenByIdQuery = `
+SELECT email, reset_token_hash, reset_token_expiry
+FROM accounts
+WHERE id = $1;
+`
+
 const setForgottenPasswordQuery = `
 UPDATE accounts
-SET reset_token = NULL,
+SET reset_token_hash = NULL,
     reset_token_expiry = NULL,
-		password_hash = $2
+    failed_logins = 0,
+    locked_until = NULL,
+    password_hash = $2
 WHERE id = $1
-	AND reset_token = $3
+  AND reset_token_hash = $3
   AND reset_token_expiry >= $4;
 `
 
 const selectPasswordByIdQuery = `
-SELECT password_hash
+SELECT email, password_hash
 FROM accounts
 WHERE id = $1;
 `
 
+// The old hash is checked again, in case the password changed while the old one was being matched.
+// Reset tokens from before the change stop working, since they'd undo it.
 const changePasswordQuery = `
 UPDATE accounts
-SET password_hash = $2
-WHERE id = $1;
+SET password_hash = $2,
+    reset_token_hash = NULL,
+    reset_token_expiry = NULL
+WHERE id = $1
+  AND password_hash = $3;
 `
 
 // See the docs on interfaces in store.go
-func (s *PostgresStore) SetForgottenPassword(ctx context.Context, id int64, password, resetToken string) error {
-	if response, err := s.pool.Exec(ctx, setForgottenPasswordQuery, id, password, resetToken, time.Now()); err != nil {
+func (s *PostgresStore) SetForgottenPassword(ctx context.Context, id int64, password, resetToken string) (err error) {
+	ctx, span := wikisophiaPostgres.StartSpan(ctx, s.pool, "accounts.PostgresStore.SetForgottenPassword")
+	defer func() { tracing.End(span, err) }()
+	var email string
+	var storedHash *string
+	var expiry *time.Time
+	if err := s.pool.QueryRow(ctx, selectResetTokenByIdQuery, id).Scan(&email, &storedHash, &expiry); err == pgx.ErrNoRows {
+		return accounts.AccountNotExistsError{}
+	} else if err != nil {
+		return fmt.Errorf("failed to set password: %v", err)
+	}
+	if storedHash == nil || expiry == nil || time.Now().After(*expiry) || !tokens.Matches(resetToken, *storedHash) {
+		return accounts.InvalidResetTokenError{}
+	}
+	if err := s.policy.Check(email, password); err != nil {
 		return err
+	}
+	hash, err := s.hasher.Hash(ctx, password)
+	if err != nil {
+		return fmt.Errorf("failed to set password: %v", err)
+	}
+
+	// If no rows change, someone else used or replaced the token since we read it, or it just expired.
+	if response, err := s.pool.Exec(ctx, setForgottenPasswordQuery, id, hash, *storedHash, time.Now()); err != nil {
+		return fmt.Errorf("failed to set password: %v", err)
 	} else if response.RowsAffected() != 1 {
-		return fmt.Errorf("either no account exists with ID %d, or the reset token was invalid or expired", id)
+		return accounts.InvalidResetTokenError{}
 	}
 	return nil
 }
 
 // See the docs on interfaces in store.go
-func (s *PostgresStore) ChangePassword(ctx context.Context, id int64, oldPassword, newPassword string) error {
+func (s *PostgresStore) ChangePassword(ctx context.Context, id int64, oldPassword, newPassword, code string) (err error) {
+	ctx, span := wikisophiaPostgres.StartSpan(ctx, s.pool, "accounts.PostgresStore.ChangePassword")
+	defer func() { tracing.End(span, err) }()
 	row := s.pool.QueryRow(ctx, selectPasswordByIdQuery, id)
-	var oldPasswordHash string
-	if err := row.Scan(&oldPasswordHash); err == pgx.ErrNoRows {
-		return fmt.Errorf("either no account exists with ID %d, or the old password was incorrect", id)
+	var email string
+	var oldPasswordHash *string
+	if err := row.Scan(&email, &oldPasswordHash); err == pgx.ErrNoRows {
+		return accounts.AccountNotExistsError{}
 	} else if err != nil {
 		return fmt.Errorf("failed to change password: %v", err)
 	}
-	matches, err := s.hasher.Matches(oldPassword, oldPasswordHash)
+	if oldPasswordHash == nil {
+		return accounts.InvalidPasswordError{}
+	}
+	matches, err := s.hasher.Matches(ctx, oldPassword, *oldPasswordHash)
 	if err != nil {
 		return errors.New("error matching password against the database")
 	}
 	if !matches {
-		return fmt.Errorf("either no account exists with ID %d, or the old password was incorrect", id)
+		return accounts.InvalidPasswordError{}
 	}
-	newHash, err := s.hasher.Hash(newPassword)
+	if err := s.policy.Check(email, newPassword); err != nil {
+		return err
+	}
+	if err := s.checkSecondFactor(ctx, id, code); err != nil {
+		return err
+	}
+	newHash, err := s.hasher.Hash(ctx, newPassword)
 	if err != nil {
 		return fmt.Errorf("failed to change password: %v", err)
 	}
-	_, err = s.pool.Exec(ctx, changePasswordQuery, id, newHash)
+	response, err := s.pool.Exec(ctx, changePasswordQuery, id, newHash, *oldPasswordHash)
 	if err != nil {
 		return fmt.Errorf("failed to change password: %v", err)
 	}
+	// If no rows changed, the password changed since we read it.
+	if response.RowsAffected() != 1 {
+		return accounts.InvalidPasswordError{}
+	}
 	return nil
 }
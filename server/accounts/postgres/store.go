@@ -1,32 +1,65 @@
 package postgres
 
 import (
+	"context"
+
 	"log"
 
 	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/accounts/tokens"
 )
 
 // NewPostgresStore returns a Store which can manage accounts.
 // The returned Store.Close() function will *not* close the pool, since we did not open it.
-func NewPostgresStore(pool *pgxpool.Pool, hasher Hasher) *PostgresStore {
+func NewPostgresStore(pool *pgxpool.Pool, hasher Hasher, policy accounts.PasswordPolicy, expiry tokens.Expiry) *PostgresStore {
 	if pool == nil {
 		log.Fatal("A connection pool is required to make an accounts.PostgresStore.")
 	}
+	missingPasswordHash, err := hasher.Hash(context.Background(), missingPassword)
+	if err != nil {
+		log.Fatalf("Failed to hash the password for missing accounts: %v", err)
+	}
 	return &PostgresStore{
-		pool:   pool,
-		hasher: hasher,
+		pool:                pool,
+		hasher:              hasher,
+		policy:              policy,
+		expiry:              expiry,
+		missingPasswordHash: missingPasswordHash,
 	}
 }
 
+// missingPassword is hashed to make PostgresStore.missingPasswordHash.
+const missingPassword = "this account has no password"
+
 type Hasher interface {
 	// Hash a value to a string which encodes the algorithm + salt as well.
-	Hash(value string) (string, error)
+	Hash(ctx context.Context, value string) (string, error)
 	// Check if the given value matches a hash.
-	Matches(value string, hash string) (bool, error)
+	Matches(ctx context.Context, value string, hash string) (bool, error)
+	// Check if a matching hash was made with an older algorithm or weaker params than Hash uses now.
+	NeedsRehash(hash string) bool
 }
 
 // PostgresStore saves account info in Postgres.
 type PostgresStore struct {
 	pool   *pgxpool.Pool
 	hasher Hasher
+	policy accounts.PasswordPolicy
+	// expiry is how long each kind of token can be used for.
+	expiry tokens.Expiry
+	// missingPasswordHash is checked when someone logs into an account which doesn't exist, or has no password.
+	// That makes those logins take as long as ones with the wrong password, so the timing doesn't
+	// reveal which emails have accounts.
+	missingPasswordHash string
+}
+
+// Ping makes sure the database is reachable.
+func (store *PostgresStore) Ping(ctx context.Context) error {
+	conn, err := store.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+	return conn.Conn().Ping(ctx)
 }
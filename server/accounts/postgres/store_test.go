@@ -7,12 +7,14 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 	"github.com/wikisophia/api/server/accounts"
 	accountsPostgres "github.com/wikisophia/api/server/accounts/postgres"
 	"github.com/wikisophia/api/server/accounts/storetest"
+	"github.com/wikisophia/api/server/accounts/tokens"
 	"github.com/wikisophia/api/server/config"
 	"github.com/wikisophia/api/server/passwords"
 	"github.com/wikisophia/api/server/postgres"
@@ -25,6 +27,16 @@ func TestMain(m *testing.M) {
 	os.Exit(m.Run())
 }
 
+// TestMigrationsLoad makes sure the embedded migration files are all well-formed.
+func TestMigrationsLoad(t *testing.T) {
+	loaded, err := accountsPostgres.Migrations()
+	require.NoError(t, err)
+	require.NotEmpty(t, loaded)
+	for i, migration := range loaded {
+		require.Equal(t, i+1, migration.Version, "migration versions should have no gaps")
+	}
+}
+
 // TestPostgresStore makes sure store is consistent with the StoreTests suite.
 // This helps verify:
 //    1. The postgres Store, which is used in prod to keep account info.
@@ -36,10 +48,19 @@ func TestPostgresStore(t *testing.T) {
 
 	cfg := config.MustParse()
 	pool := postgres.NewPGXPool(cfg.AccountsStore.Postgres)
+	loaded, err := accountsPostgres.Migrations()
+	require.NoError(t, err)
+	migrationPool := postgres.NewPGXPool(cfg.AccountsStore.Postgres.ForMigrations())
+	_, err = postgres.NewMigrator(migrationPool, cfg.AccountsStore.Postgres.User, loaded, accountsPostgres.RoleVariable).Up(context.Background())
+	migrationPool.Close()
+	require.NoError(t, err)
 	emptyData, err := ioutil.ReadFile(filepath.Join(".", "scripts", "empty.sql"))
 	require.NoError(t, err)
 	empty := string(emptyData)
-	store := accountsPostgres.NewPostgresStore(pool, passwords.NewHasher(*cfg.Hash))
+	policy, err := passwords.NewPolicy(*cfg.PasswordPolicy)
+	require.NoError(t, err)
+	expiry := tokens.Expiry{Reset: cfg.Tokens.ResetExpiry(), Verification: cfg.Tokens.VerificationExpiry()}
+	store := accountsPostgres.NewPostgresStore(pool, passwords.NewHasher(*cfg.Hash), policy, expiry)
 
 	suite.Run(t, &storetest.StoreTests{
 		StoreFactory: func() accounts.Store {
@@ -48,6 +69,88 @@ func TestPostgresStore(t *testing.T) {
 			return store
 		},
 	})
+	suite.Run(t, &storetest.TimingTests{
+		StoreFactory: func(hasher *storetest.RecordingHasher) accounts.Store {
+			_, err := pool.Exec(context.Background(), empty)
+			require.NoError(t, err)
+			return accountsPostgres.NewPostgresStore(pool, hasher, policy, expiry)
+		},
+		Hasher: passwords.NewHasher(*cfg.Hash),
+	})
+	suite.Run(t, &storetest.PolicyTests{
+		StoreFactory: func(policy accounts.PasswordPolicy) accounts.Store {
+			_, err := pool.Exec(context.Background(), empty)
+			require.NoError(t, err)
+			return accountsPostgres.NewPostgresStore(pool, passwords.NewHasher(*cfg.Hash), policy, expiry)
+		},
+	})
+	suite.Run(t, &storetest.ResetTokenTests{
+		StoreFactory: func(resetTokenExpiry time.Duration) accounts.Store {
+			_, err := pool.Exec(context.Background(), empty)
+			require.NoError(t, err)
+			return accountsPostgres.NewPostgresStore(pool, passwords.NewHasher(*cfg.Hash), policy, tokens.Expiry{Reset: resetTokenExpiry, Verification: expiry.Verification})
+		},
+	})
+	suite.Run(t, &storetest.VerificationTests{
+		StoreFactory: func(expiry tokens.Expiry) accounts.Store {
+			_, err := pool.Exec(context.Background(), empty)
+			require.NoError(t, err)
+			return accountsPostgres.NewPostgresStore(pool, passwords.NewHasher(*cfg.Hash), policy, expiry)
+		},
+	})
+	suite.Run(t, &storetest.EmailChangeTests{
+		StoreFactory: func(expiry tokens.Expiry) accounts.Store {
+			_, err := pool.Exec(context.Background(), empty)
+			require.NoError(t, err)
+			return accountsPostgres.NewPostgresStore(pool, passwords.NewHasher(*cfg.Hash), policy, expiry)
+		},
+	})
+	suite.Run(t, &storetest.ProfileTests{
+		StoreFactory: func() accounts.Store {
+			_, err := pool.Exec(context.Background(), empty)
+			require.NoError(t, err)
+			return accountsPostgres.NewPostgresStore(pool, passwords.NewHasher(*cfg.Hash), policy, expiry)
+		},
+	})
+	suite.Run(t, &storetest.DeletionTests{
+		StoreFactory: func() accounts.Store {
+			_, err := pool.Exec(context.Background(), empty)
+			require.NoError(t, err)
+			return accountsPostgres.NewPostgresStore(pool, passwords.NewHasher(*cfg.Hash), policy, expiry)
+		},
+	})
+	suite.Run(t, &storetest.TwoFactorTests{
+		StoreFactory: func() accounts.Store {
+			_, err := pool.Exec(context.Background(), empty)
+			require.NoError(t, err)
+			return accountsPostgres.NewPostgresStore(pool, passwords.NewHasher(*cfg.Hash), policy, expiry)
+		},
+	})
+	suite.Run(t, &storetest.SessionTests{
+		StoreFactory: func() accounts.Store {
+			_, err := pool.Exec(context.Background(), empty)
+			require.NoError(t, err)
+			return accountsPostgres.NewPostgresStore(pool, passwords.NewHasher(*cfg.Hash), policy, expiry)
+		},
+	})
+	suite.Run(t, &storetest.OutboxTests{
+		StoreFactory: func() accounts.Store {
+			_, err := pool.Exec(context.Background(), empty)
+			require.NoError(t, err)
+			return accountsPostgres.NewPostgresStore(pool, passwords.NewHasher(*cfg.Hash), policy, expiry)
+		},
+	})
+	stronger := *cfg.Hash
+	stronger.Time++
+	suite.Run(t, &storetest.HashingTests{
+		StoreFactory: func(hasher *storetest.RecordingHasher) accounts.Store {
+			_, err := pool.Exec(context.Background(), empty)
+			require.NoError(t, err)
+			return accountsPostgres.NewPostgresStore(pool, hasher, policy, expiry)
+		},
+		Weak:   passwords.NewHasher(*cfg.Hash),
+		Strong: passwords.NewHasher(stronger),
+	})
 
 	pool.Close()
 }
@@ -0,0 +1,342 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/accounts/totp"
+	wikisophiaPostgres "github.com/wikisophia/api/server/postgres"
+	"github.com/wikisophia/api/server/tracing"
+)
+
+const selectTwoFactorQuery = `
+SELECT email, password_hash, totp_secret, totp_pending_secret, totp_last_step, two_factor_required,
+       (SELECT array_agg(code_hash ORDER BY id) FROM recovery_codes WHERE account_id = accounts.id)
+FROM accounts
+WHERE id = $1
+  AND purged_at IS NULL;
+`
+
+// The password hash is checked again, in case the password changed while the old one was being matched.
+const enrollTwoFactorQuery = `
+UPDATE accounts
+SET totp_pending_secret = $2
+WHERE id = $1
+  AND password_hash = $3
+  AND totp_secret IS NULL;
+`
+
+// The pending secret is checked again, in case someone else confirmed or replaced it in the meantime.
+// Any old recovery codes are replaced in the same statement.
+const confirmTwoFactorQuery = `
+WITH confirmed AS (
+  UPDATE accounts
+  SET totp_secret = totp_pending_secret,
+      totp_pending_secret = NULL,
+      totp_last_step = $2
+  WHERE id = $1
+    AND totp_pending_secret = $3
+    AND totp_secret IS NULL
+  RETURNING id
+), cleared AS (
+  DELETE FROM recovery_codes WHERE account_id IN (SELECT id FROM confirmed)
+)
+INSERT INTO recovery_codes (account_id, code_hash)
+SELECT confirmed.id, unnest($4::text[]) FROM confirmed;
+`
+
+// Checking the last step again stops two requests from using the same code at once.
+const useTotpStepQuery = `
+UPDATE accounts
+SET totp_last_step = $2
+WHERE id = $1
+  AND totp_secret = $3
+  AND totp_last_step < $2;
+`
+
+const useRecoveryCodeQuery = `
+DELETE FROM recovery_codes
+WHERE account_id = $1
+  AND code_hash = $2;
+`
+
+const disableTwoFactorQuery = `
+WITH disabled AS (
+  UPDATE accounts
+  SET totp_secret = NULL,
+      totp_pending_secret = NULL,
+      totp_last_step = 0
+  WHERE id = $1
+    AND password_hash = $2
+    AND totp_secret = $3
+    AND NOT two_factor_required
+  RETURNING id
+), cleared AS (
+  DELETE FROM recovery_codes WHERE account_id IN (SELECT id FROM disabled)
+)
+SELECT id FROM disabled;
+`
+
+const selectTwoFactorStatusQuery = `
+SELECT totp_secret IS NOT NULL, two_factor_required, (SELECT COUNT(*) FROM recovery_codes WHERE account_id = accounts.id)
+FROM accounts
+WHERE id = $1
+  AND purged_at IS NULL;
+`
+
+// Moderators must keep two-factor auth, so the requirement can't be taken off of them.
+const requireTwoFactorQuery = `
+UPDATE accounts
+SET two_factor_required = $2
+WHERE id = $1
+  AND purged_at IS NULL
+  AND ($2 OR NOT moderator);
+`
+
+// twoFactorRow is what selectTwoFactorQuery reads.
+type twoFactorRow struct {
+	email              string
+	passwordHash       *string
+	secret             *string
+	pendingSecret      *string
+	lastStep           int64
+	required           bool
+	recoveryCodeHashes []string
+}
+
+// See the docs on interfaces in store.go
+func (s *PostgresStore) EnrollTwoFactor(ctx context.Context, id int64, password string) (enrollment accounts.TwoFactorEnrollment, err error) {
+	ctx, span := wikisophiaPostgres.StartSpan(ctx, s.pool, "accounts.PostgresStore.EnrollTwoFactor")
+	defer func() { tracing.End(span, err) }()
+	row, err := s.twoFactorRow(ctx, id)
+	if err != nil {
+		return accounts.TwoFactorEnrollment{}, err
+	}
+	if err := s.checkPassword(ctx, password, row.passwordHash); err != nil {
+		return accounts.TwoFactorEnrollment{}, err
+	}
+	if row.secret != nil {
+		return accounts.TwoFactorEnrollment{}, accounts.TwoFactorEnabledError{}
+	}
+	secret, err := totp.NewSecret()
+	if err != nil {
+		return accounts.TwoFactorEnrollment{}, fmt.Errorf("failed to enroll in two-factor auth: %v", err)
+	}
+	response, err := s.pool.Exec(ctx, enrollTwoFactorQuery, id, secret, *row.passwordHash)
+	if err != nil {
+		return accounts.TwoFactorEnrollment{}, fmt.Errorf("failed to enroll in two-factor auth: %v", err)
+	}
+	// If no rows changed, the password changed since we read it, or two-factor auth was turned on.
+	if response.RowsAffected() != 1 {
+		return accounts.TwoFactorEnrollment{}, accounts.InvalidPasswordError{}
+	}
+	return accounts.TwoFactorEnrollment{
+		ID:     id,
+		Email:  row.email,
+		Secret: secret,
+	}, nil
+}
+
+// See the docs on interfaces in store.go
+func (s *PostgresStore) ConfirmTwoFactor(ctx context.Context, id int64, code string) (codes []string, err error) {
+	ctx, span := wikisophiaPostgres.StartSpan(ctx, s.pool, "accounts.PostgresStore.ConfirmTwoFactor")
+	defer func() { tracing.End(span, err) }()
+	row, err := s.twoFactorRow(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if row.secret != nil {
+		return nil, accounts.TwoFactorEnabledError{}
+	}
+	if row.pendingSecret == nil {
+		return nil, accounts.TwoFactorNotEnrolledError{}
+	}
+	step, ok, err := totp.Validate(*row.pendingSecret, code, time.Now(), 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to confirm two-factor auth: %v", err)
+	}
+	if !ok {
+		return nil, accounts.InvalidTwoFactorCodeError{}
+	}
+	codes, hashes, err := s.newRecoveryCodes(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to confirm two-factor auth: %v", err)
+	}
+	response, err := s.pool.Exec(ctx, confirmTwoFactorQuery, id, step, *row.pendingSecret, hashes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to confirm two-factor auth: %v", err)
+	}
+	// If no codes were saved, someone else confirmed or replaced the secret since we read it.
+	if response.RowsAffected() == 0 {
+		return nil, accounts.InvalidTwoFactorCodeError{}
+	}
+	return codes, nil
+}
+
+// See the docs on interfaces in store.go
+func (s *PostgresStore) CheckTwoFactor(ctx context.Context, id int64, code string) (err error) {
+	ctx, span := wikisophiaPostgres.StartSpan(ctx, s.pool, "accounts.PostgresStore.CheckTwoFactor")
+	defer func() { tracing.End(span, err) }()
+	row, err := s.twoFactorRow(ctx, id)
+	if err != nil {
+		return err
+	}
+	if row.secret == nil {
+		return accounts.TwoFactorNotEnrolledError{}
+	}
+	return s.useTwoFactorCode(ctx, id, row, code)
+}
+
+// See the docs on interfaces in store.go
+func (s *PostgresStore) DisableTwoFactor(ctx context.Context, id int64, password, code string) (err error) {
+	ctx, span := wikisophiaPostgres.StartSpan(ctx, s.pool, "accounts.PostgresStore.DisableTwoFactor")
+	defer func() { tracing.End(span, err) }()
+	row, err := s.twoFactorRow(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.checkPassword(ctx, password, row.passwordHash); err != nil {
+		return err
+	}
+	if row.secret == nil {
+		return accounts.TwoFactorNotEnrolledError{}
+	}
+	// Check this before the code, so that the code isn't used up.
+	if row.required {
+		return accounts.TwoFactorRequiredError{}
+	}
+	if err := s.useTwoFactorCode(ctx, id, row, code); err != nil {
+		return err
+	}
+
+	var disabledID int64
+	err = s.pool.QueryRow(ctx, disableTwoFactorQuery, id, *row.passwordHash, *row.secret).Scan(&disabledID)
+	// If no rows changed, the password or secret changed since we read them, or two-factor auth became required.
+	if err == pgx.ErrNoRows {
+		status, err := s.TwoFactorStatus(ctx, id)
+		if err != nil {
+			return err
+		}
+		if status.Required {
+			return accounts.TwoFactorRequiredError{}
+		}
+		return accounts.InvalidPasswordError{}
+	} else if err != nil {
+		return fmt.Errorf("failed to disable two-factor auth: %v", err)
+	}
+	return nil
+}
+
+// See the docs on interfaces in store.go
+func (s *PostgresStore) TwoFactorStatus(ctx context.Context, id int64) (status accounts.TwoFactorStatus, err error) {
+	ctx, span := wikisophiaPostgres.StartSpan(ctx, s.pool, "accounts.PostgresStore.TwoFactorStatus")
+	defer func() { tracing.End(span, err) }()
+	err = s.pool.QueryRow(ctx, selectTwoFactorStatusQuery, id).Scan(&status.Enabled, &status.Required, &status.RecoveryCodesLeft)
+	if err == pgx.ErrNoRows {
+		return accounts.TwoFactorStatus{}, accounts.AccountNotExistsError{}
+	} else if err != nil {
+		return accounts.TwoFactorStatus{}, fmt.Errorf("failed to read two-factor status: %v", err)
+	}
+	return status, nil
+}
+
+// See the docs on interfaces in store.go
+func (s *PostgresStore) RequireTwoFactor(ctx context.Context, id int64, required bool) (err error) {
+	ctx, span := wikisophiaPostgres.StartSpan(ctx, s.pool, "accounts.PostgresStore.RequireTwoFactor")
+	defer func() { tracing.End(span, err) }()
+	response, err := s.pool.Exec(ctx, requireTwoFactorQuery, id, required)
+	if err != nil {
+		return fmt.Errorf("failed to require two-factor auth: %v", err)
+	}
+	// If no rows changed, the account doesn't exist, or it's a moderator.
+	if response.RowsAffected() != 1 {
+		if _, err := s.IsModerator(ctx, id); err != nil {
+			return err
+		}
+		return accounts.TwoFactorRequiredError{}
+	}
+	return nil
+}
+
+// twoFactorRow reads the account's two-factor auth columns, or returns an AccountNotExistsError.
+func (s *PostgresStore) twoFactorRow(ctx context.Context, id int64) (twoFactorRow, error) {
+	var row twoFactorRow
+	err := s.pool.QueryRow(ctx, selectTwoFactorQuery, id).Scan(&row.email, &row.passwordHash, &row.secret, &row.pendingSecret,
+		&row.lastStep, &row.required, &row.recoveryCodeHashes)
+	if err == pgx.ErrNoRows {
+		return twoFactorRow{}, accounts.AccountNotExistsError{}
+	} else if err != nil {
+		return twoFactorRow{}, fmt.Errorf("failed to read two-factor auth: %v", err)
+	}
+	return row, nil
+}
+
+// checkSecondFactor uses up the code if the account has two-factor auth on. Methods which need the password
+// call it once the password is known to be right.
+func (s *PostgresStore) checkSecondFactor(ctx context.Context, id int64, code string) error {
+	row, err := s.twoFactorRow(ctx, id)
+	if err != nil {
+		return err
+	}
+	if row.secret == nil {
+		return nil
+	}
+	if code == "" {
+		return accounts.TwoFactorCodeMissingError{}
+	}
+	return s.useTwoFactorCode(ctx, id, row, code)
+}
+
+// useTwoFactorCode checks the code against the TOTP secret and recovery codes in the row, and marks it used.
+func (s *PostgresStore) useTwoFactorCode(ctx context.Context, id int64, row twoFactorRow, code string) error {
+	step, ok, err := totp.Validate(*row.secret, code, time.Now(), row.lastStep)
+	if err != nil {
+		return fmt.Errorf("failed to check two-factor code: %v", err)
+	}
+	if ok {
+		response, err := s.pool.Exec(ctx, useTotpStepQuery, id, step, *row.secret)
+		if err != nil {
+			return fmt.Errorf("failed to use two-factor code: %v", err)
+		}
+		// If no rows changed, someone else used this code, or a later one, in the meantime.
+		if response.RowsAffected() != 1 {
+			return accounts.InvalidTwoFactorCodeError{}
+		}
+		return nil
+	}
+
+	matched, err := totp.MatchRecoveryCode(ctx, s.hasher, code, row.recoveryCodeHashes)
+	if err != nil {
+		return fmt.Errorf("failed to check recovery code: %v", err)
+	}
+	if matched == "" {
+		return accounts.InvalidTwoFactorCodeError{}
+	}
+	response, err := s.pool.Exec(ctx, useRecoveryCodeQuery, id, matched)
+	if err != nil {
+		return fmt.Errorf("failed to use recovery code: %v", err)
+	}
+	// If no rows changed, someone else used the code in the meantime.
+	if response.RowsAffected() != 1 {
+		return accounts.InvalidTwoFactorCodeError{}
+	}
+	return nil
+}
+
+// newRecoveryCodes makes a set of recovery codes, and their hashes.
+func (s *PostgresStore) newRecoveryCodes(ctx context.Context) ([]string, []string, error) {
+	codes, err := totp.NewRecoveryCodes()
+	if err != nil {
+		return nil, nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		if hashes[i], err = totp.HashRecoveryCode(ctx, s.hasher, code); err != nil {
+			return nil, nil, err
+		}
+	}
+	return codes, hashes, nil
+}
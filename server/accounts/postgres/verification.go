@@ -0,0 +1,123 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/accounts/tokens"
+	wikisophiaPostgres "github.com/wikisophia/api/server/postgres"
+	"github.com/wikisophia/api/server/tracing"
+)
+
+// The email with the token is queued in the same statement.
+const updateVerificationTokenQuery = `
+WITH updated AS (
+  UPDATE accounts
+  SET verification_token_hash = $2,
+      verification_token_expiry = $3
+  WHERE email = $1
+    AND email_verified_at IS NULL
+  RETURNING id
+), queued AS (
+  INSERT INTO email_outbox (kind, account_id, email, verification_token)
+  SELECT $5, id, $1, $4
+  FROM updated
+)
+SELECT id FROM updated;
+`
+
+const selectEmailVerifiedQuery = `SELECT email_verified_at IS NOT NULL FROM accounts WHERE email = $1;`
+
+const selectVerificationTokenByIdQuery = `
+SELECT verification_token_hash, verification_token_expiry
+FROM accounts
+WHERE id = $1;
+`
+
+const verifyEmailQuery = `
+UPDATE accounts
+SET email_verified_at = $2,
+    verification_token_hash = NULL,
+    verification_token_expiry = NULL
+WHERE id = $1
+  AND verification_token_hash = $3
+  AND verification_token_expiry >= $2;
+`
+
+const selectEmailVerifiedAtQuery = `SELECT email_verified_at FROM accounts WHERE id = $1 AND purged_at IS NULL;`
+
+const verificationTokenErrorMsg = "failed to make a verification token"
+
+// See the docs on interfaces in store.go
+func (s *PostgresStore) NewVerificationToken(ctx context.Context, email string) (account accounts.Account, err error) {
+	ctx, span := wikisophiaPostgres.StartSpan(ctx, s.pool, "accounts.PostgresStore.NewVerificationToken")
+	defer func() { tracing.End(span, err) }()
+	token, err := tokens.NewVerificationToken(50)
+	if err != nil {
+		return accounts.Account{}, fmt.Errorf("%s: %v", verificationTokenErrorMsg, err)
+	}
+	expiration := time.Now().Add(s.expiry.Verification)
+
+	var id int64
+	err = s.pool.QueryRow(ctx, updateVerificationTokenQuery, email, tokens.Hash(token), expiration, token, string(accounts.EmailKindVerification)).Scan(&id)
+	if err == pgx.ErrNoRows {
+		// Either there's no account, or it's verified already.
+		var verified bool
+		if err := s.pool.QueryRow(ctx, selectEmailVerifiedQuery, email).Scan(&verified); err == pgx.ErrNoRows {
+			return accounts.Account{}, accounts.AccountNotExistsError{Email: email}
+		} else if err != nil {
+			return accounts.Account{}, fmt.Errorf("%s: %v", verificationTokenErrorMsg, err)
+		}
+		return accounts.Account{}, accounts.EmailAlreadyVerifiedError{Email: email}
+	} else if err != nil {
+		return accounts.Account{}, fmt.Errorf("%s: %v", verificationTokenErrorMsg, err)
+	}
+	return accounts.Account{
+		ID:                id,
+		Email:             email,
+		VerificationToken: token,
+	}, nil
+}
+
+// See the docs on interfaces in store.go
+func (s *PostgresStore) VerifyEmail(ctx context.Context, id int64, token string) (err error) {
+	ctx, span := wikisophiaPostgres.StartSpan(ctx, s.pool, "accounts.PostgresStore.VerifyEmail")
+	defer func() { tracing.End(span, err) }()
+	var storedHash *string
+	var expiry *time.Time
+	if err := s.pool.QueryRow(ctx, selectVerificationTokenByIdQuery, id).Scan(&storedHash, &expiry); err == pgx.ErrNoRows {
+		return accounts.AccountNotExistsError{}
+	} else if err != nil {
+		return fmt.Errorf("failed to verify email: %v", err)
+	}
+	if storedHash == nil || expiry == nil || time.Now().After(*expiry) || !tokens.Matches(token, *storedHash) {
+		return accounts.InvalidVerificationTokenError{}
+	}
+
+	// If no rows change, someone else used or replaced the token since we read it, or it just expired.
+	if response, err := s.pool.Exec(ctx, verifyEmailQuery, id, time.Now(), *storedHash); err != nil {
+		return fmt.Errorf("failed to verify email: %v", err)
+	} else if response.RowsAffected() != 1 {
+		return accounts.InvalidVerificationTokenError{}
+	}
+	return nil
+}
+
+// See the docs on interfaces in store.go
+func (s *PostgresStore) EmailVerifiedAt(ctx context.Context, id int64) (verifiedAt time.Time, err error) {
+	ctx, span := wikisophiaPostgres.StartSpan(ctx, s.pool, "accounts.PostgresStore.EmailVerifiedAt")
+	defer func() { tracing.End(span, err) }()
+	var stored *time.Time
+	if err := s.pool.QueryRow(ctx, selectEmailVerifiedAtQuery, id).Scan(&stored); err == pgx.ErrNoRows {
+		return time.Time{}, accounts.AccountNotExistsError{}
+	} else if err != nil {
+		return time.Time{}, fmt.Errorf("failed to fetch email verification time: %v", err)
+	}
+	if stored == nil {
+		return time.Time{}, nil
+	}
+	return *stored, nil
+}
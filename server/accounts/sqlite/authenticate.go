@@ -0,0 +1,66 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+
+	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/logging"
+)
+
+const authenticateQuery = `
+SELECT id, password_hash
+FROM accounts
+WHERE email = ?;
+`
+
+// rehashQuery only replaces the hash which was checked, in case the password changed in the meantime.
+const rehashQuery = `
+UPDATE accounts
+SET password_hash = ?
+WHERE id = ?
+  AND password_hash = ?;
+`
+
+// See the docs on interfaces in store.go
+func (s *SQLiteStore) Authenticate(ctx context.Context, email, password string) (int64, error) {
+	var id int64
+	var hashedPassword sql.NullString
+	if err := s.db.QueryRowContext(ctx, authenticateQuery, email).Scan(&id, &hashedPassword); err == sql.ErrNoRows {
+		s.hasher.Matches(ctx, password, s.missingPasswordHash)
+		return -1, accounts.AccountNotExistsError{Email: email}
+	} else if err != nil {
+		return -1, fmt.Errorf("failed to authenticate: %v", err)
+	}
+	if !hashedPassword.Valid {
+		s.hasher.Matches(ctx, password, s.missingPasswordHash)
+		return -1, accounts.InvalidPasswordError{}
+	}
+
+	match, err := s.hasher.Matches(ctx, password, hashedPassword.String)
+	if err != nil {
+		return -1, accounts.CorruptedPasswordError{Email: email}
+	}
+	if !match {
+		return -1, accounts.InvalidPasswordError{}
+	}
+	if s.hasher.NeedsRehash(hashedPassword.String) {
+		if err := s.rehash(ctx, id, password, hashedPassword.String); err != nil {
+			// The login is still valid, so just try again next time.
+			logging.FromContext(ctx).Warn("failed to rehash password", slog.Int64("account_id", id), slog.Any("error", err))
+		}
+	}
+	return id, nil
+}
+
+// rehash replaces oldHash with a new hash of the password, made with the hasher's current params.
+func (s *SQLiteStore) rehash(ctx context.Context, id int64, password, oldHash string) error {
+	newHash, err := s.hasher.Hash(ctx, password)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, rehashQuery, newHash, id, oldHash)
+	return err
+}
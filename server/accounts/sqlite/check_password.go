@@ -0,0 +1,46 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/wikisophia/api/server/accounts"
+)
+
+const selectUnpurgedPasswordQuery = `
+SELECT email, password_hash
+FROM accounts
+WHERE id = ?
+  AND purged_at IS NULL;
+`
+
+// accountPassword returns the account's email and password hash, for methods which check its password.
+// Purged accounts are treated as though they didn't exist.
+func (s *SQLiteStore) accountPassword(ctx context.Context, id int64) (string, sql.NullString, error) {
+	var email string
+	var hash sql.NullString
+	if err := s.db.QueryRowContext(ctx, selectUnpurgedPasswordQuery, id).Scan(&email, &hash); err == sql.ErrNoRows {
+		return "", sql.NullString{}, accounts.AccountNotExistsError{}
+	} else if err != nil {
+		return "", sql.NullString{}, fmt.Errorf("failed to read password: %v", err)
+	}
+	return email, hash, nil
+}
+
+// checkPassword returns an InvalidPasswordError unless the password matches the hash.
+// Accounts without a password take as long to check as the ones with one.
+func (s *SQLiteStore) checkPassword(ctx context.Context, password string, hash sql.NullString) error {
+	if !hash.Valid {
+		s.hasher.Matches(ctx, password, s.missingPasswordHash)
+		return accounts.InvalidPasswordError{}
+	}
+	matches, err := s.hasher.Matches(ctx, password, hash.String)
+	if err != nil {
+		return fmt.Errorf("failed to check password: %v", err)
+	}
+	if !matches {
+		return accounts.InvalidPasswordError{}
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/sqlite"
+)
+
+// The password hash is checked again, in case the password changed while the old one was being matched.
+const scheduleDeletionQuery = `
+UPDATE accounts
+SET deletion_due_at = ?
+WHERE id = ?
+  AND password_hash = ?;
+`
+
+const cancelDeletionQuery = `
+UPDATE accounts
+SET deletion_due_at = NULL
+WHERE id = ?
+  AND purged_at IS NULL;
+`
+
+const selectDueDeletionsQuery = `
+SELECT id
+FROM accounts
+WHERE deletion_due_at <= ?
+  AND purged_at IS NULL;
+`
+
+// Everything which could identify the account's owner is cleared. The row is kept so that its ID isn't reused.
+const purgeAccountQuery = `
+UPDATE accounts
+SET email = ?,
+    password_hash = NULL,
+    reset_token_hash = NULL,
+    reset_token_expiry = NULL,
+    email_verified_at = NULL,
+    verification_token_hash = NULL,
+    verification_token_expiry = NULL,
+    new_email = NULL,
+    email_change_token_hash = NULL,
+    email_change_token_expiry = NULL,
+    failed_logins = 0,
+    locked_until = NULL,
+    display_name = '',
+    bio = '',
+    preferences = NULL,
+    deletion_due_at = NULL,
+    totp_secret = NULL,
+    totp_pending_secret = NULL,
+    totp_last_step = 0,
+    two_factor_required = 0,
+    moderator = 0,
+    purged_at = ?
+WHERE id = ?;
+`
+
+const dropAccountEmailsQuery = `DELETE FROM email_outbox WHERE account_id = ?;`
+
+// See the docs on interfaces in store.go
+func (s *SQLiteStore) ScheduleDeletion(ctx context.Context, id int64, password string, dueAt time.Time) error {
+	_, passwordHash, err := s.accountPassword(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.checkPassword(ctx, password, passwordHash); err != nil {
+		return err
+	}
+
+	result, err := s.db.ExecContext(ctx, scheduleDeletionQuery, dueAt.Unix(), id, passwordHash.String)
+	if err != nil {
+		return fmt.Errorf("failed to schedule deletion: %v", err)
+	}
+	// If no rows changed, the password changed since we read it.
+	if affected, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to schedule deletion: %v", err)
+	} else if affected != 1 {
+		return accounts.InvalidPasswordError{}
+	}
+	return nil
+}
+
+// See the docs on interfaces in store.go
+func (s *SQLiteStore) CancelDeletion(ctx context.Context, id int64) error {
+	result, err := s.db.ExecContext(ctx, cancelDeletionQuery, id)
+	if err != nil {
+		return fmt.Errorf("failed to cancel deletion: %v", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to cancel deletion: %v", err)
+	} else if affected != 1 {
+		return accounts.AccountNotExistsError{}
+	}
+	return nil
+}
+
+// See the docs on interfaces in store.go
+func (s *SQLiteStore) PurgeAccounts(ctx context.Context, now time.Time) (int, error) {
+	transaction, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge accounts: %v", err)
+	}
+	ids, err := dueDeletions(ctx, transaction, now)
+	for _, id := range ids {
+		if err != nil {
+			break
+		}
+		err = purgeAccount(ctx, transaction, id, now)
+	}
+	if sqlite.RollbackIfErr(transaction, err) {
+		return 0, fmt.Errorf("failed to purge accounts: %v", err)
+	}
+	if err := transaction.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to purge accounts: %v", err)
+	}
+	return len(ids), nil
+}
+
+func dueDeletions(ctx context.Context, transaction *sql.Tx, now time.Time) ([]int64, error) {
+	rows, err := transaction.QueryContext(ctx, selectDueDeletionsQuery, now.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func purgeAccount(ctx context.Context, transaction *sql.Tx, id int64, now time.Time) error {
+	placeholder, err := accounts.PurgedEmail(id)
+	if err != nil {
+		return err
+	}
+	if _, err := transaction.ExecContext(ctx, purgeAccountQuery, placeholder, now.Unix(), id); err != nil {
+		return err
+	}
+	if _, err := transaction.ExecContext(ctx, deleteRecoveryCodesQuery, id); err != nil {
+		return err
+	}
+	if _, err := transaction.ExecContext(ctx, dropAccountSessionsQuery, id); err != nil {
+		return err
+	}
+	_, err = transaction.ExecContext(ctx, dropAccountEmailsQuery, id)
+	return err
+}
@@ -0,0 +1,131 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/accounts/tokens"
+	"github.com/wikisophia/api/server/sqlite"
+)
+
+// The password hash is checked again, in case the password changed while the old one was being matched.
+const requestEmailChangeQuery = `
+UPDATE accounts
+SET new_email = ?,
+    email_change_token_hash = ?,
+    email_change_token_expiry = ?
+WHERE id = ?
+  AND password_hash = ?;
+`
+
+const selectEmailChangeTokenByIdQuery = `
+SELECT new_email, email_change_token_hash, email_change_token_expiry
+FROM accounts
+WHERE id = ?;
+`
+
+// Tokens sent to the old email are cleared, since they shouldn't work once it isn't the account's.
+const confirmEmailChangeQuery = `
+UPDATE accounts
+SET email = new_email,
+    email_verified_at = ?,
+    new_email = NULL,
+    email_change_token_hash = NULL,
+    email_change_token_expiry = NULL,
+    reset_token_hash = NULL,
+    reset_token_expiry = NULL,
+    verification_token_hash = NULL,
+    verification_token_expiry = NULL
+WHERE id = ?
+  AND email_change_token_hash = ?
+  AND email_change_token_expiry >= ?;
+`
+
+const emailChangeErrorMsg = "failed to request email change"
+
+// See the docs on interfaces in store.go
+func (s *SQLiteStore) RequestEmailChange(ctx context.Context, id int64, password, newEmail, code string) (accounts.Account, error) {
+	email, passwordHash, err := s.accountPassword(ctx, id)
+	if err != nil {
+		return accounts.Account{}, err
+	}
+	if err := s.checkPassword(ctx, password, passwordHash); err != nil {
+		return accounts.Account{}, err
+	}
+	if newEmail == email {
+		return accounts.Account{}, accounts.EmailExistsError{Email: newEmail}
+	}
+	if err := s.checkSecondFactor(ctx, id, code); err != nil {
+		return accounts.Account{}, err
+	}
+	token, err := tokens.NewVerificationToken(50)
+	if err != nil {
+		return accounts.Account{}, fmt.Errorf("%s: %v", emailChangeErrorMsg, err)
+	}
+	expiration := time.Now().Add(s.expiry.Verification).Unix()
+
+	transaction, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return accounts.Account{}, fmt.Errorf("%s: %v", emailChangeErrorMsg, err)
+	}
+	result, err := transaction.ExecContext(ctx, requestEmailChangeQuery, newEmail, tokens.Hash(token), expiration, id, passwordHash.String)
+	var affected int64
+	if err == nil {
+		affected, err = result.RowsAffected()
+	}
+	// If no rows changed, the password changed since we read it.
+	if err == nil && affected != 1 {
+		transaction.Rollback()
+		return accounts.Account{}, accounts.InvalidPasswordError{}
+	}
+	account := accounts.Account{
+		ID:               id,
+		Email:            newEmail,
+		EmailChangeToken: token,
+	}
+	if err == nil {
+		err = queueEmail(ctx, transaction, accounts.QueuedEmail{Kind: accounts.EmailKindEmailChange, Account: account})
+	}
+	if err == nil {
+		err = queueEmail(ctx, transaction, accounts.QueuedEmail{Kind: accounts.EmailKindEmailChangeNotice, Account: accounts.Account{ID: id, Email: email}})
+	}
+	if sqlite.RollbackIfErr(transaction, err) {
+		return accounts.Account{}, fmt.Errorf("%s: %v", emailChangeErrorMsg, err)
+	}
+	if err := transaction.Commit(); err != nil {
+		return accounts.Account{}, fmt.Errorf("%s: %v", emailChangeErrorMsg, err)
+	}
+	return account, nil
+}
+
+// See the docs on interfaces in store.go
+func (s *SQLiteStore) ConfirmEmailChange(ctx context.Context, id int64, token string) error {
+	var newEmail, storedHash sql.NullString
+	var expiry sql.NullInt64
+	if err := s.db.QueryRowContext(ctx, selectEmailChangeTokenByIdQuery, id).Scan(&newEmail, &storedHash, &expiry); err == sql.ErrNoRows {
+		return accounts.AccountNotExistsError{}
+	} else if err != nil {
+		return fmt.Errorf("failed to confirm email change: %v", err)
+	}
+	if !newEmail.Valid || !storedHash.Valid || !expiry.Valid || time.Now().Unix() > expiry.Int64 || !tokens.Matches(token, storedHash.String) {
+		return accounts.InvalidEmailChangeTokenError{}
+	}
+
+	now := time.Now().Unix()
+	result, err := s.db.ExecContext(ctx, confirmEmailChangeQuery, now, id, storedHash.String, now)
+	if sqlite.IsUniqueViolation(err) {
+		return accounts.EmailExistsError{Email: newEmail.String}
+	} else if err != nil {
+		return fmt.Errorf("failed to confirm email change: %v", err)
+	}
+	// If this fails, someone else used or replaced the token since we read it, or it just expired.
+	if affected, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to confirm email change: %v", err)
+	} else if affected != 1 {
+		return accounts.InvalidEmailChangeTokenError{}
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/sqlite"
+)
+
+const exportAccountsQuery = `
+SELECT id, email, COALESCE(password_hash, ''), email_verified_at, display_name, bio, preferences, deletion_due_at, purged_at,
+       COALESCE(totp_secret, ''), totp_last_step, two_factor_required, moderator
+FROM accounts
+ORDER BY id;
+`
+
+const exportRecoveryCodesQuery = `
+SELECT account_id, code_hash
+FROM recovery_codes
+ORDER BY id;
+`
+
+const hasAccountsQuery = `SELECT EXISTS (SELECT 1 FROM accounts);`
+
+// INTEGER PRIMARY KEY columns pick max(id)+1 for new rows,
+// so imported IDs don't need any special handling afterwards.
+const importAccountQuery = `
+INSERT INTO accounts (id, email, password_hash, email_verified_at, display_name, bio, preferences, deletion_due_at, purged_at,
+                      totp_secret, totp_last_step, two_factor_required, moderator)
+VALUES (?, ?, NULLIF(?, ''), ?, ?, ?, ?, ?, ?, NULLIF(?, ''), ?, ?, ?);
+`
+
+// See the docs on interfaces in store.go
+func (s *SQLiteStore) ExportAccounts(ctx context.Context) ([]accounts.StoredAccount, error) {
+	rows, err := s.db.QueryContext(ctx, exportAccountsQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export accounts: %v", err)
+	}
+	defer rows.Close()
+
+	var exported []accounts.StoredAccount
+	for rows.Next() {
+		var account accounts.StoredAccount
+		var verifiedAt sql.NullInt64
+		var preferences sql.NullString
+		var deletionDueAt, purgedAt sql.NullInt64
+		if err := rows.Scan(&account.ID, &account.Email, &account.PasswordHash, &verifiedAt, &account.DisplayName, &account.Bio, &preferences,
+			&deletionDueAt, &purgedAt, &account.TwoFactorSecret, &account.TwoFactorLastStep, &account.TwoFactorRequired, &account.Moderator); err != nil {
+			return nil, fmt.Errorf("export result scan failed: %v", err)
+		}
+		if verifiedAt.Valid {
+			at := time.Unix(verifiedAt.Int64, 0)
+			account.EmailVerifiedAt = &at
+		}
+		if preferences.Valid {
+			account.Preferences = []byte(preferences.String)
+		}
+		account.DeletionDueAt = unixTime(deletionDueAt)
+		account.PurgedAt = unixTime(purgedAt)
+		exported = append(exported, account)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to export accounts: %v", err)
+	}
+	if err := s.exportRecoveryCodes(ctx, exported); err != nil {
+		return nil, fmt.Errorf("failed to export recovery codes: %v", err)
+	}
+	return exported, nil
+}
+
+// exportRecoveryCodes adds the recovery code hashes to the exported accounts.
+func (s *SQLiteStore) exportRecoveryCodes(ctx context.Context, exported []accounts.StoredAccount) error {
+	indexes := make(map[int64]int, len(exported))
+	for i, account := range exported {
+		indexes[account.ID] = i
+	}
+	rows, err := s.db.QueryContext(ctx, exportRecoveryCodesQuery)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var hash string
+		if err := rows.Scan(&id, &hash); err != nil {
+			return err
+		}
+		if i, ok := indexes[id]; ok {
+			exported[i].RecoveryCodeHashes = append(exported[i].RecoveryCodeHashes, hash)
+		}
+	}
+	return rows.Err()
+}
+
+// See the docs on interfaces in store.go
+func (s *SQLiteStore) ImportAccounts(ctx context.Context, imported []accounts.StoredAccount) error {
+	transaction, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to import accounts: %v", err)
+	}
+	var exists bool
+	err = transaction.QueryRowContext(ctx, hasAccountsQuery).Scan(&exists)
+	if sqlite.RollbackIfErr(transaction, err) {
+		return fmt.Errorf("failed to check for existing accounts: %v", err)
+	}
+	if exists {
+		transaction.Rollback()
+		return accounts.StoreNotEmptyError{}
+	}
+	for _, account := range imported {
+		err = importAccount(ctx, transaction, account)
+		// email is the only UNIQUE column. A duplicate ID violates the PRIMARY KEY instead.
+		if sqlite.IsUniqueViolation(err) {
+			transaction.Rollback()
+			return accounts.EmailExistsError{Email: account.Email}
+		}
+		if sqlite.RollbackIfErr(transaction, err) {
+			return fmt.Errorf("failed to import account %d: %v", account.ID, err)
+		}
+	}
+	if err := transaction.Commit(); err != nil {
+		return fmt.Errorf("failed to import accounts: %v", err)
+	}
+	return nil
+}
+
+// importAccount saves one account and its recovery codes as part of an import.
+func importAccount(ctx context.Context, transaction *sql.Tx, account accounts.StoredAccount) error {
+	var verifiedAt sql.NullInt64
+	if account.EmailVerifiedAt != nil {
+		verifiedAt = sql.NullInt64{Int64: account.EmailVerifiedAt.Unix(), Valid: true}
+	}
+	var preferences sql.NullString
+	if account.Preferences != nil {
+		preferences = sql.NullString{String: string(account.Preferences), Valid: true}
+	}
+	if _, err := transaction.ExecContext(ctx, importAccountQuery, account.ID, account.Email, account.PasswordHash, verifiedAt,
+		account.DisplayName, account.Bio, preferences, unixSeconds(account.DeletionDueAt), unixSeconds(account.PurgedAt),
+		account.TwoFactorSecret, account.TwoFactorLastStep, account.TwoFactorRequired, account.Moderator); err != nil {
+		return err
+	}
+	for _, hash := range account.RecoveryCodeHashes {
+		if _, err := transaction.ExecContext(ctx, insertRecoveryCodeQuery, account.ID, hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unixTime converts a nullable unix seconds column to a *time.Time.
+func unixTime(seconds sql.NullInt64) *time.Time {
+	if !seconds.Valid {
+		return nil
+	}
+	at := time.Unix(seconds.Int64, 0)
+	return &at
+}
+
+// unixSeconds converts a *time.Time to a nullable unix seconds column.
+func unixSeconds(at *time.Time) sql.NullInt64 {
+	if at == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: at.Unix(), Valid: true}
+}
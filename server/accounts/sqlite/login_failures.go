@@ -0,0 +1,92 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/wikisophia/api/server/accounts"
+)
+
+const selectLoginFailuresQuery = `
+SELECT id, failed_logins, locked_until
+FROM accounts
+WHERE email = ?;
+`
+
+const recordLoginFailureQuery = `
+UPDATE accounts
+SET failed_logins = failed_logins + 1
+WHERE id = ?
+RETURNING failed_logins;
+`
+
+const lockAccountQuery = `
+UPDATE accounts
+SET locked_until = ?
+WHERE id = ?;
+`
+
+const clearLoginFailuresQuery = `
+UPDATE accounts
+SET failed_logins = 0,
+    locked_until = NULL
+WHERE id = ?;
+`
+
+// See the docs on interfaces in store.go
+func (s *SQLiteStore) LoginFailures(ctx context.Context, email string) (accounts.LoginFailures, error) {
+	var failures accounts.LoginFailures
+	var lockedUntil sql.NullInt64
+	if err := s.db.QueryRowContext(ctx, selectLoginFailuresQuery, email).Scan(&failures.AccountID, &failures.Count, &lockedUntil); err == sql.ErrNoRows {
+		return accounts.LoginFailures{}, accounts.AccountNotExistsError{Email: email}
+	} else if err != nil {
+		return accounts.LoginFailures{}, fmt.Errorf("failed to fetch login failures: %v", err)
+	}
+	if lockedUntil.Valid {
+		failures.LockedUntil = time.Unix(lockedUntil.Int64, 0)
+	}
+	return failures, nil
+}
+
+// See the docs on interfaces in store.go
+func (s *SQLiteStore) RecordLoginFailure(ctx context.Context, id int64) (int, error) {
+	var count int
+	if err := s.db.QueryRowContext(ctx, recordLoginFailureQuery, id).Scan(&count); err == sql.ErrNoRows {
+		return 0, accounts.AccountNotExistsError{}
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to record login failure: %v", err)
+	}
+	return count, nil
+}
+
+// See the docs on interfaces in store.go
+func (s *SQLiteStore) LockAccount(ctx context.Context, id int64, until time.Time) error {
+	// Round up, so that the account is never unlocked early.
+	lockedUntil := until.Unix()
+	if until.After(time.Unix(lockedUntil, 0)) {
+		lockedUntil++
+	}
+	return s.execForAccount(ctx, "failed to lock account", lockAccountQuery, lockedUntil, id)
+}
+
+// See the docs on interfaces in store.go
+func (s *SQLiteStore) ClearLoginFailures(ctx context.Context, id int64) error {
+	return s.execForAccount(ctx, "failed to clear login failures", clearLoginFailuresQuery, id)
+}
+
+// execForAccount runs a query which should update exactly one account.
+// If it updates none, it returns an AccountNotExistsError.
+func (s *SQLiteStore) execForAccount(ctx context.Context, errorMsg, query string, args ...interface{}) error {
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("%s: %v", errorMsg, err)
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("%s: %v", errorMsg, err)
+	} else if affected != 1 {
+		return accounts.AccountNotExistsError{}
+	}
+	return nil
+}
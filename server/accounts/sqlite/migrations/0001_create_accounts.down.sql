@@ -0,0 +1,2 @@
+-- Delete the stuff created by 0001_create_accounts.up.sql
+DROP TABLE IF EXISTS accounts;
@@ -0,0 +1,15 @@
+-- Create the stuff inside the accounts database.
+-- This mirrors the Postgres schema. Expiry times are unix seconds, so that they compare correctly.
+CREATE TABLE accounts (
+  id INTEGER PRIMARY KEY,
+  email TEXT NOT NULL UNIQUE,
+  reset_token TEXT,
+  reset_token_expiry INTEGER,
+  password_hash TEXT,
+  created_on TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  last_modified TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  CONSTRAINT tokens_must_expire CHECK (reset_token IS NULL OR reset_token_expiry IS NOT NULL)
+);
+CREATE TRIGGER update_accounts_last_modified AFTER UPDATE OF email, reset_token, reset_token_expiry, password_hash ON accounts BEGIN
+  UPDATE accounts SET last_modified = CURRENT_TIMESTAMP WHERE id = new.id;
+END;
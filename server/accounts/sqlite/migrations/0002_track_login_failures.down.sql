@@ -0,0 +1,3 @@
+-- Delete the stuff created by 0002_track_login_failures.up.sql
+ALTER TABLE accounts DROP COLUMN locked_until;
+ALTER TABLE accounts DROP COLUMN failed_logins;
@@ -0,0 +1,4 @@
+-- Count the failed logins on each account, so that repeated guesses can be locked out.
+-- locked_until is in unix seconds, like reset_token_expiry.
+ALTER TABLE accounts ADD COLUMN failed_logins INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE accounts ADD COLUMN locked_until INTEGER;
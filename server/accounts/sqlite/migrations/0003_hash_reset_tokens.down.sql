@@ -0,0 +1,3 @@
+-- Undo 0003_hash_reset_tokens.up.sql. The hashes can't be turned back into tokens, so they're cleared.
+UPDATE accounts SET reset_token_hash = NULL, reset_token_expiry = NULL;
+ALTER TABLE accounts RENAME COLUMN reset_token_hash TO reset_token;
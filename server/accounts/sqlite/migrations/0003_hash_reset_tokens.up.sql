@@ -0,0 +1,4 @@
+-- Store a hash of each reset token instead of the token itself.
+-- The old tokens can't be hashed in SQL, so they're cleared. Their owners can ask for new ones.
+UPDATE accounts SET reset_token = NULL, reset_token_expiry = NULL;
+ALTER TABLE accounts RENAME COLUMN reset_token TO reset_token_hash;
@@ -0,0 +1,4 @@
+-- Delete the stuff created by 0004_verify_emails.up.sql
+ALTER TABLE accounts DROP COLUMN verification_token_expiry;
+ALTER TABLE accounts DROP COLUMN verification_token_hash;
+ALTER TABLE accounts DROP COLUMN email_verified_at;
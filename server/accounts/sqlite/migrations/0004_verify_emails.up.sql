@@ -0,0 +1,5 @@
+-- Track which accounts have proven that they own their email, separately from password resets.
+-- email_verified_at and verification_token_expiry are in unix seconds, like reset_token_expiry.
+ALTER TABLE accounts ADD COLUMN email_verified_at INTEGER;
+ALTER TABLE accounts ADD COLUMN verification_token_hash TEXT;
+ALTER TABLE accounts ADD COLUMN verification_token_expiry INTEGER;
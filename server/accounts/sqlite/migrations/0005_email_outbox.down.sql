@@ -0,0 +1,2 @@
+-- Delete the stuff created by 0005_email_outbox.up.sql
+DROP TABLE IF EXISTS email_outbox;
@@ -0,0 +1,17 @@
+-- Queue emails in the same transaction as the tokens they send, so that failed sends can be retried.
+-- The tokens are kept until the email is sent. Times are unix seconds, like the token expiries.
+CREATE TABLE email_outbox (
+  id INTEGER PRIMARY KEY,
+  kind TEXT NOT NULL,
+  account_id INTEGER NOT NULL REFERENCES accounts (id) ON DELETE CASCADE,
+  email TEXT NOT NULL,
+  reset_token TEXT,
+  verification_token TEXT,
+  locked_until INTEGER,
+  created_at INTEGER NOT NULL,
+  attempts INTEGER NOT NULL DEFAULT 0,
+  next_attempt_at INTEGER NOT NULL,
+  last_error TEXT,
+  dead_at INTEGER
+);
+CREATE INDEX email_outbox_due_idx ON email_outbox (next_attempt_at) WHERE dead_at IS NULL;
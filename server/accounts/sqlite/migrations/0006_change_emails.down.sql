@@ -0,0 +1,5 @@
+-- Delete the stuff created by 0006_change_emails.up.sql
+ALTER TABLE email_outbox DROP COLUMN email_change_token;
+ALTER TABLE accounts DROP COLUMN email_change_token_expiry;
+ALTER TABLE accounts DROP COLUMN email_change_token_hash;
+ALTER TABLE accounts DROP COLUMN new_email;
@@ -0,0 +1,6 @@
+-- Let accounts move to a new email once they prove that they own it.
+-- new_email isn't UNIQUE, since it isn't the account's yet. The email column's constraint is checked when the move is confirmed.
+ALTER TABLE accounts ADD COLUMN new_email TEXT;
+ALTER TABLE accounts ADD COLUMN email_change_token_hash TEXT;
+ALTER TABLE accounts ADD COLUMN email_change_token_expiry INTEGER;
+ALTER TABLE email_outbox ADD COLUMN email_change_token TEXT;
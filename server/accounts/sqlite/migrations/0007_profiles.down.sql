@@ -0,0 +1,4 @@
+-- Delete the stuff created by 0007_profiles.up.sql
+ALTER TABLE accounts DROP COLUMN preferences;
+ALTER TABLE accounts DROP COLUMN bio;
+ALTER TABLE accounts DROP COLUMN display_name;
@@ -0,0 +1,5 @@
+-- Let accounts say something about themselves.
+-- preferences is a JSON object which only clients look inside. It's NULL until the account sets some.
+ALTER TABLE accounts ADD COLUMN display_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE accounts ADD COLUMN bio TEXT NOT NULL DEFAULT '';
+ALTER TABLE accounts ADD COLUMN preferences TEXT;
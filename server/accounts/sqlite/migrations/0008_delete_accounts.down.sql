@@ -0,0 +1,4 @@
+-- Delete the stuff created by 0008_delete_accounts.up.sql
+DROP INDEX accounts_deletion_due_idx;
+ALTER TABLE accounts DROP COLUMN purged_at;
+ALTER TABLE accounts DROP COLUMN deletion_due_at;
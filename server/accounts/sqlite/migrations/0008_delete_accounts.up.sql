@@ -0,0 +1,6 @@
+-- Let accounts be deleted once their owners ask, after a grace period.
+-- Purged accounts keep their rows, so that their IDs aren't reused, but everything in them is cleared.
+-- Both times are unix seconds, like the token expiries.
+ALTER TABLE accounts ADD COLUMN deletion_due_at INTEGER;
+ALTER TABLE accounts ADD COLUMN purged_at INTEGER;
+CREATE INDEX accounts_deletion_due_idx ON accounts (deletion_due_at) WHERE deletion_due_at IS NOT NULL AND purged_at IS NULL;
@@ -0,0 +1,6 @@
+-- Delete the stuff created by 0009_two_factor.up.sql
+DROP TABLE recovery_codes;
+ALTER TABLE accounts DROP COLUMN two_factor_required;
+ALTER TABLE accounts DROP COLUMN totp_last_step;
+ALTER TABLE accounts DROP COLUMN totp_pending_secret;
+ALTER TABLE accounts DROP COLUMN totp_secret;
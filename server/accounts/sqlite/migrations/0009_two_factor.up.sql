@@ -0,0 +1,14 @@
+-- Let accounts log in with a TOTP code as well as their password.
+-- totp_secret is only set once the secret is confirmed. Until then, it's in totp_pending_secret.
+-- totp_last_step is the step of the last code which was used, so that codes can't be replayed.
+ALTER TABLE accounts ADD COLUMN totp_secret TEXT;
+ALTER TABLE accounts ADD COLUMN totp_pending_secret TEXT;
+ALTER TABLE accounts ADD COLUMN totp_last_step INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE accounts ADD COLUMN two_factor_required INTEGER NOT NULL DEFAULT 0;
+-- Recovery codes are hashed like passwords. Each row is deleted once its code is used.
+CREATE TABLE recovery_codes (
+  id INTEGER PRIMARY KEY,
+  account_id INTEGER NOT NULL REFERENCES accounts (id) ON DELETE CASCADE,
+  code_hash TEXT NOT NULL
+);
+CREATE INDEX recovery_codes_account_idx ON recovery_codes (account_id);
@@ -0,0 +1 @@
+-- 0010_clear_dead_email_tokens.up.sql cleared tokens which shouldn't have been kept, so there's nothing to undo.
@@ -0,0 +1,3 @@
+-- Dead emails lose their tokens, so that they don't sit in the database in plaintext.
+-- Retrying a dead email makes new tokens for it.
+UPDATE email_outbox SET reset_token = NULL, verification_token = NULL, email_change_token = NULL WHERE dead_at IS NOT NULL;
@@ -0,0 +1,2 @@
+-- Delete the stuff created by 0011_moderators.up.sql
+ALTER TABLE accounts DROP COLUMN moderator;
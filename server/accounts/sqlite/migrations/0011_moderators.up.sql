@@ -0,0 +1,3 @@
+-- Moderators could do a lot of damage if someone else took them over, so they must have two-factor auth.
+-- Giving an account the role sets two_factor_required too.
+ALTER TABLE accounts ADD COLUMN moderator INTEGER NOT NULL DEFAULT 0;
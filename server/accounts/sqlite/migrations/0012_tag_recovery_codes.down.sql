@@ -0,0 +1,2 @@
+-- Undo 0012_tag_recovery_codes.up.sql. The older code can't read the lookup tags, so they're cut off.
+UPDATE recovery_codes SET code_hash = substr(code_hash, 6) WHERE code_hash GLOB '[0-9a-f][0-9a-f][0-9a-f][0-9a-f]:*';
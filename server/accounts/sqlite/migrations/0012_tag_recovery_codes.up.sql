@@ -0,0 +1,2 @@
+-- Recovery code hashes start with a short lookup tag now, so that checking a code only needs one slow hash.
+-- Hashes from before this still work, so nothing needs to change.
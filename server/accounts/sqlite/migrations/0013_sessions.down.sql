@@ -0,0 +1,2 @@
+-- Delete the stuff created by 0013_sessions.up.sql
+DROP TABLE sessions;
@@ -0,0 +1,10 @@
+-- Record each login, so that people can see where they're logged in.
+-- issued_at and last_used_at are in unix seconds. last_used_at is only updated once a minute.
+CREATE TABLE sessions (
+  id INTEGER PRIMARY KEY,
+  account_id INTEGER NOT NULL REFERENCES accounts (id) ON DELETE CASCADE,
+  issued_at INTEGER NOT NULL,
+  last_used_at INTEGER NOT NULL,
+  client TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX sessions_account_idx ON sessions (account_id);
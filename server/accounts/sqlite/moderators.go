@@ -0,0 +1,51 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/wikisophia/api/server/accounts"
+)
+
+// Moderators must have two-factor auth, so giving the role requires it too.
+const setModeratorQuery = `
+UPDATE accounts
+SET moderator = ?,
+    two_factor_required = (two_factor_required OR ?)
+WHERE id = ?
+  AND purged_at IS NULL;
+`
+
+const selectModeratorQuery = `
+SELECT moderator
+FROM accounts
+WHERE id = ?
+  AND purged_at IS NULL;
+`
+
+// See the docs on interfaces in store.go
+func (s *SQLiteStore) SetModerator(ctx context.Context, id int64, moderator bool) error {
+	result, err := s.db.ExecContext(ctx, setModeratorQuery, moderator, moderator, id)
+	if err != nil {
+		return fmt.Errorf("failed to set the moderator role: %v", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to set the moderator role: %v", err)
+	} else if affected != 1 {
+		return accounts.AccountNotExistsError{}
+	}
+	return nil
+}
+
+// See the docs on interfaces in store.go
+func (s *SQLiteStore) IsModerator(ctx context.Context, id int64) (bool, error) {
+	var moderator bool
+	err := s.db.QueryRowContext(ctx, selectModeratorQuery, id).Scan(&moderator)
+	if err == sql.ErrNoRows {
+		return false, accounts.AccountNotExistsError{}
+	} else if err != nil {
+		return false, fmt.Errorf("failed to read the moderator role: %v", err)
+	}
+	return moderator, nil
+}
@@ -0,0 +1,341 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/accounts/tokens"
+	"github.com/wikisophia/api/server/sqlite"
+)
+
+const queueEmailQuery = `
+INSERT INTO email_outbox (kind, account_id, email, reset_token, verification_token, email_change_token, locked_until, created_at, next_attempt_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?);
+`
+
+const queuedEmailColumns = `id, kind, account_id, email, reset_token, verification_token, email_change_token, locked_until, created_at, attempts, next_attempt_at, last_error, dead_at`
+
+const claimEmailsQuery = `
+UPDATE email_outbox
+SET next_attempt_at = ?
+WHERE id IN (
+  SELECT id
+  FROM email_outbox
+  WHERE dead_at IS NULL
+    AND next_attempt_at <= ?
+  ORDER BY next_attempt_at, id
+  LIMIT ?
+)
+RETURNING ` + queuedEmailColumns + `;
+`
+
+const deleteEmailQuery = `DELETE FROM email_outbox WHERE id = ?;`
+
+const emailFailedQuery = `
+UPDATE email_outbox
+SET attempts = attempts + 1,
+    last_error = ?,
+    next_attempt_at = ?
+WHERE id = ?;
+`
+
+// Dead emails lose their tokens, so that they don't sit in the database in plaintext. RetryEmail makes new ones.
+const emailDiedQuery = `
+UPDATE email_outbox
+SET attempts = attempts + 1,
+    last_error = ?,
+    dead_at = ?,
+    reset_token = NULL,
+    verification_token = NULL,
+    email_change_token = NULL
+WHERE id = ?;
+`
+
+const selectFailedEmailsQuery = `SELECT ` + queuedEmailColumns + ` FROM email_outbox WHERE attempts > 0 ORDER BY id;`
+
+const selectRetriedEmailQuery = `SELECT kind, account_id, email, dead_at IS NOT NULL FROM email_outbox WHERE id = ?;`
+
+const retryEmailQuery = `
+UPDATE email_outbox
+SET attempts = 0,
+    next_attempt_at = ?
+WHERE id = ?;
+`
+
+const retryDeadEmailQuery = `
+UPDATE email_outbox
+SET attempts = 0,
+    next_attempt_at = ?,
+    dead_at = NULL,
+    reset_token = ?,
+    verification_token = ?,
+    email_change_token = ?
+WHERE id = ?;
+`
+
+// The renew queries only replace tokens which would go to the account's current email.
+
+const renewResetTokenQuery = `
+UPDATE accounts
+SET reset_token_hash = ?,
+    reset_token_expiry = ?
+WHERE id = ?
+  AND email = ?
+  AND purged_at IS NULL;
+`
+
+const renewVerificationTokenQuery = `
+UPDATE accounts
+SET verification_token_hash = ?,
+    verification_token_expiry = ?
+WHERE id = ?
+  AND email = ?
+  AND email_verified_at IS NULL
+  AND purged_at IS NULL;
+`
+
+const renewEmailChangeTokenQuery = `
+UPDATE accounts
+SET email_change_token_hash = ?,
+    email_change_token_expiry = ?
+WHERE id = ?
+  AND new_email = ?
+  AND email_change_token_hash IS NOT NULL
+  AND purged_at IS NULL;
+`
+
+const retryEmailErrorMsg = "failed to retry email"
+
+// execer runs statements inside or outside of a transaction.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// See the docs on interfaces in store.go
+func (s *SQLiteStore) QueueEmail(ctx context.Context, email accounts.QueuedEmail) error {
+	if err := queueEmail(ctx, s.db, email); err != nil {
+		return fmt.Errorf("failed to queue email: %v", err)
+	}
+	return nil
+}
+
+// queueEmail adds the email to the outbox through db, which may be a transaction.
+func queueEmail(ctx context.Context, db execer, email accounts.QueuedEmail) error {
+	var lockedUntil sql.NullInt64
+	if !email.LockedUntil.IsZero() {
+		lockedUntil = sql.NullInt64{Int64: email.LockedUntil.Unix(), Valid: true}
+	}
+	now := time.Now().Unix()
+	_, err := db.ExecContext(ctx, queueEmailQuery,
+		email.Kind,
+		email.Account.ID,
+		email.Account.Email,
+		nullIfEmpty(email.Account.ResetToken),
+		nullIfEmpty(email.Account.VerificationToken),
+		nullIfEmpty(email.Account.EmailChangeToken),
+		lockedUntil,
+		now,
+		now)
+	return err
+}
+
+// See the docs on interfaces in store.go
+func (s *SQLiteStore) ClaimEmails(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]accounts.QueuedEmail, error) {
+	rows, err := s.db.QueryContext(ctx, claimEmailsQuery, now.Add(lease).Unix(), now.Unix(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim emails: %v", err)
+	}
+	claimed, err := scanQueuedEmails(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim emails: %v", err)
+	}
+	// RETURNING doesn't promise any order.
+	sort.Slice(claimed, func(i, j int) bool {
+		return claimed[i].ID < claimed[j].ID
+	})
+	return claimed, nil
+}
+
+// See the docs on interfaces in store.go
+func (s *SQLiteStore) EmailSent(ctx context.Context, id int64) error {
+	result, err := s.db.ExecContext(ctx, deleteEmailQuery, id)
+	return requireOneEmail(result, err, id, "failed to delete sent email")
+}
+
+// See the docs on interfaces in store.go
+func (s *SQLiteStore) EmailFailed(ctx context.Context, id int64, reason string, retryAt time.Time) error {
+	var result sql.Result
+	var err error
+	if retryAt.IsZero() {
+		result, err = s.db.ExecContext(ctx, emailDiedQuery, reason, time.Now().Unix(), id)
+	} else {
+		result, err = s.db.ExecContext(ctx, emailFailedQuery, reason, retryAt.Unix(), id)
+	}
+	return requireOneEmail(result, err, id, "failed to record email failure")
+}
+
+// See the docs on interfaces in store.go
+func (s *SQLiteStore) FailedEmails(ctx context.Context) ([]accounts.QueuedEmail, error) {
+	rows, err := s.db.QueryContext(ctx, selectFailedEmailsQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch failed emails: %v", err)
+	}
+	failed, err := scanQueuedEmails(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch failed emails: %v", err)
+	}
+	return failed, nil
+}
+
+// See the docs on interfaces in store.go
+func (s *SQLiteStore) RetryEmail(ctx context.Context, id int64) error {
+	transaction, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %v", retryEmailErrorMsg, err)
+	}
+	var email accounts.QueuedEmail
+	var dead bool
+	err = transaction.QueryRowContext(ctx, selectRetriedEmailQuery, id).Scan(&email.Kind, &email.Account.ID, &email.Account.Email, &dead)
+	if err == sql.ErrNoRows {
+		transaction.Rollback()
+		return accounts.QueuedEmailNotExistsError{ID: id}
+	}
+	now := time.Now().Unix()
+	if err == nil && !dead {
+		_, err = transaction.ExecContext(ctx, retryEmailQuery, now, id)
+	} else if err == nil {
+		var account accounts.Account
+		if account, err = s.renewTokens(ctx, transaction, email); err == nil {
+			_, err = transaction.ExecContext(ctx, retryDeadEmailQuery, now,
+				nullIfEmpty(account.ResetToken),
+				nullIfEmpty(account.VerificationToken),
+				nullIfEmpty(account.EmailChangeToken),
+				id)
+		}
+	}
+	if sqlite.RollbackIfErr(transaction, err) {
+		if errors.As(err, &accounts.StaleQueuedEmailError{}) {
+			return err
+		}
+		return fmt.Errorf("%s: %v", retryEmailErrorMsg, err)
+	}
+	if err := transaction.Commit(); err != nil {
+		return fmt.Errorf("%s: %v", retryEmailErrorMsg, err)
+	}
+	return nil
+}
+
+// renewTokens makes new tokens for a dead email through transaction, to replace the ones it lost,
+// and returns its Account with them.
+func (s *SQLiteStore) renewTokens(ctx context.Context, transaction *sql.Tx, email accounts.QueuedEmail) (accounts.Account, error) {
+	account := email.Account
+	var renewed string
+	var err error
+	switch email.Kind {
+	case accounts.EmailKindWelcome, accounts.EmailKindReset:
+		renewed, err = renewToken(ctx, transaction, renewResetTokenQuery, s.expiry.Reset, account)
+		account.ResetToken = renewed
+		// Welcome emails only have a verification link if there's still something to verify.
+		if err == nil && renewed != "" && email.Kind == accounts.EmailKindWelcome {
+			account.VerificationToken, err = renewToken(ctx, transaction, renewVerificationTokenQuery, s.expiry.Verification, account)
+		}
+	case accounts.EmailKindVerification:
+		renewed, err = renewToken(ctx, transaction, renewVerificationTokenQuery, s.expiry.Verification, account)
+		account.VerificationToken = renewed
+	case accounts.EmailKindEmailChange:
+		renewed, err = renewToken(ctx, transaction, renewEmailChangeTokenQuery, s.expiry.Verification, account)
+		account.EmailChangeToken = renewed
+	default:
+		// The other emails don't have tokens.
+		return account, nil
+	}
+	if err != nil {
+		return accounts.Account{}, err
+	}
+	if renewed == "" {
+		return accounts.Account{}, accounts.StaleQueuedEmailError{ID: email.ID}
+	}
+	return account, nil
+}
+
+// renewToken replaces one of the account's token hashes with query, and returns the new token.
+// It returns an empty token if query didn't change the account.
+func renewToken(ctx context.Context, transaction *sql.Tx, query string, expiry time.Duration, account accounts.Account) (string, error) {
+	token, err := tokens.NewVerificationToken(50)
+	if err != nil {
+		return "", err
+	}
+	result, err := transaction.ExecContext(ctx, query, tokens.Hash(token), time.Now().Add(expiry).Unix(), account.ID, account.Email)
+	if err != nil {
+		return "", err
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected != 1 {
+		return "", err
+	}
+	return token, nil
+}
+
+// requireOneEmail turns the result of a statement which should change one email into an error.
+func requireOneEmail(result sql.Result, err error, id int64, errorMsg string) error {
+	if err != nil {
+		return fmt.Errorf("%s: %v", errorMsg, err)
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("%s: %v", errorMsg, err)
+	} else if affected != 1 {
+		return accounts.QueuedEmailNotExistsError{ID: id}
+	}
+	return nil
+}
+
+// scanQueuedEmails reads rows of queuedEmailColumns, and closes them.
+func scanQueuedEmails(rows *sql.Rows) ([]accounts.QueuedEmail, error) {
+	defer rows.Close()
+	emails := make([]accounts.QueuedEmail, 0)
+	for rows.Next() {
+		var email accounts.QueuedEmail
+		var resetToken, verificationToken, emailChangeToken, lastError sql.NullString
+		var lockedUntil, deadAt sql.NullInt64
+		var createdAt, nextAttemptAt int64
+		if err := rows.Scan(
+			&email.ID,
+			&email.Kind,
+			&email.Account.ID,
+			&email.Account.Email,
+			&resetToken,
+			&verificationToken,
+			&emailChangeToken,
+			&lockedUntil,
+			&createdAt,
+			&email.Attempts,
+			&nextAttemptAt,
+			&lastError,
+			&deadAt,
+		); err != nil {
+			return nil, err
+		}
+		email.Account.ResetToken = resetToken.String
+		email.Account.VerificationToken = verificationToken.String
+		email.Account.EmailChangeToken = emailChangeToken.String
+		email.LastError = lastError.String
+		email.CreatedAt = time.Unix(createdAt, 0)
+		email.NextAttemptAt = time.Unix(nextAttemptAt, 0)
+		if lockedUntil.Valid {
+			email.LockedUntil = time.Unix(lockedUntil.Int64, 0)
+		}
+		if deadAt.Valid {
+			email.DeadAt = time.Unix(deadAt.Int64, 0)
+		}
+		emails = append(emails, email)
+	}
+	return emails, rows.Err()
+}
+
+func nullIfEmpty(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
@@ -0,0 +1,70 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/wikisophia/api/server/accounts"
+)
+
+const selectProfileQuery = `
+SELECT id, email, display_name, bio, preferences, deletion_due_at
+FROM accounts
+WHERE id = ?
+  AND purged_at IS NULL;
+`
+
+// NULL parameters leave their columns as they are.
+const updateProfileQuery = `
+UPDATE accounts
+SET display_name = COALESCE(?, display_name),
+    bio = COALESCE(?, bio),
+    preferences = COALESCE(?, preferences)
+WHERE id = ?
+  AND purged_at IS NULL
+RETURNING id, email, display_name, bio, preferences, deletion_due_at;
+`
+
+// See the docs on interfaces in store.go
+func (s *SQLiteStore) AccountProfile(ctx context.Context, id int64) (accounts.AccountProfile, error) {
+	profile, err := scanProfile(s.db.QueryRowContext(ctx, selectProfileQuery, id))
+	if err == sql.ErrNoRows {
+		return accounts.AccountProfile{}, accounts.AccountNotExistsError{}
+	} else if err != nil {
+		return accounts.AccountProfile{}, fmt.Errorf("failed to fetch profile: %v", err)
+	}
+	return profile, nil
+}
+
+// See the docs on interfaces in store.go
+func (s *SQLiteStore) UpdateProfile(ctx context.Context, id int64, update accounts.ProfileUpdate) (accounts.AccountProfile, error) {
+	var preferences sql.NullString
+	if update.Preferences != nil {
+		preferences = sql.NullString{String: string(update.Preferences), Valid: true}
+	}
+	profile, err := scanProfile(s.db.QueryRowContext(ctx, updateProfileQuery, update.DisplayName, update.Bio, preferences, id))
+	if err == sql.ErrNoRows {
+		return accounts.AccountProfile{}, accounts.AccountNotExistsError{}
+	} else if err != nil {
+		return accounts.AccountProfile{}, fmt.Errorf("failed to update profile: %v", err)
+	}
+	return profile, nil
+}
+
+func scanProfile(row *sql.Row) (accounts.AccountProfile, error) {
+	var profile accounts.AccountProfile
+	var preferences sql.NullString
+	var deletionDueAt sql.NullInt64
+	if err := row.Scan(&profile.ID, &profile.Email, &profile.DisplayName, &profile.Bio, &preferences, &deletionDueAt); err != nil {
+		return accounts.AccountProfile{}, err
+	}
+	if preferences.Valid {
+		profile.Preferences = []byte(preferences.String)
+	}
+	if deletionDueAt.Valid {
+		profile.DeletionDueAt = time.Unix(deletionDueAt.Int64, 0)
+	}
+	return profile, nil
+}
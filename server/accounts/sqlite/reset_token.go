@@ -0,0 +1,80 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/accounts/tokens"
+	"github.com/wikisophia/api/server/sqlite"
+)
+
+const selectAccountByEmailQuery = `SELECT id FROM accounts WHERE email = ?;`
+
+const newAccountQuery = `
+INSERT INTO accounts (email, reset_token_hash, reset_token_expiry, verification_token_hash, verification_token_expiry)
+VALUES (?, ?, ?, ?, ?);
+`
+
+const updateResetTokenQuery = `
+UPDATE accounts
+SET reset_token_hash = ?,
+    reset_token_expiry = ?
+WHERE id = ?;
+`
+
+const resetTokenErrorMsg = "failed to make a reset token"
+
+// See the docs on interfaces in store.go
+func (s *SQLiteStore) NewResetToken(ctx context.Context, email string) (accounts.Account, bool, error) {
+	token, err := tokens.NewVerificationToken(50)
+	if err != nil {
+		return accounts.Account{}, false, fmt.Errorf("%s: %v", resetTokenErrorMsg, err)
+	}
+	verificationToken, err := tokens.NewVerificationToken(50)
+	if err != nil {
+		return accounts.Account{}, false, fmt.Errorf("%s: %v", resetTokenErrorMsg, err)
+	}
+	hash := tokens.Hash(token)
+	expiration := time.Now().Add(s.expiry.Reset).Unix()
+	verificationExpiration := time.Now().Add(s.expiry.Verification).Unix()
+
+	transaction, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return accounts.Account{}, false, fmt.Errorf("%s: %v", resetTokenErrorMsg, err)
+	}
+	var id int64
+	isNew := false
+	err = transaction.QueryRowContext(ctx, selectAccountByEmailQuery, email).Scan(&id)
+	if err == sql.ErrNoRows {
+		isNew = true
+		var result sql.Result
+		if result, err = transaction.ExecContext(ctx, newAccountQuery, email, hash, expiration, tokens.Hash(verificationToken), verificationExpiration); err == nil {
+			id, err = result.LastInsertId()
+		}
+	} else if err == nil {
+		_, err = transaction.ExecContext(ctx, updateResetTokenQuery, hash, expiration, id)
+	}
+	account := accounts.Account{
+		ID:         id,
+		Email:      email,
+		ResetToken: token,
+	}
+	queued := accounts.QueuedEmail{Kind: accounts.EmailKindReset, Account: account}
+	if isNew {
+		account.VerificationToken = verificationToken
+		queued = accounts.QueuedEmail{Kind: accounts.EmailKindWelcome, Account: account}
+	}
+	if err == nil {
+		err = queueEmail(ctx, transaction, queued)
+	}
+	if sqlite.RollbackIfErr(transaction, err) {
+		return accounts.Account{}, false, fmt.Errorf("%s: %v", resetTokenErrorMsg, err)
+	}
+	if err := transaction.Commit(); err != nil {
+		return accounts.Account{}, false, fmt.Errorf("%s: %v", resetTokenErrorMsg, err)
+	}
+	return account, isNew, nil
+}
@@ -0,0 +1,94 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/wikisophia/api/server/accounts"
+)
+
+// The SELECT inserts nothing if the account doesn't exist.
+const startSessionQuery = `
+INSERT INTO sessions (account_id, issued_at, last_used_at, client)
+SELECT id, ?, ?, ?
+FROM accounts
+WHERE id = ?
+  AND purged_at IS NULL;
+`
+
+// last_used_at is only written once a minute, so that every request doesn't need a write.
+const sessionUsedQuery = `
+UPDATE sessions
+SET last_used_at = ?
+WHERE id = ?
+  AND account_id = ?
+  AND last_used_at <= ?;
+`
+
+const selectAccountSessionsQuery = `
+SELECT id, issued_at, last_used_at, client
+FROM sessions
+WHERE account_id = ?
+ORDER BY id;
+`
+
+const dropAccountSessionsQuery = `DELETE FROM sessions WHERE account_id = ?;`
+
+// See the docs on interfaces in store.go
+func (s *SQLiteStore) StartSession(ctx context.Context, accountID int64, client string, now time.Time) (accounts.Session, error) {
+	client = accounts.TrimSessionClient(client)
+	result, err := s.db.ExecContext(ctx, startSessionQuery, now.Unix(), now.Unix(), client, accountID)
+	if err != nil {
+		return accounts.Session{}, fmt.Errorf("failed to start a session: %v", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return accounts.Session{}, fmt.Errorf("failed to start a session: %v", err)
+	} else if affected != 1 {
+		return accounts.Session{}, accounts.AccountNotExistsError{}
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return accounts.Session{}, fmt.Errorf("failed to start a session: %v", err)
+	}
+	issuedAt := time.Unix(now.Unix(), 0)
+	return accounts.Session{
+		ID:         id,
+		AccountID:  accountID,
+		IssuedAt:   issuedAt,
+		LastUsedAt: issuedAt,
+		Client:     client,
+	}, nil
+}
+
+// See the docs on interfaces in store.go
+func (s *SQLiteStore) SessionUsed(ctx context.Context, accountID int64, id int64, now time.Time) error {
+	if _, err := s.db.ExecContext(ctx, sessionUsedQuery, now.Unix(), id, accountID, now.Add(-time.Minute).Unix()); err != nil {
+		return fmt.Errorf("failed to record a session's use: %v", err)
+	}
+	return nil
+}
+
+// See the docs on interfaces in store.go
+func (s *SQLiteStore) AccountSessions(ctx context.Context, accountID int64) ([]accounts.Session, error) {
+	rows, err := s.db.QueryContext(ctx, selectAccountSessionsQuery, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sessions: %v", err)
+	}
+	defer rows.Close()
+	sessions := make([]accounts.Session, 0)
+	for rows.Next() {
+		var issuedAt, lastUsedAt int64
+		session := accounts.Session{AccountID: accountID}
+		if err := rows.Scan(&session.ID, &issuedAt, &lastUsedAt, &session.Client); err != nil {
+			return nil, fmt.Errorf("failed to read sessions: %v", err)
+		}
+		session.IssuedAt = time.Unix(issuedAt, 0)
+		session.LastUsedAt = time.Unix(lastUsedAt, 0)
+		sessions = append(sessions, session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read sessions: %v", err)
+	}
+	return sessions, nil
+}
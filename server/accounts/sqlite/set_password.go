@@ -0,0 +1,122 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/accounts/tokens"
+)
+
+const selectResetTokenByIdQuery = `
+SELECT email, reset_token_hash, reset_token_expiry
+FROM accounts
+WHERE id = ?;
+`
+
+const setForgottenPasswordQuery = `
+UPDATE accounts
+SET reset_token_hash = NULL,
+    reset_token_expiry = NULL,
+    failed_logins = 0,
+    locked_until = NULL,
+    password_hash = ?
+WHERE id = ?
+  AND reset_token_hash = ?
+  AND reset_token_expiry >= ?;
+`
+
+const selectPasswordByIdQuery = `
+SELECT email, password_hash
+FROM accounts
+WHERE id = ?;
+`
+
+// The old hash is checked again, in case the password changed while the old one was being matched.
+// Reset tokens from before the change stop working, since they'd undo it.
+const changePasswordQuery = `
+UPDATE accounts
+SET password_hash = ?,
+    reset_token_hash = NULL,
+    reset_token_expiry = NULL
+WHERE id = ?
+  AND password_hash = ?;
+`
+
+// See the docs on interfaces in store.go
+func (s *SQLiteStore) SetForgottenPassword(ctx context.Context, id int64, password, resetToken string) error {
+	var email string
+	var storedHash sql.NullString
+	var expiry sql.NullInt64
+	if err := s.db.QueryRowContext(ctx, selectResetTokenByIdQuery, id).Scan(&email, &storedHash, &expiry); err == sql.ErrNoRows {
+		return accounts.AccountNotExistsError{}
+	} else if err != nil {
+		return fmt.Errorf("failed to set password: %v", err)
+	}
+	if !storedHash.Valid || !expiry.Valid || time.Now().Unix() > expiry.Int64 || !tokens.Matches(resetToken, storedHash.String) {
+		return accounts.InvalidResetTokenError{}
+	}
+	if err := s.policy.Check(email, password); err != nil {
+		return err
+	}
+
+	hash, err := s.hasher.Hash(ctx, password)
+	if err != nil {
+		return fmt.Errorf("failed to set password: %v", err)
+	}
+	result, err := s.db.ExecContext(ctx, setForgottenPasswordQuery, hash, id, storedHash.String, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("failed to set password: %v", err)
+	}
+	// If this fails, someone else used or replaced the token since we read it, or it just expired.
+	if affected, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to set password: %v", err)
+	} else if affected != 1 {
+		return accounts.InvalidResetTokenError{}
+	}
+	return nil
+}
+
+// See the docs on interfaces in store.go
+func (s *SQLiteStore) ChangePassword(ctx context.Context, id int64, oldPassword, newPassword, code string) error {
+	var email string
+	var oldPasswordHash sql.NullString
+	if err := s.db.QueryRowContext(ctx, selectPasswordByIdQuery, id).Scan(&email, &oldPasswordHash); err == sql.ErrNoRows {
+		return accounts.AccountNotExistsError{}
+	} else if err != nil {
+		return fmt.Errorf("failed to change password: %v", err)
+	}
+	if !oldPasswordHash.Valid {
+		return accounts.InvalidPasswordError{}
+	}
+	matches, err := s.hasher.Matches(ctx, oldPassword, oldPasswordHash.String)
+	if err != nil {
+		return accounts.CorruptedPasswordError{Email: email}
+	}
+	if !matches {
+		return accounts.InvalidPasswordError{}
+	}
+	if err := s.policy.Check(email, newPassword); err != nil {
+		return err
+	}
+	if err := s.checkSecondFactor(ctx, id, code); err != nil {
+		return err
+	}
+	newHash, err := s.hasher.Hash(ctx, newPassword)
+	if err != nil {
+		return fmt.Errorf("failed to change password: %v", err)
+	}
+	result, err := s.db.ExecContext(ctx, changePasswordQuery, newHash, id, oldPasswordHash.String)
+	if err != nil {
+		return fmt.Errorf("failed to change password: %v", err)
+	}
+	// If no rows changed, the password changed since we read it.
+	if affected, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to change password: %v", err)
+	} else if affected != 1 {
+		return accounts.InvalidPasswordError{}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"log"
+
+	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/accounts/tokens"
+)
+
+// NewSQLiteStore returns a Store which can manage accounts.
+// The returned Store will *not* close the db, since we did not open it.
+func NewSQLiteStore(db *sql.DB, hasher Hasher, policy accounts.PasswordPolicy, expiry tokens.Expiry) *SQLiteStore {
+	if db == nil {
+		log.Fatal("A database is required to make an accounts.SQLiteStore.")
+	}
+	missingPasswordHash, err := hasher.Hash(context.Background(), missingPassword)
+	if err != nil {
+		log.Fatalf("Failed to hash the password for missing accounts: %v", err)
+	}
+	return &SQLiteStore{
+		db:                  db,
+		hasher:              hasher,
+		policy:              policy,
+		expiry:              expiry,
+		missingPasswordHash: missingPasswordHash,
+	}
+}
+
+// missingPassword is hashed to make SQLiteStore.missingPasswordHash.
+const missingPassword = "this account has no password"
+
+type Hasher interface {
+	// Hash a value to a string which encodes the algorithm + salt as well.
+	Hash(ctx context.Context, value string) (string, error)
+	// Check if the given value matches a hash.
+	Matches(ctx context.Context, value string, hash string) (bool, error)
+	// Check if a matching hash was made with an older algorithm or weaker params than Hash uses now.
+	NeedsRehash(hash string) bool
+}
+
+// SQLiteStore saves account info in a SQLite database file.
+// It expects that the Migrations() have already been applied.
+type SQLiteStore struct {
+	db     *sql.DB
+	hasher Hasher
+	policy accounts.PasswordPolicy
+	// expiry is how long each kind of token can be used for.
+	expiry tokens.Expiry
+	// missingPasswordHash is checked when someone logs into an account which doesn't exist, or has no password.
+	// That makes those logins take as long as ones with the wrong password, so the timing doesn't
+	// reveal which emails have accounts.
+	missingPasswordHash string
+}
+
+// Ping makes sure the database file can still be read.
+func (store *SQLiteStore) Ping(ctx context.Context) error {
+	return store.db.PingContext(ctx)
+}
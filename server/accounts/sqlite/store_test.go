@@ -0,0 +1,226 @@
+package sqlite_test
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"github.com/wikisophia/api/server/accounts"
+	accountsSQLite "github.com/wikisophia/api/server/accounts/sqlite"
+	"github.com/wikisophia/api/server/accounts/storetest"
+	"github.com/wikisophia/api/server/accounts/tokens"
+	"github.com/wikisophia/api/server/config"
+	"github.com/wikisophia/api/server/passwords"
+	"github.com/wikisophia/api/server/sqlite"
+)
+
+// TestMigrationsLoad makes sure the embedded migration files are all well-formed.
+func TestMigrationsLoad(t *testing.T) {
+	loaded, err := accountsSQLite.Migrations()
+	require.NoError(t, err)
+	require.NotEmpty(t, loaded)
+	for i, migration := range loaded {
+		require.Equal(t, i+1, migration.Version, "migration versions should have no gaps")
+	}
+}
+
+// TestSQLiteStore makes sure the SQLiteStore is consistent with the StoreTests suite.
+// Each test gets a fresh database file, so they don't need any cleanup.
+func TestSQLiteStore(t *testing.T) {
+	newStore := storeFactory(t)
+	policy, err := passwords.NewPolicy(*config.Defaults().PasswordPolicy)
+	require.NoError(t, err)
+	suite.Run(t, &storetest.StoreTests{
+		StoreFactory: func() accounts.Store {
+			return newStore(cheapHasher, policy, hourExpiry)
+		},
+	})
+}
+
+// TestSQLiteStoreTiming makes sure the SQLiteStore is consistent with the TimingTests suite.
+func TestSQLiteStoreTiming(t *testing.T) {
+	newStore := storeFactory(t)
+	policy, err := passwords.NewPolicy(*config.Defaults().PasswordPolicy)
+	require.NoError(t, err)
+	suite.Run(t, &storetest.TimingTests{
+		StoreFactory: func(hasher *storetest.RecordingHasher) accounts.Store {
+			return newStore(hasher, policy, hourExpiry)
+		},
+		Hasher: cheapHasher,
+	})
+}
+
+// TestSQLiteStorePolicy makes sure the SQLiteStore is consistent with the PolicyTests suite.
+func TestSQLiteStorePolicy(t *testing.T) {
+	newStore := storeFactory(t)
+	suite.Run(t, &storetest.PolicyTests{
+		StoreFactory: func(policy accounts.PasswordPolicy) accounts.Store {
+			return newStore(cheapHasher, policy, hourExpiry)
+		},
+	})
+}
+
+// TestSQLiteStoreHashing makes sure the SQLiteStore is consistent with the HashingTests suite.
+func TestSQLiteStoreHashing(t *testing.T) {
+	newStore := storeFactory(t)
+	policy, err := passwords.NewPolicy(*config.Defaults().PasswordPolicy)
+	require.NoError(t, err)
+	stronger := cheapHash
+	stronger.Time++
+	suite.Run(t, &storetest.HashingTests{
+		StoreFactory: func(hasher *storetest.RecordingHasher) accounts.Store {
+			return newStore(hasher, policy, hourExpiry)
+		},
+		Weak:   cheapHasher,
+		Strong: passwords.NewHasher(stronger),
+	})
+}
+
+// TestSQLiteStoreResetTokens makes sure the SQLiteStore is consistent with the ResetTokenTests suite.
+func TestSQLiteStoreResetTokens(t *testing.T) {
+	newStore := storeFactory(t)
+	policy, err := passwords.NewPolicy(*config.Defaults().PasswordPolicy)
+	require.NoError(t, err)
+	suite.Run(t, &storetest.ResetTokenTests{
+		StoreFactory: func(resetTokenExpiry time.Duration) accounts.Store {
+			return newStore(cheapHasher, policy, tokens.Expiry{Reset: resetTokenExpiry, Verification: time.Hour})
+		},
+	})
+}
+
+// TestSQLiteStoreVerification makes sure the SQLiteStore is consistent with the VerificationTests suite.
+func TestSQLiteStoreVerification(t *testing.T) {
+	newStore := storeFactory(t)
+	policy, err := passwords.NewPolicy(*config.Defaults().PasswordPolicy)
+	require.NoError(t, err)
+	suite.Run(t, &storetest.VerificationTests{
+		StoreFactory: func(expiry tokens.Expiry) accounts.Store {
+			return newStore(cheapHasher, policy, expiry)
+		},
+	})
+}
+
+// TestSQLiteStoreEmailChange makes sure the SQLiteStore is consistent with the EmailChangeTests suite.
+func TestSQLiteStoreEmailChange(t *testing.T) {
+	newStore := storeFactory(t)
+	policy, err := passwords.NewPolicy(*config.Defaults().PasswordPolicy)
+	require.NoError(t, err)
+	suite.Run(t, &storetest.EmailChangeTests{
+		StoreFactory: func(expiry tokens.Expiry) accounts.Store {
+			return newStore(cheapHasher, policy, expiry)
+		},
+	})
+}
+
+// TestSQLiteStoreProfile makes sure the SQLiteStore is consistent with the ProfileTests suite.
+func TestSQLiteStoreProfile(t *testing.T) {
+	newStore := storeFactory(t)
+	policy, err := passwords.NewPolicy(*config.Defaults().PasswordPolicy)
+	require.NoError(t, err)
+	suite.Run(t, &storetest.ProfileTests{
+		StoreFactory: func() accounts.Store {
+			return newStore(cheapHasher, policy, hourExpiry)
+		},
+	})
+}
+
+// TestSQLiteStoreDeletion makes sure the SQLiteStore is consistent with the DeletionTests suite.
+func TestSQLiteStoreDeletion(t *testing.T) {
+	newStore := storeFactory(t)
+	policy, err := passwords.NewPolicy(*config.Defaults().PasswordPolicy)
+	require.NoError(t, err)
+	suite.Run(t, &storetest.DeletionTests{
+		StoreFactory: func() accounts.Store {
+			return newStore(cheapHasher, policy, hourExpiry)
+		},
+	})
+}
+
+// TestSQLiteStoreTwoFactor makes sure the SQLiteStore is consistent with the TwoFactorTests suite.
+func TestSQLiteStoreTwoFactor(t *testing.T) {
+	newStore := storeFactory(t)
+	policy, err := passwords.NewPolicy(*config.Defaults().PasswordPolicy)
+	require.NoError(t, err)
+	suite.Run(t, &storetest.TwoFactorTests{
+		StoreFactory: func() accounts.Store {
+			return newStore(cheapHasher, policy, hourExpiry)
+		},
+	})
+}
+
+// TestSQLiteStoreSessions makes sure the SQLiteStore is consistent with the SessionTests suite.
+func TestSQLiteStoreSessions(t *testing.T) {
+	newStore := storeFactory(t)
+	policy, err := passwords.NewPolicy(*config.Defaults().PasswordPolicy)
+	require.NoError(t, err)
+	suite.Run(t, &storetest.SessionTests{
+		StoreFactory: func() accounts.Store {
+			return newStore(cheapHasher, policy, hourExpiry)
+		},
+	})
+}
+
+// TestSQLiteStoreOutbox makes sure the SQLiteStore is consistent with the OutboxTests suite.
+func TestSQLiteStoreOutbox(t *testing.T) {
+	newStore := storeFactory(t)
+	policy, err := passwords.NewPolicy(*config.Defaults().PasswordPolicy)
+	require.NoError(t, err)
+	suite.Run(t, &storetest.OutboxTests{
+		StoreFactory: func() accounts.Store {
+			return newStore(cheapHasher, policy, hourExpiry)
+		},
+	})
+}
+
+// Cheap hashing params keep the suites fast. The hash strength isn't what's being tested.
+var cheapHash = config.Hash{
+	Time:        1,
+	Memory:      1024,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   16,
+}
+
+var cheapHasher = passwords.NewHasher(cheapHash)
+
+// hourExpiry keeps tokens valid for the whole test.
+var hourExpiry = tokens.Expiry{Reset: time.Hour, Verification: time.Hour}
+
+// storeFactory returns a function which makes SQLiteStores, each with a fresh database file.
+func storeFactory(t *testing.T) func(hasher accountsSQLite.Hasher, policy accounts.PasswordPolicy, expiry tokens.Expiry) accounts.Store {
+	loaded, err := accountsSQLite.Migrations()
+	require.NoError(t, err)
+	dir := t.TempDir()
+	opened := 0
+	return func(hasher accountsSQLite.Hasher, policy accounts.PasswordPolicy, expiry tokens.Expiry) accounts.Store {
+		opened++
+		db, err := sqlite.Open(filepath.Join(dir, fmt.Sprintf("accounts-%d.db", opened)))
+		require.NoError(t, err)
+		t.Cleanup(func() { db.Close() })
+		require.NoError(t, sqlite.Migrate(db, loaded))
+		return accountsSQLite.NewSQLiteStore(db, hasher, policy, expiry)
+	}
+}
+
+// TestResetTokensStoredHashed makes sure the database never has a usable reset token.
+func TestResetTokensStoredHashed(t *testing.T) {
+	loaded, err := accountsSQLite.Migrations()
+	require.NoError(t, err)
+	db, err := sqlite.Open(filepath.Join(t.TempDir(), "accounts.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	require.NoError(t, sqlite.Migrate(db, loaded))
+	store := accountsSQLite.NewSQLiteStore(db, cheapHasher, nil, hourExpiry)
+
+	account, _, err := store.NewResetToken(context.Background(), "email@soph.wiki")
+	require.NoError(t, err)
+	var stored string
+	require.NoError(t, db.QueryRow("SELECT reset_token_hash FROM accounts WHERE id = ?", account.ID).Scan(&stored))
+	assert.NotContains(t, stored, account.ResetToken)
+	assert.Equal(t, tokens.Hash(account.ResetToken), stored)
+}
@@ -0,0 +1,395 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/accounts/totp"
+	"github.com/wikisophia/api/server/sqlite"
+)
+
+const selectTwoFactorQuery = `
+SELECT email, password_hash, totp_secret, totp_pending_secret, totp_last_step, two_factor_required
+FROM accounts
+WHERE id = ?
+  AND purged_at IS NULL;
+`
+
+const selectRecoveryCodesQuery = `
+SELECT code_hash
+FROM recovery_codes
+WHERE account_id = ?
+ORDER BY id;
+`
+
+// The password hash is checked again, in case the password changed while the old one was being matched.
+const enrollTwoFactorQuery = `
+UPDATE accounts
+SET totp_pending_secret = ?
+WHERE id = ?
+  AND password_hash = ?
+  AND totp_secret IS NULL;
+`
+
+// The pending secret is checked again, in case someone else confirmed or replaced it in the meantime.
+const confirmTwoFactorQuery = `
+UPDATE accounts
+SET totp_secret = totp_pending_secret,
+    totp_pending_secret = NULL,
+    totp_last_step = ?
+WHERE id = ?
+  AND totp_pending_secret = ?
+  AND totp_secret IS NULL;
+`
+
+// Checking the last step again stops two requests from using the same code at once.
+const useTotpStepQuery = `
+UPDATE accounts
+SET totp_last_step = ?
+WHERE id = ?
+  AND totp_secret = ?
+  AND totp_last_step < ?;
+`
+
+const useRecoveryCodeQuery = `
+DELETE FROM recovery_codes
+WHERE account_id = ?
+  AND code_hash = ?;
+`
+
+const insertRecoveryCodeQuery = `INSERT INTO recovery_codes (account_id, code_hash) VALUES (?, ?);`
+
+const deleteRecoveryCodesQuery = `DELETE FROM recovery_codes WHERE account_id = ?;`
+
+const disableTwoFactorQuery = `
+UPDATE accounts
+SET totp_secret = NULL,
+    totp_pending_secret = NULL,
+    totp_last_step = 0
+WHERE id = ?
+  AND password_hash = ?
+  AND totp_secret = ?
+  AND two_factor_required = 0;
+`
+
+const selectTwoFactorStatusQuery = `
+SELECT totp_secret IS NOT NULL, two_factor_required, (SELECT COUNT(*) FROM recovery_codes WHERE account_id = accounts.id)
+FROM accounts
+WHERE id = ?
+  AND purged_at IS NULL;
+`
+
+// Moderators must keep two-factor auth, so the requirement can't be taken off of them.
+const requireTwoFactorQuery = `
+UPDATE accounts
+SET two_factor_required = ?
+WHERE id = ?
+  AND purged_at IS NULL
+  AND (? OR moderator = 0);
+`
+
+// twoFactorRow is what selectTwoFactorQuery reads.
+type twoFactorRow struct {
+	email         string
+	passwordHash  sql.NullString
+	secret        sql.NullString
+	pendingSecret sql.NullString
+	lastStep      int64
+	required      bool
+}
+
+// See the docs on interfaces in store.go
+func (s *SQLiteStore) EnrollTwoFactor(ctx context.Context, id int64, password string) (accounts.TwoFactorEnrollment, error) {
+	row, err := s.twoFactorRow(ctx, id)
+	if err != nil {
+		return accounts.TwoFactorEnrollment{}, err
+	}
+	if err := s.checkPassword(ctx, password, row.passwordHash); err != nil {
+		return accounts.TwoFactorEnrollment{}, err
+	}
+	if row.secret.Valid {
+		return accounts.TwoFactorEnrollment{}, accounts.TwoFactorEnabledError{}
+	}
+	secret, err := totp.NewSecret()
+	if err != nil {
+		return accounts.TwoFactorEnrollment{}, fmt.Errorf("failed to enroll in two-factor auth: %v", err)
+	}
+	result, err := s.db.ExecContext(ctx, enrollTwoFactorQuery, secret, id, row.passwordHash.String)
+	if err != nil {
+		return accounts.TwoFactorEnrollment{}, fmt.Errorf("failed to enroll in two-factor auth: %v", err)
+	}
+	// If no rows changed, the password changed since we read it, or two-factor auth was turned on.
+	if affected, err := result.RowsAffected(); err != nil {
+		return accounts.TwoFactorEnrollment{}, fmt.Errorf("failed to enroll in two-factor auth: %v", err)
+	} else if affected != 1 {
+		return accounts.TwoFactorEnrollment{}, accounts.InvalidPasswordError{}
+	}
+	return accounts.TwoFactorEnrollment{
+		ID:     id,
+		Email:  row.email,
+		Secret: secret,
+	}, nil
+}
+
+// See the docs on interfaces in store.go
+func (s *SQLiteStore) ConfirmTwoFactor(ctx context.Context, id int64, code string) ([]string, error) {
+	row, err := s.twoFactorRow(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if row.secret.Valid {
+		return nil, accounts.TwoFactorEnabledError{}
+	}
+	if !row.pendingSecret.Valid {
+		return nil, accounts.TwoFactorNotEnrolledError{}
+	}
+	step, ok, err := totp.Validate(row.pendingSecret.String, code, time.Now(), 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to confirm two-factor auth: %v", err)
+	}
+	if !ok {
+		return nil, accounts.InvalidTwoFactorCodeError{}
+	}
+	codes, hashes, err := s.newRecoveryCodes(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to confirm two-factor auth: %v", err)
+	}
+
+	transaction, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to confirm two-factor auth: %v", err)
+	}
+	result, err := transaction.ExecContext(ctx, confirmTwoFactorQuery, step, id, row.pendingSecret.String)
+	var affected int64
+	if err == nil {
+		affected, err = result.RowsAffected()
+	}
+	if err == nil && affected != 1 {
+		transaction.Rollback()
+		return nil, accounts.InvalidTwoFactorCodeError{}
+	}
+	if err == nil {
+		_, err = transaction.ExecContext(ctx, deleteRecoveryCodesQuery, id)
+	}
+	for _, hash := range hashes {
+		if err != nil {
+			break
+		}
+		_, err = transaction.ExecContext(ctx, insertRecoveryCodeQuery, id, hash)
+	}
+	if sqlite.RollbackIfErr(transaction, err) {
+		return nil, fmt.Errorf("failed to confirm two-factor auth: %v", err)
+	}
+	if err := transaction.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to confirm two-factor auth: %v", err)
+	}
+	return codes, nil
+}
+
+// See the docs on interfaces in store.go
+func (s *SQLiteStore) CheckTwoFactor(ctx context.Context, id int64, code string) error {
+	row, err := s.twoFactorRow(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !row.secret.Valid {
+		return accounts.TwoFactorNotEnrolledError{}
+	}
+	return s.useTwoFactorCode(ctx, id, row, code)
+}
+
+// See the docs on interfaces in store.go
+func (s *SQLiteStore) DisableTwoFactor(ctx context.Context, id int64, password, code string) error {
+	row, err := s.twoFactorRow(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.checkPassword(ctx, password, row.passwordHash); err != nil {
+		return err
+	}
+	if !row.secret.Valid {
+		return accounts.TwoFactorNotEnrolledError{}
+	}
+	// Check this before the code, so that the code isn't used up.
+	if row.required {
+		return accounts.TwoFactorRequiredError{}
+	}
+	if err := s.useTwoFactorCode(ctx, id, row, code); err != nil {
+		return err
+	}
+
+	transaction, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to disable two-factor auth: %v", err)
+	}
+	result, err := transaction.ExecContext(ctx, disableTwoFactorQuery, id, row.passwordHash.String, row.secret.String)
+	var affected int64
+	if err == nil {
+		affected, err = result.RowsAffected()
+	}
+	// If no rows changed, the password or secret changed since we read them, or two-factor auth became required.
+	if err == nil && affected != 1 {
+		transaction.Rollback()
+		return s.disableConflict(ctx, id)
+	}
+	if err == nil {
+		_, err = transaction.ExecContext(ctx, deleteRecoveryCodesQuery, id)
+	}
+	if sqlite.RollbackIfErr(transaction, err) {
+		return fmt.Errorf("failed to disable two-factor auth: %v", err)
+	}
+	if err := transaction.Commit(); err != nil {
+		return fmt.Errorf("failed to disable two-factor auth: %v", err)
+	}
+	return nil
+}
+
+// disableConflict returns the error for a DisableTwoFactor call whose account changed while its password was checked.
+func (s *SQLiteStore) disableConflict(ctx context.Context, id int64) error {
+	status, err := s.TwoFactorStatus(ctx, id)
+	if err != nil {
+		return err
+	}
+	if status.Required {
+		return accounts.TwoFactorRequiredError{}
+	}
+	return accounts.InvalidPasswordError{}
+}
+
+// See the docs on interfaces in store.go
+func (s *SQLiteStore) TwoFactorStatus(ctx context.Context, id int64) (accounts.TwoFactorStatus, error) {
+	var status accounts.TwoFactorStatus
+	err := s.db.QueryRowContext(ctx, selectTwoFactorStatusQuery, id).Scan(&status.Enabled, &status.Required, &status.RecoveryCodesLeft)
+	if err == sql.ErrNoRows {
+		return accounts.TwoFactorStatus{}, accounts.AccountNotExistsError{}
+	} else if err != nil {
+		return accounts.TwoFactorStatus{}, fmt.Errorf("failed to read two-factor status: %v", err)
+	}
+	return status, nil
+}
+
+// See the docs on interfaces in store.go
+func (s *SQLiteStore) RequireTwoFactor(ctx context.Context, id int64, required bool) error {
+	result, err := s.db.ExecContext(ctx, requireTwoFactorQuery, required, id, required)
+	if err != nil {
+		return fmt.Errorf("failed to require two-factor auth: %v", err)
+	}
+	// If no rows changed, the account doesn't exist, or it's a moderator.
+	if affected, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to require two-factor auth: %v", err)
+	} else if affected != 1 {
+		if _, err := s.IsModerator(ctx, id); err != nil {
+			return err
+		}
+		return accounts.TwoFactorRequiredError{}
+	}
+	return nil
+}
+
+// twoFactorRow reads the account's two-factor auth columns, or returns an AccountNotExistsError.
+func (s *SQLiteStore) twoFactorRow(ctx context.Context, id int64) (twoFactorRow, error) {
+	var row twoFactorRow
+	err := s.db.QueryRowContext(ctx, selectTwoFactorQuery, id).Scan(&row.email, &row.passwordHash, &row.secret, &row.pendingSecret,
+		&row.lastStep, &row.required)
+	if err == sql.ErrNoRows {
+		return twoFactorRow{}, accounts.AccountNotExistsError{}
+	} else if err != nil {
+		return twoFactorRow{}, fmt.Errorf("failed to read two-factor auth: %v", err)
+	}
+	return row, nil
+}
+
+// checkSecondFactor uses up the code if the account has two-factor auth on. Methods which need the password
+// call it once the password is known to be right.
+func (s *SQLiteStore) checkSecondFactor(ctx context.Context, id int64, code string) error {
+	row, err := s.twoFactorRow(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !row.secret.Valid {
+		return nil
+	}
+	if code == "" {
+		return accounts.TwoFactorCodeMissingError{}
+	}
+	return s.useTwoFactorCode(ctx, id, row, code)
+}
+
+// useTwoFactorCode checks the code against the TOTP secret and recovery codes in the row, and marks it used.
+func (s *SQLiteStore) useTwoFactorCode(ctx context.Context, id int64, row twoFactorRow, code string) error {
+	step, ok, err := totp.Validate(row.secret.String, code, time.Now(), row.lastStep)
+	if err != nil {
+		return fmt.Errorf("failed to check two-factor code: %v", err)
+	}
+	if ok {
+		result, err := s.db.ExecContext(ctx, useTotpStepQuery, step, id, row.secret.String, step)
+		if err != nil {
+			return fmt.Errorf("failed to use two-factor code: %v", err)
+		}
+		// If no rows changed, someone else used this code, or a later one, in the meantime.
+		if affected, err := result.RowsAffected(); err != nil {
+			return fmt.Errorf("failed to use two-factor code: %v", err)
+		} else if affected != 1 {
+			return accounts.InvalidTwoFactorCodeError{}
+		}
+		return nil
+	}
+
+	hashes, err := s.recoveryCodeHashes(ctx, id)
+	if err != nil {
+		return err
+	}
+	matched, err := totp.MatchRecoveryCode(ctx, s.hasher, code, hashes)
+	if err != nil {
+		return fmt.Errorf("failed to check recovery code: %v", err)
+	}
+	if matched == "" {
+		return accounts.InvalidTwoFactorCodeError{}
+	}
+	result, err := s.db.ExecContext(ctx, useRecoveryCodeQuery, id, matched)
+	if err != nil {
+		return fmt.Errorf("failed to use recovery code: %v", err)
+	}
+	// If no rows changed, someone else used the code in the meantime.
+	if affected, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to use recovery code: %v", err)
+	} else if affected != 1 {
+		return accounts.InvalidTwoFactorCodeError{}
+	}
+	return nil
+}
+
+func (s *SQLiteStore) recoveryCodeHashes(ctx context.Context, id int64) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, selectRecoveryCodesQuery, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recovery codes: %v", err)
+	}
+	defer rows.Close()
+	var hashes []string
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return nil, fmt.Errorf("failed to read recovery codes: %v", err)
+		}
+		hashes = append(hashes, hash)
+	}
+	return hashes, rows.Err()
+}
+
+// newRecoveryCodes makes a set of recovery codes, and their hashes.
+func (s *SQLiteStore) newRecoveryCodes(ctx context.Context) ([]string, []string, error) {
+	codes, err := totp.NewRecoveryCodes()
+	if err != nil {
+		return nil, nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		if hashes[i], err = totp.HashRecoveryCode(ctx, s.hasher, code); err != nil {
+			return nil, nil, err
+		}
+	}
+	return codes, hashes, nil
+}
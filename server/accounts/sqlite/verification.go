@@ -0,0 +1,126 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/accounts/tokens"
+	"github.com/wikisophia/api/server/sqlite"
+)
+
+const updateVerificationTokenQuery = `
+UPDATE accounts
+SET verification_token_hash = ?,
+    verification_token_expiry = ?
+WHERE email = ?
+  AND email_verified_at IS NULL
+RETURNING id;
+`
+
+const selectEmailVerifiedQuery = `SELECT email_verified_at IS NOT NULL FROM accounts WHERE email = ?;`
+
+const selectVerificationTokenByIdQuery = `
+SELECT verification_token_hash, verification_token_expiry
+FROM accounts
+WHERE id = ?;
+`
+
+const verifyEmailQuery = `
+UPDATE accounts
+SET email_verified_at = ?,
+    verification_token_hash = NULL,
+    verification_token_expiry = NULL
+WHERE id = ?
+  AND verification_token_hash = ?
+  AND verification_token_expiry >= ?;
+`
+
+const selectEmailVerifiedAtQuery = `SELECT email_verified_at FROM accounts WHERE id = ? AND purged_at IS NULL;`
+
+const verificationTokenErrorMsg = "failed to make a verification token"
+
+// See the docs on interfaces in store.go
+func (s *SQLiteStore) NewVerificationToken(ctx context.Context, email string) (accounts.Account, error) {
+	token, err := tokens.NewVerificationToken(50)
+	if err != nil {
+		return accounts.Account{}, fmt.Errorf("%s: %v", verificationTokenErrorMsg, err)
+	}
+	expiration := time.Now().Add(s.expiry.Verification).Unix()
+
+	transaction, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return accounts.Account{}, fmt.Errorf("%s: %v", verificationTokenErrorMsg, err)
+	}
+	var id int64
+	err = transaction.QueryRowContext(ctx, updateVerificationTokenQuery, tokens.Hash(token), expiration, email).Scan(&id)
+	if err == sql.ErrNoRows {
+		transaction.Rollback()
+		// Either there's no account, or it's verified already.
+		var verified bool
+		if err := s.db.QueryRowContext(ctx, selectEmailVerifiedQuery, email).Scan(&verified); err == sql.ErrNoRows {
+			return accounts.Account{}, accounts.AccountNotExistsError{Email: email}
+		} else if err != nil {
+			return accounts.Account{}, fmt.Errorf("%s: %v", verificationTokenErrorMsg, err)
+		}
+		return accounts.Account{}, accounts.EmailAlreadyVerifiedError{Email: email}
+	}
+	account := accounts.Account{
+		ID:                id,
+		Email:             email,
+		VerificationToken: token,
+	}
+	if err == nil {
+		err = queueEmail(ctx, transaction, accounts.QueuedEmail{Kind: accounts.EmailKindVerification, Account: account})
+	}
+	if sqlite.RollbackIfErr(transaction, err) {
+		return accounts.Account{}, fmt.Errorf("%s: %v", verificationTokenErrorMsg, err)
+	}
+	if err := transaction.Commit(); err != nil {
+		return accounts.Account{}, fmt.Errorf("%s: %v", verificationTokenErrorMsg, err)
+	}
+	return account, nil
+}
+
+// See the docs on interfaces in store.go
+func (s *SQLiteStore) VerifyEmail(ctx context.Context, id int64, token string) error {
+	var storedHash sql.NullString
+	var expiry sql.NullInt64
+	if err := s.db.QueryRowContext(ctx, selectVerificationTokenByIdQuery, id).Scan(&storedHash, &expiry); err == sql.ErrNoRows {
+		return accounts.AccountNotExistsError{}
+	} else if err != nil {
+		return fmt.Errorf("failed to verify email: %v", err)
+	}
+	if !storedHash.Valid || !expiry.Valid || time.Now().Unix() > expiry.Int64 || !tokens.Matches(token, storedHash.String) {
+		return accounts.InvalidVerificationTokenError{}
+	}
+
+	now := time.Now().Unix()
+	result, err := s.db.ExecContext(ctx, verifyEmailQuery, now, id, storedHash.String, now)
+	if err != nil {
+		return fmt.Errorf("failed to verify email: %v", err)
+	}
+	// If this fails, someone else used or replaced the token since we read it, or it just expired.
+	if affected, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to verify email: %v", err)
+	} else if affected != 1 {
+		return accounts.InvalidVerificationTokenError{}
+	}
+	return nil
+}
+
+// See the docs on interfaces in store.go
+func (s *SQLiteStore) EmailVerifiedAt(ctx context.Context, id int64) (time.Time, error) {
+	var verifiedAt sql.NullInt64
+	if err := s.db.QueryRowContext(ctx, selectEmailVerifiedAtQuery, id).Scan(&verifiedAt); err == sql.ErrNoRows {
+		return time.Time{}, accounts.AccountNotExistsError{}
+	} else if err != nil {
+		return time.Time{}, fmt.Errorf("failed to fetch email verification time: %v", err)
+	}
+	if !verifiedAt.Valid {
+		return time.Time{}, nil
+	}
+	return time.Unix(verifiedAt.Int64, 0), nil
+}
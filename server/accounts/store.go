@@ -2,6 +2,7 @@ package accounts
 
 import (
 	"context"
+	"time"
 )
 
 // Store combines all the functions needed to read & write Arguments
@@ -10,6 +11,16 @@ type Store interface {
 	Authenticator
 	PasswordSetter
 	ResetTokenGenerator
+	LoginTracker
+	EmailVerifier
+	EmailChanger
+	Profile
+	Deleter
+	TwoFactor
+	Moderators
+	Sessions
+	Outbox
+	Exporter
 }
 type Authenticator interface {
 	// Authenticate returns the account's ID.
@@ -26,14 +37,33 @@ type PasswordSetter interface {
 	// If no account exists with this ID, it returns an AccountNotExistsError.
 	// If the resetToken is wrong, it returns an InvalidResetTokenError.
 	// If the password is unacceptable, it returns a ProhibitedPasswordError.
+	// The password is only checked once the resetToken is known to be right.
+	//
+	// A successful reset also clears the account's LoginFailures, unlocking it.
 	SetForgottenPassword(ctx context.Context, id int64, password, resetToken string) error
 
 	// Change the password for this account by using the old one, rather than a reset token.
+	// If the account has two-factor auth on, code must be its current TOTP code or an unused recovery code,
+	// like in TwoFactor.CheckTwoFactor. Otherwise, code is ignored.
+	// Any unused reset token stops working, so that it can't undo the change.
 	//
 	// If the newPassword is unacceptable, it returns a ProhibitedPasswordError.
 	// If no account with the ID exists, it returns an AccountNotExistsError.
-	// If the old password is wrong, it returns an InvalidPasswordError.
-	ChangePassword(ctx context.Context, id int64, oldPassword, newPassword string) error
+	// If the old password is wrong, or the password changed while it was being checked, it returns an InvalidPasswordError.
+	// If the account needs a code and there isn't one, it returns a TwoFactorCodeMissingError.
+	// If the code is wrong, it returns an InvalidTwoFactorCodeError.
+	// The newPassword and code are only checked once the oldPassword is known to be right,
+	// and the code is only used up if the newPassword is acceptable.
+	ChangePassword(ctx context.Context, id int64, oldPassword, newPassword, code string) error
+}
+
+// PasswordPolicy decides which passwords people may choose.
+// Stores check it in PasswordSetter's methods.
+type PasswordPolicy interface {
+	// Check returns a ProhibitedPasswordError listing every rule the password breaks.
+	// The email is the account's, since passwords which look like it are easy to guess.
+	// Other errors mean the policy couldn't be checked.
+	Check(email, password string) error
 }
 
 type ResetTokenGenerator interface {
@@ -42,5 +72,260 @@ type ResetTokenGenerator interface {
 	//
 	// If no Account exists with this email yet, one will be created. The bool return value is
 	// true if the Account is new, and false if it existed already.
+	//
+	// New accounts get a VerificationToken too, and an EmailKindWelcome email with both tokens is queued
+	// in the Outbox. Existing accounts get an EmailKindReset one. The email is saved along with the tokens,
+	// so that they're never made without a way to send them.
 	NewResetToken(ctx context.Context, email string) (Account, bool, error)
 }
+
+// LoginTracker remembers the failed logins on each account, so that repeated guesses can be locked out.
+// It doesn't decide when to lock an account. See the lockout package for that.
+type LoginTracker interface {
+	// LoginFailures returns the failed logins for the account with this email.
+	//
+	// If no account has this email, it returns an AccountNotExistsError.
+	LoginFailures(ctx context.Context, email string) (LoginFailures, error)
+
+	// RecordLoginFailure adds one to the account's failed login count, and returns the new count.
+	// Concurrent calls never lose an increment.
+	//
+	// If no account with the ID exists, it returns an AccountNotExistsError.
+	RecordLoginFailure(ctx context.Context, id int64) (int, error)
+
+	// LockAccount stops the account from logging in until the given time.
+	//
+	// If no account with the ID exists, it returns an AccountNotExistsError.
+	LockAccount(ctx context.Context, id int64, until time.Time) error
+
+	// ClearLoginFailures resets the account's failed login count to zero, and unlocks it.
+	//
+	// If no account with the ID exists, it returns an AccountNotExistsError.
+	ClearLoginFailures(ctx context.Context, id int64) error
+}
+
+// EmailVerifier keeps track of which accounts have proven that they own their email.
+// This is separate from password resets, so that a verified email means the same thing
+// however the account got its password.
+type EmailVerifier interface {
+	// NewVerificationToken makes a token which proves that the account owns its email, and returns
+	// the Account with its VerificationToken set. This replaces any token it made before.
+	// An EmailKindVerification email with the token is queued in the Outbox along with it.
+	//
+	// If no account has this email, it returns an AccountNotExistsError.
+	// If the email is verified already, it returns an EmailAlreadyVerifiedError.
+	NewVerificationToken(ctx context.Context, email string) (Account, error)
+
+	// VerifyEmail marks the account's email as verified. Each token can only be used once,
+	// and only until it expires.
+	//
+	// If no account with the ID exists, it returns an AccountNotExistsError.
+	// If the token is wrong, used or expired, it returns an InvalidVerificationTokenError.
+	VerifyEmail(ctx context.Context, id int64, token string) error
+
+	// EmailVerifiedAt returns when the account's email was verified, or the zero Time if it hasn't been.
+	//
+	// If no account with the ID exists, it returns an AccountNotExistsError.
+	EmailVerifiedAt(ctx context.Context, id int64) (time.Time, error)
+}
+
+// EmailChanger moves accounts to new emails. An account only moves once its owner proves
+// that they can read the new email, so nobody can claim an address they don't own.
+type EmailChanger interface {
+	// RequestEmailChange checks the account's password, and makes a token which confirms the move to newEmail.
+	// It returns the Account with its Email set to newEmail and its EmailChangeToken set.
+	// This replaces any move requested before.
+	//
+	// An EmailKindEmailChange email with the token is queued for newEmail, along with an EmailKindEmailChangeNotice
+	// for the current email. Whether another account has newEmail isn't checked until the move is confirmed,
+	// so that this can't be used to find out which emails have accounts.
+	//
+	// If the account has two-factor auth on, code must be right too, like in PasswordSetter.ChangePassword.
+	//
+	// If no account with the ID exists, it returns an AccountNotExistsError.
+	// If the password is wrong, it returns an InvalidPasswordError.
+	// If newEmail is the account's email already, it returns an EmailExistsError.
+	// If the account needs a code and there isn't one, it returns a TwoFactorCodeMissingError.
+	// If the code is wrong, it returns an InvalidTwoFactorCodeError.
+	RequestEmailChange(ctx context.Context, id int64, password, newEmail, code string) (Account, error)
+
+	// ConfirmEmailChange moves the account to the email which the token was sent to, and marks it as verified.
+	// Reset and verification tokens sent to the old email stop working. Each token can only be used once,
+	// and only until it expires.
+	//
+	// If no account with the ID exists, it returns an AccountNotExistsError.
+	// If the token is wrong, used or expired, it returns an InvalidEmailChangeTokenError.
+	// If another account has the new email, it returns an EmailExistsError.
+	ConfirmEmailChange(ctx context.Context, id int64, token string) error
+}
+
+// Profile keeps what accounts say about themselves, like the names they go by.
+type Profile interface {
+	// AccountProfile returns the account's profile. New accounts have empty ones.
+	//
+	// If no account with the ID exists, it returns an AccountNotExistsError.
+	AccountProfile(ctx context.Context, id int64) (AccountProfile, error)
+
+	// UpdateProfile changes the parts of the account's profile which are set in the update, and returns the new one.
+	// It doesn't check them against the Max* limits, so callers should do that first.
+	//
+	// If no account with the ID exists, it returns an AccountNotExistsError.
+	UpdateProfile(ctx context.Context, id int64, update ProfileUpdate) (AccountProfile, error)
+}
+
+// Deleter removes accounts whose owners ask it to. They wait out a grace period first, so that
+// their owners can change their minds.
+//
+// Purged accounts are anonymized rather than deleted, so that their IDs are never reused. Their email becomes
+// a random placeholder, and everything else which the Store knew about them is cleared, so they can't log in.
+// AccountProfile, UpdateProfile, EmailVerifiedAt, RequestEmailChange, ScheduleDeletion, CancelDeletion and the
+// TwoFactor methods treat them as though they didn't exist.
+type Deleter interface {
+	// ScheduleDeletion checks the account's password, and schedules it to be purged at dueAt.
+	// This replaces any time which was scheduled before.
+	//
+	// If no account with the ID exists, it returns an AccountNotExistsError.
+	// If the password is wrong, it returns an InvalidPasswordError.
+	ScheduleDeletion(ctx context.Context, id int64, password string, dueAt time.Time) error
+
+	// CancelDeletion stops the account from being purged. It does nothing if the account wasn't going to be.
+	//
+	// If no account with the ID exists, it returns an AccountNotExistsError.
+	CancelDeletion(ctx context.Context, id int64) error
+
+	// PurgeAccounts anonymizes every account which was due to be purged at now, and returns how many it purged.
+	// Their queued emails are dropped from the Outbox too, and their Sessions are forgotten.
+	PurgeAccounts(ctx context.Context, now time.Time) (int, error)
+}
+
+// TwoFactor makes accounts give a TOTP code from an authenticator app, as well as their password, when they log in.
+// Recovery codes can be used in place of TOTP codes, once each, in case the app is lost.
+type TwoFactor interface {
+	// EnrollTwoFactor checks the account's password, and gives it a new TOTP secret. The secret isn't used
+	// until ConfirmTwoFactor gets a code made with it. Enrolling again replaces an unconfirmed secret.
+	//
+	// If no account with the ID exists, it returns an AccountNotExistsError.
+	// If the password is wrong, it returns an InvalidPasswordError.
+	// If two-factor auth is on already, it returns a TwoFactorEnabledError.
+	EnrollTwoFactor(ctx context.Context, id int64, password string) (TwoFactorEnrollment, error)
+
+	// ConfirmTwoFactor turns on two-factor auth if the code was made with the account's unconfirmed secret.
+	// It returns new recovery codes. Only their hashes are stored, so they can't be shown again.
+	//
+	// If no account with the ID exists, it returns an AccountNotExistsError.
+	// If the account has no unconfirmed secret, it returns a TwoFactorNotEnrolledError.
+	// If two-factor auth is on already, it returns a TwoFactorEnabledError.
+	// If the code is wrong, it returns an InvalidTwoFactorCodeError.
+	ConfirmTwoFactor(ctx context.Context, id int64, code string) ([]string, error)
+
+	// CheckTwoFactor returns nil if the code is the account's current TOTP code, or one of its unused
+	// recovery codes. Each TOTP code only works once, and recovery codes are used up.
+	//
+	// If no account with the ID exists, it returns an AccountNotExistsError.
+	// If two-factor auth is off, it returns a TwoFactorNotEnrolledError.
+	// If the code is wrong, it returns an InvalidTwoFactorCodeError.
+	CheckTwoFactor(ctx context.Context, id int64, code string) error
+
+	// DisableTwoFactor checks the account's password and code, like CheckTwoFactor does, and turns two-factor auth off.
+	//
+	// If no account with the ID exists, it returns an AccountNotExistsError.
+	// If the password is wrong, it returns an InvalidPasswordError.
+	// If two-factor auth is off, it returns a TwoFactorNotEnrolledError.
+	// If the code is wrong, it returns an InvalidTwoFactorCodeError.
+	// If the account must have two-factor auth, it returns a TwoFactorRequiredError.
+	DisableTwoFactor(ctx context.Context, id int64, password, code string) error
+
+	// TwoFactorStatus says whether the account has two-factor auth on, and whether it must.
+	//
+	// If no account with the ID exists, it returns an AccountNotExistsError.
+	TwoFactorStatus(ctx context.Context, id int64) (TwoFactorStatus, error)
+
+	// RequireTwoFactor says whether the account must turn on two-factor auth before it can log in,
+	// and keep it on. This is meant for accounts which could do a lot of damage if someone else took them over.
+	// Moderators always need it, so they're required as soon as they get the role.
+	//
+	// If no account with the ID exists, it returns an AccountNotExistsError.
+	// If required is false and the account is a moderator, it returns a TwoFactorRequiredError.
+	RequireTwoFactor(ctx context.Context, id int64, required bool) error
+}
+
+// Moderators keeps track of which accounts are moderators.
+type Moderators interface {
+	// SetModerator gives the account the moderator role, or takes it away. Giving it also requires the account
+	// to have two-factor auth, as RequireTwoFactor does. Taking it away leaves that requirement as it was.
+	//
+	// If no account with the ID exists, it returns an AccountNotExistsError.
+	SetModerator(ctx context.Context, id int64, moderator bool) error
+
+	// IsModerator returns true if the account has the moderator role.
+	//
+	// If no account with the ID exists, it returns an AccountNotExistsError.
+	IsModerator(ctx context.Context, id int64) (bool, error)
+}
+
+// Sessions records each login, and when it was last used.
+// Session tokens are checked by their signature, so these records don't decide whether one still works.
+type Sessions interface {
+	// StartSession records a login to the account at now, from the client, and returns its Session.
+	//
+	// If no account with the ID exists, it returns an AccountNotExistsError.
+	StartSession(ctx context.Context, accountID int64, client string, now time.Time) (Session, error)
+
+	// SessionUsed records that a request used the session at now. To save writes, this only changes the Session
+	// if it was last used a minute or more before. It does nothing if the account has no session with the ID.
+	SessionUsed(ctx context.Context, accountID int64, id int64, now time.Time) error
+
+	// AccountSessions returns every Session of the account, ordered by ID.
+	// It returns an empty slice if the account has none, even if the account doesn't exist.
+	AccountSessions(ctx context.Context, accountID int64) ([]Session, error)
+}
+
+// Outbox holds emails until they're sent. Senders claim the ones which are due, and then report
+// whether each one was sent. Emails which keep failing can be given up on, and retried later by hand.
+type Outbox interface {
+	// QueueEmail adds an email to the Outbox, due right away. The email's ID, CreatedAt,
+	// Attempts, NextAttemptAt, LastError and DeadAt are ignored.
+	QueueEmail(ctx context.Context, email QueuedEmail) error
+
+	// ClaimEmails returns up to limit emails which are due at now, oldest first. Dead emails are never due.
+	// The claimed emails aren't due again until lease has passed, so that concurrent senders
+	// don't send the same ones. If the sender dies, they'll be claimed again after that.
+	ClaimEmails(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]QueuedEmail, error)
+
+	// EmailSent deletes the email from the Outbox, along with its tokens.
+	//
+	// If no email has this ID, it returns a QueuedEmailNotExistsError.
+	EmailSent(ctx context.Context, id int64) error
+
+	// EmailFailed records a failed attempt to send the email, and makes it due again at retryAt.
+	// If retryAt is the zero Time, the email is dead, and won't be sent unless someone calls RetryEmail.
+	// Dead emails lose their tokens, so that they don't sit in the Outbox in plaintext.
+	//
+	// If no email has this ID, it returns a QueuedEmailNotExistsError.
+	EmailFailed(ctx context.Context, id int64, reason string, retryAt time.Time) error
+
+	// FailedEmails returns the emails which have failed at least once, dead or not, ordered by ID.
+	FailedEmails(ctx context.Context) ([]QueuedEmail, error)
+
+	// RetryEmail makes the email due right away, and clears its Attempts, even if it's dead.
+	// Dead emails get new tokens to replace the ones they lost, and those replace the account's current ones.
+	//
+	// If no email has this ID, it returns a QueuedEmailNotExistsError.
+	// If the email is dead, and the account no longer needs the tokens it carried, it returns a StaleQueuedEmailError.
+	// The email is left as it was.
+	RetryEmail(ctx context.Context, id int64) error
+}
+
+// Exporter moves accounts in and out of a Store wholesale.
+// This is used to back up the data, or copy it between storage backends.
+type Exporter interface {
+	// ExportAccounts returns every account in the Store, ordered by ID.
+	ExportAccounts(ctx context.Context) ([]StoredAccount, error)
+
+	// ImportAccounts saves the accounts with the IDs, password hashes and verification times they had in another Store.
+	// Either all of them are saved or none are.
+	//
+	// If the Store already has accounts, it returns a StoreNotEmptyError and saves nothing.
+	// If two of the accounts have the same email, it returns an EmailExistsError.
+	ImportAccounts(ctx context.Context, imported []StoredAccount) error
+}
@@ -0,0 +1,180 @@
+package storetest
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"github.com/wikisophia/api/server/accounts"
+)
+
+// DeletionTests is a testing suite which makes sure that a Store purges accounts when their owners ask,
+// and that nothing about them is left afterwards.
+type DeletionTests struct {
+	suite.Suite
+	// StoreFactory makes an empty Store.
+	StoreFactory func() accounts.Store
+}
+
+const deletionPassword = "some-long-password-for-tests"
+
+// TestScheduleAndCancel makes sure that scheduled deletions show up in the profile, and can be called off.
+func (suite *DeletionTests) TestScheduleAndCancel() {
+	store := suite.StoreFactory()
+	id := suite.newAccount(store, "someone@soph.wiki")
+	dueAt := time.Now().Add(-time.Minute).Truncate(time.Second)
+
+	require.NoError(suite.T(), store.ScheduleDeletion(context.Background(), id, deletionPassword, dueAt))
+	profile, err := store.AccountProfile(context.Background(), id)
+	require.NoError(suite.T(), err)
+	assert.WithinDuration(suite.T(), dueAt, profile.DeletionDueAt, time.Second)
+
+	require.NoError(suite.T(), store.CancelDeletion(context.Background(), id))
+	profile, err = store.AccountProfile(context.Background(), id)
+	require.NoError(suite.T(), err)
+	assert.True(suite.T(), profile.DeletionDueAt.IsZero())
+	purged, err := store.PurgeAccounts(context.Background(), time.Now())
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, purged)
+	_, err = store.Authenticate(context.Background(), "someone@soph.wiki", deletionPassword)
+	assert.NoError(suite.T(), err)
+}
+
+// TestWrongPasswordRejected makes sure that nobody can delete an account without its password.
+func (suite *DeletionTests) TestWrongPasswordRejected() {
+	store := suite.StoreFactory()
+	id := suite.newAccount(store, "someone@soph.wiki")
+	withoutPassword, _, err := store.NewResetToken(context.Background(), "other@soph.wiki")
+	require.NoError(suite.T(), err)
+
+	err = store.ScheduleDeletion(context.Background(), id, "wrong-password", time.Now())
+	assert.True(suite.T(), errors.As(err, &accounts.InvalidPasswordError{}))
+	err = store.ScheduleDeletion(context.Background(), withoutPassword.ID, "", time.Now())
+	assert.True(suite.T(), errors.As(err, &accounts.InvalidPasswordError{}))
+	purged, err := store.PurgeAccounts(context.Background(), time.Now().Add(time.Hour))
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, purged)
+}
+
+// TestMissingAccount makes sure that deletions of accounts which don't exist fail.
+func (suite *DeletionTests) TestMissingAccount() {
+	store := suite.StoreFactory()
+	err := store.ScheduleDeletion(context.Background(), 1, deletionPassword, time.Now())
+	assert.True(suite.T(), errors.As(err, &accounts.AccountNotExistsError{}))
+	err = store.CancelDeletion(context.Background(), 1)
+	assert.True(suite.T(), errors.As(err, &accounts.AccountNotExistsError{}))
+}
+
+// TestOnlyDueAccountsPurged makes sure that accounts aren't purged before their grace period is over.
+func (suite *DeletionTests) TestOnlyDueAccountsPurged() {
+	store := suite.StoreFactory()
+	now := time.Now()
+	due := suite.newAccount(store, "due@soph.wiki")
+	require.NoError(suite.T(), store.ScheduleDeletion(context.Background(), due, deletionPassword, now.Add(-time.Minute)))
+	later := suite.newAccount(store, "later@soph.wiki")
+	require.NoError(suite.T(), store.ScheduleDeletion(context.Background(), later, deletionPassword, now.Add(time.Hour)))
+	suite.newAccount(store, "kept@soph.wiki")
+
+	purged, err := store.PurgeAccounts(context.Background(), now)
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 1, purged)
+	_, err = store.Authenticate(context.Background(), "later@soph.wiki", deletionPassword)
+	assert.NoError(suite.T(), err)
+	_, err = store.Authenticate(context.Background(), "kept@soph.wiki", deletionPassword)
+	assert.NoError(suite.T(), err)
+
+	purged, err = store.PurgeAccounts(context.Background(), now)
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, purged, "accounts should only be purged once")
+}
+
+// TestPurgeForgetsEverything makes sure that nothing which could identify a purged account's owner is kept,
+// and that the account can't be used anymore.
+func (suite *DeletionTests) TestPurgeForgetsEverything() {
+	store := suite.StoreFactory()
+	id := suite.newAccount(store, "someone@soph.wiki")
+	name, bio := "Someone", "I like arguments."
+	_, err := store.UpdateProfile(context.Background(), id, accounts.ProfileUpdate{
+		DisplayName: &name,
+		Bio:         &bio,
+		Preferences: []byte(`{"theme":"dark"}`),
+	})
+	require.NoError(suite.T(), err)
+	_, err = store.RequestEmailChange(context.Background(), id, deletionPassword, "new@soph.wiki", "")
+	require.NoError(suite.T(), err)
+	require.NoError(suite.T(), store.ScheduleDeletion(context.Background(), id, deletionPassword, time.Now().Add(-time.Minute)))
+
+	purged, err := store.PurgeAccounts(context.Background(), time.Now())
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, purged)
+
+	_, err = store.Authenticate(context.Background(), "someone@soph.wiki", deletionPassword)
+	assert.True(suite.T(), errors.As(err, &accounts.AccountNotExistsError{}))
+	_, err = store.AccountProfile(context.Background(), id)
+	assert.True(suite.T(), errors.As(err, &accounts.AccountNotExistsError{}))
+	_, err = store.UpdateProfile(context.Background(), id, accounts.ProfileUpdate{DisplayName: &name})
+	assert.True(suite.T(), errors.As(err, &accounts.AccountNotExistsError{}))
+	_, err = store.EmailVerifiedAt(context.Background(), id)
+	assert.True(suite.T(), errors.As(err, &accounts.AccountNotExistsError{}))
+	_, err = store.RequestEmailChange(context.Background(), id, deletionPassword, "newer@soph.wiki", "")
+	assert.True(suite.T(), errors.As(err, &accounts.AccountNotExistsError{}))
+	err = store.ScheduleDeletion(context.Background(), id, deletionPassword, time.Now())
+	assert.True(suite.T(), errors.As(err, &accounts.AccountNotExistsError{}))
+	err = store.CancelDeletion(context.Background(), id)
+	assert.True(suite.T(), errors.As(err, &accounts.AccountNotExistsError{}))
+	claimed, err := store.ClaimEmails(context.Background(), time.Now(), 100, time.Hour)
+	require.NoError(suite.T(), err)
+	assert.Empty(suite.T(), claimed, "the purged account's emails shouldn't be sent")
+
+	exported, err := store.ExportAccounts(context.Background())
+	require.NoError(suite.T(), err)
+	require.Len(suite.T(), exported, 1)
+	assert.Equal(suite.T(), id, exported[0].ID)
+	assert.True(suite.T(), strings.HasSuffix(exported[0].Email, ".invalid"), "%s should be a placeholder", exported[0].Email)
+	assert.Empty(suite.T(), exported[0].PasswordHash)
+	assert.Empty(suite.T(), exported[0].DisplayName)
+	assert.Empty(suite.T(), exported[0].Bio)
+	assert.Nil(suite.T(), exported[0].Preferences)
+	assert.Nil(suite.T(), exported[0].EmailVerifiedAt)
+	assert.Nil(suite.T(), exported[0].DeletionDueAt)
+	assert.NotNil(suite.T(), exported[0].PurgedAt)
+
+	account, isNew, err := store.NewResetToken(context.Background(), "someone@soph.wiki")
+	require.NoError(suite.T(), err)
+	assert.True(suite.T(), isNew, "the email should be free for a new account")
+	assert.Greater(suite.T(), account.ID, id, "purged accounts' IDs shouldn't be reused")
+}
+
+// TestDeletionExported makes sure that scheduled and finished purges survive an export and import.
+func (suite *DeletionTests) TestDeletionExported() {
+	source := suite.StoreFactory()
+	purgedID := suite.newAccount(source, "purged@soph.wiki")
+	require.NoError(suite.T(), source.ScheduleDeletion(context.Background(), purgedID, deletionPassword, time.Now().Add(-time.Minute)))
+	_, err := source.PurgeAccounts(context.Background(), time.Now())
+	require.NoError(suite.T(), err)
+	dueID := suite.newAccount(source, "due@soph.wiki")
+	dueAt := time.Now().Add(time.Hour)
+	require.NoError(suite.T(), source.ScheduleDeletion(context.Background(), dueID, deletionPassword, dueAt))
+
+	exported, err := source.ExportAccounts(context.Background())
+	require.NoError(suite.T(), err)
+	destination := suite.StoreFactory()
+	require.NoError(suite.T(), destination.ImportAccounts(context.Background(), exported))
+	_, err = destination.AccountProfile(context.Background(), purgedID)
+	assert.True(suite.T(), errors.As(err, &accounts.AccountNotExistsError{}))
+	profile, err := destination.AccountProfile(context.Background(), dueID)
+	require.NoError(suite.T(), err)
+	assert.WithinDuration(suite.T(), dueAt, profile.DeletionDueAt, time.Second)
+}
+
+// newAccount makes an account with deletionPassword, and returns its ID.
+func (suite *DeletionTests) newAccount(store accounts.Store, email string) int64 {
+	account, _, err := store.NewResetToken(context.Background(), email)
+	require.NoError(suite.T(), err)
+	require.NoError(suite.T(), store.SetForgottenPassword(context.Background(), account.ID, deletionPassword, account.ResetToken))
+	return account.ID
+}
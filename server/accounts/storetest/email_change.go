@@ -0,0 +1,186 @@
+package storetest
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/accounts/tokens"
+)
+
+// EmailChangeTests is a testing suite which makes sure that a Store only moves accounts to new emails
+// once they're confirmed, and keeps each email on one account.
+type EmailChangeTests struct {
+	suite.Suite
+	// StoreFactory makes an empty Store whose tokens last as long as expiry says.
+	// The durations may be negative, which makes tokens that have already expired.
+	StoreFactory func(expiry tokens.Expiry) accounts.Store
+}
+
+const changePassword = "some-long-password-for-tests"
+
+// TestChangeFlow makes sure that an account keeps its email until the move is confirmed,
+// and that both addresses hear about it.
+func (suite *EmailChangeTests) TestChangeFlow() {
+	store := suite.StoreFactory(tokens.Expiry{Reset: time.Hour, Verification: time.Hour})
+	created := suite.newAccount(store, "old@soph.wiki")
+	suite.claimAll(store)
+
+	account, err := store.RequestEmailChange(context.Background(), created.ID, changePassword, "new@soph.wiki", "")
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), created.ID, account.ID)
+	assert.Equal(suite.T(), "new@soph.wiki", account.Email)
+	assert.NotEmpty(suite.T(), account.EmailChangeToken)
+
+	queued := suite.claimAll(store)
+	require.Len(suite.T(), queued, 2)
+	assert.Equal(suite.T(), accounts.EmailKindEmailChange, queued[0].Kind)
+	assert.Equal(suite.T(), "new@soph.wiki", queued[0].Account.Email)
+	assert.Equal(suite.T(), account.EmailChangeToken, queued[0].Account.EmailChangeToken)
+	assert.Equal(suite.T(), accounts.EmailKindEmailChangeNotice, queued[1].Kind)
+	assert.Equal(suite.T(), "old@soph.wiki", queued[1].Account.Email)
+	assert.Empty(suite.T(), queued[1].Account.EmailChangeToken, "the old email shouldn't get the token")
+
+	_, err = store.Authenticate(context.Background(), "old@soph.wiki", changePassword)
+	require.NoError(suite.T(), err, "the account shouldn't move until the change is confirmed")
+
+	before := time.Now().Add(-time.Second)
+	require.NoError(suite.T(), store.ConfirmEmailChange(context.Background(), account.ID, account.EmailChangeToken))
+	id, err := store.Authenticate(context.Background(), "new@soph.wiki", changePassword)
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), created.ID, id)
+	_, err = store.Authenticate(context.Background(), "old@soph.wiki", changePassword)
+	assert.True(suite.T(), errors.As(err, &accounts.AccountNotExistsError{}))
+	verifiedAt, err := store.EmailVerifiedAt(context.Background(), created.ID)
+	require.NoError(suite.T(), err)
+	assert.False(suite.T(), verifiedAt.Before(before), "confirming the new email should verify it")
+}
+
+// TestOldTokensRevoked makes sure that tokens sent to the old email stop working once the account moves.
+func (suite *EmailChangeTests) TestOldTokensRevoked() {
+	store := suite.StoreFactory(tokens.Expiry{Reset: time.Hour, Verification: time.Hour})
+	created := suite.newAccount(store, "old@soph.wiki")
+	reset, _, err := store.NewResetToken(context.Background(), "old@soph.wiki")
+	require.NoError(suite.T(), err)
+
+	account, err := store.RequestEmailChange(context.Background(), created.ID, changePassword, "new@soph.wiki", "")
+	require.NoError(suite.T(), err)
+	require.NoError(suite.T(), store.ConfirmEmailChange(context.Background(), account.ID, account.EmailChangeToken))
+
+	err = store.SetForgottenPassword(context.Background(), created.ID, "another-long-password", reset.ResetToken)
+	assert.True(suite.T(), errors.As(err, &accounts.InvalidResetTokenError{}))
+	err = store.VerifyEmail(context.Background(), created.ID, created.VerificationToken)
+	assert.True(suite.T(), errors.As(err, &accounts.InvalidVerificationTokenError{}))
+}
+
+// TestWrongPasswordRejected makes sure that nobody can move an account without its password.
+func (suite *EmailChangeTests) TestWrongPasswordRejected() {
+	store := suite.StoreFactory(tokens.Expiry{Reset: time.Hour, Verification: time.Hour})
+	created := suite.newAccount(store, "old@soph.wiki")
+	withoutPassword, _, err := store.NewResetToken(context.Background(), "other@soph.wiki")
+	require.NoError(suite.T(), err)
+	suite.claimAll(store)
+
+	_, err = store.RequestEmailChange(context.Background(), created.ID, "wrong-password", "new@soph.wiki", "")
+	assert.True(suite.T(), errors.As(err, &accounts.InvalidPasswordError{}))
+	_, err = store.RequestEmailChange(context.Background(), withoutPassword.ID, "", "new@soph.wiki", "")
+	assert.True(suite.T(), errors.As(err, &accounts.InvalidPasswordError{}))
+	assert.Empty(suite.T(), suite.claimAll(store), "failed requests shouldn't queue emails")
+}
+
+// TestMissingAccount makes sure that changes to accounts which don't exist fail.
+func (suite *EmailChangeTests) TestMissingAccount() {
+	store := suite.StoreFactory(tokens.Expiry{Reset: time.Hour, Verification: time.Hour})
+	_, err := store.RequestEmailChange(context.Background(), 1, changePassword, "new@soph.wiki", "")
+	assert.True(suite.T(), errors.As(err, &accounts.AccountNotExistsError{}))
+	err = store.ConfirmEmailChange(context.Background(), 1, "token")
+	assert.True(suite.T(), errors.As(err, &accounts.AccountNotExistsError{}))
+}
+
+// TestSameEmailRejected makes sure that an account can't move to the email it has.
+func (suite *EmailChangeTests) TestSameEmailRejected() {
+	store := suite.StoreFactory(tokens.Expiry{Reset: time.Hour, Verification: time.Hour})
+	created := suite.newAccount(store, "old@soph.wiki")
+	_, err := store.RequestEmailChange(context.Background(), created.ID, changePassword, "old@soph.wiki", "")
+	assert.True(suite.T(), errors.As(err, &accounts.EmailExistsError{}))
+}
+
+// TestTakenEmailRejected makes sure that two accounts never share an email. Asking for a taken one
+// looks like it works, so that it doesn't reveal which emails have accounts.
+func (suite *EmailChangeTests) TestTakenEmailRejected() {
+	store := suite.StoreFactory(tokens.Expiry{Reset: time.Hour, Verification: time.Hour})
+	first := suite.newAccount(store, "first@soph.wiki")
+	second := suite.newAccount(store, "second@soph.wiki")
+	firstMove, err := store.RequestEmailChange(context.Background(), first.ID, changePassword, "new@soph.wiki", "")
+	require.NoError(suite.T(), err)
+	secondMove, err := store.RequestEmailChange(context.Background(), second.ID, changePassword, "new@soph.wiki", "")
+	require.NoError(suite.T(), err)
+
+	require.NoError(suite.T(), store.ConfirmEmailChange(context.Background(), second.ID, secondMove.EmailChangeToken))
+	err = store.ConfirmEmailChange(context.Background(), first.ID, firstMove.EmailChangeToken)
+	assert.True(suite.T(), errors.As(err, &accounts.EmailExistsError{}))
+	_, err = store.Authenticate(context.Background(), "first@soph.wiki", changePassword)
+	assert.NoError(suite.T(), err)
+}
+
+// TestNewRequestReplacesOld makes sure that only the latest move can be confirmed.
+func (suite *EmailChangeTests) TestNewRequestReplacesOld() {
+	store := suite.StoreFactory(tokens.Expiry{Reset: time.Hour, Verification: time.Hour})
+	created := suite.newAccount(store, "old@soph.wiki")
+	first, err := store.RequestEmailChange(context.Background(), created.ID, changePassword, "first@soph.wiki", "")
+	require.NoError(suite.T(), err)
+	second, err := store.RequestEmailChange(context.Background(), created.ID, changePassword, "second@soph.wiki", "")
+	require.NoError(suite.T(), err)
+
+	err = store.ConfirmEmailChange(context.Background(), created.ID, first.EmailChangeToken)
+	assert.True(suite.T(), errors.As(err, &accounts.InvalidEmailChangeTokenError{}))
+	require.NoError(suite.T(), store.ConfirmEmailChange(context.Background(), created.ID, second.EmailChangeToken))
+	_, err = store.Authenticate(context.Background(), "second@soph.wiki", changePassword)
+	assert.NoError(suite.T(), err)
+}
+
+// TestTokenSingleUse makes sure that an email change token can't be used twice.
+func (suite *EmailChangeTests) TestTokenSingleUse() {
+	store := suite.StoreFactory(tokens.Expiry{Reset: time.Hour, Verification: time.Hour})
+	created := suite.newAccount(store, "old@soph.wiki")
+	account, err := store.RequestEmailChange(context.Background(), created.ID, changePassword, "new@soph.wiki", "")
+	require.NoError(suite.T(), err)
+	require.NoError(suite.T(), store.ConfirmEmailChange(context.Background(), account.ID, account.EmailChangeToken))
+
+	err = store.ConfirmEmailChange(context.Background(), account.ID, account.EmailChangeToken)
+	assert.True(suite.T(), errors.As(err, &accounts.InvalidEmailChangeTokenError{}))
+	err = store.ConfirmEmailChange(context.Background(), account.ID, "")
+	assert.True(suite.T(), errors.As(err, &accounts.InvalidEmailChangeTokenError{}))
+}
+
+// TestExpiredTokenRejected makes sure that an email change token can't be used once it expires.
+func (suite *EmailChangeTests) TestExpiredTokenRejected() {
+	store := suite.StoreFactory(tokens.Expiry{Reset: time.Hour, Verification: -time.Minute})
+	created := suite.newAccount(store, "old@soph.wiki")
+	account, err := store.RequestEmailChange(context.Background(), created.ID, changePassword, "new@soph.wiki", "")
+	require.NoError(suite.T(), err)
+
+	err = store.ConfirmEmailChange(context.Background(), account.ID, account.EmailChangeToken)
+	assert.True(suite.T(), errors.As(err, &accounts.InvalidEmailChangeTokenError{}))
+	_, err = store.Authenticate(context.Background(), "old@soph.wiki", changePassword)
+	assert.NoError(suite.T(), err)
+}
+
+// newAccount makes an account with changePassword. Its VerificationToken is set.
+func (suite *EmailChangeTests) newAccount(store accounts.Store, email string) accounts.Account {
+	account, _, err := store.NewResetToken(context.Background(), email)
+	require.NoError(suite.T(), err)
+	require.NoError(suite.T(), store.SetForgottenPassword(context.Background(), account.ID, changePassword, account.ResetToken))
+	return account
+}
+
+// claimAll claims every email which is due in the store's Outbox.
+func (suite *EmailChangeTests) claimAll(store accounts.Store) []accounts.QueuedEmail {
+	claimed, err := store.ClaimEmails(context.Background(), time.Now(), 100, time.Hour)
+	require.NoError(suite.T(), err)
+	return claimed
+}
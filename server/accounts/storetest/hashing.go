@@ -0,0 +1,82 @@
+package storetest
+
+import (
+	"context"
+	"errors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/passwords"
+)
+
+// HashingTests is a testing suite which makes sure that a Store only saves hashed passwords,
+// and upgrades old hashes when people log in.
+type HashingTests struct {
+	suite.Suite
+	// StoreFactory makes an empty Store which hashes passwords with hasher.
+	StoreFactory func(hasher *RecordingHasher) accounts.Store
+	// Weak and Strong should hash with different params, so that Strong.NeedsRehash is true for Weak's hashes.
+	// Both should still be cheap, to keep the suite fast.
+	Weak   *passwords.Hasher
+	Strong *passwords.Hasher
+}
+
+// TestPasswordsHashed makes sure that passwords set with a reset token or changed get hashed.
+func (suite *HashingTests) TestPasswordsHashed() {
+	hasher := &RecordingHasher{Hasher: suite.Weak}
+	store := suite.StoreFactory(hasher)
+	weakCost := suite.costOf(suite.Weak)
+
+	account, _, err := store.NewResetToken(context.Background(), "email@soph.wiki")
+	require.NoError(suite.T(), err)
+	require.NoError(suite.T(), store.SetForgottenPassword(context.Background(), account.ID, "first-password", account.ResetToken))
+	hasher.TakeChecked()
+	_, err = store.Authenticate(context.Background(), "email@soph.wiki", "first-password")
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), []string{weakCost}, hasher.TakeChecked(), "a password set with a reset token should be hashed")
+
+	require.NoError(suite.T(), store.ChangePassword(context.Background(), account.ID, "first-password", "second-password", ""))
+	hasher.TakeChecked()
+	_, err = store.Authenticate(context.Background(), "email@soph.wiki", "second-password")
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), []string{weakCost}, hasher.TakeChecked(), "a changed password should be hashed")
+}
+
+// TestAuthenticateRehashes makes sure that a successful login replaces a hash made with weaker params,
+// and that a failed one doesn't.
+func (suite *HashingTests) TestAuthenticateRehashes() {
+	hasher := &RecordingHasher{Hasher: suite.Weak}
+	store := suite.StoreFactory(hasher)
+	weakCost, strongCost := suite.costOf(suite.Weak), suite.costOf(suite.Strong)
+
+	account, _, err := store.NewResetToken(context.Background(), "email@soph.wiki")
+	require.NoError(suite.T(), err)
+	require.NoError(suite.T(), store.SetForgottenPassword(context.Background(), account.ID, "password", account.ResetToken))
+	hasher.Hasher = suite.Strong
+	hasher.TakeChecked()
+
+	_, err = store.Authenticate(context.Background(), "email@soph.wiki", "wrong-password")
+	require.True(suite.T(), errors.As(err, &accounts.InvalidPasswordError{}))
+	assert.Equal(suite.T(), []string{weakCost}, hasher.TakeChecked())
+
+	_, err = store.Authenticate(context.Background(), "email@soph.wiki", "wrong-password")
+	require.True(suite.T(), errors.As(err, &accounts.InvalidPasswordError{}))
+	assert.Equal(suite.T(), []string{weakCost}, hasher.TakeChecked(), "failed logins shouldn't rehash")
+
+	_, err = store.Authenticate(context.Background(), "email@soph.wiki", "password")
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), []string{weakCost}, hasher.TakeChecked())
+
+	_, err = store.Authenticate(context.Background(), "email@soph.wiki", "password")
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), []string{strongCost}, hasher.TakeChecked(), "a successful login should rehash")
+}
+
+// costOf returns the cost of the hashes made by hasher.
+func (suite *HashingTests) costOf(hasher *passwords.Hasher) string {
+	hash, err := hasher.Hash(context.Background(), "password")
+	require.NoError(suite.T(), err)
+	return hashCost(hash)
+}
@@ -0,0 +1,241 @@
+package storetest
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"github.com/wikisophia/api/server/accounts"
+)
+
+// OutboxTests is a testing suite which makes sure that a Store queues an email with every token it makes,
+// and that its Outbox hands out, retries and gives up on emails properly.
+type OutboxTests struct {
+	suite.Suite
+	// StoreFactory makes an empty Store whose tokens last at least an hour.
+	StoreFactory func() accounts.Store
+}
+
+// TestTokensQueueEmails makes sure that each token is queued in an email which can use it.
+func (suite *OutboxTests) TestTokensQueueEmails() {
+	store := suite.StoreFactory()
+	created, _, err := store.NewResetToken(context.Background(), "email@soph.wiki")
+	require.NoError(suite.T(), err)
+	reset, _, err := store.NewResetToken(context.Background(), "email@soph.wiki")
+	require.NoError(suite.T(), err)
+	verification, err := store.NewVerificationToken(context.Background(), "email@soph.wiki")
+	require.NoError(suite.T(), err)
+
+	claimed := suite.claim(store, time.Now().Add(time.Second))
+	require.Len(suite.T(), claimed, 3)
+	assert.Equal(suite.T(), accounts.EmailKindWelcome, claimed[0].Kind)
+	assert.Equal(suite.T(), created, claimed[0].Account)
+	assert.NotEmpty(suite.T(), created.VerificationToken, "new accounts should get a verification token")
+	assert.Equal(suite.T(), accounts.EmailKindReset, claimed[1].Kind)
+	assert.Equal(suite.T(), reset, claimed[1].Account)
+	assert.Empty(suite.T(), reset.VerificationToken, "existing accounts shouldn't get a new verification token")
+	assert.Equal(suite.T(), accounts.EmailKindVerification, claimed[2].Kind)
+	assert.Equal(suite.T(), verification, claimed[2].Account)
+
+	require.NoError(suite.T(), store.VerifyEmail(context.Background(), created.ID, claimed[2].Account.VerificationToken))
+	require.NoError(suite.T(), store.SetForgottenPassword(context.Background(), created.ID, "password", claimed[1].Account.ResetToken))
+}
+
+// TestWelcomeVerificationTokenWorks makes sure the verification token in a welcome email can be used.
+func (suite *OutboxTests) TestWelcomeVerificationTokenWorks() {
+	store := suite.StoreFactory()
+	created, _, err := store.NewResetToken(context.Background(), "email@soph.wiki")
+	require.NoError(suite.T(), err)
+	require.NoError(suite.T(), store.VerifyEmail(context.Background(), created.ID, created.VerificationToken))
+}
+
+// TestFailedVerificationQueuesNothing makes sure no email is queued when a verification token can't be made.
+func (suite *OutboxTests) TestFailedVerificationQueuesNothing() {
+	store := suite.StoreFactory()
+	_, err := store.NewVerificationToken(context.Background(), "missing@soph.wiki")
+	require.True(suite.T(), errors.As(err, &accounts.AccountNotExistsError{}))
+	assert.Empty(suite.T(), suite.claim(store, time.Now().Add(time.Second)))
+}
+
+// TestQueueEmail makes sure emails queued directly keep their contents.
+func (suite *OutboxTests) TestQueueEmail() {
+	store := suite.StoreFactory()
+	account, _, err := store.NewResetToken(context.Background(), "email@soph.wiki")
+	require.NoError(suite.T(), err)
+	suite.sendAll(store)
+
+	until := time.Now().Add(time.Hour).Truncate(time.Second)
+	require.NoError(suite.T(), store.QueueEmail(context.Background(), accounts.QueuedEmail{
+		Kind:        accounts.EmailKindLocked,
+		Account:     accounts.Account{ID: account.ID, Email: account.Email},
+		LockedUntil: until,
+	}))
+	claimed := suite.claim(store, time.Now().Add(time.Second))
+	require.Len(suite.T(), claimed, 1)
+	assert.Equal(suite.T(), accounts.EmailKindLocked, claimed[0].Kind)
+	assert.Equal(suite.T(), accounts.Account{ID: account.ID, Email: account.Email}, claimed[0].Account)
+	assert.True(suite.T(), until.Equal(claimed[0].LockedUntil))
+	assert.Zero(suite.T(), claimed[0].Attempts)
+}
+
+// TestClaimsAreLeased makes sure claimed emails aren't handed out again until their lease runs out.
+func (suite *OutboxTests) TestClaimsAreLeased() {
+	store := suite.StoreFactory()
+	for _, email := range []string{"first@soph.wiki", "second@soph.wiki", "third@soph.wiki"} {
+		_, _, err := store.NewResetToken(context.Background(), email)
+		require.NoError(suite.T(), err)
+	}
+	now := time.Now().Add(time.Second)
+
+	first, err := store.ClaimEmails(context.Background(), now, 2, time.Hour)
+	require.NoError(suite.T(), err)
+	require.Len(suite.T(), first, 2)
+	assert.Equal(suite.T(), "first@soph.wiki", first[0].Account.Email)
+	assert.Equal(suite.T(), "second@soph.wiki", first[1].Account.Email)
+
+	second, err := store.ClaimEmails(context.Background(), now, 2, time.Hour)
+	require.NoError(suite.T(), err)
+	require.Len(suite.T(), second, 1)
+	assert.Equal(suite.T(), "third@soph.wiki", second[0].Account.Email)
+
+	assert.Len(suite.T(), suite.claim(store, now.Add(2*time.Hour)), 3, "emails should be claimable again once their lease runs out")
+}
+
+// TestSentEmailsDeleted makes sure sent emails are never handed out again.
+func (suite *OutboxTests) TestSentEmailsDeleted() {
+	store := suite.StoreFactory()
+	_, _, err := store.NewResetToken(context.Background(), "email@soph.wiki")
+	require.NoError(suite.T(), err)
+	claimed := suite.claim(store, time.Now().Add(time.Second))
+	require.Len(suite.T(), claimed, 1)
+
+	require.NoError(suite.T(), store.EmailSent(context.Background(), claimed[0].ID))
+	assert.Empty(suite.T(), suite.claim(store, time.Now().Add(2*time.Hour)))
+	err = store.EmailSent(context.Background(), claimed[0].ID)
+	assert.True(suite.T(), errors.As(err, &accounts.QueuedEmailNotExistsError{}))
+}
+
+// TestFailuresRetried makes sure failed emails are due again at the retry time, and show up as failed.
+func (suite *OutboxTests) TestFailuresRetried() {
+	store := suite.StoreFactory()
+	_, _, err := store.NewResetToken(context.Background(), "email@soph.wiki")
+	require.NoError(suite.T(), err)
+	now := time.Now().Add(time.Second)
+	claimed := suite.claim(store, now)
+	require.Len(suite.T(), claimed, 1)
+	require.NoError(suite.T(), store.EmailFailed(context.Background(), claimed[0].ID, "connection refused", now.Add(time.Hour)))
+
+	failed, err := store.FailedEmails(context.Background())
+	require.NoError(suite.T(), err)
+	require.Len(suite.T(), failed, 1)
+	assert.Equal(suite.T(), 1, failed[0].Attempts)
+	assert.Equal(suite.T(), "connection refused", failed[0].LastError)
+	assert.True(suite.T(), failed[0].DeadAt.IsZero())
+
+	assert.Empty(suite.T(), suite.claim(store, now.Add(30*time.Minute)))
+	retried := suite.claim(store, now.Add(90*time.Minute))
+	require.Len(suite.T(), retried, 1)
+	assert.Equal(suite.T(), claimed[0].ID, retried[0].ID)
+	assert.Equal(suite.T(), 1, retried[0].Attempts)
+}
+
+// TestDeadEmailsRetriedByHand makes sure dead emails are only sent again after a RetryEmail call.
+func (suite *OutboxTests) TestDeadEmailsRetriedByHand() {
+	store := suite.StoreFactory()
+	_, _, err := store.NewResetToken(context.Background(), "email@soph.wiki")
+	require.NoError(suite.T(), err)
+	claimed := suite.claim(store, time.Now().Add(time.Second))
+	require.Len(suite.T(), claimed, 1)
+	require.NoError(suite.T(), store.EmailFailed(context.Background(), claimed[0].ID, "mailbox unavailable", time.Time{}))
+
+	assert.Empty(suite.T(), suite.claim(store, time.Now().Add(24*time.Hour)), "dead emails should never be due")
+	failed, err := store.FailedEmails(context.Background())
+	require.NoError(suite.T(), err)
+	require.Len(suite.T(), failed, 1)
+	assert.False(suite.T(), failed[0].DeadAt.IsZero())
+
+	require.NoError(suite.T(), store.RetryEmail(context.Background(), claimed[0].ID))
+	retried := suite.claim(store, time.Now().Add(time.Second))
+	require.Len(suite.T(), retried, 1)
+	assert.Zero(suite.T(), retried[0].Attempts)
+	assert.True(suite.T(), retried[0].DeadAt.IsZero())
+}
+
+// TestDeadEmailsLoseTokens makes sure dead emails don't keep their tokens, and get new ones when they're retried.
+func (suite *OutboxTests) TestDeadEmailsLoseTokens() {
+	store := suite.StoreFactory()
+	created, _, err := store.NewResetToken(context.Background(), "email@soph.wiki")
+	require.NoError(suite.T(), err)
+	claimed := suite.claim(store, time.Now().Add(time.Second))
+	require.Len(suite.T(), claimed, 1)
+	require.NoError(suite.T(), store.EmailFailed(context.Background(), claimed[0].ID, "mailbox unavailable", time.Time{}))
+
+	failed, err := store.FailedEmails(context.Background())
+	require.NoError(suite.T(), err)
+	require.Len(suite.T(), failed, 1)
+	assert.Equal(suite.T(), accounts.Account{ID: created.ID, Email: created.Email}, failed[0].Account)
+
+	require.NoError(suite.T(), store.RetryEmail(context.Background(), claimed[0].ID))
+	retried := suite.claim(store, time.Now().Add(time.Second))
+	require.Len(suite.T(), retried, 1)
+	assert.Equal(suite.T(), accounts.EmailKindWelcome, retried[0].Kind)
+	assert.NotEmpty(suite.T(), retried[0].Account.ResetToken)
+	assert.NotEqual(suite.T(), created.ResetToken, retried[0].Account.ResetToken)
+	assert.NotEmpty(suite.T(), retried[0].Account.VerificationToken)
+	assert.NotEqual(suite.T(), created.VerificationToken, retried[0].Account.VerificationToken)
+
+	err = store.SetForgottenPassword(context.Background(), created.ID, "password", created.ResetToken)
+	assert.True(suite.T(), errors.As(err, &accounts.InvalidResetTokenError{}), "the new reset token should replace the old one")
+	require.NoError(suite.T(), store.SetForgottenPassword(context.Background(), created.ID, "password", retried[0].Account.ResetToken))
+	require.NoError(suite.T(), store.VerifyEmail(context.Background(), created.ID, retried[0].Account.VerificationToken))
+}
+
+// TestStaleDeadEmailsNotRetried makes sure dead emails aren't retried once the account doesn't need their tokens.
+func (suite *OutboxTests) TestStaleDeadEmailsNotRetried() {
+	store := suite.StoreFactory()
+	_, _, err := store.NewResetToken(context.Background(), "email@soph.wiki")
+	require.NoError(suite.T(), err)
+	suite.sendAll(store)
+	verification, err := store.NewVerificationToken(context.Background(), "email@soph.wiki")
+	require.NoError(suite.T(), err)
+	claimed := suite.claim(store, time.Now().Add(time.Second))
+	require.Len(suite.T(), claimed, 1)
+	require.NoError(suite.T(), store.EmailFailed(context.Background(), claimed[0].ID, "mailbox unavailable", time.Time{}))
+	require.NoError(suite.T(), store.VerifyEmail(context.Background(), verification.ID, verification.VerificationToken))
+
+	err = store.RetryEmail(context.Background(), claimed[0].ID)
+	assert.True(suite.T(), errors.As(err, &accounts.StaleQueuedEmailError{}))
+	failed, err := store.FailedEmails(context.Background())
+	require.NoError(suite.T(), err)
+	require.Len(suite.T(), failed, 1)
+	assert.False(suite.T(), failed[0].DeadAt.IsZero(), "stale emails should stay dead")
+}
+
+// TestMissingEmails makes sure the Outbox methods which take an ID fail on ones which don't exist.
+func (suite *OutboxTests) TestMissingEmails() {
+	store := suite.StoreFactory()
+	err := store.EmailFailed(context.Background(), 100, "reason", time.Now())
+	assert.True(suite.T(), errors.As(err, &accounts.QueuedEmailNotExistsError{}))
+	err = store.RetryEmail(context.Background(), 100)
+	assert.True(suite.T(), errors.As(err, &accounts.QueuedEmailNotExistsError{}))
+	failed, err := store.FailedEmails(context.Background())
+	require.NoError(suite.T(), err)
+	assert.Empty(suite.T(), failed)
+}
+
+// claim returns every email which is due at now.
+func (suite *OutboxTests) claim(store accounts.Store, now time.Time) []accounts.QueuedEmail {
+	claimed, err := store.ClaimEmails(context.Background(), now, 100, time.Hour)
+	require.NoError(suite.T(), err)
+	return claimed
+}
+
+// sendAll marks every queued email as sent.
+func (suite *OutboxTests) sendAll(store accounts.Store) {
+	for _, email := range suite.claim(store, time.Now().Add(time.Second)) {
+		require.NoError(suite.T(), store.EmailSent(context.Background(), email.ID))
+	}
+}
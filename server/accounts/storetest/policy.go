@@ -0,0 +1,89 @@
+package storetest
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"github.com/wikisophia/api/server/accounts"
+)
+
+// PolicyTests is a testing suite which makes sure that a Store checks new passwords against its
+// accounts.PasswordPolicy, but only once the caller has proven that it may set one.
+// Otherwise, the rejections could tell strangers something about the account's email.
+type PolicyTests struct {
+	suite.Suite
+	// StoreFactory makes an empty Store which checks passwords against policy.
+	StoreFactory func(policy accounts.PasswordPolicy) accounts.Store
+}
+
+// TestSetForgottenPasswordChecksPolicy makes sure the policy gets the account's email,
+// and that a rejected password doesn't use up the reset token.
+func (suite *PolicyTests) TestSetForgottenPasswordChecksPolicy() {
+	policy := &rejectingPolicy{rejected: "rejected-password"}
+	store := suite.StoreFactory(policy)
+	account, _, err := store.NewResetToken(context.Background(), "email@soph.wiki")
+	require.NoError(suite.T(), err)
+
+	err = store.SetForgottenPassword(context.Background(), account.ID, "rejected-password", "wrong-"+account.ResetToken)
+	require.True(suite.T(), errors.As(err, &accounts.InvalidResetTokenError{}))
+	assert.Empty(suite.T(), policy.takeEmails(), "the policy shouldn't be checked without the right token")
+
+	err = store.SetForgottenPassword(context.Background(), account.ID, "rejected-password", account.ResetToken)
+	var prohibited accounts.ProhibitedPasswordError
+	require.True(suite.T(), errors.As(err, &prohibited))
+	assert.Equal(suite.T(), []string{"is rejected"}, prohibited.Reasons)
+	assert.Equal(suite.T(), []string{"email@soph.wiki"}, policy.takeEmails())
+
+	require.NoError(suite.T(), store.SetForgottenPassword(context.Background(), account.ID, "accepted-password", account.ResetToken))
+}
+
+// TestChangePasswordChecksPolicy makes sure the policy gets the account's email,
+// and that a rejected password leaves the old one in place.
+func (suite *PolicyTests) TestChangePasswordChecksPolicy() {
+	policy := &rejectingPolicy{rejected: "rejected-password"}
+	store := suite.StoreFactory(policy)
+	account, _, err := store.NewResetToken(context.Background(), "email@soph.wiki")
+	require.NoError(suite.T(), err)
+	require.NoError(suite.T(), store.SetForgottenPassword(context.Background(), account.ID, "old-password", account.ResetToken))
+	policy.takeEmails()
+
+	err = store.ChangePassword(context.Background(), account.ID, "wrong-password", "rejected-password", "")
+	require.True(suite.T(), errors.As(err, &accounts.InvalidPasswordError{}))
+	assert.Empty(suite.T(), policy.takeEmails(), "the policy shouldn't be checked without the right password")
+
+	err = store.ChangePassword(context.Background(), account.ID, "old-password", "rejected-password", "")
+	require.True(suite.T(), errors.As(err, &accounts.ProhibitedPasswordError{}))
+	assert.Equal(suite.T(), []string{"email@soph.wiki"}, policy.takeEmails())
+
+	_, err = store.Authenticate(context.Background(), "email@soph.wiki", "old-password")
+	require.NoError(suite.T(), err)
+}
+
+// rejectingPolicy rejects one password, and records the emails it was checked with.
+type rejectingPolicy struct {
+	rejected string
+	mutex    sync.Mutex
+	emails   []string
+}
+
+func (p *rejectingPolicy) Check(email, password string) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.emails = append(p.emails, email)
+	if password == p.rejected {
+		return accounts.ProhibitedPasswordError{Reasons: []string{"is rejected"}}
+	}
+	return nil
+}
+
+func (p *rejectingPolicy) takeEmails() []string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	emails := p.emails
+	p.emails = nil
+	return emails
+}
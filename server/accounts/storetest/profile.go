@@ -0,0 +1,99 @@
+package storetest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"github.com/wikisophia/api/server/accounts"
+)
+
+// ProfileTests is a testing suite which makes sure that a Store keeps what accounts say about themselves.
+type ProfileTests struct {
+	suite.Suite
+	// StoreFactory makes an empty Store.
+	StoreFactory func() accounts.Store
+}
+
+// TestNewProfilesEmpty makes sure that new accounts start with empty profiles.
+func (suite *ProfileTests) TestNewProfilesEmpty() {
+	store := suite.StoreFactory()
+	account, _, err := store.NewResetToken(context.Background(), "someone@soph.wiki")
+	require.NoError(suite.T(), err)
+
+	profile, err := store.AccountProfile(context.Background(), account.ID)
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), accounts.AccountProfile{ID: account.ID, Email: "someone@soph.wiki"}, profile)
+}
+
+// TestUpdatesPartial makes sure that updates only change the parts of the profile which they set.
+func (suite *ProfileTests) TestUpdatesPartial() {
+	store := suite.StoreFactory()
+	account, _, err := store.NewResetToken(context.Background(), "someone@soph.wiki")
+	require.NoError(suite.T(), err)
+
+	name := "Someone"
+	updated, err := store.UpdateProfile(context.Background(), account.ID, accounts.ProfileUpdate{
+		DisplayName: &name,
+		Preferences: json.RawMessage(`{"theme":"dark"}`),
+	})
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "Someone", updated.DisplayName)
+	assert.JSONEq(suite.T(), `{"theme":"dark"}`, string(updated.Preferences))
+
+	bio := "I like arguments."
+	updated, err = store.UpdateProfile(context.Background(), account.ID, accounts.ProfileUpdate{Bio: &bio})
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "Someone", updated.DisplayName)
+	assert.Equal(suite.T(), "I like arguments.", updated.Bio)
+	assert.JSONEq(suite.T(), `{"theme":"dark"}`, string(updated.Preferences))
+
+	empty := ""
+	_, err = store.UpdateProfile(context.Background(), account.ID, accounts.ProfileUpdate{
+		DisplayName: &empty,
+		Preferences: json.RawMessage(`{}`),
+	})
+	require.NoError(suite.T(), err)
+	profile, err := store.AccountProfile(context.Background(), account.ID)
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "", profile.DisplayName)
+	assert.Equal(suite.T(), "I like arguments.", profile.Bio)
+	assert.JSONEq(suite.T(), `{}`, string(profile.Preferences))
+}
+
+// TestProfileExported makes sure that profiles survive an export and import.
+func (suite *ProfileTests) TestProfileExported() {
+	source := suite.StoreFactory()
+	account, _, err := source.NewResetToken(context.Background(), "someone@soph.wiki")
+	require.NoError(suite.T(), err)
+	name, bio := "Someone", "I like arguments."
+	_, err = source.UpdateProfile(context.Background(), account.ID, accounts.ProfileUpdate{
+		DisplayName: &name,
+		Bio:         &bio,
+		Preferences: json.RawMessage(`{"theme":"dark"}`),
+	})
+	require.NoError(suite.T(), err)
+
+	exported, err := source.ExportAccounts(context.Background())
+	require.NoError(suite.T(), err)
+	destination := suite.StoreFactory()
+	require.NoError(suite.T(), destination.ImportAccounts(context.Background(), exported))
+	profile, err := destination.AccountProfile(context.Background(), account.ID)
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "Someone", profile.DisplayName)
+	assert.Equal(suite.T(), "I like arguments.", profile.Bio)
+	assert.JSONEq(suite.T(), `{"theme":"dark"}`, string(profile.Preferences))
+}
+
+// TestMissingAccount makes sure that profiles of accounts which don't exist can't be read or changed.
+func (suite *ProfileTests) TestMissingAccount() {
+	store := suite.StoreFactory()
+	_, err := store.AccountProfile(context.Background(), 1)
+	assert.True(suite.T(), errors.As(err, &accounts.AccountNotExistsError{}))
+	name := "Someone"
+	_, err = store.UpdateProfile(context.Background(), 1, accounts.ProfileUpdate{DisplayName: &name})
+	assert.True(suite.T(), errors.As(err, &accounts.AccountNotExistsError{}))
+}
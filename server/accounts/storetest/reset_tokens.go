@@ -0,0 +1,82 @@
+package storetest
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"github.com/wikisophia/api/server/accounts"
+)
+
+// ResetTokenTests is a testing suite which makes sure that a Store's reset tokens expire,
+// and can only be used once.
+type ResetTokenTests struct {
+	suite.Suite
+	// StoreFactory makes an empty Store whose reset tokens last for resetTokenExpiry.
+	// It may be negative, which makes tokens that have already expired.
+	StoreFactory func(resetTokenExpiry time.Duration) accounts.Store
+}
+
+// TestExpiredTokenRejected makes sure a token can't be used once it expires.
+func (suite *ResetTokenTests) TestExpiredTokenRejected() {
+	store := suite.StoreFactory(-time.Minute)
+	account, _, err := store.NewResetToken(context.Background(), "email@soph.wiki")
+	require.NoError(suite.T(), err)
+
+	err = store.SetForgottenPassword(context.Background(), account.ID, "password", account.ResetToken)
+	assert.True(suite.T(), errors.As(err, &accounts.InvalidResetTokenError{}))
+	_, err = store.Authenticate(context.Background(), "email@soph.wiki", "password")
+	assert.True(suite.T(), errors.As(err, &accounts.InvalidPasswordError{}))
+}
+
+// TestUnexpiredTokenAccepted makes sure a token can be used before it expires.
+func (suite *ResetTokenTests) TestUnexpiredTokenAccepted() {
+	store := suite.StoreFactory(time.Hour)
+	account, _, err := store.NewResetToken(context.Background(), "email@soph.wiki")
+	require.NoError(suite.T(), err)
+
+	require.NoError(suite.T(), store.SetForgottenPassword(context.Background(), account.ID, "password", account.ResetToken))
+	_, err = store.Authenticate(context.Background(), "email@soph.wiki", "password")
+	assert.NoError(suite.T(), err)
+}
+
+// TestReusedTokenRejected makes sure a used token stays invalid, even after newer ones are made.
+func (suite *ResetTokenTests) TestReusedTokenRejected() {
+	store := suite.StoreFactory(time.Hour)
+	first, _, err := store.NewResetToken(context.Background(), "email@soph.wiki")
+	require.NoError(suite.T(), err)
+	require.NoError(suite.T(), store.SetForgottenPassword(context.Background(), first.ID, "first-password", first.ResetToken))
+
+	err = store.SetForgottenPassword(context.Background(), first.ID, "second-password", first.ResetToken)
+	assert.True(suite.T(), errors.As(err, &accounts.InvalidResetTokenError{}))
+
+	second, _, err := store.NewResetToken(context.Background(), "email@soph.wiki")
+	require.NoError(suite.T(), err)
+	err = store.SetForgottenPassword(context.Background(), first.ID, "second-password", first.ResetToken)
+	assert.True(suite.T(), errors.As(err, &accounts.InvalidResetTokenError{}), "a used token shouldn't work again after a new one is made")
+	require.NoError(suite.T(), store.SetForgottenPassword(context.Background(), second.ID, "third-password", second.ResetToken))
+	err = store.SetForgottenPassword(context.Background(), second.ID, "fourth-password", second.ResetToken)
+	assert.True(suite.T(), errors.As(err, &accounts.InvalidResetTokenError{}))
+
+	_, err = store.Authenticate(context.Background(), "email@soph.wiki", "third-password")
+	assert.NoError(suite.T(), err)
+}
+
+// TestChangedPasswordRevokesToken makes sure a token from before a password change can't undo it.
+func (suite *ResetTokenTests) TestChangedPasswordRevokesToken() {
+	store := suite.StoreFactory(time.Hour)
+	first, _, err := store.NewResetToken(context.Background(), "email@soph.wiki")
+	require.NoError(suite.T(), err)
+	require.NoError(suite.T(), store.SetForgottenPassword(context.Background(), first.ID, "first-password", first.ResetToken))
+	second, _, err := store.NewResetToken(context.Background(), "email@soph.wiki")
+	require.NoError(suite.T(), err)
+
+	require.NoError(suite.T(), store.ChangePassword(context.Background(), first.ID, "first-password", "second-password", ""))
+	err = store.SetForgottenPassword(context.Background(), second.ID, "third-password", second.ResetToken)
+	assert.True(suite.T(), errors.As(err, &accounts.InvalidResetTokenError{}))
+	_, err = store.Authenticate(context.Background(), "email@soph.wiki", "second-password")
+	assert.NoError(suite.T(), err)
+}
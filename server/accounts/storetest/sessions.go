@@ -0,0 +1,133 @@
+package storetest
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"github.com/wikisophia/api/server/accounts"
+)
+
+// SessionTests is a testing suite which makes sure that a Store keeps a record of each login.
+type SessionTests struct {
+	suite.Suite
+	// StoreFactory makes an empty Store.
+	StoreFactory func() accounts.Store
+}
+
+// TestStartedSessionsListed makes sure that new sessions show up for their own account, and nobody else's.
+func (suite *SessionTests) TestStartedSessionsListed() {
+	store := suite.StoreFactory()
+	id := suite.newAccount(store, "someone@soph.wiki")
+	other := suite.newAccount(store, "other@soph.wiki")
+	now := time.Now().Truncate(time.Second)
+
+	first, err := store.StartSession(context.Background(), id, "Firefox", now)
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), id, first.AccountID)
+	assert.WithinDuration(suite.T(), now, first.IssuedAt, time.Second)
+	assert.WithinDuration(suite.T(), now, first.LastUsedAt, time.Second)
+	assert.Equal(suite.T(), "Firefox", first.Client)
+	second, err := store.StartSession(context.Background(), id, "", now.Add(time.Minute))
+	require.NoError(suite.T(), err)
+	assert.NotEqual(suite.T(), first.ID, second.ID)
+	_, err = store.StartSession(context.Background(), other, "curl", now)
+	require.NoError(suite.T(), err)
+
+	sessions, err := store.AccountSessions(context.Background(), id)
+	require.NoError(suite.T(), err)
+	require.Len(suite.T(), sessions, 2)
+	assert.Equal(suite.T(), first.ID, sessions[0].ID)
+	assert.Equal(suite.T(), "Firefox", sessions[0].Client)
+	assert.WithinDuration(suite.T(), now, sessions[0].IssuedAt, time.Second)
+	assert.Equal(suite.T(), second.ID, sessions[1].ID)
+	assert.Equal(suite.T(), "", sessions[1].Client)
+}
+
+// TestLongClientsTrimmed makes sure that nobody can fill up the store with a huge User-Agent.
+func (suite *SessionTests) TestLongClientsTrimmed() {
+	store := suite.StoreFactory()
+	id := suite.newAccount(store, "someone@soph.wiki")
+
+	session, err := store.StartSession(context.Background(), id, strings.Repeat("é", accounts.MaxSessionClientLength), time.Now())
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), accounts.TrimSessionClient(strings.Repeat("é", accounts.MaxSessionClientLength)), session.Client)
+	sessions, err := store.AccountSessions(context.Background(), id)
+	require.NoError(suite.T(), err)
+	require.Len(suite.T(), sessions, 1)
+	assert.Equal(suite.T(), session.Client, sessions[0].Client)
+}
+
+// TestUseRecordedByTheMinute makes sure that the last use is only updated once a minute,
+// and only by the account which owns the session.
+func (suite *SessionTests) TestUseRecordedByTheMinute() {
+	store := suite.StoreFactory()
+	id := suite.newAccount(store, "someone@soph.wiki")
+	other := suite.newAccount(store, "other@soph.wiki")
+	now := time.Now().Truncate(time.Second)
+	session, err := store.StartSession(context.Background(), id, "Firefox", now)
+	require.NoError(suite.T(), err)
+
+	require.NoError(suite.T(), store.SessionUsed(context.Background(), id, session.ID, now.Add(30*time.Second)))
+	suite.assertLastUsed(store, id, now)
+	require.NoError(suite.T(), store.SessionUsed(context.Background(), other, session.ID, now.Add(2*time.Minute)))
+	suite.assertLastUsed(store, id, now)
+	require.NoError(suite.T(), store.SessionUsed(context.Background(), id, session.ID, now.Add(2*time.Minute)))
+	suite.assertLastUsed(store, id, now.Add(2*time.Minute))
+	assert.NoError(suite.T(), store.SessionUsed(context.Background(), id, session.ID+100, now))
+}
+
+// TestMissingAccount makes sure that sessions can't start for accounts which don't exist.
+func (suite *SessionTests) TestMissingAccount() {
+	store := suite.StoreFactory()
+	_, err := store.StartSession(context.Background(), 1, "Firefox", time.Now())
+	assert.True(suite.T(), errors.As(err, &accounts.AccountNotExistsError{}))
+	sessions, err := store.AccountSessions(context.Background(), 1)
+	require.NoError(suite.T(), err)
+	assert.Empty(suite.T(), sessions)
+}
+
+// TestPurgedSessionsForgotten makes sure that purging an account forgets where it logged in.
+func (suite *SessionTests) TestPurgedSessionsForgotten() {
+	store := suite.StoreFactory()
+	id := suite.newAccount(store, "someone@soph.wiki")
+	kept := suite.newAccount(store, "kept@soph.wiki")
+	now := time.Now()
+	_, err := store.StartSession(context.Background(), id, "Firefox", now)
+	require.NoError(suite.T(), err)
+	_, err = store.StartSession(context.Background(), kept, "Firefox", now)
+	require.NoError(suite.T(), err)
+
+	require.NoError(suite.T(), store.ScheduleDeletion(context.Background(), id, deletionPassword, now.Add(-time.Minute)))
+	purged, err := store.PurgeAccounts(context.Background(), now)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, purged)
+	sessions, err := store.AccountSessions(context.Background(), id)
+	require.NoError(suite.T(), err)
+	assert.Empty(suite.T(), sessions)
+	_, err = store.StartSession(context.Background(), id, "Firefox", now)
+	assert.True(suite.T(), errors.As(err, &accounts.AccountNotExistsError{}))
+	sessions, err = store.AccountSessions(context.Background(), kept)
+	require.NoError(suite.T(), err)
+	assert.Len(suite.T(), sessions, 1)
+}
+
+func (suite *SessionTests) assertLastUsed(store accounts.Store, id int64, expected time.Time) {
+	suite.T().Helper()
+	sessions, err := store.AccountSessions(context.Background(), id)
+	require.NoError(suite.T(), err)
+	require.Len(suite.T(), sessions, 1)
+	assert.WithinDuration(suite.T(), expected, sessions[0].LastUsedAt, time.Second)
+}
+
+// newAccount makes an account with deletionPassword, and returns its ID.
+func (suite *SessionTests) newAccount(store accounts.Store, email string) int64 {
+	account, _, err := store.NewResetToken(context.Background(), email)
+	require.NoError(suite.T(), err)
+	require.NoError(suite.T(), store.SetForgottenPassword(context.Background(), account.ID, deletionPassword, account.ResetToken))
+	return account.ID
+}
@@ -3,6 +3,9 @@ package storetest
 import (
 	"context"
 	"errors"
+	"fmt"
+	"sync"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -162,3 +165,158 @@ func (suite *StoreTests) TestAuthenticateUnknownEmailReturnsError() {
 	require.Error(suite.T(), err)
 	require.True(suite.T(), errors.As(err, &accounts.AccountNotExistsError{}))
 }
+
+// TestLoginFailuresCounted makes sure failed logins add up, and that locks are saved.
+func (suite *StoreTests) TestLoginFailuresCounted() {
+	store := suite.StoreFactory()
+	account, _, err := store.NewResetToken(context.Background(), "email@soph.wiki")
+	require.NoError(suite.T(), err)
+
+	failures, err := store.LoginFailures(context.Background(), "email@soph.wiki")
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), accounts.LoginFailures{AccountID: account.ID}, failures)
+
+	count, err := store.RecordLoginFailure(context.Background(), account.ID)
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 1, count)
+	count, err = store.RecordLoginFailure(context.Background(), account.ID)
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 2, count)
+
+	until := time.Now().Add(time.Hour)
+	require.NoError(suite.T(), store.LockAccount(context.Background(), account.ID, until))
+	failures, err = store.LoginFailures(context.Background(), "email@soph.wiki")
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 2, failures.Count)
+	assert.WithinDuration(suite.T(), until, failures.LockedUntil, time.Second)
+	assert.False(suite.T(), failures.LockedUntil.Before(until), "stores may round the lock up, but never down")
+}
+
+// TestClearLoginFailures makes sure clearing the failures also unlocks the account.
+func (suite *StoreTests) TestClearLoginFailures() {
+	store := suite.StoreFactory()
+	account, _, err := store.NewResetToken(context.Background(), "email@soph.wiki")
+	require.NoError(suite.T(), err)
+	_, err = store.RecordLoginFailure(context.Background(), account.ID)
+	require.NoError(suite.T(), err)
+	require.NoError(suite.T(), store.LockAccount(context.Background(), account.ID, time.Now().Add(time.Hour)))
+
+	require.NoError(suite.T(), store.ClearLoginFailures(context.Background(), account.ID))
+	failures, err := store.LoginFailures(context.Background(), "email@soph.wiki")
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, failures.Count)
+	assert.True(suite.T(), failures.LockedUntil.IsZero())
+}
+
+// TestResetClearsLoginFailures makes sure people can unlock their account by resetting its password.
+func (suite *StoreTests) TestResetClearsLoginFailures() {
+	store := suite.StoreFactory()
+	account, _, err := store.NewResetToken(context.Background(), "email@soph.wiki")
+	require.NoError(suite.T(), err)
+	_, err = store.RecordLoginFailure(context.Background(), account.ID)
+	require.NoError(suite.T(), err)
+	require.NoError(suite.T(), store.LockAccount(context.Background(), account.ID, time.Now().Add(time.Hour)))
+
+	require.NoError(suite.T(), store.SetForgottenPassword(context.Background(), account.ID, "password", account.ResetToken))
+	failures, err := store.LoginFailures(context.Background(), "email@soph.wiki")
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, failures.Count)
+	assert.True(suite.T(), failures.LockedUntil.IsZero())
+}
+
+func (suite *StoreTests) TestLoginFailuresUnknownAccountReturnsError() {
+	store := suite.StoreFactory()
+	_, err := store.LoginFailures(context.Background(), "email@soph.wiki")
+	require.True(suite.T(), errors.As(err, &accounts.AccountNotExistsError{}))
+	_, err = store.RecordLoginFailure(context.Background(), 1)
+	require.True(suite.T(), errors.As(err, &accounts.AccountNotExistsError{}))
+	err = store.LockAccount(context.Background(), 1, time.Now())
+	require.True(suite.T(), errors.As(err, &accounts.AccountNotExistsError{}))
+	err = store.ClearLoginFailures(context.Background(), 1)
+	require.True(suite.T(), errors.As(err, &accounts.AccountNotExistsError{}))
+}
+
+// TestExportImportRoundtrip makes sure exported accounts can be imported into an
+// empty Store and still be logged into.
+func (suite *StoreTests) TestExportImportRoundtrip() {
+	store := suite.StoreFactory()
+	first, _, err := store.NewResetToken(context.Background(), "email1@soph.wiki")
+	require.NoError(suite.T(), err)
+	require.NoError(suite.T(), store.SetForgottenPassword(context.Background(), first.ID, "password1", first.ResetToken))
+	second, _, err := store.NewResetToken(context.Background(), "email2@soph.wiki")
+	require.NoError(suite.T(), err)
+	require.NoError(suite.T(), store.SetForgottenPassword(context.Background(), second.ID, "password2", second.ResetToken))
+
+	exported, err := store.ExportAccounts(context.Background())
+	require.NoError(suite.T(), err)
+	require.Len(suite.T(), exported, 2)
+	assert.Equal(suite.T(), first.ID, exported[0].ID)
+	assert.Equal(suite.T(), "email1@soph.wiki", exported[0].Email)
+	assert.Equal(suite.T(), second.ID, exported[1].ID)
+
+	store = suite.StoreFactory()
+	require.NoError(suite.T(), store.ImportAccounts(context.Background(), exported))
+	id, err := store.Authenticate(context.Background(), "email2@soph.wiki", "password2")
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), second.ID, id)
+
+	third, isNew, err := store.NewResetToken(context.Background(), "email3@soph.wiki")
+	require.NoError(suite.T(), err)
+	require.True(suite.T(), isNew)
+	assert.Greater(suite.T(), third.ID, second.ID)
+}
+
+// TestImportIntoNonEmptyStoreFails makes sure imports can't clobber accounts which already exist.
+func (suite *StoreTests) TestImportIntoNonEmptyStoreFails() {
+	store := suite.StoreFactory()
+	account, _, err := store.NewResetToken(context.Background(), "email@soph.wiki")
+	require.NoError(suite.T(), err)
+	err = store.ImportAccounts(context.Background(), []accounts.StoredAccount{{
+		ID:    account.ID + 1,
+		Email: "other@soph.wiki",
+	}})
+	require.Error(suite.T(), err)
+	require.True(suite.T(), errors.As(err, &accounts.StoreNotEmptyError{}))
+	_, err = store.AccountProfile(context.Background(), account.ID+1)
+	assert.True(suite.T(), errors.As(err, &accounts.AccountNotExistsError{}))
+}
+
+// TestImportDuplicateEmailsSavesNothing makes sure a bad import doesn't leave half its accounts behind.
+func (suite *StoreTests) TestImportDuplicateEmailsSavesNothing() {
+	store := suite.StoreFactory()
+	err := store.ImportAccounts(context.Background(), []accounts.StoredAccount{
+		{ID: 1, Email: "email@soph.wiki"},
+		{ID: 2, Email: "email@soph.wiki"},
+	})
+	require.Error(suite.T(), err)
+	require.True(suite.T(), errors.As(err, &accounts.EmailExistsError{}))
+	exported, err := store.ExportAccounts(context.Background())
+	require.NoError(suite.T(), err)
+	assert.Empty(suite.T(), exported)
+}
+
+// TestConcurrentSignups makes sure the Store can be used from many goroutines at once,
+// like it will be when serving requests.
+func (suite *StoreTests) TestConcurrentSignups() {
+	store := suite.StoreFactory()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			email := fmt.Sprintf("email-%d@soph.wiki", i)
+			account, _, err := store.NewResetToken(context.Background(), email)
+			if !assert.NoError(suite.T(), err) {
+				return
+			}
+			assert.NoError(suite.T(), store.SetForgottenPassword(context.Background(), account.ID, "password", account.ResetToken))
+			_, err = store.Authenticate(context.Background(), email, "password")
+			assert.NoError(suite.T(), err)
+		}(i)
+	}
+	wg.Wait()
+
+	exported, err := store.ExportAccounts(context.Background())
+	require.NoError(suite.T(), err)
+	assert.Len(suite.T(), exported, 10)
+}
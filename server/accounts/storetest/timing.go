@@ -0,0 +1,117 @@
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/accounts/email"
+	"github.com/wikisophia/api/server/accounts/lockout"
+	"github.com/wikisophia/api/server/config"
+	"github.com/wikisophia/api/server/passwords"
+)
+
+// TimingTests is a testing suite which makes sure that a Store which hashes passwords does the same
+// work in Authenticate whether or not the account exists. Otherwise, the response time would reveal
+// which emails have accounts.
+type TimingTests struct {
+	suite.Suite
+	// StoreFactory makes an empty Store which hashes passwords with hasher.
+	StoreFactory func(hasher *RecordingHasher) accounts.Store
+	// Hasher does the real hashing. It should use cheap params, to keep the suite fast.
+	Hasher *passwords.Hasher
+}
+
+// TestAuthenticatePathsMatch makes sure logins with the wrong password, to an account with no password,
+// and to an account which doesn't exist all check exactly one hash of the same cost.
+func (suite *TimingTests) TestAuthenticatePathsMatch() {
+	hasher := &RecordingHasher{Hasher: suite.Hasher}
+	store := suite.StoreFactory(hasher)
+	account, _, err := store.NewResetToken(context.Background(), "registered@soph.wiki")
+	require.NoError(suite.T(), err)
+	require.NoError(suite.T(), store.SetForgottenPassword(context.Background(), account.ID, "password", account.ResetToken))
+	_, _, err = store.NewResetToken(context.Background(), "no-password@soph.wiki")
+	require.NoError(suite.T(), err)
+	hasher.TakeChecked()
+
+	_, err = store.Authenticate(context.Background(), "registered@soph.wiki", "wrong-password")
+	require.True(suite.T(), errors.As(err, &accounts.InvalidPasswordError{}))
+	wrongPassword := hasher.TakeChecked()
+	_, err = store.Authenticate(context.Background(), "no-password@soph.wiki", "wrong-password")
+	require.True(suite.T(), errors.As(err, &accounts.InvalidPasswordError{}))
+	noPassword := hasher.TakeChecked()
+	_, err = store.Authenticate(context.Background(), "no-account@soph.wiki", "wrong-password")
+	require.True(suite.T(), errors.As(err, &accounts.AccountNotExistsError{}))
+	noAccount := hasher.TakeChecked()
+
+	require.Len(suite.T(), wrongPassword, 1)
+	assert.Equal(suite.T(), wrongPassword, noPassword, "an account with no password should check a hash like any other")
+	assert.Equal(suite.T(), wrongPassword, noAccount, "a missing account should check a hash like any other")
+}
+
+// TestLockedAuthenticateMatches makes sure that logins to a locked account check a hash like logins to one
+// which doesn't exist. Otherwise, anyone could find out which emails have accounts by locking them.
+func (suite *TimingTests) TestLockedAuthenticateMatches() {
+	hasher := &RecordingHasher{Hasher: suite.Hasher}
+	store := lockout.NewStore(suite.StoreFactory(hasher), email.ConsoleEmailer{}, config.Lockout{
+		Threshold:      1,
+		DelayMillis:    60000,
+		MaxDelayMillis: 60000,
+	}, nil)
+	account, _, err := store.NewResetToken(context.Background(), "registered@soph.wiki")
+	require.NoError(suite.T(), err)
+	require.NoError(suite.T(), store.SetForgottenPassword(context.Background(), account.ID, "password", account.ResetToken))
+	_, err = store.Authenticate(context.Background(), "registered@soph.wiki", "wrong-password")
+	require.True(suite.T(), errors.As(err, &accounts.AccountLockedError{}))
+	hasher.TakeChecked()
+
+	_, err = store.Authenticate(context.Background(), "registered@soph.wiki", "password")
+	require.True(suite.T(), errors.As(err, &accounts.AccountLockedError{}))
+	locked := hasher.TakeChecked()
+	_, err = store.Authenticate(context.Background(), "no-account@soph.wiki", "password")
+	require.True(suite.T(), errors.As(err, &accounts.AccountNotExistsError{}))
+	noAccount := hasher.TakeChecked()
+
+	require.Len(suite.T(), noAccount, 1)
+	assert.Equal(suite.T(), noAccount, locked, "a locked account should check a hash like a missing one")
+}
+
+// RecordingHasher wraps a passwords.Hasher, and records the cost of each hash that a password gets checked against.
+type RecordingHasher struct {
+	*passwords.Hasher
+	mutex   sync.Mutex
+	checked []string
+}
+
+// Matches records the hash's cost and then checks it, like passwords.Hasher.Matches.
+func (h *RecordingHasher) Matches(ctx context.Context, value string, hash string) (bool, error) {
+	h.mutex.Lock()
+	h.checked = append(h.checked, hashCost(hash))
+	h.mutex.Unlock()
+	return h.Hasher.Matches(ctx, value, hash)
+}
+
+// TakeChecked returns the cost of each hash checked since the last call, in order.
+func (h *RecordingHasher) TakeChecked() []string {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	checked := h.checked
+	h.checked = nil
+	return checked
+}
+
+// hashCost strips the salt and key out of an encoded hash, leaving the parts which decide how long it takes to check.
+// "$argon2id$v=19$m=1024,t=1,p=1$salt$key" becomes "$argon2id$v=19$m=1024,t=1,p=1 keylen=3".
+func hashCost(hash string) string {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return "malformed"
+	}
+	return fmt.Sprintf("%s keylen=%d", strings.Join(parts[:4], "$"), len(parts[5]))
+}
@@ -0,0 +1,314 @@
+package storetest
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/accounts/totp"
+)
+
+// TwoFactorTests is a testing suite which makes sure that a Store handles two-factor auth properly.
+type TwoFactorTests struct {
+	suite.Suite
+	// StoreFactory makes an empty Store.
+	StoreFactory func() accounts.Store
+}
+
+const twoFactorPassword = "some-long-password-for-tests"
+
+// TestEnrollAndConfirm makes sure that two-factor auth only turns on once the secret is confirmed.
+func (suite *TwoFactorTests) TestEnrollAndConfirm() {
+	store := suite.StoreFactory()
+	id := suite.newAccount(store, "someone@soph.wiki")
+
+	_, err := store.EnrollTwoFactor(context.Background(), id, "wrong-password")
+	assert.True(suite.T(), errors.As(err, &accounts.InvalidPasswordError{}))
+	enrollment, err := store.EnrollTwoFactor(context.Background(), id, twoFactorPassword)
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), id, enrollment.ID)
+	assert.Equal(suite.T(), "someone@soph.wiki", enrollment.Email)
+	assert.NotEmpty(suite.T(), enrollment.Secret)
+	status, err := store.TwoFactorStatus(context.Background(), id)
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), accounts.TwoFactorStatus{}, status)
+	err = store.CheckTwoFactor(context.Background(), id, suite.code(enrollment.Secret, 0))
+	assert.True(suite.T(), errors.As(err, &accounts.TwoFactorNotEnrolledError{}), "unconfirmed secrets shouldn't be used")
+
+	_, err = store.ConfirmTwoFactor(context.Background(), id, "000000")
+	assert.True(suite.T(), errors.As(err, &accounts.InvalidTwoFactorCodeError{}))
+	codes, err := store.ConfirmTwoFactor(context.Background(), id, suite.code(enrollment.Secret, 0))
+	require.NoError(suite.T(), err)
+	assert.Len(suite.T(), codes, totp.RecoveryCodeCount)
+	status, err = store.TwoFactorStatus(context.Background(), id)
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), accounts.TwoFactorStatus{Enabled: true, RecoveryCodesLeft: totp.RecoveryCodeCount}, status)
+
+	_, err = store.EnrollTwoFactor(context.Background(), id, twoFactorPassword)
+	assert.True(suite.T(), errors.As(err, &accounts.TwoFactorEnabledError{}))
+	_, err = store.ConfirmTwoFactor(context.Background(), id, suite.code(enrollment.Secret, 1))
+	assert.True(suite.T(), errors.As(err, &accounts.TwoFactorEnabledError{}))
+}
+
+// TestConfirmNeedsEnrollment makes sure that two-factor auth can't be confirmed or used before it's set up.
+func (suite *TwoFactorTests) TestConfirmNeedsEnrollment() {
+	store := suite.StoreFactory()
+	id := suite.newAccount(store, "someone@soph.wiki")
+	_, err := store.ConfirmTwoFactor(context.Background(), id, "123456")
+	assert.True(suite.T(), errors.As(err, &accounts.TwoFactorNotEnrolledError{}))
+	err = store.CheckTwoFactor(context.Background(), id, "123456")
+	assert.True(suite.T(), errors.As(err, &accounts.TwoFactorNotEnrolledError{}))
+	err = store.DisableTwoFactor(context.Background(), id, twoFactorPassword, "123456")
+	assert.True(suite.T(), errors.As(err, &accounts.TwoFactorNotEnrolledError{}))
+}
+
+// TestEnrollingAgainReplacesSecret makes sure that only the newest unconfirmed secret works.
+func (suite *TwoFactorTests) TestEnrollingAgainReplacesSecret() {
+	store := suite.StoreFactory()
+	id := suite.newAccount(store, "someone@soph.wiki")
+	first, err := store.EnrollTwoFactor(context.Background(), id, twoFactorPassword)
+	require.NoError(suite.T(), err)
+	second, err := store.EnrollTwoFactor(context.Background(), id, twoFactorPassword)
+	require.NoError(suite.T(), err)
+	assert.NotEqual(suite.T(), first.Secret, second.Secret)
+
+	_, err = store.ConfirmTwoFactor(context.Background(), id, suite.code(first.Secret, 0))
+	assert.True(suite.T(), errors.As(err, &accounts.InvalidTwoFactorCodeError{}))
+	_, err = store.ConfirmTwoFactor(context.Background(), id, suite.code(second.Secret, 0))
+	assert.NoError(suite.T(), err)
+}
+
+// TestCodesOnlyWorkOnce makes sure that TOTP codes can't be replayed.
+func (suite *TwoFactorTests) TestCodesOnlyWorkOnce() {
+	store := suite.StoreFactory()
+	id, secret, _ := suite.newTwoFactorAccount(store, "someone@soph.wiki")
+
+	err := store.CheckTwoFactor(context.Background(), id, suite.code(secret, 0))
+	assert.True(suite.T(), errors.As(err, &accounts.InvalidTwoFactorCodeError{}), "the confirmation code shouldn't work again")
+	require.NoError(suite.T(), store.CheckTwoFactor(context.Background(), id, suite.code(secret, 1)))
+	err = store.CheckTwoFactor(context.Background(), id, suite.code(secret, 1))
+	assert.True(suite.T(), errors.As(err, &accounts.InvalidTwoFactorCodeError{}))
+	err = store.CheckTwoFactor(context.Background(), id, "not-a-code")
+	assert.True(suite.T(), errors.As(err, &accounts.InvalidTwoFactorCodeError{}))
+}
+
+// TestRecoveryCodesAreUsedUp makes sure that each recovery code works once, however it's typed.
+func (suite *TwoFactorTests) TestRecoveryCodesAreUsedUp() {
+	store := suite.StoreFactory()
+	id, _, codes := suite.newTwoFactorAccount(store, "someone@soph.wiki")
+
+	typed := strings.ToUpper(strings.ReplaceAll(codes[3], "-", " "))
+	require.NoError(suite.T(), store.CheckTwoFactor(context.Background(), id, typed))
+	err := store.CheckTwoFactor(context.Background(), id, codes[3])
+	assert.True(suite.T(), errors.As(err, &accounts.InvalidTwoFactorCodeError{}))
+	require.NoError(suite.T(), store.CheckTwoFactor(context.Background(), id, codes[0]))
+	status, err := store.TwoFactorStatus(context.Background(), id)
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), totp.RecoveryCodeCount-2, status.RecoveryCodesLeft)
+}
+
+// TestDisable makes sure that two-factor auth can be turned off with the password and a code.
+func (suite *TwoFactorTests) TestDisable() {
+	store := suite.StoreFactory()
+	id, secret, codes := suite.newTwoFactorAccount(store, "someone@soph.wiki")
+
+	err := store.DisableTwoFactor(context.Background(), id, "wrong-password", codes[0])
+	assert.True(suite.T(), errors.As(err, &accounts.InvalidPasswordError{}))
+	err = store.DisableTwoFactor(context.Background(), id, twoFactorPassword, "000000")
+	assert.True(suite.T(), errors.As(err, &accounts.InvalidTwoFactorCodeError{}))
+	require.NoError(suite.T(), store.DisableTwoFactor(context.Background(), id, twoFactorPassword, suite.code(secret, 1)))
+
+	status, err := store.TwoFactorStatus(context.Background(), id)
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), accounts.TwoFactorStatus{}, status)
+	err = store.CheckTwoFactor(context.Background(), id, codes[0])
+	assert.True(suite.T(), errors.As(err, &accounts.TwoFactorNotEnrolledError{}))
+	_, err = store.EnrollTwoFactor(context.Background(), id, twoFactorPassword)
+	assert.NoError(suite.T(), err)
+}
+
+// TestChangePasswordNeedsCode makes sure that accounts with two-factor auth need a code to change their password.
+func (suite *TwoFactorTests) TestChangePasswordNeedsCode() {
+	store := suite.StoreFactory()
+	id, _, codes := suite.newTwoFactorAccount(store, "someone@soph.wiki")
+
+	err := store.ChangePassword(context.Background(), id, twoFactorPassword, "some-new-long-password", "")
+	assert.True(suite.T(), errors.As(err, &accounts.TwoFactorCodeMissingError{}))
+	err = store.ChangePassword(context.Background(), id, "wrong-password", "some-new-long-password", "")
+	assert.True(suite.T(), errors.As(err, &accounts.InvalidPasswordError{}), "the password should be checked before the code")
+	err = store.ChangePassword(context.Background(), id, twoFactorPassword, "some-new-long-password", "000000")
+	assert.True(suite.T(), errors.As(err, &accounts.InvalidTwoFactorCodeError{}))
+	_, err = store.Authenticate(context.Background(), "someone@soph.wiki", twoFactorPassword)
+	require.NoError(suite.T(), err, "the password shouldn't change without the right code")
+
+	require.NoError(suite.T(), store.ChangePassword(context.Background(), id, twoFactorPassword, "some-new-long-password", codes[0]))
+	_, err = store.Authenticate(context.Background(), "someone@soph.wiki", "some-new-long-password")
+	require.NoError(suite.T(), err)
+	err = store.CheckTwoFactor(context.Background(), id, codes[0])
+	assert.True(suite.T(), errors.As(err, &accounts.InvalidTwoFactorCodeError{}), "the recovery code should be used up")
+}
+
+// TestEmailChangeNeedsCode makes sure that accounts with two-factor auth need a code to move to a new email.
+func (suite *TwoFactorTests) TestEmailChangeNeedsCode() {
+	store := suite.StoreFactory()
+	id, secret, _ := suite.newTwoFactorAccount(store, "someone@soph.wiki")
+
+	_, err := store.RequestEmailChange(context.Background(), id, twoFactorPassword, "new@soph.wiki", "")
+	assert.True(suite.T(), errors.As(err, &accounts.TwoFactorCodeMissingError{}))
+	_, err = store.RequestEmailChange(context.Background(), id, twoFactorPassword, "new@soph.wiki", "000000")
+	assert.True(suite.T(), errors.As(err, &accounts.InvalidTwoFactorCodeError{}))
+	account, err := store.RequestEmailChange(context.Background(), id, twoFactorPassword, "new@soph.wiki", suite.code(secret, 1))
+	require.NoError(suite.T(), err)
+	require.NoError(suite.T(), store.ConfirmEmailChange(context.Background(), id, account.EmailChangeToken))
+}
+
+// TestRequired makes sure that accounts which must have two-factor auth can't turn it off.
+func (suite *TwoFactorTests) TestRequired() {
+	store := suite.StoreFactory()
+	id := suite.newAccount(store, "moderator@soph.wiki")
+	require.NoError(suite.T(), store.RequireTwoFactor(context.Background(), id, true))
+	status, err := store.TwoFactorStatus(context.Background(), id)
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), accounts.TwoFactorStatus{Required: true}, status)
+
+	secret, codes := suite.enableTwoFactor(store, id)
+	err = store.DisableTwoFactor(context.Background(), id, twoFactorPassword, codes[0])
+	assert.True(suite.T(), errors.As(err, &accounts.TwoFactorRequiredError{}))
+	require.NoError(suite.T(), store.CheckTwoFactor(context.Background(), id, codes[0]), "the code shouldn't be used up")
+
+	require.NoError(suite.T(), store.RequireTwoFactor(context.Background(), id, false))
+	assert.NoError(suite.T(), store.DisableTwoFactor(context.Background(), id, twoFactorPassword, suite.code(secret, 1)))
+}
+
+// TestModeratorsNeedTwoFactor makes sure that moderators must have two-factor auth for as long as they have the role.
+func (suite *TwoFactorTests) TestModeratorsNeedTwoFactor() {
+	store := suite.StoreFactory()
+	id := suite.newAccount(store, "moderator@soph.wiki")
+	moderator, err := store.IsModerator(context.Background(), id)
+	require.NoError(suite.T(), err)
+	assert.False(suite.T(), moderator)
+
+	require.NoError(suite.T(), store.SetModerator(context.Background(), id, true))
+	moderator, err = store.IsModerator(context.Background(), id)
+	require.NoError(suite.T(), err)
+	assert.True(suite.T(), moderator)
+	status, err := store.TwoFactorStatus(context.Background(), id)
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), accounts.TwoFactorStatus{Required: true}, status)
+	err = store.RequireTwoFactor(context.Background(), id, false)
+	assert.True(suite.T(), errors.As(err, &accounts.TwoFactorRequiredError{}))
+	require.NoError(suite.T(), store.RequireTwoFactor(context.Background(), id, true))
+
+	require.NoError(suite.T(), store.SetModerator(context.Background(), id, false))
+	status, err = store.TwoFactorStatus(context.Background(), id)
+	require.NoError(suite.T(), err)
+	assert.True(suite.T(), status.Required, "taking the role away shouldn't change the requirement")
+	require.NoError(suite.T(), store.RequireTwoFactor(context.Background(), id, false))
+}
+
+// TestMissingAccount makes sure that two-factor auth on accounts which don't exist fails.
+func (suite *TwoFactorTests) TestMissingAccount() {
+	store := suite.StoreFactory()
+	_, err := store.EnrollTwoFactor(context.Background(), 1, twoFactorPassword)
+	assert.True(suite.T(), errors.As(err, &accounts.AccountNotExistsError{}))
+	_, err = store.ConfirmTwoFactor(context.Background(), 1, "123456")
+	assert.True(suite.T(), errors.As(err, &accounts.AccountNotExistsError{}))
+	err = store.CheckTwoFactor(context.Background(), 1, "123456")
+	assert.True(suite.T(), errors.As(err, &accounts.AccountNotExistsError{}))
+	err = store.DisableTwoFactor(context.Background(), 1, twoFactorPassword, "123456")
+	assert.True(suite.T(), errors.As(err, &accounts.AccountNotExistsError{}))
+	_, err = store.TwoFactorStatus(context.Background(), 1)
+	assert.True(suite.T(), errors.As(err, &accounts.AccountNotExistsError{}))
+	err = store.RequireTwoFactor(context.Background(), 1, true)
+	assert.True(suite.T(), errors.As(err, &accounts.AccountNotExistsError{}))
+	err = store.RequireTwoFactor(context.Background(), 1, false)
+	assert.True(suite.T(), errors.As(err, &accounts.AccountNotExistsError{}))
+	err = store.SetModerator(context.Background(), 1, true)
+	assert.True(suite.T(), errors.As(err, &accounts.AccountNotExistsError{}))
+	_, err = store.IsModerator(context.Background(), 1)
+	assert.True(suite.T(), errors.As(err, &accounts.AccountNotExistsError{}))
+}
+
+// TestPurgeForgetsTwoFactor makes sure that purged accounts don't keep their secrets or recovery codes.
+func (suite *TwoFactorTests) TestPurgeForgetsTwoFactor() {
+	store := suite.StoreFactory()
+	id, _, codes := suite.newTwoFactorAccount(store, "someone@soph.wiki")
+	require.NoError(suite.T(), store.SetModerator(context.Background(), id, true))
+	require.NoError(suite.T(), store.ScheduleDeletion(context.Background(), id, twoFactorPassword, time.Now().Add(-time.Minute)))
+	_, err := store.PurgeAccounts(context.Background(), time.Now())
+	require.NoError(suite.T(), err)
+
+	err = store.CheckTwoFactor(context.Background(), id, codes[0])
+	assert.True(suite.T(), errors.As(err, &accounts.AccountNotExistsError{}))
+	_, err = store.TwoFactorStatus(context.Background(), id)
+	assert.True(suite.T(), errors.As(err, &accounts.AccountNotExistsError{}))
+	exported, err := store.ExportAccounts(context.Background())
+	require.NoError(suite.T(), err)
+	require.Len(suite.T(), exported, 1)
+	assert.Empty(suite.T(), exported[0].TwoFactorSecret)
+	assert.Empty(suite.T(), exported[0].RecoveryCodeHashes)
+	assert.False(suite.T(), exported[0].TwoFactorRequired)
+	assert.False(suite.T(), exported[0].Moderator)
+}
+
+// TestTwoFactorExported makes sure that two-factor auth survives an export and import.
+func (suite *TwoFactorTests) TestTwoFactorExported() {
+	source := suite.StoreFactory()
+	id, secret, codes := suite.newTwoFactorAccount(source, "someone@soph.wiki")
+	require.NoError(suite.T(), source.SetModerator(context.Background(), id, true))
+	require.NoError(suite.T(), source.CheckTwoFactor(context.Background(), id, codes[0]))
+
+	exported, err := source.ExportAccounts(context.Background())
+	require.NoError(suite.T(), err)
+	destination := suite.StoreFactory()
+	require.NoError(suite.T(), destination.ImportAccounts(context.Background(), exported))
+	status, err := destination.TwoFactorStatus(context.Background(), id)
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), accounts.TwoFactorStatus{Enabled: true, Required: true, RecoveryCodesLeft: totp.RecoveryCodeCount - 1}, status)
+	moderator, err := destination.IsModerator(context.Background(), id)
+	require.NoError(suite.T(), err)
+	assert.True(suite.T(), moderator)
+	err = destination.CheckTwoFactor(context.Background(), id, suite.code(secret, 0))
+	assert.True(suite.T(), errors.As(err, &accounts.InvalidTwoFactorCodeError{}), "used codes should stay used")
+	err = destination.CheckTwoFactor(context.Background(), id, codes[0])
+	assert.True(suite.T(), errors.As(err, &accounts.InvalidTwoFactorCodeError{}), "used recovery codes should stay used")
+	assert.NoError(suite.T(), destination.CheckTwoFactor(context.Background(), id, codes[1]))
+}
+
+// newAccount makes an account with twoFactorPassword, and returns its ID.
+func (suite *TwoFactorTests) newAccount(store accounts.Store, email string) int64 {
+	account, _, err := store.NewResetToken(context.Background(), email)
+	require.NoError(suite.T(), err)
+	require.NoError(suite.T(), store.SetForgottenPassword(context.Background(), account.ID, twoFactorPassword, account.ResetToken))
+	return account.ID
+}
+
+// newTwoFactorAccount makes an account with two-factor auth on, and returns its ID, TOTP secret and recovery codes.
+// The code for the current period has been used already.
+func (suite *TwoFactorTests) newTwoFactorAccount(store accounts.Store, email string) (int64, string, []string) {
+	id := suite.newAccount(store, email)
+	secret, codes := suite.enableTwoFactor(store, id)
+	return id, secret, codes
+}
+
+// enableTwoFactor turns on two-factor auth with the code for the current period,
+// and returns the TOTP secret and recovery codes.
+func (suite *TwoFactorTests) enableTwoFactor(store accounts.Store, id int64) (string, []string) {
+	enrollment, err := store.EnrollTwoFactor(context.Background(), id, twoFactorPassword)
+	require.NoError(suite.T(), err)
+	codes, err := store.ConfirmTwoFactor(context.Background(), id, suite.code(enrollment.Secret, 0))
+	require.NoError(suite.T(), err)
+	return enrollment.Secret, codes
+}
+
+// code returns the secret's TOTP code for the given number of periods from now.
+func (suite *TwoFactorTests) code(secret string, periods int) string {
+	code, err := totp.Code(secret, time.Now().Add(time.Duration(periods)*totp.Period))
+	require.NoError(suite.T(), err)
+	return code
+}
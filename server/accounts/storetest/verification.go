@@ -0,0 +1,154 @@
+package storetest
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/accounts/tokens"
+)
+
+// VerificationTests is a testing suite which makes sure that a Store tracks verified emails,
+// and that its verification tokens expire and can only be used once.
+type VerificationTests struct {
+	suite.Suite
+	// StoreFactory makes an empty Store whose tokens last as long as expiry says.
+	// The durations may be negative, which makes tokens that have already expired.
+	StoreFactory func(expiry tokens.Expiry) accounts.Store
+}
+
+// TestVerifyFlow makes sure a new account is unverified until it uses its verification token.
+func (suite *VerificationTests) TestVerifyFlow() {
+	store := suite.StoreFactory(tokens.Expiry{Reset: time.Hour, Verification: time.Hour})
+	created, _, err := store.NewResetToken(context.Background(), "email@soph.wiki")
+	require.NoError(suite.T(), err)
+	verifiedAt, err := store.EmailVerifiedAt(context.Background(), created.ID)
+	require.NoError(suite.T(), err)
+	assert.True(suite.T(), verifiedAt.IsZero())
+
+	account, err := store.NewVerificationToken(context.Background(), "email@soph.wiki")
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), created.ID, account.ID)
+	assert.NotEmpty(suite.T(), account.VerificationToken)
+	before := time.Now().Add(-time.Second)
+	require.NoError(suite.T(), store.VerifyEmail(context.Background(), account.ID, account.VerificationToken))
+
+	verifiedAt, err = store.EmailVerifiedAt(context.Background(), account.ID)
+	require.NoError(suite.T(), err)
+	assert.False(suite.T(), verifiedAt.Before(before))
+}
+
+// TestTokenSingleUse makes sure a verification token can't be used twice.
+func (suite *VerificationTests) TestTokenSingleUse() {
+	store := suite.StoreFactory(tokens.Expiry{Reset: time.Hour, Verification: time.Hour})
+	_, _, err := store.NewResetToken(context.Background(), "email@soph.wiki")
+	require.NoError(suite.T(), err)
+	account, err := store.NewVerificationToken(context.Background(), "email@soph.wiki")
+	require.NoError(suite.T(), err)
+	require.NoError(suite.T(), store.VerifyEmail(context.Background(), account.ID, account.VerificationToken))
+
+	err = store.VerifyEmail(context.Background(), account.ID, account.VerificationToken)
+	assert.True(suite.T(), errors.As(err, &accounts.InvalidVerificationTokenError{}))
+}
+
+// TestExpiredTokenRejected makes sure a verification token can't be used once it expires.
+func (suite *VerificationTests) TestExpiredTokenRejected() {
+	store := suite.StoreFactory(tokens.Expiry{Reset: time.Hour, Verification: -time.Minute})
+	_, _, err := store.NewResetToken(context.Background(), "email@soph.wiki")
+	require.NoError(suite.T(), err)
+	account, err := store.NewVerificationToken(context.Background(), "email@soph.wiki")
+	require.NoError(suite.T(), err)
+
+	err = store.VerifyEmail(context.Background(), account.ID, account.VerificationToken)
+	assert.True(suite.T(), errors.As(err, &accounts.InvalidVerificationTokenError{}))
+	verifiedAt, err := store.EmailVerifiedAt(context.Background(), account.ID)
+	require.NoError(suite.T(), err)
+	assert.True(suite.T(), verifiedAt.IsZero())
+}
+
+// TestNewTokenReplacesOld makes sure only the latest verification token works.
+func (suite *VerificationTests) TestNewTokenReplacesOld() {
+	store := suite.StoreFactory(tokens.Expiry{Reset: time.Hour, Verification: time.Hour})
+	_, _, err := store.NewResetToken(context.Background(), "email@soph.wiki")
+	require.NoError(suite.T(), err)
+	first, err := store.NewVerificationToken(context.Background(), "email@soph.wiki")
+	require.NoError(suite.T(), err)
+	second, err := store.NewVerificationToken(context.Background(), "email@soph.wiki")
+	require.NoError(suite.T(), err)
+
+	err = store.VerifyEmail(context.Background(), first.ID, first.VerificationToken)
+	assert.True(suite.T(), errors.As(err, &accounts.InvalidVerificationTokenError{}))
+	assert.NoError(suite.T(), store.VerifyEmail(context.Background(), second.ID, second.VerificationToken))
+}
+
+// TestResetTokensDontVerify makes sure the two kinds of tokens can't be swapped.
+func (suite *VerificationTests) TestResetTokensDontVerify() {
+	store := suite.StoreFactory(tokens.Expiry{Reset: time.Hour, Verification: time.Hour})
+	account, _, err := store.NewResetToken(context.Background(), "email@soph.wiki")
+	require.NoError(suite.T(), err)
+	err = store.VerifyEmail(context.Background(), account.ID, account.ResetToken)
+	assert.True(suite.T(), errors.As(err, &accounts.InvalidVerificationTokenError{}))
+
+	verification, err := store.NewVerificationToken(context.Background(), "email@soph.wiki")
+	require.NoError(suite.T(), err)
+	err = store.SetForgottenPassword(context.Background(), account.ID, "password", verification.VerificationToken)
+	assert.True(suite.T(), errors.As(err, &accounts.InvalidResetTokenError{}))
+}
+
+// TestAlreadyVerifiedRejected makes sure verified emails don't get new tokens.
+func (suite *VerificationTests) TestAlreadyVerifiedRejected() {
+	store := suite.StoreFactory(tokens.Expiry{Reset: time.Hour, Verification: time.Hour})
+	_, _, err := store.NewResetToken(context.Background(), "email@soph.wiki")
+	require.NoError(suite.T(), err)
+	account, err := store.NewVerificationToken(context.Background(), "email@soph.wiki")
+	require.NoError(suite.T(), err)
+	require.NoError(suite.T(), store.VerifyEmail(context.Background(), account.ID, account.VerificationToken))
+
+	_, err = store.NewVerificationToken(context.Background(), "email@soph.wiki")
+	assert.True(suite.T(), errors.As(err, &accounts.EmailAlreadyVerifiedError{}))
+}
+
+// TestUnknownAccountsRejected makes sure the EmailVerifier functions return
+// AccountNotExistsErrors for accounts which don't exist.
+func (suite *VerificationTests) TestUnknownAccountsRejected() {
+	store := suite.StoreFactory(tokens.Expiry{Reset: time.Hour, Verification: time.Hour})
+	_, err := store.NewVerificationToken(context.Background(), "email@soph.wiki")
+	assert.True(suite.T(), errors.As(err, &accounts.AccountNotExistsError{}))
+	err = store.VerifyEmail(context.Background(), 1, "token")
+	assert.True(suite.T(), errors.As(err, &accounts.AccountNotExistsError{}))
+	_, err = store.EmailVerifiedAt(context.Background(), 1)
+	assert.True(suite.T(), errors.As(err, &accounts.AccountNotExistsError{}))
+}
+
+// TestVerificationExported makes sure the verification time survives an export and import.
+func (suite *VerificationTests) TestVerificationExported() {
+	source := suite.StoreFactory(tokens.Expiry{Reset: time.Hour, Verification: time.Hour})
+	_, _, err := source.NewResetToken(context.Background(), "verified@soph.wiki")
+	require.NoError(suite.T(), err)
+	_, _, err = source.NewResetToken(context.Background(), "unverified@soph.wiki")
+	require.NoError(suite.T(), err)
+	account, err := source.NewVerificationToken(context.Background(), "verified@soph.wiki")
+	require.NoError(suite.T(), err)
+	require.NoError(suite.T(), source.VerifyEmail(context.Background(), account.ID, account.VerificationToken))
+	verifiedAt, err := source.EmailVerifiedAt(context.Background(), account.ID)
+	require.NoError(suite.T(), err)
+
+	exported, err := source.ExportAccounts(context.Background())
+	require.NoError(suite.T(), err)
+	require.Len(suite.T(), exported, 2)
+	require.NotNil(suite.T(), exported[0].EmailVerifiedAt)
+	assert.Nil(suite.T(), exported[1].EmailVerifiedAt)
+
+	destination := suite.StoreFactory(tokens.Expiry{Reset: time.Hour, Verification: time.Hour})
+	require.NoError(suite.T(), destination.ImportAccounts(context.Background(), exported))
+	imported, err := destination.EmailVerifiedAt(context.Background(), account.ID)
+	require.NoError(suite.T(), err)
+	assert.WithinDuration(suite.T(), verifiedAt, imported, time.Second)
+	unverified, err := destination.EmailVerifiedAt(context.Background(), exported[1].ID)
+	require.NoError(suite.T(), err)
+	assert.True(suite.T(), unverified.IsZero())
+}
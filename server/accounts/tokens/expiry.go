@@ -0,0 +1,9 @@
+package tokens
+
+import "time"
+
+// Expiry says how long each kind of token can be used for.
+type Expiry struct {
+	Reset        time.Duration
+	Verification time.Duration
+}
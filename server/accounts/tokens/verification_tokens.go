@@ -2,13 +2,12 @@ package tokens
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/base64"
-	"time"
+	"encoding/hex"
 )
 
-// ResetTokenExpiry determines how long a reset token should be valid for
-const ResetTokenExpiry = 48 * time.Hour
-
 // Make a new URL-friendly verification token.
 func NewVerificationToken(length int) (string, error) {
 	requiredLength := base64.URLEncoding.DecodedLen(length)
@@ -18,3 +17,15 @@ func NewVerificationToken(length int) (string, error) {
 	}
 	return base64.URLEncoding.EncodeToString(tmp), nil
 }
+
+// Hash returns what the stores save instead of a token, so that a leaked database can't be used to
+// reset anyone's password. The tokens are long and random, so a fast hash is as good as a slow one.
+func Hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Matches returns true if the token has the hash. It takes the same time no matter how much of the hash matches.
+func Matches(token string, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(Hash(token)), []byte(hash)) == 1
+}
@@ -0,0 +1,123 @@
+package totp
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// RecoveryCodeCount is how many recovery codes an account gets when it turns on two-factor auth.
+const RecoveryCodeCount = 10
+
+// recoveryAlphabet leaves out characters which are easy to mix up, like 0 and o.
+const recoveryAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// recoveryCodeLength is the number of characters in each code, not counting the dash.
+const recoveryCodeLength = 10
+
+// NewRecoveryCodes makes codes which can each be used once in place of a TOTP code.
+// They look like "abcde-fghjk".
+func NewRecoveryCodes() ([]string, error) {
+	codes := make([]string, RecoveryCodeCount)
+	random := make([]byte, recoveryCodeLength)
+	for i := range codes {
+		if _, err := rand.Read(random); err != nil {
+			return nil, err
+		}
+		var code strings.Builder
+		for j, b := range random {
+			if j == recoveryCodeLength/2 {
+				code.WriteByte('-')
+			}
+			// 256 isn't a multiple of the alphabet's length, so this is very slightly biased.
+			// The codes are long enough that it doesn't matter.
+			code.WriteByte(recoveryAlphabet[int(b)%len(recoveryAlphabet)])
+		}
+		codes[i] = code.String()
+	}
+	return codes, nil
+}
+
+// NormalizeRecoveryCode puts a code the way people typed it into the form NewRecoveryCodes made it in.
+// It returns false if the code can't be a recovery code, so callers can skip the slow hash checks.
+func NormalizeRecoveryCode(code string) (string, bool) {
+	var normalized strings.Builder
+	for _, char := range strings.ToLower(code) {
+		if char == '-' || char == ' ' {
+			continue
+		}
+		if !strings.ContainsRune(recoveryAlphabet, char) {
+			return "", false
+		}
+		normalized.WriteRune(char)
+	}
+	if normalized.Len() != recoveryCodeLength {
+		return "", false
+	}
+	flat := normalized.String()
+	return flat[:recoveryCodeLength/2] + "-" + flat[recoveryCodeLength/2:], true
+}
+
+// Hasher hashes values, and checks them against hashes. It's implemented by *passwords.Hasher.
+type Hasher interface {
+	Hash(ctx context.Context, value string) (string, error)
+	Matches(ctx context.Context, value string, hash string) (bool, error)
+}
+
+// lookupTagLength is how many hex characters of the code's SHA-256 go in front of its hash.
+//
+// The tag lets MatchRecoveryCode skip the hashes which can't match, so that checking a code costs one slow hash
+// rather than one for each code the account has left. It's short on purpose. 16 bits are plenty to tell ten codes
+// apart, but only take a little off of the 49 bits which someone with a copy of the database would have to guess.
+const lookupTagLength = 4
+
+// HashRecoveryCode hashes a code from NewRecoveryCodes like a password, with a lookup tag in front.
+func HashRecoveryCode(ctx context.Context, hasher Hasher, code string) (string, error) {
+	normalized, ok := NormalizeRecoveryCode(code)
+	if !ok {
+		return "", errors.New("failed to hash recovery code: it isn't one")
+	}
+	hash, err := hasher.Hash(ctx, normalized)
+	if err != nil {
+		return "", err
+	}
+	return lookupTag(normalized) + ":" + hash, nil
+}
+
+// MatchRecoveryCode returns whichever of the hashes was made from the code, or "" if none were.
+// Recovery codes are hashed like passwords, so this is slow. It returns early if the code can't be a recovery code,
+// and only checks the hashes whose lookup tag matches the code's.
+func MatchRecoveryCode(ctx context.Context, hasher Hasher, code string, hashes []string) (string, error) {
+	normalized, ok := NormalizeRecoveryCode(code)
+	if !ok {
+		return "", nil
+	}
+	tag := lookupTag(normalized)
+	for _, stored := range hashes {
+		hash := stored
+		// Hashes made before the tags were added have to be checked one by one.
+		if len(stored) > lookupTagLength && stored[lookupTagLength] == ':' {
+			if stored[:lookupTagLength] != tag {
+				continue
+			}
+			hash = stored[lookupTagLength+1:]
+		}
+		matches, err := hasher.Matches(ctx, normalized, hash)
+		if err != nil {
+			return "", err
+		}
+		if matches {
+			return stored, nil
+		}
+	}
+	return "", nil
+}
+
+// lookupTag returns the tag which goes in front of the hash of a normalized code.
+func lookupTag(normalized string) string {
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])[:lookupTagLength]
+}
@@ -0,0 +1,103 @@
+// Package totp makes and checks the time-based one-time passwords from RFC 6238,
+// which authenticator apps show for two-factor logins.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Digits is how long each code is.
+const Digits = 6
+
+// Period is how long each code lasts.
+const Period = 30 * time.Second
+
+// secretSize is the number of random bytes in each secret. RFC 4226 recommends 160 bits.
+const secretSize = 20
+
+// skew is how many periods a code may be off by, so that clocks which drift a little still work.
+const skew = 1
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewSecret makes a random secret, encoded in base32 like authenticator apps expect.
+func NewSecret() (string, error) {
+	secret := make([]byte, secretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return encoding.EncodeToString(secret), nil
+}
+
+// URI returns the otpauth:// URI for the secret, which authenticator apps can read from a QR code.
+// The issuer and account name are what the app shows next to the codes.
+func URI(secret, issuer, accountName string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(Digits))
+	query.Set("period", fmt.Sprint(int(Period.Seconds())))
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(accountName)
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// Step returns the number of periods since the unix epoch at t. Each step has its own code.
+func Step(t time.Time) int64 {
+	return t.Unix() / int64(Period.Seconds())
+}
+
+// Code returns the secret's code at t.
+func Code(secret string, t time.Time) (string, error) {
+	return codeAt(secret, Step(t))
+}
+
+// Validate checks whether code is the secret's code at t, or within a period of it.
+// Codes from steps up to lastStep are rejected, so that each code only works once.
+//
+// If the code is valid, it returns its step. The caller should save that as the next lastStep.
+func Validate(secret, code string, t time.Time, lastStep int64) (int64, bool, error) {
+	if len(code) != Digits {
+		return 0, false, nil
+	}
+	now := Step(t)
+	for step := now - skew; step <= now+skew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		expected, err := codeAt(secret, step)
+		if err != nil {
+			return 0, false, err
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// codeAt implements the HOTP algorithm from RFC 4226, with the step as its counter.
+func codeAt(secret string, step int64) (string, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", errors.New("the TOTP secret isn't valid base32")
+	}
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	truncated := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", Digits, truncated%1000000), nil
+}
@@ -0,0 +1,146 @@
+package totp_test
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wikisophia/api/server/accounts/totp"
+)
+
+// rfcSecret is the SHA1 secret from RFC 6238's test vectors, in base32.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestRFCVectors(t *testing.T) {
+	// RFC 6238 lists 8 digit codes. These are their last 6 digits.
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1111111111: "050471",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, expected := range vectors {
+		code, err := totp.Code(rfcSecret, time.Unix(unix, 0))
+		require.NoError(t, err)
+		assert.Equal(t, expected, code, "code at %d", unix)
+	}
+}
+
+func TestValidateAllowsSkewButNotReuse(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	previous, err := totp.Code(rfcSecret, now.Add(-totp.Period))
+	require.NoError(t, err)
+	step, ok, err := totp.Validate(rfcSecret, previous, now, 0)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, totp.Step(now)-1, step)
+
+	_, ok, err = totp.Validate(rfcSecret, previous, now, step)
+	require.NoError(t, err)
+	assert.False(t, ok, "codes should only work once")
+	tooOld, err := totp.Code(rfcSecret, now.Add(-2*totp.Period))
+	require.NoError(t, err)
+	_, ok, err = totp.Validate(rfcSecret, tooOld, now, 0)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	_, ok, err = totp.Validate(rfcSecret, "12345", now, 0)
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestNewSecretWorks(t *testing.T) {
+	secret, err := totp.NewSecret()
+	require.NoError(t, err)
+	assert.Len(t, secret, 32)
+	code, err := totp.Code(secret, time.Now())
+	require.NoError(t, err)
+	_, ok, err := totp.Validate(secret, code, time.Now(), 0)
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestURI(t *testing.T) {
+	uri, err := url.Parse(totp.URI(rfcSecret, "Wikisophia", "someone@soph.wiki"))
+	require.NoError(t, err)
+	assert.Equal(t, "otpauth", uri.Scheme)
+	assert.Equal(t, "totp", uri.Host)
+	assert.Equal(t, "/Wikisophia:someone@soph.wiki", uri.Path)
+	assert.Equal(t, rfcSecret, uri.Query().Get("secret"))
+	assert.Equal(t, "Wikisophia", uri.Query().Get("issuer"))
+	assert.Equal(t, "6", uri.Query().Get("digits"))
+	assert.Equal(t, "30", uri.Query().Get("period"))
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := totp.NewRecoveryCodes()
+	require.NoError(t, err)
+	require.Len(t, codes, totp.RecoveryCodeCount)
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		assert.False(t, seen[code])
+		seen[code] = true
+		normalized, ok := totp.NormalizeRecoveryCode(code)
+		assert.True(t, ok)
+		assert.Equal(t, code, normalized)
+	}
+
+	normalized, ok := totp.NormalizeRecoveryCode(" ABCDE fghjk ")
+	assert.True(t, ok)
+	assert.Equal(t, "abcde-fghjk", normalized)
+	_, ok = totp.NormalizeRecoveryCode("123456")
+	assert.False(t, ok)
+	_, ok = totp.NormalizeRecoveryCode("abcde-fghj0")
+	assert.False(t, ok)
+}
+
+func TestMatchRecoveryCodeHashesOnce(t *testing.T) {
+	codes, err := totp.NewRecoveryCodes()
+	require.NoError(t, err)
+	hasher := &countingHasher{}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i], err = totp.HashRecoveryCode(context.Background(), hasher, code)
+		require.NoError(t, err)
+	}
+
+	matched, err := totp.MatchRecoveryCode(context.Background(), hasher, strings.ToUpper(codes[7]), hashes)
+	require.NoError(t, err)
+	assert.Equal(t, hashes[7], matched)
+	// Two codes can share a tag by chance, so count the hashes which have the same one.
+	sameTag := 0
+	for _, hash := range hashes[:8] {
+		if hash[:5] == hashes[7][:5] {
+			sameTag++
+		}
+	}
+	assert.Equal(t, sameTag, hasher.matches, "only the hashes with the code's lookup tag should be checked")
+
+	// Hashes from before the lookup tags still work.
+	legacy, err := hasher.Hash(context.Background(), codes[3])
+	require.NoError(t, err)
+	matched, err = totp.MatchRecoveryCode(context.Background(), hasher, codes[3], []string{legacy})
+	require.NoError(t, err)
+	assert.Equal(t, legacy, matched)
+
+	_, err = totp.HashRecoveryCode(context.Background(), hasher, "123456")
+	assert.Error(t, err)
+}
+
+// countingHasher hashes values quickly and insecurely, and counts how many hashes it checks.
+type countingHasher struct {
+	matches int
+}
+
+func (h *countingHasher) Hash(ctx context.Context, value string) (string, error) {
+	return "$fake$" + value, nil
+}
+
+func (h *countingHasher) Matches(ctx context.Context, value string, hash string) (bool, error) {
+	h.matches++
+	return hash == "$fake$"+value, nil
+}
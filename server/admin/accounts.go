@@ -0,0 +1,39 @@
+package admin
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/http/problems"
+)
+
+// Accounts is what the /accounts/ endpoints need from the accounts Store.
+type Accounts interface {
+	accounts.TwoFactor
+	accounts.Moderators
+}
+
+// accountHandler serves one resource of the account with the ID in the path.
+type accountHandler func(w http.ResponseWriter, r *http.Request, id int64)
+
+// Implements /accounts/:id/...
+//
+// This sends each request to the handler for its resource.
+func accountsHandler(store Accounts) http.HandlerFunc {
+	handlers := map[string]accountHandler{
+		"two-factor": twoFactorHandler(store),
+		"moderator":  moderatorHandler(store),
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		idString, resource, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/accounts/"), "/")
+		id, err := strconv.ParseInt(idString, 10, 64)
+		handler, ok := handlers[resource]
+		if err != nil || !ok {
+			problems.NotFound(w, r)
+			return
+		}
+		handler(w, r, id)
+	}
+}
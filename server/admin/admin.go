@@ -0,0 +1,122 @@
+// Package admin serves the endpoints which operators use to inspect and manage a running server.
+//
+// These have no authentication, so they're served on their own listener, which should only be
+// reachable from inside the deployment. They're never added to the API's router.
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/config"
+	"github.com/wikisophia/api/server/http/problems"
+	"github.com/wikisophia/api/server/metrics"
+)
+
+// Toggles are settings which can be changed while the server is running.
+// They're safe to use from multiple goroutines.
+type Toggles struct {
+	readOnly atomic.Bool
+}
+
+// ReadOnly is true if the API should reject requests which change data.
+func (t *Toggles) ReadOnly() bool {
+	return t != nil && t.readOnly.Load()
+}
+
+// SetReadOnly turns read-only mode on or off.
+func (t *Toggles) SetReadOnly(readOnly bool) {
+	t.readOnly.Store(readOnly)
+}
+
+// TogglesResponse is the body of GET /toggles responses, and PUT /toggles requests.
+type TogglesResponse struct {
+	ReadOnly bool `json:"readOnly"`
+}
+
+// NewHandler serves these endpoints:
+//
+//	GET /debug/pprof/...          The standard net/http/pprof profiles
+//	GET /metrics                  The registry's Prometheus metrics, if it isn't nil
+//	GET /config                   The app's config, with secrets redacted
+//	GET /toggles                  The current Toggles
+//	PUT /toggles                  Replace the Toggles
+//	GET /outbox                   The emails which failed to send, if outbox isn't nil
+//	POST /outbox/:id/retry        Send a failed email again, even if it was given up on
+//	GET /accounts/:id/two-factor  The account's two-factor auth status, if store isn't nil
+//	PUT /accounts/:id/two-factor  Set whether the account must use two-factor auth
+//	GET /accounts/:id/moderator   Whether the account is a moderator, if store isn't nil
+//	PUT /accounts/:id/moderator   Give the account the moderator role, or take it away
+func NewHandler(cfg config.Configuration, registry *prometheus.Registry, toggles *Toggles, outbox accounts.Outbox, store Accounts) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	if registry != nil {
+		mux.Handle("/metrics", metrics.Handler(registry))
+	}
+	mux.HandleFunc("/config", configHandler(cfg.Values()))
+	mux.HandleFunc("/toggles", togglesHandler(toggles))
+	if outbox != nil {
+		mux.HandleFunc("/outbox", failedEmailsHandler(outbox))
+		mux.HandleFunc("/outbox/", retryEmailHandler(outbox))
+	}
+	if store != nil {
+		mux.HandleFunc("/accounts/", accountsHandler(store))
+	}
+	mux.HandleFunc("/", problems.NotFound)
+	return mux
+}
+
+// NewServer makes an http.Server for the handler from NewHandler.
+func NewServer(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:    addr,
+		Handler: handler,
+	}
+}
+
+func configHandler(values map[string]interface{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			problems.MethodNotAllowed(w, r)
+			return
+		}
+		writeJSON(w, values)
+	}
+}
+
+func togglesHandler(toggles *Toggles) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+		case "PUT":
+			var body TogglesResponse
+			decoder := json.NewDecoder(r.Body)
+			decoder.DisallowUnknownFields()
+			if err := decoder.Decode(&body); err != nil {
+				problems.Write(w, http.StatusBadRequest, problems.CodeMalformedRequest, "Failed to parse request body: "+err.Error())
+				return
+			}
+			toggles.SetReadOnly(body.ReadOnly)
+		default:
+			problems.MethodNotAllowed(w, r)
+			return
+		}
+		writeJSON(w, TogglesResponse{
+			ReadOnly: toggles.ReadOnly(),
+		})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, body interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,210 @@
+package admin_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wikisophia/api/server/acceptancetest"
+	"github.com/wikisophia/api/server/accounts/memory"
+	"github.com/wikisophia/api/server/admin"
+	"github.com/wikisophia/api/server/config"
+	"github.com/wikisophia/api/server/http/problems"
+	"github.com/wikisophia/api/server/metrics"
+)
+
+func TestPprofServed(t *testing.T) {
+	rr := do(t, admin.NewHandler(config.Defaults(), nil, &admin.Toggles{}, nil, nil), "GET", "/debug/pprof/", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "goroutine")
+}
+
+func TestMetricsServed(t *testing.T) {
+	rr := do(t, admin.NewHandler(config.Defaults(), metrics.NewRegistry(), &admin.Toggles{}, nil, nil), "GET", "/metrics", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "go_goroutines")
+}
+
+func TestMetricsNotServedWithoutRegistry(t *testing.T) {
+	rr := do(t, admin.NewHandler(config.Defaults(), nil, &admin.Toggles{}, nil, nil), "GET", "/metrics", "")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestConfigRedacted(t *testing.T) {
+	cfg := config.Defaults()
+	cfg.AccountsStore.Postgres.Password = "hunter2"
+	rr := do(t, admin.NewHandler(cfg, nil, &admin.Toggles{}, nil, nil), "GET", "/config", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NotContains(t, rr.Body.String(), "hunter2")
+
+	var values map[string]interface{}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &values))
+	assert.Equal(t, config.Redacted, values["WKSPH_ACCOUNTS_STORE_POSTGRES_PASSWORD"])
+	assert.Equal(t, ":8001", values["WKSPH_SERVER_ADDR"])
+}
+
+func TestReadOnlyToggle(t *testing.T) {
+	toggles := &admin.Toggles{}
+	handler := admin.NewHandler(config.Defaults(), nil, toggles, nil, nil)
+
+	rr := do(t, handler, "PUT", "/toggles", `{"readOnly":true}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"readOnly":true}`, rr.Body.String())
+	assert.True(t, toggles.ReadOnly())
+
+	rr = do(t, handler, "GET", "/toggles", "")
+	assert.JSONEq(t, `{"readOnly":true}`, rr.Body.String())
+
+	do(t, handler, "PUT", "/toggles", `{"readOnly":false}`)
+	assert.False(t, toggles.ReadOnly())
+}
+
+func TestBadToggles(t *testing.T) {
+	handler := admin.NewHandler(config.Defaults(), nil, &admin.Toggles{}, nil, nil)
+	assert.Equal(t, http.StatusBadRequest, do(t, handler, "PUT", "/toggles", `{"readOnly":"yes"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do(t, handler, "PUT", "/toggles", `{"writeOnly":true}`).Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, do(t, handler, "DELETE", "/toggles", "").Code)
+}
+
+func do(t *testing.T, handler http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return rr
+}
+
+func TestFailedEmailsServed(t *testing.T) {
+	store := memory.NewMemoryStore()
+	account, _, err := store.NewResetToken(context.Background(), "email@soph.wiki")
+	require.NoError(t, err)
+	claimed, err := store.ClaimEmails(context.Background(), time.Now(), 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	require.NoError(t, store.EmailFailed(context.Background(), claimed[0].ID, "connection refused", time.Time{}))
+	handler := admin.NewHandler(config.Defaults(), nil, &admin.Toggles{}, store, nil)
+
+	rr := do(t, handler, "GET", "/outbox", "")
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.NotContains(t, rr.Body.String(), account.ResetToken)
+	var response admin.FailedEmailsResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	require.Len(t, response.Emails, 1)
+	assert.Equal(t, "email@soph.wiki", response.Emails[0].Email)
+	assert.Equal(t, "connection refused", response.Emails[0].LastError)
+	assert.NotNil(t, response.Emails[0].DeadAt)
+	assert.Nil(t, response.Emails[0].NextAttemptAt)
+
+	id := strconv.FormatInt(claimed[0].ID, 10)
+	assert.Equal(t, http.StatusNoContent, do(t, handler, "POST", "/outbox/"+id+"/retry", "").Code)
+	claimed, err = store.ClaimEmails(context.Background(), time.Now(), 10, time.Minute)
+	require.NoError(t, err)
+	assert.Len(t, claimed, 1, "retried emails should be due right away")
+}
+
+func TestStaleEmailRetriesConflict(t *testing.T) {
+	store := memory.NewMemoryStore()
+	account, _, err := store.NewResetToken(context.Background(), "email@soph.wiki")
+	require.NoError(t, err)
+	claimed, err := store.ClaimEmails(context.Background(), time.Now(), 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	require.NoError(t, store.EmailFailed(context.Background(), claimed[0].ID, "connection refused", time.Time{}))
+	// The welcome email's reset token would go to an email which isn't the account's anymore.
+	require.NoError(t, store.SetForgottenPassword(context.Background(), account.ID, "password", account.ResetToken))
+	moved, err := store.RequestEmailChange(context.Background(), account.ID, "password", "moved@soph.wiki", "")
+	require.NoError(t, err)
+	require.NoError(t, store.ConfirmEmailChange(context.Background(), account.ID, moved.EmailChangeToken))
+	handler := admin.NewHandler(config.Defaults(), nil, &admin.Toggles{}, store, nil)
+
+	rr := do(t, handler, "POST", "/outbox/"+strconv.FormatInt(claimed[0].ID, 10)+"/retry", "")
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	assert.Equal(t, problems.CodeStaleEmail, acceptancetest.ParseProblem(t, rr).Code)
+}
+
+func TestBadEmailRetries(t *testing.T) {
+	handler := admin.NewHandler(config.Defaults(), nil, &admin.Toggles{}, memory.NewMemoryStore(), nil)
+	assert.Equal(t, http.StatusNotFound, do(t, handler, "POST", "/outbox/1/retry", "").Code)
+	assert.Equal(t, http.StatusNotFound, do(t, handler, "POST", "/outbox/one/retry", "").Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, do(t, handler, "GET", "/outbox/1/retry", "").Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, do(t, handler, "POST", "/outbox", "").Code)
+}
+
+func TestOutboxNotServedWithoutStore(t *testing.T) {
+	rr := do(t, admin.NewHandler(config.Defaults(), nil, &admin.Toggles{}, nil, nil), "GET", "/outbox", "")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestTwoFactorRequirement(t *testing.T) {
+	store := memory.NewMemoryStore()
+	account, _, err := store.NewResetToken(context.Background(), "email@soph.wiki")
+	require.NoError(t, err)
+	handler := admin.NewHandler(config.Defaults(), nil, &admin.Toggles{}, nil, store)
+	path := "/accounts/" + strconv.FormatInt(account.ID, 10) + "/two-factor"
+
+	rr := do(t, handler, "PUT", path, `{"required":true}`)
+	require.Equal(t, http.StatusOK, rr.Code)
+	var response admin.TwoFactorResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, admin.TwoFactorResponse{Required: true}, response)
+	status, err := store.TwoFactorStatus(context.Background(), account.ID)
+	require.NoError(t, err)
+	assert.True(t, status.Required)
+
+	rr = do(t, handler, "GET", path, "")
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.True(t, response.Required)
+
+	assert.Equal(t, http.StatusNotFound, do(t, handler, "PUT", "/accounts/100/two-factor", `{"required":true}`).Code)
+	assert.Equal(t, http.StatusNotFound, do(t, handler, "GET", "/accounts/one/two-factor", "").Code)
+	assert.Equal(t, http.StatusBadRequest, do(t, handler, "PUT", path, `{"require":true}`).Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, do(t, handler, "POST", path, "").Code)
+}
+
+func TestModeratorRole(t *testing.T) {
+	store := memory.NewMemoryStore()
+	account, _, err := store.NewResetToken(context.Background(), "email@soph.wiki")
+	require.NoError(t, err)
+	handler := admin.NewHandler(config.Defaults(), nil, &admin.Toggles{}, nil, store)
+	path := "/accounts/" + strconv.FormatInt(account.ID, 10) + "/moderator"
+
+	rr := do(t, handler, "PUT", path, `{"moderator":true}`)
+	require.Equal(t, http.StatusOK, rr.Code)
+	var response admin.ModeratorResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.True(t, response.Moderator)
+	status, err := store.TwoFactorStatus(context.Background(), account.ID)
+	require.NoError(t, err)
+	assert.True(t, status.Required, "moderators should need two-factor auth")
+
+	twoFactorPath := "/accounts/" + strconv.FormatInt(account.ID, 10) + "/two-factor"
+	rr = do(t, handler, "PUT", twoFactorPath, `{"required":false}`)
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	assert.Equal(t, problems.CodeTwoFactorRequired, acceptancetest.ParseProblem(t, rr).Code)
+
+	rr = do(t, handler, "PUT", path, `{"moderator":false}`)
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.False(t, response.Moderator)
+	assert.Equal(t, http.StatusOK, do(t, handler, "PUT", twoFactorPath, `{"required":false}`).Code)
+
+	rr = do(t, handler, "GET", path, "")
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"moderator":false}`, rr.Body.String())
+	assert.Equal(t, http.StatusNotFound, do(t, handler, "PUT", "/accounts/100/moderator", `{"moderator":true}`).Code)
+	assert.Equal(t, http.StatusNotFound, do(t, handler, "GET", "/accounts/1/moderators", "").Code)
+	assert.Equal(t, http.StatusBadRequest, do(t, handler, "PUT", path, `{"mod":true}`).Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, do(t, handler, "POST", path, "").Code)
+}
+
+func TestTwoFactorNotServedWithoutStore(t *testing.T) {
+	rr := do(t, admin.NewHandler(config.Defaults(), nil, &admin.Toggles{}, nil, nil), "GET", "/accounts/1/two-factor", "")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
@@ -0,0 +1,58 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/http/problems"
+)
+
+// ModeratorResponse is the body of GET /accounts/:id/moderator responses, and PUT /accounts/:id/moderator requests.
+type ModeratorResponse struct {
+	Moderator bool `json:"moderator"`
+}
+
+// Implements GET and PUT /accounts/:id/moderator
+//
+// Giving an account the moderator role requires it to have two-factor auth too.
+func moderatorHandler(moderators accounts.Moderators) accountHandler {
+	return func(w http.ResponseWriter, r *http.Request, id int64) {
+		switch r.Method {
+		case "GET":
+		case "PUT":
+			var body ModeratorResponse
+			decoder := json.NewDecoder(r.Body)
+			decoder.DisallowUnknownFields()
+			if err := decoder.Decode(&body); err != nil {
+				problems.Write(w, http.StatusBadRequest, problems.CodeMalformedRequest, "Failed to parse request body: "+err.Error())
+				return
+			}
+			err := moderators.SetModerator(r.Context(), id, body.Moderator)
+			if errors.As(err, &accounts.AccountNotExistsError{}) {
+				problems.NotFound(w, r)
+				return
+			}
+			if err != nil {
+				problems.WriteInternal(w, r, err)
+				return
+			}
+		default:
+			problems.MethodNotAllowed(w, r)
+			return
+		}
+		moderator, err := moderators.IsModerator(r.Context(), id)
+		if errors.As(err, &accounts.AccountNotExistsError{}) {
+			problems.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			problems.WriteInternal(w, r, err)
+			return
+		}
+		writeJSON(w, ModeratorResponse{
+			Moderator: moderator,
+		})
+	}
+}
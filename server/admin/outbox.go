@@ -0,0 +1,101 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/http/problems"
+)
+
+// FailedEmailsResponse is the body of GET /outbox responses.
+type FailedEmailsResponse struct {
+	Emails []FailedEmail `json:"emails"`
+}
+
+// FailedEmail describes an email which has failed to send at least once.
+// Its tokens are left out, since they still work until the email dies.
+type FailedEmail struct {
+	ID        int64     `json:"id"`
+	Kind      string    `json:"kind"`
+	AccountID int64     `json:"accountId"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"createdAt"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"lastError"`
+	// NextAttemptAt is when the email will be retried. It's nil if the email is dead.
+	NextAttemptAt *time.Time `json:"nextAttemptAt,omitempty"`
+	// DeadAt is when the email was given up on. It's nil if it'll still be retried.
+	DeadAt *time.Time `json:"deadAt,omitempty"`
+}
+
+// Implements GET /outbox
+func failedEmailsHandler(outbox accounts.Outbox) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			problems.MethodNotAllowed(w, r)
+			return
+		}
+		failed, err := outbox.FailedEmails(r.Context())
+		if err != nil {
+			problems.WriteInternal(w, r, err)
+			return
+		}
+		response := FailedEmailsResponse{Emails: make([]FailedEmail, 0, len(failed))}
+		for _, email := range failed {
+			response.Emails = append(response.Emails, describeFailure(email))
+		}
+		writeJSON(w, response)
+	}
+}
+
+// Implements POST /outbox/:id/retry
+func retryEmailHandler(outbox accounts.Outbox) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		idString, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/outbox/"), "/")
+		id, err := strconv.ParseInt(idString, 10, 64)
+		if err != nil || action != "retry" {
+			problems.NotFound(w, r)
+			return
+		}
+		if r.Method != "POST" {
+			problems.MethodNotAllowed(w, r)
+			return
+		}
+		err = outbox.RetryEmail(r.Context(), id)
+		if errors.As(err, &accounts.QueuedEmailNotExistsError{}) {
+			problems.NotFound(w, r)
+			return
+		}
+		if errors.As(err, &accounts.StaleQueuedEmailError{}) {
+			problems.Write(w, http.StatusConflict, problems.CodeStaleEmail, "The account has changed since this email was queued, so it can't get new tokens.")
+			return
+		}
+		if err != nil {
+			problems.WriteInternal(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func describeFailure(email accounts.QueuedEmail) FailedEmail {
+	failure := FailedEmail{
+		ID:        email.ID,
+		Kind:      string(email.Kind),
+		AccountID: email.Account.ID,
+		Email:     email.Account.Email,
+		CreatedAt: email.CreatedAt,
+		Attempts:  email.Attempts,
+		LastError: email.LastError,
+	}
+	if email.DeadAt.IsZero() {
+		failure.NextAttemptAt = &email.NextAttemptAt
+	} else {
+		failure.DeadAt = &email.DeadAt
+	}
+	return failure
+}
@@ -0,0 +1,72 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/http/problems"
+)
+
+// TwoFactorResponse is the body of GET /accounts/:id/two-factor responses.
+type TwoFactorResponse struct {
+	Enabled           bool `json:"enabled"`
+	Required          bool `json:"required"`
+	RecoveryCodesLeft int  `json:"recoveryCodesLeft"`
+}
+
+// RequireTwoFactorRequest is the body of PUT /accounts/:id/two-factor requests.
+type RequireTwoFactorRequest struct {
+	Required bool `json:"required"`
+}
+
+// Implements GET and PUT /accounts/:id/two-factor
+//
+// Accounts which are required to have two-factor auth can't log in until they set it up, and can't turn it off.
+// Moderators always are, so the requirement can't be taken off of them.
+func twoFactorHandler(twoFactor accounts.TwoFactor) accountHandler {
+	return func(w http.ResponseWriter, r *http.Request, id int64) {
+		switch r.Method {
+		case "GET":
+		case "PUT":
+			var body RequireTwoFactorRequest
+			decoder := json.NewDecoder(r.Body)
+			decoder.DisallowUnknownFields()
+			if err := decoder.Decode(&body); err != nil {
+				problems.Write(w, http.StatusBadRequest, problems.CodeMalformedRequest, "Failed to parse request body: "+err.Error())
+				return
+			}
+			err := twoFactor.RequireTwoFactor(r.Context(), id, body.Required)
+			if errors.As(err, &accounts.AccountNotExistsError{}) {
+				problems.NotFound(w, r)
+				return
+			}
+			if errors.As(err, &accounts.TwoFactorRequiredError{}) {
+				problems.Write(w, http.StatusConflict, problems.CodeTwoFactorRequired, "Moderators must have two-factor auth. Take the role away first.")
+				return
+			}
+			if err != nil {
+				problems.WriteInternal(w, r, err)
+				return
+			}
+		default:
+			problems.MethodNotAllowed(w, r)
+			return
+		}
+		status, err := twoFactor.TwoFactorStatus(r.Context(), id)
+		if errors.As(err, &accounts.AccountNotExistsError{}) {
+			problems.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			problems.WriteInternal(w, r, err)
+			return
+		}
+		writeJSON(w, TwoFactorResponse{
+			Enabled:           status.Enabled,
+			Required:          status.Required,
+			RecoveryCodesLeft: status.RecoveryCodesLeft,
+		})
+	}
+}
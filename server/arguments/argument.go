@@ -1,8 +1,8 @@
 package arguments
 
 import (
-	"errors"
 	"fmt"
+	"strings"
 )
 
 // Argument is the core data type for the API.
@@ -11,25 +11,64 @@ type Argument struct {
 	Version    int      `json:"version"`
 	Conclusion string   `json:"conclusion"`
 	Premises   []string `json:"premises"`
+	// AuthorID is the account which wrote this version, or 0 if nobody was logged in.
+	// It's left out of the JSON so that clients can neither see nor forge it.
+	AuthorID int64 `json:"-"`
 }
 
-// Validate returns nil if the argument is well-formed, or an error if not.
+// Validate returns nil if the argument is well-formed.
+// Otherwise it returns a *ValidationError which lists everything that's wrong with it.
 func (a *Argument) Validate() error {
+	var errs []FieldError
 	if a.Conclusion == "" {
-		return errors.New("arguments must have a conclusion")
+		errs = append(errs, FieldError{
+			Field:   "conclusion",
+			Message: "arguments must have a conclusion",
+		})
 	}
 	if len(a.Premises) < 2 {
-		return errors.New("arguments must have at least 2 premises")
+		errs = append(errs, FieldError{
+			Field:   "premises",
+			Message: "arguments must have at least 2 premises",
+		})
 	}
 	for i, premise := range a.Premises {
 		if premise == "" {
-			return fmt.Errorf("argument premise[%d] is empty, but must not be", i)
+			errs = append(errs, FieldError{
+				Field:   fmt.Sprintf("premises[%d]", i),
+				Message: fmt.Sprintf("argument premise[%d] is empty, but must not be", i),
+			})
 		}
 	}
 
+	if len(errs) > 0 {
+		return &ValidationError{
+			Fields: errs,
+		}
+	}
 	return nil
 }
 
+// ValidationError is returned by Validate if an argument is malformed.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Fields))
+	for _, field := range e.Fields {
+		messages = append(messages, field.Message)
+	}
+	return strings.Join(messages, "; ")
+}
+
+// FieldError describes what's wrong with one part of an argument.
+type FieldError struct {
+	// Field is the JSON name of the bad value, like "conclusion" or "premises[1]".
+	Field   string
+	Message string
+}
+
 // ByID can be used to sort slices of Arguments by ID.
 type ByID []Argument
 
@@ -1,22 +1,22 @@
 package http
 
 import (
-	"context"
 	"fmt"
 	"net/http"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/wikisophia/api/server/arguments"
+	"github.com/wikisophia/api/server/http/problems"
 )
 
 func deleteHandler(deleter arguments.Deleter) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
 		id, goodID := parseInt64Param(params.ByName("id"))
 		if !goodID {
-			http.Error(w, fmt.Sprintf("argument %s does not exist", params.ByName("id")), http.StatusNotFound)
+			problems.Write(w, http.StatusNotFound, problems.CodeNotFound, fmt.Sprintf("argument %s does not exist", params.ByName("id")))
 			return
 		}
-		if err := deleter.Delete(context.Background(), id); writeStoreError(w, err) {
+		if err := deleter.Delete(r.Context(), id); writeStoreError(w, r, err) {
 			return
 		}
 
@@ -8,6 +8,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/wikisophia/api/server/acceptancetest"
+	"github.com/wikisophia/api/server/http/problems"
 )
 
 func TestGetDeleted(t *testing.T) {
@@ -25,13 +26,13 @@ func TestGetDeleted(t *testing.T) {
 func TestDeleteUnknown(t *testing.T) {
 	rr := newApp(t, nil).Do(newDeleteArgument(1))
 	assert.Equal(t, http.StatusNotFound, rr.Code)
-	assert.Equal(t, "text/plain; charset=utf-8", rr.Header().Get("Content-Type"))
+	assert.Equal(t, problems.ContentType, rr.Header().Get("Content-Type"))
 }
 
 func TestDeleteUnknownString(t *testing.T) {
 	rr := newApp(t, nil).Do(httptest.NewRequest("DELETE", "/arguments/badID", nil))
 	assert.Equal(t, http.StatusNotFound, rr.Code)
-	assert.Equal(t, "text/plain; charset=utf-8", rr.Header().Get("Content-Type"))
+	assert.Equal(t, problems.ContentType, rr.Header().Get("Content-Type"))
 }
 
 func newDeleteArgument(id int64) *http.Request {
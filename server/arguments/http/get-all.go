@@ -1,7 +1,6 @@
 package http
 
 import (
-	"context"
 	"encoding/json"
 	"net/http"
 	"regexp"
@@ -9,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/wikisophia/api/server/arguments"
+	"github.com/wikisophia/api/server/http/problems"
 )
 
 var wordSplitter = regexp.MustCompile("[a-zA-Z]+")
@@ -16,34 +16,33 @@ var wordSplitter = regexp.MustCompile("[a-zA-Z]+")
 func getAllArgumentsHandler(getter arguments.GetSome) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.URL == nil {
-			http.Error(w, "URL was nil. Bad Request-Line?", http.StatusBadRequest)
+			problems.Write(w, http.StatusBadRequest, problems.CodeMalformedRequest, "URL was nil. Bad Request-Line?")
 			return
 		}
 		count, ok := parseOptionalNonNegativeIntParam(r.URL.Query().Get("count"))
 		if !ok {
-			http.Error(w, "The count query param must be a nonnegative integer.", http.StatusBadRequest)
+			writeInvalidQueryParam(w, "count", "The count query param must be a nonnegative integer.")
 			return
 		}
 		offset, ok := parseOptionalNonNegativeIntParam(r.URL.Query().Get("offset"))
 		if !ok {
-			http.Error(w, "The offset query param must be a nonnegative integer.", http.StatusBadRequest)
+			writeInvalidQueryParam(w, "offset", "The offset query param must be a nonnegative integer.")
 			return
 		}
 		exclude, ok := parseOptionalArrayOfInt64s(r.URL.Query().Get("exclude"))
 		if !ok {
-			http.Error(w, "The exclude query param must be a comma-separated list of non-negative integers.", http.StatusBadRequest)
+			writeInvalidQueryParam(w, "exclude", "The exclude query param must be a comma-separated list of non-negative integers.")
 			return
 		}
 
-		args, err := getter.FetchSome(context.Background(), arguments.FetchSomeOptions{
+		args, err := getter.FetchSome(r.Context(), arguments.FetchSomeOptions{
 			Conclusion:            r.URL.Query().Get("conclusion"),
 			ConclusionContainsAll: wordSplitter.FindAllString(r.URL.Query().Get("search"), -1),
 			Count:                 count,
 			Exclude:               exclude,
 			Offset:                offset,
 		})
-		if err != nil {
-			http.Error(w, "failed to fetch arguments from the backend", http.StatusInternalServerError)
+		if writeStoreError(w, r, err) {
 			return
 		}
 
@@ -55,6 +54,13 @@ func getAllArgumentsHandler(getter arguments.GetSome) http.HandlerFunc {
 	}
 }
 
+func writeInvalidQueryParam(w http.ResponseWriter, param string, detail string) {
+	problems.WriteInvalid(w, detail, []problems.FieldError{{
+		Field:  param,
+		Detail: detail,
+	}})
+}
+
 // GetAllResponse is the contract class for the GET /arguments?conclusion=foo endpoint
 type GetAllResponse struct {
 	Arguments []arguments.Argument `json:"arguments"`
@@ -1,12 +1,12 @@
 package http
 
 import (
-	"context"
 	"fmt"
 	"net/http"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/wikisophia/api/server/arguments"
+	"github.com/wikisophia/api/server/http/problems"
 )
 
 // Implements GET /arguments/:id
@@ -14,12 +14,12 @@ func getLiveArgumentHandler(getter arguments.GetLive) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
 		id, goodID := parseInt64Param(params.ByName("id"))
 		if !goodID {
-			http.Error(w, fmt.Sprintf("argument %s does not exist", params.ByName("id")), http.StatusNotFound)
+			problems.Write(w, http.StatusNotFound, problems.CodeNotFound, fmt.Sprintf("argument %s does not exist", params.ByName("id")))
 			return
 		}
 
-		arg, err := getter.FetchLive(context.Background(), id)
-		if writeStoreError(w, err) {
+		arg, err := getter.FetchLive(r.Context(), id)
+		if writeStoreError(w, r, err) {
 			return
 		}
 		w.Header().Set("Content-Type", "application/json; charset=utf-8")
@@ -8,6 +8,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/wikisophia/api/server/acceptancetest"
+	"github.com/wikisophia/api/server/http/problems"
 )
 
 func TestGetLatest(t *testing.T) {
@@ -26,13 +27,13 @@ func TestGetLatest(t *testing.T) {
 func TestGetMissingArgument(t *testing.T) {
 	rr := newApp(t, nil).Do(newGetArgument(1))
 	assert.Equal(t, http.StatusNotFound, rr.Code)
-	assert.Equal(t, "text/plain; charset=utf-8", rr.Header().Get("Content-Type"))
+	assert.Equal(t, problems.CodeNotFound, acceptancetest.ParseProblem(t, rr).Code)
 }
 
 func TestGetStringID(t *testing.T) {
 	rr := newApp(t, nil).Do(httptest.NewRequest("GET", "/arguments/foo", nil))
 	assert.Equal(t, http.StatusNotFound, rr.Code)
-	assert.Equal(t, "text/plain; charset=utf-8", rr.Header().Get("Content-Type"))
+	assert.Equal(t, problems.ContentType, rr.Header().Get("Content-Type"))
 }
 
 func TestPostSpecificArgumentsNotAllowed(t *testing.T) {
@@ -1,12 +1,12 @@
 package http
 
 import (
-	"context"
 	"fmt"
 	"net/http"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/wikisophia/api/server/arguments"
+	"github.com/wikisophia/api/server/http/problems"
 )
 
 // Implements GET /arguments/:id/version/:version
@@ -17,11 +17,11 @@ func getArgumentByVersionHandler(getter arguments.GetVersioned) httprouter.Handl
 
 		if !goodID || !ok {
 			response := fmt.Sprintf("version %s of argument %s does not exist", params.ByName("version"), params.ByName("id"))
-			http.Error(w, response, http.StatusNotFound)
+			problems.Write(w, http.StatusNotFound, problems.CodeNotFound, response)
 			return
 		}
-		arg, err := getter.FetchVersion(context.Background(), id, version)
-		if writeStoreError(w, err) {
+		arg, err := getter.FetchVersion(r.Context(), id, version)
+		if writeStoreError(w, r, err) {
 			return
 		}
 		w.Header().Set("Content-Type", "application/json; charset=utf-8")
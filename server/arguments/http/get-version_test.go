@@ -8,6 +8,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/wikisophia/api/server/acceptancetest"
+	"github.com/wikisophia/api/server/http/problems"
 )
 
 func TestGetVersion(t *testing.T) {
@@ -36,13 +37,13 @@ func TestGetMissingVersion(t *testing.T) {
 func TestGetStringVersion(t *testing.T) {
 	rr := newApp(t, nil).Do(httptest.NewRequest("GET", "/arguments/1/version/foo", nil))
 	assert.Equal(t, http.StatusNotFound, rr.Code)
-	assert.Equal(t, "text/plain; charset=utf-8", rr.Header().Get("Content-Type"))
+	assert.Equal(t, problems.ContentType, rr.Header().Get("Content-Type"))
 }
 
 func TestGetLargeVersion(t *testing.T) {
 	rr := newApp(t, nil).Do(newGetArgumentVersion(1, 65537))
 	assert.Equal(t, http.StatusNotFound, rr.Code)
-	assert.Equal(t, "text/plain; charset=utf-8", rr.Header().Get("Content-Type"))
+	assert.Equal(t, problems.ContentType, rr.Header().Get("Content-Type"))
 }
 
 func newGetArgumentVersion(id int64, version int) *http.Request {
@@ -1,16 +1,29 @@
 package http
 
 import (
+	"net/http"
+
 	"github.com/julienschmidt/httprouter"
 	"github.com/wikisophia/api/server/arguments"
 )
 
+// Router is implemented by *httprouter.Router.
+// The server may wrap it to add middleware to each route.
+type Router interface {
+	Handle(method, path string, handle httprouter.Handle)
+	HandlerFunc(method, path string, handler http.HandlerFunc)
+}
+
+// SessionAccountID returns the ID of the account which is logged into the request, if there is one.
+type SessionAccountID func(r *http.Request) (int64, bool)
+
 // AppendRoutes populates the router with all the /arguments* endpoints.
-func AppendRoutes(router *httprouter.Router, store arguments.Store) {
-	router.HandlerFunc("POST", "/arguments", saveHandler(store))
+// New versions are recorded as written by the account which sessionAccountID finds, if any.
+func AppendRoutes(router Router, store arguments.Store, sessionAccountID SessionAccountID) {
+	router.HandlerFunc("POST", "/arguments", saveHandler(store, sessionAccountID))
 	router.HandlerFunc("GET", "/arguments", getAllArgumentsHandler(store))
-	router.GET("/arguments/:id", getLiveArgumentHandler(store))
-	router.PATCH("/arguments/:id", updateHandler(store))
-	router.DELETE("/arguments/:id", deleteHandler(store))
-	router.GET("/arguments/:id/version/:version", getArgumentByVersionHandler(store))
+	router.Handle("GET", "/arguments/:id", getLiveArgumentHandler(store))
+	router.Handle("PATCH", "/arguments/:id", updateHandler(store, sessionAccountID))
+	router.Handle("DELETE", "/arguments/:id", deleteHandler(store))
+	router.Handle("GET", "/arguments/:id/version/:version", getArgumentByVersionHandler(store))
 }
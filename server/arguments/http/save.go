@@ -1,37 +1,39 @@
 package http
 
 import (
-	"context"
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
 	"strconv"
 
 	"github.com/wikisophia/api/server/arguments"
+	"github.com/wikisophia/api/server/http/problems"
 )
 
 // Implements POST /arguments
-func saveHandler(saver arguments.Saver) http.HandlerFunc {
+func saveHandler(saver arguments.Saver, sessionAccountID SessionAccountID) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		data, err := ioutil.ReadAll(r.Body)
 		if err != nil {
-			http.Error(w, "Failed to read request: "+err.Error(), http.StatusBadRequest)
+			problems.Write(w, http.StatusBadRequest, problems.CodeMalformedRequest, "Failed to read the request body.")
 			return
 		}
 
 		var arg arguments.Argument
 		if err := json.Unmarshal(data, &arg); err != nil {
-			http.Error(w, "Failed to unmarshal argument: "+err.Error(), http.StatusBadRequest)
+			problems.Write(w, http.StatusBadRequest, problems.CodeMalformedRequest, "Failed to unmarshal argument: "+err.Error())
 			return
 		}
 		if err := arg.Validate(); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			writeInvalidArgument(w, err)
 			return
 		}
 
-		id, err := saver.Save(context.Background(), arg)
-		if err != nil {
-			http.Error(w, "Failed to save argument: "+err.Error(), http.StatusServiceUnavailable)
+		if accountID, ok := sessionAccountID(r); ok {
+			arg.AuthorID = accountID
+		}
+		id, err := saver.Save(r.Context(), arg)
+		if writeStoreError(w, r, err) {
 			return
 		}
 		arg.ID = id
@@ -4,10 +4,13 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/wikisophia/api/server/acceptancetest"
+	"github.com/wikisophia/api/server/arguments"
+	"github.com/wikisophia/api/server/http/problems"
 )
 
 func TestSaveGetRoundtrip(t *testing.T) {
@@ -20,22 +23,53 @@ func TestSaveGetRoundtrip(t *testing.T) {
 	assert.Equal(t, expected, actual)
 }
 
+// TestConcurrentSaves makes sure requests can be handled in parallel.
+// This is mostly useful with "go test -race".
+func TestConcurrentSaves(t *testing.T) {
+	app := newApp(t, nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rr := app.Do(newPostArgument(`{"conclusion":"Socrates is mortal","premises":["Socrates is a man","All men are mortal"]}`))
+			assert.Equal(t, http.StatusCreated, rr.Code)
+			rr = app.Do(httptest.NewRequest("GET", "/arguments", nil))
+			assert.Equal(t, http.StatusOK, rr.Code)
+		}()
+	}
+	wg.Wait()
+	assert.Len(t, app.FetchSomeSuccessfully(t, arguments.FetchSomeOptions{}), 10)
+}
+
 func TestSaveNoConclusion(t *testing.T) {
 	rr := newApp(t, nil).Do(newPostArgument(`{"premises":["Socrates is a man","All men are mortal"]}`))
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
-	assert.Equal(t, "text/plain; charset=utf-8", rr.Header().Get("Content-Type"))
+	assert.Equal(t, problems.ContentType, rr.Header().Get("Content-Type"))
 }
 
 func TestSaveNoPremises(t *testing.T) {
 	rr := newApp(t, nil).Do(newPostArgument(`{"conclusion":"Socrates is mortal"}`))
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
-	assert.Equal(t, "text/plain; charset=utf-8", rr.Header().Get("Content-Type"))
+	assert.Equal(t, problems.ContentType, rr.Header().Get("Content-Type"))
+}
+
+func TestSaveListsEveryInvalidField(t *testing.T) {
+	rr := newApp(t, nil).Do(newPostArgument(`{"premises":["Socrates is a man",""]}`))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	problem := acceptancetest.ParseProblem(t, rr)
+	assert.Equal(t, problems.CodeValidationFailed, problem.Code)
+	fields := make([]string, 0, len(problem.Errors))
+	for _, fieldError := range problem.Errors {
+		fields = append(fields, fieldError.Field)
+	}
+	assert.Equal(t, []string{"conclusion", "premises[1]"}, fields)
 }
 
 func TestSaveNotJSON(t *testing.T) {
 	rr := newApp(t, nil).Do(newPostArgument("bad payload"))
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
-	assert.Equal(t, "text/plain; charset=utf-8", rr.Header().Get("Content-Type"))
+	assert.Equal(t, problems.ContentType, rr.Header().Get("Content-Type"))
 }
 
 func newPostArgument(payload string) *http.Request {
@@ -1,47 +1,58 @@
 package http
 
 import (
-	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"log"
 	"net/http"
 	"strconv"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/wikisophia/api/server/arguments"
+	"github.com/wikisophia/api/server/http/problems"
+	"github.com/wikisophia/api/server/http/timeouts"
 )
 
 // Implements PATCH /arguments/:id
-func updateHandler(updater arguments.Updater) httprouter.Handle {
+func updateHandler(updater arguments.Updater, sessionAccountID SessionAccountID) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
 		id, goodID := parseInt64Param(params.ByName("id"))
 		if !goodID || id < 1 {
-			http.Error(w, fmt.Sprintf("argument %s does not exist", params.ByName("id")), http.StatusNotFound)
+			problems.Write(w, http.StatusNotFound, problems.CodeNotFound, fmt.Sprintf("argument %s does not exist", params.ByName("id")))
 			return
 		}
 
 		bodyBytes, err := ioutil.ReadAll(r.Body)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("error reading request body: %v", err), http.StatusInternalServerError)
+			problems.Write(w, http.StatusBadRequest, problems.CodeMalformedRequest, "Failed to read the request body.")
 			return
 		}
 		var arg arguments.Argument
 		if err := json.Unmarshal(bodyBytes, &arg); err != nil {
-			http.Error(w, "request body parse failure. Check the JSON syntax in your request body.", http.StatusBadRequest)
+			problems.Write(w, http.StatusBadRequest, problems.CodeMalformedRequest, "request body parse failure. Check the JSON syntax in your request body.")
 			return
 		}
 		if arg.ID != 0 {
-			http.Error(w, "request.id should not be defined. The ID is taken from the URL path.", http.StatusBadRequest)
+			detail := "request.id should not be defined. The ID is taken from the URL path."
+			problems.WriteInvalid(w, detail, []problems.FieldError{{
+				Field:  "id",
+				Detail: detail,
+			}})
+			return
 		}
 		arg.ID = id
 		if err := arg.Validate(); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			writeInvalidArgument(w, err)
 			return
 		}
 
-		version, err := updater.Update(context.Background(), arg)
-		if writeStoreError(w, err) {
+		if accountID, ok := sessionAccountID(r); ok {
+			arg.AuthorID = accountID
+		}
+		version, err := updater.Update(r.Context(), arg)
+		if writeStoreError(w, r, err) {
 			return
 		}
 		arg.Version = version
@@ -58,24 +69,47 @@ func parseInt64Param(param string) (int64, bool) {
 	return parsed, err == nil
 }
 
-func writeStoreError(w http.ResponseWriter, err error) bool {
+// writeStoreError responds to the error from a Store call.
+// It returns false if err was nil, in which case nothing was written.
+func writeStoreError(w http.ResponseWriter, r *http.Request, err error) bool {
 	if err == nil {
 		return false
 	}
+	if timeouts.WriteError(w, r, err) {
+		return true
+	}
 	if _, ok := err.(*arguments.NotFoundError); ok {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		problems.Write(w, http.StatusNotFound, problems.CodeNotFound, err.Error())
 		return true
 	}
-	http.Error(w, err.Error(), http.StatusInternalServerError)
+	problems.WriteInternal(w, r, err)
 	return true
 }
 
+// writeInvalidArgument responds to the error from Argument.Validate.
+func writeInvalidArgument(w http.ResponseWriter, err error) {
+	var invalid *arguments.ValidationError
+	if !errors.As(err, &invalid) {
+		problems.Write(w, http.StatusBadRequest, problems.CodeValidationFailed, err.Error())
+		return
+	}
+	fields := make([]problems.FieldError, 0, len(invalid.Fields))
+	for _, field := range invalid.Fields {
+		fields = append(fields, problems.FieldError{
+			Field:  field.Field,
+			Detail: field.Message,
+		})
+	}
+	problems.WriteInvalid(w, err.Error(), fields)
+}
+
 func writeArgument(w http.ResponseWriter, arg arguments.Argument, id string) {
 	data, err := json.Marshal(GetOneResponse{
 		Argument: arg,
 	})
 	if err != nil {
-		http.Error(w, "failed json.marshal on argument "+id, http.StatusInternalServerError)
+		// Callers may have written the status already, so this can only be logged.
+		log.Printf("ERROR: failed json.marshal on argument %s: %v", id, err)
 		return
 	}
 	w.Write(data)
@@ -9,6 +9,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/wikisophia/api/server/acceptancetest"
+	"github.com/wikisophia/api/server/http/problems"
 )
 
 func TestPatchLive(t *testing.T) {
@@ -43,7 +44,7 @@ func TestPatchUnknown(t *testing.T) {
 	payload := string(acceptancetest.ReadFile(t, samplesPath+"update-request.json"))
 	rr := app.Do(httptest.NewRequest("PATCH", "/arguments/1", strings.NewReader(payload)))
 	assert.Equal(t, http.StatusNotFound, rr.Code, "body: %s", rr.Body.String())
-	assert.Equal(t, "text/plain; charset=utf-8", rr.Header().Get("Content-Type"))
+	assert.Equal(t, problems.ContentType, rr.Header().Get("Content-Type"))
 }
 
 func TestMalformedPatch(t *testing.T) {
@@ -64,5 +65,5 @@ func assertPatchRejected(t *testing.T, payload string) {
 	id := app.SaveSuccessfully(t, acceptancetest.ParseSample(t, samplesPath+"save-request.json"))
 	rr := app.Do(httptest.NewRequest("PATCH", "/arguments/"+strconv.FormatInt(id, 10), strings.NewReader(payload)))
 	assert.Equal(t, http.StatusBadRequest, rr.Code, "body: %s", rr.Body.String())
-	assert.Equal(t, "text/plain; charset=utf-8", rr.Header().Get("Content-Type"))
+	assert.Equal(t, problems.ContentType, rr.Header().Get("Content-Type"))
 }
@@ -2,9 +2,14 @@ package memory
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/wikisophia/api/server/arguments"
 )
@@ -12,31 +17,33 @@ import (
 // NewMemoryStore returns an in-memory implementation of a Store.
 //
 // This is used when testing other parts of the app so that those tests don't
-// need to rely on a database.
-//
-// TODO #11: This should be threadsafe. It's not a huge deal yet because this
-// is used for tests & development... but might cause some false positives.
+// need to rely on a database. It's safe for concurrent use.
 func NewMemoryStore() *InMemoryStore {
 	// Populate the arguments value with a "dummy" arg, since versions start at 1.
 	// The implementation is just a bit simpler if we start the real data at index 1 too.
 	return &InMemoryStore{
-		nextID:    0,
 		arguments: make([][]arguments.Argument, 1),
+		deletedAt: make(map[int64]time.Time),
 	}
 }
 
 // InMemoryStore saves arguments in program memory.
 // This is mainly intended for testing and easier dev environment setups.
 type InMemoryStore struct {
-	nextID    int64
+	mutex     sync.RWMutex
 	arguments [][]arguments.Argument
+	// deletedAt has the deleted arguments' IDs. Their versions stay in arguments, so that they can be exported.
+	deletedAt map[int64]time.Time
 }
 
 // Delete deletes an argument (and all its versions) from the site.
 // If the argument didn't exist, the error will be a NotFoundError.
 func (s *InMemoryStore) Delete(ctx context.Context, id int64) error {
-	if id > 0 && id < int64(len(s.arguments)) {
-		s.arguments[id] = nil
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	// Deleting an argument twice isn't an error, like in the SQL stores.
+	if id > 0 && id < int64(len(s.arguments)) && s.arguments[id] != nil {
+		s.deletedAt[id] = time.Now().UTC()
 		return nil
 	}
 	return &arguments.NotFoundError{
@@ -47,6 +54,8 @@ func (s *InMemoryStore) Delete(ctx context.Context, id int64) error {
 // FetchVersion should return a particular version of an argument.
 // If the the argument didn't exist, the error should be an NotFoundError.
 func (s *InMemoryStore) FetchVersion(ctx context.Context, id int64, version int) (arguments.Argument, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
 	if !s.argumentExists(id) {
 		return arguments.Argument{}, &arguments.NotFoundError{
 			Message: fmt.Sprintf("argument with id %d does not exist", id),
@@ -64,6 +73,8 @@ func (s *InMemoryStore) FetchVersion(ctx context.Context, id int64, version int)
 // FetchLive should return the latest "active" version of an argument.
 // If no argument with this ID exists, the error should be an NotFoundError.
 func (s *InMemoryStore) FetchLive(ctx context.Context, id int64) (arguments.Argument, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
 	if !s.argumentExists(id) {
 		return arguments.Argument{}, &arguments.NotFoundError{
 			Message: fmt.Sprintf("argument with id %d does not exist", id),
@@ -79,10 +90,12 @@ func (s *InMemoryStore) FetchLive(ctx context.Context, id int64) (arguments.Argu
 // FetchSome returns all the "live" arguments matching the given options.
 // If none exist, error will be nil and the slice empty.
 func (s *InMemoryStore) FetchSome(ctx context.Context, options arguments.FetchSomeOptions) ([]arguments.Argument, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
 	args := make([]arguments.Argument, 0, 20)
 	numSkipped := 0
 	for i := 1; i < len(s.arguments); i++ {
-		if containsInt64(options.Exclude, int64(i)) {
+		if !s.argumentExists(int64(i)) || containsInt64(options.Exclude, int64(i)) {
 			continue
 		}
 		if options.Conclusion != "" && options.Conclusion != s.arguments[i][len(s.arguments[i])-1].Conclusion {
@@ -104,6 +117,25 @@ func (s *InMemoryStore) FetchSome(ctx context.Context, options arguments.FetchSo
 	return args, nil
 }
 
+// FetchAuthored returns every version which the account wrote, ordered by argument ID and then by version.
+func (s *InMemoryStore) FetchAuthored(ctx context.Context, authorID int64) ([]arguments.Argument, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	authored := make([]arguments.Argument, 0)
+	for id, versions := range s.arguments {
+		if !s.argumentExists(int64(id)) {
+			continue
+		}
+		// The 0th version is a copy of the 1st, so it's skipped.
+		for i := 1; i < len(versions); i++ {
+			if versions[i].AuthorID == authorID {
+				authored = append(authored, versions[i])
+			}
+		}
+	}
+	return authored, nil
+}
+
 func containsAll(text string, elements []string) bool {
 	for _, element := range elements {
 		if !strings.Contains(text, element) {
@@ -116,8 +148,11 @@ func containsAll(text string, elements []string) bool {
 // Save stores an argument and returns that argument's ID.
 // The ID on the input argument will be ignored.
 func (s *InMemoryStore) Save(ctx context.Context, argument arguments.Argument) (id int64, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 	argument.ID = int64(len(s.arguments))
 	argument.Version = 1
+	argument.Premises = copyStrings(argument.Premises)
 	s.arguments = append(s.arguments, []arguments.Argument{
 		argument, // Add this twice because the 0th index will be ignored by Fetches
 		argument,
@@ -128,18 +163,164 @@ func (s *InMemoryStore) Save(ctx context.Context, argument arguments.Argument) (
 // Update makes a new version of the argument. It returns the new argument's version.
 // If no argument with this ID exists, the returned error is an NotFoundError.
 func (s *InMemoryStore) Update(ctx context.Context, argument arguments.Argument) (version int, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 	if !s.argumentExists(argument.ID) {
 		return -1, &arguments.NotFoundError{
 			Message: fmt.Sprintf("argument with id %d does not exist", argument.ID),
 		}
 	}
 	argument.Version = len(s.arguments[argument.ID])
+	argument.Premises = copyStrings(argument.Premises)
 	s.arguments[argument.ID] = append(s.arguments[argument.ID], argument)
 	return argument.Version, nil
 }
 
+// ExportArguments returns every argument, including deleted ones, ordered by ID.
+func (s *InMemoryStore) ExportArguments(ctx context.Context) ([]arguments.StoredArgument, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	exported := make([]arguments.StoredArgument, 0, len(s.arguments))
+	for id, versions := range s.arguments {
+		// Index 0 is the dummy argument. Nil entries are IDs which were never used.
+		if versions == nil {
+			continue
+		}
+		stored := arguments.StoredArgument{
+			ID:       int64(id),
+			Versions: make([]arguments.Argument, 0, len(versions)-1),
+		}
+		for _, version := range versions[1:] {
+			version.Premises = copyStrings(version.Premises)
+			stored.Versions = append(stored.Versions, version)
+		}
+		if deletedAt, ok := s.deletedAt[int64(id)]; ok {
+			stored.DeletedAt = &deletedAt
+		}
+		exported = append(exported, stored)
+	}
+	return exported, nil
+}
+
+// ImportArguments saves the arguments with the IDs, versions and authors they had in another Store.
+// If this store already has arguments, it returns a *StoreNotEmptyError.
+func (s *InMemoryStore) ImportArguments(ctx context.Context, imported []arguments.StoredArgument) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(s.arguments) > 1 {
+		return &arguments.StoreNotEmptyError{}
+	}
+	sorted := append([]arguments.StoredArgument(nil), imported...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].ID < sorted[j].ID
+	})
+	// Everything is checked before anything is saved, so that a bad import leaves the store empty.
+	restored := make([][]arguments.Argument, 1)
+	deletedAt := make(map[int64]time.Time)
+	for _, stored := range sorted {
+		if stored.ID < int64(len(restored)) {
+			return fmt.Errorf("argument %d was imported twice, or has an invalid ID", stored.ID)
+		}
+		if len(stored.Versions) == 0 {
+			return fmt.Errorf("argument %d has no versions", stored.ID)
+		}
+		for int64(len(restored)) < stored.ID {
+			restored = append(restored, nil)
+		}
+		versions := make([]arguments.Argument, 0, len(stored.Versions)+1)
+		for i, version := range stored.Versions {
+			version.ID = stored.ID
+			version.Version = i + 1
+			version.Premises = copyStrings(version.Premises)
+			versions = append(versions, version)
+		}
+		// The 0th version is a copy of the 1st, like in Save.
+		restored = append(restored, append(versions[:1:1], versions...))
+		if stored.DeletedAt != nil {
+			deletedAt[stored.ID] = *stored.DeletedAt
+		}
+	}
+	s.arguments = restored
+	s.deletedAt = deletedAt
+	return nil
+}
+
+// WriteSnapshot writes everything in the store to w, so that ReadSnapshot can restore it later.
+func (s *InMemoryStore) WriteSnapshot(w io.Writer) error {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	written := make([][]snapshotVersion, len(s.arguments))
+	for id, versions := range s.arguments {
+		if versions == nil {
+			continue
+		}
+		written[id] = make([]snapshotVersion, len(versions))
+		for i, version := range versions {
+			written[id][i] = snapshotVersion{Argument: version, AuthorID: version.AuthorID}
+		}
+	}
+	deleted := make(map[int64]time.Time, len(s.deletedAt))
+	for id, at := range s.deletedAt {
+		deleted[id] = at
+	}
+	return json.NewEncoder(w).Encode(snapshot{
+		Arguments: written,
+		Deleted:   deleted,
+	})
+}
+
+// ReadSnapshot replaces everything in the store with the data from a WriteSnapshot call.
+func (s *InMemoryStore) ReadSnapshot(r io.Reader) error {
+	var read snapshot
+	if err := json.NewDecoder(r).Decode(&read); err != nil {
+		return fmt.Errorf("failed to read arguments snapshot: %v", err)
+	}
+	restored := make([][]arguments.Argument, len(read.Arguments))
+	if len(restored) == 0 {
+		restored = make([][]arguments.Argument, 1)
+	}
+	for id, versions := range read.Arguments {
+		if versions == nil {
+			continue
+		}
+		restored[id] = make([]arguments.Argument, len(versions))
+		for i, version := range versions {
+			restored[id][i] = version.Argument
+			restored[id][i].AuthorID = version.AuthorID
+		}
+	}
+	deletedAt := read.Deleted
+	if deletedAt == nil {
+		deletedAt = make(map[int64]time.Time)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.arguments = restored
+	s.deletedAt = deletedAt
+	return nil
+}
+
+// snapshot is the file format used by WriteSnapshot and ReadSnapshot.
+// IDs which were never used are saved as nulls. Older snapshots saved deleted arguments that way too.
+type snapshot struct {
+	Arguments [][]snapshotVersion `json:"arguments"`
+	// Deleted maps the deleted arguments' IDs to the times they were deleted.
+	Deleted map[int64]time.Time `json:"deleted,omitempty"`
+}
+
+// snapshotVersion is one version of an argument. It saves the AuthorID too,
+// which arguments.Argument leaves out of its JSON.
+type snapshotVersion struct {
+	arguments.Argument
+	AuthorID int64 `json:"authorId,omitempty"`
+}
+
 func (s *InMemoryStore) argumentExists(id int64) bool {
-	return int64(len(s.arguments)) > id && s.arguments[id] != nil
+	if id <= 0 || int64(len(s.arguments)) <= id || s.arguments[id] == nil {
+		return false
+	}
+	_, deleted := s.deletedAt[id]
+	return !deleted
 }
 
 func containsInt64(s []int64, e int64) bool {
@@ -150,3 +331,8 @@ func containsInt64(s []int64, e int64) bool {
 	}
 	return false
 }
+
+// copyStrings keeps the store's data from changing if the caller reuses their slice.
+func copyStrings(values []string) []string {
+	return append([]string(nil), values...)
+}
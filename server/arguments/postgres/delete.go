@@ -6,12 +6,16 @@ import (
 	"time"
 
 	"github.com/wikisophia/api/server/arguments"
+	wikisophiaPostgres "github.com/wikisophia/api/server/postgres"
+	"github.com/wikisophia/api/server/tracing"
 )
 
 const deleteQuery = `UPDATE arguments SET deleted_on = $1 WHERE id = $2 RETURNING id;`
 
 // Delete soft deletes an argument by ID.
-func (store *PostgresStore) Delete(ctx context.Context, id int64) error {
+func (store *PostgresStore) Delete(ctx context.Context, id int64) (err error) {
+	ctx, span := wikisophiaPostgres.StartSpan(ctx, store.pool, "arguments.PostgresStore.Delete")
+	defer func() { tracing.End(span, err) }()
 	rows, err := store.pool.Query(ctx, deleteQuery, time.Now(), id)
 	if err != nil {
 		return err
@@ -0,0 +1,145 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/wikisophia/api/server/arguments"
+	wikisophiaPostgres "github.com/wikisophia/api/server/postgres"
+	"github.com/wikisophia/api/server/tracing"
+)
+
+const exportArgumentsQuery = `
+SELECT arguments.id, arguments.deleted_on, argument_versions.argument_version, argument_versions.author_id, conclusions.claim, premises.claim
+FROM arguments
+	INNER JOIN argument_versions ON arguments.id = argument_versions.argument_id
+	INNER JOIN claims conclusions ON conclusions.id = argument_versions.conclusion_id
+	LEFT JOIN argument_premises ON argument_premises.argument_version_id = argument_versions.id
+	LEFT JOIN claims premises ON premises.id = argument_premises.premise_id
+ORDER BY arguments.id, argument_versions.argument_version, argument_premises.id;
+`
+
+const hasArgumentsQuery = `SELECT EXISTS (SELECT 1 FROM arguments);`
+
+const importArgumentQuery = `INSERT INTO arguments (id, deleted_on) VALUES ($1, $2);`
+
+const importArgumentVersionQuery = `
+INSERT INTO argument_versions
+	(argument_id, argument_version, conclusion_id, author_id) VALUES
+	($1, $2, $3, $4)
+RETURNING id;
+`
+
+// Imported rows set their IDs explicitly, so the sequence needs to skip past them
+// or else the next Save() call would collide with an imported argument.
+const resyncArgumentIDsQuery = `
+SELECT setval(pg_get_serial_sequence('arguments', 'id'), GREATEST(MAX(id), 1))
+FROM arguments;
+`
+
+const importArgumentsErrorMsg = "failed to import arguments"
+
+// ExportArguments returns every argument, including deleted ones, ordered by ID.
+func (store *PostgresStore) ExportArguments(ctx context.Context) (exported []arguments.StoredArgument, err error) {
+	ctx, span := wikisophiaPostgres.StartSpan(ctx, store.pool, "arguments.PostgresStore.ExportArguments")
+	defer func() { tracing.End(span, err) }()
+	rows, err := store.pool.Query(ctx, exportArgumentsQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export arguments: %v", err)
+	}
+	defer rows.Close()
+
+	exported = make([]arguments.StoredArgument, 0)
+	for rows.Next() {
+		var id int64
+		var deletedAt *time.Time
+		var version int
+		var authorID *int64
+		var conclusion string
+		var premise *string
+		if err := rows.Scan(&id, &deletedAt, &version, &authorID, &conclusion, &premise); err != nil {
+			return nil, fmt.Errorf("export result scan failed: %v", err)
+		}
+		if len(exported) == 0 || exported[len(exported)-1].ID != id {
+			exported = append(exported, arguments.StoredArgument{
+				ID:        id,
+				DeletedAt: deletedAt,
+			})
+		}
+		last := &exported[len(exported)-1]
+		if len(last.Versions) == 0 || last.Versions[len(last.Versions)-1].Version != version {
+			last.Versions = append(last.Versions, arguments.Argument{
+				ID:         id,
+				Version:    version,
+				Conclusion: conclusion,
+				AuthorID:   authorOrZero(authorID),
+			})
+		}
+		if premise != nil {
+			lastVersion := &last.Versions[len(last.Versions)-1]
+			lastVersion.Premises = append(lastVersion.Premises, *premise)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to export arguments: %v", err)
+	}
+	return exported, nil
+}
+
+// ImportArguments saves the arguments with the IDs, versions and authors they had in another Store.
+// If this store already has arguments, it returns a *StoreNotEmptyError.
+func (store *PostgresStore) ImportArguments(ctx context.Context, imported []arguments.StoredArgument) (err error) {
+	ctx, span := wikisophiaPostgres.StartSpan(ctx, store.pool, "arguments.PostgresStore.ImportArguments")
+	defer func() { tracing.End(span, err) }()
+	transaction, err := wikisophiaPostgres.BeginTx(ctx, store.pool)
+	if err != nil {
+		return fmt.Errorf("%s: %v", importArgumentsErrorMsg, err)
+	}
+	// This does nothing once the transaction is committed.
+	defer transaction.Rollback(ctx)
+
+	var exists bool
+	if err := transaction.QueryRow(ctx, hasArgumentsQuery).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to check for existing arguments: %v", err)
+	}
+	if exists {
+		return &arguments.StoreNotEmptyError{}
+	}
+	for _, argument := range imported {
+		if err := store.importArgument(ctx, transaction, argument); err != nil {
+			return fmt.Errorf("failed to import argument %d: %v", argument.ID, err)
+		}
+	}
+	if _, err := transaction.Exec(ctx, resyncArgumentIDsQuery); err != nil {
+		return fmt.Errorf("failed to resync the argument ID sequence: %v", err)
+	}
+	if err := transaction.Commit(ctx); err != nil {
+		return fmt.Errorf("%s: %v", importArgumentsErrorMsg, err)
+	}
+	return nil
+}
+
+// importArgument saves one argument and all its versions as part of an import.
+func (store *PostgresStore) importArgument(ctx context.Context, tx pgx.Tx, argument arguments.StoredArgument) (err error) {
+	ctx, span := tracing.Start(ctx, "arguments.PostgresStore.importArgument")
+	defer func() { tracing.End(span, err) }()
+	if _, err := tx.Exec(ctx, importArgumentQuery, argument.ID, argument.DeletedAt); err != nil {
+		return err
+	}
+	for i, version := range argument.Versions {
+		conclusionID, err := store.saveClaim(ctx, tx, version.Conclusion)
+		if err != nil {
+			return err
+		}
+		var versionID int64
+		if err := tx.QueryRow(ctx, importArgumentVersionQuery, argument.ID, i+1, conclusionID, nullableAuthor(version.AuthorID)).Scan(&versionID); err != nil {
+			return fmt.Errorf("failed to save version %d: %v", i+1, err)
+		}
+		if err := store.savePremises(ctx, tx, versionID, version.Premises); err != nil {
+			return err
+		}
+	}
+	return nil
+}
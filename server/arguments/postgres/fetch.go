@@ -10,10 +10,12 @@ import (
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"github.com/wikisophia/api/server/arguments"
+	wikisophiaPostgres "github.com/wikisophia/api/server/postgres"
+	"github.com/wikisophia/api/server/tracing"
 )
 
 const fetchQuery = `
-(SELECT claims.claim, argument_versions.argument_version AS argument_version, argument_premises.id AS o
+(SELECT claims.claim, argument_versions.argument_version AS argument_version, argument_versions.author_id, argument_premises.id AS o
 FROM claims
 	INNER JOIN argument_premises ON claims.id = argument_premises.premise_id
 	INNER JOIN argument_versions ON argument_premises.argument_version_id = argument_versions.id
@@ -22,7 +24,7 @@ WHERE arguments.id = $1
 	AND arguments.deleted_on IS NULL
 	AND argument_versions.argument_version = $2)
 UNION ALL
-(SELECT claims.claim, argument_versions.argument_version AS argument_version, -1 AS o
+(SELECT claims.claim, argument_versions.argument_version AS argument_version, argument_versions.author_id, -1 AS o
 FROM claims
 	INNER JOIN argument_versions ON claims.id = argument_versions.conclusion_id
 	INNER JOIN arguments ON arguments.id = argument_versions.argument_id
@@ -33,7 +35,7 @@ ORDER BY o;
 `
 
 const fetchLiveQuery = `
-(SELECT claims.claim, argument_versions.argument_version AS argument_version, argument_premises.id AS o
+(SELECT claims.claim, argument_versions.argument_version AS argument_version, argument_versions.author_id, argument_premises.id AS o
 	FROM claims
 		INNER JOIN argument_premises ON claims.id = argument_premises.premise_id
 		INNER JOIN argument_versions ON argument_premises.argument_version_id = argument_versions.id
@@ -44,7 +46,7 @@ const fetchLiveQuery = `
 		AND arguments.deleted_on IS NULL
 		AND argument_versions.argument_id = $1)
 UNION ALL
-(SELECT claims.claim, argument_versions.argument_version AS argument_version, -1 AS o
+(SELECT claims.claim, argument_versions.argument_version AS argument_version, argument_versions.author_id, -1 AS o
 	FROM claims
 		INNER JOIN argument_versions ON claims.id = argument_versions.conclusion_id
 		INNER JOIN arguments ON arguments.id = argument_versions.argument_id
@@ -56,8 +58,26 @@ UNION ALL
 ORDER BY o;
 `
 
+const fetchAuthoredQuery = `
+WITH authored AS (
+	SELECT arguments.id, argument_versions.argument_version, argument_versions.id AS argument_version_id, claims.claim AS conclusion
+	FROM argument_versions
+		INNER JOIN arguments ON arguments.id = argument_versions.argument_id
+		INNER JOIN claims ON argument_versions.conclusion_id = claims.id
+	WHERE argument_versions.author_id = $1
+		AND arguments.deleted_on IS NULL
+)
+SELECT authored.id, authored.argument_version, authored.conclusion, claims.claim AS premise
+FROM authored
+	INNER JOIN argument_premises ON authored.argument_version_id = argument_premises.argument_version_id
+	INNER JOIN claims ON claims.id = argument_premises.premise_id
+ORDER BY authored.id, authored.argument_version, argument_premises.id;
+`
+
 // FetchVersion fetches a specific version of an argument.
-func (store *PostgresStore) FetchVersion(ctx context.Context, id int64, version int) (arguments.Argument, error) {
+func (store *PostgresStore) FetchVersion(ctx context.Context, id int64, version int) (argument arguments.Argument, err error) {
+	ctx, span := wikisophiaPostgres.StartSpan(ctx, store.pool, "arguments.PostgresStore.FetchVersion")
+	defer func() { tracing.End(span, err) }()
 	rows, err := store.pool.Query(ctx, fetchQuery, id, version)
 	if err != nil {
 		return arguments.Argument{}, fmt.Errorf("argument fetch query failed: %v", err)
@@ -69,7 +89,9 @@ func (store *PostgresStore) FetchVersion(ctx context.Context, id int64, version
 // FetchLive fetches the "active" version of an argument.
 // This is usually the newest one, but it may not be if an
 // update has been reverted.
-func (store *PostgresStore) FetchLive(ctx context.Context, id int64) (arguments.Argument, error) {
+func (store *PostgresStore) FetchLive(ctx context.Context, id int64) (argument arguments.Argument, err error) {
+	ctx, span := wikisophiaPostgres.StartSpan(ctx, store.pool, "arguments.PostgresStore.FetchLive")
+	defer func() { tracing.End(span, err) }()
 	rows, err := store.pool.Query(ctx, fetchLiveQuery, id)
 	if err != nil {
 		return arguments.Argument{}, fmt.Errorf("argument fetch query failed: %v", err)
@@ -81,13 +103,14 @@ func (store *PostgresStore) FetchLive(ctx context.Context, id int64) (arguments.
 func (store *PostgresStore) parseFetchResults(id int64, rows pgx.Rows) (arguments.Argument, error) {
 	var claim string
 	var version int
+	var authorID *int64
 	var dummy int
 
 	var conclusion string
 	var premises []string
 
 	for rows.Next() {
-		if err := rows.Scan(&claim, &version, &dummy); err != nil {
+		if err := rows.Scan(&claim, &version, &authorID, &dummy); err != nil {
 			return arguments.Argument{}, fmt.Errorf("fetch result scan failed: %v", err)
 		}
 		if conclusion == "" {
@@ -106,14 +129,60 @@ func (store *PostgresStore) parseFetchResults(id int64, rows pgx.Rows) (argument
 		Version:    version,
 		Conclusion: conclusion,
 		Premises:   premises,
+		AuthorID:   authorOrZero(authorID),
 	}, nil
 }
 
+// FetchAuthored returns every version which the account wrote, ordered by argument ID and then by version.
+func (store *PostgresStore) FetchAuthored(ctx context.Context, authorID int64) (authored []arguments.Argument, err error) {
+	ctx, span := wikisophiaPostgres.StartSpan(ctx, store.pool, "arguments.PostgresStore.FetchAuthored")
+	defer func() { tracing.End(span, err) }()
+	rows, err := store.pool.Query(ctx, fetchAuthoredQuery, authorID)
+	if err != nil {
+		return nil, fmt.Errorf("authored arguments fetch query failed: %v", err)
+	}
+	defer rows.Close()
+
+	authored = make([]arguments.Argument, 0)
+	var id int64
+	var version int
+	var conclusion, premise string
+	for rows.Next() {
+		if err := rows.Scan(&id, &version, &conclusion, &premise); err != nil {
+			return nil, fmt.Errorf("fetch result scan failed: %v", err)
+		}
+		if len(authored) == 0 || authored[len(authored)-1].ID != id || authored[len(authored)-1].Version != version {
+			authored = append(authored, arguments.Argument{
+				ID:         id,
+				Version:    version,
+				Conclusion: conclusion,
+				AuthorID:   authorID,
+			})
+		}
+		last := &authored[len(authored)-1]
+		last.Premises = append(last.Premises, premise)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("authored arguments fetch query failed: %v", err)
+	}
+	return authored, nil
+}
+
+// authorOrZero reads an author_id column, which is NULL for anonymous versions.
+func authorOrZero(authorID *int64) int64 {
+	if authorID == nil {
+		return 0
+	}
+	return *authorID
+}
+
 // FetchSome returns all the "live" arguments matching the given options.
 // If none exist, error will be nil and the slice empty.
-func (store *PostgresStore) FetchSome(ctx context.Context, options arguments.FetchSomeOptions) ([]arguments.Argument, error) {
+func (store *PostgresStore) FetchSome(ctx context.Context, options arguments.FetchSomeOptions) (fetched []arguments.Argument, err error) {
+	ctx, span := wikisophiaPostgres.StartSpan(ctx, store.pool, "arguments.PostgresStore.FetchSome")
+	defer func() { tracing.End(span, err) }()
 	// TODO: StringBuilder this
-	selectArgumentsQuery := `SELECT arguments.id, argument_versions.argument_version, argument_versions.id AS argument_version_id, claims.claim AS conclusion
+	selectArgumentsQuery := `SELECT arguments.id, argument_versions.argument_version, argument_versions.id AS argument_version_id, argument_versions.author_id, claims.claim AS conclusion
 	FROM arguments
 		INNER JOIN argument_versions ON arguments.id = argument_versions.argument_id
 		INNER JOIN claims ON argument_versions.conclusion_id = claims.id
@@ -164,7 +233,7 @@ func (store *PostgresStore) FetchSome(ctx context.Context, options arguments.Fet
 	fetchAllQuery := `WITH chosen_arguments AS (`
 	fetchAllQuery += selectArgumentsQuery
 	fetchAllQuery += ") \n"
-	fetchAllQuery += `SELECT chosen_arguments.id, chosen_arguments.argument_version, chosen_arguments.conclusion, claims.claim AS premise
+	fetchAllQuery += `SELECT chosen_arguments.id, chosen_arguments.argument_version, chosen_arguments.author_id, chosen_arguments.conclusion, claims.claim AS premise
 	FROM chosen_arguments
 		INNER JOIN argument_premises ON chosen_arguments.argument_version_id = argument_premises.argument_version_id
 		INNER JOIN claims ON claims.id = argument_premises.premise_id
@@ -180,10 +249,11 @@ func (store *PostgresStore) FetchSome(ctx context.Context, options arguments.Fet
 	args := make(map[int64]*arguments.Argument, 10)
 	var id int64
 	var version int
+	var authorID *int64
 	var conclusion string
 	var premise string
 	for rows.Next() {
-		if err := rows.Scan(&id, &version, &conclusion, &premise); err != nil {
+		if err := rows.Scan(&id, &version, &authorID, &conclusion, &premise); err != nil {
 			return nil, fmt.Errorf("fetch result scan failed: %v", err)
 		}
 		if val, ok := args[id]; ok {
@@ -196,6 +266,7 @@ func (store *PostgresStore) FetchSome(ctx context.Context, options arguments.Fet
 				Premises:   premises,
 				ID:         id,
 				Version:    version,
+				AuthorID:   authorOrZero(authorID),
 			}
 		}
 	}
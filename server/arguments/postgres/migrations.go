@@ -0,0 +1,23 @@
+package postgres
+
+import (
+	"embed"
+	"io/fs"
+
+	"github.com/wikisophia/api/server/migrations"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// RoleVariable is the psql-style variable which the migrations use to refer to the app's database role.
+const RoleVariable = ":argumentsUser"
+
+// Migrations returns the schema migrations for the arguments database, in order.
+func Migrations() ([]migrations.Migration, error) {
+	dir, err := fs.Sub(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	return migrations.Load(dir)
+}
@@ -1,12 +1,6 @@
 /**
  * This file deletes all the database structures which were created
- * in create.sql.
- *
- * This file is run once for integration tests, immediately before
- * create.sql is run. All statements here must be guarded by IF EXISTS
- * clauses so that they can be run on an empty database without errors.
- *
- * It should be kept in sync with create.sql and empty.sql.
+ * in 0001_create_arguments.up.sql.
  */
 
 DROP INDEX IF EXISTS argument_premises_premise_idx;
@@ -0,0 +1,4 @@
+-- Record which account wrote each version, so that accounts can export what they wrote.
+ALTER TABLE argument_versions ADD COLUMN author_id bigint;
+COMMENT ON COLUMN argument_versions.author_id IS 'The account which wrote this version. This is null if nobody was logged in.';
+CREATE INDEX argument_versions_author_idx ON argument_versions (author_id) WHERE author_id IS NOT NULL;
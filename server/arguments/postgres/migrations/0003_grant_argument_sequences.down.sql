@@ -0,0 +1,2 @@
+-- Delete the stuff created by 0003_grant_argument_sequences.up.sql
+REVOKE UPDATE ON ALL SEQUENCES IN SCHEMA public FROM :argumentsUser;
@@ -0,0 +1,2 @@
+-- Imports set the arguments' IDs explicitly, so the app needs UPDATE to resync the sequence afterwards.
+GRANT UPDATE ON ALL SEQUENCES IN SCHEMA public TO :argumentsUser;
@@ -7,6 +7,8 @@ import (
 
 	"github.com/jackc/pgx/v4"
 	"github.com/wikisophia/api/server/arguments"
+	wikisophiaPostgres "github.com/wikisophia/api/server/postgres"
+	"github.com/wikisophia/api/server/tracing"
 )
 
 const saveClaimQuery = `
@@ -27,8 +29,8 @@ INSERT INTO arguments DEFAULT VALUES RETURNING id;
 
 const saveArgumentVersionQuery = `
 INSERT INTO argument_versions
-	(argument_id, argument_version, conclusion_id) VALUES
-	($1, 1, $2)
+	(argument_id, argument_version, conclusion_id, author_id) VALUES
+	($1, 1, $2, $3)
 RETURNING id;
 `
 
@@ -42,8 +44,10 @@ const saveArgumentErrorMsg = "failed to save argument"
 
 // Save stores an argument and returns its ID.
 // If the call succeeds, the Version will be 1.
-func (store *PostgresStore) Save(ctx context.Context, argument arguments.Argument) (int64, error) {
-	transaction, err := store.pool.BeginTx(ctx, pgx.TxOptions{})
+func (store *PostgresStore) Save(ctx context.Context, argument arguments.Argument) (id int64, err error) {
+	ctx, span := wikisophiaPostgres.StartSpan(ctx, store.pool, "arguments.PostgresStore.Save")
+	defer func() { tracing.End(span, err) }()
+	transaction, err := wikisophiaPostgres.BeginTx(ctx, store.pool)
 	if err != nil {
 		return -1, fmt.Errorf("%s: %v", saveArgumentErrorMsg, err)
 	}
@@ -55,7 +59,7 @@ func (store *PostgresStore) Save(ctx context.Context, argument arguments.Argumen
 	if didRollback := rollbackIfErr(ctx, transaction, err); didRollback {
 		return -1, fmt.Errorf("%s: %v", saveArgumentErrorMsg, err)
 	}
-	argumentVersionID, err := store.saveArgumentVersion(ctx, transaction, argumentID, 1, conclusionID)
+	argumentVersionID, err := store.saveArgumentVersion(ctx, transaction, argumentID, 1, conclusionID, argument.AuthorID)
 	if didRollback := rollbackIfErr(ctx, transaction, err); didRollback {
 		return -1, fmt.Errorf("%s: %v", saveArgumentErrorMsg, err)
 	}
@@ -71,50 +75,72 @@ func (store *PostgresStore) Save(ctx context.Context, argument arguments.Argumen
 	return argumentID, nil
 }
 
-func (store *PostgresStore) saveClaim(ctx context.Context, tx pgx.Tx, claim string) (int64, error) {
+func (store *PostgresStore) saveClaim(ctx context.Context, tx pgx.Tx, claim string) (id int64, err error) {
+	ctx, span := tracing.Start(ctx, "arguments.PostgresStore.saveClaim")
+	defer func() { tracing.End(span, err) }()
 	row := tx.QueryRow(ctx, saveClaimQuery, claim)
-	var id int64
 	if err := row.Scan(&id); err != nil {
 		return -1, fmt.Errorf("failed to save claim \"%s\": %v", claim, err)
 	}
 	return id, nil
 }
 
-func (store *PostgresStore) saveArgument(ctx context.Context, tx pgx.Tx) (int64, error) {
+func (store *PostgresStore) saveArgument(ctx context.Context, tx pgx.Tx) (id int64, err error) {
+	ctx, span := tracing.Start(ctx, "arguments.PostgresStore.saveArgument")
+	defer func() { tracing.End(span, err) }()
 	row := tx.QueryRow(ctx, saveArgumentQuery)
-	var id int64
 	if err := row.Scan(&id); err != nil {
 		return -1, fmt.Errorf("failed to scan argument ID: %v", err)
 	}
 	return id, nil
 }
 
-func (store *PostgresStore) saveArgumentVersion(ctx context.Context, tx pgx.Tx, argumentID int64, versionID int, conclusionID int64) (int64, error) {
-	row := tx.QueryRow(ctx, saveArgumentVersionQuery, argumentID, conclusionID)
-	var id int64
+func (store *PostgresStore) saveArgumentVersion(ctx context.Context, tx pgx.Tx, argumentID int64, versionID int, conclusionID int64, authorID int64) (id int64, err error) {
+	ctx, span := tracing.Start(ctx, "arguments.PostgresStore.saveArgumentVersion")
+	defer func() { tracing.End(span, err) }()
+	row := tx.QueryRow(ctx, saveArgumentVersionQuery, argumentID, conclusionID, nullableAuthor(authorID))
 	if err := row.Scan(&id); err != nil {
 		return -1, fmt.Errorf("failed to scan argument ID: %v", err)
 	}
 	return id, nil
 }
 
-func (store *PostgresStore) savePremises(ctx context.Context, tx pgx.Tx, argumentVersionID int64, premises []string) error {
+func (store *PostgresStore) savePremises(ctx context.Context, tx pgx.Tx, argumentVersionID int64, premises []string) (err error) {
+	ctx, span := tracing.Start(ctx, "arguments.PostgresStore.savePremises")
+	defer func() { tracing.End(span, err) }()
 	for i := 0; i < len(premises); i++ {
 		claimID, err := store.saveClaim(ctx, tx, premises[i])
 		if err != nil {
 			return fmt.Errorf(`failed to save premise as claim "%s": %v`, premises[i], err)
 		}
 
-		rows, err := tx.Query(ctx, savePremiseQuery, argumentVersionID, claimID)
-		if err != nil {
+		if err := store.savePremise(ctx, tx, argumentVersionID, claimID); err != nil {
 			return fmt.Errorf(`failed to save premise "%s": %v`, premises[i], err)
 		}
-		// Rows need to be closed before making the next query in a transaction.
-		rows.Close()
 	}
 	return nil
 }
 
+func (store *PostgresStore) savePremise(ctx context.Context, tx pgx.Tx, argumentVersionID int64, claimID int64) (err error) {
+	ctx, span := tracing.Start(ctx, "arguments.PostgresStore.savePremise")
+	defer func() { tracing.End(span, err) }()
+	rows, err := tx.Query(ctx, savePremiseQuery, argumentVersionID, claimID)
+	if err != nil {
+		return err
+	}
+	// Rows need to be closed before making the next query in a transaction.
+	rows.Close()
+	return rows.Err()
+}
+
+// nullableAuthor stores anonymous versions' authors as NULL.
+func nullableAuthor(authorID int64) *int64 {
+	if authorID == 0 {
+		return nil
+	}
+	return &authorID
+}
+
 func rollbackIfErr(ctx context.Context, transaction pgx.Tx, err error) bool {
 	if err != nil {
 		if rollbackErr := transaction.Rollback(ctx); rollbackErr != nil {
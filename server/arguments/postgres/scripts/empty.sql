@@ -5,7 +5,7 @@
  * It's designed to be run at the start of every integration test case
  * which uses the database, to clear out state from the previous tests.
  *
- * It should be kept in sync with create.sql and destroy.sql.
+ * It should be kept in sync with the tables created in ../migrations.
  */
 
 DELETE FROM argument_premises;
@@ -1,6 +1,8 @@
 package postgres
 
 import (
+	"context"
+
 	"log"
 
 	"github.com/jackc/pgx/v4/pgxpool"
@@ -18,8 +20,18 @@ func NewPostgresStore(pool *pgxpool.Pool) *PostgresStore {
 	}
 }
 
-// PostgresStore expects that {projectRoot}/postgres/scripts/create.sql
-// has already been run on your database so that the expected schema exists.
+// PostgresStore expects that the Migrations() have already been applied
+// to your database so that the expected schema exists.
 type PostgresStore struct {
 	pool *pgxpool.Pool
 }
+
+// Ping makes sure the database is reachable.
+func (store *PostgresStore) Ping(ctx context.Context) error {
+	conn, err := store.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+	return conn.Conn().Ping(ctx)
+}
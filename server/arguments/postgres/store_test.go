@@ -24,6 +24,16 @@ func TestMain(m *testing.M) {
 	os.Exit(m.Run())
 }
 
+// TestMigrationsLoad makes sure the embedded migration files are all well-formed.
+func TestMigrationsLoad(t *testing.T) {
+	loaded, err := argumentsPostgres.Migrations()
+	require.NoError(t, err)
+	require.NotEmpty(t, loaded)
+	for i, migration := range loaded {
+		require.Equal(t, i+1, migration.Version, "migration versions should have no gaps")
+	}
+}
+
 func TestArgumentStorageIntegration(t *testing.T) {
 	// Only run tests which rely on the database if the database flag is present
 	if !*hasDatabase {
@@ -32,6 +42,12 @@ func TestArgumentStorageIntegration(t *testing.T) {
 
 	cfg := config.MustParse().ArgumentsStore.Postgres
 	pool := postgres.NewPGXPool(cfg)
+	loaded, err := argumentsPostgres.Migrations()
+	require.NoError(t, err)
+	migrationPool := postgres.NewPGXPool(cfg.ForMigrations())
+	_, err = postgres.NewMigrator(migrationPool, cfg.User, loaded, argumentsPostgres.RoleVariable).Up(context.Background())
+	migrationPool.Close()
+	require.NoError(t, err)
 	emptyData, err := ioutil.ReadFile(filepath.Join(".", "scripts", "empty.sql"))
 	require.NoError(t, err)
 	empty := string(emptyData)
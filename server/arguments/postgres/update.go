@@ -7,11 +7,13 @@ import (
 
 	"github.com/jackc/pgx/v4"
 	"github.com/wikisophia/api/server/arguments"
+	wikisophiaPostgres "github.com/wikisophia/api/server/postgres"
+	"github.com/wikisophia/api/server/tracing"
 )
 
 var newArgumentVersionQuery = `
-INSERT INTO argument_versions (argument_id, argument_version, conclusion_id)
-	SELECT argument_id, argument_version + 1, $2
+INSERT INTO argument_versions (argument_id, argument_version, conclusion_id, author_id)
+	SELECT argument_id, argument_version + 1, $2, $3
 		FROM argument_versions
 		WHERE argument_id = $1
 		ORDER BY argument_version DESC
@@ -23,7 +25,9 @@ const updateArgumentErrorMsg = "failed to update argument %d: %v"
 
 // Update saves a new version of an argument.
 func (store *PostgresStore) Update(ctx context.Context, argument arguments.Argument) (version int, err error) {
-	tx, err := store.pool.BeginTx(ctx, pgx.TxOptions{})
+	ctx, span := wikisophiaPostgres.StartSpan(ctx, store.pool, "arguments.PostgresStore.Update")
+	defer func() { tracing.End(span, err) }()
+	tx, err := wikisophiaPostgres.BeginTx(ctx, store.pool)
 	if didRollback := rollbackIfErr(ctx, tx, err); didRollback {
 		return -1, err
 	}
@@ -31,7 +35,7 @@ func (store *PostgresStore) Update(ctx context.Context, argument arguments.Argum
 	if didRollback := rollbackIfErr(ctx, tx, err); didRollback {
 		return -1, err
 	}
-	argumentVersionID, argumentVersion, err := store.newArgumentVersion(ctx, tx, argument.ID, conclusionID)
+	argumentVersionID, argumentVersion, err := store.newArgumentVersion(ctx, tx, argument.ID, conclusionID, argument.AuthorID)
 	if didRollback := rollbackIfErr(ctx, tx, err); didRollback {
 		return -1, err
 	}
@@ -46,8 +50,10 @@ func (store *PostgresStore) Update(ctx context.Context, argument arguments.Argum
 	return argumentVersion, nil
 }
 
-func (store *PostgresStore) newArgumentVersion(ctx context.Context, tx pgx.Tx, argumentID int64, conclusionID int64) (int64, int, error) {
-	row := tx.QueryRow(ctx, newArgumentVersionQuery, argumentID, conclusionID)
+func (store *PostgresStore) newArgumentVersion(ctx context.Context, tx pgx.Tx, argumentID int64, conclusionID int64, authorID int64) (versionID int64, version int, err error) {
+	ctx, span := tracing.Start(ctx, "arguments.PostgresStore.newArgumentVersion")
+	defer func() { tracing.End(span, err) }()
+	row := tx.QueryRow(ctx, newArgumentVersionQuery, argumentID, conclusionID, nullableAuthor(authorID))
 	var argumentVersionID int64
 	var argumentVersion int
 	if err := row.Scan(&argumentVersionID, &argumentVersion); err != nil {
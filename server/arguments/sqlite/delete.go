@@ -0,0 +1,28 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/wikisophia/api/server/arguments"
+)
+
+const deleteQuery = `UPDATE arguments SET deleted_on = CURRENT_TIMESTAMP WHERE id = ?;`
+
+// Delete soft deletes an argument by ID.
+func (store *SQLiteStore) Delete(ctx context.Context, id int64) error {
+	result, err := store.db.ExecContext(ctx, deleteQuery, id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return &arguments.NotFoundError{
+			Message: fmt.Sprintf("argument with id %d does not exist", id),
+		}
+	}
+	return nil
+}
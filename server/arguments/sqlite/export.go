@@ -0,0 +1,164 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/wikisophia/api/server/arguments"
+	"github.com/wikisophia/api/server/sqlite"
+)
+
+const exportVersionsQuery = `
+SELECT arguments.id, arguments.deleted_on, argument_versions.id, argument_versions.argument_version, claims.claim, argument_versions.author_id
+FROM arguments
+	INNER JOIN argument_versions ON arguments.id = argument_versions.argument_id
+	INNER JOIN claims ON claims.id = argument_versions.conclusion_id
+ORDER BY arguments.id, argument_versions.argument_version;
+`
+
+const exportPremisesQuery = `
+SELECT argument_premises.argument_version_id, claims.claim
+FROM argument_premises
+	INNER JOIN claims ON claims.id = argument_premises.premise_id
+ORDER BY argument_premises.id;
+`
+
+const hasArgumentsQuery = `SELECT EXISTS (SELECT 1 FROM arguments);`
+
+// INTEGER PRIMARY KEY columns pick max(id)+1 for new rows,
+// so imported IDs don't need any special handling afterwards.
+const importArgumentQuery = `INSERT INTO arguments (id, deleted_on) VALUES (?, ?);`
+
+const importArgumentVersionQuery = `
+INSERT INTO argument_versions
+	(argument_id, argument_version, conclusion_id, author_id) VALUES
+	(?, ?, ?, ?);
+`
+
+// deletedOnLayout is the format which CURRENT_TIMESTAMP writes to the deleted_on column, in UTC.
+const deletedOnLayout = "2006-01-02 15:04:05"
+
+const importArgumentsErrorMsg = "failed to import arguments"
+
+// ExportArguments returns every argument, including deleted ones, ordered by ID.
+func (store *SQLiteStore) ExportArguments(ctx context.Context) ([]arguments.StoredArgument, error) {
+	rows, err := store.db.QueryContext(ctx, exportVersionsQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export arguments: %v", err)
+	}
+	// The premises are fetched once these rows are closed, so that this doesn't hold two connections at once.
+	type versionIndex struct{ argument, version int }
+	versions := make(map[int64]versionIndex)
+	exported := make([]arguments.StoredArgument, 0)
+	for rows.Next() {
+		var id, versionID int64
+		var deletedOn sql.NullString
+		var authorID sql.NullInt64
+		var version arguments.Argument
+		if err := rows.Scan(&id, &deletedOn, &versionID, &version.Version, &version.Conclusion, &authorID); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("export result scan failed: %v", err)
+		}
+		if len(exported) == 0 || exported[len(exported)-1].ID != id {
+			stored := arguments.StoredArgument{ID: id}
+			if deletedOn.Valid {
+				deletedAt, err := time.ParseInLocation(deletedOnLayout, deletedOn.String, time.UTC)
+				if err != nil {
+					rows.Close()
+					return nil, fmt.Errorf("argument %d has an unreadable deleted_on time: %v", id, err)
+				}
+				stored.DeletedAt = &deletedAt
+			}
+			exported = append(exported, stored)
+		}
+		last := &exported[len(exported)-1]
+		version.ID = id
+		version.AuthorID = authorID.Int64
+		versions[versionID] = versionIndex{len(exported) - 1, len(last.Versions)}
+		last.Versions = append(last.Versions, version)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to export arguments: %v", err)
+	}
+
+	rows, err = store.db.QueryContext(ctx, exportPremisesQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export premises: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var versionID int64
+		var premise string
+		if err := rows.Scan(&versionID, &premise); err != nil {
+			return nil, fmt.Errorf("export result scan failed: %v", err)
+		}
+		if index, ok := versions[versionID]; ok {
+			version := &exported[index.argument].Versions[index.version]
+			version.Premises = append(version.Premises, premise)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to export premises: %v", err)
+	}
+	return exported, nil
+}
+
+// ImportArguments saves the arguments with the IDs, versions and authors they had in another Store.
+// If this store already has arguments, it returns a *StoreNotEmptyError.
+func (store *SQLiteStore) ImportArguments(ctx context.Context, imported []arguments.StoredArgument) error {
+	transaction, err := store.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %v", importArgumentsErrorMsg, err)
+	}
+	var exists bool
+	err = transaction.QueryRowContext(ctx, hasArgumentsQuery).Scan(&exists)
+	if sqlite.RollbackIfErr(transaction, err) {
+		return fmt.Errorf("failed to check for existing arguments: %v", err)
+	}
+	if exists {
+		transaction.Rollback()
+		return &arguments.StoreNotEmptyError{}
+	}
+	for _, argument := range imported {
+		err = importArgument(ctx, transaction, argument)
+		if sqlite.RollbackIfErr(transaction, err) {
+			return fmt.Errorf("failed to import argument %d: %v", argument.ID, err)
+		}
+	}
+	if err := transaction.Commit(); err != nil {
+		return fmt.Errorf("%s: %v", importArgumentsErrorMsg, err)
+	}
+	return nil
+}
+
+// importArgument saves one argument and all its versions as part of an import.
+func importArgument(ctx context.Context, tx *sql.Tx, argument arguments.StoredArgument) error {
+	var deletedOn sql.NullString
+	if argument.DeletedAt != nil {
+		deletedOn = sql.NullString{String: argument.DeletedAt.UTC().Format(deletedOnLayout), Valid: true}
+	}
+	if _, err := tx.ExecContext(ctx, importArgumentQuery, argument.ID, deletedOn); err != nil {
+		return err
+	}
+	for i, version := range argument.Versions {
+		conclusionID, err := saveClaim(ctx, tx, version.Conclusion)
+		if err != nil {
+			return err
+		}
+		result, err := tx.ExecContext(ctx, importArgumentVersionQuery, argument.ID, i+1, conclusionID, nullableAuthor(version.AuthorID))
+		if err != nil {
+			return fmt.Errorf("failed to save version %d: %v", i+1, err)
+		}
+		versionID, err := result.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("failed to save version %d: %v", i+1, err)
+		}
+		if err := savePremises(ctx, tx, versionID, version.Premises); err != nil {
+			return err
+		}
+	}
+	return nil
+}
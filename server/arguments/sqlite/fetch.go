@@ -0,0 +1,234 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/wikisophia/api/server/arguments"
+)
+
+const fetchVersionQuery = `
+SELECT argument_versions.id, argument_versions.argument_version, claims.claim, argument_versions.author_id
+FROM argument_versions
+	INNER JOIN arguments ON arguments.id = argument_versions.argument_id
+	INNER JOIN claims ON claims.id = argument_versions.conclusion_id
+WHERE arguments.id = ?
+	AND arguments.deleted_on IS NULL
+	AND argument_versions.argument_version = ?;
+`
+
+const fetchLiveQuery = `
+SELECT argument_versions.id, argument_versions.argument_version, claims.claim, argument_versions.author_id
+FROM argument_versions
+	INNER JOIN arguments ON arguments.id = argument_versions.argument_id
+	INNER JOIN claims ON claims.id = argument_versions.conclusion_id
+WHERE arguments.id = ?
+	AND arguments.deleted_on IS NULL
+ORDER BY argument_versions.argument_version DESC
+LIMIT 1;
+`
+
+const fetchPremisesQuery = `
+SELECT claims.claim
+FROM argument_premises
+	INNER JOIN claims ON claims.id = argument_premises.premise_id
+WHERE argument_premises.argument_version_id = ?
+ORDER BY argument_premises.id;
+`
+
+const fetchAuthoredQuery = `
+SELECT argument_versions.id, arguments.id, argument_versions.argument_version, claims.claim
+FROM argument_versions
+	INNER JOIN arguments ON arguments.id = argument_versions.argument_id
+	INNER JOIN claims ON claims.id = argument_versions.conclusion_id
+WHERE argument_versions.author_id = ?
+	AND arguments.deleted_on IS NULL
+ORDER BY arguments.id, argument_versions.argument_version;
+`
+
+// FetchVersion fetches a specific version of an argument.
+func (store *SQLiteStore) FetchVersion(ctx context.Context, id int64, version int) (arguments.Argument, error) {
+	return store.fetchOne(ctx, id, store.db.QueryRowContext(ctx, fetchVersionQuery, id, version))
+}
+
+// FetchLive fetches the newest version of an argument.
+func (store *SQLiteStore) FetchLive(ctx context.Context, id int64) (arguments.Argument, error) {
+	return store.fetchOne(ctx, id, store.db.QueryRowContext(ctx, fetchLiveQuery, id))
+}
+
+func (store *SQLiteStore) fetchOne(ctx context.Context, id int64, row *sql.Row) (arguments.Argument, error) {
+	var argumentVersionID int64
+	var authorID sql.NullInt64
+	argument := arguments.Argument{ID: id}
+	if err := row.Scan(&argumentVersionID, &argument.Version, &argument.Conclusion, &authorID); err == sql.ErrNoRows {
+		return arguments.Argument{}, &arguments.NotFoundError{
+			Message: fmt.Sprintf("no argument found with id=%d", id),
+		}
+	} else if err != nil {
+		return arguments.Argument{}, fmt.Errorf("argument fetch query failed: %v", err)
+	}
+	argument.AuthorID = authorID.Int64
+
+	premises, err := store.fetchPremises(ctx, argumentVersionID)
+	if err != nil {
+		return arguments.Argument{}, err
+	}
+	argument.Premises = premises
+	return argument, nil
+}
+
+func (store *SQLiteStore) fetchPremises(ctx context.Context, argumentVersionID int64) ([]string, error) {
+	rows, err := store.db.QueryContext(ctx, fetchPremisesQuery, argumentVersionID)
+	if err != nil {
+		return nil, fmt.Errorf("premises fetch query failed: %v", err)
+	}
+	defer rows.Close()
+	var premises []string
+	for rows.Next() {
+		var premise string
+		if err := rows.Scan(&premise); err != nil {
+			return nil, fmt.Errorf("fetch result scan failed: %v", err)
+		}
+		premises = append(premises, premise)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("premises fetch query failed: %v", err)
+	}
+	return premises, nil
+}
+
+// FetchAuthored returns every version which the account wrote, ordered by argument ID and then by version.
+func (store *SQLiteStore) FetchAuthored(ctx context.Context, authorID int64) ([]arguments.Argument, error) {
+	rows, err := store.db.QueryContext(ctx, fetchAuthoredQuery, authorID)
+	if err != nil {
+		return nil, fmt.Errorf("authored arguments fetch query failed: %v", err)
+	}
+	// The premises are fetched once these rows are closed, so that this doesn't hold two connections at once.
+	var versionIDs []int64
+	authored := make([]arguments.Argument, 0)
+	for rows.Next() {
+		var versionID int64
+		argument := arguments.Argument{AuthorID: authorID}
+		if err := rows.Scan(&versionID, &argument.ID, &argument.Version, &argument.Conclusion); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("fetch result scan failed: %v", err)
+		}
+		versionIDs = append(versionIDs, versionID)
+		authored = append(authored, argument)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("authored arguments fetch query failed: %v", err)
+	}
+
+	for i, versionID := range versionIDs {
+		if authored[i].Premises, err = store.fetchPremises(ctx, versionID); err != nil {
+			return nil, err
+		}
+	}
+	return authored, nil
+}
+
+// FetchSome returns all the "live" arguments matching the given options.
+// If none exist, error will be nil and the slice empty.
+func (store *SQLiteStore) FetchSome(ctx context.Context, options arguments.FetchSomeOptions) ([]arguments.Argument, error) {
+	var query strings.Builder
+	query.WriteString(`SELECT arguments.id, argument_versions.argument_version, claims.claim, argument_versions.author_id, premises.claim
+FROM arguments
+	INNER JOIN argument_versions ON arguments.id = argument_versions.argument_id
+	INNER JOIN claims ON claims.id = argument_versions.conclusion_id
+	INNER JOIN argument_premises ON argument_premises.argument_version_id = argument_versions.id
+	INNER JOIN claims premises ON premises.id = argument_premises.premise_id
+WHERE arguments.id IN (`)
+	params := chooseArguments(&query, options)
+	query.WriteString(`)
+	AND argument_versions.argument_version = (
+		SELECT MAX(argument_version) FROM argument_versions latest WHERE latest.argument_id = arguments.id
+	)
+ORDER BY arguments.id, argument_premises.id;`)
+
+	rows, err := store.db.QueryContext(ctx, query.String(), params...)
+	if err != nil {
+		return nil, fmt.Errorf("failed fetchSome query: %v", err)
+	}
+	defer rows.Close()
+
+	var fetched []arguments.Argument
+	for rows.Next() {
+		var id int64
+		var version int
+		var conclusion, premise string
+		var authorID sql.NullInt64
+		if err := rows.Scan(&id, &version, &conclusion, &authorID, &premise); err != nil {
+			return nil, fmt.Errorf("fetch result scan failed: %v", err)
+		}
+		if len(fetched) == 0 || fetched[len(fetched)-1].ID != id {
+			fetched = append(fetched, arguments.Argument{
+				ID:         id,
+				Version:    version,
+				Conclusion: conclusion,
+				AuthorID:   authorID.Int64,
+			})
+		}
+		last := &fetched[len(fetched)-1]
+		last.Premises = append(last.Premises, premise)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed fetchSome query: %v", err)
+	}
+	if fetched == nil {
+		fetched = []arguments.Argument{}
+	}
+	return fetched, nil
+}
+
+// chooseArguments writes a query which selects the IDs of the arguments that match the options.
+// It returns the query's params.
+func chooseArguments(query *strings.Builder, options arguments.FetchSomeOptions) []interface{} {
+	var params []interface{}
+	query.WriteString(`SELECT arguments.id
+	FROM arguments
+		INNER JOIN argument_versions ON arguments.id = argument_versions.argument_id
+		INNER JOIN claims ON claims.id = argument_versions.conclusion_id
+	WHERE arguments.deleted_on IS NULL
+		AND argument_versions.argument_version = (
+			SELECT MAX(argument_version) FROM argument_versions latest WHERE latest.argument_id = arguments.id
+		)`)
+	if options.Conclusion != "" {
+		query.WriteString("\n\t\tAND claims.claim = ?")
+		params = append(params, options.Conclusion)
+	}
+	if len(options.ConclusionContainsAll) != 0 {
+		query.WriteString("\n\t\tAND claims.id IN (SELECT rowid FROM claims_search WHERE claims_search MATCH ?)")
+		params = append(params, matchAll(options.ConclusionContainsAll))
+	}
+	if len(options.Exclude) != 0 {
+		query.WriteString("\n\t\tAND arguments.id NOT IN (?" + strings.Repeat(", ?", len(options.Exclude)-1) + ")")
+		for _, id := range options.Exclude {
+			params = append(params, id)
+		}
+	}
+	query.WriteString("\n\tORDER BY arguments.id")
+	// SQLite needs a LIMIT to use OFFSET. -1 means "no limit".
+	if options.Count != 0 || options.Offset != 0 {
+		count := options.Count
+		if count == 0 {
+			count = -1
+		}
+		query.WriteString("\n\tLIMIT ? OFFSET ?")
+		params = append(params, count, options.Offset)
+	}
+	return params
+}
+
+// matchAll builds an FTS5 query which matches text containing all the words.
+// Each word is quoted so that FTS5 treats it as a plain string, rather than query syntax.
+func matchAll(words []string) string {
+	quoted := make([]string, len(words))
+	for i, word := range words {
+		quoted[i] = `"` + strings.ReplaceAll(word, `"`, `""`) + `"`
+	}
+	return strings.Join(quoted, " AND ")
+}
@@ -0,0 +1,20 @@
+package sqlite
+
+import (
+	"embed"
+	"io/fs"
+
+	"github.com/wikisophia/api/server/migrations"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Migrations returns the schema migrations for the arguments database, in order.
+func Migrations() ([]migrations.Migration, error) {
+	dir, err := fs.Sub(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	return migrations.Load(dir)
+}
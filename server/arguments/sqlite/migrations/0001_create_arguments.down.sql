@@ -0,0 +1,11 @@
+/**
+ * This file deletes all the database structures which were created
+ * in 0001_create_arguments.up.sql. SQLite drops each table's indexes
+ * and triggers along with it.
+ */
+
+DROP TABLE IF EXISTS argument_premises;
+DROP TABLE IF EXISTS argument_versions;
+DROP TABLE IF EXISTS arguments;
+DROP TABLE IF EXISTS claims_search;
+DROP TABLE IF EXISTS claims;
@@ -0,0 +1,51 @@
+-- Create the stuff inside the arguments database.
+-- This mirrors the Postgres schema, except that search uses an FTS5 index rather than tsvectors.
+CREATE TABLE claims (
+  id INTEGER PRIMARY KEY,
+  claim TEXT UNIQUE NOT NULL CONSTRAINT claim_not_empty CHECK (claim != ''),
+  created_on TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- claims_search indexes the words in each claim, so that arguments can be found by their conclusion.
+-- It stores no text of its own. The triggers keep it in sync with the claims table.
+CREATE VIRTUAL TABLE claims_search USING fts5(
+  claim,
+  content='claims',
+  content_rowid='id',
+  tokenize='porter unicode61'
+);
+CREATE TRIGGER claims_search_insert AFTER INSERT ON claims BEGIN
+  INSERT INTO claims_search (rowid, claim) VALUES (new.id, new.claim);
+END;
+CREATE TRIGGER claims_search_delete AFTER DELETE ON claims BEGIN
+  INSERT INTO claims_search (claims_search, rowid, claim) VALUES ('delete', old.id, old.claim);
+END;
+
+CREATE TABLE arguments (
+  id INTEGER PRIMARY KEY,
+  deleted_on TEXT DEFAULT NULL,
+  created_on TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  last_modified TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TRIGGER update_arguments_last_modified AFTER UPDATE OF deleted_on ON arguments BEGIN
+  UPDATE arguments SET last_modified = CURRENT_TIMESTAMP WHERE id = new.id;
+END;
+
+CREATE TABLE argument_versions (
+  id INTEGER PRIMARY KEY,
+  argument_id INTEGER NOT NULL REFERENCES arguments(id),
+  argument_version INTEGER NOT NULL,
+  conclusion_id INTEGER NOT NULL REFERENCES claims(id),
+  created_on TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE(argument_id, argument_version)
+);
+CREATE INDEX argument_versions_conclusion_idx ON argument_versions (conclusion_id);
+
+CREATE TABLE argument_premises (
+  id INTEGER PRIMARY KEY,
+  argument_version_id INTEGER NOT NULL REFERENCES argument_versions(id),
+  premise_id INTEGER NOT NULL REFERENCES claims(id),
+  created_on TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE(argument_version_id, premise_id)
+);
+CREATE INDEX argument_premises_premise_idx ON argument_premises (premise_id);
@@ -0,0 +1,3 @@
+-- Delete the stuff created by 0002_argument_authors.up.sql
+DROP INDEX argument_versions_author_idx;
+ALTER TABLE argument_versions DROP COLUMN author_id;
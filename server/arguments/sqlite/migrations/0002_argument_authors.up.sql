@@ -0,0 +1,4 @@
+-- Record which account wrote each version, so that accounts can export what they wrote.
+-- Versions written without logging in have no author.
+ALTER TABLE argument_versions ADD COLUMN author_id INTEGER;
+CREATE INDEX argument_versions_author_idx ON argument_versions (author_id) WHERE author_id IS NOT NULL;
@@ -0,0 +1,95 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/wikisophia/api/server/arguments"
+	"github.com/wikisophia/api/server/sqlite"
+)
+
+const insertClaimQuery = `INSERT INTO claims (claim) VALUES (?) ON CONFLICT (claim) DO NOTHING;`
+const selectClaimQuery = `SELECT id FROM claims WHERE claim = ?;`
+const saveArgumentQuery = `INSERT INTO arguments DEFAULT VALUES;`
+
+const saveArgumentVersionQuery = `
+INSERT INTO argument_versions
+	(argument_id, argument_version, conclusion_id, author_id) VALUES
+	(?, 1, ?, ?);
+`
+
+const savePremiseQuery = `
+INSERT INTO argument_premises
+	(argument_version_id, premise_id) VALUES
+	(?, ?);
+`
+
+const saveArgumentErrorMsg = "failed to save argument"
+
+// Save stores an argument and returns its ID.
+// If the call succeeds, the Version will be 1.
+func (store *SQLiteStore) Save(ctx context.Context, argument arguments.Argument) (int64, error) {
+	transaction, err := store.db.BeginTx(ctx, nil)
+	if err != nil {
+		return -1, fmt.Errorf("%s: %v", saveArgumentErrorMsg, err)
+	}
+	conclusionID, err := saveClaim(ctx, transaction, argument.Conclusion)
+	if sqlite.RollbackIfErr(transaction, err) {
+		return -1, fmt.Errorf("%s: %v", saveArgumentErrorMsg, err)
+	}
+	result, err := transaction.ExecContext(ctx, saveArgumentQuery)
+	if sqlite.RollbackIfErr(transaction, err) {
+		return -1, fmt.Errorf("%s: %v", saveArgumentErrorMsg, err)
+	}
+	argumentID, err := result.LastInsertId()
+	if sqlite.RollbackIfErr(transaction, err) {
+		return -1, fmt.Errorf("%s: %v", saveArgumentErrorMsg, err)
+	}
+	result, err = transaction.ExecContext(ctx, saveArgumentVersionQuery, argumentID, conclusionID, nullableAuthor(argument.AuthorID))
+	if sqlite.RollbackIfErr(transaction, err) {
+		return -1, fmt.Errorf("%s: %v", saveArgumentErrorMsg, err)
+	}
+	argumentVersionID, err := result.LastInsertId()
+	if sqlite.RollbackIfErr(transaction, err) {
+		return -1, fmt.Errorf("%s: %v", saveArgumentErrorMsg, err)
+	}
+	err = savePremises(ctx, transaction, argumentVersionID, argument.Premises)
+	if sqlite.RollbackIfErr(transaction, err) {
+		return -1, fmt.Errorf("%s: %v", saveArgumentErrorMsg, err)
+	}
+	if err := transaction.Commit(); err != nil {
+		return -1, fmt.Errorf("%s: %v", saveArgumentErrorMsg, err)
+	}
+	return argumentID, nil
+}
+
+// nullableAuthor stores anonymous versions' authors as NULL.
+func nullableAuthor(authorID int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: authorID, Valid: authorID != 0}
+}
+
+// saveClaim returns the ID of the claim, inserting it if it doesn't exist yet.
+func saveClaim(ctx context.Context, tx *sql.Tx, claim string) (int64, error) {
+	if _, err := tx.ExecContext(ctx, insertClaimQuery, claim); err != nil {
+		return -1, fmt.Errorf("failed to save claim \"%s\": %v", claim, err)
+	}
+	var id int64
+	if err := tx.QueryRowContext(ctx, selectClaimQuery, claim).Scan(&id); err != nil {
+		return -1, fmt.Errorf("failed to scan claim ID for \"%s\": %v", claim, err)
+	}
+	return id, nil
+}
+
+func savePremises(ctx context.Context, tx *sql.Tx, argumentVersionID int64, premises []string) error {
+	for _, premise := range premises {
+		claimID, err := saveClaim(ctx, tx, premise)
+		if err != nil {
+			return fmt.Errorf(`failed to save premise as claim "%s": %v`, premise, err)
+		}
+		if _, err := tx.ExecContext(ctx, savePremiseQuery, argumentVersionID, claimID); err != nil {
+			return fmt.Errorf(`failed to save premise "%s": %v`, premise, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"log"
+)
+
+// NewSQLiteStore returns a Store which is used to save and load Arguments.
+// The returned Store will *not* close the db, since we did not open it.
+func NewSQLiteStore(db *sql.DB) *SQLiteStore {
+	if db == nil {
+		log.Fatal("A database is required to make an arguments.SQLiteStore.")
+	}
+	return &SQLiteStore{
+		db: db,
+	}
+}
+
+// SQLiteStore expects that the Migrations() have already been applied
+// to your database so that the expected schema exists.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// Ping makes sure the database file can still be read.
+func (store *SQLiteStore) Ping(ctx context.Context) error {
+	return store.db.PingContext(ctx)
+}
@@ -0,0 +1,65 @@
+package sqlite_test
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"github.com/wikisophia/api/server/arguments"
+	argumentsSQLite "github.com/wikisophia/api/server/arguments/sqlite"
+	"github.com/wikisophia/api/server/arguments/storetest"
+	"github.com/wikisophia/api/server/sqlite"
+)
+
+// TestMigrationsLoad makes sure the embedded migration files are all well-formed.
+func TestMigrationsLoad(t *testing.T) {
+	loaded, err := argumentsSQLite.Migrations()
+	require.NoError(t, err)
+	require.NotEmpty(t, loaded)
+	for i, migration := range loaded {
+		require.Equal(t, i+1, migration.Version, "migration versions should have no gaps")
+	}
+}
+
+// TestSQLiteStore makes sure the SQLiteStore is consistent with the StoreTests suite.
+// Each test gets a fresh database file, so they don't need any cleanup.
+func TestSQLiteStore(t *testing.T) {
+	loaded, err := argumentsSQLite.Migrations()
+	require.NoError(t, err)
+	dir := t.TempDir()
+	opened := 0
+
+	suite.Run(t, &storetest.StoreTests{
+		StoreFactory: func() arguments.Store {
+			opened++
+			db, err := sqlite.Open(filepath.Join(dir, fmt.Sprintf("arguments-%d.db", opened)))
+			require.NoError(t, err)
+			t.Cleanup(func() { db.Close() })
+			require.NoError(t, sqlite.Migrate(db, loaded))
+			return argumentsSQLite.NewSQLiteStore(db)
+		},
+	})
+}
+
+// TestMigrationsRollBack makes sure the down migrations undo the up ones.
+func TestMigrationsRollBack(t *testing.T) {
+	loaded, err := argumentsSQLite.Migrations()
+	require.NoError(t, err)
+	db, err := sqlite.Open(filepath.Join(t.TempDir(), "arguments.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	require.NoError(t, sqlite.Migrate(db, loaded))
+	migrator := sqlite.NewMigrator(db, loaded)
+	for range loaded {
+		rolledBack, err := migrator.Down(context.Background())
+		require.NoError(t, err)
+		require.NotNil(t, rolledBack)
+	}
+	var tables int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name != 'schema_migrations'").Scan(&tables))
+	require.Zero(t, tables)
+}
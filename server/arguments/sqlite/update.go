@@ -0,0 +1,71 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/wikisophia/api/server/arguments"
+	"github.com/wikisophia/api/server/sqlite"
+)
+
+const newArgumentVersionQuery = `
+INSERT INTO argument_versions (argument_id, argument_version, conclusion_id, author_id)
+	SELECT argument_versions.argument_id, MAX(argument_versions.argument_version) + 1, ?, ?
+		FROM argument_versions
+			INNER JOIN arguments ON arguments.id = argument_versions.argument_id
+		WHERE argument_versions.argument_id = ?
+			AND arguments.deleted_on IS NULL
+		GROUP BY argument_versions.argument_id;
+`
+
+const selectArgumentVersionQuery = `SELECT argument_version FROM argument_versions WHERE id = ?;`
+
+const updateArgumentErrorMsg = "failed to update argument %d: %v"
+
+// Update saves a new version of an argument.
+func (store *SQLiteStore) Update(ctx context.Context, argument arguments.Argument) (int, error) {
+	tx, err := store.db.BeginTx(ctx, nil)
+	if err != nil {
+		return -1, fmt.Errorf(updateArgumentErrorMsg, argument.ID, err)
+	}
+	conclusionID, err := saveClaim(ctx, tx, argument.Conclusion)
+	if sqlite.RollbackIfErr(tx, err) {
+		return -1, fmt.Errorf(updateArgumentErrorMsg, argument.ID, err)
+	}
+	argumentVersionID, argumentVersion, err := newArgumentVersion(ctx, tx, argument.ID, conclusionID, argument.AuthorID)
+	if sqlite.RollbackIfErr(tx, err) {
+		return -1, err
+	}
+	err = savePremises(ctx, tx, argumentVersionID, argument.Premises)
+	if sqlite.RollbackIfErr(tx, err) {
+		return -1, fmt.Errorf(updateArgumentErrorMsg, argument.ID, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return -1, fmt.Errorf(updateArgumentErrorMsg, argument.ID, err)
+	}
+	return argumentVersion, nil
+}
+
+func newArgumentVersion(ctx context.Context, tx *sql.Tx, argumentID int64, conclusionID int64, authorID int64) (int64, int, error) {
+	result, err := tx.ExecContext(ctx, newArgumentVersionQuery, conclusionID, nullableAuthor(authorID), argumentID)
+	if err != nil {
+		return -1, -1, fmt.Errorf(`couldn't create new argument version for id=%d: %v`, argumentID, err)
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return -1, -1, fmt.Errorf(`couldn't create new argument version for id=%d: %v`, argumentID, err)
+	} else if affected == 0 {
+		return -1, -1, &arguments.NotFoundError{
+			Message: fmt.Sprintf("argument %d does not exist", argumentID),
+		}
+	}
+	argumentVersionID, err := result.LastInsertId()
+	if err != nil {
+		return -1, -1, fmt.Errorf(`couldn't create new argument version for id=%d: %v`, argumentID, err)
+	}
+	var argumentVersion int
+	if err := tx.QueryRowContext(ctx, selectArgumentVersionQuery, argumentVersionID).Scan(&argumentVersion); err != nil {
+		return -1, -1, fmt.Errorf(`couldn't read new argument version for id=%d: %v`, argumentID, err)
+	}
+	return argumentVersionID, argumentVersion, nil
+}
@@ -3,12 +3,15 @@ package arguments
 import (
 	"context"
 	"fmt"
+	"time"
 )
 
 // Store combines all the functions needed to read & write Arguments
 // into a single interface.
 type Store interface {
 	Deleter
+	Exporter
+	GetAuthored
 	GetSome
 	GetVersioned
 	GetLive
@@ -30,6 +33,14 @@ type GetSome interface {
 	FetchSome(ctx context.Context, options FetchSomeOptions) ([]Argument, error)
 }
 
+// GetAuthored can find everything an account wrote.
+type GetAuthored interface {
+	// FetchAuthored returns every version which the account wrote, ordered by argument ID and then by version.
+	// Versions of deleted arguments are left out.
+	// If there are none, error will be nil and the slice empty.
+	FetchAuthored(ctx context.Context, authorID int64) ([]Argument, error)
+}
+
 // GetVersioned returns a specific version of an argument.
 type GetVersioned interface {
 	// FetchVersion should return a particular version of an argument.
@@ -47,17 +58,40 @@ type GetLive interface {
 // Saver can save arguments.
 type Saver interface {
 	// Save stores an argument and returns that argument's ID.
-	// The ID on the input argument will be ignored.
+	// The ID on the input argument will be ignored. Its AuthorID is kept with the first version.
 	Save(ctx context.Context, argument Argument) (id int64, err error)
 }
 
 // Updater can update existing arguments.
 type Updater interface {
-	// Update makes a new version of the argument. It returns the new argument's version.
+	// Update makes a new version of the argument, written by its AuthorID. It returns the new argument's version.
 	// If no argument with this ID exists, the returned error is an arguments.NotFoundError.
 	Update(ctx context.Context, argument Argument) (version int, err error)
 }
 
+// Exporter moves arguments in and out of a Store wholesale, with their IDs and edit histories.
+// This is used to back up the data, or copy it between storage backends.
+type Exporter interface {
+	// ExportArguments returns every argument in the Store, including deleted ones, ordered by ID.
+	ExportArguments(ctx context.Context) ([]StoredArgument, error)
+
+	// ImportArguments saves the arguments with the IDs, versions and authors they had in another Store.
+	// Either all of them are saved or none are. Arguments saved afterwards get IDs past the imported ones.
+	//
+	// If the Store already has arguments, it returns a *StoreNotEmptyError and saves nothing.
+	ImportArguments(ctx context.Context, imported []StoredArgument) error
+}
+
+// StoredArgument is everything a Store keeps about one argument.
+type StoredArgument struct {
+	ID int64
+	// Versions has every version of the argument, starting with version 1.
+	Versions []Argument
+	// DeletedAt is when the argument was deleted, or nil if it's still live.
+	// Deleted arguments keep their versions, so that they can be exported too.
+	DeletedAt *time.Time
+}
+
 // FetchSomeOptions has some ways to limit what gets returned when fetching all the arguments.
 type FetchSomeOptions struct {
 	// Conclusion only finds arguments which support a given conclusion
@@ -88,3 +122,11 @@ type NotFoundError struct {
 func (e *NotFoundError) Error() string {
 	return fmt.Sprintf(e.Message, e.Args...)
 }
+
+// StoreNotEmptyError will be returned by Exporter.ImportArguments() calls if the Store already has arguments.
+// Imports keep the arguments' IDs, so they could clash with the ones which are there.
+type StoreNotEmptyError struct{}
+
+func (e *StoreNotEmptyError) Error() string {
+	return "the store already has arguments"
+}
@@ -2,6 +2,9 @@ package storetest
 
 import (
 	"context"
+	"fmt"
+	"sync"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -119,6 +122,26 @@ func (suite *StoreTests) TestDeletedIsUnavailable() {
 	}
 }
 
+// TestFetchSomeSkipsDeleted makes sure deleted arguments don't show up in lists.
+func (suite *StoreTests) TestFetchSomeSkipsDeleted() {
+	store := suite.StoreFactory()
+	arg := acceptancetest.ParseSample(suite.T(), samplesPath+"save-request.json")
+
+	deleted := suite.saveWithUpdates(store, arg)
+	kept := suite.saveWithUpdates(store, arg)
+	if !assert.NoError(suite.T(), store.Delete(context.Background(), deleted)) {
+		return
+	}
+	allArgs, err := store.FetchSome(context.Background(), arguments.FetchSomeOptions{})
+	if !assert.NoError(suite.T(), err) {
+		return
+	}
+	if !assert.Len(suite.T(), allArgs, 1) {
+		return
+	}
+	assert.Equal(suite.T(), kept, allArgs[0].ID)
+}
+
 // TestFetchUnknownReturnsError makes sure the backend returns errors when asked for an unknown ID.
 func (suite *StoreTests) TestFetchUnknownReturnsError() {
 	store := suite.StoreFactory()
@@ -351,6 +374,167 @@ func (suite *StoreTests) TestFetchWithExclusions() {
 	assert.Equal(suite.T(), id3, allArgs[1].ID)
 }
 
+// TestAuthorsRecorded makes sure that each version remembers who wrote it.
+func (suite *StoreTests) TestAuthorsRecorded() {
+	store := suite.StoreFactory()
+	original := acceptancetest.ParseSample(suite.T(), samplesPath+"save-request.json")
+	original.AuthorID = 7
+	updated := acceptancetest.ParseSample(suite.T(), samplesPath+"update-request.json")
+	updated.AuthorID = 8
+	id := suite.saveWithUpdates(store, original, updated)
+	if id == -1 {
+		return
+	}
+
+	first, err := store.FetchVersion(context.Background(), id, 1)
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(7), first.AuthorID)
+	live, err := store.FetchLive(context.Background(), id)
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(8), live.AuthorID)
+	some, err := store.FetchSome(context.Background(), arguments.FetchSomeOptions{})
+	require.NoError(suite.T(), err)
+	require.Len(suite.T(), some, 1)
+	assert.Equal(suite.T(), int64(8), some[0].AuthorID)
+}
+
+// TestFetchAuthored makes sure that FetchAuthored finds every live version which the account wrote, and nothing else.
+func (suite *StoreTests) TestFetchAuthored() {
+	store := suite.StoreFactory()
+	mine := arguments.Argument{Conclusion: "mine", Premises: []string{"p1", "p2"}, AuthorID: 7}
+	anonymous := arguments.Argument{Conclusion: "mine", Premises: []string{"p3", "p4"}}
+	mineAgain := arguments.Argument{Conclusion: "mine", Premises: []string{"p5", "p6"}, AuthorID: 7}
+	edited := suite.saveWithUpdates(store, mine, anonymous, mineAgain)
+	if edited == -1 {
+		return
+	}
+	if suite.saveWithUpdates(store, arguments.Argument{Conclusion: "theirs", Premises: []string{"p7", "p8"}, AuthorID: 8}) == -1 {
+		return
+	}
+	deleted := suite.saveWithUpdates(store, arguments.Argument{Conclusion: "deleted", Premises: []string{"p9", "p10"}, AuthorID: 7})
+	if deleted == -1 {
+		return
+	}
+	require.NoError(suite.T(), store.Delete(context.Background(), deleted))
+
+	authored, err := store.FetchAuthored(context.Background(), 7)
+	require.NoError(suite.T(), err)
+	mine.ID, mine.Version = edited, 1
+	mineAgain.ID, mineAgain.Version = edited, 3
+	assert.Equal(suite.T(), []arguments.Argument{mine, mineAgain}, authored)
+
+	none, err := store.FetchAuthored(context.Background(), 9)
+	require.NoError(suite.T(), err)
+	assert.NotNil(suite.T(), none)
+	assert.Empty(suite.T(), none)
+}
+
+// TestExportImportRoundtrip makes sure that arguments keep their IDs, versions, authors and deletions
+// when they're moved to another Store.
+func (suite *StoreTests) TestExportImportRoundtrip() {
+	source := suite.StoreFactory()
+	edited := suite.saveWithUpdates(source,
+		arguments.Argument{Conclusion: "edited", Premises: []string{"p1", "p2"}, AuthorID: 7},
+		arguments.Argument{Conclusion: "edited", Premises: []string{"p1", "p3"}})
+	deleted := suite.saveWithUpdates(source, arguments.Argument{Conclusion: "deleted", Premises: []string{"p4", "p5"}, AuthorID: 8})
+	last := suite.saveWithUpdates(source, arguments.Argument{Conclusion: "last", Premises: []string{"p6", "p7"}})
+	if edited == -1 || deleted == -1 || last == -1 {
+		return
+	}
+	require.NoError(suite.T(), source.Delete(context.Background(), deleted))
+
+	exported, err := source.ExportArguments(context.Background())
+	require.NoError(suite.T(), err)
+	require.Len(suite.T(), exported, 3)
+	assert.Equal(suite.T(), edited, exported[0].ID)
+	require.Len(suite.T(), exported[0].Versions, 2)
+	assert.Equal(suite.T(), int64(7), exported[0].Versions[0].AuthorID)
+	assert.Equal(suite.T(), []string{"p1", "p3"}, exported[0].Versions[1].Premises)
+	assert.Nil(suite.T(), exported[0].DeletedAt)
+	assert.Equal(suite.T(), deleted, exported[1].ID)
+	require.NotNil(suite.T(), exported[1].DeletedAt)
+	assert.Equal(suite.T(), "deleted", exported[1].Versions[0].Conclusion)
+
+	destination := suite.StoreFactory()
+	require.NoError(suite.T(), destination.ImportArguments(context.Background(), exported))
+	reexported, err := destination.ExportArguments(context.Background())
+	require.NoError(suite.T(), err)
+	require.Len(suite.T(), reexported, 3)
+	for i := range exported {
+		assert.Equal(suite.T(), exported[i].ID, reexported[i].ID)
+		assert.Equal(suite.T(), exported[i].Versions, reexported[i].Versions)
+		if exported[i].DeletedAt == nil {
+			assert.Nil(suite.T(), reexported[i].DeletedAt)
+		} else if assert.NotNil(suite.T(), reexported[i].DeletedAt) {
+			assert.WithinDuration(suite.T(), *exported[i].DeletedAt, *reexported[i].DeletedAt, time.Second)
+		}
+	}
+
+	live, err := destination.FetchLive(context.Background(), edited)
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 2, live.Version)
+	_, err = destination.FetchLive(context.Background(), deleted)
+	require.Error(suite.T(), err)
+	assert.IsType(suite.T(), &arguments.NotFoundError{}, err)
+
+	next, err := destination.Save(context.Background(), arguments.Argument{Conclusion: "next", Premises: []string{"p8", "p9"}})
+	require.NoError(suite.T(), err)
+	assert.Greater(suite.T(), next, last)
+}
+
+// TestImportIntoNonEmptyStoreFails makes sure that imports can't clash with arguments which already exist.
+func (suite *StoreTests) TestImportIntoNonEmptyStoreFails() {
+	store := suite.StoreFactory()
+	id := suite.saveWithUpdates(store, arguments.Argument{Conclusion: "existing", Premises: []string{"p1", "p2"}})
+	if id == -1 {
+		return
+	}
+	err := store.ImportArguments(context.Background(), []arguments.StoredArgument{{
+		ID:       id + 1,
+		Versions: []arguments.Argument{{Conclusion: "imported", Premises: []string{"p3", "p4"}}},
+	}})
+	require.Error(suite.T(), err)
+	assert.IsType(suite.T(), &arguments.StoreNotEmptyError{}, err)
+	_, err = store.FetchLive(context.Background(), id+1)
+	assert.IsType(suite.T(), &arguments.NotFoundError{}, err)
+}
+
+// TestConcurrentWrites makes sure the Store can be used from many goroutines at once,
+// like it will be when serving requests.
+func (suite *StoreTests) TestConcurrentWrites() {
+	store := suite.StoreFactory()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id, err := store.Save(context.Background(), arguments.Argument{
+				Conclusion: fmt.Sprintf("conclusion %d", i),
+				Premises:   []string{"shared premise", fmt.Sprintf("premise %d", i)},
+			})
+			if !assert.NoError(suite.T(), err) {
+				return
+			}
+			_, err = store.Update(context.Background(), arguments.Argument{
+				ID:         id,
+				Conclusion: fmt.Sprintf("conclusion %d", i),
+				Premises:   []string{"shared premise", fmt.Sprintf("new premise %d", i)},
+			})
+			assert.NoError(suite.T(), err)
+			_, err = store.FetchSome(context.Background(), arguments.FetchSomeOptions{})
+			assert.NoError(suite.T(), err)
+		}(i)
+	}
+	wg.Wait()
+
+	fetched, err := store.FetchSome(context.Background(), arguments.FetchSomeOptions{})
+	require.NoError(suite.T(), err)
+	require.Len(suite.T(), fetched, 10)
+	for _, argument := range fetched {
+		assert.Equal(suite.T(), 2, argument.Version)
+	}
+}
+
 func (suite *StoreTests) saveWithUpdates(store arguments.Store, arg arguments.Argument, updates ...arguments.Argument) int64 {
 	id, err := store.Save(context.Background(), arg)
 	if !assert.NoError(suite.T(), err) {
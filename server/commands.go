@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/wikisophia/api/server/config"
+	"github.com/wikisophia/api/server/dump"
+)
+
+// dumpCommand implements "dump FILE"
+func dumpCommand(args []string) error {
+	if len(args) != 1 {
+		return errors.New("expected exactly one argument: the file to write")
+	}
+	cfg := config.MustParse()
+	accountsStore, closeAccounts := newAccountsStore(&cfg, nil)
+	defer closeAccounts()
+	argumentsStore, closeArguments := newArgumentsStore(cfg.ArgumentsStore, nil)
+	defer closeArguments()
+	taken, err := dump.Take(context.Background(), accountsStore, argumentsStore)
+	if err != nil {
+		return err
+	}
+
+	// Dumps have password hashes and two-factor secrets in them, so only the owner can read them.
+	file, err := os.OpenFile(args[0], os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	// OpenFile only sets the mode on new files. This covers dumps over an old backup.
+	if err := file.Chmod(0600); err != nil {
+		file.Close()
+		return err
+	}
+	if err := dump.Write(file, taken); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	log.Printf("Wrote %d accounts and %d arguments to %s", len(taken.Accounts), len(taken.Arguments), args[0])
+	return nil
+}
+
+// restoreCommand implements "restore FILE"
+func restoreCommand(args []string) error {
+	if len(args) != 1 {
+		return errors.New("expected exactly one argument: the file to read")
+	}
+	file, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	read, err := dump.Read(file)
+	if err != nil {
+		return err
+	}
+
+	cfg := config.MustParse()
+	accountsStore, closeAccounts := newAccountsStore(&cfg, nil)
+	defer closeAccounts()
+	argumentsStore, closeArguments := newArgumentsStore(cfg.ArgumentsStore, nil)
+	defer closeArguments()
+	if err := dump.Restore(context.Background(), read, accountsStore, argumentsStore); err != nil {
+		return err
+	}
+	log.Printf("Restored %d accounts and %d arguments from %s", len(read.Accounts), len(read.Arguments), args[0])
+	return nil
+}
+
+// seedCommand implements "seed [FILE...]"
+func seedCommand(args []string) error {
+	paths := args
+	if len(paths) == 0 {
+		ex, err := os.Executable()
+		if err != nil {
+			return err
+		}
+		paths, err = filepath.Glob(filepath.Join(filepath.Dir(ex), "samples", "*.json"))
+		if err != nil {
+			return err
+		}
+		if len(paths) == 0 {
+			return errors.New("no fixture files given, and no samples/*.json files exist next to the executable")
+		}
+	}
+
+	cfg := config.MustParse()
+	store, closeStore := newArgumentsStore(cfg.ArgumentsStore, nil)
+	defer closeStore()
+	saved, err := dump.Seed(context.Background(), store, paths...)
+	log.Printf("Saved %d arguments", saved)
+	return err
+}
@@ -4,9 +4,13 @@ import (
 	"crypto/ecdsa"
 	"crypto/x509"
 	"encoding/pem"
+	"fmt"
 	"io/ioutil"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -23,6 +27,7 @@ func Defaults() Configuration {
 		Server: &Server{
 			Addr:                    ":8001",
 			ReadHeaderTimeoutMillis: 5000,
+			RequestTimeoutMillis:    10000,
 			CorsAllowedOrigins:      []string{"*"},
 			UseSSL:                  false,
 			CertPath:                filepath.FromSlash(exPath + "/dev-certificates/ssl-cert.pem"),
@@ -31,21 +36,35 @@ func Defaults() Configuration {
 		AccountsStore: &Storage{
 			Type: StorageTypeMemory,
 			Postgres: &Postgres{
-				Database: "wikisophia_accounts",
-				Host:     "localhost",
-				Port:     5432,
-				User:     "wikisophia_accounts_dev",
-				Password: "wikisophia_accounts_dev_password",
+				Database:               "wikisophia_accounts",
+				Host:                   "localhost",
+				Port:                   5432,
+				User:                   "wikisophia_accounts_dev",
+				Password:               "wikisophia_accounts_dev_password",
+				StatementTimeoutMillis: 5000,
+			},
+			SQLite: &SQLite{
+				Path: "wikisophia_accounts.db",
+			},
+			Memory: &Memory{
+				SnapshotIntervalMillis: 60000,
 			},
 		},
 		ArgumentsStore: &Storage{
 			Type: StorageTypeMemory,
 			Postgres: &Postgres{
-				Database: "wikisophia_arguments",
-				Host:     "localhost",
-				Port:     5432,
-				User:     "wikisophia_arguments_dev",
-				Password: "wikisophia_arguments_dev_password",
+				Database:               "wikisophia_arguments",
+				Host:                   "localhost",
+				Port:                   5432,
+				User:                   "wikisophia_arguments_dev",
+				Password:               "wikisophia_arguments_dev_password",
+				StatementTimeoutMillis: 5000,
+			},
+			SQLite: &SQLite{
+				Path: "wikisophia_arguments.db",
+			},
+			Memory: &Memory{
+				SnapshotIntervalMillis: 60000,
 			},
 		},
 		Hash: &Hash{
@@ -55,17 +74,235 @@ func Defaults() Configuration {
 			SaltLength:  32,
 			KeyLength:   32,
 		},
+		PasswordPolicy: &PasswordPolicy{
+			MinLength:            8,
+			MaxLength:            256,
+			RejectSimilarToEmail: true,
+		},
+		Log: &Log{
+			Level:  LogLevelInfo,
+			Format: LogFormatJSON,
+		},
+		Metrics: &Metrics{
+			Enabled: true,
+		},
+		Admin: &Admin{
+			Addr: "127.0.0.1:8002",
+		},
+		Tracing: &Tracing{
+			Exporter:      TracingExporterNone,
+			SamplePercent: 100,
+		},
+		RateLimit: &RateLimit{
+			Enabled: true,
+			Sessions: &RateLimitGroup{
+				IPPerMinute:      10,
+				IPBurst:          10,
+				AccountPerMinute: 5,
+				AccountBurst:     5,
+			},
+			Accounts: &RateLimitGroup{
+				IPPerMinute:      5,
+				IPBurst:          5,
+				AccountPerMinute: 5,
+				AccountBurst:     5,
+			},
+			ArgumentWrites: &RateLimitGroup{
+				IPPerMinute:      60,
+				IPBurst:          30,
+				AccountPerMinute: 60,
+				AccountBurst:     30,
+			},
+		},
+		Lockout: &Lockout{
+			Threshold:      5,
+			DelayMillis:    60000,
+			MaxDelayMillis: 3600000,
+		},
+		Tokens: &Tokens{
+			ResetExpiryMillis:        86400000,
+			VerificationExpiryMillis: 604800000,
+		},
+		Verification: &Verification{},
+		Email: &Email{
+			Type:          EmailTypeConsole,
+			From:          "Wikisophia <noreply@soph.wiki>",
+			PublicBaseURL: "http://localhost:8080",
+			SMTP: &SMTP{
+				Host:          "localhost",
+				Port:          587,
+				TLS:           SMTPTLSStartTLS,
+				TimeoutMillis: 10000,
+			},
+			File: &EmailFile{
+				Dir: "emails",
+			},
+		},
+		Outbox: &Outbox{
+			PollIntervalMillis:  1000,
+			BatchSize:           10,
+			LeaseMillis:         60000,
+			MaxAttempts:         10,
+			RetryDelayMillis:    30000,
+			MaxRetryDelayMillis: 3600000,
+		},
+		Deletion: &Deletion{
+			GracePeriodMillis:   1209600000,
+			PurgeIntervalMillis: 3600000,
+		},
+		TwoFactor: &TwoFactor{
+			Issuer:                "Wikisophia",
+			ChallengeExpiryMillis: 300000,
+		},
 		JwtPrivateKeyPath: filepath.FromSlash(exPath + "/dev-certificates/jwt-private-key.pem"),
 	}
 }
 
 // Configuration stores all the application config.
 type Configuration struct {
-	Server            *Server  `environment:"SERVER"`
-	AccountsStore     *Storage `environment:"ACCOUNTS_STORE"`
-	ArgumentsStore    *Storage `environment:"ARGUMENTS_STORE"`
-	Hash              *Hash    `environment:"HASH"`
-	JwtPrivateKeyPath string   `environment:"JWT_PRIVATE_KEY_PATH"`
+	Server            *Server         `environment:"SERVER"`
+	AccountsStore     *Storage        `environment:"ACCOUNTS_STORE"`
+	ArgumentsStore    *Storage        `environment:"ARGUMENTS_STORE"`
+	Hash              *Hash           `environment:"HASH"`
+	PasswordPolicy    *PasswordPolicy `environment:"PASSWORD_POLICY"`
+	Log               *Log            `environment:"LOG"`
+	Metrics           *Metrics        `environment:"METRICS"`
+	Admin             *Admin          `environment:"ADMIN"`
+	Tracing           *Tracing        `environment:"TRACING"`
+	RateLimit         *RateLimit      `environment:"RATE_LIMIT"`
+	Lockout           *Lockout        `environment:"LOCKOUT"`
+	Tokens            *Tokens         `environment:"TOKENS"`
+	Verification      *Verification   `environment:"VERIFICATION"`
+	Email             *Email          `environment:"EMAIL"`
+	Outbox            *Outbox         `environment:"OUTBOX"`
+	Deletion          *Deletion       `environment:"DELETION"`
+	TwoFactor         *TwoFactor      `environment:"TWO_FACTOR"`
+	JwtPrivateKeyPath string          `environment:"JWT_PRIVATE_KEY_PATH"`
+}
+
+// Email configures how the server sends emails to account owners.
+type Email struct {
+	// Type is where emails go. See the EmailType constants.
+	Type string `environment:"TYPE"`
+	// From is the address emails come from, like "Wikisophia <noreply@soph.wiki>".
+	From string `environment:"FROM"`
+	// PublicBaseURL is where people use the site, like "https://soph.wiki".
+	// The links in emails start with it.
+	PublicBaseURL string     `environment:"PUBLIC_BASE_URL"`
+	SMTP          *SMTP      `environment:"SMTP"`
+	File          *EmailFile `environment:"FILE"`
+}
+
+// The valid Email.Type values.
+const (
+	// EmailTypeConsole logs each email's tokens instead of sending it. This is meant for development.
+	EmailTypeConsole = "console"
+	// EmailTypeSMTP sends emails through an SMTP server.
+	EmailTypeSMTP = "smtp"
+	// EmailTypeFile writes each email to a .eml file, which mail clients can open. This is meant for development and tests.
+	EmailTypeFile = "file"
+)
+
+// SMTP configures the server which the "smtp" Email.Type sends through.
+type SMTP struct {
+	Host string `environment:"HOST"`
+	Port int    `environment:"PORT"`
+	// Username and Password are used to log into the server. If Username is empty, emails are sent without logging in.
+	// The password is only sent over TLS, or to localhost.
+	Username string `environment:"USERNAME"`
+	Password string `environment:"PASSWORD"`
+	// TLS says how the connection is encrypted. See the SMTPTLS constants.
+	TLS string `environment:"TLS"`
+	// TimeoutMillis is how long sending one email may take.
+	TimeoutMillis int `environment:"TIMEOUT_MILLIS"`
+}
+
+// The valid SMTP.TLS values.
+const (
+	// SMTPTLSStartTLS connects without TLS, and then upgrades with the STARTTLS command. This is usual on port 587.
+	SMTPTLSStartTLS = "starttls"
+	// SMTPTLSImplicit uses TLS from the start. This is usual on port 465.
+	SMTPTLSImplicit = "implicit"
+	// SMTPTLSNone never encrypts the connection. Only use it for servers on the same machine.
+	SMTPTLSNone = "none"
+)
+
+// Timeout returns how long sending one email may take.
+func (cfg *SMTP) Timeout() time.Duration {
+	return time.Duration(cfg.TimeoutMillis) * time.Millisecond
+}
+
+// EmailFile configures where the "file" Email.Type writes emails.
+type EmailFile struct {
+	// Dir is the directory the .eml files go in. It's made if it doesn't exist.
+	Dir string `environment:"DIR"`
+}
+
+// Outbox configures the worker which sends the emails that wait in the accounts store's outbox.
+// Each failed attempt delays the next one twice as long as the last, starting at RetryDelayMillis
+// and capped at MaxRetryDelayMillis. Emails which fail MaxAttempts times are dead-lettered.
+type Outbox struct {
+	// PollIntervalMillis is how long the worker waits to check again once no emails are due.
+	PollIntervalMillis int `environment:"POLL_INTERVAL_MILLIS"`
+	// BatchSize is how many emails the worker claims at a time.
+	BatchSize int `environment:"BATCH_SIZE"`
+	// LeaseMillis is how long a claimed email is hidden from other workers. If the worker dies
+	// while sending it, it gets sent again after this.
+	LeaseMillis         int `environment:"LEASE_MILLIS"`
+	MaxAttempts         int `environment:"MAX_ATTEMPTS"`
+	RetryDelayMillis    int `environment:"RETRY_DELAY_MILLIS"`
+	MaxRetryDelayMillis int `environment:"MAX_RETRY_DELAY_MILLIS"`
+}
+
+// PollInterval returns how long the worker waits to check again once no emails are due.
+func (cfg *Outbox) PollInterval() time.Duration {
+	return time.Duration(cfg.PollIntervalMillis) * time.Millisecond
+}
+
+// Lease returns how long a claimed email is hidden from other workers.
+func (cfg *Outbox) Lease() time.Duration {
+	return time.Duration(cfg.LeaseMillis) * time.Millisecond
+}
+
+// RetryDelay returns how long to wait after an email's first failure.
+func (cfg *Outbox) RetryDelay() time.Duration {
+	return time.Duration(cfg.RetryDelayMillis) * time.Millisecond
+}
+
+// MaxRetryDelay returns the longest that the worker waits between attempts.
+func (cfg *Outbox) MaxRetryDelay() time.Duration {
+	return time.Duration(cfg.MaxRetryDelayMillis) * time.Millisecond
+}
+
+// Deletion configures how accounts are deleted once their owners ask.
+type Deletion struct {
+	// GracePeriodMillis is how long an account waits to be purged after its owner asks. They can change their mind until then.
+	GracePeriodMillis int `environment:"GRACE_PERIOD_MILLIS"`
+	// PurgeIntervalMillis is how often the worker looks for accounts which are due to be purged.
+	PurgeIntervalMillis int `environment:"PURGE_INTERVAL_MILLIS"`
+}
+
+// GracePeriod returns how long an account waits to be purged after its owner asks.
+func (cfg *Deletion) GracePeriod() time.Duration {
+	return time.Duration(cfg.GracePeriodMillis) * time.Millisecond
+}
+
+// PurgeInterval returns how often the worker looks for accounts which are due to be purged.
+func (cfg *Deletion) PurgeInterval() time.Duration {
+	return time.Duration(cfg.PurgeIntervalMillis) * time.Millisecond
+}
+
+// TwoFactor configures two-factor auth.
+type TwoFactor struct {
+	// Issuer names the site in authenticator apps.
+	Issuer string `environment:"ISSUER"`
+	// ChallengeExpiryMillis is how long people have to enter a code after they enter their password.
+	ChallengeExpiryMillis int `environment:"CHALLENGE_EXPIRY_MILLIS"`
+}
+
+// ChallengeExpiry returns how long people have to enter a code after they enter their password.
+func (cfg *TwoFactor) ChallengeExpiry() time.Duration {
+	return time.Duration(cfg.ChallengeExpiryMillis) * time.Millisecond
 }
 
 // Server has all the config values which affect the http.Server which responds to requests.
@@ -76,12 +313,24 @@ type Server struct {
 	UseSSL                  bool     `environment:"USE_SSL"`
 	CertPath                string   `environment:"CERT_PATH"`
 	KeyPath                 string   `environment:"KEY_PATH"`
+	// RequestTimeoutMillis is how long a request may take before it fails with a 504.
+	RequestTimeoutMillis int `environment:"REQUEST_TIMEOUT_MILLIS"`
+	// RouteTimeouts override RequestTimeoutMillis for some routes.
+	// Each one looks like "POST /sessions=20000", where the path is the route's pattern.
+	RouteTimeouts []string `environment:"ROUTE_TIMEOUTS"`
+	// DrainDelayMillis is how long GET /readyz fails before the server stops accepting connections
+	// during a shutdown. It should be long enough for the load balancer to notice.
+	DrainDelayMillis int `environment:"DRAIN_DELAY_MILLIS"`
 }
 
 // Storage has all the config values related to the backend which is used to save arguments.
 type Storage struct {
 	Type     StorageType `environment:"TYPE"`
 	Postgres *Postgres   `environment:"POSTGRES"`
+	SQLite   *SQLite     `environment:"SQLITE"`
+	Memory   *Memory     `environment:"MEMORY"`
+	// MigrateOnStartup applies any pending schema migrations before the server starts.
+	MigrateOnStartup bool `environment:"MIGRATE_ON_STARTUP"`
 }
 
 // StorageType determines how the service stores its arguments.
@@ -95,6 +344,9 @@ const (
 	// StorageTypePostgres is used to save arguments in a postgres instance.
 	// If this is used, you'll need a working postgres instance to save arguments.
 	StorageTypePostgres StorageType = "postgres"
+	// StorageTypeSQLite is used to save arguments in a local SQLite file.
+	// This persists data without needing to run a database server.
+	StorageTypeSQLite StorageType = "sqlite"
 )
 
 // storageTypes returns all the valid StorageType values.
@@ -102,11 +354,13 @@ func storageTypes() []StorageType {
 	return []StorageType{
 		StorageTypeMemory,
 		StorageTypePostgres,
+		StorageTypeSQLite,
 	}
 }
 
 // Hash configures the hashing algorithm used to store passwords.
 // This project hashes with Argon2: https://www.alexedwards.net/blog/how-to-hash-and-verify-passwords-with-argon2-in-go
+// Stored hashes with weaker params than these are replaced the next time their owner logs in.
 type Hash struct {
 	Time        uint32 `environment:"ITERATIONS"`
 	Memory      uint32 `environment:"MEMORY_BYTES"`
@@ -115,6 +369,153 @@ type Hash struct {
 	KeyLength   uint32 `environment:"KEY_LENGTH"`
 }
 
+// PasswordPolicy configures which passwords people may choose.
+// Lengths are counted in characters, not bytes.
+type PasswordPolicy struct {
+	MinLength int `environment:"MIN_LENGTH"`
+	MaxLength int `environment:"MAX_LENGTH"`
+	// BreachedListPath points to a file of passwords which have been in data breaches, so they can't be used.
+	// Each line starts with the uppercase hex SHA-1 of a password, and the lines are sorted.
+	// Anything after the hash, like HIBP's ":count" suffix, is ignored. If empty, no list is checked.
+	BreachedListPath string `environment:"BREACHED_LIST_PATH"`
+	// RejectSimilarToEmail rejects passwords which contain, or are nearly the same as, the name in the account's email.
+	RejectSimilarToEmail bool `environment:"REJECT_SIMILAR_TO_EMAIL"`
+}
+
+// Log configures the app's logs.
+type Log struct {
+	// Level is the least important level which gets logged.
+	Level string `environment:"LEVEL"`
+	// Format is "json" for one JSON object per line, or "text" for key=value pairs.
+	Format string `environment:"FORMAT"`
+}
+
+// The valid Log.Level values.
+const (
+	LogLevelDebug = "debug"
+	LogLevelInfo  = "info"
+	LogLevelWarn  = "warn"
+	LogLevelError = "error"
+)
+
+// The valid Log.Format values.
+const (
+	LogFormatJSON = "json"
+	LogFormatText = "text"
+)
+
+// SlogLevel returns the Level as a log/slog value.
+// Unknown levels are treated as "info", but should be caught during config validation.
+func (cfg *Log) SlogLevel() slog.Level {
+	switch cfg.Level {
+	case LogLevelDebug:
+		return slog.LevelDebug
+	case LogLevelWarn:
+		return slog.LevelWarn
+	case LogLevelError:
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// Metrics configures the Prometheus metrics.
+type Metrics struct {
+	// Enabled records the metrics, and serves them on the admin listener at GET /metrics.
+	Enabled bool `environment:"ENABLED"`
+}
+
+// Admin configures the listener for maintenance endpoints like pprof, metrics and read-only mode.
+// These are never served by the API's listener.
+type Admin struct {
+	// Addr is the host/port of the admin listener. If empty, it's disabled.
+	// It has no authentication, so it shouldn't be reachable from the internet.
+	Addr string `environment:"ADDR"`
+}
+
+// Tracing configures the OpenTelemetry traces.
+type Tracing struct {
+	// Exporter is where the spans go. See the TracingExporter constants.
+	Exporter string `environment:"EXPORTER"`
+	// OTLPEndpoint is the host:port of the collector for the "otlp" exporter.
+	// If empty, the standard OTEL_EXPORTER_OTLP_* environment variables are used.
+	OTLPEndpoint string `environment:"OTLP_ENDPOINT"`
+	// OTLPInsecure sends spans to the collector over HTTP rather than HTTPS.
+	OTLPInsecure bool `environment:"OTLP_INSECURE"`
+	// FilePath is where the "stdout" exporter writes its spans. If empty, they go to stdout.
+	FilePath string `environment:"FILE_PATH"`
+	// SamplePercent is the share of new traces which get recorded.
+	// Requests which are part of a caller's trace follow the caller's decision.
+	SamplePercent int `environment:"SAMPLE_PERCENT"`
+}
+
+// The valid Tracing.Exporter values.
+const (
+	// TracingExporterNone turns tracing off.
+	TracingExporterNone = "none"
+	// TracingExporterOTLP sends spans to an OpenTelemetry collector over OTLP/HTTP.
+	TracingExporterOTLP = "otlp"
+	// TracingExporterStdout writes spans as JSON, so that they can be read without a collector.
+	TracingExporterStdout = "stdout"
+)
+
+// RateLimit configures how many requests each client can make.
+// Each group of routes has its own token buckets. See the docs for which routes are in each group.
+type RateLimit struct {
+	Enabled bool `environment:"ENABLED"`
+	// TrustForwardedFor identifies clients by the last address in the X-Forwarded-For header,
+	// rather than the address which connected. Only turn it on behind a proxy which sets the header.
+	TrustForwardedFor bool            `environment:"TRUST_FORWARDED_FOR"`
+	Sessions          *RateLimitGroup `environment:"SESSIONS"`
+	Accounts          *RateLimitGroup `environment:"ACCOUNTS"`
+	ArgumentWrites    *RateLimitGroup `environment:"ARGUMENT_WRITES"`
+}
+
+// RateLimitGroup configures the token buckets for one group of routes.
+// A PerMinute of 0 turns off that bucket. A Burst is the most requests which can be made at once.
+type RateLimitGroup struct {
+	IPPerMinute      int `environment:"IP_PER_MINUTE"`
+	IPBurst          int `environment:"IP_BURST"`
+	AccountPerMinute int `environment:"ACCOUNT_PER_MINUTE"`
+	AccountBurst     int `environment:"ACCOUNT_BURST"`
+}
+
+// Lockout configures how accounts get locked after too many failed logins.
+// Each failure past the Threshold locks the account for twice as long as the last one,
+// starting at DelayMillis and capped at MaxDelayMillis.
+type Lockout struct {
+	// Threshold is how many failed logins in a row lock the account. 0 turns off lockouts.
+	Threshold      int `environment:"THRESHOLD"`
+	DelayMillis    int `environment:"DELAY_MILLIS"`
+	MaxDelayMillis int `environment:"MAX_DELAY_MILLIS"`
+}
+
+// Tokens configures the tokens which get emailed to account owners.
+type Tokens struct {
+	// ResetExpiryMillis is how long a password reset token can be used for.
+	ResetExpiryMillis int `environment:"RESET_EXPIRY_MILLIS"`
+	// VerificationExpiryMillis is how long an email verification token can be used for.
+	VerificationExpiryMillis int `environment:"VERIFICATION_EXPIRY_MILLIS"`
+}
+
+// ResetExpiry returns how long a password reset token can be used for.
+func (cfg *Tokens) ResetExpiry() time.Duration {
+	return time.Duration(cfg.ResetExpiryMillis) * time.Millisecond
+}
+
+// VerificationExpiry returns how long an email verification token can be used for.
+func (cfg *Tokens) VerificationExpiry() time.Duration {
+	return time.Duration(cfg.VerificationExpiryMillis) * time.Millisecond
+}
+
+// Verification says what accounts can't do until they've verified their email.
+type Verification struct {
+	// RequiredToLogin stops unverified accounts from starting sessions.
+	RequiredToLogin bool `environment:"REQUIRED_TO_LOGIN"`
+	// RequiredToWriteArguments stops argument writes unless they come from a session of a verified account.
+	RequiredToWriteArguments bool `environment:"REQUIRED_TO_WRITE_ARGUMENTS"`
+}
+
 // Postgres configures the Postgres connection
 type Postgres struct {
 	Database string `environment:"DBNAME"`
@@ -122,6 +523,34 @@ type Postgres struct {
 	Port     uint16 `environment:"PORT"`
 	User     string `environment:"USER"`
 	Password string `environment:"PASSWORD"`
+	// MigrationUser is the role which runs schema migrations. If empty, User is used.
+	// Either way, the migrations grant their privileges to User.
+	MigrationUser     string `environment:"MIGRATION_USER"`
+	MigrationPassword string `environment:"MIGRATION_PASSWORD"`
+	// StatementTimeoutMillis makes Postgres cancel any query which runs longer than this.
+	// If 0, queries only stop when their request's context does.
+	StatementTimeoutMillis int `environment:"STATEMENT_TIMEOUT_MILLIS"`
+}
+
+// Memory configures the in-memory stores.
+type Memory struct {
+	// SnapshotPath is a file where the data is saved, so that it survives restarts.
+	// If empty, the data is lost when the server stops.
+	SnapshotPath string `environment:"SNAPSHOT_PATH"`
+	// SnapshotIntervalMillis is how often the snapshot is saved while the server runs.
+	// It's also saved when the server shuts down gracefully.
+	SnapshotIntervalMillis int `environment:"SNAPSHOT_INTERVAL_MILLIS"`
+}
+
+// SnapshotInterval returns the time between snapshot saves.
+func (cfg *Memory) SnapshotInterval() time.Duration {
+	return time.Duration(cfg.SnapshotIntervalMillis) * time.Millisecond
+}
+
+// SQLite configures the SQLite database file.
+type SQLite struct {
+	// Path is the database file. It will be created if it doesn't exist.
+	Path string `environment:"PATH"`
 }
 
 // ReadHeaderTimeout returns the time the server will wait for the client to send
@@ -130,6 +559,52 @@ func (cfg *Server) ReadHeaderTimeout() time.Duration {
 	return time.Duration(cfg.ReadHeaderTimeoutMillis) * time.Millisecond
 }
 
+// DrainDelay returns how long the server keeps serving requests after it's told to shut down.
+func (cfg *Server) DrainDelay() time.Duration {
+	return time.Duration(cfg.DrainDelayMillis) * time.Millisecond
+}
+
+// RouteTimeout returns how long requests to the route may take.
+// The path should be the route's pattern, like "/arguments/:id".
+func (cfg *Server) RouteTimeout(method, path string) time.Duration {
+	millis := cfg.RequestTimeoutMillis
+	for _, override := range cfg.RouteTimeouts {
+		if overrideMethod, overridePath, overrideMillis, err := parseRouteTimeout(override); err == nil &&
+			overrideMethod == method && overridePath == path {
+			millis = overrideMillis
+		}
+	}
+	return time.Duration(millis) * time.Millisecond
+}
+
+// parseRouteTimeout splits a RouteTimeouts entry like "POST /sessions=20000" into its parts.
+func parseRouteTimeout(value string) (method, path string, millis int, err error) {
+	route, millisString := value, ""
+	if i := strings.LastIndex(value, "="); i >= 0 {
+		route, millisString = value[:i], value[i+1:]
+	}
+	parts := strings.Fields(route)
+	if len(parts) != 2 {
+		return "", "", 0, fmt.Errorf("%q should look like \"METHOD /path=millis\"", value)
+	}
+	millis, err = strconv.Atoi(millisString)
+	if err != nil || millis < 1 {
+		return "", "", 0, fmt.Errorf("%q should end with a positive number of milliseconds", value)
+	}
+	return strings.ToUpper(parts[0]), parts[1], millis, nil
+}
+
+// ForMigrations returns the config which should be used to connect when running migrations.
+func (cfg *Postgres) ForMigrations() *Postgres {
+	if cfg.MigrationUser == "" {
+		return cfg
+	}
+	copied := *cfg
+	copied.User = cfg.MigrationUser
+	copied.Password = cfg.MigrationPassword
+	return &copied
+}
+
 // JwtPrivateKey returns the PrivateKey object from the file at the given path.
 // This is used to sign JWTs. Panic if the file doesn't exist, can't be read, or
 // didn't have a valid private key.
@@ -2,7 +2,10 @@ package config
 
 import (
 	"log"
+	"net/mail"
+	"net/url"
 	"os"
+	"strings"
 
 	configs "github.com/wikisophia/go-environment-configs"
 )
@@ -29,10 +32,45 @@ func Parse() (Configuration, error) {
 	log.SetOutput(os.Stderr)
 
 	errs = requirePositive(cfg.Server.ReadHeaderTimeoutMillis, prefix+"_SERVER_READ_HEADER_TIMEOUT_MILLIS", errs)
+	errs = requirePositive(cfg.Server.RequestTimeoutMillis, prefix+"_SERVER_REQUEST_TIMEOUT_MILLIS", errs)
+	errs = requireNonNegative(cfg.Server.DrainDelayMillis, prefix+"_SERVER_DRAIN_DELAY_MILLIS", errs)
+	errs = requireValidRouteTimeouts(cfg.Server.RouteTimeouts, prefix+"_SERVER_ROUTE_TIMEOUTS", errs)
+	errs = requireNonNegative(cfg.AccountsStore.Postgres.StatementTimeoutMillis, prefix+"_ACCOUNTS_STORE_POSTGRES_STATEMENT_TIMEOUT_MILLIS", errs)
+	errs = requireNonNegative(cfg.ArgumentsStore.Postgres.StatementTimeoutMillis, prefix+"_ARGUMENTS_STORE_POSTGRES_STATEMENT_TIMEOUT_MILLIS", errs)
 	errs = requirePositive(int(cfg.AccountsStore.Postgres.Port), prefix+"_ACCOUNTS_STORE_POSTGRES_PORT", errs)
 	errs = requirePositive(int(cfg.ArgumentsStore.Postgres.Port), prefix+"_ARGUMENTS_STORE_POSTGRES_PORT", errs)
 	errs = requireValidStorageType(cfg.AccountsStore.Type, prefix+"_ACCOUNTS_STORE_TYPE", errs)
 	errs = requireValidStorageType(cfg.ArgumentsStore.Type, prefix+"_ARGUMENTS_STORE_TYPE", errs)
+	errs = requirePositive(cfg.AccountsStore.Memory.SnapshotIntervalMillis, prefix+"_ACCOUNTS_STORE_MEMORY_SNAPSHOT_INTERVAL_MILLIS", errs)
+	errs = requirePositive(cfg.ArgumentsStore.Memory.SnapshotIntervalMillis, prefix+"_ARGUMENTS_STORE_MEMORY_SNAPSHOT_INTERVAL_MILLIS", errs)
+	errs = requireSeparateSnapshotFiles(cfg.AccountsStore, cfg.ArgumentsStore, prefix+"_ARGUMENTS_STORE_MEMORY_SNAPSHOT_PATH", errs)
+	errs = requireSeparateSQLiteFiles(cfg.AccountsStore, cfg.ArgumentsStore, prefix+"_ARGUMENTS_STORE_SQLITE_PATH", errs)
+	errs = configs.Ensure(errs, prefix+"_ADMIN_ADDR", cfg.Admin.Addr == "" || cfg.Admin.Addr != cfg.Server.Addr, "must be different from %s_SERVER_ADDR. Got %s", prefix, cfg.Admin.Addr)
+	errs = requireOneOf(cfg.Log.Level, []string{LogLevelDebug, LogLevelInfo, LogLevelWarn, LogLevelError}, prefix+"_LOG_LEVEL", errs)
+	errs = requireOneOf(cfg.Log.Format, []string{LogFormatJSON, LogFormatText}, prefix+"_LOG_FORMAT", errs)
+	errs = requireOneOf(cfg.Tracing.Exporter, []string{TracingExporterNone, TracingExporterOTLP, TracingExporterStdout}, prefix+"_TRACING_EXPORTER", errs)
+	errs = configs.Ensure(errs, prefix+"_TRACING_SAMPLE_PERCENT", cfg.Tracing.SamplePercent >= 0 && cfg.Tracing.SamplePercent <= 100, "must be between 0 and 100. Got %d", cfg.Tracing.SamplePercent)
+	errs = requireValidRateLimitGroup(cfg.RateLimit.Sessions, prefix+"_RATE_LIMIT_SESSIONS", errs)
+	errs = requireValidRateLimitGroup(cfg.RateLimit.Accounts, prefix+"_RATE_LIMIT_ACCOUNTS", errs)
+	errs = requireValidRateLimitGroup(cfg.RateLimit.ArgumentWrites, prefix+"_RATE_LIMIT_ARGUMENT_WRITES", errs)
+	errs = requirePositive(cfg.PasswordPolicy.MinLength, prefix+"_PASSWORD_POLICY_MIN_LENGTH", errs)
+	errs = configs.Ensure(errs, prefix+"_PASSWORD_POLICY_MAX_LENGTH", cfg.PasswordPolicy.MaxLength >= cfg.PasswordPolicy.MinLength, "must be at least %s_PASSWORD_POLICY_MIN_LENGTH. Got %d", prefix, cfg.PasswordPolicy.MaxLength)
+	errs = requireNonNegative(cfg.Lockout.Threshold, prefix+"_LOCKOUT_THRESHOLD", errs)
+	errs = requirePositive(cfg.Lockout.DelayMillis, prefix+"_LOCKOUT_DELAY_MILLIS", errs)
+	errs = configs.Ensure(errs, prefix+"_LOCKOUT_MAX_DELAY_MILLIS", cfg.Lockout.MaxDelayMillis >= cfg.Lockout.DelayMillis, "must be at least %s_LOCKOUT_DELAY_MILLIS. Got %d", prefix, cfg.Lockout.MaxDelayMillis)
+	errs = requirePositive(cfg.Tokens.ResetExpiryMillis, prefix+"_TOKENS_RESET_EXPIRY_MILLIS", errs)
+	errs = requirePositive(cfg.Tokens.VerificationExpiryMillis, prefix+"_TOKENS_VERIFICATION_EXPIRY_MILLIS", errs)
+	errs = requireValidEmail(cfg.Email, prefix+"_EMAIL", errs)
+	errs = requirePositive(cfg.Outbox.PollIntervalMillis, prefix+"_OUTBOX_POLL_INTERVAL_MILLIS", errs)
+	errs = requirePositive(cfg.Outbox.BatchSize, prefix+"_OUTBOX_BATCH_SIZE", errs)
+	errs = requirePositive(cfg.Outbox.LeaseMillis, prefix+"_OUTBOX_LEASE_MILLIS", errs)
+	errs = requirePositive(cfg.Outbox.MaxAttempts, prefix+"_OUTBOX_MAX_ATTEMPTS", errs)
+	errs = requirePositive(cfg.Outbox.RetryDelayMillis, prefix+"_OUTBOX_RETRY_DELAY_MILLIS", errs)
+	errs = requireNonNegative(cfg.Deletion.GracePeriodMillis, prefix+"_DELETION_GRACE_PERIOD_MILLIS", errs)
+	errs = requirePositive(cfg.Deletion.PurgeIntervalMillis, prefix+"_DELETION_PURGE_INTERVAL_MILLIS", errs)
+	errs = configs.Ensure(errs, prefix+"_TWO_FACTOR_ISSUER", cfg.TwoFactor.Issuer != "" && !strings.Contains(cfg.TwoFactor.Issuer, ":"), "must be non-empty, without colons. Got %s", cfg.TwoFactor.Issuer)
+	errs = requirePositive(cfg.TwoFactor.ChallengeExpiryMillis, prefix+"_TWO_FACTOR_CHALLENGE_EXPIRY_MILLIS", errs)
+	errs = configs.Ensure(errs, prefix+"_OUTBOX_MAX_RETRY_DELAY_MILLIS", cfg.Outbox.MaxRetryDelayMillis >= cfg.Outbox.RetryDelayMillis, "must be at least %s_OUTBOX_RETRY_DELAY_MILLIS. Got %d", prefix, cfg.Outbox.MaxRetryDelayMillis)
 	return cfg, errs
 }
 
@@ -40,6 +78,44 @@ func requirePositive(value int, prefix string, err error) error {
 	return configs.Ensure(err, prefix, value > 0, "must be positive. Got %d", value)
 }
 
+func requireNonNegative(value int, prefix string, err error) error {
+	return configs.Ensure(err, prefix, value >= 0, "must not be negative. Got %d", value)
+}
+
+func requireValidRateLimitGroup(group *RateLimitGroup, prefix string, err error) error {
+	err = requireNonNegative(group.IPPerMinute, prefix+"_IP_PER_MINUTE", err)
+	err = requireNonNegative(group.IPBurst, prefix+"_IP_BURST", err)
+	err = requireNonNegative(group.AccountPerMinute, prefix+"_ACCOUNT_PER_MINUTE", err)
+	return requireNonNegative(group.AccountBurst, prefix+"_ACCOUNT_BURST", err)
+}
+
+func requireValidEmail(cfg *Email, prefix string, err error) error {
+	err = requireOneOf(cfg.Type, []string{EmailTypeConsole, EmailTypeSMTP, EmailTypeFile}, prefix+"_TYPE", err)
+	_, parseErr := mail.ParseAddress(cfg.From)
+	err = configs.Ensure(err, prefix+"_FROM", parseErr == nil, "must be an email address. Got %s", cfg.From)
+	baseURL, parseErr := url.Parse(cfg.PublicBaseURL)
+	err = configs.Ensure(err, prefix+"_PUBLIC_BASE_URL", parseErr == nil && (baseURL.Scheme == "http" || baseURL.Scheme == "https") && baseURL.Host != "",
+		"must be an absolute http or https URL. Got %s", cfg.PublicBaseURL)
+	if cfg.Type == EmailTypeFile {
+		return configs.Ensure(err, prefix+"_FILE_DIR", cfg.File.Dir != "", "must not be empty when %s_TYPE is %s", prefix, EmailTypeFile)
+	}
+	if cfg.Type != EmailTypeSMTP {
+		return err
+	}
+	err = configs.Ensure(err, prefix+"_SMTP_HOST", cfg.SMTP.Host != "", "must not be empty when %s_TYPE is %s", prefix, EmailTypeSMTP)
+	err = configs.Ensure(err, prefix+"_SMTP_PORT", cfg.SMTP.Port > 0 && cfg.SMTP.Port < 65536, "must be a port number. Got %d", cfg.SMTP.Port)
+	err = requireOneOf(cfg.SMTP.TLS, []string{SMTPTLSStartTLS, SMTPTLSImplicit, SMTPTLSNone}, prefix+"_SMTP_TLS", err)
+	return requirePositive(cfg.SMTP.TimeoutMillis, prefix+"_SMTP_TIMEOUT_MILLIS", err)
+}
+
+func requireValidRouteTimeouts(values []string, prefix string, err error) error {
+	for _, value := range values {
+		_, _, _, parseErr := parseRouteTimeout(value)
+		err = configs.Ensure(err, prefix, parseErr == nil, "%v", parseErr)
+	}
+	return err
+}
+
 func requireValidStorageType(value StorageType, prefix string, err error) error {
 	allowedTypes := storageTypes()
 	for _, storageType := range storageTypes() {
@@ -49,3 +125,29 @@ func requireValidStorageType(value StorageType, prefix string, err error) error
 	}
 	return configs.Ensure(err, prefix, false, "must be one of %v. Got %s", allowedTypes, value)
 }
+
+func requireOneOf(value string, allowed []string, prefix string, err error) error {
+	for _, option := range allowed {
+		if option == value {
+			return err
+		}
+	}
+	return configs.Ensure(err, prefix, false, "must be one of %v. Got %s", allowed, value)
+}
+
+// requireSeparateSQLiteFiles makes sure the accounts and arguments don't share a database file.
+// Each store tracks its own schema migrations, so they'd conflict if they did.
+func requireSeparateSQLiteFiles(accounts *Storage, arguments *Storage, prefix string, err error) error {
+	if accounts.Type != StorageTypeSQLite || arguments.Type != StorageTypeSQLite {
+		return err
+	}
+	return configs.Ensure(err, prefix, accounts.SQLite.Path != arguments.SQLite.Path, "must be different from the accounts store path. Got %s", arguments.SQLite.Path)
+}
+
+// requireSeparateSnapshotFiles makes sure the accounts and arguments don't overwrite each other's snapshots.
+func requireSeparateSnapshotFiles(accounts *Storage, arguments *Storage, prefix string, err error) error {
+	if accounts.Type != StorageTypeMemory || arguments.Type != StorageTypeMemory || accounts.Memory.SnapshotPath == "" {
+		return err
+	}
+	return configs.Ensure(err, prefix, accounts.Memory.SnapshotPath != arguments.Memory.SnapshotPath, "must be different from the accounts snapshot path. Got %s", arguments.Memory.SnapshotPath)
+}
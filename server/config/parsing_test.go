@@ -6,6 +6,7 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -45,8 +46,256 @@ func TestEnvironmentOverrides(t *testing.T) {
 		return cfg.Server.CertPath
 	})
 
+	// WKSPH_SERVER_REQUEST_TIMEOUT_MILLIS determines how long a request may take before the server gives up with a 504.
+	assertIntParses(t, "WKSPH_SERVER_REQUEST_TIMEOUT_MILLIS", 3000, func(cfg config.Configuration) int {
+		return cfg.Server.RequestTimeoutMillis
+	})
+
+	// WKSPH_SERVER_ROUTE_TIMEOUTS overrides WKSPH_SERVER_REQUEST_TIMEOUT_MILLIS for some routes.
+	assertStringSliceParses(t, "WKSPH_SERVER_ROUTE_TIMEOUTS", []string{"POST /sessions=20000", "GET /arguments=500"}, func(cfg config.Configuration) []string {
+		return cfg.Server.RouteTimeouts
+	})
+
+	// WKSPH_SERVER_DRAIN_DELAY_MILLIS determines how long GET /readyz fails before the server
+	// stops accepting connections during a shutdown.
+	assertIntParses(t, "WKSPH_SERVER_DRAIN_DELAY_MILLIS", 5000, func(cfg config.Configuration) int {
+		return cfg.Server.DrainDelayMillis
+	})
+
+	// WKSPH_LOG_LEVEL is the least important level which gets logged.
+	// Valid options are "debug", "info", "warn", or "error".
+	assertStringParses(t, "WKSPH_LOG_LEVEL", "debug", func(cfg config.Configuration) string {
+		return cfg.Log.Level
+	})
+
+	// WKSPH_LOG_FORMAT determines how log lines are written.
+	// Valid options are "json" or "text".
+	assertStringParses(t, "WKSPH_LOG_FORMAT", "text", func(cfg config.Configuration) string {
+		return cfg.Log.Format
+	})
+
+	// WKSPH_METRICS_ENABLED determines whether the admin listener serves Prometheus metrics at GET /metrics.
+	assertBoolParses(t, "WKSPH_METRICS_ENABLED", false, func(cfg config.Configuration) bool {
+		return cfg.Metrics.Enabled
+	})
+
+	// WKSPH_ADMIN_ADDR determines which host/port serves pprof, metrics, and other maintenance endpoints.
+	// If empty, they're disabled. They have no authentication, so keep them private.
+	assertStringParses(t, "WKSPH_ADMIN_ADDR", "127.0.0.1:9090", func(cfg config.Configuration) string {
+		return cfg.Admin.Addr
+	})
+
+	// WKSPH_TRACING_EXPORTER determines where OpenTelemetry spans are sent.
+	// Valid options are "none", "otlp", or "stdout".
+	assertStringParses(t, "WKSPH_TRACING_EXPORTER", "otlp", func(cfg config.Configuration) string {
+		return cfg.Tracing.Exporter
+	})
+
+	// WKSPH_TRACING_OTLP_ENDPOINT is the host:port of the OpenTelemetry collector.
+	assertStringParses(t, "WKSPH_TRACING_OTLP_ENDPOINT", "collector:4318", func(cfg config.Configuration) string {
+		return cfg.Tracing.OTLPEndpoint
+	})
+
+	// WKSPH_TRACING_OTLP_INSECURE sends spans to the collector without TLS.
+	assertBoolParses(t, "WKSPH_TRACING_OTLP_INSECURE", true, func(cfg config.Configuration) bool {
+		return cfg.Tracing.OTLPInsecure
+	})
+
+	// WKSPH_TRACING_FILE_PATH is where the "stdout" exporter writes. If empty, it uses stdout.
+	assertStringParses(t, "WKSPH_TRACING_FILE_PATH", "/tmp/spans.json", func(cfg config.Configuration) string {
+		return cfg.Tracing.FilePath
+	})
+
+	// WKSPH_TRACING_SAMPLE_PERCENT is the share of new traces which get recorded.
+	assertIntParses(t, "WKSPH_TRACING_SAMPLE_PERCENT", 10, func(cfg config.Configuration) int {
+		return cfg.Tracing.SamplePercent
+	})
+
+	// WKSPH_RATE_LIMIT_ENABLED determines whether clients which make too many requests get a 429.
+	assertBoolParses(t, "WKSPH_RATE_LIMIT_ENABLED", false, func(cfg config.Configuration) bool {
+		return cfg.RateLimit.Enabled
+	})
+
+	// WKSPH_RATE_LIMIT_TRUST_FORWARDED_FOR identifies clients by the X-Forwarded-For header.
+	assertBoolParses(t, "WKSPH_RATE_LIMIT_TRUST_FORWARDED_FOR", true, func(cfg config.Configuration) bool {
+		return cfg.RateLimit.TrustForwardedFor
+	})
+
+	// WKSPH_RATE_LIMIT_SESSIONS_* limit POST /sessions.
+	assertIntParses(t, "WKSPH_RATE_LIMIT_SESSIONS_IP_PER_MINUTE", 20, func(cfg config.Configuration) int {
+		return cfg.RateLimit.Sessions.IPPerMinute
+	})
+	assertIntParses(t, "WKSPH_RATE_LIMIT_SESSIONS_IP_BURST", 3, func(cfg config.Configuration) int {
+		return cfg.RateLimit.Sessions.IPBurst
+	})
+
+	// WKSPH_RATE_LIMIT_ACCOUNTS_* limit POST /accounts and POST /accounts/:id/password.
+	assertIntParses(t, "WKSPH_RATE_LIMIT_ACCOUNTS_ACCOUNT_PER_MINUTE", 2, func(cfg config.Configuration) int {
+		return cfg.RateLimit.Accounts.AccountPerMinute
+	})
+
+	// WKSPH_RATE_LIMIT_ARGUMENT_WRITES_* limit the routes which save, update or delete arguments.
+	assertIntParses(t, "WKSPH_RATE_LIMIT_ARGUMENT_WRITES_ACCOUNT_BURST", 100, func(cfg config.Configuration) int {
+		return cfg.RateLimit.ArgumentWrites.AccountBurst
+	})
+
+	// WKSPH_PASSWORD_POLICY_MIN_LENGTH is the fewest characters a password can have.
+	assertIntParses(t, "WKSPH_PASSWORD_POLICY_MIN_LENGTH", 12, func(cfg config.Configuration) int {
+		return cfg.PasswordPolicy.MinLength
+	})
+
+	// WKSPH_PASSWORD_POLICY_MAX_LENGTH is the most characters a password can have.
+	assertIntParses(t, "WKSPH_PASSWORD_POLICY_MAX_LENGTH", 64, func(cfg config.Configuration) int {
+		return cfg.PasswordPolicy.MaxLength
+	})
+
+	// WKSPH_PASSWORD_POLICY_BREACHED_LIST_PATH points to a sorted file of SHA-1 hashes of breached passwords.
+	assertStringParses(t, "WKSPH_PASSWORD_POLICY_BREACHED_LIST_PATH", "/data/pwned-passwords-sha1-ordered-by-hash.txt", func(cfg config.Configuration) string {
+		return cfg.PasswordPolicy.BreachedListPath
+	})
+
+	// WKSPH_PASSWORD_POLICY_REJECT_SIMILAR_TO_EMAIL rejects passwords which look like the account's email.
+	assertBoolParses(t, "WKSPH_PASSWORD_POLICY_REJECT_SIMILAR_TO_EMAIL", false, func(cfg config.Configuration) bool {
+		return cfg.PasswordPolicy.RejectSimilarToEmail
+	})
+
+	// WKSPH_LOCKOUT_THRESHOLD is how many failed logins in a row lock an account. 0 turns off lockouts.
+	assertIntParses(t, "WKSPH_LOCKOUT_THRESHOLD", 10, func(cfg config.Configuration) int {
+		return cfg.Lockout.Threshold
+	})
+
+	// WKSPH_LOCKOUT_DELAY_MILLIS is how long the first lock lasts. Each one after it lasts twice as long.
+	assertIntParses(t, "WKSPH_LOCKOUT_DELAY_MILLIS", 30000, func(cfg config.Configuration) int {
+		return cfg.Lockout.DelayMillis
+	})
+
+	// WKSPH_LOCKOUT_MAX_DELAY_MILLIS is the longest that a lock can last.
+	assertIntParses(t, "WKSPH_LOCKOUT_MAX_DELAY_MILLIS", 86400000, func(cfg config.Configuration) int {
+		return cfg.Lockout.MaxDelayMillis
+	})
+
+	// WKSPH_TOKENS_RESET_EXPIRY_MILLIS is how long a password reset token can be used for.
+	assertIntParses(t, "WKSPH_TOKENS_RESET_EXPIRY_MILLIS", 3600000, func(cfg config.Configuration) int {
+		return cfg.Tokens.ResetExpiryMillis
+	})
+
+	// WKSPH_TOKENS_VERIFICATION_EXPIRY_MILLIS is how long an email verification token can be used for.
+	assertIntParses(t, "WKSPH_TOKENS_VERIFICATION_EXPIRY_MILLIS", 3600000, func(cfg config.Configuration) int {
+		return cfg.Tokens.VerificationExpiryMillis
+	})
+
+	// WKSPH_EMAIL_TYPE is where emails go: "console", "smtp" or "file".
+	assertStringParses(t, "WKSPH_EMAIL_TYPE", "smtp", func(cfg config.Configuration) string {
+		return cfg.Email.Type
+	})
+
+	// WKSPH_EMAIL_FROM is the address emails come from.
+	assertStringParses(t, "WKSPH_EMAIL_FROM", "Someone <someone@soph.wiki>", func(cfg config.Configuration) string {
+		return cfg.Email.From
+	})
+
+	// WKSPH_EMAIL_PUBLIC_BASE_URL is the start of the links in emails.
+	assertStringParses(t, "WKSPH_EMAIL_PUBLIC_BASE_URL", "https://soph.wiki", func(cfg config.Configuration) string {
+		return cfg.Email.PublicBaseURL
+	})
+
+	// WKSPH_EMAIL_SMTP_HOST is the SMTP server which sends emails.
+	assertStringParses(t, "WKSPH_EMAIL_SMTP_HOST", "smtp.soph.wiki", func(cfg config.Configuration) string {
+		return cfg.Email.SMTP.Host
+	})
+
+	// WKSPH_EMAIL_SMTP_PORT is the SMTP server's port.
+	assertIntParses(t, "WKSPH_EMAIL_SMTP_PORT", 465, func(cfg config.Configuration) int {
+		return cfg.Email.SMTP.Port
+	})
+
+	// WKSPH_EMAIL_SMTP_USERNAME logs into the SMTP server.
+	assertStringParses(t, "WKSPH_EMAIL_SMTP_USERNAME", "wikisophia", func(cfg config.Configuration) string {
+		return cfg.Email.SMTP.Username
+	})
+
+	// WKSPH_EMAIL_SMTP_PASSWORD is the WKSPH_EMAIL_SMTP_USERNAME's password.
+	assertStringParses(t, "WKSPH_EMAIL_SMTP_PASSWORD", "some-password", func(cfg config.Configuration) string {
+		return cfg.Email.SMTP.Password
+	})
+
+	// WKSPH_EMAIL_SMTP_TLS says how the SMTP connection is encrypted.
+	assertStringParses(t, "WKSPH_EMAIL_SMTP_TLS", "implicit", func(cfg config.Configuration) string {
+		return cfg.Email.SMTP.TLS
+	})
+
+	// WKSPH_EMAIL_SMTP_TIMEOUT_MILLIS is how long sending one email may take.
+	assertIntParses(t, "WKSPH_EMAIL_SMTP_TIMEOUT_MILLIS", 3000, func(cfg config.Configuration) int {
+		return cfg.Email.SMTP.TimeoutMillis
+	})
+
+	// WKSPH_EMAIL_FILE_DIR is where the "file" email type writes emails.
+	assertStringParses(t, "WKSPH_EMAIL_FILE_DIR", "/tmp/emails", func(cfg config.Configuration) string {
+		return cfg.Email.File.Dir
+	})
+
+	// WKSPH_OUTBOX_POLL_INTERVAL_MILLIS is how long the email worker waits to check again once no emails are due.
+	assertIntParses(t, "WKSPH_OUTBOX_POLL_INTERVAL_MILLIS", 5000, func(cfg config.Configuration) int {
+		return cfg.Outbox.PollIntervalMillis
+	})
+
+	// WKSPH_OUTBOX_BATCH_SIZE is how many emails the worker claims at a time.
+	assertIntParses(t, "WKSPH_OUTBOX_BATCH_SIZE", 50, func(cfg config.Configuration) int {
+		return cfg.Outbox.BatchSize
+	})
+
+	// WKSPH_OUTBOX_LEASE_MILLIS is how long a claimed email is hidden from other workers.
+	assertIntParses(t, "WKSPH_OUTBOX_LEASE_MILLIS", 120000, func(cfg config.Configuration) int {
+		return cfg.Outbox.LeaseMillis
+	})
+
+	// WKSPH_OUTBOX_MAX_ATTEMPTS is how many times an email can fail before it's dead-lettered.
+	assertIntParses(t, "WKSPH_OUTBOX_MAX_ATTEMPTS", 3, func(cfg config.Configuration) int {
+		return cfg.Outbox.MaxAttempts
+	})
+
+	// WKSPH_OUTBOX_RETRY_DELAY_MILLIS is how long to wait after an email's first failure. Each one after it waits twice as long.
+	assertIntParses(t, "WKSPH_OUTBOX_RETRY_DELAY_MILLIS", 1000, func(cfg config.Configuration) int {
+		return cfg.Outbox.RetryDelayMillis
+	})
+
+	// WKSPH_OUTBOX_MAX_RETRY_DELAY_MILLIS is the longest that the worker waits between attempts.
+	assertIntParses(t, "WKSPH_OUTBOX_MAX_RETRY_DELAY_MILLIS", 86400000, func(cfg config.Configuration) int {
+		return cfg.Outbox.MaxRetryDelayMillis
+	})
+
+	// WKSPH_DELETION_GRACE_PERIOD_MILLIS is how long accounts wait to be purged after their owners ask.
+	assertIntParses(t, "WKSPH_DELETION_GRACE_PERIOD_MILLIS", 0, func(cfg config.Configuration) int {
+		return cfg.Deletion.GracePeriodMillis
+	})
+
+	// WKSPH_DELETION_PURGE_INTERVAL_MILLIS is how often the worker looks for accounts which are due to be purged.
+	assertIntParses(t, "WKSPH_DELETION_PURGE_INTERVAL_MILLIS", 60000, func(cfg config.Configuration) int {
+		return cfg.Deletion.PurgeIntervalMillis
+	})
+
+	// WKSPH_TWO_FACTOR_ISSUER names the site in authenticator apps.
+	assertStringParses(t, "WKSPH_TWO_FACTOR_ISSUER", "Wikisophia Staging", func(cfg config.Configuration) string {
+		return cfg.TwoFactor.Issuer
+	})
+
+	// WKSPH_TWO_FACTOR_CHALLENGE_EXPIRY_MILLIS is how long people have to enter a code after they enter their password.
+	assertIntParses(t, "WKSPH_TWO_FACTOR_CHALLENGE_EXPIRY_MILLIS", 60000, func(cfg config.Configuration) int {
+		return cfg.TwoFactor.ChallengeExpiryMillis
+	})
+
+	// WKSPH_VERIFICATION_REQUIRED_TO_LOGIN stops accounts from logging in until they verify their email.
+	assertBoolParses(t, "WKSPH_VERIFICATION_REQUIRED_TO_LOGIN", true, func(cfg config.Configuration) bool {
+		return cfg.Verification.RequiredToLogin
+	})
+
+	// WKSPH_VERIFICATION_REQUIRED_TO_WRITE_ARGUMENTS only lets sessions of verified accounts change arguments.
+	assertBoolParses(t, "WKSPH_VERIFICATION_REQUIRED_TO_WRITE_ARGUMENTS", true, func(cfg config.Configuration) bool {
+		return cfg.Verification.RequiredToWriteArguments
+	})
+
 	// WKSPH_ACCOUNTS_STORE_TYPE determines how the account data is stored.
-	// Valid options are "memory" or "postgres".
+	// Valid options are "memory", "postgres", or "sqlite".
 	assertStringParses(t, "WKSPH_ACCOUNTS_STORE_TYPE", "postgres", func(cfg config.Configuration) string {
 		return string(cfg.AccountsStore.Type)
 	})
@@ -81,8 +330,48 @@ func TestEnvironmentOverrides(t *testing.T) {
 		return cfg.AccountsStore.Postgres.Password
 	})
 
+	// WKSPH_ACCOUNTS_STORE_POSTGRES_MIGRATION_USER is the user who runs schema migrations on the accounts database.
+	// If empty, WKSPH_ACCOUNTS_STORE_POSTGRES_USER is used. Either way, migrations grant privileges to that user.
+	assertStringParses(t, "WKSPH_ACCOUNTS_STORE_POSTGRES_MIGRATION_USER", "some-admin", func(cfg config.Configuration) string {
+		return cfg.AccountsStore.Postgres.MigrationUser
+	})
+
+	// WKSPH_ACCOUNTS_STORE_POSTGRES_MIGRATION_PASSWORD is the password of the WKSPH_ACCOUNTS_STORE_POSTGRES_MIGRATION_USER.
+	assertStringParses(t, "WKSPH_ACCOUNTS_STORE_POSTGRES_MIGRATION_PASSWORD", "some-admin-password", func(cfg config.Configuration) string {
+		return cfg.AccountsStore.Postgres.MigrationPassword
+	})
+
+	// WKSPH_ACCOUNTS_STORE_POSTGRES_STATEMENT_TIMEOUT_MILLIS makes Postgres cancel queries which run longer than this.
+	assertIntParses(t, "WKSPH_ACCOUNTS_STORE_POSTGRES_STATEMENT_TIMEOUT_MILLIS", 2000, func(cfg config.Configuration) int {
+		return cfg.AccountsStore.Postgres.StatementTimeoutMillis
+	})
+
+	// WKSPH_ACCOUNTS_STORE_SQLITE_PATH is the file where accounts are stored.
+	// If WKSPH_ACCOUNTS_STORE_TYPE isn't "sqlite", this is ignored.
+	assertStringParses(t, "WKSPH_ACCOUNTS_STORE_SQLITE_PATH", "/some/path.db", func(cfg config.Configuration) string {
+		return cfg.AccountsStore.SQLite.Path
+	})
+
+	// WKSPH_ACCOUNTS_STORE_MEMORY_SNAPSHOT_PATH is a file where in-memory accounts are saved, so they survive restarts.
+	// If empty, they're lost when the server stops. If WKSPH_ACCOUNTS_STORE_TYPE isn't "memory", this is ignored.
+	assertStringParses(t, "WKSPH_ACCOUNTS_STORE_MEMORY_SNAPSHOT_PATH", "/some/snapshot.json", func(cfg config.Configuration) string {
+		return cfg.AccountsStore.Memory.SnapshotPath
+	})
+
+	// WKSPH_ACCOUNTS_STORE_MEMORY_SNAPSHOT_INTERVAL_MILLIS is how often the snapshot gets saved.
+	// It's also saved when the server shuts down gracefully.
+	assertIntParses(t, "WKSPH_ACCOUNTS_STORE_MEMORY_SNAPSHOT_INTERVAL_MILLIS", 1000, func(cfg config.Configuration) int {
+		return cfg.AccountsStore.Memory.SnapshotIntervalMillis
+	})
+
+	// WKSPH_ACCOUNTS_STORE_MIGRATE_ON_STARTUP applies any pending schema migrations to the
+	// accounts database before the server starts. If the store has no schema, this is ignored.
+	assertBoolParses(t, "WKSPH_ACCOUNTS_STORE_MIGRATE_ON_STARTUP", true, func(cfg config.Configuration) bool {
+		return cfg.AccountsStore.MigrateOnStartup
+	})
+
 	// WKSPH_ARGUMENTS_STORE_TYPE determines how the argument data is stored.
-	// Valid options are "memory" or "postgres".
+	// Valid options are "memory", "postgres", or "sqlite".
 	assertStringParses(t, "WKSPH_ARGUMENTS_STORE_TYPE", "postgres", func(cfg config.Configuration) string {
 		return string(cfg.ArgumentsStore.Type)
 	})
@@ -117,6 +406,46 @@ func TestEnvironmentOverrides(t *testing.T) {
 		return cfg.ArgumentsStore.Postgres.Password
 	})
 
+	// WKSPH_ARGUMENTS_STORE_POSTGRES_MIGRATION_USER is the user who runs schema migrations on the arguments database.
+	// If empty, WKSPH_ARGUMENTS_STORE_POSTGRES_USER is used. Either way, migrations grant privileges to that user.
+	assertStringParses(t, "WKSPH_ARGUMENTS_STORE_POSTGRES_MIGRATION_USER", "some-admin", func(cfg config.Configuration) string {
+		return cfg.ArgumentsStore.Postgres.MigrationUser
+	})
+
+	// WKSPH_ARGUMENTS_STORE_POSTGRES_MIGRATION_PASSWORD is the password of the WKSPH_ARGUMENTS_STORE_POSTGRES_MIGRATION_USER.
+	assertStringParses(t, "WKSPH_ARGUMENTS_STORE_POSTGRES_MIGRATION_PASSWORD", "some-admin-password", func(cfg config.Configuration) string {
+		return cfg.ArgumentsStore.Postgres.MigrationPassword
+	})
+
+	// WKSPH_ARGUMENTS_STORE_POSTGRES_STATEMENT_TIMEOUT_MILLIS makes Postgres cancel queries which run longer than this.
+	assertIntParses(t, "WKSPH_ARGUMENTS_STORE_POSTGRES_STATEMENT_TIMEOUT_MILLIS", 2000, func(cfg config.Configuration) int {
+		return cfg.ArgumentsStore.Postgres.StatementTimeoutMillis
+	})
+
+	// WKSPH_ARGUMENTS_STORE_SQLITE_PATH is the file where arguments are stored.
+	// If WKSPH_ARGUMENTS_STORE_TYPE isn't "sqlite", this is ignored.
+	assertStringParses(t, "WKSPH_ARGUMENTS_STORE_SQLITE_PATH", "/some/path.db", func(cfg config.Configuration) string {
+		return cfg.ArgumentsStore.SQLite.Path
+	})
+
+	// WKSPH_ARGUMENTS_STORE_MEMORY_SNAPSHOT_PATH is a file where in-memory arguments are saved, so they survive restarts.
+	// If empty, they're lost when the server stops. If WKSPH_ARGUMENTS_STORE_TYPE isn't "memory", this is ignored.
+	assertStringParses(t, "WKSPH_ARGUMENTS_STORE_MEMORY_SNAPSHOT_PATH", "/some/snapshot.json", func(cfg config.Configuration) string {
+		return cfg.ArgumentsStore.Memory.SnapshotPath
+	})
+
+	// WKSPH_ARGUMENTS_STORE_MEMORY_SNAPSHOT_INTERVAL_MILLIS is how often the snapshot gets saved.
+	// It's also saved when the server shuts down gracefully.
+	assertIntParses(t, "WKSPH_ARGUMENTS_STORE_MEMORY_SNAPSHOT_INTERVAL_MILLIS", 1000, func(cfg config.Configuration) int {
+		return cfg.ArgumentsStore.Memory.SnapshotIntervalMillis
+	})
+
+	// WKSPH_ARGUMENTS_STORE_MIGRATE_ON_STARTUP applies any pending schema migrations to the
+	// arguments database before the server starts. If the store has no schema, this is ignored.
+	assertBoolParses(t, "WKSPH_ARGUMENTS_STORE_MIGRATE_ON_STARTUP", true, func(cfg config.Configuration) bool {
+		return cfg.ArgumentsStore.MigrateOnStartup
+	})
+
 	// WKSPH_HASH_ITERATIONS determines the "time" argument to argon2.Key() when hashing passwords.
 	assertUInt32Parses(t, "WKSPH_HASH_ITERATIONS", ^uint32(0), func(cfg config.Configuration) uint32 {
 		return cfg.Hash.Time
@@ -160,8 +489,44 @@ func TestInvalidEnvironment(t *testing.T) {
 	assertInvalid(t, "WKSPH_SERVER_READ_HEADER_TIMEOUT_MILLIS", "foo")
 	assertInvalid(t, "WKSPH_SERVER_READ_HEADER_TIMEOUT_MILLIS", "-12")
 	assertInvalid(t, "WKSPH_SERVER_READ_HEADER_TIMEOUT_MILLIS", "0")
+	assertInvalid(t, "WKSPH_SERVER_REQUEST_TIMEOUT_MILLIS", "0")
+	assertInvalid(t, "WKSPH_SERVER_REQUEST_TIMEOUT_MILLIS", "notAnInt")
+	assertInvalid(t, "WKSPH_SERVER_ROUTE_TIMEOUTS", "POST /sessions")
+	assertInvalid(t, "WKSPH_SERVER_ROUTE_TIMEOUTS", "/sessions=100")
+	assertInvalid(t, "WKSPH_SERVER_ROUTE_TIMEOUTS", "POST /sessions=0")
+	assertInvalid(t, "WKSPH_SERVER_DRAIN_DELAY_MILLIS", "-1")
 	assertInvalid(t, "WKSPH_SERVER_USE_SSL", "3")
 	assertInvalid(t, "WKSPH_SERVER_USE_SSL", "notABool")
+	assertInvalid(t, "WKSPH_METRICS_ENABLED", "notABool")
+	assertInvalid(t, "WKSPH_ADMIN_ADDR", ":8001")
+	assertInvalid(t, "WKSPH_LOG_LEVEL", "verbose")
+	assertInvalid(t, "WKSPH_LOG_FORMAT", "xml")
+	assertInvalid(t, "WKSPH_TRACING_EXPORTER", "jaeger")
+	assertInvalid(t, "WKSPH_RATE_LIMIT_SESSIONS_IP_PER_MINUTE", "-1")
+	assertInvalid(t, "WKSPH_RATE_LIMIT_ARGUMENT_WRITES_ACCOUNT_BURST", "many")
+	assertInvalid(t, "WKSPH_TRACING_SAMPLE_PERCENT", "101")
+	assertInvalid(t, "WKSPH_TRACING_SAMPLE_PERCENT", "-1")
+	assertInvalid(t, "WKSPH_PASSWORD_POLICY_MIN_LENGTH", "0")
+	assertInvalid(t, "WKSPH_PASSWORD_POLICY_MAX_LENGTH", "4")
+	assertInvalid(t, "WKSPH_LOCKOUT_THRESHOLD", "-1")
+	assertInvalid(t, "WKSPH_LOCKOUT_DELAY_MILLIS", "0")
+	assertInvalid(t, "WKSPH_LOCKOUT_MAX_DELAY_MILLIS", "1000")
+	assertInvalid(t, "WKSPH_TOKENS_RESET_EXPIRY_MILLIS", "0")
+	assertInvalid(t, "WKSPH_TOKENS_VERIFICATION_EXPIRY_MILLIS", "0")
+	assertInvalid(t, "WKSPH_EMAIL_TYPE", "carrier-pigeon")
+	assertInvalid(t, "WKSPH_EMAIL_FROM", "not an address")
+	assertInvalid(t, "WKSPH_EMAIL_PUBLIC_BASE_URL", "soph.wiki")
+	assertInvalid(t, "WKSPH_EMAIL_PUBLIC_BASE_URL", "ftp://soph.wiki")
+	assertInvalid(t, "WKSPH_OUTBOX_POLL_INTERVAL_MILLIS", "0")
+	assertInvalid(t, "WKSPH_OUTBOX_BATCH_SIZE", "0")
+	assertInvalid(t, "WKSPH_OUTBOX_LEASE_MILLIS", "-1")
+	assertInvalid(t, "WKSPH_OUTBOX_MAX_ATTEMPTS", "0")
+	assertInvalid(t, "WKSPH_OUTBOX_RETRY_DELAY_MILLIS", "0")
+	assertInvalid(t, "WKSPH_OUTBOX_MAX_RETRY_DELAY_MILLIS", "1000")
+	assertInvalid(t, "WKSPH_DELETION_GRACE_PERIOD_MILLIS", "-1")
+	assertInvalid(t, "WKSPH_DELETION_PURGE_INTERVAL_MILLIS", "0")
+	assertInvalid(t, "WKSPH_TWO_FACTOR_ISSUER", "Wiki:sophia")
+	assertInvalid(t, "WKSPH_TWO_FACTOR_CHALLENGE_EXPIRY_MILLIS", "0")
 	assertInvalid(t, "WKSPH_ACCOUNTS_STORE_TYPE", "invalid")
 	assertInvalid(t, "WKSPH_ACCOUNTS_STORE_POSTGRES_PORT", "foo")
 	assertInvalid(t, "WKSPH_ACCOUNTS_STORE_POSTGRES_PORT", "-3")
@@ -170,6 +535,11 @@ func TestInvalidEnvironment(t *testing.T) {
 	assertInvalid(t, "WKSPH_ARGUMENTS_STORE_POSTGRES_PORT", "foo")
 	assertInvalid(t, "WKSPH_ARGUMENTS_STORE_POSTGRES_PORT", "-3")
 	assertInvalid(t, "WKSPH_ARGUMENTS_STORE_POSTGRES_PORT", "0")
+	assertInvalid(t, "WKSPH_ARGUMENTS_STORE_MIGRATE_ON_STARTUP", "notABool")
+	assertInvalid(t, "WKSPH_ACCOUNTS_STORE_POSTGRES_STATEMENT_TIMEOUT_MILLIS", "-1")
+	assertInvalid(t, "WKSPH_ARGUMENTS_STORE_POSTGRES_STATEMENT_TIMEOUT_MILLIS", "-1")
+	assertInvalid(t, "WKSPH_ACCOUNTS_STORE_MEMORY_SNAPSHOT_INTERVAL_MILLIS", "0")
+	assertInvalid(t, "WKSPH_ARGUMENTS_STORE_MEMORY_SNAPSHOT_INTERVAL_MILLIS", "notAnInt")
 	assertInvalid(t, "WKSPH_HASH_ITERATIONS", fmt.Sprintf("%d", uint64(^uint32(0))+1))
 	assertInvalid(t, "WKSPH_HASH_ITERATIONS", "-1")
 	assertInvalid(t, "WKSPH_HASH_MEMORY_BYTES", "notAnInt")
@@ -186,6 +556,37 @@ func TestInvalidEnvironment(t *testing.T) {
 	assertInvalid(t, "WKSPH_HASH_KEY_LENGTH", "-1")
 }
 
+// TestSQLitePathsMustDiffer makes sure the two stores can't share a SQLite file.
+func TestSQLitePathsMustDiffer(t *testing.T) {
+	defer setEnv(t, "WKSPH_ACCOUNTS_STORE_TYPE", "sqlite")()
+	defer setEnv(t, "WKSPH_ARGUMENTS_STORE_TYPE", "sqlite")()
+	defer setEnv(t, "WKSPH_ACCOUNTS_STORE_SQLITE_PATH", "shared.db")()
+	defer setEnv(t, "WKSPH_ARGUMENTS_STORE_SQLITE_PATH", "shared.db")()
+	_, err := config.Parse()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "WKSPH_ARGUMENTS_STORE_SQLITE_PATH")
+}
+
+// TestSnapshotPathsMustDiffer makes sure the two memory stores can't share a snapshot file.
+func TestSnapshotPathsMustDiffer(t *testing.T) {
+	defer setEnv(t, "WKSPH_ACCOUNTS_STORE_MEMORY_SNAPSHOT_PATH", "shared.json")()
+	defer setEnv(t, "WKSPH_ARGUMENTS_STORE_MEMORY_SNAPSHOT_PATH", "shared.json")()
+	_, err := config.Parse()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "WKSPH_ARGUMENTS_STORE_MEMORY_SNAPSHOT_PATH")
+}
+
+// TestRouteTimeout makes sure WKSPH_SERVER_ROUTE_TIMEOUTS only affects the routes it names.
+func TestRouteTimeout(t *testing.T) {
+	defer setEnv(t, "WKSPH_SERVER_REQUEST_TIMEOUT_MILLIS", "1000")()
+	defer setEnv(t, "WKSPH_SERVER_ROUTE_TIMEOUTS", "POST /sessions=20000")()
+	cfg, err := config.Parse()
+	require.NoError(t, err)
+	assert.Equal(t, 20*time.Second, cfg.Server.RouteTimeout("POST", "/sessions"))
+	assert.Equal(t, time.Second, cfg.Server.RouteTimeout("GET", "/sessions"))
+	assert.Equal(t, time.Second, cfg.Server.RouteTimeout("POST", "/arguments"))
+}
+
 func TestEdgeCases(t *testing.T) {
 	assertStringSliceParses(t, "WKSPH_SERVER_CORS_ALLOWED_ORIGINS", nil, func(cfg config.Configuration) []string {
 		return cfg.Server.CorsAllowedOrigins
@@ -248,6 +649,33 @@ func assertUInt32Parses(t *testing.T, env string, value uint32, getter func(cfg
 	assert.EqualValues(t, getter(cfg), value)
 }
 
+// TestSMTPValidatedWhenUsed makes sure the SMTP settings are only checked if emails are sent with SMTP.
+func TestSMTPValidatedWhenUsed(t *testing.T) {
+	func() {
+		defer setEnv(t, "WKSPH_EMAIL_SMTP_PORT", "0")()
+		_, err := config.Parse()
+		assert.NoError(t, err)
+	}()
+
+	defer setEnv(t, "WKSPH_EMAIL_TYPE", "smtp")()
+	assertInvalid(t, "WKSPH_EMAIL_SMTP_PORT", "0")
+	assertInvalid(t, "WKSPH_EMAIL_SMTP_PORT", "65536")
+	assertInvalid(t, "WKSPH_EMAIL_SMTP_TLS", "ssl")
+	assertInvalid(t, "WKSPH_EMAIL_SMTP_TIMEOUT_MILLIS", "0")
+}
+
+// TestEmailFileDirValidatedWhenUsed makes sure the file emailer has somewhere to write.
+func TestEmailFileDirValidatedWhenUsed(t *testing.T) {
+	func() {
+		defer setEnv(t, "WKSPH_EMAIL_FILE_DIR", "")()
+		_, err := config.Parse()
+		assert.NoError(t, err)
+	}()
+
+	defer setEnv(t, "WKSPH_EMAIL_TYPE", "file")()
+	assertInvalid(t, "WKSPH_EMAIL_FILE_DIR", "")
+}
+
 func assertInvalid(t *testing.T, env string, value string) {
 	t.Helper()
 	defer setEnv(t, env, value)()
@@ -0,0 +1,46 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Redacted replaces the values of secret config variables.
+const Redacted = "REDACTED"
+
+// Values returns every config value, keyed by its environment variable.
+// Variables with "PASSWORD" or "SECRET" in their names are Redacted.
+func (cfg *Configuration) Values() map[string]interface{} {
+	values := make(map[string]interface{})
+	collectValues(prefix, reflect.ValueOf(cfg).Elem(), values)
+	return values
+}
+
+func collectValues(environment string, value reflect.Value, values map[string]interface{}) {
+	for i := 0; i < value.NumField(); i++ {
+		tag := value.Type().Field(i).Tag.Get("environment")
+		if tag == "" {
+			continue
+		}
+		fieldEnvironment := environment + "_" + tag
+		field := value.Field(i)
+		if field.Kind() == reflect.Ptr {
+			if field.IsNil() {
+				continue
+			}
+			field = field.Elem()
+		}
+		switch {
+		case field.Kind() == reflect.Struct:
+			collectValues(fieldEnvironment, field, values)
+		case isSecret(fieldEnvironment):
+			values[fieldEnvironment] = Redacted
+		default:
+			values[fieldEnvironment] = field.Interface()
+		}
+	}
+}
+
+func isSecret(environment string) bool {
+	return strings.Contains(environment, "PASSWORD") || strings.Contains(environment, "SECRET")
+}
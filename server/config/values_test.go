@@ -0,0 +1,24 @@
+package config_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wikisophia/api/server/config"
+)
+
+func TestValuesRedactsSecrets(t *testing.T) {
+	cfg := config.Defaults()
+	cfg.AccountsStore.Postgres.Password = "hunter2"
+	cfg.ArgumentsStore.Postgres.MigrationPassword = "hunter3"
+	values := cfg.Values()
+
+	assert.Equal(t, ":8001", values["WKSPH_SERVER_ADDR"])
+	assert.Equal(t, uint16(5432), values["WKSPH_ACCOUNTS_STORE_POSTGRES_PORT"])
+	assert.Equal(t, config.Redacted, values["WKSPH_ACCOUNTS_STORE_POSTGRES_PASSWORD"])
+	assert.Equal(t, config.Redacted, values["WKSPH_ARGUMENTS_STORE_POSTGRES_MIGRATION_PASSWORD"])
+	for _, value := range values {
+		assert.NotEqual(t, "hunter2", value)
+		assert.NotEqual(t, "hunter3", value)
+	}
+}
@@ -0,0 +1,146 @@
+// Package dump copies account and argument data in and out of the Stores as JSON.
+//
+// This lets ops back up a Store, or move the data from one storage backend to another.
+package dump
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/arguments"
+)
+
+// Dump is the contract class for dump files.
+type Dump struct {
+	Accounts  []accounts.StoredAccount `json:"accounts"`
+	Arguments []ArgumentHistory        `json:"arguments"`
+}
+
+// ArgumentHistory has every version of a single argument, starting with version 1.
+type ArgumentHistory struct {
+	ID       int64             `json:"id"`
+	Versions []ArgumentVersion `json:"versions"`
+	// DeletedAt is when the argument was deleted, or nil if it's still live.
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+}
+
+// ArgumentVersion is one version of an argument. It saves the AuthorID too,
+// which arguments.Argument leaves out of its JSON.
+type ArgumentVersion struct {
+	arguments.Argument
+	AuthorID int64 `json:"authorId,omitempty"`
+}
+
+// newArgumentVersion moves the argument's AuthorID into the ArgumentVersion, so that dumps are the same
+// after they've been written and read.
+func newArgumentVersion(argument arguments.Argument) ArgumentVersion {
+	authorID := argument.AuthorID
+	argument.AuthorID = 0
+	return ArgumentVersion{Argument: argument, AuthorID: authorID}
+}
+
+// argument returns the version with its AuthorID set.
+func (v ArgumentVersion) argument() arguments.Argument {
+	argument := v.Argument
+	argument.AuthorID = v.AuthorID
+	return argument
+}
+
+// Take reads everything out of the stores, including deleted arguments.
+func Take(ctx context.Context, accountsStore accounts.Exporter, argumentsStore arguments.Exporter) (Dump, error) {
+	exported, err := accountsStore.ExportAccounts(ctx)
+	if err != nil {
+		return Dump{}, err
+	}
+	stored, err := argumentsStore.ExportArguments(ctx)
+	if err != nil {
+		return Dump{}, fmt.Errorf("failed to export arguments: %v", err)
+	}
+
+	histories := make([]ArgumentHistory, 0, len(stored))
+	for _, argument := range stored {
+		history := ArgumentHistory{
+			ID:        argument.ID,
+			Versions:  make([]ArgumentVersion, 0, len(argument.Versions)),
+			DeletedAt: argument.DeletedAt,
+		}
+		for _, version := range argument.Versions {
+			history.Versions = append(history.Versions, newArgumentVersion(version))
+		}
+		histories = append(histories, history)
+	}
+
+	return Dump{
+		Accounts:  exported,
+		Arguments: histories,
+	}, nil
+}
+
+// Restore loads a Dump into empty stores. Accounts and arguments keep their IDs,
+// and deleted arguments stay deleted.
+//
+// If either store already has data, nothing is restored. The accounts and arguments are each
+// restored in a single transaction, so a failure part way through leaves at most one of them restored.
+// The accounts go first.
+func Restore(ctx context.Context, dump Dump, accountsStore accounts.Exporter, argumentsStore arguments.Exporter) error {
+	// The stores would refuse the import anyway, but checking both first
+	// keeps the accounts from being restored when the arguments can't be.
+	existingAccounts, err := accountsStore.ExportAccounts(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check for existing accounts: %v", err)
+	}
+	if len(existingAccounts) > 0 {
+		return accounts.StoreNotEmptyError{}
+	}
+	existingArguments, err := argumentsStore.ExportArguments(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check for existing arguments: %v", err)
+	}
+	if len(existingArguments) > 0 {
+		return &arguments.StoreNotEmptyError{}
+	}
+
+	imported := make([]arguments.StoredArgument, 0, len(dump.Arguments))
+	for _, history := range dump.Arguments {
+		if len(history.Versions) == 0 {
+			return fmt.Errorf("argument %d has no versions", history.ID)
+		}
+		argument := arguments.StoredArgument{
+			ID:        history.ID,
+			Versions:  make([]arguments.Argument, 0, len(history.Versions)),
+			DeletedAt: history.DeletedAt,
+		}
+		for _, version := range history.Versions {
+			argument.Versions = append(argument.Versions, version.argument())
+		}
+		imported = append(imported, argument)
+	}
+
+	if err := accountsStore.ImportAccounts(ctx, dump.Accounts); err != nil {
+		return fmt.Errorf("failed to restore accounts: %v", err)
+	}
+	if err := argumentsStore.ImportArguments(ctx, imported); err != nil {
+		return fmt.Errorf("failed to restore arguments: %v", err)
+	}
+	return nil
+}
+
+// Write encodes the dump as JSON.
+func Write(w io.Writer, dump Dump) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(dump)
+}
+
+// Read decodes a dump which was written by Write.
+func Read(r io.Reader) (Dump, error) {
+	var dump Dump
+	if err := json.NewDecoder(r).Decode(&dump); err != nil {
+		return Dump{}, fmt.Errorf("malformed dump file: %v", err)
+	}
+	return dump, nil
+}
@@ -0,0 +1,119 @@
+package dump_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wikisophia/api/server/acceptancetest"
+	"github.com/wikisophia/api/server/accounts"
+	accountsMemory "github.com/wikisophia/api/server/accounts/memory"
+	"github.com/wikisophia/api/server/arguments"
+	argumentsMemory "github.com/wikisophia/api/server/arguments/memory"
+	"github.com/wikisophia/api/server/dump"
+)
+
+const samplesPath = "../samples/"
+
+func TestDumpRestoreRoundtrip(t *testing.T) {
+	ctx := context.Background()
+	accountsStore := accountsMemory.NewMemoryStore()
+	argumentsStore := argumentsMemory.NewMemoryStore()
+
+	account, _, err := accountsStore.NewResetToken(ctx, "email@soph.wiki")
+	require.NoError(t, err)
+	require.NoError(t, accountsStore.SetForgottenPassword(ctx, account.ID, "password", account.ResetToken))
+
+	original := acceptancetest.ParseSample(t, samplesPath+"save-request.json")
+	original.AuthorID = account.ID
+	updated := acceptancetest.ParseSample(t, samplesPath+"update-request.json")
+	deletedID, err := argumentsStore.Save(ctx, original)
+	require.NoError(t, err)
+	require.NoError(t, argumentsStore.Delete(ctx, deletedID))
+	id, err := argumentsStore.Save(ctx, original)
+	require.NoError(t, err)
+	updated.ID = id
+	_, err = argumentsStore.Update(ctx, updated)
+	require.NoError(t, err)
+
+	taken, err := dump.Take(ctx, accountsStore, argumentsStore)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, dump.Write(&buf, taken))
+	read, err := dump.Read(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, taken, read)
+
+	restoredAccounts := accountsMemory.NewMemoryStore()
+	restoredArguments := argumentsMemory.NewMemoryStore()
+	require.NoError(t, dump.Restore(ctx, read, restoredAccounts, restoredArguments))
+
+	authed, err := restoredAccounts.Authenticate(ctx, "email@soph.wiki", "password")
+	require.NoError(t, err)
+	assert.Equal(t, account.ID, authed)
+
+	restored, err := restoredArguments.FetchSome(ctx, arguments.FetchSomeOptions{})
+	require.NoError(t, err)
+	require.Len(t, restored, 1)
+	assert.Equal(t, id, restored[0].ID)
+	assert.Equal(t, updated.Conclusion, restored[0].Conclusion)
+	assert.Equal(t, updated.Premises, restored[0].Premises)
+	assert.Equal(t, 2, restored[0].Version)
+	first, err := restoredArguments.FetchVersion(ctx, restored[0].ID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, original.Conclusion, first.Conclusion)
+	assert.Equal(t, account.ID, first.AuthorID)
+	assert.Zero(t, restored[0].AuthorID)
+
+	_, err = restoredArguments.FetchLive(ctx, deletedID)
+	assert.IsType(t, &arguments.NotFoundError{}, err)
+	exported, err := restoredArguments.ExportArguments(ctx)
+	require.NoError(t, err)
+	require.Len(t, exported, 2)
+	assert.Equal(t, deletedID, exported[0].ID)
+	assert.NotNil(t, exported[0].DeletedAt)
+}
+
+func TestRestoreRefusesNonEmptyStores(t *testing.T) {
+	ctx := context.Background()
+	accountsStore := accountsMemory.NewMemoryStore()
+	account, _, err := accountsStore.NewResetToken(ctx, "email@soph.wiki")
+	require.NoError(t, err)
+	argumentsStore := argumentsMemory.NewMemoryStore()
+	_, err = argumentsStore.Save(ctx, acceptancetest.ParseSample(t, samplesPath+"save-request.json"))
+	require.NoError(t, err)
+	taken, err := dump.Take(ctx, accountsStore, argumentsStore)
+	require.NoError(t, err)
+
+	err = dump.Restore(ctx, taken, accountsStore, argumentsMemory.NewMemoryStore())
+	assert.True(t, errors.As(err, &accounts.StoreNotEmptyError{}))
+
+	// The arguments are checked before anything is restored, so the accounts store stays empty.
+	emptyAccounts := accountsMemory.NewMemoryStore()
+	err = dump.Restore(ctx, taken, emptyAccounts, argumentsStore)
+	assert.IsType(t, &arguments.StoreNotEmptyError{}, err)
+	_, err = emptyAccounts.AccountProfile(ctx, account.ID)
+	assert.True(t, errors.As(err, &accounts.AccountNotExistsError{}))
+}
+
+func TestSeedSamples(t *testing.T) {
+	paths, err := filepath.Glob(filepath.FromSlash(samplesPath + "*.json"))
+	require.NoError(t, err)
+	store := argumentsMemory.NewMemoryStore()
+	saved, err := dump.Seed(context.Background(), store, paths...)
+	require.NoError(t, err)
+
+	fetched, err := store.FetchSome(context.Background(), arguments.FetchSomeOptions{})
+	require.NoError(t, err)
+	assert.Len(t, fetched, saved)
+	assert.Equal(t, 7, saved)
+}
+
+func TestSeedRejectsUnknownShapes(t *testing.T) {
+	_, err := dump.Seed(context.Background(), argumentsMemory.NewMemoryStore(), samplesPath+"README.md")
+	assert.Error(t, err)
+}
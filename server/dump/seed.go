@@ -0,0 +1,61 @@
+package dump
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/wikisophia/api/server/arguments"
+)
+
+// Seed saves all the arguments in the fixture files at the given paths.
+// It returns the number of arguments which were saved.
+//
+// Fixtures may use any of the shapes in the samples directory: a bare argument,
+// {"argument": {...}}, or {"arguments": [...]}.
+func Seed(ctx context.Context, saver arguments.Saver, paths ...string) (int, error) {
+	saved := 0
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return saved, err
+		}
+		args, err := parseFixture(data)
+		if err != nil {
+			return saved, fmt.Errorf("bad fixture %s: %v", path, err)
+		}
+		for _, arg := range args {
+			if err := arg.Validate(); err != nil {
+				return saved, fmt.Errorf("bad fixture %s: %v", path, err)
+			}
+			if _, err := saver.Save(ctx, arg); err != nil {
+				return saved, fmt.Errorf("failed to save argument from %s: %v", path, err)
+			}
+			saved++
+		}
+	}
+	return saved, nil
+}
+
+func parseFixture(data []byte) ([]arguments.Argument, error) {
+	var fixture struct {
+		arguments.Argument
+		One  *arguments.Argument  `json:"argument"`
+		Many []arguments.Argument `json:"arguments"`
+	}
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		return nil, err
+	}
+	switch {
+	case len(fixture.Many) > 0:
+		return fixture.Many, nil
+	case fixture.One != nil:
+		return []arguments.Argument{*fixture.One}, nil
+	case fixture.Conclusion != "":
+		return []arguments.Argument{fixture.Argument}, nil
+	default:
+		return nil, errors.New("no arguments found")
+	}
+}
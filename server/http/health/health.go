@@ -0,0 +1,99 @@
+// Package health tells orchestrators whether the server is alive, and whether it should get traffic.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/wikisophia/api/server/logging"
+)
+
+// Check is something which must work for the server to handle requests.
+type Check struct {
+	// Name identifies the check in the /readyz response, like "accounts_store".
+	Name string
+	Ping func(ctx context.Context) error
+}
+
+// Pinger is implemented by the stores which connect to a database.
+type Pinger interface {
+	// Ping makes sure the database is reachable.
+	Ping(ctx context.Context) error
+}
+
+// The values of Response.Status and the statuses in Response.Checks.
+const (
+	StatusOK       = "ok"
+	StatusFailing  = "failing"
+	StatusDraining = "draining"
+)
+
+// Response is the body of /healthz and /readyz responses.
+type Response struct {
+	Status string `json:"status"`
+	// Checks has the status of each Check, by name. It's only set by /readyz.
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// Checker serves /healthz and /readyz.
+type Checker struct {
+	checks   []Check
+	draining atomic.Bool
+}
+
+// NewChecker makes a Checker which runs all the checks on each /readyz request.
+func NewChecker(checks ...Check) *Checker {
+	return &Checker{
+		checks: checks,
+	}
+}
+
+// Drain makes /readyz fail from now on, so that load balancers stop sending new requests.
+// Call it when the server starts shutting down.
+func (c *Checker) Drain() {
+	c.draining.Store(true)
+}
+
+// Live handles GET /healthz. It succeeds as long as the process can respond.
+func (c *Checker) Live(w http.ResponseWriter, r *http.Request) {
+	writeResponse(w, http.StatusOK, Response{
+		Status: StatusOK,
+	})
+}
+
+// Ready handles GET /readyz. It responds with a 503 if any Check fails, or if the server is draining.
+// Failures are logged rather than returned, since they may include connection details.
+func (c *Checker) Ready(w http.ResponseWriter, r *http.Request) {
+	response := Response{
+		Status: StatusOK,
+		Checks: make(map[string]string, len(c.checks)),
+	}
+	for _, check := range c.checks {
+		if err := check.Ping(r.Context()); err != nil {
+			logging.FromContext(r.Context()).Warn("readiness check failed", slog.String("check", check.Name), slog.Any("error", err))
+			response.Status = StatusFailing
+			response.Checks[check.Name] = StatusFailing
+		} else {
+			response.Checks[check.Name] = StatusOK
+		}
+	}
+	if c.draining.Load() {
+		response.Status = StatusDraining
+	}
+
+	status := http.StatusOK
+	if response.Status != StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	writeResponse(w, status, response)
+}
+
+func writeResponse(w http.ResponseWriter, status int, response Response) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
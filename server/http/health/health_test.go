@@ -0,0 +1,80 @@
+package health_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wikisophia/api/server/http/health"
+)
+
+func TestLive(t *testing.T) {
+	checker := health.NewChecker(failingCheck("accounts_store"))
+	checker.Drain()
+	rr := httptest.NewRecorder()
+	checker.Live(rr, httptest.NewRequest("GET", "/healthz", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, health.Response{Status: health.StatusOK}, parseResponse(t, rr))
+}
+
+func TestReady(t *testing.T) {
+	rr := httptest.NewRecorder()
+	health.NewChecker(passingCheck("accounts_store"), passingCheck("arguments_store")).Ready(rr, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, health.Response{
+		Status: health.StatusOK,
+		Checks: map[string]string{
+			"accounts_store":  health.StatusOK,
+			"arguments_store": health.StatusOK,
+		},
+	}, parseResponse(t, rr))
+}
+
+func TestNotReadyIfCheckFails(t *testing.T) {
+	rr := httptest.NewRecorder()
+	health.NewChecker(passingCheck("accounts_store"), failingCheck("arguments_store")).Ready(rr, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Equal(t, health.Response{
+		Status: health.StatusFailing,
+		Checks: map[string]string{
+			"accounts_store":  health.StatusOK,
+			"arguments_store": health.StatusFailing,
+		},
+	}, parseResponse(t, rr))
+	assert.NotContains(t, rr.Body.String(), "connection refused")
+}
+
+func TestNotReadyWhileDraining(t *testing.T) {
+	checker := health.NewChecker(passingCheck("accounts_store"))
+	checker.Drain()
+	rr := httptest.NewRecorder()
+	checker.Ready(rr, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Equal(t, health.StatusDraining, parseResponse(t, rr).Status)
+}
+
+func passingCheck(name string) health.Check {
+	return health.Check{
+		Name: name,
+		Ping: func(ctx context.Context) error { return nil },
+	}
+}
+
+func failingCheck(name string) health.Check {
+	return health.Check{
+		Name: name,
+		Ping: func(ctx context.Context) error { return errors.New("dial tcp: connection refused") },
+	}
+}
+
+func parseResponse(t *testing.T, rr *httptest.ResponseRecorder) health.Response {
+	t.Helper()
+	var response health.Response
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	return response
+}
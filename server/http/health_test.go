@@ -0,0 +1,30 @@
+package http_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	accountsMemory "github.com/wikisophia/api/server/accounts/memory"
+	"github.com/wikisophia/api/server/http/health"
+)
+
+func TestHealthz(t *testing.T) {
+	server, _ := newLoggedServer(t, accountsMemory.NewMemoryStore())
+	rr := httptest.NewRecorder()
+	server.Handle(rr, httptest.NewRequest("GET", "/healthz", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestReadyzChecksKey(t *testing.T) {
+	server, _ := newLoggedServer(t, accountsMemory.NewMemoryStore())
+	rr := httptest.NewRecorder()
+	server.Handle(rr, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var response health.Response
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, health.StatusOK, response.Checks["jwt_key"])
+}
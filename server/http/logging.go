@@ -0,0 +1,95 @@
+package http
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/wikisophia/api/server/logging"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader identifies a request in the logs.
+// Clients and proxies may send one. Otherwise, the server makes one up.
+// Either way, it's echoed in the response.
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID limits the IDs which clients can choose, so that they can't garble the logs.
+var validRequestID = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,128}$`)
+
+// logRequests gives each request an ID and a logger, and logs a summary once it's done.
+// If the request is being traced, its lines include the trace ID.
+func logRequests(logger *slog.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		requestLogger := logger.With(slog.String("request_id", id))
+		if spanContext := trace.SpanContextFromContext(r.Context()); spanContext.IsValid() {
+			requestLogger = requestLogger.With(slog.String("trace_id", spanContext.TraceID().String()))
+		}
+		r = r.WithContext(logging.NewContext(r.Context(), requestLogger))
+		recorder := &responseRecorder{
+			ResponseWriter: w,
+			status:         http.StatusOK,
+		}
+		next.ServeHTTP(recorder, r)
+
+		route, accountID := logging.Details(r.Context())
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("route", route),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", recorder.status),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.Int64("bytes", recorder.bytes),
+		}
+		if accountID != 0 {
+			attrs = append(attrs, slog.Int64("account_id", accountID))
+		}
+		level := slog.LevelInfo
+		if recorder.status >= 500 {
+			level = slog.LevelError
+		}
+		requestLogger.LogAttrs(r.Context(), level, "request", attrs...)
+	})
+}
+
+func newRequestID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		// crypto/rand doesn't fail on the platforms we support, and the ID isn't a secret anyway.
+		return "unknown"
+	}
+	return hex.EncodeToString(id)
+}
+
+// responseRecorder remembers the status and size of a response.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(data)
+	r.bytes += int64(n)
+	return n, err
+}
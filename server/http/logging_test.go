@@ -0,0 +1,94 @@
+package http_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	accountsMemory "github.com/wikisophia/api/server/accounts/memory"
+	argumentsMemory "github.com/wikisophia/api/server/arguments/memory"
+	"github.com/wikisophia/api/server/config"
+	wikisophiaHttp "github.com/wikisophia/api/server/http"
+)
+
+func TestRequestIDGenerated(t *testing.T) {
+	server, logs := newLoggedServer(t, accountsMemory.NewMemoryStore())
+	rr := httptest.NewRecorder()
+	server.Handle(rr, httptest.NewRequest("GET", "/arguments/1", nil))
+
+	id := rr.Header().Get(wikisophiaHttp.RequestIDHeader)
+	assert.Len(t, id, 32)
+	line := parseLogLine(t, logs)
+	assert.Equal(t, id, line["request_id"])
+	assert.Equal(t, "GET", line["method"])
+	assert.Equal(t, "/arguments/:id", line["route"])
+	assert.Equal(t, "/arguments/1", line["path"])
+	assert.EqualValues(t, http.StatusNotFound, line["status"])
+	assert.EqualValues(t, rr.Body.Len(), line["bytes"])
+	assert.Contains(t, line, "latency_ms")
+	assert.NotContains(t, line, "account_id")
+}
+
+func TestRequestIDPropagated(t *testing.T) {
+	server, logs := newLoggedServer(t, accountsMemory.NewMemoryStore())
+	req := httptest.NewRequest("GET", "/arguments", nil)
+	req.Header.Set(wikisophiaHttp.RequestIDHeader, "from-the-proxy.123")
+	rr := httptest.NewRecorder()
+	server.Handle(rr, req)
+
+	assert.Equal(t, "from-the-proxy.123", rr.Header().Get(wikisophiaHttp.RequestIDHeader))
+	assert.Equal(t, "from-the-proxy.123", parseLogLine(t, logs)["request_id"])
+}
+
+func TestUnsafeRequestIDReplaced(t *testing.T) {
+	server, _ := newLoggedServer(t, accountsMemory.NewMemoryStore())
+	req := httptest.NewRequest("GET", "/arguments", nil)
+	req.Header.Set(wikisophiaHttp.RequestIDHeader, "bad\nid")
+	rr := httptest.NewRecorder()
+	server.Handle(rr, req)
+	assert.Len(t, rr.Header().Get(wikisophiaHttp.RequestIDHeader), 32)
+}
+
+func TestAccountIDLogged(t *testing.T) {
+	accountsStore := accountsMemory.NewMemoryStore()
+	account, _, err := accountsStore.NewResetToken(context.Background(), "some-email@soph.wiki")
+	require.NoError(t, err)
+	require.NoError(t, accountsStore.SetForgottenPassword(context.Background(), account.ID, "some-password", account.ResetToken))
+
+	server, logs := newLoggedServer(t, accountsStore)
+	rr := httptest.NewRecorder()
+	server.Handle(rr, httptest.NewRequest("POST", "/sessions", strings.NewReader(`{"email":"some-email@soph.wiki","password":"some-password"}`)))
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.EqualValues(t, account.ID, parseLogLine(t, logs)["account_id"])
+}
+
+func newLoggedServer(t *testing.T, accountsStore wikisophiaHttp.AccountsStore) (*wikisophiaHttp.Server, *bytes.Buffer) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+	logs := &bytes.Buffer{}
+	server := wikisophiaHttp.NewServer(*config.Defaults().Server, key, wikisophiaHttp.ServerDependencies{
+		AccountsStore:  accountsStore,
+		ArgumentsStore: argumentsMemory.NewMemoryStore(),
+	}, wikisophiaHttp.Options{
+		Logger: slog.New(slog.NewJSONHandler(logs, nil)),
+	})
+	return server, logs
+}
+
+func parseLogLine(t *testing.T, logs *bytes.Buffer) map[string]interface{} {
+	t.Helper()
+	var line map[string]interface{}
+	require.NoError(t, json.Unmarshal(logs.Bytes(), &line))
+	return line
+}
@@ -0,0 +1,36 @@
+package http
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/wikisophia/api/server/logging"
+	"github.com/wikisophia/api/server/metrics"
+)
+
+// countRequests records the metrics for each request.
+// It relies on logRequests to put the route on the context, so it must be inside it.
+func countRequests(httpMetrics *metrics.HTTP, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &responseRecorder{
+			ResponseWriter: w,
+			status:         http.StatusOK,
+		}
+		next.ServeHTTP(recorder, r)
+		route, _ := logging.Details(r.Context())
+		httpMetrics.Observe(methodLabel(r.Method), route, recorder.status, time.Since(start))
+	})
+}
+
+// methodLabel returns the method for the metrics, or "OTHER" if it isn't a standard one.
+// Clients can send any method they like, and each label value makes a new time series.
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	default:
+		return "OTHER"
+	}
+}
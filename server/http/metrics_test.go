@@ -0,0 +1,63 @@
+package http_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	accountsMemory "github.com/wikisophia/api/server/accounts/memory"
+	argumentsMemory "github.com/wikisophia/api/server/arguments/memory"
+	"github.com/wikisophia/api/server/config"
+	wikisophiaHttp "github.com/wikisophia/api/server/http"
+	"github.com/wikisophia/api/server/metrics"
+)
+
+func TestRequestsCounted(t *testing.T) {
+	registry := metrics.NewRegistry()
+	server := newMeteredServer(t, registry)
+	server.Handle(httptest.NewRecorder(), httptest.NewRequest("GET", "/arguments/1", nil))
+
+	rr := httptest.NewRecorder()
+	metrics.Handler(registry).ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(t, rr.Body.String(), `wikisophia_http_requests_total{method="GET",route="/arguments/:id",status="404"} 1`)
+}
+
+func TestUnknownMethodsGrouped(t *testing.T) {
+	registry := metrics.NewRegistry()
+	server := newMeteredServer(t, registry)
+	server.Handle(httptest.NewRecorder(), httptest.NewRequest("BREW", "/arguments/1", nil))
+	server.Handle(httptest.NewRecorder(), httptest.NewRequest("WHEN", "/arguments/1", nil))
+
+	rr := httptest.NewRecorder()
+	metrics.Handler(registry).ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(t, rr.Body.String(), `method="OTHER"`)
+	assert.NotContains(t, rr.Body.String(), `method="BREW"`)
+	assert.NotContains(t, rr.Body.String(), `method="WHEN"`)
+}
+
+func TestMetricsNotServedByAPI(t *testing.T) {
+	rr := httptest.NewRecorder()
+	newMeteredServer(t, metrics.NewRegistry()).Handle(rr, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func newMeteredServer(t *testing.T, registry *prometheus.Registry) *wikisophiaHttp.Server {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+	return wikisophiaHttp.NewServer(*config.Defaults().Server, key, wikisophiaHttp.ServerDependencies{
+		AccountsStore:  accountsMemory.NewMemoryStore(),
+		ArgumentsStore: argumentsMemory.NewMemoryStore(),
+	}, wikisophiaHttp.Options{
+		Logger:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Registry: registry,
+	})
+}
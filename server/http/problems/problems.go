@@ -0,0 +1,142 @@
+// Package problems writes error responses in the application/problem+json format from RFC 7807.
+//
+// Every response has a stable Code which clients can rely on, and a Detail meant for humans.
+// Details may be reworded at any time, so clients shouldn't parse them.
+package problems
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/wikisophia/api/server/logging"
+)
+
+// ContentType is the Content-Type header of every error response.
+const ContentType = "application/problem+json"
+
+// Code is a machine-readable description of what went wrong.
+type Code string
+
+const (
+	// CodeMalformedRequest means the request body couldn't be read, or wasn't valid JSON.
+	CodeMalformedRequest Code = "malformed_request"
+	// CodeValidationFailed means the request was well-formed, but some of its values weren't allowed.
+	// The Problem's Errors say which ones.
+	CodeValidationFailed Code = "validation_failed"
+	// CodeNotFound means the requested resource doesn't exist.
+	CodeNotFound Code = "not_found"
+	// CodeMethodNotAllowed means the path exists, but doesn't support the request's method.
+	CodeMethodNotAllowed Code = "method_not_allowed"
+	// CodePermissionDenied means the client's credentials were wrong, or don't allow the request.
+	CodePermissionDenied Code = "permission_denied"
+	// CodeAccountLocked means the account had too many failed logins, so its password and codes can't be used for a while.
+	// Logins with an email and password get CodePermissionDenied instead, so they don't reveal which emails have accounts.
+	// The Retry-After header says how many seconds until it's unlocked.
+	CodeAccountLocked Code = "account_locked"
+	// CodeEmailNotVerified means the account has to verify its email before it can do this.
+	// POST /accounts/verify/resend sends a new verification email.
+	CodeEmailNotVerified Code = "email_not_verified"
+	// CodeProhibitedPassword means the client tried to set a password which isn't allowed.
+	// The Problem's Errors say which rules it broke.
+	CodeProhibitedPassword Code = "prohibited_password"
+	// CodeEmailTaken means another account has the email which this one tried to move to.
+	CodeEmailTaken Code = "email_taken"
+	// CodeTwoFactorSetupRequired means the account must turn on two-factor auth before it can log in.
+	// POST /accounts/:id/two-factor sets it up, with the setupToken from the response in place of a session.
+	CodeTwoFactorSetupRequired Code = "two_factor_setup_required"
+	// CodeTwoFactorRequired means the account must keep two-factor auth on, so it can't turn it off.
+	CodeTwoFactorRequired Code = "two_factor_required"
+	// CodeTwoFactorCodeRequired means the password was right, but the account has two-factor auth on,
+	// so the request needs a code from the authenticator app, or a recovery code, as well.
+	CodeTwoFactorCodeRequired Code = "two_factor_code_required"
+	// CodeTwoFactorEnabled means the account tried to set up two-factor auth, but it's on already.
+	CodeTwoFactorEnabled Code = "two_factor_enabled"
+	// CodeStaleEmail means an admin tried to retry a dead email, but the account has changed so much since
+	// it was queued that its tokens can't be replaced. It can be left dead.
+	CodeStaleEmail Code = "stale_email"
+	// CodeTimeout means the request ran out of time before the server could finish it.
+	CodeTimeout Code = "timeout"
+	// CodeRequestCancelled means the request was cancelled before the server could finish it.
+	CodeRequestCancelled Code = "request_cancelled"
+	// CodeReadOnly means the server is in read-only mode for maintenance, so it can't change any data.
+	// The request may succeed if it's retried later.
+	CodeReadOnly Code = "read_only"
+	// CodeRateLimited means the client has made too many requests recently.
+	// The Retry-After header says how many seconds to wait before trying again.
+	CodeRateLimited Code = "rate_limited"
+	// CodeInternal means the server has a problem. The details are only logged.
+	CodeInternal Code = "internal_error"
+)
+
+// Problem is the response body for every error.
+type Problem struct {
+	// Type is always "about:blank". Clients should use the Code instead.
+	Type string `json:"type"`
+	// Title is the standard text for the HTTP Status.
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Code   Code   `json:"code"`
+	Detail string `json:"detail,omitempty"`
+	// Errors lists each bad value in the request, if the Code is CodeValidationFailed or CodeProhibitedPassword.
+	Errors []FieldError `json:"errors,omitempty"`
+	// SetupToken lets the account set up two-factor auth without a session, if the Code is CodeTwoFactorSetupRequired.
+	SetupToken string `json:"setupToken,omitempty"`
+}
+
+// FieldError describes a problem with one value in the request.
+type FieldError struct {
+	// Field is the name of the bad value, like "premises[1]" or "email".
+	Field  string `json:"field"`
+	Detail string `json:"detail"`
+}
+
+// Write responds with a Problem.
+func Write(w http.ResponseWriter, status int, code Code, detail string) {
+	WriteProblem(w, Problem{
+		Status: status,
+		Code:   code,
+		Detail: detail,
+	})
+}
+
+// WriteInvalid responds with a 400, listing every bad value in the request.
+func WriteInvalid(w http.ResponseWriter, detail string, errors []FieldError) {
+	WriteProblem(w, Problem{
+		Status: http.StatusBadRequest,
+		Code:   CodeValidationFailed,
+		Detail: detail,
+		Errors: errors,
+	})
+}
+
+// WriteInternal logs err and responds with a 500.
+// Errors like these often hold database details, so the client never sees them.
+func WriteInternal(w http.ResponseWriter, r *http.Request, err error) {
+	logging.FromContext(r.Context()).Error("request failed", slog.Any("error", err))
+	Write(w, http.StatusInternalServerError, CodeInternal, "An internal error occurred. Please try again later.")
+}
+
+// WriteProblem responds with p. Its Type and Title will be filled in if they're empty.
+func WriteProblem(w http.ResponseWriter, p Problem) {
+	if p.Type == "" {
+		p.Type = "about:blank"
+	}
+	if p.Title == "" {
+		p.Title = http.StatusText(p.Status)
+	}
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// NotFound handles requests for paths which don't exist.
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	Write(w, http.StatusNotFound, CodeNotFound, r.URL.Path+" does not exist")
+}
+
+// MethodNotAllowed handles requests for paths which don't support the method.
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	Write(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, r.Method+" is not supported on "+r.URL.Path)
+}
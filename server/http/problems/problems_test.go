@@ -0,0 +1,53 @@
+package problems_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wikisophia/api/server/http/problems"
+)
+
+func TestWrite(t *testing.T) {
+	rr := httptest.NewRecorder()
+	problems.Write(rr, http.StatusNotFound, problems.CodeNotFound, "argument 3 does not exist")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Equal(t, problems.ContentType, rr.Header().Get("Content-Type"))
+	assert.Equal(t, problems.Problem{
+		Type:   "about:blank",
+		Title:  "Not Found",
+		Status: http.StatusNotFound,
+		Code:   problems.CodeNotFound,
+		Detail: "argument 3 does not exist",
+	}, parseProblem(t, rr))
+}
+
+func TestWriteInvalid(t *testing.T) {
+	rr := httptest.NewRecorder()
+	problems.WriteInvalid(rr, "bad argument", []problems.FieldError{
+		{Field: "conclusion", Detail: "is required"},
+	})
+	problem := parseProblem(t, rr)
+	assert.Equal(t, http.StatusBadRequest, problem.Status)
+	assert.Equal(t, problems.CodeValidationFailed, problem.Code)
+	assert.Equal(t, []problems.FieldError{{Field: "conclusion", Detail: "is required"}}, problem.Errors)
+}
+
+func TestWriteInternalHidesDetails(t *testing.T) {
+	rr := httptest.NewRecorder()
+	problems.WriteInternal(rr, httptest.NewRequest("GET", "/arguments", nil), errors.New("pq: relation \"arguments\" does not exist"))
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.NotContains(t, rr.Body.String(), "relation")
+	assert.Equal(t, problems.CodeInternal, parseProblem(t, rr).Code)
+}
+
+func parseProblem(t *testing.T, rr *httptest.ResponseRecorder) problems.Problem {
+	t.Helper()
+	var problem problems.Problem
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &problem))
+	return problem
+}
@@ -0,0 +1,110 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often the MemoryLimiter forgets the buckets which have refilled.
+const sweepInterval = time.Minute
+
+// NewMemoryLimiter makes a Limiter which keeps the buckets in this process.
+// It uses now to tell the time. If now is nil, it uses time.Now.
+func NewMemoryLimiter(now func() time.Time) *MemoryLimiter {
+	if now == nil {
+		now = time.Now
+	}
+	return &MemoryLimiter{
+		buckets:   make(map[string]*bucket),
+		now:       now,
+		lastSweep: now(),
+	}
+}
+
+// MemoryLimiter is a Limiter for servers which run on a single machine.
+// It's safe to use from multiple goroutines.
+type MemoryLimiter struct {
+	mutex     sync.Mutex
+	buckets   map[string]*bucket
+	now       func() time.Time
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	limit   Limit
+}
+
+// Allow implements Limiter. It never returns an error.
+func (l *MemoryLimiter) Allow(ctx context.Context, key string, limit Limit) (bool, time.Duration, error) {
+	if limit.Unlimited() {
+		return true, 0, nil
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := l.now()
+	if now.Sub(l.lastSweep) >= sweepInterval {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{
+			tokens:  capacity(limit),
+			updated: now,
+		}
+		l.buckets[key] = b
+	}
+	b.limit = limit
+	b.refill(now)
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0, nil
+	}
+	return false, time.Duration((1 - b.tokens) * float64(tokenInterval(limit))), nil
+}
+
+// Len returns the number of buckets which the limiter is keeping track of.
+func (l *MemoryLimiter) Len() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return len(l.buckets)
+}
+
+// sweep forgets the full buckets, since a new one would be the same.
+// Without this, every client the server has ever seen would take up memory.
+func (l *MemoryLimiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		b.refill(now)
+		if b.tokens >= capacity(b.limit) {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+func (b *bucket) refill(now time.Time) {
+	elapsed := now.Sub(b.updated)
+	if elapsed <= 0 {
+		return
+	}
+	b.tokens += float64(elapsed) / float64(tokenInterval(b.limit))
+	if max := capacity(b.limit); b.tokens > max {
+		b.tokens = max
+	}
+	b.updated = now
+}
+
+func capacity(limit Limit) float64 {
+	if limit.Burst < 1 {
+		return 1
+	}
+	return float64(limit.Burst)
+}
+
+// tokenInterval is how long the bucket takes to gain one token.
+func tokenInterval(limit Limit) time.Duration {
+	return time.Minute / time.Duration(limit.PerMinute)
+}
@@ -0,0 +1,116 @@
+// Package ratelimit throttles clients which make too many requests, so that they can't
+// brute-force passwords or flood people with emails.
+//
+// Each client gets a token bucket for each group of routes. Every request takes a token,
+// and the buckets refill at a steady rate. Requests which find their bucket empty get a 429.
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/wikisophia/api/server/http/problems"
+	"github.com/wikisophia/api/server/logging"
+)
+
+// Limit describes a token bucket.
+type Limit struct {
+	// PerMinute is how many tokens the bucket gains each minute. If it's 0 or less, there's no limit.
+	PerMinute int
+	// Burst is how many tokens the bucket holds, which is the most requests a client can make at once.
+	// If it's less than 1, the bucket holds 1.
+	Burst int
+}
+
+// Unlimited is true if the Limit doesn't restrict anything.
+func (l Limit) Unlimited() bool {
+	return l.PerMinute <= 0
+}
+
+// Limiter keeps track of the buckets.
+//
+// The default is the MemoryLimiter. If the server runs on several machines, each one limits
+// its clients separately. Implement this with a shared store instead to limit them all together.
+type Limiter interface {
+	// Allow takes a token from the bucket named key. If the bucket is empty, it returns false,
+	// and how long the client should wait before trying again.
+	Allow(ctx context.Context, key string, limit Limit) (allowed bool, retryAfter time.Duration, err error)
+}
+
+// Rule limits a group of routes.
+type Rule struct {
+	// Group names the routes in the Limiter's keys, so that each group has its own buckets.
+	Group string
+	// PerIP limits each client IP address.
+	PerIP Limit
+	// PerAccount limits the requests which act on each account.
+	PerAccount Limit
+	// Account identifies the account which a request acts on, like its ID or email address.
+	// If it's nil or returns false, only PerIP applies.
+	Account func(r *http.Request, params httprouter.Params) (string, bool)
+}
+
+// WithLimits responds with a 429 instead of calling next if the client has used up any of the rule's limits.
+// If the limiter fails, the request is allowed, since an outage there shouldn't take down the API.
+func WithLimits(limiter Limiter, rule Rule, clientIP func(r *http.Request) string, next httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		if !rule.PerIP.Unlimited() {
+			if !allow(w, r, limiter, rule.Group+":ip:"+clientIP(r), rule.PerIP) {
+				return
+			}
+		}
+		if !rule.PerAccount.Unlimited() && rule.Account != nil {
+			if account, ok := rule.Account(r, params); ok {
+				if !allow(w, r, limiter, rule.Group+":account:"+account, rule.PerAccount) {
+					return
+				}
+			}
+		}
+		next(w, r, params)
+	}
+}
+
+// allow takes a token from the bucket, or responds with a 429 and returns false if it's empty.
+func allow(w http.ResponseWriter, r *http.Request, limiter Limiter, key string, limit Limit) bool {
+	allowed, retryAfter, err := limiter.Allow(r.Context(), key, limit)
+	if err != nil {
+		logging.FromContext(r.Context()).Warn("rate limiter failed", slog.String("key", key), slog.Any("error", err))
+		return true
+	}
+	if allowed {
+		return true
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	problems.Write(w, http.StatusTooManyRequests, problems.CodeRateLimited, "Too many requests. Please try again later.")
+	return false
+}
+
+// ClientIP returns a function which finds the address of the client which sent a request.
+//
+// If trustForwardedFor is true, it uses the last address in the X-Forwarded-For header,
+// which was added by the proxy in front of the server. Only turn it on behind a proxy which sets
+// the header, or clients could choose their own addresses.
+func ClientIP(trustForwardedFor bool) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		if trustForwardedFor {
+			if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+				addresses := strings.Split(forwarded[len(forwarded)-1], ",")
+				if address := strings.TrimSpace(addresses[len(addresses)-1]); address != "" {
+					return address
+				}
+			}
+		}
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			return r.RemoteAddr
+		}
+		return host
+	}
+}
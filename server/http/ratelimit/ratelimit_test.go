@@ -0,0 +1,146 @@
+package ratelimit_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wikisophia/api/server/http/problems"
+	"github.com/wikisophia/api/server/http/ratelimit"
+)
+
+func TestBurstThenRefill(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	limiter := ratelimit.NewMemoryLimiter(clock.Now)
+	limit := ratelimit.Limit{PerMinute: 6, Burst: 2}
+
+	assertAllowed(t, limiter, "key", limit)
+	assertAllowed(t, limiter, "key", limit)
+	allowed, retryAfter, err := limiter.Allow(context.Background(), "key", limit)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+	assert.Equal(t, 10*time.Second, retryAfter)
+
+	clock.now = clock.now.Add(4 * time.Second)
+	_, retryAfter, _ = limiter.Allow(context.Background(), "key", limit)
+	assert.Equal(t, 6*time.Second, retryAfter)
+
+	clock.now = clock.now.Add(6 * time.Second)
+	assertAllowed(t, limiter, "key", limit)
+}
+
+func TestKeysHaveSeparateBuckets(t *testing.T) {
+	limiter := ratelimit.NewMemoryLimiter(nil)
+	limit := ratelimit.Limit{PerMinute: 1, Burst: 1}
+	assertAllowed(t, limiter, "sessions:ip:192.0.2.1", limit)
+	assertAllowed(t, limiter, "sessions:ip:192.0.2.2", limit)
+	assertAllowed(t, limiter, "accounts:ip:192.0.2.1", limit)
+}
+
+func TestUnlimited(t *testing.T) {
+	limiter := ratelimit.NewMemoryLimiter(nil)
+	for i := 0; i < 100; i++ {
+		assertAllowed(t, limiter, "key", ratelimit.Limit{})
+	}
+	assert.Equal(t, 0, limiter.Len())
+}
+
+func TestFullBucketsForgotten(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	limiter := ratelimit.NewMemoryLimiter(clock.Now)
+	limit := ratelimit.Limit{PerMinute: 60, Burst: 5}
+	assertAllowed(t, limiter, "old", limit)
+	assert.Equal(t, 1, limiter.Len())
+
+	clock.now = clock.now.Add(2 * time.Minute)
+	assertAllowed(t, limiter, "new", limit)
+	assert.Equal(t, 1, limiter.Len())
+}
+
+func TestWithLimitsPerIP(t *testing.T) {
+	handle := ratelimit.WithLimits(ratelimit.NewMemoryLimiter(nil), ratelimit.Rule{
+		Group: "sessions",
+		PerIP: ratelimit.Limit{PerMinute: 1, Burst: 1},
+	}, ratelimit.ClientIP(false), okHandle)
+
+	assert.Equal(t, http.StatusNoContent, do(handle, "192.0.2.1:1234", nil).Code)
+	rr := do(handle, "192.0.2.1:5678", nil)
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, "60", rr.Header().Get("Retry-After"))
+	assert.Equal(t, problems.ContentType, rr.Header().Get("Content-Type"))
+	assert.Equal(t, http.StatusNoContent, do(handle, "192.0.2.2:1234", nil).Code)
+}
+
+func TestWithLimitsPerAccount(t *testing.T) {
+	handle := ratelimit.WithLimits(ratelimit.NewMemoryLimiter(nil), ratelimit.Rule{
+		Group:      "accounts",
+		PerIP:      ratelimit.Limit{PerMinute: 100, Burst: 100},
+		PerAccount: ratelimit.Limit{PerMinute: 1, Burst: 1},
+		Account: func(r *http.Request, params httprouter.Params) (string, bool) {
+			return params.ByName("id"), params.ByName("id") != ""
+		},
+	}, ratelimit.ClientIP(false), okHandle)
+
+	account := httprouter.Params{{Key: "id", Value: "7"}}
+	assert.Equal(t, http.StatusNoContent, do(handle, "192.0.2.1:1234", account).Code)
+	assert.Equal(t, http.StatusTooManyRequests, do(handle, "192.0.2.2:1234", account).Code)
+	assert.Equal(t, http.StatusNoContent, do(handle, "192.0.2.2:1234", nil).Code)
+}
+
+func TestLimiterFailuresAllowed(t *testing.T) {
+	handle := ratelimit.WithLimits(failingLimiter{}, ratelimit.Rule{
+		Group: "sessions",
+		PerIP: ratelimit.Limit{PerMinute: 1, Burst: 1},
+	}, ratelimit.ClientIP(false), okHandle)
+	assert.Equal(t, http.StatusNoContent, do(handle, "192.0.2.1:1234", nil).Code)
+}
+
+func TestClientIP(t *testing.T) {
+	req := httptest.NewRequest("POST", "/sessions", nil)
+	req.RemoteAddr = "10.0.0.5:4321"
+	req.Header.Add("X-Forwarded-For", "203.0.113.9, 198.51.100.7")
+	assert.Equal(t, "10.0.0.5", ratelimit.ClientIP(false)(req))
+	assert.Equal(t, "198.51.100.7", ratelimit.ClientIP(true)(req))
+
+	req.Header.Del("X-Forwarded-For")
+	assert.Equal(t, "10.0.0.5", ratelimit.ClientIP(true)(req))
+}
+
+func assertAllowed(t *testing.T, limiter ratelimit.Limiter, key string, limit ratelimit.Limit) {
+	t.Helper()
+	allowed, _, err := limiter.Allow(context.Background(), key, limit)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+}
+
+func do(handle httprouter.Handle, remoteAddr string, params httprouter.Params) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/sessions", nil)
+	req.RemoteAddr = remoteAddr
+	rr := httptest.NewRecorder()
+	handle(rr, req, params)
+	return rr
+}
+
+func okHandle(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+type failingLimiter struct{}
+
+func (failingLimiter) Allow(ctx context.Context, key string, limit ratelimit.Limit) (bool, time.Duration, error) {
+	return false, 0, errors.New("redis: connection refused")
+}
@@ -0,0 +1,103 @@
+package http
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	accountsHttp "github.com/wikisophia/api/server/accounts/http"
+	"github.com/wikisophia/api/server/config"
+	"github.com/wikisophia/api/server/http/ratelimit"
+)
+
+// rateLimitRule returns the limits for a route, or false if it isn't limited.
+func rateLimitRule(cfg *config.RateLimit, key *ecdsa.PrivateKey, method, path string) (ratelimit.Rule, bool) {
+	switch {
+	case method == "POST" && path == "/sessions":
+		// Keying by email slows down guesses at one account's password from many addresses.
+		// Requests with a two-factor challenge have no email, so they're only limited by IP.
+		// The lockout counts their wrong codes against the account instead.
+		return newRule("sessions", cfg.Sessions, emailInBody), true
+	case method == "POST" && path == "/accounts":
+		// Keying by email stops clients from flooding someone's inbox with reset emails.
+		return newRule("accounts", cfg.Accounts, emailInBody), true
+	case method == "POST" && path == "/accounts/:id/password":
+		return newRule("accounts", cfg.Accounts, idInPath), true
+	case method == "POST" && path == "/accounts/:id/email":
+		// Keying by account slows down guesses at its password, and stops clients from flooding the old inbox.
+		return newRule("accounts", cfg.Accounts, idInPath), true
+	case method == "PATCH" && path == "/accounts/:id":
+		// This is PATCH /accounts/me.
+		return newRule("accounts", cfg.Accounts, sessionAccount(key)), true
+	case method == "DELETE" && path == "/accounts/:id":
+		// This is DELETE /accounts/me. Keying by account slows down guesses at its password.
+		return newRule("accounts", cfg.Accounts, sessionAccount(key)), true
+	case method == "POST" && path == "/accounts/:id/two-factor", method == "DELETE" && path == "/accounts/:id/two-factor":
+		// Keying by account slows down guesses at its password and codes.
+		return newRule("accounts", cfg.Accounts, idInPath), true
+	case method == "POST" && path == "/accounts/:id/restore", method == "GET" && path == "/accounts/:id/export",
+		method == "GET" && path == "/accounts/:id/two-factor":
+		return newRule("accounts", cfg.Accounts, sessionAccount(key)), true
+	case method == "POST" && path == "/accounts/:id":
+		// This is POST /accounts/verify. The tokens are too long to guess, so only IPs are limited.
+		return newRule("accounts", cfg.Accounts, nil), true
+	case method == "POST" && path == "/accounts/:id/resend":
+		// Like POST /accounts, this stops clients from flooding someone's inbox.
+		return newRule("accounts", cfg.Accounts, emailInBody), true
+	case writesArguments(method, path):
+		return newRule("argument_writes", cfg.ArgumentWrites, sessionAccount(key)), true
+	default:
+		return ratelimit.Rule{}, false
+	}
+}
+
+func newRule(group string, cfg *config.RateLimitGroup, account func(r *http.Request, params httprouter.Params) (string, bool)) ratelimit.Rule {
+	return ratelimit.Rule{
+		Group: group,
+		PerIP: ratelimit.Limit{
+			PerMinute: cfg.IPPerMinute,
+			Burst:     cfg.IPBurst,
+		},
+		PerAccount: ratelimit.Limit{
+			PerMinute: cfg.AccountPerMinute,
+			Burst:     cfg.AccountBurst,
+		},
+		Account: account,
+	}
+}
+
+// emailInBody finds the "email" in a JSON request body, and leaves the body for the handler to read.
+func emailInBody(r *http.Request, params httprouter.Params) (string, bool) {
+	body, err := io.ReadAll(r.Body)
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return "", false
+	}
+	var request struct {
+		Email string `json:"email"`
+	}
+	if err := json.Unmarshal(body, &request); err != nil || request.Email == "" {
+		return "", false
+	}
+	return strings.ToLower(request.Email), true
+}
+
+func idInPath(r *http.Request, params httprouter.Params) (string, bool) {
+	id, err := strconv.ParseInt(params.ByName("id"), 10, 64)
+	if err != nil {
+		return "", false
+	}
+	return strconv.FormatInt(id, 10), true
+}
+
+func sessionAccount(key *ecdsa.PrivateKey) func(r *http.Request, params httprouter.Params) (string, bool) {
+	return func(r *http.Request, params httprouter.Params) (string, bool) {
+		id, ok := accountsHttp.SessionAccountID(key, r)
+		return strconv.FormatInt(id, 10), ok
+	}
+}
@@ -0,0 +1,107 @@
+package http_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wikisophia/api/server/acceptancetest"
+	accountsMemory "github.com/wikisophia/api/server/accounts/memory"
+	argumentsMemory "github.com/wikisophia/api/server/arguments/memory"
+	"github.com/wikisophia/api/server/config"
+	wikisophiaHttp "github.com/wikisophia/api/server/http"
+	"github.com/wikisophia/api/server/http/problems"
+)
+
+func TestSessionsLimitedByIP(t *testing.T) {
+	server := newLimitedServer(t, &config.RateLimitGroup{IPPerMinute: 1, IPBurst: 2})
+	assert.Equal(t, http.StatusForbidden, login(server, "192.0.2.1:1234", "first@soph.wiki").Code)
+	assert.Equal(t, http.StatusForbidden, login(server, "192.0.2.1:1234", "second@soph.wiki").Code)
+
+	rr := login(server, "192.0.2.1:1234", "third@soph.wiki")
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, "60", rr.Header().Get("Retry-After"))
+	assert.Equal(t, problems.CodeRateLimited, parseProblemCode(t, rr))
+
+	assert.Equal(t, http.StatusForbidden, login(server, "192.0.2.2:1234", "third@soph.wiki").Code)
+}
+
+func TestSessionsLimitedByEmail(t *testing.T) {
+	server := newLimitedServer(t, &config.RateLimitGroup{AccountPerMinute: 1, AccountBurst: 1})
+	assert.Equal(t, http.StatusForbidden, login(server, "192.0.2.1:1234", "victim@soph.wiki").Code)
+	assert.Equal(t, http.StatusTooManyRequests, login(server, "192.0.2.2:1234", "Victim@soph.wiki").Code)
+	assert.Equal(t, http.StatusForbidden, login(server, "192.0.2.2:1234", "someone-else@soph.wiki").Code)
+}
+
+func TestReadsNotLimited(t *testing.T) {
+	server := newLimitedServer(t, &config.RateLimitGroup{IPPerMinute: 1, IPBurst: 1})
+	for i := 0; i < 5; i++ {
+		rr := httptest.NewRecorder()
+		server.Handle(rr, httptest.NewRequest("GET", "/arguments", nil))
+		assert.Equal(t, http.StatusOK, rr.Code)
+	}
+}
+
+func TestArgumentWritesLimitedBySession(t *testing.T) {
+	cfg := config.Defaults().RateLimit
+	cfg.ArgumentWrites = &config.RateLimitGroup{AccountPerMinute: 1, AccountBurst: 1}
+	accountsStore := accountsMemory.NewMemoryStore()
+	account, _, err := accountsStore.NewResetToken(context.Background(), "some-email@soph.wiki")
+	require.NoError(t, err)
+	require.NoError(t, accountsStore.SetForgottenPassword(context.Background(), account.ID, "some-password", account.ResetToken))
+	server := newServerWithRateLimits(t, accountsStore, cfg)
+	token := sessionToken(t, login(server, "192.0.2.1:1234", "some-email@soph.wiki"))
+
+	save := func(remoteAddr string) int {
+		req := httptest.NewRequest("POST", "/arguments", strings.NewReader(`{"conclusion":"c","premises":["p1","p2"]}`))
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		server.Handle(rr, req)
+		return rr.Code
+	}
+	assert.Equal(t, http.StatusCreated, save("192.0.2.1:1234"))
+	assert.Equal(t, http.StatusTooManyRequests, save("192.0.2.2:1234"))
+}
+
+func newLimitedServer(t *testing.T, sessions *config.RateLimitGroup) *wikisophiaHttp.Server {
+	cfg := config.Defaults().RateLimit
+	cfg.Sessions = sessions
+	return newServerWithRateLimits(t, accountsMemory.NewMemoryStore(), cfg)
+}
+
+func newServerWithRateLimits(t *testing.T, accountsStore wikisophiaHttp.AccountsStore, cfg *config.RateLimit) *wikisophiaHttp.Server {
+	t.Helper()
+	return wikisophiaHttp.NewServer(*config.Defaults().Server, acceptancetest.KeyForTests(t), wikisophiaHttp.ServerDependencies{
+		AccountsStore:  accountsStore,
+		ArgumentsStore: argumentsMemory.NewMemoryStore(),
+	}, wikisophiaHttp.Options{
+		Logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+		RateLimits: cfg,
+	})
+}
+
+func login(server *wikisophiaHttp.Server, remoteAddr, email string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/sessions", strings.NewReader(`{"email":"`+email+`","password":"some-password"}`))
+	req.RemoteAddr = remoteAddr
+	rr := httptest.NewRecorder()
+	server.Handle(rr, req)
+	return rr
+}
+
+func sessionToken(t *testing.T, rr *httptest.ResponseRecorder) string {
+	t.Helper()
+	require.Equal(t, http.StatusOK, rr.Code)
+	var response struct {
+		Token string `json:"token"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	return response.Token
+}
@@ -0,0 +1,34 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/wikisophia/api/server/admin"
+	"github.com/wikisophia/api/server/http/problems"
+)
+
+// changesData is true if the route might write to the stores.
+// Logging in only records the new session, so people can still log in during read-only mode.
+func changesData(method, path string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS":
+		return false
+	case "POST":
+		return path != "/sessions"
+	default:
+		return true
+	}
+}
+
+// rejectIfReadOnly responds with a 503 instead of calling next while the server is in read-only mode.
+func rejectIfReadOnly(toggles *admin.Toggles, next httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		if toggles.ReadOnly() {
+			w.Header().Set("Retry-After", "60")
+			problems.Write(w, http.StatusServiceUnavailable, problems.CodeReadOnly, "The server is in read-only mode for maintenance. Please try again later.")
+			return
+		}
+		next(w, r, params)
+	}
+}
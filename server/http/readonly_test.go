@@ -0,0 +1,82 @@
+package http_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	accountsMemory "github.com/wikisophia/api/server/accounts/memory"
+	"github.com/wikisophia/api/server/admin"
+	argumentsMemory "github.com/wikisophia/api/server/arguments/memory"
+	"github.com/wikisophia/api/server/config"
+	wikisophiaHttp "github.com/wikisophia/api/server/http"
+	"github.com/wikisophia/api/server/http/problems"
+)
+
+func TestReadOnlyRejectsWrites(t *testing.T) {
+	toggles := &admin.Toggles{}
+	toggles.SetReadOnly(true)
+	server := newToggledServer(t, accountsMemory.NewMemoryStore(), toggles)
+
+	rr := httptest.NewRecorder()
+	server.Handle(rr, httptest.NewRequest("POST", "/arguments", strings.NewReader(`{"conclusion":"c","premises":["p1","p2"]}`)))
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Equal(t, problems.ContentType, rr.Header().Get("Content-Type"))
+	assert.Equal(t, problems.CodeReadOnly, parseProblemCode(t, rr))
+
+	rr = httptest.NewRecorder()
+	server.Handle(rr, httptest.NewRequest("GET", "/arguments/1", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestReadOnlyAllowsLogin(t *testing.T) {
+	accountsStore := accountsMemory.NewMemoryStore()
+	account, _, err := accountsStore.NewResetToken(context.Background(), "some-email@soph.wiki")
+	require.NoError(t, err)
+	require.NoError(t, accountsStore.SetForgottenPassword(context.Background(), account.ID, "some-password", account.ResetToken))
+
+	toggles := &admin.Toggles{}
+	toggles.SetReadOnly(true)
+	rr := httptest.NewRecorder()
+	newToggledServer(t, accountsStore, toggles).Handle(rr, httptest.NewRequest("POST", "/sessions", strings.NewReader(`{"email":"some-email@soph.wiki","password":"some-password"}`)))
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestWritableAgain(t *testing.T) {
+	toggles := &admin.Toggles{}
+	toggles.SetReadOnly(true)
+	toggles.SetReadOnly(false)
+	rr := httptest.NewRecorder()
+	newToggledServer(t, accountsMemory.NewMemoryStore(), toggles).Handle(rr, httptest.NewRequest("POST", "/arguments", strings.NewReader(`{"conclusion":"c","premises":["p1","p2"]}`)))
+	assert.NotEqual(t, http.StatusServiceUnavailable, rr.Code)
+}
+
+func newToggledServer(t *testing.T, accountsStore wikisophiaHttp.AccountsStore, toggles *admin.Toggles) *wikisophiaHttp.Server {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+	return wikisophiaHttp.NewServer(*config.Defaults().Server, key, wikisophiaHttp.ServerDependencies{
+		AccountsStore:  accountsStore,
+		ArgumentsStore: argumentsMemory.NewMemoryStore(),
+	}, wikisophiaHttp.Options{
+		Logger:  slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Toggles: toggles,
+	})
+}
+
+func parseProblemCode(t *testing.T, rr *httptest.ResponseRecorder) problems.Code {
+	t.Helper()
+	var problem problems.Problem
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &problem))
+	return problem.Code
+}
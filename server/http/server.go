@@ -4,40 +4,176 @@ import (
 	"context"
 	"crypto/ecdsa"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/cors"
 	"github.com/wikisophia/api/server/accounts"
-	"github.com/wikisophia/api/server/accounts/email"
 	accountsHttp "github.com/wikisophia/api/server/accounts/http"
+	"github.com/wikisophia/api/server/admin"
 	"github.com/wikisophia/api/server/arguments"
 	argumentsHttp "github.com/wikisophia/api/server/arguments/http"
 	"github.com/wikisophia/api/server/config"
+	"github.com/wikisophia/api/server/http/health"
+	"github.com/wikisophia/api/server/http/problems"
+	"github.com/wikisophia/api/server/http/ratelimit"
+	"github.com/wikisophia/api/server/http/timeouts"
+	"github.com/wikisophia/api/server/logging"
+	"github.com/wikisophia/api/server/metrics"
 )
 
+// maxBodyBytes is the biggest request body which the handlers will read.
+// Without a limit, one request could take up all the server's memory.
+const maxBodyBytes = 1 << 20
+
 // Server runs the service. Use NewServer() to construct one from an app config,
 // and Start() to make it start listening and serving requests.
 type Server struct {
-	router *httprouter.Router
+	handler http.Handler
+	checker *health.Checker
+}
+
+// Options says how the server reports on itself, and how operators can manage it.
+type Options struct {
+	// Logger gets a line for each request when it finishes.
+	Logger *slog.Logger
+	// Registry collects the HTTP metrics. If nil, they aren't recorded.
+	// They're served by the admin listener, never by this server.
+	Registry *prometheus.Registry
+	// Toggles can put the server in read-only mode. If nil, it's always writable.
+	Toggles *admin.Toggles
+	// RateLimits throttle clients which make too many requests. If nil or disabled, nobody is throttled.
+	RateLimits *config.RateLimit
+	// Verification says what accounts can't do until they've verified their email.
+	// If nil, unverified accounts can do everything.
+	Verification *config.Verification
+	// Deletion says how long deleted accounts wait before they're purged. If nil, the defaults are used.
+	Deletion *config.Deletion
+	// TwoFactor names the site in authenticator apps, and says how long logins wait for a code.
+	// If nil, the defaults are used.
+	TwoFactor *config.TwoFactor
+	// RateLimiter keeps track of each client's requests. If nil, a ratelimit.MemoryLimiter is used.
+	RateLimiter ratelimit.Limiter
+	// ReadinessChecks must all pass for GET /readyz to succeed.
+	// The server adds its own check for the JWT key.
+	ReadinessChecks []health.Check
 }
 
 // NewServer makes a server which defines REST endpoints for the service.
-func NewServer(key *ecdsa.PrivateKey, store Dependencies) *Server {
+func NewServer(cfg config.Server, key *ecdsa.PrivateKey, store Dependencies, options Options) *Server {
 	router := httprouter.New()
-	accountsHttp.AppendRoutes(router, key, store)
-	argumentsHttp.AppendRoutes(router, store)
+	router.NotFound = http.HandlerFunc(problems.NotFound)
+	router.MethodNotAllowed = http.HandlerFunc(problems.MethodNotAllowed)
+	routes := &routes{
+		router:   router,
+		cfg:      cfg,
+		key:      key,
+		toggles:  options.Toggles,
+		sessions: store,
+	}
+	var verification config.Verification
+	if options.Verification != nil {
+		verification = *options.Verification
+	}
+	if verification.RequiredToWriteArguments {
+		routes.verifier = store
+	}
+	deletion := *config.Defaults().Deletion
+	if options.Deletion != nil {
+		deletion = *options.Deletion
+	}
+	twoFactor := *config.Defaults().TwoFactor
+	if options.TwoFactor != nil {
+		twoFactor = *options.TwoFactor
+	}
+	if options.RateLimits != nil && options.RateLimits.Enabled {
+		routes.rateLimits = options.RateLimits
+		routes.limiter = options.RateLimiter
+		if routes.limiter == nil {
+			routes.limiter = ratelimit.NewMemoryLimiter(nil)
+		}
+		routes.clientIP = ratelimit.ClientIP(options.RateLimits.TrustForwardedFor)
+	}
+	accountsHttp.AppendRoutes(routes, key, verification, deletion, twoFactor, store)
+	argumentsHttp.AppendRoutes(routes, store, func(r *http.Request) (int64, bool) {
+		return accountsHttp.SessionAccountID(key, r)
+	})
+
+	checker := health.NewChecker(append(options.ReadinessChecks, health.Check{
+		Name: "jwt_key",
+		Ping: func(ctx context.Context) error {
+			return accountsHttp.CheckKey(key)
+		},
+	})...)
+	routes.HandlerFunc("GET", "/healthz", checker.Live)
+	routes.HandlerFunc("GET", "/readyz", checker.Ready)
+
+	var handler http.Handler = router
+	if options.Registry != nil {
+		handler = countRequests(metrics.NewHTTP(options.Registry), handler)
+	}
 	return &Server{
-		router: router,
+		handler: traceRequests(logRequests(options.Logger, handler)),
+		checker: checker,
+	}
+}
+
+// routes wraps every endpoint's handler in the middleware which all of them share,
+// and then adds it to the router.
+type routes struct {
+	router  *httprouter.Router
+	cfg     config.Server
+	key     *ecdsa.PrivateKey
+	toggles *admin.Toggles
+	// verifier is nil unless argument writes need a verified account.
+	verifier accounts.EmailVerifier
+	// rateLimits is nil if rate limiting is off.
+	rateLimits *config.RateLimit
+	limiter    ratelimit.Limiter
+	clientIP   func(r *http.Request) string
+	// sessions records when each session was last used.
+	sessions accounts.Sessions
+}
+
+func (r *routes) Handle(method, path string, handle httprouter.Handle) {
+	handle = recordSessionUse(r.key, r.toggles, r.sessions, handle)
+	handle = timeouts.WithDeadline(r.cfg.RouteTimeout(method, path), handle)
+	if changesData(method, path) {
+		handle = rejectIfReadOnly(r.toggles, handle)
+	}
+	if r.verifier != nil && writesArguments(method, path) {
+		handle = requireVerifiedSession(r.key, r.verifier, handle)
+	}
+	if r.rateLimits != nil {
+		if rule, ok := rateLimitRule(r.rateLimits, r.key, method, path); ok {
+			handle = ratelimit.WithLimits(r.limiter, rule, r.clientIP, handle)
+		}
 	}
+	r.router.Handle(method, path, func(w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		req.Body = http.MaxBytesReader(w, req.Body, maxBodyBytes)
+		logging.SetRoute(req.Context(), path)
+		setSpanRoute(req, path)
+		handle(w, req, params)
+	})
+}
+
+func (r *routes) HandlerFunc(method, path string, handler http.HandlerFunc) {
+	r.Handle(method, path, func(w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		if len(params) > 0 {
+			req = req.WithContext(context.WithValue(req.Context(), httprouter.ParamsKey, params))
+		}
+		handler(w, req)
+	})
 }
 
 // Dependencies for all the server's endpoints
 type Dependencies interface {
-	email.Emailer
 	accounts.Store
 	arguments.Store
 }
@@ -45,7 +181,6 @@ type Dependencies interface {
 type AccountsStore = accounts.Store
 type ArgumentsStore = arguments.Store
 type ServerDependencies struct {
-	email.Emailer
 	AccountsStore
 	ArgumentsStore
 }
@@ -53,20 +188,20 @@ type ServerDependencies struct {
 // Handle exists to make testing easier.
 // It lets the Server act without having to bind to a port.
 func (s *Server) Handle(w http.ResponseWriter, req *http.Request) {
-	s.router.ServeHTTP(w, req)
+	s.handler.ServeHTTP(w, req)
 }
 
 // Start connects the API server to its port and blocks until it hears a
 // shutdown signal. Once the server has shut down completely, it adds
 // an element to the done channel.
 func (s *Server) Start(cfg config.Server, done chan<- struct{}) error {
-	var handler http.Handler = s.router
+	handler := s.handler
 	if len(cfg.CorsAllowedOrigins) > 0 {
 		// AllowedMethods should stay in sync with the methods used by the routes
 		handler = cors.New(cors.Options{
 			AllowedOrigins: cfg.CorsAllowedOrigins,
 			AllowedMethods: []string{"DELETE", "GET", "POST", "PATCH"},
-			ExposedHeaders: []string{"Location"},
+			ExposedHeaders: []string{"Location", "Retry-After", RequestIDHeader},
 		}).Handler(handler)
 	}
 
@@ -76,18 +211,23 @@ func (s *Server) Start(cfg config.Server, done chan<- struct{}) error {
 		ReadHeaderTimeout: cfg.ReadHeaderTimeout(),
 	}
 
-	go shutdownOnSignal(httpServer, done)
+	go shutdownOnSignal(httpServer, s.checker, cfg.DrainDelay(), done)
 	if cfg.UseSSL {
 		return httpServer.ListenAndServeTLS(cfg.CertPath, cfg.KeyPath)
 	}
 	return httpServer.ListenAndServe()
 }
 
-func shutdownOnSignal(server *http.Server, done chan<- struct{}) {
-	signals := make(chan os.Signal)
+// shutdownOnSignal drains the server once it gets a shutdown signal.
+// GET /readyz fails for drainDelay first, so load balancers can stop sending new requests.
+// Then the server stops accepting connections, and finishes the requests in progress.
+func shutdownOnSignal(server *http.Server, checker *health.Checker, drainDelay time.Duration, done chan<- struct{}) {
+	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
 	sig := <-signals
-	log.Printf("Received signal %v. API server shutting down.", sig)
+	checker.Drain()
+	log.Printf("Received signal %v. API server draining for %v, then shutting down.", sig, drainDelay)
+	time.Sleep(drainDelay)
 	server.Shutdown(context.Background())
 	var s struct{}
 	done <- s
@@ -0,0 +1,28 @@
+package http
+
+import (
+	"crypto/ecdsa"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/wikisophia/api/server/accounts"
+	accountsHttp "github.com/wikisophia/api/server/accounts/http"
+	"github.com/wikisophia/api/server/admin"
+	"github.com/wikisophia/api/server/logging"
+)
+
+// recordSessionUse notes when the request's session was last used, so that the account's owner can see it.
+// The stores only write this once a minute per session, and nothing is written in read-only mode.
+// Failures are logged, but don't fail the request.
+func recordSessionUse(key *ecdsa.PrivateKey, toggles *admin.Toggles, sessions accounts.Sessions, next httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		if session, ok := accountsHttp.ParseSession(key, r); ok && session.SessionID != 0 && !toggles.ReadOnly() {
+			if err := sessions.SessionUsed(r.Context(), session.UserID, session.SessionID, time.Now()); err != nil {
+				logging.FromContext(r.Context()).Error("failed to record a session's use", slog.Any("error", err))
+			}
+		}
+		next(w, r, params)
+	}
+}
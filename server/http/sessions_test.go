@@ -0,0 +1,59 @@
+package http_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	accountsMemory "github.com/wikisophia/api/server/accounts/memory"
+	"github.com/wikisophia/api/server/admin"
+	wikisophiaHttp "github.com/wikisophia/api/server/http"
+)
+
+func TestSessionUseRecorded(t *testing.T) {
+	store := &sessionRecorder{AccountsStore: accountsMemory.NewMemoryStore()}
+	account, _, err := store.NewResetToken(context.Background(), "some-email@soph.wiki")
+	require.NoError(t, err)
+	require.NoError(t, store.SetForgottenPassword(context.Background(), account.ID, "some-password", account.ResetToken))
+	toggles := &admin.Toggles{}
+	server := newToggledServer(t, store, toggles)
+
+	rr := httptest.NewRecorder()
+	server.Handle(rr, httptest.NewRequest("POST", "/sessions", strings.NewReader(`{"email":"some-email@soph.wiki","password":"some-password"}`)))
+	require.Equal(t, http.StatusOK, rr.Code)
+	var session struct {
+		Token string `json:"token"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &session))
+	assert.Empty(t, store.used, "logging in without a session shouldn't record any use")
+
+	req := httptest.NewRequest("GET", "/accounts/me", nil)
+	req.Header.Set("Authorization", "Bearer "+session.Token)
+	server.Handle(httptest.NewRecorder(), req)
+	require.Len(t, store.used, 1)
+	sessions, err := store.AccountSessions(context.Background(), account.ID)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, sessions[0].ID, store.used[0])
+
+	toggles.SetReadOnly(true)
+	server.Handle(httptest.NewRecorder(), req)
+	assert.Len(t, store.used, 1, "nothing should be written in read-only mode")
+}
+
+// sessionRecorder remembers which sessions were used.
+type sessionRecorder struct {
+	wikisophiaHttp.AccountsStore
+	used []int64
+}
+
+func (s *sessionRecorder) SessionUsed(ctx context.Context, accountID int64, id int64, now time.Time) error {
+	s.used = append(s.used, id)
+	return s.AccountsStore.SessionUsed(ctx, accountID, id, now)
+}
@@ -0,0 +1,48 @@
+// Package timeouts gives each request a deadline, and reports the requests which run out of time.
+package timeouts
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/wikisophia/api/server/http/problems"
+	"github.com/wikisophia/api/server/logging"
+)
+
+// WithDeadline makes the request's context expire after timeout.
+// Stores which respect the context will then give up on their queries.
+func WithDeadline(timeout time.Duration, next httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		next(w, r.WithContext(ctx), params)
+	}
+}
+
+// WriteError responds with a 504 if err happened because the request ran past its deadline,
+// or a 503 if the request was cancelled (usually because the client went away).
+//
+// It returns false if err is nil or had nothing to do with the request's context,
+// in which case the caller should respond to it.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) bool {
+	// Work which finished in time succeeded, even if the deadline passed right after.
+	if err == nil {
+		return false
+	}
+	ctxErr := r.Context().Err()
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(ctxErr, context.DeadlineExceeded):
+		logging.FromContext(r.Context()).Warn("request ran out of time", slog.Any("error", err))
+		problems.Write(w, http.StatusGatewayTimeout, problems.CodeTimeout, "The request took too long. Please try again later.")
+		return true
+	case errors.Is(err, context.Canceled) || errors.Is(ctxErr, context.Canceled):
+		problems.Write(w, http.StatusServiceUnavailable, problems.CodeRequestCancelled, "The request was cancelled.")
+		return true
+	default:
+		return false
+	}
+}
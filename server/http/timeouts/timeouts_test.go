@@ -0,0 +1,57 @@
+package timeouts_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/wikisophia/api/server/http/problems"
+	"github.com/wikisophia/api/server/http/timeouts"
+)
+
+func TestDeadlineExceeded(t *testing.T) {
+	handle := timeouts.WithDeadline(time.Millisecond, slowHandle)
+	rr := httptest.NewRecorder()
+	handle(rr, httptest.NewRequest("GET", "/arguments", nil), nil)
+	assert.Equal(t, http.StatusGatewayTimeout, rr.Code)
+	assert.Equal(t, problems.ContentType, rr.Header().Get("Content-Type"))
+}
+
+func TestRequestCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	handle := timeouts.WithDeadline(time.Minute, slowHandle)
+	rr := httptest.NewRecorder()
+	handle(rr, httptest.NewRequest("GET", "/arguments", nil).WithContext(ctx), nil)
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+}
+
+func TestUnrelatedErrorsIgnored(t *testing.T) {
+	rr := httptest.NewRecorder()
+	handled := timeouts.WriteError(rr, httptest.NewRequest("GET", "/arguments", nil), errors.New("some other problem"))
+	assert.False(t, handled)
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestNilErrorIgnoredAfterDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	<-ctx.Done()
+	rr := httptest.NewRecorder()
+	handled := timeouts.WriteError(rr, httptest.NewRequest("GET", "/arguments", nil).WithContext(ctx), nil)
+	assert.False(t, handled)
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+// slowHandle acts like a store which takes until the request's context ends.
+func slowHandle(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	<-r.Context().Done()
+	if !timeouts.WriteError(w, r, r.Context().Err()) {
+		w.WriteHeader(http.StatusOK)
+	}
+}
@@ -0,0 +1,55 @@
+package http_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	accountsMemory "github.com/wikisophia/api/server/accounts/memory"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestRequestTraced(t *testing.T) {
+	// The store hashes a password when it's made, so make it before recording.
+	store := accountsMemory.NewMemoryStore()
+	recorder := useSpanRecorder(t)
+	server, logs := newLoggedServer(t, store)
+	req := httptest.NewRequest("GET", "/arguments/1", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	server.Handle(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "GET /arguments/:id", spans[0].Name())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", spans[0].Parent().SpanID().String())
+	assert.Contains(t, spans[0].Attributes(), attribute.Int("http.response.status_code", http.StatusNotFound))
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", parseLogLine(t, logs)["trace_id"])
+}
+
+func TestUntracedRequestsLogNoTraceID(t *testing.T) {
+	server, logs := newLoggedServer(t, accountsMemory.NewMemoryStore())
+	server.Handle(httptest.NewRecorder(), httptest.NewRequest("GET", "/arguments/1", nil))
+	assert.NotContains(t, parseLogLine(t, logs), "trace_id")
+}
+
+// useSpanRecorder records spans in memory, and follows traceparent headers, until the test ends.
+// The globals can't be restored once they're set, so no-ops are left behind instead.
+func useSpanRecorder(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+	})
+	return recorder
+}
@@ -0,0 +1,49 @@
+package http
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/wikisophia/api/server/accounts"
+	accountsHttp "github.com/wikisophia/api/server/accounts/http"
+	"github.com/wikisophia/api/server/http/problems"
+	"github.com/wikisophia/api/server/http/timeouts"
+)
+
+// writesArguments is true if the route changes arguments.
+func writesArguments(method, path string) bool {
+	return method != "GET" && strings.HasPrefix(path, "/arguments")
+}
+
+// requireVerifiedSession only calls next if the request has a session from an account
+// which has verified its email.
+func requireVerifiedSession(key *ecdsa.PrivateKey, verifier accounts.EmailVerifier, next httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		id, ok := accountsHttp.SessionAccountID(key, r)
+		if !ok {
+			problems.Write(w, http.StatusForbidden, problems.CodePermissionDenied, "Log in with a verified account to change arguments.")
+			return
+		}
+		verifiedAt, err := verifier.EmailVerifiedAt(r.Context(), id)
+		if timeouts.WriteError(w, r, err) {
+			return
+		}
+		// The account may have been deleted since the session started.
+		if errors.As(err, &accounts.AccountNotExistsError{}) {
+			problems.Write(w, http.StatusForbidden, problems.CodePermissionDenied, "Log in with a verified account to change arguments.")
+			return
+		}
+		if err != nil {
+			problems.WriteInternal(w, r, err)
+			return
+		}
+		if verifiedAt.IsZero() {
+			problems.Write(w, http.StatusForbidden, problems.CodeEmailNotVerified, "Verify this account's email before changing arguments.")
+			return
+		}
+		next(w, r, params)
+	}
+}
@@ -0,0 +1,64 @@
+package http_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	accountsMemory "github.com/wikisophia/api/server/accounts/memory"
+	argumentsMemory "github.com/wikisophia/api/server/arguments/memory"
+	"github.com/wikisophia/api/server/config"
+	wikisophiaHttp "github.com/wikisophia/api/server/http"
+	"github.com/wikisophia/api/server/http/problems"
+)
+
+func TestArgumentWritesNeedVerifiedSession(t *testing.T) {
+	accountsStore := accountsMemory.NewMemoryStore()
+	account, _, err := accountsStore.NewResetToken(context.Background(), "some-email@soph.wiki")
+	require.NoError(t, err)
+	require.NoError(t, accountsStore.SetForgottenPassword(context.Background(), account.ID, "some-password", account.ResetToken))
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+	server := wikisophiaHttp.NewServer(*config.Defaults().Server, key, wikisophiaHttp.ServerDependencies{
+		AccountsStore:  accountsStore,
+		ArgumentsStore: argumentsMemory.NewMemoryStore(),
+	}, wikisophiaHttp.Options{
+		Logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Verification: &config.Verification{RequiredToWriteArguments: true},
+	})
+	token := sessionToken(t, login(server, "192.0.2.1:1234", "some-email@soph.wiki"))
+
+	save := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/arguments", strings.NewReader(`{"conclusion":"c","premises":["p1","p2"]}`))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		server.Handle(rr, req)
+		return rr
+	}
+	rr := save("")
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Equal(t, problems.CodePermissionDenied, parseProblemCode(t, rr))
+	rr = save(token)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Equal(t, problems.CodeEmailNotVerified, parseProblemCode(t, rr))
+
+	verification, err := accountsStore.NewVerificationToken(context.Background(), "some-email@soph.wiki")
+	require.NoError(t, err)
+	require.NoError(t, accountsStore.VerifyEmail(context.Background(), verification.ID, verification.VerificationToken))
+	assert.Equal(t, http.StatusCreated, save(token).Code)
+
+	rr = httptest.NewRecorder()
+	server.Handle(rr, httptest.NewRequest("GET", "/arguments", nil))
+	assert.Equal(t, http.StatusOK, rr.Code, "reads shouldn't need a session")
+}
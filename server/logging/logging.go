@@ -0,0 +1,84 @@
+// Package logging sets up the app's structured logs, and carries a logger through each request's context.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+
+	"github.com/wikisophia/api/server/config"
+)
+
+// New makes a logger which writes to w in the configured format.
+func New(cfg *config.Log, w io.Writer) *slog.Logger {
+	options := &slog.HandlerOptions{
+		Level: cfg.SlogLevel(),
+	}
+	if cfg.Format == config.LogFormatText {
+		return slog.New(slog.NewTextHandler(w, options))
+	}
+	return slog.New(slog.NewJSONHandler(w, options))
+}
+
+type contextKey struct{}
+
+// requestDetails are learned while a request is being handled, and logged once it's done.
+type requestDetails struct {
+	mutex     sync.Mutex
+	logger    *slog.Logger
+	route     string
+	accountID int64
+}
+
+// NewContext returns a copy of ctx which carries logger.
+// Use it once per request, before calling any handlers.
+func NewContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, &requestDetails{
+		logger: logger,
+	})
+}
+
+// FromContext returns the logger for the request which ctx belongs to.
+// If there isn't one, it returns slog.Default().
+func FromContext(ctx context.Context) *slog.Logger {
+	if details := detailsFrom(ctx); details != nil {
+		return details.logger
+	}
+	return slog.Default()
+}
+
+// SetRoute records the pattern of the route which is handling the request, like "/arguments/:id".
+func SetRoute(ctx context.Context, route string) {
+	if details := detailsFrom(ctx); details != nil {
+		details.mutex.Lock()
+		details.route = route
+		details.mutex.Unlock()
+	}
+}
+
+// SetAccountID records the account which made the request.
+// Handlers should only call it once they know who the client is.
+func SetAccountID(ctx context.Context, id int64) {
+	if details := detailsFrom(ctx); details != nil {
+		details.mutex.Lock()
+		details.accountID = id
+		details.mutex.Unlock()
+	}
+}
+
+// Details returns the values from SetRoute and SetAccountID.
+// They'll be empty if nothing has been set.
+func Details(ctx context.Context) (route string, accountID int64) {
+	if details := detailsFrom(ctx); details != nil {
+		details.mutex.Lock()
+		defer details.mutex.Unlock()
+		return details.route, details.accountID
+	}
+	return "", 0
+}
+
+func detailsFrom(ctx context.Context) *requestDetails {
+	details, _ := ctx.Value(contextKey{}).(*requestDetails)
+	return details
+}
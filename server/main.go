@@ -1,58 +1,324 @@
 package main
 
 import (
-	_ "net/http/pprof"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	nethttp "net/http"
+	"os"
 
 	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/accounts/deletion"
 	"github.com/wikisophia/api/server/accounts/email"
+	"github.com/wikisophia/api/server/accounts/lockout"
 	accountsMemory "github.com/wikisophia/api/server/accounts/memory"
+	"github.com/wikisophia/api/server/accounts/outbox"
 	accountsPostgres "github.com/wikisophia/api/server/accounts/postgres"
+	accountsSQLite "github.com/wikisophia/api/server/accounts/sqlite"
+	"github.com/wikisophia/api/server/accounts/tokens"
+	"github.com/wikisophia/api/server/admin"
 	"github.com/wikisophia/api/server/arguments"
 	argumentsMemory "github.com/wikisophia/api/server/arguments/memory"
 	argumentsPostgres "github.com/wikisophia/api/server/arguments/postgres"
+	argumentsSQLite "github.com/wikisophia/api/server/arguments/sqlite"
 	"github.com/wikisophia/api/server/http"
+	"github.com/wikisophia/api/server/http/health"
+	"github.com/wikisophia/api/server/logging"
+	"github.com/wikisophia/api/server/memory"
+	"github.com/wikisophia/api/server/metrics"
+	"github.com/wikisophia/api/server/migrations"
 	"github.com/wikisophia/api/server/passwords"
+	"github.com/wikisophia/api/server/tracing"
 
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/wikisophia/api/server/config"
 	"github.com/wikisophia/api/server/postgres"
+	"github.com/wikisophia/api/server/sqlite"
 )
 
+const usage = `Usage: %s [command] [args]
+
+Commands:
+  serve                 Start the API server. This is the default if no command is given.
+  dump FILE             Write all the accounts and arguments to FILE.
+  restore FILE          Load a FILE written by "dump" into the configured stores.
+  seed [FILE...]        Save the arguments from some fixture files. Defaults to samples/*.json.
+  migrate up            Apply all the pending schema migrations.
+  migrate down DB       Roll back the most recent schema migration of DB, which is accounts or arguments.
+  migrate status        List the schema migrations, and whether they've been applied.
+  migrate baseline DB N Mark DB's migrations up to N as applied without running them.
+                        Use this on databases which were set up before migrations existed.
+
+All commands use the same environment variables for config. See docs/configuration.md.
+`
+
 func main() {
+	command := "serve"
+	args := os.Args[1:]
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+
+	var err error
+	switch command {
+	case "serve":
+		err = serve(args)
+	case "dump":
+		err = dumpCommand(args)
+	case "restore":
+		err = restoreCommand(args)
+	case "seed":
+		err = seedCommand(args)
+	case "migrate":
+		err = migrateCommand(args)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprintf(os.Stdout, usage, os.Args[0])
+		return
+	default:
+		fmt.Fprintf(os.Stderr, usage, os.Args[0])
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s failed: %v\n", command, err)
+		os.Exit(1)
+	}
+}
+
+func serve(args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("unexpected arguments: %v", args)
+	}
 	cfg := config.MustParse()
-	deps := newDependencies(&cfg)
-	server := http.NewServer(cfg.JwtPrivateKey(), deps)
+	logger := logging.New(cfg.Log, os.Stderr)
+	slog.SetDefault(logger)
+	if err := migrateOnStartup(&cfg); err != nil {
+		return err
+	}
+	stopTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := stopTracing(context.Background()); err != nil {
+			log.Printf("ERROR: Failed to flush the remaining spans: %v", err)
+		}
+	}()
+	var registry *prometheus.Registry
+	if cfg.Metrics.Enabled {
+		registry = metrics.NewRegistry()
+	}
+	deps, checks, closeStores := newDependencies(&cfg, registry)
+	defer closeStores()
+	toggles := &admin.Toggles{}
+	server := http.NewServer(*cfg.Server, cfg.JwtPrivateKey(), deps, http.Options{
+		Logger:          logger,
+		Registry:        registry,
+		Toggles:         toggles,
+		RateLimits:      cfg.RateLimit,
+		Verification:    cfg.Verification,
+		Deletion:        cfg.Deletion,
+		TwoFactor:       cfg.TwoFactor,
+		ReadinessChecks: checks,
+	})
+	if cfg.Admin.Addr != "" {
+		stopAdmin := startAdminServer(cfg.Admin.Addr, admin.NewHandler(cfg, registry, toggles, deps, deps))
+		defer stopAdmin()
+	}
 
 	done := make(chan struct{}, 1)
 	go server.Start(*cfg.Server, done)
 	<-done
+	return nil
 }
 
-func newDependencies(cfg *config.Configuration) http.Dependencies {
-	return http.ServerDependencies{
-		AccountsStore:  newAccountsStore(cfg.AccountsStore, cfg.Hash),
-		ArgumentsStore: newArgumentsStore(cfg.ArgumentsStore),
-		Emailer:        email.ConsoleEmailer{},
+// newDependencies makes everything the server needs, and the checks which make sure the stores are reachable.
+// It also starts the worker which sends the emails queued in the accounts store, and the one which purges deleted accounts.
+// If registry isn't nil, the stores and emailer record metrics in it.
+// If tracing is on, the emailer records spans too.
+// The returned function stops the workers, and then flushes and closes the stores. Call it once they're no longer in use.
+func newDependencies(cfg *config.Configuration, registry *prometheus.Registry) (http.Dependencies, []health.Check, func()) {
+	var registerer prometheus.Registerer
+	if registry != nil {
+		registerer = registry
+	}
+	accountsStore, closeAccounts := newAccountsStore(cfg, registerer)
+	argumentsStore, closeArguments := newArgumentsStore(cfg.ArgumentsStore, registerer)
+	checks := append(pingCheck("accounts_store", accountsStore), pingCheck("arguments_store", argumentsStore)...)
+	emailer := newEmailer(cfg.Email)
+	if registry != nil {
+		storeMetrics := metrics.NewStores(registry)
+		accountsStore = storeMetrics.Accounts(accountsStore)
+		argumentsStore = storeMetrics.Arguments(argumentsStore)
+		emailer = metrics.NewEmailer(emailer, registry)
+	}
+	if cfg.Tracing.Exporter != config.TracingExporterNone {
+		emailer = tracing.NewEmailer(emailer)
+	}
+	worker := outbox.NewWorker(accountsStore, emailer, *cfg.Outbox, nil)
+	worker.Start()
+	purger := deletion.NewPurger(accountsStore, *cfg.Deletion, nil)
+	purger.Start()
+	accountsStore = lockout.NewStore(accountsStore, outbox.Emailer{Outbox: accountsStore}, *cfg.Lockout, nil)
+	deps := http.ServerDependencies{
+		AccountsStore:  accountsStore,
+		ArgumentsStore: argumentsStore,
+	}
+	return deps, checks, func() {
+		worker.Stop()
+		purger.Stop()
+		closeAccounts()
+		closeArguments()
 	}
 }
 
-func newAccountsStore(cfg *config.Storage, cfgHash *config.Hash) accounts.Store {
+// newEmailer makes the configured Emailer.
+func newEmailer(cfg *config.Email) email.Emailer {
+	switch cfg.Type {
+	case config.EmailTypeSMTP:
+		emailer, err := email.NewSMTPEmailer(*cfg)
+		if err != nil {
+			log.Fatalf("Failed to set up the SMTP emailer: %v", err)
+		}
+		return emailer
+	case config.EmailTypeFile:
+		emailer, err := email.NewFileEmailer(*cfg)
+		if err != nil {
+			log.Fatalf("Failed to set up the file emailer: %v", err)
+		}
+		return emailer
+	default:
+		return email.ConsoleEmailer{}
+	}
+}
+
+// newAccountsStore makes the configured store, and a function which closes it.
+// If registerer isn't nil, the store's connection pool stats will be registered on it.
+func newAccountsStore(cfg *config.Configuration, registerer prometheus.Registerer) (accounts.Store, func()) {
+	policy, err := passwords.NewPolicy(*cfg.PasswordPolicy)
+	if err != nil {
+		log.Fatalf("Failed to load the password policy: %v", err)
+	}
+	expiry := tokens.Expiry{
+		Reset:        cfg.Tokens.ResetExpiry(),
+		Verification: cfg.Tokens.VerificationExpiry(),
+	}
+	store, closeStore := newAccountsStorage(cfg.AccountsStore, passwords.NewHasher(*cfg.Hash), policy, expiry, registerer)
+	return store, func() {
+		closeStore()
+		policy.Close()
+	}
+}
+
+func newAccountsStorage(cfg *config.Storage, hasher *passwords.Hasher, policy *passwords.Policy, expiry tokens.Expiry, registerer prometheus.Registerer) (accounts.Store, func()) {
 	switch cfg.Type {
 	case config.StorageTypeMemory:
-		return accountsMemory.NewMemoryStore()
+		store := accountsMemory.NewMemoryStoreWith(hasher, policy, expiry)
+		return store, startSnapshots(cfg.Memory, store)
 	case config.StorageTypePostgres:
-		return accountsPostgres.NewPostgresStore(postgres.NewPGXPool(cfg.Postgres), passwords.NewHasher(*cfgHash))
+		pool := postgres.NewPGXPool(cfg.Postgres)
+		registerPool(registerer, "accounts", pool)
+		return accountsPostgres.NewPostgresStore(pool, hasher, policy, expiry), pool.Close
+	case config.StorageTypeSQLite:
+		db := newSQLiteDB(cfg.SQLite, accountsSQLite.Migrations)
+		return accountsSQLite.NewSQLiteStore(db, hasher, policy, expiry), closeSQLiteDB(db)
 	default:
 		panic("Invalid config storage.type: " + cfg.Type + ". This should be caught during config valation.")
 	}
 }
 
-func newArgumentsStore(cfg *config.Storage) arguments.Store {
+// newArgumentsStore makes the configured store, and a function which closes it.
+// If registerer isn't nil, the store's connection pool stats will be registered on it.
+func newArgumentsStore(cfg *config.Storage, registerer prometheus.Registerer) (arguments.Store, func()) {
 	switch cfg.Type {
 	case config.StorageTypeMemory:
-		return argumentsMemory.NewMemoryStore()
+		store := argumentsMemory.NewMemoryStore()
+		return store, startSnapshots(cfg.Memory, store)
 	case config.StorageTypePostgres:
-		return argumentsPostgres.NewPostgresStore(postgres.NewPGXPool(cfg.Postgres))
+		pool := postgres.NewPGXPool(cfg.Postgres)
+		registerPool(registerer, "arguments", pool)
+		return argumentsPostgres.NewPostgresStore(pool), pool.Close
+	case config.StorageTypeSQLite:
+		db := newSQLiteDB(cfg.SQLite, argumentsSQLite.Migrations)
+		return argumentsSQLite.NewSQLiteStore(db), closeSQLiteDB(db)
 	default:
 		panic("Invalid config storage.type: " + cfg.Type + ". This should be caught during config valation.")
 	}
 }
+
+// pingCheck returns a readiness check for the store, if it connects to a database.
+func pingCheck(name string, store interface{}) []health.Check {
+	if pinger, ok := store.(health.Pinger); ok {
+		return []health.Check{{
+			Name: name,
+			Ping: pinger.Ping,
+		}}
+	}
+	return nil
+}
+
+func registerPool(registerer prometheus.Registerer, database string, pool *pgxpool.Pool) {
+	if registerer != nil {
+		registerer.MustRegister(metrics.NewPoolCollector(database, pool))
+	}
+}
+
+// startAdminServer serves the admin endpoints on their own port.
+// The returned function shuts that server down.
+func startAdminServer(addr string, handler nethttp.Handler) func() {
+	server := admin.NewServer(addr, handler)
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, nethttp.ErrServerClosed) {
+			log.Fatalf("Failed to serve the admin endpoints on %s: %v", addr, err)
+		}
+	}()
+	return func() {
+		if err := server.Shutdown(context.Background()); err != nil {
+			log.Printf("ERROR: Failed to shut down the admin server: %v", err)
+		}
+	}
+}
+
+// startSnapshots loads the store's snapshot, if one is configured, and starts saving it periodically.
+// The returned function saves one last snapshot.
+func startSnapshots(cfg *config.Memory, store memory.Snapshottable) func() {
+	if cfg.SnapshotPath == "" {
+		return func() {}
+	}
+	snapshotter := memory.NewSnapshotter(cfg.SnapshotPath, store)
+	if err := snapshotter.Load(); err != nil {
+		log.Fatalf("Failed to load snapshot: %v", err)
+	}
+	snapshotter.Start(cfg.SnapshotInterval())
+	return func() {
+		if err := snapshotter.Stop(); err != nil {
+			log.Printf("ERROR: Failed to save the final snapshot to %s: %v", cfg.SnapshotPath, err)
+		}
+	}
+}
+
+// newSQLiteDB opens the database file and applies any pending migrations.
+// SQLite is meant to work without any setup, so this doesn't wait for "migrate up".
+func newSQLiteDB(cfg *config.SQLite, loadMigrations func() ([]migrations.Migration, error)) *sql.DB {
+	db := sqlite.NewDB(cfg)
+	loaded, err := loadMigrations()
+	if err != nil {
+		log.Fatalf("Failed to load the migrations for %s: %v", cfg.Path, err)
+	}
+	if err := sqlite.Migrate(db, loaded); err != nil {
+		log.Fatalf("Failed to migrate %s: %v", cfg.Path, err)
+	}
+	return db
+}
+
+func closeSQLiteDB(db *sql.DB) func() {
+	return func() {
+		if err := db.Close(); err != nil {
+			log.Printf("ERROR: Failed to close sqlite database: %v", err)
+		}
+	}
+}
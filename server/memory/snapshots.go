@@ -0,0 +1,113 @@
+// Package memory keeps the in-memory stores' data on disk between restarts.
+package memory
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Snapshottable is implemented by stores which can save and restore all their data at once.
+type Snapshottable interface {
+	WriteSnapshot(w io.Writer) error
+	ReadSnapshot(r io.Reader) error
+}
+
+// Snapshotter saves a store's data to a file, and loads it back again.
+// Use NewSnapshotter() to make one.
+type Snapshotter struct {
+	path  string
+	store Snapshottable
+
+	// saving makes sure only one Save() writes the file at a time.
+	saving sync.Mutex
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// NewSnapshotter makes a Snapshotter which keeps the store's data in the file at path.
+func NewSnapshotter(path string, store Snapshottable) *Snapshotter {
+	return &Snapshotter{
+		path:  path,
+		store: store,
+	}
+}
+
+// Load reads the snapshot file into the store.
+// If the file doesn't exist yet, the store is left alone.
+func (s *Snapshotter) Load() error {
+	file, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := s.store.ReadSnapshot(file); err != nil {
+		return fmt.Errorf("%s: %v", s.path, err)
+	}
+	return nil
+}
+
+// Save writes the store's data to the snapshot file.
+//
+// The data goes to a temp file first, which is then renamed over the old snapshot.
+// This way, a crash partway through never leaves a corrupted snapshot behind.
+func (s *Snapshotter) Save() error {
+	s.saving.Lock()
+	defer s.saving.Unlock()
+
+	temp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create a temp file for the snapshot: %v", err)
+	}
+	defer os.Remove(temp.Name())
+	if err := s.store.WriteSnapshot(temp); err != nil {
+		temp.Close()
+		return fmt.Errorf("failed to write snapshot: %v", err)
+	}
+	if err := temp.Close(); err != nil {
+		return fmt.Errorf("failed to write snapshot: %v", err)
+	}
+	if err := os.Rename(temp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to replace %s: %v", s.path, err)
+	}
+	return nil
+}
+
+// Start saves a snapshot every interval in the background, until Stop() is called.
+func (s *Snapshotter) Start(interval time.Duration) {
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.Save(); err != nil {
+					log.Printf("ERROR: Failed to save a snapshot to %s: %v", s.path, err)
+				}
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends the background saves started by Start(), and then saves one last snapshot.
+// It's safe to call even if Start() wasn't.
+func (s *Snapshotter) Stop() error {
+	if s.stop != nil {
+		close(s.stop)
+		<-s.done
+		s.stop = nil
+	}
+	return s.Save()
+}
@@ -0,0 +1,98 @@
+package memory_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wikisophia/api/server/accounts"
+	accountsMemory "github.com/wikisophia/api/server/accounts/memory"
+	"github.com/wikisophia/api/server/arguments"
+	argumentsMemory "github.com/wikisophia/api/server/arguments/memory"
+	"github.com/wikisophia/api/server/memory"
+)
+
+func TestLoadMissingFileIsEmpty(t *testing.T) {
+	store := argumentsMemory.NewMemoryStore()
+	snapshotter := memory.NewSnapshotter(filepath.Join(t.TempDir(), "missing.json"), store)
+	require.NoError(t, snapshotter.Load())
+	fetched, err := store.FetchSome(context.Background(), arguments.FetchSomeOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, fetched)
+}
+
+func TestArgumentsSurviveRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "arguments.json")
+	ctx := context.Background()
+	store := argumentsMemory.NewMemoryStore()
+	first, err := store.Save(ctx, arguments.Argument{Conclusion: "c1", Premises: []string{"p1", "p2"}})
+	require.NoError(t, err)
+	second, err := store.Save(ctx, arguments.Argument{Conclusion: "c2", Premises: []string{"p3", "p4"}})
+	require.NoError(t, err)
+	_, err = store.Update(ctx, arguments.Argument{ID: second, Conclusion: "c3", Premises: []string{"p5", "p6"}, AuthorID: 7})
+	require.NoError(t, err)
+	require.NoError(t, store.Delete(ctx, first))
+	require.NoError(t, memory.NewSnapshotter(path, store).Save())
+
+	restarted := argumentsMemory.NewMemoryStore()
+	require.NoError(t, memory.NewSnapshotter(path, restarted).Load())
+	_, err = restarted.FetchLive(ctx, first)
+	assert.Error(t, err, "deleted arguments should stay deleted")
+	live, err := restarted.FetchLive(ctx, second)
+	require.NoError(t, err)
+	assert.Equal(t, 2, live.Version)
+	assert.Equal(t, "c3", live.Conclusion)
+	assert.Equal(t, int64(7), live.AuthorID)
+	third, err := restarted.Save(ctx, arguments.Argument{Conclusion: "c4", Premises: []string{"p7", "p8"}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), third, "IDs shouldn't be reused after a restart")
+}
+
+func TestAccountsSurviveRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "accounts.json")
+	ctx := context.Background()
+	store := accountsMemory.NewMemoryStore()
+	account, _, err := store.NewResetToken(ctx, "someone@soph.wiki")
+	require.NoError(t, err)
+	require.NoError(t, store.SetForgottenPassword(ctx, account.ID, "some-password", account.ResetToken))
+	pending, _, err := store.NewResetToken(ctx, "pending@soph.wiki")
+	require.NoError(t, err)
+	require.NoError(t, memory.NewSnapshotter(path, store).Save())
+
+	restarted := accountsMemory.NewMemoryStore()
+	require.NoError(t, memory.NewSnapshotter(path, restarted).Load())
+	id, err := restarted.Authenticate(ctx, "someone@soph.wiki", "some-password")
+	require.NoError(t, err)
+	assert.Equal(t, account.ID, id)
+	require.NoError(t, restarted.SetForgottenPassword(ctx, pending.ID, "other-password", pending.ResetToken))
+	newAccount, isNew, err := restarted.NewResetToken(ctx, "new@soph.wiki")
+	require.NoError(t, err)
+	assert.True(t, isNew)
+	assert.Equal(t, pending.ID+1, newAccount.ID)
+}
+
+func TestStopSavesFinalSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "accounts.json")
+	store := accountsMemory.NewMemoryStore()
+	snapshotter := memory.NewSnapshotter(path, store)
+	snapshotter.Start(time.Hour)
+	_, _, err := store.NewResetToken(context.Background(), "someone@soph.wiki")
+	require.NoError(t, err)
+	require.NoError(t, snapshotter.Stop())
+
+	restarted := accountsMemory.NewMemoryStore()
+	require.NoError(t, memory.NewSnapshotter(path, restarted).Load())
+	exported, err := restarted.ExportAccounts(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []accounts.StoredAccount{{ID: 1, Email: "someone@soph.wiki"}}, exported)
+}
+
+func TestCorruptedSnapshotFailsToLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "arguments.json")
+	require.NoError(t, os.WriteFile(path, []byte("not json"), 0600))
+	assert.Error(t, memory.NewSnapshotter(path, argumentsMemory.NewMemoryStore()).Load())
+}
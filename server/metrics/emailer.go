@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/accounts/email"
+)
+
+// NewEmailer returns an Emailer which counts the emails that emailer sends, and fails to send.
+func NewEmailer(emailer email.Emailer, registerer prometheus.Registerer) email.Emailer {
+	sent := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "email",
+		Name:      "sent_total",
+		Help:      "The number of emails which the server tried to send. The result is \"error\" if it failed.",
+	}, []string{"type", "result"})
+	registerer.MustRegister(sent)
+	return &countingEmailer{
+		emailer: emailer,
+		sent:    sent,
+	}
+}
+
+type countingEmailer struct {
+	emailer email.Emailer
+	sent    *prometheus.CounterVec
+}
+
+func (e *countingEmailer) SendWelcome(ctx context.Context, account accounts.Account) error {
+	err := e.emailer.SendWelcome(ctx, account)
+	e.sent.WithLabelValues("welcome", result(err)).Inc()
+	return err
+}
+
+func (e *countingEmailer) SendReset(ctx context.Context, account accounts.Account) error {
+	err := e.emailer.SendReset(ctx, account)
+	e.sent.WithLabelValues("reset", result(err)).Inc()
+	return err
+}
+
+func (e *countingEmailer) SendVerification(ctx context.Context, account accounts.Account) error {
+	err := e.emailer.SendVerification(ctx, account)
+	e.sent.WithLabelValues("verification", result(err)).Inc()
+	return err
+}
+
+func (e *countingEmailer) SendLocked(ctx context.Context, account accounts.Account, until time.Time) error {
+	err := e.emailer.SendLocked(ctx, account, until)
+	e.sent.WithLabelValues("locked", result(err)).Inc()
+	return err
+}
+
+func (e *countingEmailer) SendEmailChange(ctx context.Context, account accounts.Account) error {
+	err := e.emailer.SendEmailChange(ctx, account)
+	e.sent.WithLabelValues("email_change", result(err)).Inc()
+	return err
+}
+
+func (e *countingEmailer) SendEmailChangeNotice(ctx context.Context, account accounts.Account) error {
+	err := e.emailer.SendEmailChangeNotice(ctx, account)
+	e.sent.WithLabelValues("email_change_notice", result(err)).Inc()
+	return err
+}
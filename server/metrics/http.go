@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// knownMethods are the only methods which get their own label value.
+// Clients can send anything, so the rest are lumped together.
+var knownMethods = map[string]bool{
+	"DELETE":  true,
+	"GET":     true,
+	"HEAD":    true,
+	"OPTIONS": true,
+	"PATCH":   true,
+	"POST":    true,
+	"PUT":     true,
+}
+
+// HTTP counts the requests which the API server handles.
+type HTTP struct {
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+// NewHTTP makes the HTTP metrics and registers them.
+func NewHTTP(registerer prometheus.Registerer) *HTTP {
+	labels := []string{"method", "route", "status"}
+	m := &HTTP{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "requests_total",
+			Help:      "The number of HTTP requests which the server has finished.",
+		}, labels),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "How long the server took to finish HTTP requests.",
+			Buckets:   prometheus.DefBuckets,
+		}, labels),
+	}
+	registerer.MustRegister(m.requests, m.duration)
+	return m
+}
+
+// Observe records a finished request. The route should be the pattern, like "/arguments/:id",
+// so that the number of label values stays small. Requests which didn't match a route should use "".
+func (m *HTTP) Observe(method, route string, status int, elapsed time.Duration) {
+	if route == "" {
+		route = "unmatched"
+	}
+	if !knownMethods[method] {
+		method = "OTHER"
+	}
+	statusLabel := strconv.Itoa(status)
+	m.requests.WithLabelValues(method, route, statusLabel).Inc()
+	m.duration.WithLabelValues(method, route, statusLabel).Observe(elapsed.Seconds())
+}
@@ -0,0 +1,41 @@
+// Package metrics reports on the app's health in the Prometheus format.
+//
+// Everything is registered on a Registry from NewRegistry, rather than Prometheus' global one,
+// so that tests can make as many servers as they like.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace prefixes all the app's metric names.
+const namespace = "wikisophia"
+
+// NewRegistry makes a Registry which already has the Go runtime and process metrics.
+func NewRegistry() *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return registry
+}
+
+// Handler serves GET /metrics requests for everything in the registry.
+func Handler(registry *prometheus.Registry) http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{
+		Registry: registry,
+	})
+}
+
+// result describes how an operation ended, for the "result" label.
+func result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
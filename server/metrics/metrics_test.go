@@ -0,0 +1,105 @@
+package metrics_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wikisophia/api/server/accounts"
+	argumentsMemory "github.com/wikisophia/api/server/arguments/memory"
+	"github.com/wikisophia/api/server/metrics"
+)
+
+func TestHTTPMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	httpMetrics := metrics.NewHTTP(registry)
+	httpMetrics.Observe("GET", "/arguments/:id", http.StatusOK, time.Millisecond)
+	httpMetrics.Observe("GET", "/arguments/:id", http.StatusOK, time.Millisecond)
+	httpMetrics.Observe("BREW", "", http.StatusNotFound, time.Millisecond)
+
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(`
+# HELP wikisophia_http_requests_total The number of HTTP requests which the server has finished.
+# TYPE wikisophia_http_requests_total counter
+wikisophia_http_requests_total{method="GET",route="/arguments/:id",status="200"} 2
+wikisophia_http_requests_total{method="OTHER",route="unmatched",status="404"} 1
+`), "wikisophia_http_requests_total"))
+}
+
+func TestStoreMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	store := metrics.NewStores(registry).Arguments(argumentsMemory.NewMemoryStore())
+	_, err := store.FetchLive(context.Background(), 1)
+	require.Error(t, err)
+
+	assert.Equal(t, 1, testutil.CollectAndCount(registry, "wikisophia_store_operation_duration_seconds"))
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	labels := map[string]string{}
+	for _, label := range families[0].GetMetric()[0].GetLabel() {
+		labels[label.GetName()] = label.GetValue()
+	}
+	assert.Equal(t, map[string]string{"store": "arguments", "operation": "FetchLive", "result": "error"}, labels)
+}
+
+func TestEmailerMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	emailer := metrics.NewEmailer(failingEmailer{}, registry)
+	emailer.SendWelcome(context.Background(), accounts.Account{})
+	emailer.SendReset(context.Background(), accounts.Account{})
+	emailer.SendReset(context.Background(), accounts.Account{})
+	emailer.SendVerification(context.Background(), accounts.Account{})
+	emailer.SendLocked(context.Background(), accounts.Account{}, time.Now())
+
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(`
+# HELP wikisophia_email_sent_total The number of emails which the server tried to send. The result is "error" if it failed.
+# TYPE wikisophia_email_sent_total counter
+wikisophia_email_sent_total{result="error",type="locked"} 1
+wikisophia_email_sent_total{result="error",type="reset"} 2
+wikisophia_email_sent_total{result="error",type="verification"} 1
+wikisophia_email_sent_total{result="error",type="welcome"} 1
+`)))
+}
+
+func TestHandler(t *testing.T) {
+	registry := metrics.NewRegistry()
+	metrics.NewHTTP(registry).Observe("GET", "/arguments", http.StatusOK, time.Millisecond)
+	rr := httptest.NewRecorder()
+	metrics.Handler(registry).ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `wikisophia_http_requests_total{method="GET",route="/arguments",status="200"} 1`)
+	assert.Contains(t, rr.Body.String(), "go_goroutines")
+}
+
+type failingEmailer struct{}
+
+func (failingEmailer) SendWelcome(ctx context.Context, account accounts.Account) error {
+	return errors.New("smtp is down")
+}
+
+func (failingEmailer) SendReset(ctx context.Context, account accounts.Account) error {
+	return errors.New("smtp is down")
+}
+
+func (failingEmailer) SendVerification(ctx context.Context, account accounts.Account) error {
+	return errors.New("smtp is down")
+}
+
+func (failingEmailer) SendLocked(ctx context.Context, account accounts.Account, until time.Time) error {
+	return errors.New("smtp is down")
+}
+
+func (failingEmailer) SendEmailChange(ctx context.Context, account accounts.Account) error {
+	return errors.New("smtp is down")
+}
+
+func (failingEmailer) SendEmailChangeNotice(ctx context.Context, account accounts.Account) error {
+	return errors.New("smtp is down")
+}
@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// NewPoolCollector reports the connection stats of a pgx pool.
+// The database names the pool in the "database" label, so that each pool can have its own collector.
+func NewPoolCollector(database string, pool *pgxpool.Pool) prometheus.Collector {
+	labels := prometheus.Labels{"database": database}
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "pgxpool", name), help, nil, labels)
+	}
+	return &poolCollector{
+		pool:                 pool,
+		acquireCount:         desc("acquire_total", "The number of connections which have been acquired from the pool."),
+		acquireDuration:      desc("acquire_duration_seconds_total", "The total time spent waiting to acquire connections."),
+		canceledAcquireCount: desc("canceled_acquire_total", "The number of acquires which were cancelled by their context."),
+		emptyAcquireCount:    desc("empty_acquire_total", "The number of acquires which had to wait because the pool was empty."),
+		acquiredConns:        desc("acquired_connections", "The number of connections which are in use."),
+		constructingConns:    desc("constructing_connections", "The number of connections which are being opened."),
+		idleConns:            desc("idle_connections", "The number of open connections which aren't in use."),
+		totalConns:           desc("total_connections", "The number of connections in the pool."),
+		maxConns:             desc("max_connections", "The most connections which the pool will open."),
+	}
+}
+
+type poolCollector struct {
+	pool                 *pgxpool.Pool
+	acquireCount         *prometheus.Desc
+	acquireDuration      *prometheus.Desc
+	canceledAcquireCount *prometheus.Desc
+	emptyAcquireCount    *prometheus.Desc
+	acquiredConns        *prometheus.Desc
+	constructingConns    *prometheus.Desc
+	idleConns            *prometheus.Desc
+	totalConns           *prometheus.Desc
+	maxConns             *prometheus.Desc
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.acquireCount
+	ch <- c.acquireDuration
+	ch <- c.canceledAcquireCount
+	ch <- c.emptyAcquireCount
+	ch <- c.acquiredConns
+	ch <- c.constructingConns
+	ch <- c.idleConns
+	ch <- c.totalConns
+	ch <- c.maxConns
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	stat := c.pool.Stat()
+	ch <- prometheus.MustNewConstMetric(c.acquireCount, prometheus.CounterValue, float64(stat.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.acquireDuration, prometheus.CounterValue, stat.AcquireDuration().Seconds())
+	ch <- prometheus.MustNewConstMetric(c.canceledAcquireCount, prometheus.CounterValue, float64(stat.CanceledAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.emptyAcquireCount, prometheus.CounterValue, float64(stat.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.acquiredConns, prometheus.GaugeValue, float64(stat.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(c.constructingConns, prometheus.GaugeValue, float64(stat.ConstructingConns()))
+	ch <- prometheus.MustNewConstMetric(c.idleConns, prometheus.GaugeValue, float64(stat.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(c.totalConns, prometheus.GaugeValue, float64(stat.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(c.maxConns, prometheus.GaugeValue, float64(stat.MaxConns()))
+}
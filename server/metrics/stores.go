@@ -0,0 +1,293 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/arguments"
+)
+
+// Stores times the calls to the accounts and arguments stores.
+// Use it to wrap each store with Arguments() and Accounts().
+type Stores struct {
+	duration *prometheus.HistogramVec
+}
+
+// NewStores makes the store metrics and registers them.
+func NewStores(registerer prometheus.Registerer) *Stores {
+	m := &Stores{
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "store",
+			Name:      "operation_duration_seconds",
+			Help:      "How long each store operation took. The result is \"error\" if it returned any error.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"store", "operation", "result"}),
+	}
+	registerer.MustRegister(m.duration)
+	return m
+}
+
+// observe records an operation which started at start. It takes a pointer so that
+// it can be deferred before the error is known.
+func (m *Stores) observe(store, operation string, start time.Time, err *error) {
+	m.duration.WithLabelValues(store, operation, result(*err)).Observe(time.Since(start).Seconds())
+}
+
+// Arguments returns a Store which records metrics about every call to store.
+func (m *Stores) Arguments(store arguments.Store) arguments.Store {
+	return &argumentsStore{
+		store:   store,
+		metrics: m,
+	}
+}
+
+type argumentsStore struct {
+	store   arguments.Store
+	metrics *Stores
+}
+
+func (s *argumentsStore) Delete(ctx context.Context, id int64) (err error) {
+	defer s.metrics.observe("arguments", "Delete", time.Now(), &err)
+	return s.store.Delete(ctx, id)
+}
+
+func (s *argumentsStore) ExportArguments(ctx context.Context) (exported []arguments.StoredArgument, err error) {
+	defer s.metrics.observe("arguments", "ExportArguments", time.Now(), &err)
+	return s.store.ExportArguments(ctx)
+}
+
+func (s *argumentsStore) ImportArguments(ctx context.Context, imported []arguments.StoredArgument) (err error) {
+	defer s.metrics.observe("arguments", "ImportArguments", time.Now(), &err)
+	return s.store.ImportArguments(ctx, imported)
+}
+
+func (s *argumentsStore) FetchAuthored(ctx context.Context, authorID int64) (args []arguments.Argument, err error) {
+	defer s.metrics.observe("arguments", "FetchAuthored", time.Now(), &err)
+	return s.store.FetchAuthored(ctx, authorID)
+}
+
+func (s *argumentsStore) FetchSome(ctx context.Context, options arguments.FetchSomeOptions) (args []arguments.Argument, err error) {
+	defer s.metrics.observe("arguments", "FetchSome", time.Now(), &err)
+	return s.store.FetchSome(ctx, options)
+}
+
+func (s *argumentsStore) FetchVersion(ctx context.Context, id int64, version int) (arg arguments.Argument, err error) {
+	defer s.metrics.observe("arguments", "FetchVersion", time.Now(), &err)
+	return s.store.FetchVersion(ctx, id, version)
+}
+
+func (s *argumentsStore) FetchLive(ctx context.Context, id int64) (arg arguments.Argument, err error) {
+	defer s.metrics.observe("arguments", "FetchLive", time.Now(), &err)
+	return s.store.FetchLive(ctx, id)
+}
+
+func (s *argumentsStore) Save(ctx context.Context, argument arguments.Argument) (id int64, err error) {
+	defer s.metrics.observe("arguments", "Save", time.Now(), &err)
+	return s.store.Save(ctx, argument)
+}
+
+func (s *argumentsStore) Update(ctx context.Context, argument arguments.Argument) (version int, err error) {
+	defer s.metrics.observe("arguments", "Update", time.Now(), &err)
+	return s.store.Update(ctx, argument)
+}
+
+// Accounts returns a Store which records metrics about every call to store.
+func (m *Stores) Accounts(store accounts.Store) accounts.Store {
+	return &accountsStore{
+		store:   store,
+		metrics: m,
+	}
+}
+
+type accountsStore struct {
+	store   accounts.Store
+	metrics *Stores
+}
+
+func (s *accountsStore) Authenticate(ctx context.Context, email, password string) (id int64, err error) {
+	defer s.metrics.observe("accounts", "Authenticate", time.Now(), &err)
+	return s.store.Authenticate(ctx, email, password)
+}
+
+func (s *accountsStore) SetForgottenPassword(ctx context.Context, id int64, password, resetToken string) (err error) {
+	defer s.metrics.observe("accounts", "SetForgottenPassword", time.Now(), &err)
+	return s.store.SetForgottenPassword(ctx, id, password, resetToken)
+}
+
+func (s *accountsStore) ChangePassword(ctx context.Context, id int64, oldPassword, newPassword, code string) (err error) {
+	defer s.metrics.observe("accounts", "ChangePassword", time.Now(), &err)
+	return s.store.ChangePassword(ctx, id, oldPassword, newPassword, code)
+}
+
+func (s *accountsStore) NewResetToken(ctx context.Context, email string) (account accounts.Account, isNew bool, err error) {
+	defer s.metrics.observe("accounts", "NewResetToken", time.Now(), &err)
+	return s.store.NewResetToken(ctx, email)
+}
+
+func (s *accountsStore) LoginFailures(ctx context.Context, email string) (failures accounts.LoginFailures, err error) {
+	defer s.metrics.observe("accounts", "LoginFailures", time.Now(), &err)
+	return s.store.LoginFailures(ctx, email)
+}
+
+func (s *accountsStore) RecordLoginFailure(ctx context.Context, id int64) (count int, err error) {
+	defer s.metrics.observe("accounts", "RecordLoginFailure", time.Now(), &err)
+	return s.store.RecordLoginFailure(ctx, id)
+}
+
+func (s *accountsStore) LockAccount(ctx context.Context, id int64, until time.Time) (err error) {
+	defer s.metrics.observe("accounts", "LockAccount", time.Now(), &err)
+	return s.store.LockAccount(ctx, id, until)
+}
+
+func (s *accountsStore) ClearLoginFailures(ctx context.Context, id int64) (err error) {
+	defer s.metrics.observe("accounts", "ClearLoginFailures", time.Now(), &err)
+	return s.store.ClearLoginFailures(ctx, id)
+}
+
+func (s *accountsStore) NewVerificationToken(ctx context.Context, email string) (account accounts.Account, err error) {
+	defer s.metrics.observe("accounts", "NewVerificationToken", time.Now(), &err)
+	return s.store.NewVerificationToken(ctx, email)
+}
+
+func (s *accountsStore) VerifyEmail(ctx context.Context, id int64, token string) (err error) {
+	defer s.metrics.observe("accounts", "VerifyEmail", time.Now(), &err)
+	return s.store.VerifyEmail(ctx, id, token)
+}
+
+func (s *accountsStore) EmailVerifiedAt(ctx context.Context, id int64) (verifiedAt time.Time, err error) {
+	defer s.metrics.observe("accounts", "EmailVerifiedAt", time.Now(), &err)
+	return s.store.EmailVerifiedAt(ctx, id)
+}
+
+func (s *accountsStore) RequestEmailChange(ctx context.Context, id int64, password, newEmail, code string) (account accounts.Account, err error) {
+	defer s.metrics.observe("accounts", "RequestEmailChange", time.Now(), &err)
+	return s.store.RequestEmailChange(ctx, id, password, newEmail, code)
+}
+
+func (s *accountsStore) ConfirmEmailChange(ctx context.Context, id int64, token string) (err error) {
+	defer s.metrics.observe("accounts", "ConfirmEmailChange", time.Now(), &err)
+	return s.store.ConfirmEmailChange(ctx, id, token)
+}
+
+func (s *accountsStore) AccountProfile(ctx context.Context, id int64) (profile accounts.AccountProfile, err error) {
+	defer s.metrics.observe("accounts", "AccountProfile", time.Now(), &err)
+	return s.store.AccountProfile(ctx, id)
+}
+
+func (s *accountsStore) UpdateProfile(ctx context.Context, id int64, update accounts.ProfileUpdate) (profile accounts.AccountProfile, err error) {
+	defer s.metrics.observe("accounts", "UpdateProfile", time.Now(), &err)
+	return s.store.UpdateProfile(ctx, id, update)
+}
+
+func (s *accountsStore) ScheduleDeletion(ctx context.Context, id int64, password string, dueAt time.Time) (err error) {
+	defer s.metrics.observe("accounts", "ScheduleDeletion", time.Now(), &err)
+	return s.store.ScheduleDeletion(ctx, id, password, dueAt)
+}
+
+func (s *accountsStore) CancelDeletion(ctx context.Context, id int64) (err error) {
+	defer s.metrics.observe("accounts", "CancelDeletion", time.Now(), &err)
+	return s.store.CancelDeletion(ctx, id)
+}
+
+func (s *accountsStore) PurgeAccounts(ctx context.Context, now time.Time) (purged int, err error) {
+	defer s.metrics.observe("accounts", "PurgeAccounts", time.Now(), &err)
+	return s.store.PurgeAccounts(ctx, now)
+}
+
+func (s *accountsStore) EnrollTwoFactor(ctx context.Context, id int64, password string) (enrollment accounts.TwoFactorEnrollment, err error) {
+	defer s.metrics.observe("accounts", "EnrollTwoFactor", time.Now(), &err)
+	return s.store.EnrollTwoFactor(ctx, id, password)
+}
+
+func (s *accountsStore) ConfirmTwoFactor(ctx context.Context, id int64, code string) (codes []string, err error) {
+	defer s.metrics.observe("accounts", "ConfirmTwoFactor", time.Now(), &err)
+	return s.store.ConfirmTwoFactor(ctx, id, code)
+}
+
+func (s *accountsStore) CheckTwoFactor(ctx context.Context, id int64, code string) (err error) {
+	defer s.metrics.observe("accounts", "CheckTwoFactor", time.Now(), &err)
+	return s.store.CheckTwoFactor(ctx, id, code)
+}
+
+func (s *accountsStore) DisableTwoFactor(ctx context.Context, id int64, password, code string) (err error) {
+	defer s.metrics.observe("accounts", "DisableTwoFactor", time.Now(), &err)
+	return s.store.DisableTwoFactor(ctx, id, password, code)
+}
+
+func (s *accountsStore) TwoFactorStatus(ctx context.Context, id int64) (status accounts.TwoFactorStatus, err error) {
+	defer s.metrics.observe("accounts", "TwoFactorStatus", time.Now(), &err)
+	return s.store.TwoFactorStatus(ctx, id)
+}
+
+func (s *accountsStore) RequireTwoFactor(ctx context.Context, id int64, required bool) (err error) {
+	defer s.metrics.observe("accounts", "RequireTwoFactor", time.Now(), &err)
+	return s.store.RequireTwoFactor(ctx, id, required)
+}
+
+func (s *accountsStore) SetModerator(ctx context.Context, id int64, moderator bool) (err error) {
+	defer s.metrics.observe("accounts", "SetModerator", time.Now(), &err)
+	return s.store.SetModerator(ctx, id, moderator)
+}
+
+func (s *accountsStore) IsModerator(ctx context.Context, id int64) (moderator bool, err error) {
+	defer s.metrics.observe("accounts", "IsModerator", time.Now(), &err)
+	return s.store.IsModerator(ctx, id)
+}
+
+func (s *accountsStore) StartSession(ctx context.Context, accountID int64, client string, now time.Time) (session accounts.Session, err error) {
+	defer s.metrics.observe("accounts", "StartSession", time.Now(), &err)
+	return s.store.StartSession(ctx, accountID, client, now)
+}
+
+func (s *accountsStore) SessionUsed(ctx context.Context, accountID int64, id int64, now time.Time) (err error) {
+	defer s.metrics.observe("accounts", "SessionUsed", time.Now(), &err)
+	return s.store.SessionUsed(ctx, accountID, id, now)
+}
+
+func (s *accountsStore) AccountSessions(ctx context.Context, accountID int64) (sessions []accounts.Session, err error) {
+	defer s.metrics.observe("accounts", "AccountSessions", time.Now(), &err)
+	return s.store.AccountSessions(ctx, accountID)
+}
+
+func (s *accountsStore) QueueEmail(ctx context.Context, email accounts.QueuedEmail) (err error) {
+	defer s.metrics.observe("accounts", "QueueEmail", time.Now(), &err)
+	return s.store.QueueEmail(ctx, email)
+}
+
+func (s *accountsStore) ClaimEmails(ctx context.Context, now time.Time, limit int, lease time.Duration) (claimed []accounts.QueuedEmail, err error) {
+	defer s.metrics.observe("accounts", "ClaimEmails", time.Now(), &err)
+	return s.store.ClaimEmails(ctx, now, limit, lease)
+}
+
+func (s *accountsStore) EmailSent(ctx context.Context, id int64) (err error) {
+	defer s.metrics.observe("accounts", "EmailSent", time.Now(), &err)
+	return s.store.EmailSent(ctx, id)
+}
+
+func (s *accountsStore) EmailFailed(ctx context.Context, id int64, reason string, retryAt time.Time) (err error) {
+	defer s.metrics.observe("accounts", "EmailFailed", time.Now(), &err)
+	return s.store.EmailFailed(ctx, id, reason, retryAt)
+}
+
+func (s *accountsStore) FailedEmails(ctx context.Context) (failed []accounts.QueuedEmail, err error) {
+	defer s.metrics.observe("accounts", "FailedEmails", time.Now(), &err)
+	return s.store.FailedEmails(ctx)
+}
+
+func (s *accountsStore) RetryEmail(ctx context.Context, id int64) (err error) {
+	defer s.metrics.observe("accounts", "RetryEmail", time.Now(), &err)
+	return s.store.RetryEmail(ctx, id)
+}
+
+func (s *accountsStore) ExportAccounts(ctx context.Context) (exported []accounts.StoredAccount, err error) {
+	defer s.metrics.observe("accounts", "ExportAccounts", time.Now(), &err)
+	return s.store.ExportAccounts(ctx)
+}
+
+func (s *accountsStore) ImportAccounts(ctx context.Context, imported []accounts.StoredAccount) (err error) {
+	defer s.metrics.observe("accounts", "ImportAccounts", time.Now(), &err)
+	return s.store.ImportAccounts(ctx, imported)
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	accountsPostgres "github.com/wikisophia/api/server/accounts/postgres"
+	accountsSQLite "github.com/wikisophia/api/server/accounts/sqlite"
+	argumentsPostgres "github.com/wikisophia/api/server/arguments/postgres"
+	argumentsSQLite "github.com/wikisophia/api/server/arguments/sqlite"
+	"github.com/wikisophia/api/server/config"
+	"github.com/wikisophia/api/server/migrations"
+	"github.com/wikisophia/api/server/postgres"
+	"github.com/wikisophia/api/server/sqlite"
+)
+
+// schema describes the migrations for one of the app's databases.
+type schema struct {
+	name               string
+	storage            *config.Storage
+	postgresMigrations func() ([]migrations.Migration, error)
+	postgresRole       string
+	sqliteMigrations   func() ([]migrations.Migration, error)
+}
+
+func schemas(cfg *config.Configuration) []schema {
+	return []schema{
+		{
+			name:               "accounts",
+			storage:            cfg.AccountsStore,
+			postgresMigrations: accountsPostgres.Migrations,
+			postgresRole:       accountsPostgres.RoleVariable,
+			sqliteMigrations:   accountsSQLite.Migrations,
+		},
+		{
+			name:               "arguments",
+			storage:            cfg.ArgumentsStore,
+			postgresMigrations: argumentsPostgres.Migrations,
+			postgresRole:       argumentsPostgres.RoleVariable,
+			sqliteMigrations:   argumentsSQLite.Migrations,
+		},
+	}
+}
+
+// migrator returns a Migrator for the schema, and a function which closes its connection.
+// If the configured storage type doesn't have a schema, the Migrator will be nil.
+func (s schema) migrator() (*migrations.Migrator, func(), error) {
+	switch s.storage.Type {
+	case config.StorageTypePostgres:
+		loaded, err := s.postgresMigrations()
+		if err != nil {
+			return nil, nil, err
+		}
+		pool := postgres.NewPGXPool(s.storage.Postgres.ForMigrations())
+		return postgres.NewMigrator(pool, s.storage.Postgres.User, loaded, s.postgresRole), pool.Close, nil
+	case config.StorageTypeSQLite:
+		loaded, err := s.sqliteMigrations()
+		if err != nil {
+			return nil, nil, err
+		}
+		db := sqlite.NewDB(s.storage.SQLite)
+		return sqlite.NewMigrator(db, loaded), func() { db.Close() }, nil
+	default:
+		return nil, func() {}, nil
+	}
+}
+
+// migrateOnStartup applies pending migrations to the stores which are configured to do so.
+func migrateOnStartup(cfg *config.Configuration) error {
+	for _, s := range schemas(cfg) {
+		if !s.storage.MigrateOnStartup {
+			continue
+		}
+		if err := migrateUp(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateCommand implements "migrate up|down DATABASE|status|baseline DATABASE VERSION"
+//
+// down and baseline only work on one database at a time, since the databases' migrations are numbered separately.
+func migrateCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New("expected a subcommand: up, down DATABASE, status, or baseline DATABASE VERSION")
+	}
+	cfg := config.MustParse()
+	switch args[0] {
+	case "up":
+		for _, s := range schemas(&cfg) {
+			if err := migrateUp(s); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "down":
+		if len(args) != 2 {
+			return errors.New("down expects the database to roll back: accounts or arguments")
+		}
+		s, err := namedSchema(schemas(&cfg), args[1])
+		if err != nil {
+			return err
+		}
+		return migrateDown(s)
+	case "status":
+		return migrateStatus(schemas(&cfg))
+	case "baseline":
+		if len(args) != 3 {
+			return errors.New("baseline expects the database and the version to mark as applied")
+		}
+		s, err := namedSchema(schemas(&cfg), args[1])
+		if err != nil {
+			return err
+		}
+		version, err := strconv.Atoi(args[2])
+		if err != nil {
+			return fmt.Errorf("invalid version %s: %v", args[2], err)
+		}
+		return migrateBaseline(s, version)
+	default:
+		return fmt.Errorf("unknown migrate subcommand %q", args[0])
+	}
+}
+
+// namedSchema returns the schema for the database called name.
+func namedSchema(all []schema, name string) (schema, error) {
+	names := make([]string, 0, len(all))
+	for _, s := range all {
+		if s.name == name {
+			return s, nil
+		}
+		names = append(names, s.name)
+	}
+	return schema{}, fmt.Errorf("unknown database %q: expected one of %s", name, strings.Join(names, ", "))
+}
+
+func migrateUp(s schema) error {
+	migrator, closeDB, err := s.migrator()
+	if err != nil || migrator == nil {
+		return err
+	}
+	defer closeDB()
+	applied, err := migrator.Up(context.Background())
+	for _, migration := range applied {
+		log.Printf("Applied %s migration %04d_%s", s.name, migration.Version, migration.Name)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", s.name, err)
+	}
+	if len(applied) == 0 {
+		log.Printf("The %s database is up to date", s.name)
+	}
+	return nil
+}
+
+func migrateDown(s schema) error {
+	migrator, closeDB, err := s.migrator()
+	if err != nil || migrator == nil {
+		return err
+	}
+	defer closeDB()
+	rolledBack, err := migrator.Down(context.Background())
+	if err != nil {
+		return fmt.Errorf("%s: %v", s.name, err)
+	}
+	if rolledBack == nil {
+		log.Printf("The %s database has no migrations to roll back", s.name)
+	} else {
+		log.Printf("Rolled back %s migration %04d_%s", s.name, rolledBack.Version, rolledBack.Name)
+	}
+	return nil
+}
+
+func migrateBaseline(s schema, version int) error {
+	migrator, closeDB, err := s.migrator()
+	if err != nil || migrator == nil {
+		return err
+	}
+	defer closeDB()
+	marked, err := migrator.Baseline(context.Background(), version)
+	for _, migration := range marked {
+		log.Printf("Marked %s migration %04d_%s as applied", s.name, migration.Version, migration.Name)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", s.name, err)
+	}
+	return nil
+}
+
+func migrateStatus(all []schema) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "DATABASE\tMIGRATION\tAPPLIED ON")
+	for _, s := range all {
+		migrator, closeDB, err := s.migrator()
+		if err != nil {
+			return err
+		}
+		if migrator == nil {
+			fmt.Fprintf(w, "%s\t-\tstorage type %s has no schema\n", s.name, s.storage.Type)
+			continue
+		}
+		statuses, err := migrator.Status(context.Background())
+		closeDB()
+		if err != nil {
+			return fmt.Errorf("%s: %v", s.name, err)
+		}
+		for _, status := range statuses {
+			appliedOn := "pending"
+			if status.AppliedOn != nil {
+				appliedOn = status.AppliedOn.Format("2006-01-02 15:04:05 MST")
+			}
+			fmt.Fprintf(w, "%s\t%04d_%s\t%s\n", s.name, status.Version, status.Name, appliedOn)
+		}
+	}
+	return w.Flush()
+}
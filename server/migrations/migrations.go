@@ -0,0 +1,234 @@
+// Package migrations applies versioned schema changes to a database.
+//
+// Migrations are SQL files named like "0001_create_accounts.up.sql", each with a
+// matching "0001_create_accounts.down.sql" which undoes it. They're applied in
+// version order, and the applied versions are recorded in a schema_migrations table
+// so that each one only runs once.
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Migration is a single, reversible schema change.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status describes whether a Migration has been applied to the database yet.
+type Status struct {
+	Migration
+	// AppliedOn is nil if the migration hasn't been applied.
+	AppliedOn *time.Time
+}
+
+// Database is implemented by each storage backend that migrations can run against.
+type Database interface {
+	// Lock blocks until no other process is running migrations on the database.
+	// The returned function releases the lock.
+	Lock(ctx context.Context) (unlock func(), err error)
+	// EnsureVersionTable creates the schema_migrations table if it doesn't exist yet.
+	EnsureVersionTable(ctx context.Context) error
+	// AppliedVersions returns the time that each applied migration was run, keyed by version.
+	AppliedVersions(ctx context.Context) (map[int]time.Time, error)
+	// Apply runs the SQL and records that the migration was applied or rolled back.
+	// Both of these must happen atomically. If sql is empty, only the record changes.
+	Apply(ctx context.Context, migration Migration, sql string, up bool) error
+}
+
+var fileNamePattern = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Load reads all the migrations in the root of fsys.
+// Every migration must have both an up and a down file.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration, len(entries)/2)
+	for _, entry := range entries {
+		matches := fileNamePattern.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || matches == nil {
+			continue
+		}
+		version, err := strconv.Atoi(matches[1])
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("%s: migration versions must be positive integers", entry.Name())
+		}
+		data, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: matches[2]}
+			byVersion[version] = migration
+		} else if migration.Name != matches[2] {
+			return nil, fmt.Errorf("version %d is used by both %s and %s", version, migration.Name, matches[2])
+		}
+		if matches[3] == "up" {
+			migration.Up = string(data)
+		} else {
+			migration.Down = string(data)
+		}
+	}
+
+	loaded := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s must have both an up and a down file", migration.Version, migration.Name)
+		}
+		loaded = append(loaded, *migration)
+	}
+	sort.Slice(loaded, func(i, j int) bool {
+		return loaded[i].Version < loaded[j].Version
+	})
+	return loaded, nil
+}
+
+// Migrator moves a database's schema between versions.
+type Migrator struct {
+	db         Database
+	migrations []Migration
+	// Substitute transforms a migration's SQL before it's run.
+	// Backends use this to fill in variables, like the name of the role to grant privileges to.
+	substitute func(sql string) string
+}
+
+// NewMigrator makes a Migrator which applies the migrations to db.
+// The migrations must be sorted by version, as returned by Load.
+//
+// substitute may be nil if the migrations don't use any variables.
+func NewMigrator(db Database, migrations []Migration, substitute func(sql string) string) *Migrator {
+	if substitute == nil {
+		substitute = func(sql string) string { return sql }
+	}
+	return &Migrator{
+		db:         db,
+		migrations: migrations,
+		substitute: substitute,
+	}
+}
+
+// Up applies all the pending migrations, and returns the ones which were run.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+	err := m.locked(ctx, func(done map[int]time.Time) error {
+		for _, migration := range m.migrations {
+			if _, ok := done[migration.Version]; ok {
+				continue
+			}
+			if err := m.db.Apply(ctx, migration, m.substitute(migration.Up), true); err != nil {
+				return fmt.Errorf("migration %04d_%s failed: %w", migration.Version, migration.Name, err)
+			}
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down rolls back the most recently applied migration, and returns it.
+// If no migrations have been applied, it returns nil.
+func (m *Migrator) Down(ctx context.Context) (*Migration, error) {
+	var rolledBack *Migration
+	err := m.locked(ctx, func(done map[int]time.Time) error {
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			migration := m.migrations[i]
+			if _, ok := done[migration.Version]; !ok {
+				continue
+			}
+			if err := m.db.Apply(ctx, migration, m.substitute(migration.Down), false); err != nil {
+				return fmt.Errorf("rollback of %04d_%s failed: %w", migration.Version, migration.Name, err)
+			}
+			rolledBack = &migration
+			return nil
+		}
+		return nil
+	})
+	return rolledBack, err
+}
+
+// Baseline marks every migration up to and including version as applied, without running them.
+// This is for databases whose schema was set up by hand before migrations existed.
+func (m *Migrator) Baseline(ctx context.Context, version int) ([]Migration, error) {
+	var marked []Migration
+	err := m.locked(ctx, func(done map[int]time.Time) error {
+		for _, migration := range m.migrations {
+			if migration.Version > version {
+				break
+			}
+			if _, ok := done[migration.Version]; ok {
+				continue
+			}
+			if err := m.db.Apply(ctx, migration, "", true); err != nil {
+				return fmt.Errorf("failed to mark %04d_%s as applied: %w", migration.Version, migration.Name, err)
+			}
+			marked = append(marked, migration)
+		}
+		return nil
+	})
+	return marked, err
+}
+
+// Status reports which migrations have been applied.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	if err := m.db.EnsureVersionTable(ctx); err != nil {
+		return nil, err
+	}
+	done, err := m.db.AppliedVersions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := Status{Migration: migration}
+		if appliedOn, ok := done[migration.Version]; ok {
+			status.AppliedOn = &appliedOn
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// ErrUnknownVersion is returned if the database has a migration applied which the
+// Migrator doesn't know about. This usually means the code is older than the database.
+var ErrUnknownVersion = errors.New("the database has migrations applied which this code doesn't know about")
+
+func (m *Migrator) locked(ctx context.Context, work func(done map[int]time.Time) error) error {
+	if err := m.db.EnsureVersionTable(ctx); err != nil {
+		return err
+	}
+	unlock, err := m.db.Lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	done, err := m.db.AppliedVersions(ctx)
+	if err != nil {
+		return err
+	}
+	known := make(map[int]struct{}, len(m.migrations))
+	for _, migration := range m.migrations {
+		known[migration.Version] = struct{}{}
+	}
+	for version := range done {
+		if _, ok := known[version]; !ok {
+			return fmt.Errorf("%w: version %d", ErrUnknownVersion, version)
+		}
+	}
+	return work(done)
+}
@@ -0,0 +1,156 @@
+package migrations_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wikisophia/api/server/migrations"
+)
+
+func TestLoadSortsByVersion(t *testing.T) {
+	loaded, err := migrations.Load(fstest.MapFS{
+		"0002_second.up.sql":   {Data: []byte("up 2")},
+		"0002_second.down.sql": {Data: []byte("down 2")},
+		"0001_first.up.sql":    {Data: []byte("up 1")},
+		"0001_first.down.sql":  {Data: []byte("down 1")},
+		"README.md":            {Data: []byte("ignored")},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []migrations.Migration{
+		{Version: 1, Name: "first", Up: "up 1", Down: "down 1"},
+		{Version: 2, Name: "second", Up: "up 2", Down: "down 2"},
+	}, loaded)
+}
+
+func TestLoadRequiresDownFiles(t *testing.T) {
+	_, err := migrations.Load(fstest.MapFS{
+		"0001_first.up.sql": {Data: []byte("up 1")},
+	})
+	assert.Error(t, err)
+}
+
+func TestLoadRejectsDuplicateVersions(t *testing.T) {
+	_, err := migrations.Load(fstest.MapFS{
+		"0001_first.up.sql":   {Data: []byte("up 1")},
+		"0001_first.down.sql": {Data: []byte("down 1")},
+		"0001_other.up.sql":   {Data: []byte("up 1")},
+		"0001_other.down.sql": {Data: []byte("down 1")},
+	})
+	assert.Error(t, err)
+}
+
+func TestUpDownStatus(t *testing.T) {
+	db := newFakeDatabase()
+	migrator := migrations.NewMigrator(db, sampleMigrations(), func(sql string) string {
+		return sql + " as someone"
+	})
+
+	applied, err := migrator.Up(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, applied, 2)
+	assert.Equal(t, []string{"up 1 as someone", "up 2 as someone"}, db.ran)
+
+	applied, err = migrator.Up(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, applied)
+
+	rolledBack, err := migrator.Down(context.Background())
+	require.NoError(t, err)
+	require.NotNil(t, rolledBack)
+	assert.Equal(t, 2, rolledBack.Version)
+	assert.Equal(t, "down 2 as someone", db.ran[len(db.ran)-1])
+
+	statuses, err := migrator.Status(context.Background())
+	require.NoError(t, err)
+	require.Len(t, statuses, 2)
+	assert.NotNil(t, statuses[0].AppliedOn)
+	assert.Nil(t, statuses[1].AppliedOn)
+	assert.Equal(t, 0, db.locked)
+}
+
+func TestFailedMigrationStopsUp(t *testing.T) {
+	db := newFakeDatabase()
+	db.failOn = "up 1"
+	applied, err := migrations.NewMigrator(db, sampleMigrations(), nil).Up(context.Background())
+	require.Error(t, err)
+	assert.Empty(t, applied)
+	assert.Empty(t, db.applied)
+}
+
+func TestBaselineSkipsSQL(t *testing.T) {
+	db := newFakeDatabase()
+	migrator := migrations.NewMigrator(db, sampleMigrations(), nil)
+	marked, err := migrator.Baseline(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Len(t, marked, 1)
+	assert.Empty(t, db.ran)
+
+	applied, err := migrator.Up(context.Background())
+	require.NoError(t, err)
+	require.Len(t, applied, 1)
+	assert.Equal(t, []string{"up 2"}, db.ran)
+}
+
+func TestUnknownVersionsRejected(t *testing.T) {
+	db := newFakeDatabase()
+	db.applied[3] = time.Now()
+	_, err := migrations.NewMigrator(db, sampleMigrations(), nil).Up(context.Background())
+	assert.True(t, errors.Is(err, migrations.ErrUnknownVersion))
+}
+
+func sampleMigrations() []migrations.Migration {
+	return []migrations.Migration{
+		{Version: 1, Name: "first", Up: "up 1", Down: "down 1"},
+		{Version: 2, Name: "second", Up: "up 2", Down: "down 2"},
+	}
+}
+
+func newFakeDatabase() *fakeDatabase {
+	return &fakeDatabase{
+		applied: make(map[int]time.Time),
+	}
+}
+
+type fakeDatabase struct {
+	applied map[int]time.Time
+	ran     []string
+	locked  int
+	failOn  string
+}
+
+func (db *fakeDatabase) Lock(ctx context.Context) (func(), error) {
+	db.locked++
+	return func() { db.locked-- }, nil
+}
+
+func (db *fakeDatabase) EnsureVersionTable(ctx context.Context) error {
+	return nil
+}
+
+func (db *fakeDatabase) AppliedVersions(ctx context.Context) (map[int]time.Time, error) {
+	copied := make(map[int]time.Time, len(db.applied))
+	for version, appliedOn := range db.applied {
+		copied[version] = appliedOn
+	}
+	return copied, nil
+}
+
+func (db *fakeDatabase) Apply(ctx context.Context, migration migrations.Migration, sql string, up bool) error {
+	if sql != "" && sql == db.failOn {
+		return errors.New("syntax error")
+	}
+	if sql != "" {
+		db.ran = append(db.ran, sql)
+	}
+	if up {
+		db.applied[migration.Version] = time.Now()
+	} else {
+		delete(db.applied, migration.Version)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package passwords
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/wikisophia/api/server/config"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/crypto/argon2"
+)
+
+// Argon2id is the Algorithm this project hashes with:
+// https://www.alexedwards.net/blog/how-to-hash-and-verify-passwords-with-argon2-in-go
+// Create these with the NewArgon2id() function.
+type Argon2id struct {
+	params config.Hash
+	salts  *sync.Pool
+}
+
+// NewArgon2id makes an Argon2id which hashes with the given params.
+func NewArgon2id(params config.Hash) *Argon2id {
+	return &Argon2id{
+		params: params,
+		salts: &sync.Pool{
+			New: func() interface{} {
+				return make([]byte, params.SaltLength)
+			},
+		},
+	}
+}
+
+// argon2Params are the parts of a hash which decide how strong it is.
+type argon2Params struct {
+	memory      uint32
+	time        uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
+// Prefixes implements Algorithm.
+func (a *Argon2id) Prefixes() []string {
+	return []string{"$argon2id$"}
+}
+
+// Hash implements Algorithm.
+func (a *Argon2id) Hash(value string) (string, error) {
+	salt := a.salts.Get().([]byte)
+	defer a.salts.Put(salt)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	return a.doHash([]byte(value), salt, a.params.Time, a.params.Memory, a.params.Parallelism, a.params.KeyLength), nil
+}
+
+// Matches implements Algorithm.
+func (a *Argon2id) Matches(value string, hash string) (bool, error) {
+	params, err := parseArgon2(hash)
+	if err != nil {
+		return false, err
+	}
+	thisHashedValue := a.doHash([]byte(value), params.salt, params.time, params.memory, params.parallelism, uint32(len(params.key)))
+
+	// ConstantTimeCompare to help protect against timing attacks
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(thisHashedValue)) == 1, nil
+}
+
+// Outdated implements Algorithm. Hashes which can't be parsed count as outdated.
+func (a *Argon2id) Outdated(hash string) bool {
+	params, err := parseArgon2(hash)
+	if err != nil {
+		return true
+	}
+	return params.memory < a.params.Memory ||
+		params.time < a.params.Time ||
+		params.parallelism < a.params.Parallelism ||
+		len(params.salt) < int(a.params.SaltLength) ||
+		len(params.key) < int(a.params.KeyLength)
+}
+
+func (a *Argon2id) attributes(hash string) []attribute.KeyValue {
+	params, err := parseArgon2(hash)
+	if err != nil {
+		return nil
+	}
+	return []attribute.KeyValue{
+		attribute.Int("argon2.iterations", int(params.time)),
+		attribute.Int("argon2.memory", int(params.memory)),
+		attribute.Int("argon2.parallelism", int(params.parallelism)),
+	}
+}
+
+func parseArgon2(hash string) (argon2Params, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return argon2Params{}, errors.New("hash does not have the five expected $ symbols")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return argon2Params{}, errors.New("failed to parse the hash version")
+	}
+	if version != argon2.Version {
+		return argon2Params{}, fmt.Errorf("the golang library implements hash version %d, but the password was hashed with %d", argon2.Version, version)
+	}
+
+	var params argon2Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.parallelism); err != nil {
+		return argon2Params{}, errors.New("Could not parse the time, memory, and parallelism params from the hashed value")
+	}
+
+	var err error
+	params.salt, err = base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return argon2Params{}, errors.New("salt was not base64 encoded properly")
+	}
+
+	params.key, err = base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return argon2Params{}, errors.New("hash was not base64 encoded properly")
+	}
+	return params, nil
+}
+
+func (a *Argon2id) doHash(value []byte, salt []byte, time uint32, memory uint32, parallelism uint8, keyLength uint32) string {
+	key := argon2.IDKey(value, salt, time, memory, parallelism, keyLength)
+	encodedSalt := base64.RawStdEncoding.EncodeToString(salt)
+	encodedKey := base64.RawStdEncoding.EncodeToString(key)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, memory, time, parallelism, encodedSalt, encodedKey)
+}
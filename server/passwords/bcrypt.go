@@ -0,0 +1,52 @@
+package passwords
+
+import (
+	"errors"
+
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Bcrypt is an Algorithm for the bcrypt hashes which other systems commonly store.
+// Note that bcrypt ignores everything after the first 72 bytes of a value, and refuses to Hash longer ones.
+type Bcrypt struct {
+	// Cost is the cost new hashes are made with. Hashes with a lower one are Outdated.
+	Cost int
+}
+
+// Prefixes implements Algorithm.
+func (b Bcrypt) Prefixes() []string {
+	return []string{"$2a$", "$2b$", "$2y$"}
+}
+
+// Hash implements Algorithm.
+func (b Bcrypt) Hash(value string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(value), b.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// Matches implements Algorithm.
+func (b Bcrypt) Matches(value string, hash string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(value))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Outdated implements Algorithm. Hashes which can't be parsed count as outdated.
+func (b Bcrypt) Outdated(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost < b.Cost
+}
+
+func (b Bcrypt) attributes(hash string) []attribute.KeyValue {
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return nil
+	}
+	return []attribute.KeyValue{attribute.Int("bcrypt.cost", cost)}
+}
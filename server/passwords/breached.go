@@ -0,0 +1,138 @@
+package passwords
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+)
+
+// BreachedList looks up passwords in a sorted file of SHA-1 hashes, like the "ordered by hash"
+// download of Have I Been Pwned's Pwned Passwords. The file is searched on disk rather than loaded,
+// since the full list is tens of gigabytes.
+//
+// Like the Pwned Passwords range API, lookups find the block of lines which share the first
+// five hex digits of the hash, and then compare the rest. Nothing is sent over the network.
+type BreachedList struct {
+	file *os.File
+	size int64
+}
+
+// hashPrefixLength is how many hex digits of the hash a range shares.
+const hashPrefixLength = 5
+
+// OpenBreachedList opens the file at path. Call Close once the list is no longer in use.
+func OpenBreachedList(path string) (*BreachedList, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the breached password list: %v", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to open the breached password list: %v", err)
+	}
+	return &BreachedList{
+		file: file,
+		size: info.Size(),
+	}, nil
+}
+
+// Contains returns true if the password's hash is in the list.
+// It's safe for concurrent use.
+func (l *BreachedList) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := bytes.ToUpper([]byte(hex.EncodeToString(sum[:])))
+	prefix := hash[:hashPrefixLength]
+
+	// Find the offset of the first line whose prefix is at least as big as ours.
+	low, high := int64(0), l.size
+	for low < high {
+		middle := low + (high-low)/2
+		start, line, err := l.lineAt(middle)
+		if err != nil {
+			return false, err
+		}
+		if line == nil || bytes.Compare(linePrefix(line), prefix) >= 0 {
+			high = middle
+		} else {
+			low = start + int64(len(line))
+		}
+	}
+
+	// Then compare the rest of the hash on each line in the range.
+	start, _, err := l.lineAt(low)
+	if err != nil {
+		return false, err
+	}
+	reader := bufio.NewReaderSize(io.NewSectionReader(l.file, start, l.size-start), readSize)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return false, err
+		}
+		if !bytes.Equal(linePrefix(line), prefix) {
+			return false, nil
+		}
+		if bytes.Equal(bytes.ToUpper(lineHash(line)), hash) {
+			return true, nil
+		}
+		if err == io.EOF {
+			return false, nil
+		}
+	}
+}
+
+// Close closes the file.
+func (l *BreachedList) Close() error {
+	return l.file.Close()
+}
+
+// readSize is the buffer size for reading lines. The lines are about 50 bytes,
+// and each binary search step only needs one or two of them.
+const readSize = 256
+
+// lineAt returns the first line which starts at or after offset, including its newline,
+// and the offset it starts at. The line is nil if there are none.
+func (l *BreachedList) lineAt(offset int64) (int64, []byte, error) {
+	start := offset
+	if offset > 0 {
+		// Start at the byte before, so that a line which starts exactly at offset isn't skipped.
+		start--
+	}
+	reader := bufio.NewReaderSize(io.NewSectionReader(l.file, start, l.size-start), readSize)
+	if offset > 0 {
+		skipped, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return l.size, nil, nil
+		} else if err != nil {
+			return 0, nil, err
+		}
+		start += int64(len(skipped))
+	}
+	line, err := reader.ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return 0, nil, err
+	}
+	if len(line) == 0 {
+		return start, nil, nil
+	}
+	return start, line, nil
+}
+
+// lineHash returns the hash at the start of a line, without the count or newline after it.
+func lineHash(line []byte) []byte {
+	if end := bytes.IndexAny(line, ":\r\n"); end >= 0 {
+		return line[:end]
+	}
+	return line
+}
+
+// linePrefix returns the part of the line's hash which decides its range, in uppercase.
+func linePrefix(line []byte) []byte {
+	hash := lineHash(line)
+	return bytes.ToUpper(hash[:min(len(hash), hashPrefixLength)])
+}
@@ -1,90 +1,110 @@
 package passwords
 
 import (
-	"crypto/rand"
-	"crypto/subtle"
-	"encoding/base64"
+	"context"
 	"errors"
-	"fmt"
 	"strings"
-	"sync"
 
 	"github.com/wikisophia/api/server/config"
-	"golang.org/x/crypto/argon2"
+	"github.com/wikisophia/api/server/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/crypto/bcrypt"
 )
 
+// Algorithm is one way of hashing passwords.
+// Each hash it makes must start with one of its Prefixes, so that the Hasher knows which Algorithm can check it.
+type Algorithm interface {
+	// Prefixes lists the ways this Algorithm's hashes can start, like "$argon2id$".
+	Prefixes() []string
+	// Hash hashes a value with a new random salt, and returns a string which encodes the params and salt too.
+	Hash(value string) (string, error)
+	// Matches returns true if the value matches the hash, and false otherwise.
+	// An error will be thrown if the hash isn't formatted properly.
+	Matches(value string, hash string) (bool, error)
+	// Outdated returns true if the hash was made with weaker params than this Algorithm uses now.
+	Outdated(hash string) bool
+}
+
+// describer is implemented by Algorithms which can describe a hash's cost in traces.
+type describer interface {
+	attributes(hash string) []attribute.KeyValue
+}
+
 // Hasher can hash and verify hashes of incoming strings.
 // Create these with the NewHasher() function
 type Hasher struct {
-	params config.Hash
-	salts  *sync.Pool
+	current    Algorithm
+	algorithms []Algorithm
 }
 
 // NewHasher makes a Hasher which runs Argon2 with the given params.
+//
+// It can also check bcrypt hashes, since that's what most other systems store.
+// Accounts imported from them get upgraded to Argon2 the next time they log in.
 func NewHasher(params config.Hash) *Hasher {
+	return NewHasherWithAlgorithms(NewArgon2id(params), Bcrypt{Cost: bcrypt.DefaultCost})
+}
+
+// NewHasherWithAlgorithms makes a Hasher which hashes new values with current.
+// It can check hashes made by current or any of the legacy Algorithms.
+func NewHasherWithAlgorithms(current Algorithm, legacy ...Algorithm) *Hasher {
 	return &Hasher{
-		params: params,
-		salts: &sync.Pool{
-			New: func() interface{} {
-				return make([]byte, params.SaltLength)
-			},
-		},
+		current:    current,
+		algorithms: append([]Algorithm{current}, legacy...),
 	}
 }
 
 // Hash hashes a string and returns the hashed value.
-func (h *Hasher) Hash(value string) (string, error) {
-	salt := h.salts.Get().([]byte)
-	defer h.salts.Put(salt)
-	if _, err := rand.Read(salt); err != nil {
+func (h *Hasher) Hash(ctx context.Context, value string) (hash string, err error) {
+	_, span := tracing.Start(ctx, "Hasher.Hash")
+	defer func() { tracing.End(span, err) }()
+	hash, err = h.current.Hash(value)
+	if err != nil {
 		return "", err
 	}
-	return h.doHash([]byte(value), salt, h.params.Time, h.params.Memory, h.params.Parallelism, h.params.KeyLength), nil
+	span.SetAttributes(describe(h.current, hash)...)
+	return hash, nil
 }
 
 // Matches returns true if the value matches the hash, and false otherwise.
-// An error will be thrown if the hash isn't formatted properly. This shouldn't happen with hashes generated
-// by the Hash() function
-func (h *Hasher) Matches(value string, hash string) (bool, error) {
-	parts := strings.Split(hash, "$")
-	if len(parts) != 6 {
-		return false, errors.New("hash does not have the five expected $ symbols")
-	}
-
-	var version int
-	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
-		return false, errors.New("failed to parse the hash version")
-	}
-	if version != argon2.Version {
-		return false, fmt.Errorf("the golang library implements hash version %d, but the password was hashed with %d", argon2.Version, version)
-	}
-
-	var memory uint32
-	var time uint32
-	var parallelism uint8
-	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &parallelism); err != nil {
-		return false, errors.New("Could not parse the time, memory, and parallelism params from the hashed value")
+// An error will be thrown if the hash isn't formatted properly, or wasn't made by one of the Hasher's Algorithms.
+// This shouldn't happen with hashes generated by the Hash() function
+func (h *Hasher) Matches(ctx context.Context, value string, hash string) (matches bool, err error) {
+	_, span := tracing.Start(ctx, "Hasher.Matches")
+	defer func() { tracing.End(span, err) }()
+	algorithm := h.algorithmFor(hash)
+	if algorithm == nil {
+		return false, errors.New("the hash does not start with the prefix of a known algorithm")
 	}
+	span.SetAttributes(describe(algorithm, hash)...)
+	return algorithm.Matches(value, hash)
+}
 
-	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
-	if err != nil {
-		return false, errors.New("salt was not base64 encoded properly")
-	}
+// NeedsRehash returns true if the hash should be replaced with a new Hash of the same value.
+// This happens if it was made by a legacy Algorithm, or with weaker params than the current one uses.
+// Callers should only check this after Matches returns true.
+func (h *Hasher) NeedsRehash(hash string) bool {
+	algorithm := h.algorithmFor(hash)
+	return algorithm != h.current || algorithm.Outdated(hash)
+}
 
-	key, err := base64.RawStdEncoding.DecodeString(parts[5])
-	if err != nil {
-		return false, errors.New("hash was not base64 encoded properly")
+// algorithmFor returns the Algorithm which made the hash, or nil if none of them did.
+func (h *Hasher) algorithmFor(hash string) Algorithm {
+	for _, algorithm := range h.algorithms {
+		for _, prefix := range algorithm.Prefixes() {
+			if strings.HasPrefix(hash, prefix) {
+				return algorithm
+			}
+		}
 	}
-
-	thisHashedValue := h.doHash([]byte(value), []byte(salt), time, memory, parallelism, uint32(len(key)))
-
-	// ConstantTimeCompare to help protect against timing attacks
-	return subtle.ConstantTimeCompare([]byte(hash), []byte(thisHashedValue)) == 1, nil
+	return nil
 }
 
-func (h *Hasher) doHash(value []byte, salt []byte, time uint32, memory uint32, parallelism uint8, keyLength uint32) string {
-	key := argon2.IDKey([]byte(value), salt, time, memory, parallelism, keyLength)
-	encodedSalt := base64.RawStdEncoding.EncodeToString(salt)
-	encodedKey := base64.RawStdEncoding.EncodeToString(key)
-	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, memory, time, parallelism, encodedSalt, encodedKey)
+// describe returns the attributes which describe the hash's cost, since it dominates the time spent in these spans.
+func describe(algorithm Algorithm, hash string) []attribute.KeyValue {
+	attributes := []attribute.KeyValue{attribute.String("hash.algorithm", algorithm.Prefixes()[0])}
+	if describer, ok := algorithm.(describer); ok {
+		attributes = append(attributes, describer.attributes(hash)...)
+	}
+	return attributes
 }
@@ -1,6 +1,7 @@
 package passwords_test
 
 import (
+	"context"
 	"math/rand"
 	"sync"
 	"testing"
@@ -9,6 +10,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"github.com/wikisophia/api/server/config"
 	"github.com/wikisophia/api/server/passwords"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestHasher(t *testing.T) {
@@ -43,15 +45,75 @@ func doHashTests(t *testing.T, hasher *passwords.Hasher, wg *sync.WaitGroup) {
 
 func assertMatches(t *testing.T, hasher *passwords.Hasher, value string, wg *sync.WaitGroup) {
 	t.Helper()
-	hash, err := hasher.Hash(value)
+	hash, err := hasher.Hash(context.Background(), value)
 	require.NoError(t, err)
 
-	matches, err := hasher.Matches(value, hash)
+	matches, err := hasher.Matches(context.Background(), value, hash)
 	require.NoError(t, err)
 	assert.True(t, matches)
 
-	matches, err = hasher.Matches("some other value", hash)
+	matches, err = hasher.Matches(context.Background(), "some other value", hash)
 	require.NoError(t, err)
 	assert.False(t, matches)
 	wg.Done()
 }
+
+func TestNeedsRehash(t *testing.T) {
+	weak := config.Hash{
+		Time:        1,
+		Memory:      1024,
+		Parallelism: 1,
+		SaltLength:  16,
+		KeyLength:   16,
+	}
+	weakHash, err := passwords.NewHasher(weak).Hash(context.Background(), "password")
+	require.NoError(t, err)
+
+	assert.False(t, passwords.NewHasher(weak).NeedsRehash(weakHash))
+	stronger := map[string]func(params *config.Hash){
+		"time":        func(params *config.Hash) { params.Time++ },
+		"memory":      func(params *config.Hash) { params.Memory *= 2 },
+		"parallelism": func(params *config.Hash) { params.Parallelism++ },
+		"salt length": func(params *config.Hash) { params.SaltLength++ },
+		"key length":  func(params *config.Hash) { params.KeyLength++ },
+	}
+	for name, strengthen := range stronger {
+		params := weak
+		strengthen(&params)
+		hasher := passwords.NewHasher(params)
+		assert.True(t, hasher.NeedsRehash(weakHash), "a hash with a smaller %s should be rehashed", name)
+		matches, err := hasher.Matches(context.Background(), "password", weakHash)
+		require.NoError(t, err)
+		assert.True(t, matches, "old hashes should still match after the %s changes", name)
+	}
+}
+
+func TestLegacyAlgorithms(t *testing.T) {
+	params := config.Hash{
+		Time:        1,
+		Memory:      1024,
+		Parallelism: 1,
+		SaltLength:  16,
+		KeyLength:   16,
+	}
+	bcryptHash, err := passwords.Bcrypt{Cost: bcrypt.MinCost}.Hash("password")
+	require.NoError(t, err)
+
+	hasher := passwords.NewHasher(params)
+	matches, err := hasher.Matches(context.Background(), "password", bcryptHash)
+	require.NoError(t, err)
+	assert.True(t, matches)
+	matches, err = hasher.Matches(context.Background(), "some other value", bcryptHash)
+	require.NoError(t, err)
+	assert.False(t, matches)
+	assert.True(t, hasher.NeedsRehash(bcryptHash), "hashes from legacy algorithms should be rehashed")
+
+	bcryptHasher := passwords.NewHasherWithAlgorithms(passwords.Bcrypt{Cost: bcrypt.MinCost}, passwords.NewArgon2id(params))
+	assert.False(t, bcryptHasher.NeedsRehash(bcryptHash))
+	assert.True(t, passwords.NewHasherWithAlgorithms(passwords.Bcrypt{Cost: bcrypt.MinCost + 1}).NeedsRehash(bcryptHash))
+
+	_, err = passwords.NewHasherWithAlgorithms(passwords.NewArgon2id(params)).Matches(context.Background(), "password", bcryptHash)
+	assert.Error(t, err, "hashes from unknown algorithms shouldn't match")
+	_, err = hasher.Matches(context.Background(), "password", "password")
+	assert.Error(t, err, "raw passwords shouldn't match")
+}
@@ -0,0 +1,110 @@
+package passwords
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/config"
+)
+
+// Policy implements accounts.PasswordPolicy with the rules in a config.PasswordPolicy.
+// Create these with the NewPolicy() function. It's safe for concurrent use.
+type Policy struct {
+	cfg      config.PasswordPolicy
+	breached *BreachedList
+}
+
+// NewPolicy makes a Policy, opening the breached password list if there is one.
+// Call Close once the Policy is no longer in use.
+func NewPolicy(cfg config.PasswordPolicy) (*Policy, error) {
+	policy := &Policy{
+		cfg: cfg,
+	}
+	if cfg.BreachedListPath != "" {
+		breached, err := OpenBreachedList(cfg.BreachedListPath)
+		if err != nil {
+			return nil, err
+		}
+		policy.breached = breached
+	}
+	return policy, nil
+}
+
+// Check returns an accounts.ProhibitedPasswordError listing every rule the password breaks.
+// It only returns other errors if the breached password list can't be read.
+func (p *Policy) Check(email, password string) error {
+	var reasons []string
+	if length := utf8.RuneCountInString(password); length < p.cfg.MinLength {
+		reasons = append(reasons, fmt.Sprintf("must be at least %d characters", p.cfg.MinLength))
+	} else if length > p.cfg.MaxLength {
+		// The other checks take longer for longer passwords, so don't let huge ones get to them.
+		return accounts.ProhibitedPasswordError{Reasons: []string{fmt.Sprintf("must be at most %d characters", p.cfg.MaxLength)}}
+	}
+	if p.cfg.RejectSimilarToEmail && similarToEmail(email, password) {
+		reasons = append(reasons, "is too similar to the email")
+	}
+	if p.breached != nil {
+		breached, err := p.breached.Contains(password)
+		if err != nil {
+			return fmt.Errorf("failed to check the breached password list: %v", err)
+		}
+		if breached {
+			reasons = append(reasons, "has appeared in a data breach")
+		}
+	}
+	if len(reasons) > 0 {
+		return accounts.ProhibitedPasswordError{Reasons: reasons}
+	}
+	return nil
+}
+
+// Close closes the breached password list, if there is one.
+func (p *Policy) Close() error {
+	if p.breached == nil {
+		return nil
+	}
+	return p.breached.Close()
+}
+
+// similarToEmail returns true if the password contains the email's name or vice versa,
+// or if it's only a few typos away from the name. Case is ignored.
+func similarToEmail(email, password string) bool {
+	email = strings.ToLower(email)
+	password = strings.ToLower(password)
+	name := email
+	if at := strings.LastIndex(email, "@"); at >= 0 {
+		name = email[:at]
+	}
+	// Very short names would match too many good passwords.
+	if utf8.RuneCountInString(name) < 3 || password == "" {
+		return false
+	}
+	if strings.Contains(password, name) || strings.Contains(name, password) {
+		return true
+	}
+	return editDistance(name, password) <= utf8.RuneCountInString(name)/4
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	first, second := []rune(a), []rune(b)
+	previous := make([]int, len(second)+1)
+	current := make([]int, len(second)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(first); i++ {
+		current[0] = i
+		for j := 1; j <= len(second); j++ {
+			cost := 1
+			if first[i-1] == second[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(second)]
+}
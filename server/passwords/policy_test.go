@@ -0,0 +1,147 @@
+package passwords_test
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/config"
+	"github.com/wikisophia/api/server/passwords"
+)
+
+func TestPolicyReasons(t *testing.T) {
+	list := writeBreachedList(t, []string{"password123", "letmein!!"}, 500, ":%d\n")
+	policy, err := passwords.NewPolicy(config.PasswordPolicy{
+		MinLength:            8,
+		MaxLength:            20,
+		BreachedListPath:     list,
+		RejectSimilarToEmail: true,
+	})
+	require.NoError(t, err)
+	defer policy.Close()
+
+	tests := map[string][]string{
+		"correct horse":                     nil,
+		"":                                  {"must be at least 8 characters"},
+		"short":                             {"must be at least 8 characters"},
+		"ünïcödé":                           {"must be at least 8 characters"},
+		"ünïcödé!":                          nil,
+		strings.Repeat("x", 21):             {"must be at most 20 characters"},
+		"password123":                       {"has appeared in a data breach"},
+		"Gandalf-the-grey":                  {"is too similar to the email"},
+		"gandolf":                           {"must be at least 8 characters", "is too similar to the email"},
+		"gandalf@soph.wiki":                 {"is too similar to the email"},
+		"letmein!!":                         {"has appeared in a data breach"},
+		"letmein!!!":                        nil,
+		strings.Repeat("ab", 11):            {"must be at most 20 characters"},
+		"gandalf" + strings.Repeat("!", 14): {"must be at most 20 characters"},
+	}
+	for password, reasons := range tests {
+		err := policy.Check("gandalf@soph.wiki", password)
+		if reasons == nil {
+			assert.NoError(t, err, "%q should be allowed", password)
+			continue
+		}
+		var prohibited accounts.ProhibitedPasswordError
+		if assert.True(t, errors.As(err, &prohibited), "%q should be prohibited", password) {
+			assert.Equal(t, reasons, prohibited.Reasons, "wrong reasons for %q", password)
+		}
+	}
+}
+
+func TestPolicyEmailCheckOptional(t *testing.T) {
+	policy, err := passwords.NewPolicy(config.PasswordPolicy{
+		MinLength: 8,
+		MaxLength: 20,
+	})
+	require.NoError(t, err)
+	assert.NoError(t, policy.Check("gandalf@soph.wiki", "gandalf-the-grey"))
+}
+
+func TestPolicyMissingListFails(t *testing.T) {
+	_, err := passwords.NewPolicy(config.PasswordPolicy{
+		MinLength:        8,
+		MaxLength:        20,
+		BreachedListPath: filepath.Join(t.TempDir(), "missing.txt"),
+	})
+	assert.Error(t, err)
+}
+
+func TestBreachedList(t *testing.T) {
+	formats := map[string]string{
+		"counts":    ":%d\n",
+		"no counts": "\n",
+		"crlf":      ":%d\r\n",
+	}
+	for name, format := range formats {
+		t.Run(name, func(t *testing.T) {
+			breached := []string{"password", "123456", "qwerty", "hunter2", ""}
+			list, err := passwords.OpenBreachedList(writeBreachedList(t, breached, 2000, format))
+			require.NoError(t, err)
+			defer list.Close()
+
+			for _, password := range breached {
+				contains, err := list.Contains(password)
+				require.NoError(t, err)
+				assert.True(t, contains, "%q should be in the list", password)
+			}
+			for i := 0; i < 100; i++ {
+				contains, err := list.Contains(fmt.Sprintf("not-breached-%d", i))
+				require.NoError(t, err)
+				assert.False(t, contains)
+			}
+		})
+	}
+}
+
+func TestEmptyBreachedList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "empty.txt")
+	require.NoError(t, os.WriteFile(path, nil, 0600))
+	list, err := passwords.OpenBreachedList(path)
+	require.NoError(t, err)
+	defer list.Close()
+	contains, err := list.Contains("password")
+	require.NoError(t, err)
+	assert.False(t, contains)
+}
+
+// writeBreachedList writes a sorted list with the hashes of breached, plus filler more passwords,
+// and returns its path. format is used to write each line's ending. It may include the line's number as a count.
+func writeBreachedList(t *testing.T, breached []string, filler int, format string) string {
+	t.Helper()
+	var hashes []string
+	for _, password := range breached {
+		hashes = append(hashes, sha1Hex(password))
+	}
+	for i := 0; i < filler; i++ {
+		hashes = append(hashes, sha1Hex(fmt.Sprintf("filler-%d", i)))
+	}
+	sort.Strings(hashes)
+
+	var contents strings.Builder
+	for i, hash := range hashes {
+		contents.WriteString(hash)
+		if strings.Contains(format, "%d") {
+			fmt.Fprintf(&contents, format, i+1)
+		} else {
+			contents.WriteString(format)
+		}
+	}
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	require.NoError(t, os.WriteFile(path, []byte(contents.String()), 0600))
+	return path
+}
+
+func sha1Hex(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
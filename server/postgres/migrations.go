@@ -0,0 +1,123 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/wikisophia/api/server/migrations"
+)
+
+const createVersionTableQuery = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+  version integer PRIMARY KEY,
+  name text NOT NULL,
+  applied_on TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+`
+
+const appliedVersionsQuery = `SELECT version, applied_on FROM schema_migrations;`
+const recordMigrationQuery = `INSERT INTO schema_migrations (version, name) VALUES ($1, $2);`
+const forgetMigrationQuery = `DELETE FROM schema_migrations WHERE version = $1;`
+
+// migrationLockID is an arbitrary key for pg_advisory_lock, so that two servers starting
+// at the same time don't both try to apply the same migrations.
+const migrationLockID = 7369021
+
+// NewMigrator makes a Migrator which runs the migrations on the pool's database.
+//
+// The migrations can refer to the app's database role with a psql-style variable
+// named roleVariable (e.g. ":accountsUser"), so that they can grant it privileges.
+// It will be replaced with appUser, which may be different from the role in the pool
+// if the migrations are being run by an admin.
+func NewMigrator(pool *pgxpool.Pool, appUser string, loaded []migrations.Migration, roleVariable string) *migrations.Migrator {
+	role := regexp.MustCompile(regexp.QuoteMeta(roleVariable) + `\b`)
+	quotedUser := pgx.Identifier{appUser}.Sanitize()
+	return migrations.NewMigrator(&migrationDatabase{
+		pool: pool,
+	}, loaded, func(sql string) string {
+		return role.ReplaceAllLiteralString(sql, quotedUser)
+	})
+}
+
+type migrationDatabase struct {
+	pool *pgxpool.Pool
+}
+
+func (db *migrationDatabase) Lock(ctx context.Context) (func(), error) {
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
+		conn.Release()
+		return nil, fmt.Errorf("failed to acquire the migration lock: %v", err)
+	}
+	return func() {
+		if _, err := conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockID); err != nil {
+			log.Printf("ERROR: Failed to release the migration lock: %v", err)
+		}
+		conn.Release()
+	}, nil
+}
+
+func (db *migrationDatabase) EnsureVersionTable(ctx context.Context) error {
+	if _, err := db.pool.Exec(ctx, createVersionTableQuery); err != nil {
+		return fmt.Errorf("failed to create the schema_migrations table: %v", err)
+	}
+	return nil
+}
+
+func (db *migrationDatabase) AppliedVersions(ctx context.Context) (map[int]time.Time, error) {
+	rows, err := db.pool.Query(ctx, appliedVersionsQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %v", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedOn time.Time
+		if err := rows.Scan(&version, &appliedOn); err != nil {
+			return nil, fmt.Errorf("schema_migrations scan failed: %v", err)
+		}
+		applied[version] = appliedOn
+	}
+	return applied, rows.Err()
+}
+
+func (db *migrationDatabase) Apply(ctx context.Context, migration migrations.Migration, sql string, up bool) error {
+	transaction, err := db.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	if sql != "" {
+		if _, err := transaction.Exec(ctx, sql); rollbackIfErr(ctx, transaction, err) {
+			return err
+		}
+	}
+	if up {
+		_, err = transaction.Exec(ctx, recordMigrationQuery, migration.Version, migration.Name)
+	} else {
+		_, err = transaction.Exec(ctx, forgetMigrationQuery, migration.Version)
+	}
+	if rollbackIfErr(ctx, transaction, err) {
+		return err
+	}
+	return transaction.Commit(ctx)
+}
+
+func rollbackIfErr(ctx context.Context, transaction pgx.Tx, err error) bool {
+	if err != nil {
+		if rollbackErr := transaction.Rollback(ctx); rollbackErr != nil {
+			log.Printf("ERROR: Failed to rollback transaction: %v", rollbackErr)
+		}
+		return true
+	}
+	return false
+}
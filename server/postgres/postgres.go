@@ -53,6 +53,13 @@ func buildConnectionString(cfg *config.Postgres) string {
 		buffer.WriteString(" ")
 	}
 
+	// Unrecognized settings like this one are sent to Postgres as run-time parameters.
+	if cfg.StatementTimeoutMillis > 0 {
+		buffer.WriteString("statement_timeout=")
+		buffer.WriteString(strconv.Itoa(cfg.StatementTimeoutMillis))
+		buffer.WriteString(" ")
+	}
+
 	buffer.WriteString("sslmode=disable")
 	return buffer.String()
 }
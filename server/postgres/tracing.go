@@ -0,0 +1,33 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/wikisophia/api/server/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// StartSpan begins a span for a store operation. It records how busy the pool was
+// when the operation started, since a slow operation may have just been waiting for a connection.
+func StartSpan(ctx context.Context, pool *pgxpool.Pool, name string) (context.Context, trace.Span) {
+	stat := pool.Stat()
+	return tracing.Start(ctx, name,
+		semconv.DBSystemPostgreSQL,
+		attribute.Int("db.pool.acquired_conns", int(stat.AcquiredConns())),
+		attribute.Int("db.pool.idle_conns", int(stat.IdleConns())),
+		attribute.Int("db.pool.max_conns", int(stat.MaxConns())),
+	)
+}
+
+// BeginTx starts a transaction on a connection from the pool.
+// Its span covers the wait for a connection.
+func BeginTx(ctx context.Context, pool *pgxpool.Pool) (pgx.Tx, error) {
+	ctx, span := tracing.Start(ctx, "pgxpool.BeginTx")
+	tx, err := pool.BeginTx(ctx, pgx.TxOptions{})
+	tracing.End(span, err)
+	return tx, err
+}
@@ -0,0 +1,106 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/wikisophia/api/server/migrations"
+)
+
+const createVersionTableQuery = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+  version INTEGER PRIMARY KEY,
+  name TEXT NOT NULL,
+  applied_on INTEGER NOT NULL
+);
+`
+
+const appliedVersionsQuery = `SELECT version, applied_on FROM schema_migrations;`
+const recordMigrationQuery = `INSERT INTO schema_migrations (version, name, applied_on) VALUES (?, ?, ?);`
+const forgetMigrationQuery = `DELETE FROM schema_migrations WHERE version = ?;`
+
+// NewMigrator makes a Migrator which runs the migrations on the database.
+func NewMigrator(db *sql.DB, loaded []migrations.Migration) *migrations.Migrator {
+	return migrations.NewMigrator(&migrationDatabase{
+		db: db,
+	}, loaded, nil)
+}
+
+// Migrate brings the database's schema up to date.
+// SQLite databases are local files with no admin to run migrations, so the stores do this when they open.
+func Migrate(db *sql.DB, loaded []migrations.Migration) error {
+	_, err := NewMigrator(db, loaded).Up(context.Background())
+	return err
+}
+
+type migrationDatabase struct {
+	db *sql.DB
+}
+
+// Lock doesn't need to do anything. SQLite only allows one write transaction at a time,
+// and each migration runs in one. If two processes race to apply the same migration,
+// the loser's INSERT into schema_migrations fails and its transaction is rolled back.
+func (db *migrationDatabase) Lock(ctx context.Context) (func(), error) {
+	return func() {}, nil
+}
+
+func (db *migrationDatabase) EnsureVersionTable(ctx context.Context) error {
+	if _, err := db.db.ExecContext(ctx, createVersionTableQuery); err != nil {
+		return fmt.Errorf("failed to create the schema_migrations table: %v", err)
+	}
+	return nil
+}
+
+func (db *migrationDatabase) AppliedVersions(ctx context.Context) (map[int]time.Time, error) {
+	rows, err := db.db.QueryContext(ctx, appliedVersionsQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %v", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedOn int64
+		if err := rows.Scan(&version, &appliedOn); err != nil {
+			return nil, fmt.Errorf("schema_migrations scan failed: %v", err)
+		}
+		applied[version] = time.Unix(appliedOn, 0)
+	}
+	return applied, rows.Err()
+}
+
+func (db *migrationDatabase) Apply(ctx context.Context, migration migrations.Migration, sql string, up bool) error {
+	transaction, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if sql != "" {
+		if _, err := transaction.ExecContext(ctx, sql); RollbackIfErr(transaction, err) {
+			return err
+		}
+	}
+	if up {
+		_, err = transaction.ExecContext(ctx, recordMigrationQuery, migration.Version, migration.Name, time.Now().Unix())
+	} else {
+		_, err = transaction.ExecContext(ctx, forgetMigrationQuery, migration.Version)
+	}
+	if RollbackIfErr(transaction, err) {
+		return err
+	}
+	return transaction.Commit()
+}
+
+// RollbackIfErr rolls back the transaction if err is non-nil, and returns true if it did.
+func RollbackIfErr(transaction *sql.Tx, err error) bool {
+	if err != nil {
+		if rollbackErr := transaction.Rollback(); rollbackErr != nil {
+			log.Printf("ERROR: Failed to rollback transaction: %v", rollbackErr)
+		}
+		return true
+	}
+	return false
+}
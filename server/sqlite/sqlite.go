@@ -0,0 +1,56 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/url"
+
+	"github.com/wikisophia/api/server/config"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Make a new SQLite connection pool. The file will be created if it doesn't exist.
+func NewDB(cfg *config.SQLite) *sql.DB {
+	db, err := Open(cfg.Path)
+	if err != nil {
+		log.Fatalf("Failed to open sqlite database %s: %v", cfg.Path, err)
+	}
+	return db
+}
+
+// Open opens the database file at path, and makes sure it's usable.
+func Open(path string) (*sql.DB, error) {
+	// The pure-Go driver registers itself as "sqlite", so the app doesn't need cgo.
+	db, err := sql.Open("sqlite", buildDataSourceName(path))
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// buildDataSourceName configures every connection in the pool the same way.
+//
+// SQLite only allows one writer at a time. WAL mode lets readers work alongside it,
+// busy_timeout makes other writers wait rather than fail, and immediate transactions
+// take the write lock up front so that two transactions can't deadlock upgrading to it.
+func buildDataSourceName(path string) string {
+	params := url.Values{}
+	params.Add("_pragma", "foreign_keys(1)")
+	params.Add("_pragma", "busy_timeout(5000)")
+	params.Add("_pragma", "journal_mode(WAL)")
+	params.Set("_txlock", "immediate")
+	// The path is escaped so that a "?", "#" or "%" in it isn't read as part of the URI's syntax.
+	return (&url.URL{Scheme: "file", Opaque: url.PathEscape(path), RawQuery: params.Encode()}).String()
+}
+
+// IsUniqueViolation returns true if err came from a UNIQUE constraint failing.
+func IsUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+}
@@ -0,0 +1,30 @@
+package sqlite_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wikisophia/api/server/sqlite"
+)
+
+func TestOpenOddPaths(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "odd?name#1%20.db")
+	db, err := sqlite.Open(path)
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec("CREATE TABLE things (id INTEGER PRIMARY KEY);")
+	require.NoError(t, err)
+
+	_, err = os.Stat(path)
+	assert.NoError(t, err, "the database should be at the exact path")
+	_, err = os.Stat(filepath.Join(dir, "odd"))
+	assert.True(t, os.IsNotExist(err), "the path shouldn't be cut off at the ?")
+
+	var foreignKeys int
+	require.NoError(t, db.QueryRow("PRAGMA foreign_keys;").Scan(&foreignKeys))
+	assert.Equal(t, 1, foreignKeys, "the connection parameters should still apply")
+}
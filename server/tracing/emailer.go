@@ -0,0 +1,63 @@
+package tracing
+
+import (
+	"context"
+	"time"
+
+	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/accounts/email"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// NewEmailer returns an Emailer which records a span for each email that emailer sends.
+func NewEmailer(emailer email.Emailer) email.Emailer {
+	return &tracingEmailer{
+		emailer: emailer,
+	}
+}
+
+type tracingEmailer struct {
+	emailer email.Emailer
+}
+
+func (e *tracingEmailer) SendWelcome(ctx context.Context, account accounts.Account) error {
+	ctx, span := Start(ctx, "Emailer.SendWelcome", attribute.Int64("account.id", account.ID))
+	err := e.emailer.SendWelcome(ctx, account)
+	End(span, err)
+	return err
+}
+
+func (e *tracingEmailer) SendReset(ctx context.Context, account accounts.Account) error {
+	ctx, span := Start(ctx, "Emailer.SendReset", attribute.Int64("account.id", account.ID))
+	err := e.emailer.SendReset(ctx, account)
+	End(span, err)
+	return err
+}
+
+func (e *tracingEmailer) SendVerification(ctx context.Context, account accounts.Account) error {
+	ctx, span := Start(ctx, "Emailer.SendVerification", attribute.Int64("account.id", account.ID))
+	err := e.emailer.SendVerification(ctx, account)
+	End(span, err)
+	return err
+}
+
+func (e *tracingEmailer) SendLocked(ctx context.Context, account accounts.Account, until time.Time) error {
+	ctx, span := Start(ctx, "Emailer.SendLocked", attribute.Int64("account.id", account.ID))
+	err := e.emailer.SendLocked(ctx, account, until)
+	End(span, err)
+	return err
+}
+
+func (e *tracingEmailer) SendEmailChange(ctx context.Context, account accounts.Account) error {
+	ctx, span := Start(ctx, "Emailer.SendEmailChange", attribute.Int64("account.id", account.ID))
+	err := e.emailer.SendEmailChange(ctx, account)
+	End(span, err)
+	return err
+}
+
+func (e *tracingEmailer) SendEmailChangeNotice(ctx context.Context, account accounts.Account) error {
+	ctx, span := Start(ctx, "Emailer.SendEmailChangeNotice", attribute.Int64("account.id", account.ID))
+	err := e.emailer.SendEmailChangeNotice(ctx, account)
+	End(span, err)
+	return err
+}
@@ -0,0 +1,134 @@
+// Package tracing records OpenTelemetry spans, so that slow requests can be broken down
+// into the queries, hashes and emails which they waited on.
+//
+// Spans are recorded by the global TracerProvider. Until Start sets one up, it's a no-op,
+// so tests and commands don't pay for spans which nobody reads.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/wikisophia/api/server/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ServiceName identifies this app's spans in the tracing backend.
+const ServiceName = "wikisophia-api"
+
+// instrumentationName identifies the code which made the spans.
+const instrumentationName = "github.com/wikisophia/api/server"
+
+// Setup makes the global TracerProvider export spans as configured.
+// The returned function flushes any spans which haven't been exported yet. Call it before exiting.
+func Setup(ctx context.Context, cfg *config.Tracing) (func(context.Context) error, error) {
+	if cfg.Exporter == config.TracingExporterNone {
+		return func(context.Context) error { return nil }, nil
+	}
+	exporter, closeOutput, err := newExporter(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName(ServiceName)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe the tracing resource: %v", err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(float64(cfg.SamplePercent)/100))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if closeErr := closeOutput(); err == nil {
+			err = closeErr
+		}
+		return err
+	}, nil
+}
+
+// newExporter makes the configured exporter, and a function which closes its output.
+func newExporter(ctx context.Context, cfg *config.Tracing) (sdktrace.SpanExporter, func() error, error) {
+	switch cfg.Exporter {
+	case config.TracingExporterOTLP:
+		var options []otlptracehttp.Option
+		if cfg.OTLPEndpoint != "" {
+			options = append(options, otlptracehttp.WithEndpoint(cfg.OTLPEndpoint))
+		}
+		if cfg.OTLPInsecure {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+		exporter, err := otlptracehttp.New(ctx, options...)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to make the OTLP exporter: %v", err)
+		}
+		return exporter, func() error { return nil }, nil
+	case config.TracingExporterStdout:
+		var output io.WriteCloser = nopCloser{os.Stdout}
+		if cfg.FilePath != "" {
+			file, err := os.OpenFile(cfg.FilePath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to open %s for spans: %v", cfg.FilePath, err)
+			}
+			output = file
+		}
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(output))
+		if err != nil {
+			output.Close()
+			return nil, nil, fmt.Errorf("failed to make the stdout exporter: %v", err)
+		}
+		return exporter, output.Close, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown tracing exporter %q. This should be caught during config validation", cfg.Exporter)
+	}
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// Start begins a span, as a child of the one in ctx if there is one.
+// Pass the returned context to anything which the span should include.
+func Start(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// End ends the span. If err isn't nil, the span is marked as failed.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// StartRequest begins a span for an incoming request.
+// If the caller sent a traceparent header, the span joins the caller's trace.
+func StartRequest(r *http.Request) (context.Context, trace.Span) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	return otel.Tracer(instrumentationName).Start(ctx, r.Method,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(r.Method),
+			semconv.URLPath(r.URL.Path),
+		),
+	)
+}
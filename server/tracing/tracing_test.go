@@ -0,0 +1,127 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wikisophia/api/server/accounts"
+	"github.com/wikisophia/api/server/config"
+	"github.com/wikisophia/api/server/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestEndMarksErrors(t *testing.T) {
+	recorder := useRecorder(t)
+	_, span := tracing.Start(context.Background(), "works")
+	tracing.End(span, nil)
+	_, span = tracing.Start(context.Background(), "fails")
+	tracing.End(span, errors.New("connection refused"))
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+	assert.Equal(t, "connection refused", spans[1].Status().Description)
+}
+
+func TestStartNestsSpans(t *testing.T) {
+	recorder := useRecorder(t)
+	ctx, parent := tracing.Start(context.Background(), "parent")
+	_, child := tracing.Start(ctx, "child")
+	child.End()
+	parent.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	assert.Equal(t, spans[1].SpanContext().SpanID(), spans[0].Parent().SpanID())
+}
+
+func TestEmailer(t *testing.T) {
+	recorder := useRecorder(t)
+	emailer := tracing.NewEmailer(failingEmailer{})
+	assert.Error(t, emailer.SendWelcome(context.Background(), accounts.Account{ID: 3}))
+	assert.Error(t, emailer.SendReset(context.Background(), accounts.Account{ID: 3}))
+	assert.Error(t, emailer.SendVerification(context.Background(), accounts.Account{ID: 3}))
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+	assert.Equal(t, "Emailer.SendWelcome", spans[0].Name())
+	assert.Equal(t, "Emailer.SendReset", spans[1].Name())
+	assert.Equal(t, "Emailer.SendVerification", spans[2].Name())
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+}
+
+func TestStdoutExporterWritesFile(t *testing.T) {
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+	path := filepath.Join(t.TempDir(), "spans.json")
+	stop, err := tracing.Setup(context.Background(), &config.Tracing{
+		Exporter:      config.TracingExporterStdout,
+		FilePath:      path,
+		SamplePercent: 100,
+	})
+	require.NoError(t, err)
+	_, span := tracing.Start(context.Background(), "some-operation")
+	span.End()
+	require.NoError(t, stop(context.Background()))
+
+	written, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(written), `"Name":"some-operation"`)
+	assert.Contains(t, string(written), tracing.ServiceName)
+}
+
+func TestSetupNone(t *testing.T) {
+	original := otel.GetTracerProvider()
+	stop, err := tracing.Setup(context.Background(), &config.Tracing{
+		Exporter: config.TracingExporterNone,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, original, otel.GetTracerProvider())
+	assert.NoError(t, stop(context.Background()))
+}
+
+// useRecorder makes the global TracerProvider record spans in memory until the test ends.
+// The global can't be restored once it's set, so a no-op is left behind instead.
+func useRecorder(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+	return recorder
+}
+
+type failingEmailer struct{}
+
+func (failingEmailer) SendWelcome(ctx context.Context, account accounts.Account) error {
+	return errors.New("smtp: connection refused")
+}
+
+func (failingEmailer) SendReset(ctx context.Context, account accounts.Account) error {
+	return errors.New("smtp: connection refused")
+}
+
+func (failingEmailer) SendVerification(ctx context.Context, account accounts.Account) error {
+	return errors.New("smtp: connection refused")
+}
+
+func (failingEmailer) SendLocked(ctx context.Context, account accounts.Account, until time.Time) error {
+	return errors.New("smtp: connection refused")
+}
+
+func (failingEmailer) SendEmailChange(ctx context.Context, account accounts.Account) error {
+	return errors.New("smtp: connection refused")
+}
+
+func (failingEmailer) SendEmailChangeNotice(ctx context.Context, account accounts.Account) error {
+	return errors.New("smtp: connection refused")
+}